@@ -0,0 +1,27 @@
+// reasons-doc writes the documentation of the route status reasons of the
+// router, generated from their registry, to the file given as argument or
+// to the standard output.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+func main() {
+	if len(os.Args) > 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s [file]\n", os.Args[0])
+		os.Exit(2)
+	}
+	if len(os.Args) == 1 {
+		os.Stdout.Write(reasons.Markdown())
+		return
+	}
+	if err := ioutil.WriteFile(os.Args[1], reasons.Markdown(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,185 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/routeconvert"
+	templateplugin "github.com/openshift/router/pkg/router/template"
+)
+
+var previewRoutesLong = heredoc.Doc(`
+	Convert Kubernetes Ingresses and Gateway API HTTPRoutes to routes.
+
+	The routes equivalent to the Ingresses and HTTPRoutes of the manifests are
+	written as YAML documents, together with the haproxy configuration the router
+	generates for each of them, as comments.  The configuration is left out if no
+	router template is set.  What routes cannot express is reported as warnings.
+
+	With a load-test directory, the requests to the routes are also written there
+	for load-testing tools: vegeta targets, a k6 target list, the Host headers and
+	the TLS server names of the routes, and an /etc/hosts file resolving their
+	hosts to the router when its address is set.`)
+
+// PreviewRoutesOptions are the options of the preview-routes command.
+type PreviewRoutesOptions struct {
+	Filenames           []string
+	TemplateFile        string
+	TemplateOverrides   []string
+	WorkingDir          string
+	AllowWildcardRoutes bool
+	LoadTestDir         string
+	LoadTestRouterAddr  string
+
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// newCmdPreviewRoutes returns a command that converts ingresses and
+// httproutes to routes.
+func newCmdPreviewRoutes(out, errOut io.Writer) *cobra.Command {
+	o := &PreviewRoutesOptions{Out: out, ErrOut: errOut}
+
+	cmd := &cobra.Command{
+		Use:   "preview-routes -f FILENAME",
+		Short: "Convert Ingresses and HTTPRoutes to routes",
+		Long:  previewRoutesLong,
+		Example: heredoc.Doc(`
+			# Preview the routes of an ingress and their haproxy configuration
+			openshift-router preview-routes -f ingress.yaml --template /var/lib/haproxy/conf/haproxy-config.template
+
+			# Also write the load-test targets of the routes for a router at 10.0.0.10
+			openshift-router preview-routes -f ingress.yaml --load-test-dir ./load-test --load-test-router-address 10.0.0.10`),
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.Run()
+		},
+	}
+
+	flag := cmd.Flags()
+	flag.StringSliceVarP(&o.Filenames, "filename", "f", nil, "Files with the Ingress and HTTPRoute manifests to convert, - reads the standard input.")
+	flag.StringVar(&o.TemplateFile, "template", env("TEMPLATE_FILE", ""), "The path to the router template used to generate the haproxy configuration of the routes.")
+	flag.StringSliceVar(&o.TemplateOverrides, "template-override", envVarAsStrings("TEMPLATE_OVERRIDES", "", ","), "List of comma separated template override files whose override/global, override/defaults and override/backend sections replace the empty ones of the template. A section may only be defined by one of the files.")
+	flag.StringVar(&o.WorkingDir, "working-dir", "/var/lib/haproxy", "The working directory of the router the configuration is generated for.")
+	flag.BoolVar(&o.AllowWildcardRoutes, "allow-wildcard-routes", isTrue(env("ROUTER_ALLOW_WILDCARD_ROUTES", "")), "Generate the configuration of a router that allows wildcard routes.")
+	flag.StringVar(&o.LoadTestDir, "load-test-dir", "", "The directory to write the load-test artifacts of the routes to: vegeta targets, a k6 target list, the Host headers and the TLS server names of the routes.")
+	flag.StringVar(&o.LoadTestRouterAddr, "load-test-router-address", "", "The address of the router the load tests run against, written to an /etc/hosts file in the load-test directory that resolves the hosts of the routes to it.")
+
+	return cmd
+}
+
+// Run converts the manifests and writes the routes.
+func (o *PreviewRoutesOptions) Run() error {
+	if len(o.Filenames) == 0 {
+		return fmt.Errorf("at least one file is required")
+	}
+
+	var routes []*routev1.Route
+	for _, filename := range o.Filenames {
+		var r []*routev1.Route
+		var warnings []string
+		var err error
+		if filename == "-" {
+			r, warnings, err = routeconvert.Convert(os.Stdin)
+		} else {
+			var f *os.File
+			if f, err = os.Open(filename); err != nil {
+				return err
+			}
+			r, warnings, err = routeconvert.Convert(f)
+			f.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(o.ErrOut, "warning: %s\n", warning)
+		}
+		routes = append(routes, r...)
+	}
+
+	var files []templateplugin.File
+	if len(o.TemplateFile) > 0 {
+		renderer, err := templateplugin.NewRenderer(templateplugin.RendererConfig{
+			TemplatePath:          o.TemplateFile,
+			TemplateOverridePaths: o.TemplateOverrides,
+			WorkingDir:            o.WorkingDir,
+			AllowWildcardRoutes:   o.AllowWildcardRoutes,
+			BindPorts:             true,
+		})
+		if err != nil {
+			return err
+		}
+		files, err = renderer.Render(renderer.RouteState(routes))
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(o.LoadTestDir) > 0 {
+		if err := writeLoadTestArtifacts(o.LoadTestDir, o.LoadTestRouterAddr, routes); err != nil {
+			return err
+		}
+	}
+
+	for _, route := range routes {
+		data, err := yaml.Marshal(route)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "---\n%s", data)
+		if len(o.TemplateFile) > 0 {
+			fmt.Fprintf(o.Out, "# haproxy configuration of route %s/%s:\n", route.Namespace, route.Name)
+			for _, line := range routeConfigFragments(files, route.Namespace+":"+route.Name) {
+				fmt.Fprintf(o.Out, "#   %s\n", line)
+			}
+		}
+	}
+	return nil
+}
+
+// routeConfigFragments returns the sections of the haproxy configuration
+// and the map entries that belong to the route with the given key.
+func routeConfigFragments(files []templateplugin.File, key string) []string {
+	belongs := func(line string) bool {
+		for _, field := range strings.Fields(line) {
+			if strings.HasSuffix(field, ":"+key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var fragments []string
+	for _, file := range files {
+		lines := strings.Split(string(file.Contents), "\n")
+		if file.Name != "conf/haproxy.config" {
+			for _, line := range lines {
+				if belongs(line) {
+					fragments = append(fragments, fmt.Sprintf("%s: %s", file.Name, strings.TrimSpace(line)))
+				}
+			}
+			continue
+		}
+
+		inSection := false
+		for _, line := range lines {
+			// Sections start with an unindented header, the unindented
+			// comments before a header describe the next section.
+			if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+				inSection = line[0] != '#' && belongs(line)
+			}
+			if inSection && len(strings.TrimSpace(line)) > 0 {
+				fragments = append(fragments, line)
+			}
+		}
+	}
+	return fragments
+}
@@ -0,0 +1,124 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// The load-test artifacts written for the routes.
+const (
+	// vegetaTargetsFile lists the requests to the routes in the vegeta
+	// HTTP target format.
+	vegetaTargetsFile = "vegeta-targets.txt"
+	// k6TargetsFile lists the requests to the routes as a JSON array a k6
+	// script can open.
+	k6TargetsFile = "k6-targets.json"
+	// hostHeadersFile lists the Host headers of the routes, one per line.
+	hostHeadersFile = "hosts.txt"
+	// sniFile lists the TLS server names of the routes, one per line.
+	sniFile = "sni.txt"
+	// etcHostsFile resolves the hosts of the routes to the router, in the
+	// /etc/hosts format, when the address of the router is known.
+	etcHostsFile = "etc-hosts"
+)
+
+// loadTestTarget is a request to a route of the load-test artifacts.
+type loadTestTarget struct {
+	// URL is the URL of the request.
+	URL string `json:"url"`
+	// Host is the Host header of the request.
+	Host string `json:"host"`
+	// SNI is the TLS server name of the request, if it uses TLS.
+	SNI string `json:"sni,omitempty"`
+}
+
+// loadTestTargets returns a request to each route with a host, sorted by
+// URL.  The routes that terminate or pass TLS through are requested over
+// HTTPS with their host as the server name.
+func loadTestTargets(routes []*routev1.Route) []loadTestTarget {
+	seen := sets.NewString()
+	var targets []loadTestTarget
+	for _, route := range routes {
+		host := strings.ToLower(route.Spec.Host)
+		if len(host) == 0 {
+			continue
+		}
+		path := route.Spec.Path
+		if len(path) == 0 {
+			path = "/"
+		}
+		target := loadTestTarget{URL: "http://" + host + path, Host: host}
+		if route.Spec.TLS != nil && len(route.Spec.TLS.Termination) > 0 {
+			target.URL = "https://" + host + path
+			target.SNI = host
+		}
+		if seen.Has(target.URL) {
+			continue
+		}
+		seen.Insert(target.URL)
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URL < targets[j].URL })
+	return targets
+}
+
+// writeLoadTestArtifacts writes the load-test artifacts of routes to dir,
+// so that the configuration generated for them can be exercised under load.
+// The /etc/hosts file is only written if the address of the router is set.
+func writeLoadTestArtifacts(dir, routerAddress string, routes []*routev1.Route) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	targets := loadTestTargets(routes)
+
+	var vegeta strings.Builder
+	hosts, serverNames := sets.NewString(), sets.NewString()
+	for _, target := range targets {
+		fmt.Fprintf(&vegeta, "GET %s\nHost: %s\n\n", target.URL, target.Host)
+		hosts.Insert(target.Host)
+		if len(target.SNI) > 0 {
+			serverNames.Insert(target.SNI)
+		}
+	}
+	k6, err := json.MarshalIndent(targets, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := map[string]string{
+		vegetaTargetsFile: vegeta.String(),
+		k6TargetsFile:     string(k6) + "\n",
+		hostHeadersFile:   joinLines(hosts.List()),
+		sniFile:           joinLines(serverNames.List()),
+	}
+	if len(routerAddress) > 0 {
+		var etcHosts []string
+		for _, host := range hosts.List() {
+			etcHosts = append(etcHosts, routerAddress+" "+host)
+		}
+		files[etcHostsFile] = joinLines(etcHosts)
+	}
+
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinLines joins values into newline terminated lines.
+func joinLines(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.Join(values, "\n") + "\n"
+}
@@ -22,8 +22,10 @@ import (
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 
 	logf "github.com/openshift/router/log"
+	"github.com/openshift/router/pkg/router"
 	"github.com/openshift/router/pkg/router/controller"
 	controllerfactory "github.com/openshift/router/pkg/router/controller/factory"
+	"github.com/openshift/router/pkg/router/reasons"
 )
 
 var log = logf.Logger.WithName("router")
@@ -40,6 +42,8 @@ type RouterSelection struct {
 
 	HostnameTemplate string
 	RouterDomain     string
+	RouterDomainFile string
+	SubdomainHosts   *controller.SubdomainHosts
 	OverrideHostname bool
 	OverrideDomains  []string
 	RedactedDomains  sets.String
@@ -62,10 +66,20 @@ type RouterSelection struct {
 	AllowedDomains     []string
 	WhitelistedDomains sets.String
 
+	StrictFIPSTLSPolicy bool
+
+	RouteClasses      []string
+	RouteClassHandoff bool
+
+	NamespaceDefaultAnnotations []string
+
 	AllowWildcardRoutes bool
 
 	DisableNamespaceOwnershipCheck bool
 
+	HostArbitrationPolicy     string
+	HostArbitrationNamespaces []string
+
 	ExtendedValidation bool
 
 	ListenAddr string
@@ -73,6 +87,20 @@ type RouterSelection struct {
 	// WatchEndpoints when true will watch Endpoints instead of
 	// EndpointSlices.
 	WatchEndpoints bool
+
+	// EndpointsPrecedence when set will watch both Endpoints and
+	// EndpointSlices and serve the services from the source it names.
+	EndpointsPrecedence     string
+	EndpointSliceNamespaces []string
+
+	// TopologyAwareRouting when true will prefer endpoints that serve
+	// the zone of the router.
+	TopologyAwareRouting bool
+	Zone                 string
+
+	// EventHistorySize is the number of recent events of each kind of
+	// resource recorded for debugging.
+	EventHistorySize int
 }
 
 // Bind sets the appropriate labels
@@ -83,6 +111,7 @@ func (o *RouterSelection) Bind(flag *pflag.FlagSet) {
 	flag.DurationVar(&o.ResyncInterval, "resync-interval", controllerfactory.DefaultResyncInterval, "The interval at which the route list should be fully refreshed")
 	flag.StringVar(&o.HostnameTemplate, "hostname-template", env("ROUTER_SUBDOMAIN", ""), "If specified, a template that should be used to generate the hostname for a route without spec.host (e.g. '${name}-${namespace}.myapps.mycompany.com')")
 	flag.StringVar(&o.RouterDomain, "router-domain", env("ROUTER_DOMAIN", ""), "If specified, a domain that should be used to generate the hostname for a route with spec.subdomain and without spec.host (e.g. 'apps.mycluster.com')")
+	flag.StringVar(&o.RouterDomainFile, "router-domain-file", env("ROUTER_DOMAIN_FILE", ""), "If specified, a file containing the domain used instead of --router-domain, such as a key of a mounted configmap. The file is read again every 30 seconds, and when the domain changes the hosts generated for the routes with spec.subdomain are generated again and their status updated.")
 	flag.BoolVar(&o.OverrideHostname, "override-hostname", isTrue(env("ROUTER_OVERRIDE_HOSTNAME", "")), "Override the spec.host value for a route with --hostname-template")
 	flag.StringSliceVar(&o.OverrideDomains, "override-domains", envVarAsStrings("ROUTER_OVERRIDE_DOMAINS", "", ","), "List of comma separated domains to override if present in any routes. This overrides the spec.host value in any matching routes with --hostname-template")
 	flag.StringVar(&o.LabelSelector, "labels", env("ROUTE_LABELS", ""), "A label selector to apply to the routes to watch")
@@ -90,22 +119,35 @@ func (o *RouterSelection) Bind(flag *pflag.FlagSet) {
 	flag.StringVar(&o.ProjectLabelSelector, "project-labels", env("PROJECT_LABELS", ""), "A label selector to apply to projects to watch; if '*' watches all projects the client can access")
 	flag.StringVar(&o.NamespaceLabelSelector, "namespace-labels", env("NAMESPACE_LABELS", ""), "A label selector to apply to namespaces to watch")
 	flag.BoolVar(&o.IncludeUDP, "include-udp-endpoints", false, "If true, UDP endpoints will be considered as candidates for routing")
-	flag.StringSliceVar(&o.DeniedDomains, "denied-domains", envVarAsStrings("ROUTER_DENIED_DOMAINS", "", ","), "List of comma separated domains to deny in routes")
+	flag.StringSliceVar(&o.DeniedDomains, "denied-domains", envVarAsStrings("ROUTER_DENIED_DOMAINS", "", ","), "List of comma separated domains to deny in routes, such as the apps domain of another shard. Routes for one of these domains or any of their subdomains are rejected with a HostForbidden reason, as are wildcard routes that cover one of them.")
 	flag.StringSliceVar(&o.AllowedDomains, "allowed-domains", envVarAsStrings("ROUTER_ALLOWED_DOMAINS", "", ","), "List of comma separated domains to allow in routes. If specified, only the domains in this list will be allowed routes. Note that domains in the denied list take precedence over the ones in the allowed list")
+	flag.BoolVar(&o.StrictFIPSTLSPolicy, "strict-fips-tls-policy", isTrue(env("ROUTER_STRICT_FIPS_TLS_POLICY", "")), "Reject the routes whose certificates use algorithms or key sizes FIPS does not approve, such as RSA keys under 2048 bits, SHA-1 signatures or DSA keys, with a ComplianceViolation reason.")
+	flag.StringSliceVar(&o.RouteClasses, "route-classes", envVarAsStrings("ROUTER_ROUTE_CLASSES", "", ","), "List of comma separated route classes to serve. If specified, the router only serves the routes whose router.openshift.io/route-class annotation is one of these classes, routes without the annotation being of the \"default\" class, and removes its status from the routes that move to another class. If not specified, the router only serves the routes of the \"default\" class.")
+	flag.BoolVar(&o.RouteClassHandoff, "route-class-handoff", isTrue(env("ROUTER_ROUTE_CLASS_HANDOFF", "")), "Keep serving the routes that move to a route class the router does not serve, with a Migrating condition in their status, until another router admits them, so they are not left unserved while the router of their new class picks them up. Requires --route-classes.")
+	flag.StringSliceVar(&o.NamespaceDefaultAnnotations, "namespace-default-annotations", envVarAsStrings("ROUTER_NAMESPACE_DEFAULT_ANNOTATIONS", "", ","), "List of comma separated route annotations, such as haproxy.router.openshift.io/timeout, that routes inherit from their namespace. A route that sets one of these annotations overrides the one of its namespace.")
 	flag.BoolVar(&o.AllowWildcardRoutes, "allow-wildcard-routes", isTrue(env("ROUTER_ALLOW_WILDCARD_ROUTES", "")), "Allow wildcard host names for routes")
 	flag.BoolVar(&o.DisableNamespaceOwnershipCheck, "disable-namespace-ownership-check", isTrue(env("ROUTER_DISABLE_NAMESPACE_OWNERSHIP_CHECK", "")), "Disables the namespace ownership checks for a route host with different paths or for overlapping host names in the case of wildcard routes. Please be aware that if namespace ownership checks are disabled, routes in a different namespace can use this mechanism to 'steal' sub-paths for existing domains. This is only safe if route creation privileges are restricted, or if all the users can be trusted.")
+	flag.StringVar(&o.HostArbitrationPolicy, "host-arbitration", env("ROUTER_HOST_ARBITRATION", controller.HostArbitrationOldest), fmt.Sprintf("The policy that decides which of the routes contending for a host exposes it, one of %s. The oldest route wins under the oldest policy, the routes in the first namespace of --host-arbitration-namespaces under the namespace-priority policy, and the route with the highest %s label under the label policy. The same-namespace-label policy only lets the label override the age of the routes of the same namespace. The age of the routes decides between routes of the same priority or label.", strings.Join(controller.HostArbitrationPolicies, ", "), controller.HostPrecedenceLabel))
+	flag.StringSliceVar(&o.HostArbitrationNamespaces, "host-arbitration-namespaces", envVarAsStrings("ROUTER_HOST_ARBITRATION_NAMESPACES", "", ","), "List of comma separated namespaces in decreasing order of priority for the namespace-priority host arbitration policy. Namespaces that are not in the list have the lowest priority.")
 	flag.BoolVar(&o.ExtendedValidation, "extended-validation", isTrue(env("EXTENDED_VALIDATION", "true")), "If set, then an additional extended validation step is performed on all routes admitted in by this router. Defaults to true and enables the extended validation checks.")
 	flag.Bool("enable-ingress", false, "Enable configuration via ingress resources.")
 	flag.MarkDeprecated("enable-ingress", "Ingress resources are now synchronized to routes automatically.")
 	flag.StringVar(&o.ListenAddr, "listen-addr", env("ROUTER_LISTEN_ADDR", ""), "The name of an interface to listen on to expose metrics and health checking. If not specified, will not listen. Overrides stats port.")
 	flag.BoolVar(&o.WatchEndpoints, "watch-endpoints", isTrue(env("ROUTER_WATCH_ENDPOINTS", "")), "Watch Endpoints instead of the EndpointSlice resource.")
+	flag.StringVar(&o.EndpointsPrecedence, "endpoints-precedence", env("ROUTER_ENDPOINTS_PRECEDENCE", ""), fmt.Sprintf("Watch both the Endpoints and the EndpointSlices of the services and serve them from the source this names, one of %s, logging the services whose Endpoints and EndpointSlices list different endpoints and counting them in the template_router_endpoints_divergent_services metric. Cannot be used with --watch-endpoints.", strings.Join([]string{controllerfactory.EndpointsSourceEndpoints, controllerfactory.EndpointsSourceEndpointSlices}, ", ")))
+	flag.StringSliceVar(&o.EndpointSliceNamespaces, "endpoint-slice-namespaces", envVarAsStrings("ROUTER_ENDPOINT_SLICE_NAMESPACES", "", ","), "List of comma separated namespaces whose services are served from their EndpointSlices while --endpoints-precedence is endpoints, to migrate a namespace at a time.")
+	flag.BoolVar(&o.TopologyAwareRouting, "topology-aware-routing", isTrue(env("ROUTER_TOPOLOGY_AWARE_ROUTING", "")), "Send traffic to the endpoints that serve the zone of the router, based on EndpointSlice topology hints or endpoint zones, and to the endpoints of the other zones only as backup servers, when the endpoints of the zone are down. Falls back to all endpoints when none of the endpoints for the zone are ready.")
+	flag.StringVar(&o.Zone, "zone", env("ROUTER_ZONE", ""), "The zone the router runs in. Required by --topology-aware-routing.")
+	flag.IntVar(&o.EventHistorySize, "event-history-size", int(envInt("ROUTER_EVENT_HISTORY_SIZE", 100, 0)), "The number of recent route, endpoints, namespace and node events, and what the router did with them, to keep for each kind of resource and serve at /debug/events on the metrics port. Only the identity of the objects and a few fields without secrets are kept. Set to 0 to keep none.")
 }
 
 // RouteUpdate updates the route before it is seen by the cache.
 func (o *RouterSelection) RouteUpdate(route *routev1.Route) {
 	// If the route specifies a subdomain and no host name and we a router
 	// domain, set the host field using the subdomain and domain.
-	if len(route.Spec.Host) == 0 && len(route.Spec.Subdomain) > 0 && len(o.RouterDomain) != 0 {
+	if o.SubdomainHosts != nil {
+		o.SubdomainHosts.UpdateRoute(route)
+	} else if len(route.Spec.Host) == 0 && len(route.Spec.Subdomain) > 0 && len(o.RouterDomain) != 0 {
 		route.Spec.Host = fmt.Sprintf("%s.%s", route.Spec.Subdomain, o.RouterDomain)
 	}
 	if len(o.HostnameTemplate) == 0 {
@@ -138,9 +180,9 @@ func (o *RouterSelection) AdmissionCheck(route *routev1.Route) error {
 		return nil
 	}
 
-	if hostInDomainList(route.Spec.Host, o.BlacklistedDomains) {
-		log.V(4).Info("host in list of denied domains", "routeName", route.Name, "host", route.Spec.Host)
-		return fmt.Errorf("host in list of denied domains")
+	if domain, denied := controller.DeniedDomain(route, o.BlacklistedDomains); denied {
+		log.V(4).Info("host in list of denied domains", "routeName", route.Name, "host", route.Spec.Host, "domain", domain)
+		return router.NewRouteError(reasons.HostForbidden, fmt.Sprintf("host %s is in the denied domain %s", route.Spec.Host, domain))
 	}
 
 	if o.WhitelistedDomains.Len() > 0 {
@@ -156,6 +198,12 @@ func (o *RouterSelection) AdmissionCheck(route *routev1.Route) error {
 	return nil
 }
 
+// HostArbitration returns the policy that decides which of the routes
+// contending for a host exposes it.
+func (o *RouterSelection) HostArbitration() controller.HostArbitration {
+	return controller.HostArbitration{Policy: o.HostArbitrationPolicy, Namespaces: o.HostArbitrationNamespaces}
+}
+
 // RouteAdmissionFunc returns a func that checks if a route can be admitted
 // based on blacklist & whitelist checks and wildcard routes policy setting.
 // Note: The blacklist settings trumps the whitelist ones.
@@ -187,6 +235,69 @@ func (o *RouterSelection) Complete() error {
 		return fmt.Errorf("--override-hostname requires that --hostname-template be specified")
 	}
 
+	if o.TopologyAwareRouting {
+		if len(o.Zone) == 0 {
+			return fmt.Errorf("--topology-aware-routing requires that --zone be specified")
+		}
+		if o.WatchEndpoints {
+			return fmt.Errorf("--topology-aware-routing cannot be used with --watch-endpoints")
+		}
+	}
+
+	switch o.EndpointsPrecedence {
+	case "", controllerfactory.EndpointsSourceEndpointSlices:
+	case controllerfactory.EndpointsSourceEndpoints:
+		if o.TopologyAwareRouting && len(o.EndpointSliceNamespaces) == 0 {
+			return fmt.Errorf("--topology-aware-routing requires EndpointSlices, but --endpoints-precedence is endpoints for every namespace")
+		}
+	default:
+		return fmt.Errorf("--endpoints-precedence must be %s or %s", controllerfactory.EndpointsSourceEndpoints, controllerfactory.EndpointsSourceEndpointSlices)
+	}
+	if len(o.EndpointsPrecedence) > 0 && o.WatchEndpoints {
+		return fmt.Errorf("--endpoints-precedence cannot be used with --watch-endpoints")
+	}
+	if len(o.EndpointSliceNamespaces) > 0 && o.EndpointsPrecedence != controllerfactory.EndpointsSourceEndpoints {
+		return fmt.Errorf("--endpoint-slice-namespaces requires --endpoints-precedence=%s", controllerfactory.EndpointsSourceEndpoints)
+	}
+
+	if o.EventHistorySize < 0 {
+		return fmt.Errorf("--event-history-size must not be negative")
+	}
+
+	for _, class := range o.RouteClasses {
+		if errs := validation.IsDNS1123Subdomain(class); len(errs) > 0 {
+			return fmt.Errorf("--route-classes has an invalid class %q: %s", class, strings.Join(errs, ", "))
+		}
+	}
+	if o.RouteClassHandoff && len(o.RouteClasses) == 0 {
+		return fmt.Errorf("--route-class-handoff requires --route-classes")
+	}
+
+	for _, annotation := range o.NamespaceDefaultAnnotations {
+		if errs := validation.IsQualifiedName(annotation); len(errs) > 0 {
+			return fmt.Errorf("--namespace-default-annotations has an invalid annotation %q: %s", annotation, strings.Join(errs, ", "))
+		}
+	}
+
+	if err := o.HostArbitration().Validate(o.DisableNamespaceOwnershipCheck); err != nil {
+		return fmt.Errorf("--host-arbitration: %v", err)
+	}
+
+	if len(o.RouterDomain) > 0 {
+		o.RouterDomain = strings.ToLower(strings.Trim(o.RouterDomain, "."))
+		if errs := validation.IsDNS1123Subdomain(o.RouterDomain); len(errs) > 0 {
+			return fmt.Errorf("--router-domain %q is not a valid domain: %s", o.RouterDomain, strings.Join(errs, ", "))
+		}
+	}
+	if len(o.RouterDomainFile) > 0 {
+		domain, err := controller.ReadDomainFile(o.RouterDomainFile)
+		if err != nil {
+			return fmt.Errorf("--router-domain-file: %v", err)
+		}
+		o.RouterDomain = domain
+	}
+	o.SubdomainHosts = controller.NewSubdomainHosts(o.RouterDomain)
+
 	o.RedactedDomains = sets.NewString(o.OverrideDomains...)
 	if len(o.RedactedDomains) > 0 && len(o.HostnameTemplate) == 0 {
 		return fmt.Errorf("--override-domains requires that --hostname-template be specified")
@@ -234,7 +345,7 @@ func (o *RouterSelection) Complete() error {
 		o.NamespaceLabels = s
 	}
 
-	o.BlacklistedDomains = sets.NewString(o.DeniedDomains...)
+	o.BlacklistedDomains = controller.NewDeniedDomains(o.DeniedDomains)
 	o.WhitelistedDomains = sets.NewString(o.AllowedDomains...)
 
 	if routerCanonicalHostname := o.RouterCanonicalHostname; len(routerCanonicalHostname) > 0 {
@@ -256,6 +367,13 @@ func (o *RouterSelection) NewFactory(routeclient routeclientset.Interface, proje
 	factory.FieldSelector = o.FieldSelector
 	factory.Namespace = o.Namespace
 	factory.ResyncInterval = o.ResyncInterval
+	if o.TopologyAwareRouting {
+		factory.Zone = o.Zone
+	}
+	factory.SubdomainHosts = o.SubdomainHosts
+	factory.EventHistorySize = o.EventHistorySize
+	factory.EndpointsPrecedence = o.EndpointsPrecedence
+	factory.EndpointSliceNamespaces = sets.NewString(o.EndpointSliceNamespaces...)
 	switch {
 	case o.NamespaceLabels != nil:
 		log.V(0).Info("router is only using routes in namespaces matching labels", "labels", o.NamespaceLabels.String())
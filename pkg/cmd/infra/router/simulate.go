@@ -0,0 +1,325 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/MakeNowJust/heredoc"
+	"github.com/spf13/cobra"
+
+	kapi "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	kclientset "k8s.io/client-go/kubernetes"
+
+	routev1 "github.com/openshift/api/route/v1"
+	projectclient "github.com/openshift/client-go/project/clientset/versioned"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/openshift/router/pkg/router/controller"
+	templateplugin "github.com/openshift/router/pkg/router/template"
+)
+
+var simulateShardLong = heredoc.Doc(`
+	Simulate a router shard against the routes of a cluster.
+
+	The routes, services and endpoints the shard would select with the given
+	selection options are read from the cluster, without watching or updating
+	them, and passed through the admission checks of the router in the order
+	they were created.  Every route is reported as admitted, rejected with the
+	reason the router would record in its status, or ignored because it is not
+	in a route class of the shard.  When a router template is set, the size of
+	the configuration generated for the admitted routes is reported as well.
+
+	The command takes the options of the router, from the same flags and
+	environment variables, so that it runs the admission checks of the shard.`)
+
+// SimulateShardOptions are the options of the simulate-shard command.
+type SimulateShardOptions struct {
+	TemplateRouterOptions
+
+	Out io.Writer
+}
+
+// newCmdSimulateShard returns a command that reports what a router shard
+// would admit from the current state of a cluster.
+func newCmdSimulateShard(out io.Writer) *cobra.Command {
+	o := &SimulateShardOptions{TemplateRouterOptions: TemplateRouterOptions{Config: NewConfig()}, Out: out}
+
+	cmd := &cobra.Command{
+		Use:   "simulate-shard",
+		Short: "Report the routes a router shard would admit",
+		Long:  simulateShardLong,
+		Example: heredoc.Doc(`
+			# Simulate a shard for the routes of the namespaces labelled shard=internal
+			openshift-router simulate-shard --namespace-labels shard=internal --template /var/lib/haproxy/conf/haproxy-config.template`),
+		RunE: func(c *cobra.Command, args []string) error {
+			o.RouterSelection.Namespace = c.Flags().Lookup("namespace").Value.String()
+			if err := o.TemplateRouterOptions.Complete(); err != nil {
+				return err
+			}
+			return o.Run()
+		},
+	}
+
+	flag := cmd.Flags()
+	o.Config.Bind(flag)
+	o.TemplateRouter.Bind(flag)
+	o.RouterStats.Bind(flag)
+	o.RouterSelection.Bind(flag)
+
+	return cmd
+}
+
+// Run reads the routes of the shard, admits them and writes the report.
+func (o *SimulateShardOptions) Run() error {
+	kc, err := o.Config.Clients()
+	if err != nil {
+		return err
+	}
+	config, _, err := o.Config.KubeConfig()
+	if err != nil {
+		return err
+	}
+	routeclient, err := routeclientset.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	projectclient, err := projectclient.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	namespaces, err := o.selectedNamespaces(kc, projectclient)
+	if err != nil {
+		return err
+	}
+	list, err := routeclient.RouteV1().Routes(o.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: o.LabelSelector,
+		FieldSelector: o.FieldSelector,
+	})
+	if err != nil {
+		return err
+	}
+	var defaults *controller.NamespaceDefaults
+	if len(o.NamespaceDefaultAnnotations) > 0 {
+		nsList, err := kc.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		defaults = controller.NewNamespaceDefaults(nil, o.NamespaceDefaultAnnotations)
+		for i := range nsList.Items {
+			defaults.HandleNamespace(watch.Added, &nsList.Items[i])
+		}
+	}
+	var routes []*routev1.Route
+	for i := range list.Items {
+		route := &list.Items[i]
+		if namespaces != nil && !namespaces.Has(route.Namespace) {
+			continue
+		}
+		if defaults != nil {
+			route = defaults.WithDefaults(route)
+		}
+		o.RouteUpdate(route)
+		routes = append(routes, route)
+	}
+	// The router breaks host claim ties in favor of the oldest route, feed
+	// the routes in that order so that none is displaced along the way.
+	sort.SliceStable(routes, func(i, j int) bool {
+		if !routes[i].CreationTimestamp.Equal(&routes[j].CreationTimestamp) {
+			return routes[i].CreationTimestamp.Before(&routes[j].CreationTimestamp)
+		}
+		return routeName(routes[i]) < routeName(routes[j])
+	})
+
+	result, err := o.simulate(routes, namespaces)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tHOST\tSTATUS\tREASON")
+	var admitted []*routev1.Route
+	rejected, ignored := 0, 0
+	for _, route := range routes {
+		name := routeName(route)
+		switch rejection, isRejected := result.rejections[name]; {
+		case result.admitted.Has(name):
+			admitted = append(admitted, route)
+			fmt.Fprintf(w, "%s\t%s\t%s\tAdmitted\t\n", route.Namespace, route.Name, route.Spec.Host)
+		case isRejected:
+			rejected++
+			fmt.Fprintf(w, "%s\t%s\t%s\tRejected\t%s: %s\n", route.Namespace, route.Name, route.Spec.Host, rejection.reason, rejection.message)
+		default:
+			ignored++
+			fmt.Fprintf(w, "%s\t%s\t%s\tIgnored\tnot in a route class of the shard\n", route.Namespace, route.Name, route.Spec.Host)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "\n%d routes: %d admitted, %d rejected, %d ignored\n", len(routes), len(admitted), rejected, ignored)
+
+	if len(o.TemplateFile) == 0 {
+		return nil
+	}
+	return o.reportConfigSize(kc, admitted, namespaces)
+}
+
+// selectedNamespaces returns the namespaces selected by the namespace or
+// project label selector, or nil if the shard selects every namespace.
+func (o *SimulateShardOptions) selectedNamespaces(kc kclientset.Interface, projectclient projectclient.Interface) (sets.String, error) {
+	namespaces := sets.NewString()
+	switch {
+	case o.NamespaceLabels != nil:
+		list, err := kc.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{LabelSelector: o.NamespaceLabels.String()})
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range list.Items {
+			namespaces.Insert(namespace.Name)
+		}
+	case o.ProjectLabels != nil:
+		list, err := projectclient.ProjectV1().Projects().List(context.TODO(), metav1.ListOptions{LabelSelector: o.ProjectLabels.String()})
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range list.Items {
+			namespaces.Insert(project.Name)
+		}
+	default:
+		return nil, nil
+	}
+	return namespaces, nil
+}
+
+// shardSimulationResult is what the admission checks of a router made of a
+// set of routes.
+type shardSimulationResult struct {
+	admitted   sets.String
+	rejections map[string]shardRejection
+}
+
+type shardRejection struct {
+	reason  string
+	message string
+}
+
+// RecordRouteRejection keeps the last rejection of every route.
+func (r *shardSimulationResult) RecordRouteRejection(route *routev1.Route, reason, message string) {
+	r.rejections[routeName(route)] = shardRejection{reason: reason, message: message}
+}
+
+// HandleRoute tracks the routes that passed the admission checks.
+func (r *shardSimulationResult) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	switch eventType {
+	case watch.Added, watch.Modified:
+		r.admitted.Insert(routeName(route))
+		delete(r.rejections, routeName(route))
+	case watch.Deleted:
+		r.admitted.Delete(routeName(route))
+	}
+	return nil
+}
+
+func (r *shardSimulationResult) HandleEndpoints(watch.EventType, *kapi.Endpoints) error { return nil }
+func (r *shardSimulationResult) HandleNamespaces(sets.String) error                     { return nil }
+func (r *shardSimulationResult) HandleNode(watch.EventType, *kapi.Node) error           { return nil }
+func (r *shardSimulationResult) Commit() error                                          { return nil }
+
+// simulate passes routes through the admission plugins the router would
+// run for the shard, without a status writer.
+func (o *SimulateShardOptions) simulate(routes []*routev1.Route, namespaces sets.String) (*shardSimulationResult, error) {
+	result := &shardSimulationResult{admitted: sets.NewString(), rejections: map[string]shardRejection{}}
+
+	// The host claims the router saved are its own, the simulation
+	// starts from the routes alone.
+	o.HostClaimCache = ""
+	plugin, err := o.admissionPlugins(result, result, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if namespaces != nil {
+		plugin.HandleNamespaces(namespaces)
+	}
+	for _, route := range routes {
+		plugin.HandleRoute(watch.Added, route)
+	}
+	plugin.Commit()
+	return result, nil
+}
+
+// reportConfigSize renders the configuration of the admitted routes with
+// the endpoints of their services and writes the size of its files.
+func (o *SimulateShardOptions) reportConfigSize(kc kclientset.Interface, routes []*routev1.Route, namespaces sets.String) error {
+	renderer, err := templateplugin.NewRenderer(templateplugin.RendererConfig{
+		TemplatePath:          o.TemplateFile,
+		TemplateOverridePaths: o.TemplateOverrides,
+		WorkingDir:            o.WorkingDir,
+		AllowWildcardRoutes:   o.AllowWildcardRoutes,
+		BindPorts:             true,
+	})
+	if err != nil {
+		return err
+	}
+	state := renderer.RouteState(routes)
+
+	endpoints, err := kc.CoreV1().Endpoints(o.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	services, err := kc.CoreV1().Services(o.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	lookup := serviceListLookup{}
+	for i := range services.Items {
+		lookup[services.Items[i].Namespace+"/"+services.Items[i].Name] = &services.Items[i]
+	}
+	for i := range endpoints.Items {
+		if namespaces == nil || namespaces.Has(endpoints.Items[i].Namespace) {
+			renderer.AddEndpoints(state, &endpoints.Items[i], !o.IncludeUDP, lookup)
+		}
+	}
+
+	files, err := renderer.Render(state)
+	if err != nil {
+		return err
+	}
+	servers := 0
+	for _, serviceUnit := range state.ServiceUnits {
+		servers += len(serviceUnit.EndpointTable)
+	}
+	fmt.Fprintf(o.Out, "\nconfiguration of %d backends with %d servers:\n", len(state.Routes), servers)
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	total := 0
+	for _, file := range files {
+		total += len(file.Contents)
+		fmt.Fprintf(w, "%d\t  %s\n", len(file.Contents), file.Name)
+	}
+	fmt.Fprintf(w, "%d\t  total bytes\n", total)
+	return w.Flush()
+}
+
+// serviceListLookup finds the services of endpoints in the services listed
+// from the cluster.
+type serviceListLookup map[string]*kapi.Service
+
+func (l serviceListLookup) LookupService(endpoints *kapi.Endpoints) (*kapi.Service, error) {
+	if service, ok := l[endpoints.Namespace+"/"+endpoints.Name]; ok {
+		return service, nil
+	}
+	return nil, kerrors.NewNotFound(kapi.Resource("services"), endpoints.Name)
+}
+
+// routeName returns the namespace/name of a route.
+func routeName(route *routev1.Route) string {
+	return route.Namespace + "/" + route.Name
+}
@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -17,18 +19,26 @@ import (
 	"time"
 
 	"github.com/MakeNowJust/heredoc"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	kapi "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
 	"k8s.io/apiserver/pkg/server/healthz"
 	authoptions "k8s.io/apiserver/pkg/server/options"
+	kclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
 	authenticationclient "k8s.io/client-go/kubernetes/typed/authentication/v1"
 	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	routev1 "github.com/openshift/api/route/v1"
 	projectclient "github.com/openshift/client-go/project/clientset/versioned"
@@ -39,9 +49,12 @@ import (
 
 	"github.com/openshift/router/pkg/router"
 	"github.com/openshift/router/pkg/router/controller"
+	"github.com/openshift/router/pkg/router/leaderelection"
 	"github.com/openshift/router/pkg/router/metrics"
 	"github.com/openshift/router/pkg/router/metrics/haproxy"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 	"github.com/openshift/router/pkg/router/shutdown"
+	"github.com/openshift/router/pkg/router/telemetry"
 	templateplugin "github.com/openshift/router/pkg/router/template"
 	haproxyconfigmanager "github.com/openshift/router/pkg/router/template/configmanager/haproxy"
 	"github.com/openshift/router/pkg/router/writerlease"
@@ -107,8 +120,11 @@ type TemplateRouterOptions struct {
 type TemplateRouter struct {
 	WorkingDir                          string
 	TemplateFile                        string
+	TemplateOverrides                   []string
 	ReloadScript                        string
+	InProcessReload                     bool
 	ReloadInterval                      time.Duration
+	MasterSocket                        string
 	DefaultCertificate                  string
 	DefaultCertificatePath              string
 	DefaultCertificateDir               string
@@ -118,6 +134,10 @@ type TemplateRouter struct {
 	Ciphers                             string
 	StrictSNI                           bool
 	MetricsType                         string
+	TelemetryExporters                  []string
+	OTLP                                telemetry.OTLPConfig
+	ReadinessLevelName                  string
+	ReadinessLevel                      metrics.ReadinessLevel
 	CaptureHTTPRequestHeadersString     string
 	CaptureHTTPResponseHeadersString    string
 	CaptureHTTPCookieString             string
@@ -126,6 +146,61 @@ type TemplateRouter struct {
 	CaptureHTTPCookie                   *templateplugin.CaptureHTTPCookie
 	HTTPHeaderNameCaseAdjustmentsString string
 	HTTPHeaderNameCaseAdjustments       []templateplugin.HTTPHeaderNameCaseAdjustment
+	URINormalizersString                string
+	URINormalizers                      []string
+	ResponseHeaderPolicyFile            string
+	ResponseHeaderPolicy                []routeapihelpers.ResponseHeaderRule
+	HostClaimCache                      string
+	RouterStateConfigMap                string
+	TCPPortRangeString                  string
+	TCPPortRange                        routeapihelpers.PortRange
+	Standby                             bool
+	StandbyLease                        string
+	StandbyLeaseDuration                time.Duration
+	StatusLease                         string
+	StatusLeaseDuration                 time.Duration
+	AnnotationWarnings                  bool
+	BackendAvailabilityCondition        bool
+	ServiceCheck                        bool
+	CertificateCheckInterval            time.Duration
+	StatusReconcileInterval             time.Duration
+	CertificateCheckTimeout             time.Duration
+	CertificateDistrustedCAsFile        string
+	CertificateDistrustWarning          time.Duration
+	CertificateDistrustedCAs            []controller.DistrustedCA
+	ConfigSnippetDirectives             []string
+	HTTPCompatOptions                   []string
+	AllowIDNHosts                       bool
+	HAProxyBinary                       string
+	OldWorkerDeadline                   time.Duration
+	MaxWorkerReloads                    int
+	DisableTLSSessionTickets            []string
+	TLSSessionCacheSize                 int
+	TLSSessionLifetime                  time.Duration
+	TLSTicketKeyRotationInterval        time.Duration
+	TLSSession                          templateplugin.TLSSessionConfig
+	HealthCheckMaxInterval              time.Duration
+	HealthCheckStablePeriod             time.Duration
+	AdaptiveHealthChecks                templateplugin.AdaptiveHealthCheckConfig
+	LatencyWeighting                    templateplugin.LatencyWeightingConfig
+	LeastRequestWeighting               templateplugin.LeastRequestWeightingConfig
+	CapacityLimits                      templateplugin.CapacityLimits
+	SNIHostMismatchPolicy               string
+	CertificateConflictPolicy           string
+	SetForwardedHeaders                 string
+	WAFFailurePolicy                    string
+	WAF                                 templateplugin.WAFConfig
+	ResponseCacheSize                   int
+	MaxMapFileEntries                   int
+	TransparentProxy                    bool
+	ReloadVerificationTimeout           time.Duration
+	CommitPartitions                    int
+	ActivationWindowInterval            time.Duration
+	EndpointMetadata                    templateplugin.EndpointMetadataConfig
+	ReloadState                         templateplugin.ReloadStateConfig
+	StableServerNames                   bool
+	RouteTimeoutPolicy                  string
+	Tuning                              templateplugin.TuningConfig
 
 	TemplateRouterConfigManager
 }
@@ -137,6 +212,7 @@ type TemplateRouterConfigManager struct {
 	BlueprintRouteLabelSelector string
 	BlueprintRoutePoolSize      int
 	MaxDynamicServers           int
+	BatchErrorPercent           int
 }
 
 // isTrue here has the same logic as the function within package pkg/router/template
@@ -158,6 +234,37 @@ func getIntervalFromEnv(name string, defaultValSecs int) time.Duration {
 	return value
 }
 
+// getHAProxyTimeoutFromEnv returns a haproxy timeout based on an environment
+// variable or the default, the same way the haproxy template does.
+func getHAProxyTimeoutFromEnv(name, defaultValue string) time.Duration {
+	value, err := routeapihelpers.ParseHAProxyTimeout(env(name, defaultValue))
+	if err != nil {
+		value, _ = routeapihelpers.ParseHAProxyTimeout(defaultValue)
+	}
+	return value
+}
+
+// routerTimeoutsFromEnv returns the default timeouts the template gives
+// to the routes.
+func routerTimeoutsFromEnv() routeapihelpers.RouterTimeouts {
+	return routeapihelpers.RouterTimeouts{
+		Client:      getHAProxyTimeoutFromEnv("ROUTER_DEFAULT_CLIENT_TIMEOUT", "30s"),
+		Server:      getHAProxyTimeoutFromEnv("ROUTER_DEFAULT_SERVER_TIMEOUT", "30s"),
+		Tunnel:      getHAProxyTimeoutFromEnv("ROUTER_DEFAULT_TUNNEL_TIMEOUT", "1h"),
+		HTTPRequest: getHAProxyTimeoutFromEnv("ROUTER_SLOWLORIS_TIMEOUT", "10s"),
+	}
+}
+
+// oldWorkers returns the limits on the haproxy processes of previous
+// reloads the template renders.
+func (o *TemplateRouter) oldWorkers() templateplugin.OldWorkersConfig {
+	cfg := templateplugin.OldWorkersConfig{MaxReloads: o.MaxWorkerReloads}
+	if o.OldWorkerDeadline > 0 {
+		cfg.HardStopAfter = routeapihelpers.FormatHAProxyTimeout(o.OldWorkerDeadline)
+	}
+	return cfg
+}
+
 func (o *TemplateRouter) Bind(flag *pflag.FlagSet) {
 	flag.StringVar(&o.WorkingDir, "working-dir", "/var/lib/haproxy", "The working directory for the router plugin")
 	flag.StringVar(&o.DefaultCertificate, "default-certificate", env("DEFAULT_CERTIFICATE", ""), "The contents of a default certificate to use for routes that don't expose a TLS server cert; in PEM format")
@@ -165,23 +272,102 @@ func (o *TemplateRouter) Bind(flag *pflag.FlagSet) {
 	flag.StringVar(&o.DefaultCertificateDir, "default-certificate-dir", env("DEFAULT_CERTIFICATE_DIR", ""), "A path to a directory that contains a file named tls.crt. If tls.crt is not a PEM file which also contains a private key, it is first combined with a file named tls.key in the same directory. The PEM-format contents are then used as the default certificate. Only used if default-certificate and default-certificate-path are not specified.")
 	flag.StringVar(&o.DefaultDestinationCAPath, "default-destination-ca-path", env("DEFAULT_DESTINATION_CA_PATH", ""), "A path to a PEM file containing the default CA bundle to use with re-encrypt routes. This CA should sign for certificates in the Kubernetes DNS space (service.namespace.svc).")
 	flag.StringVar(&o.TemplateFile, "template", env("TEMPLATE_FILE", ""), "The path to the template file to use")
+	flag.StringSliceVar(&o.TemplateOverrides, "template-override", envVarAsStrings("TEMPLATE_OVERRIDES", "", ","), "List of comma separated template override files whose override/global, override/defaults and override/backend sections replace the empty ones of the template. A section may only be defined by one of the files.")
 	flag.StringVar(&o.ReloadScript, "reload", env("RELOAD_SCRIPT", ""), "The path to the reload script to use")
+	flag.BoolVar(&o.InProcessReload, "in-process-reload", env("ROUTER_IN_PROCESS_RELOAD", "") == "true", "If true, the router starts, reloads and stops the haproxy binary itself instead of running the reload script.")
 	flag.DurationVar(&o.ReloadInterval, "interval", getIntervalFromEnv("RELOAD_INTERVAL", defaultReloadInterval), "Controls how often router reloads are invoked. Mutiple router reload requests are coalesced for the duration of this interval since the last reload time.")
+	flag.StringVar(&o.MasterSocket, "haproxy-master-socket", env("ROUTER_HAPROXY_MASTER_SOCKET", ""), "If specified, run haproxy in master-worker mode with its master CLI listening on this unix socket path, and reload haproxy through the master instead of replacing its processes from the reload script.")
 	flag.BoolVar(&o.BindPortsAfterSync, "bind-ports-after-sync", env("ROUTER_BIND_PORTS_AFTER_SYNC", "") == "true", "Bind ports only after route state has been synchronized")
+	flag.StringVar(&o.ReadinessLevelName, "readiness-level", env("ROUTER_READINESS_LEVEL", ""), "The minimum readiness level the router must reach to be reported ready by the metrics server: synced-routes, synced-endpoints, first-config-written or haproxy-loaded. Each level implies the ones before it. The current level and the times of the last commit and reload are served at /debug/readiness.")
 	flag.StringVar(&o.MaxConnections, "max-connections", env("ROUTER_MAX_CONNECTIONS", ""), "Specifies the maximum number of concurrent connections.")
 	flag.StringVar(&o.Ciphers, "ciphers", env("ROUTER_CIPHERS", ""), "Specifies the cipher suites to use. You can choose a predefined cipher set ('modern', 'intermediate', or 'old') or specify exact cipher suites by passing a : separated list.")
 	flag.BoolVar(&o.StrictSNI, "strict-sni", isTrue(env("ROUTER_STRICT_SNI", "")), "Use strict-sni bind processing (do not use default cert).")
 	flag.StringVar(&o.MetricsType, "metrics-type", env("ROUTER_METRICS_TYPE", ""), "Specifies the type of metrics to gather. Supports 'haproxy'.")
+	flag.StringSliceVar(&o.TelemetryExporters, "telemetry-exporters", envVarAsStrings("ROUTER_TELEMETRY_EXPORTERS", telemetry.ExporterPrometheus, ","), "List of comma separated exporters of the metrics and traces of the router: prometheus, which serves the metrics at /metrics of the metrics server, and otlp, which pushes the durations of the commits and reloads of the router and of the handling of route and endpoints events as OpenTelemetry metrics and traces to --otlp-endpoint.")
+	flag.StringVar(&o.OTLP.Endpoint, "otlp-endpoint", env("ROUTER_OTLP_ENDPOINT", ""), "The host and port of the gRPC OTLP receiver of the OpenTelemetry collector the telemetry of the router is pushed to, when --telemetry-exporters includes otlp.")
+	flag.BoolVar(&o.OTLP.Insecure, "otlp-insecure", isTrue(env("ROUTER_OTLP_INSECURE", "")), "Connect to --otlp-endpoint without TLS.")
+	flag.StringVar(&o.OTLP.CAFile, "otlp-ca-file", env("ROUTER_OTLP_CA_FILE", ""), "The CA bundle the certificate of --otlp-endpoint is verified with. The system roots are used if empty.")
+	flag.DurationVar(&o.OTLP.Interval, "otlp-export-interval", getIntervalFromEnv("ROUTER_OTLP_EXPORT_INTERVAL", 60), "How often the metrics of the router are pushed to --otlp-endpoint.")
 	flag.BoolVar(&o.UseHAProxyConfigManager, "haproxy-config-manager", isTrue(env("ROUTER_HAPROXY_CONFIG_MANAGER", "")), "Use the the haproxy config manager (and dynamic configuration API) to configure route and endpoint changes. Reduces the number of haproxy reloads needed on configuration changes.")
 	flag.DurationVar(&o.CommitInterval, "commit-interval", getIntervalFromEnv("COMMIT_INTERVAL", defaultCommitInterval), "Controls how often to commit (to the actual config) all the changes made using the router specific dynamic configuration manager.")
 	flag.StringVar(&o.BlueprintRouteNamespace, "blueprint-route-namespace", env("ROUTER_BLUEPRINT_ROUTE_NAMESPACE", ""), "Specifies the namespace which contains the routes that serve as blueprints for the dynamic configuration manager.")
 	flag.StringVar(&o.BlueprintRouteLabelSelector, "blueprint-route-labels", env("ROUTER_BLUEPRINT_ROUTE_LABELS", ""), "A label selector to apply to the routes in the blueprint route namespace. These selected routes will serve as blueprints for the dynamic dynamic configuration manager.")
 	flag.IntVar(&o.BlueprintRoutePoolSize, "blueprint-route-pool-size", int(envInt("ROUTER_BLUEPRINT_ROUTE_POOL_SIZE", 10, 1)), "Specifies the size of the pre-allocated pool for each route blueprint managed by the router specific dynamic configuration manager. This can be overriden by an annotation router.openshift.io/pool-size on an individual route.")
 	flag.IntVar(&o.MaxDynamicServers, "max-dynamic-servers", int(envInt("ROUTER_MAX_DYNAMIC_SERVERS", 5, 1)), "Specifies the maximum number of dynamic servers added to a route for use by the router specific dynamic configuration manager.")
+	flag.IntVar(&o.BatchErrorPercent, "dynamic-config-batch-error-percent", int(envInt("ROUTER_DYNAMIC_CONFIG_BATCH_ERROR_PERCENT", int32(haproxyconfigmanager.DefaultBatchErrorThreshold*100), 0)), "The percentage of the commands of a batch sent by the router specific dynamic configuration manager that may fail and be retried one by one. Above it, the changes are applied with a reload instead.")
 	flag.StringVar(&o.CaptureHTTPRequestHeadersString, "capture-http-request-headers", env("ROUTER_CAPTURE_HTTP_REQUEST_HEADERS", ""), "A comma-delimited list of HTTP request header names and maximum header value lengths that should be captured for logging. Each item must have the following form: name:maxLength")
 	flag.StringVar(&o.CaptureHTTPResponseHeadersString, "capture-http-response-headers", env("ROUTER_CAPTURE_HTTP_RESPONSE_HEADERS", ""), "A comma-delimited list of HTTP response header names and maximum header value lengths that should be captured for logging. Each item must have the following form: name:maxLength")
 	flag.StringVar(&o.CaptureHTTPCookieString, "capture-http-cookie", env("ROUTER_CAPTURE_HTTP_COOKIE", ""), "Name and maximum length of HTTP cookie that should be captured for logging.  The argument must have the following form: name:maxLength. Append '=' to the name to indicate that an exact match should be performed; otherwise a prefix match will be performed.  The value of first cookie that matches the name is captured.")
 	flag.StringVar(&o.HTTPHeaderNameCaseAdjustmentsString, "http-header-name-case-adjustments", env("ROUTER_H1_CASE_ADJUST", ""), "A comma-delimited list of HTTP header names that should have their case adjusted. Each item must be a valid HTTP header name and should have the desired capitalization.")
+	flag.StringVar(&o.URINormalizersString, "normalize-uri", env("ROUTER_NORMALIZE_URI", ""), "A comma-delimited list of haproxy normalize-uri normalizers applied to every request before the route is selected, e.g. \"path-merge-slashes,path-strip-dotdot full,percent-decode-unreserved\". Routes may add normalizers with the haproxy.router.openshift.io/normalize-uri annotation.")
+	flag.StringVar(&o.ResponseHeaderPolicyFile, "response-header-policy-file", env("ROUTER_RESPONSE_HEADER_POLICY_FILE", ""), "A file of response header rules applied to the responses of every route the router terminates HTTP for, one \"delete <header>\" or \"replace <header> <value>\" rule per line, e.g. \"delete X-Powered-By\". Routes may add, override or \"keep <header>\" rules with the haproxy.router.openshift.io/response-header-policy annotation.")
+	flag.StringVar(&o.HostClaimCache, "host-claim-cache", env("ROUTER_HOST_CLAIM_CACHE", ""), "A path to a file where the owner of each host is recorded. When set, the router restores host ownership from this file on startup so that contending routes are not transiently admitted while the initial sync is in progress.")
+	flag.StringVar(&o.RouterStateConfigMap, "router-state-configmap", env("ROUTER_STATE_CONFIGMAP", ""), "The namespace/name of a config map the router publishes a summary of its admitted and rejected routes to. Only the replica holding the status lease publishes it. Requires route status updates and a status lease.")
+	flag.StringVar(&o.TCPPortRangeString, "tcp-port-range", env("ROUTER_TCP_PORT_RANGE", ""), "A range of ports, of the form min-max, the router allocates the dedicated ports of TCP routes from. TCP routes are rejected if no range is set.")
+	flag.BoolVar(&o.Standby, "standby", isTrue(env("ROUTER_STANDBY", "")), "Start as a standby router: routes are admitted and configured, but the public frontends are disabled and route status reports a Standby condition until the router is promoted by acquiring the standby lease.")
+	flag.StringVar(&o.StandbyLease, "standby-lease", env("ROUTER_STANDBY_LEASE", ""), "The namespace/name of a coordination lease shared by the routers of an active/passive pair. A standby router is promoted once it acquires the lease. Implies --standby.")
+	flag.DurationVar(&o.StandbyLeaseDuration, "standby-lease-duration", getIntervalFromEnv("ROUTER_STANDBY_LEASE_DURATION", 15), "How long the standby lease is held without being renewed before a standby router may acquire it.")
+	flag.StringVar(&o.StatusLease, "status-lease", env("ROUTER_STATUS_LEASE", ""), "The namespace/name of a coordination lease shared by the replicas of a router. Only the replica holding the lease writes route status, the others take over if it stops renewing the lease. Requires route status updates to be enabled.")
+	flag.DurationVar(&o.StatusLeaseDuration, "status-lease-duration", getIntervalFromEnv("ROUTER_STATUS_LEASE_DURATION", 15), "How long the status lease is held without being renewed before another replica may acquire it.")
+	flag.BoolVar(&o.BackendAvailabilityCondition, "backend-availability-condition", isTrue(env("ROUTER_BACKEND_AVAILABILITY_CONDITION", "")), "Report a BackendsAvailable=False condition, with the number of ready and total endpoints, in the status of routes whose services have no ready endpoints, and set it back to true once an endpoint is ready. Also report an EndpointsSkipped=True condition listing the ready endpoints that do not serve the target port of a route, and why.")
+	flag.BoolVar(&o.ServiceCheck, "service-check", isTrue(env("ROUTER_SERVICE_CHECK", "")), "Report a ServiceNotFound=True condition in the status of routes whose services do not exist, or do not have the port the route targets by name, and set it back to false once they do.")
+	flag.DurationVar(&o.CertificateCheckInterval, "certificate-check-interval", getIntervalFromEnv("ROUTER_CERTIFICATE_CHECK_INTERVAL", 0), "How often the certificates of the admitted edge and reencrypt routes are checked for revocation, through the OCSP responders or CRLs they name, and for CAs listed in --certificate-distrusted-cas-file. A CertificateWarnings=True condition is reported in the status of the routes with revoked or distrusted certificates, and set back to false once they are replaced. Zero disables the checks. Requires route status updates to be enabled.")
+	flag.DurationVar(&o.StatusReconcileInterval, "status-reconcile-interval", getIntervalFromEnv("ROUTER_STATUS_RECONCILE_INTERVAL", 0), "How often the conditions the router reported in the status of routes are checked, and those another controller removed are reported again. Zero disables the checks. Requires route status updates to be enabled.")
+	flag.DurationVar(&o.CertificateCheckTimeout, "certificate-check-timeout", getIntervalFromEnv("ROUTER_CERTIFICATE_CHECK_TIMEOUT", 10), "How long a request to an OCSP responder or for a CRL may take.")
+	flag.StringVar(&o.CertificateDistrustedCAsFile, "certificate-distrusted-cas-file", env("ROUTER_CERTIFICATE_DISTRUSTED_CAS_FILE", ""), "A file of CAs that are distrusted, or are going to be, one per line as the hexadecimal subject key identifier of the CA certificate, the date it is distrusted from as YYYY-MM-DD, and a name, e.g. \"3e:f0:...:12 2024-11-30 Example Root CA\". Lines starting with # are ignored.")
+	flag.DurationVar(&o.CertificateDistrustWarning, "certificate-distrust-warning", getIntervalFromEnv("ROUTER_CERTIFICATE_DISTRUST_WARNING", 30*24*60*60), "How long before a CA is distrusted the routes with certificates it issued are reported.")
+	flag.BoolVar(&o.AnnotationWarnings, "annotation-warnings", isTrue(env("ROUTER_ANNOTATION_WARNINGS", "")), "Report an AnnotationWarnings condition in the status of routes with haproxy.router.openshift.io annotations the router does not know, with the known annotation they most likely meant, or that are deprecated.")
+	flag.StringSliceVar(&o.ConfigSnippetDirectives, "config-snippet-directives", envVarAsStrings("ROUTER_CONFIG_SNIPPET_ALLOWED_DIRECTIVES", "", ","), "List of comma separated haproxy directives routes may use in backend config snippets. Routes with a config snippet are rejected if empty. Directives that open sections, add servers or access files are never allowed.")
+	flag.StringSliceVar(&o.HTTPCompatOptions, "http-compat-options", envVarAsStrings("ROUTER_ALLOWED_HTTP_COMPAT_OPTIONS", strings.Join(routeapihelpers.DefaultHTTPCompatOptions, ","), ","), "List of comma separated HTTP/1 compatibility options routes may set with the haproxy.router.openshift.io/http-compat annotation: "+strings.Join(routeapihelpers.SupportedHTTPCompatOptions, ", ")+". accept-invalid-http-request relaxes the parsing of the requests of all the routes of the frontends of a route that sets it.")
+	flag.BoolVar(&o.AllowIDNHosts, "allow-idn-hosts", isTrue(env("ROUTER_ALLOW_IDN_HOSTS", "true")), "Allow routes with internationalized host names, which haproxy matches in their punycode form. The status of the routes keeps their original host. If false, extended validation rejects routes with internationalized host names.")
+	flag.DurationVar(&o.OldWorkerDeadline, "old-worker-deadline", getIntervalFromEnv("ROUTER_OLD_WORKER_DEADLINE", 0), "How long the haproxy processes of a previous reload may drain connections before haproxy stops them (hard-stop-after). Zero uses ROUTER_HARD_STOP_AFTER.")
+	flag.IntVar(&o.MaxWorkerReloads, "max-worker-reloads", int(envInt("ROUTER_MAX_WORKER_RELOADS", 0, 0)), "How many reloads a haproxy worker survives before the haproxy master stops it (mworker-max-reloads). Only used with --haproxy-master-socket. Zero does not limit the reloads.")
+	flag.StringSliceVar(&o.DisableTLSSessionTickets, "disable-tls-session-tickets", envVarAsStrings("ROUTER_DISABLE_TLS_SESSION_TICKETS", "", ","), "List of comma separated frontends that do not issue TLS session tickets: fe_sni, which serves the routes with their own certificates, and fe_no_sni, which serves the routes with the default certificate. Clients of these frontends may still resume sessions by session ID.")
+	flag.IntVar(&o.TLSSessionCacheSize, "tls-session-cache-size", int(envInt("ROUTER_TLS_SESSION_CACHE_SIZE", 0, 0)), "The number of TLS sessions kept for resumption by session ID. Zero keeps the haproxy default.")
+	flag.DurationVar(&o.TLSSessionLifetime, "tls-session-lifetime", getIntervalFromEnv("ROUTER_TLS_SESSION_LIFETIME", 0), "How long TLS sessions can be resumed by session ID. Zero keeps the haproxy default.")
+	flag.DurationVar(&o.TLSTicketKeyRotationInterval, "tls-ticket-key-rotation-interval", getIntervalFromEnv("ROUTER_TLS_TICKET_KEY_ROTATION_INTERVAL", 0), "How often the router rotates the keys that encrypt TLS session tickets. The keys are kept in the working directory so that tickets stay valid across reloads, and new keys are pushed to the running haproxy without a reload. Zero leaves the keys to haproxy, which generates new ones on every reload.")
+	flag.DurationVar(&o.HealthCheckMaxInterval, "health-check-max-interval", getIntervalFromEnv("ROUTER_HEALTH_CHECK_MAX_INTERVAL", 0), "How far the health check interval of a backend grows while its servers stay healthy. The interval doubles every stable period and is back to the interval of the route after a failed check. Routes override it with the router.openshift.io/haproxy.health.check.max-interval annotation. Longer intervals apply from the next configuration written. Zero keeps the intervals fixed.")
+	flag.DurationVar(&o.LatencyWeighting.Interval, "latency-weighting-interval", getIntervalFromEnv("ROUTER_LATENCY_WEIGHTING_INTERVAL", 0), "How often the response times of the servers are sampled from haproxy to shift the weights of the servers of each backend toward its fastest servers. Zero keeps the configured weights.")
+	flag.Int32Var(&o.LatencyWeighting.MaxStep, "latency-weighting-max-step", envInt("ROUTER_LATENCY_WEIGHTING_MAX_STEP", 10, 1), "How many percentage points of its configured weight the weight of a server changes by at most per interval, when --latency-weighting-interval is set.")
+	flag.Int32Var(&o.LatencyWeighting.MinWeight, "latency-weighting-min-weight", envInt("ROUTER_LATENCY_WEIGHTING_MIN_WEIGHT", 25, 1), "The lowest percentage of its configured weight a slow server is set to, when --latency-weighting-interval is set.")
+	flag.Int32Var(&o.LatencyWeighting.Hysteresis, "latency-weighting-hysteresis", envInt("ROUTER_LATENCY_WEIGHTING_HYSTERESIS", 10, 0), "How many percentage points the weight a server should have must differ from its current weight before it is changed, when --latency-weighting-interval is set.")
+	flag.StringVar(&o.LatencyWeighting.DisableFile, "latency-weighting-disable-file", env("ROUTER_LATENCY_WEIGHTING_DISABLE_FILE", ""), "A file whose presence restores the configured weights of all the servers and stops the latency weighting until it is removed.")
+	flag.DurationVar(&o.LeastRequestWeighting.Interval, "least-request-weighting-interval", getIntervalFromEnv("ROUTER_LEAST_REQUEST_WEIGHTING_INTERVAL", 0), "How often the outstanding requests of the servers of the routes with the haproxy.router.openshift.io/least-request-weighting annotation are sampled from haproxy to shift their weights toward their least loaded servers. Zero disables the annotation.")
+	flag.Int32Var(&o.LeastRequestWeighting.MaxStep, "least-request-weighting-max-step", envInt("ROUTER_LEAST_REQUEST_WEIGHTING_MAX_STEP", 25, 1), "How many percentage points of its configured weight the weight of a server changes by at most per interval, when --least-request-weighting-interval is set.")
+	flag.Int32Var(&o.LeastRequestWeighting.MinWeight, "least-request-weighting-min-weight", envInt("ROUTER_LEAST_REQUEST_WEIGHTING_MIN_WEIGHT", 10, 1), "The lowest percentage of its configured weight a loaded server is set to, when --least-request-weighting-interval is set.")
+	flag.DurationVar(&o.HealthCheckStablePeriod, "health-check-stable-period", getIntervalFromEnv("ROUTER_HEALTH_CHECK_STABLE_PERIOD", 600), "How long the servers of a backend stay healthy before its health check interval doubles, when --health-check-max-interval is set.")
+	flag.IntVar(&o.CapacityLimits.ConfigBytes, "max-config-bytes", int(envInt("ROUTER_MAX_CONFIG_BYTES", 0, 0)), "The size in bytes of the generated configuration files past which further routes are rejected. Zero for no limit.")
+	flag.IntVar(&o.CapacityLimits.Backends, "max-backends", int(envInt("ROUTER_MAX_BACKENDS", 0, 0)), "The number of routes past which further routes are rejected. Zero for no limit.")
+	flag.IntVar(&o.CapacityLimits.ACLs, "max-acls", int(envInt("ROUTER_MAX_ACLS", 0, 0)), "The number of ACLs in the generated configuration past which further routes are rejected. Zero for no limit.")
+	flag.IntVar(&o.CapacityLimits.MapEntries, "max-map-entries", int(envInt("ROUTER_MAX_MAP_ENTRIES", 0, 0)), "The number of entries in the generated map files past which further routes are rejected. Zero for no limit.")
+	flag.IntVar(&o.CapacityLimits.Certificates, "max-certificates", int(envInt("ROUTER_MAX_CERTIFICATES", 0, 0)), "The number of route certificates past which further routes are rejected. Zero for no limit.")
+	flag.IntVar(&o.CapacityLimits.WarningPercent, "capacity-warning-percent", int(envInt("ROUTER_CAPACITY_WARNING_PERCENT", 80, 1)), "The percentage of a --max-* limit past which the router warns that it is nearing the limit.")
+	flag.StringVar(&o.SNIHostMismatchPolicy, "sni-host-mismatch-policy", env("ROUTER_SNI_HOST_MISMATCH_POLICY", ""), "What happens to TLS terminated requests whose SNI does not match their Host header, or that have no SNI: \"reject\" responds with 421 Misdirected Request, which makes clients that reuse connections across hosts retry on a new connection, \"default-backend\" sends them to the default backend. Routes are exempted with the haproxy.router.openshift.io/allow-sni-host-mismatch annotation. Empty lets them through.")
+	flag.StringVar(&o.CertificateConflictPolicy, "certificate-conflict-policy", env("ROUTER_CERTIFICATE_CONFLICT_POLICY", templateplugin.CertificateConflictOldest), "Which certificate is presented when routes supply different certificates for the same server name: \"oldest\" presents the certificate of the oldest route, \"latest-expiry\" the certificate that expires last. A CertificateConflict condition is reported in the status of the other routes.")
+	flag.StringVar(&o.SetForwardedHeaders, "set-forwarded-headers", env("ROUTER_SET_FORWARDED_HEADERS", routeapihelpers.SetForwardedHeadersAppend), "How the router sets the Forwarded and X-Forwarded-* headers of the requests to the routes that do not set the haproxy.router.openshift.io/set-forwarded-headers annotation: \"append\" appends them to the headers of the request, \"replace\" replaces the headers of the request, \"if-none\" only sets the headers the request does not have, \"never\" leaves the headers of the request as they are.")
+	flag.StringVar(&o.WAF.AgentAddress, "waf-agent-address", env("ROUTER_WAF_AGENT_ADDRESS", ""), "The host:port of a web application firewall agent the requests of the routes with the haproxy.router.openshift.io/waf annotation are sent to over SPOE. Empty ignores the annotation.")
+	flag.DurationVar(&o.WAF.ConnectTimeout, "waf-connect-timeout", getHAProxyTimeoutFromEnv("ROUTER_WAF_CONNECT_TIMEOUT", "1s"), "How long connecting to the web application firewall agent may take.")
+	flag.DurationVar(&o.WAF.ProcessingTimeout, "waf-processing-timeout", getHAProxyTimeoutFromEnv("ROUTER_WAF_PROCESSING_TIMEOUT", "100ms"), "How long the web application firewall agent may take to process a request.")
+	flag.IntVar(&o.ResponseCacheSize, "response-cache-size", int(envInt("ROUTER_RESPONSE_CACHE_SIZE", 0, 0)), "The size in megabytes the response caches of the routes with the haproxy.router.openshift.io/cache-ttl annotation may take in total. The caches are allocated in the order of the namespaces and names of their routes, and the routes whose caches do not fit are not cached. Zero ignores the annotation.")
+	flag.BoolVar(&o.TransparentProxy, "transparent-proxy", isTrue(env("ROUTER_TRANSPARENT_PROXY", "")), "Connect to the IPv4 backends of the routes from the addresses of the clients, so that the backends see the client addresses without the PROXY protocol. The replies of the backends must be routed back through the router. Requires a haproxy built with transparent proxy support, the NET_ADMIN capability, the net.ipv4.ip_forward sysctl set to 1 and the net.ipv4.conf.all.rp_filter sysctl not set to 1, which the router checks when it starts.")
+	flag.IntVar(&o.MaxMapFileEntries, "max-map-file-entries", int(envInt("ROUTER_MAX_MAP_FILE_ENTRIES", 0, 0)), "The number of entries above which the host maps of the routes are split into several files haproxy looks up in turn, to keep each file quick to parse. Zero does not split the maps.")
+	flag.DurationVar(&o.ReloadVerificationTimeout, "reload-verification-timeout", getIntervalFromEnv("ROUTER_RELOAD_VERIFICATION_TIMEOUT", 0), "How long a new haproxy process has to answer \"show info\" on the stats socket after a reload. A reload is only considered successful once it does, otherwise the configuration haproxy was last seen serving is restored and the reload fails. Zero trusts the exit code of the reload.")
+	flag.IntVar(&o.CommitPartitions, "commit-partitions", int(envInt("ROUTER_COMMIT_PARTITIONS", 1, 1)), "The number of partitions the hosts of the routes are split between when committing route changes. When the changes of a partition prevent the router from reloading, they are held back and retried with an increasing backoff while the changes of the other partitions are committed, so that a broken route only delays the hosts of its partition. One commits all the changes together.")
+	flag.DurationVar(&o.ActivationWindowInterval, "activation-window-interval", getIntervalFromEnv("ROUTER_ACTIVATION_WINDOW_INTERVAL", 60), "How often the router.openshift.io/active-windows and router.openshift.io/maintenance-windows annotations of the routes are checked to put the routes in and out of maintenance. Windows open and close on minute boundaries. Zero ignores the annotations.")
+	flag.BoolVar(&o.EndpointMetadata.Enabled, "endpoint-metadata", isTrue(env("ROUTER_ENDPOINT_METADATA", "")), "Set the txn.endpoint_pod, txn.endpoint_zone and txn.endpoint_node variables of the requests of HTTP routes to the pod, zone and node of the endpoint that served them, for use in custom log formats.")
+	flag.StringSliceVar(&o.EndpointMetadata.Labels, "endpoint-metadata-labels", envVarAsStrings("ROUTER_ENDPOINT_METADATA_LABELS", "", ","), "List of comma separated pod labels whose values are also set in the txn.endpoint_label_<label> variables, with the characters other than letters, digits and underscores of the label replaced by underscores. The router watches the pods of the namespaces it serves for them. Requires --endpoint-metadata.")
+	flag.BoolVar(&o.EndpointMetadata.Headers, "endpoint-metadata-headers", isTrue(env("ROUTER_ENDPOINT_METADATA_HEADERS", "")), "Also set the X-Endpoint-Pod, X-Endpoint-Zone, X-Endpoint-Node and X-Endpoint-Label-<label> response headers to the metadata of the endpoint. Requires --endpoint-metadata.")
+	flag.IntVar(&o.ReloadState.PeerPort, "stick-table-peer-port", int(envInt("ROUTER_STICK_TABLE_PEER_PORT", 0, 0)), "The local port through which haproxy hands the contents of its stick tables, such as the rate limiting counters, over to the new process on reload. Zero starts the new process with empty stick tables.")
+	flag.BoolVar(&o.ReloadState.ServerState, "preserve-server-state", isTrue(env("ROUTER_PRESERVE_SERVER_STATE", "")), "Save the state of the servers, such as their health and the weights and administrative states set through the runtime API, before each reload so the new haproxy process starts from it.")
+	flag.BoolVar(&o.ReloadState.MapEntries, "preserve-map-entries", isTrue(env("ROUTER_PRESERVE_MAP_ENTRIES", "")), "Save the entries added to the maps of the routes through the runtime API before each reload and add them to the new haproxy process, unless the new config has entries for their keys.")
+	flag.BoolVar(&o.StableServerNames, "stable-server-names", isTrue(env("ROUTER_STABLE_SERVER_NAMES", "")), "Name the servers of the backends after slots of their service instead of their pods, so that their names, stats and metrics stay the same when the pods change. A new pod takes over the slot of a removed one, and its address is changed through the runtime API when dynamic configuration is enabled.")
+	flag.StringVar(&o.RouteTimeoutPolicy, "route-timeout-policy", env("ROUTER_ROUTE_TIMEOUT_POLICY", routeapihelpers.RouteTimeoutPolicyClamp), "What to do with a route whose timeout annotations make its tunnel timeout shorter than its server timeout. Clamp raises its tunnel timeout to its server timeout, Reject rejects the route and requires --extended-validation.")
+	flag.IntVar(&o.Tuning.Threads, "threads", int(envInt("ROUTER_THREADS", 0, 0)), "The number of threads haproxy runs. Zero runs a thread per CPU the router pod may use, from its CPU limit and CPU set.")
+	flag.BoolVar(&o.Tuning.DisableCPUPinning, "disable-cpu-pinning", isTrue(env("ROUTER_DISABLE_CPU_PINNING", "")), "Do not pin the threads of haproxy to the CPUs of the router pod when the pod has exclusive CPUs.")
+	flag.IntVar(&o.Tuning.BufSize, "buf-size", int(envInt("ROUTER_BUF_SIZE", 0, 0)), "The size in bytes of the buffers of haproxy. Zero keeps the default of 32768.")
+	flag.IntVar(&o.Tuning.MaxRewrite, "max-rewrite-size", int(envInt("ROUTER_MAX_REWRITE_SIZE", 0, 0)), "The space in bytes reserved in the buffers of haproxy for rewriting headers. Zero keeps the default of 8192.")
+	flag.StringVar(&o.WAFFailurePolicy, "waf-failure-policy", env("ROUTER_WAF_FAILURE_POLICY", templateplugin.WAFFailOpen), "What happens to the requests the web application firewall agent fails to process, or does not process in time: \"fail-open\" forwards them, \"fail-closed\" denies them with a 503.")
+	flag.StringVar(&o.HAProxyBinary, "haproxy-binary", env("ROUTER_HAPROXY_BINARY", "/usr/sbin/haproxy"), "The haproxy binary the router starts and reloads when --in-process-reload is set, and uses to check the config snippets of routes.")
 }
 
 type RouterStats struct {
@@ -232,6 +418,8 @@ func NewCommandTemplateRouter(name string) *cobra.Command {
 	}
 
 	cmd.AddCommand(newCmdVersion(name, version.String(), os.Stdout))
+	cmd.AddCommand(newCmdPreviewRoutes(os.Stdout, os.Stderr))
+	cmd.AddCommand(newCmdSimulateShard(os.Stdout))
 
 	flag := cmd.Flags()
 	options.Config.Bind(flag)
@@ -340,6 +528,89 @@ func parseHTTPHeaderNameCaseAdjustments(in string) ([]templateplugin.HTTPHeaderN
 	return adjustments, nil
 }
 
+// tlsFrontends are the frontends that terminate TLS.
+var tlsFrontends = sets.NewString("fe_sni", "fe_no_sni")
+
+func parseTLSSessionConfig(disableTickets []string, cacheSize int, lifetime, rotationInterval time.Duration) (templateplugin.TLSSessionConfig, error) {
+	cfg := templateplugin.TLSSessionConfig{
+		CacheSize:                 cacheSize,
+		Lifetime:                  lifetime,
+		TicketKeyRotationInterval: rotationInterval,
+	}
+
+	for _, frontend := range disableTickets {
+		frontend = strings.TrimSpace(frontend)
+		if len(frontend) == 0 {
+			continue
+		}
+		if !tlsFrontends.Has(frontend) {
+			return cfg, fmt.Errorf("invalid frontend for disabled TLS session tickets: %q, must be one of %v", frontend, tlsFrontends.List())
+		}
+		if cfg.DisableTickets == nil {
+			cfg.DisableTickets = map[string]bool{}
+		}
+		cfg.DisableTickets[frontend] = true
+	}
+	if cacheSize < 0 {
+		return cfg, fmt.Errorf("invalid TLS session cache size: %d", cacheSize)
+	}
+	if lifetime < 0 || (lifetime > 0 && lifetime < time.Second) {
+		return cfg, fmt.Errorf("invalid TLS session lifetime %v, must be at least one second", lifetime)
+	}
+	if rotationInterval < 0 || (rotationInterval > 0 && rotationInterval < time.Minute) {
+		return cfg, fmt.Errorf("invalid TLS ticket key rotation interval %v, must be at least one minute", rotationInterval)
+	}
+	if rotationInterval > 0 && len(cfg.DisableTickets) == tlsFrontends.Len() {
+		return cfg, fmt.Errorf("TLS ticket key rotation requires TLS session tickets on at least one frontend")
+	}
+
+	return cfg, nil
+}
+
+func parseAdaptiveHealthCheckConfig(maxInterval, stablePeriod time.Duration) (templateplugin.AdaptiveHealthCheckConfig, error) {
+	cfg := templateplugin.AdaptiveHealthCheckConfig{
+		MaxInterval:  maxInterval,
+		StablePeriod: stablePeriod,
+	}
+	if maxInterval < 0 || (maxInterval > 0 && maxInterval < time.Second) {
+		return cfg, fmt.Errorf("invalid maximum health check interval %v, must be at least one second", maxInterval)
+	}
+	if maxInterval > 0 && stablePeriod < time.Minute {
+		return cfg, fmt.Errorf("invalid health check stable period %v, must be at least one minute", stablePeriod)
+	}
+	return cfg, nil
+}
+
+func validateLatencyWeightingConfig(cfg templateplugin.LatencyWeightingConfig) error {
+	switch {
+	case cfg.Interval == 0:
+		return nil
+	case cfg.Interval < 5*time.Second:
+		return fmt.Errorf("invalid latency weighting interval %v, must be at least 5 seconds", cfg.Interval)
+	case cfg.MaxStep < 1 || cfg.MaxStep > 100:
+		return fmt.Errorf("invalid latency weighting maximum step %d, must be between 1 and 100", cfg.MaxStep)
+	case cfg.MinWeight < 1 || cfg.MinWeight > 100:
+		return fmt.Errorf("invalid latency weighting minimum weight %d, must be between 1 and 100", cfg.MinWeight)
+	case cfg.Hysteresis < 0 || cfg.Hysteresis > 100:
+		return fmt.Errorf("invalid latency weighting hysteresis %d, must be between 0 and 100", cfg.Hysteresis)
+	}
+	return nil
+}
+
+func validateLeastRequestWeightingConfig(cfg templateplugin.LeastRequestWeightingConfig) error {
+	switch {
+	case cfg.Interval == 0:
+		return nil
+	case cfg.Interval < time.Second:
+		return fmt.Errorf("invalid least-request weighting interval %v, must be at least 1 second", cfg.Interval)
+	case cfg.MaxStep < 1 || cfg.MaxStep > 100:
+		return fmt.Errorf("invalid least-request weighting maximum step %d, must be between 1 and 100", cfg.MaxStep)
+	case cfg.MinWeight < 1 || cfg.MinWeight > 100:
+		return fmt.Errorf("invalid least-request weighting minimum weight %d, must be between 1 and 100", cfg.MinWeight)
+	}
+	return nil
+}
+
 func (o *TemplateRouterOptions) Complete() error {
 	routerSvcName := env("ROUTER_SERVICE_NAME", "")
 	routerSvcNamespace := env("ROUTER_SERVICE_NAMESPACE", "")
@@ -381,6 +652,10 @@ func (o *TemplateRouterOptions) Complete() error {
 		return fmt.Errorf("invalid dynamic configuration manager commit interval: %v - must be a positive duration", nsecs)
 	}
 
+	if o.BatchErrorPercent < 0 || o.BatchErrorPercent > 100 {
+		return fmt.Errorf("invalid dynamic configuration manager batch error percentage: %d - must be between 0 and 100", o.BatchErrorPercent)
+	}
+
 	captureHTTPRequestHeaders, err := parseCaptureHeaders(o.CaptureHTTPRequestHeadersString)
 	if err != nil {
 		return err
@@ -405,9 +680,211 @@ func (o *TemplateRouterOptions) Complete() error {
 	}
 	o.HTTPHeaderNameCaseAdjustments = httpHeaderNameCaseAdjustments
 
+	uriNormalizers, err := routeapihelpers.ParseURINormalizers(o.URINormalizersString)
+	if err != nil {
+		return fmt.Errorf("invalid URI normalizers: %v", err)
+	}
+	o.URINormalizers = uriNormalizers
+
+	if len(o.ResponseHeaderPolicyFile) > 0 {
+		policy, err := ioutil.ReadFile(o.ResponseHeaderPolicyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read the response header policy: %v", err)
+		}
+		rules, err := routeapihelpers.ParseResponseHeaderPolicy(string(policy))
+		if err != nil {
+			return fmt.Errorf("invalid response header policy %s: %v", o.ResponseHeaderPolicyFile, err)
+		}
+		o.ResponseHeaderPolicy = rules
+	}
+
+	if len(o.ReadinessLevelName) > 0 {
+		level, err := metrics.ParseReadinessLevel(o.ReadinessLevelName)
+		if err != nil {
+			return err
+		}
+		o.ReadinessLevel = level
+	}
+
+	if len(o.CertificateDistrustedCAsFile) > 0 {
+		cas, err := controller.LoadDistrustedCAs(o.CertificateDistrustedCAsFile)
+		if err != nil {
+			return err
+		}
+		o.CertificateDistrustedCAs = cas
+	}
+
+	tcpPortRange, err := routeapihelpers.ParsePortRange(o.TCPPortRangeString)
+	if err != nil {
+		return fmt.Errorf("invalid TCP port range: %v", err)
+	}
+	o.TCPPortRange = tcpPortRange
+
+	tlsSession, err := parseTLSSessionConfig(o.DisableTLSSessionTickets, o.TLSSessionCacheSize, o.TLSSessionLifetime, o.TLSTicketKeyRotationInterval)
+	if err != nil {
+		return err
+	}
+	o.TLSSession = tlsSession
+
+	switch o.SNIHostMismatchPolicy {
+	case "", templateplugin.SNIHostMismatchReject, templateplugin.SNIHostMismatchDefaultBackend:
+	default:
+		return fmt.Errorf("invalid SNI host mismatch policy %q, must be %q, %q or empty", o.SNIHostMismatchPolicy, templateplugin.SNIHostMismatchReject, templateplugin.SNIHostMismatchDefaultBackend)
+	}
+
+	switch o.CertificateConflictPolicy {
+	case templateplugin.CertificateConflictOldest, templateplugin.CertificateConflictLatestExpiry:
+	default:
+		return fmt.Errorf("invalid certificate conflict policy %q, must be %q or %q", o.CertificateConflictPolicy, templateplugin.CertificateConflictOldest, templateplugin.CertificateConflictLatestExpiry)
+	}
+
+	if !sets.NewString(routeapihelpers.SetForwardedHeadersPolicies...).Has(o.SetForwardedHeaders) {
+		return fmt.Errorf("invalid set-forwarded-headers policy %q, must be one of %s", o.SetForwardedHeaders, strings.Join(routeapihelpers.SetForwardedHeadersPolicies, ", "))
+	}
+
+	if len(o.WAF.AgentAddress) > 0 {
+		if _, _, err := net.SplitHostPort(o.WAF.AgentAddress); err != nil {
+			return fmt.Errorf("invalid web application firewall agent address %q: %v", o.WAF.AgentAddress, err)
+		}
+		if o.WAF.ConnectTimeout <= 0 || o.WAF.ProcessingTimeout <= 0 {
+			return fmt.Errorf("web application firewall agent timeouts must be positive")
+		}
+	}
+	switch o.WAFFailurePolicy {
+	case templateplugin.WAFFailOpen:
+	case templateplugin.WAFFailClosed:
+		o.WAF.FailClosed = true
+	default:
+		return fmt.Errorf("invalid web application firewall failure policy %q, must be %q or %q", o.WAFFailurePolicy, templateplugin.WAFFailOpen, templateplugin.WAFFailClosed)
+	}
+
+	if o.ResponseCacheSize < 0 {
+		return fmt.Errorf("response cache size must not be negative")
+	}
+
+	if o.TransparentProxy && len(o.HAProxyBinary) == 0 {
+		return fmt.Errorf("--transparent-proxy requires --haproxy-binary to check that haproxy supports transparent proxying")
+	}
+
+	if o.MaxMapFileEntries < 0 {
+		return fmt.Errorf("max map file entries must not be negative")
+	}
+
+	if o.ReloadVerificationTimeout < 0 {
+		return fmt.Errorf("reload verification timeout must not be negative")
+	}
+
+	if o.CommitPartitions < 1 {
+		return fmt.Errorf("invalid commit partitions: %d - must be at least one", o.CommitPartitions)
+	}
+
+	if o.ActivationWindowInterval < 0 {
+		return fmt.Errorf("activation window interval must not be negative")
+	}
+
+	if !o.EndpointMetadata.Enabled && (len(o.EndpointMetadata.Labels) > 0 || o.EndpointMetadata.Headers) {
+		return fmt.Errorf("--endpoint-metadata-labels and --endpoint-metadata-headers require --endpoint-metadata")
+	}
+	for _, label := range o.EndpointMetadata.Labels {
+		if errs := validation.IsQualifiedName(label); len(errs) > 0 {
+			return fmt.Errorf("invalid endpoint metadata label %q: %s", label, strings.Join(errs, ", "))
+		}
+	}
+
+	if o.MaxWorkerReloads < 0 {
+		return fmt.Errorf("invalid max worker reloads %d, must not be negative", o.MaxWorkerReloads)
+	}
+
+	if o.ReloadState.PeerPort < 0 || o.ReloadState.PeerPort > 65535 {
+		return fmt.Errorf("invalid stick table peer port %d, must be between 0 and 65535", o.ReloadState.PeerPort)
+	}
+
+	for _, option := range o.HTTPCompatOptions {
+		if !sets.NewString(routeapihelpers.SupportedHTTPCompatOptions...).Has(option) {
+			return fmt.Errorf("invalid HTTP compatibility option %q, must be one of %s", option, strings.Join(routeapihelpers.SupportedHTTPCompatOptions, ", "))
+		}
+	}
+
+	switch o.RouteTimeoutPolicy {
+	case routeapihelpers.RouteTimeoutPolicyClamp:
+	case routeapihelpers.RouteTimeoutPolicyReject:
+		if !o.ExtendedValidation {
+			return fmt.Errorf("the %s route timeout policy requires --extended-validation", o.RouteTimeoutPolicy)
+		}
+	default:
+		return fmt.Errorf("invalid route timeout policy %q, must be %s or %s", o.RouteTimeoutPolicy, routeapihelpers.RouteTimeoutPolicyClamp, routeapihelpers.RouteTimeoutPolicyReject)
+	}
+
+	if o.Tuning.Threads < 0 || o.Tuning.Threads > 64 {
+		return fmt.Errorf("invalid threads %d, must be between 0 and 64", o.Tuning.Threads)
+	}
+	if o.Tuning.BufSize < 0 || o.Tuning.MaxRewrite < 0 {
+		return fmt.Errorf("buffer and rewrite sizes must not be negative")
+	}
+	if o.Tuning.BufSize > 0 && o.Tuning.MaxRewrite > 0 && o.Tuning.MaxRewrite > o.Tuning.BufSize/2 {
+		return fmt.Errorf("invalid max rewrite size %d, must be at most half the buffer size %d", o.Tuning.MaxRewrite, o.Tuning.BufSize)
+	}
+
+	adaptiveHealthChecks, err := parseAdaptiveHealthCheckConfig(o.HealthCheckMaxInterval, o.HealthCheckStablePeriod)
+	if err != nil {
+		return err
+	}
+	o.AdaptiveHealthChecks = adaptiveHealthChecks
+
+	if err := validateLatencyWeightingConfig(o.LatencyWeighting); err != nil {
+		return err
+	}
+	if o.LatencyWeighting.Interval > 0 && o.UseHAProxyConfigManager {
+		return fmt.Errorf("latency weighting cannot be used with the haproxy config manager, which manages the server weights")
+	}
+	if err := validateLeastRequestWeightingConfig(o.LeastRequestWeighting); err != nil {
+		return err
+	}
+	if o.LeastRequestWeighting.Interval > 0 && o.UseHAProxyConfigManager {
+		return fmt.Errorf("least-request weighting cannot be used with the haproxy config manager, which manages the server weights")
+	}
+
+	if o.CapacityLimits.WarningPercent < 1 || o.CapacityLimits.WarningPercent > 100 {
+		return fmt.Errorf("invalid capacity warning percentage %d, must be between 1 and 100", o.CapacityLimits.WarningPercent)
+	}
+
+	if len(o.StandbyLease) > 0 {
+		o.Standby = true
+	}
+
 	return o.RouterSelection.Complete()
 }
 
+// validateTelemetryExporters checks that the exporters are known and that
+// the OTLP options are set exactly when the OTLP exporter is selected.
+func validateTelemetryExporters(exporters []string, otlp telemetry.OTLPConfig) error {
+	supported := sets.NewString(telemetry.Exporters...)
+	for _, exporter := range exporters {
+		if !supported.Has(exporter) {
+			return fmt.Errorf("invalid telemetry exporter %q - supported exporters are: %s", exporter, strings.Join(supported.List(), ", "))
+		}
+	}
+	if !sets.NewString(exporters...).Has(telemetry.ExporterOTLP) {
+		if len(otlp.Endpoint) > 0 {
+			return fmt.Errorf("--otlp-endpoint requires the %s telemetry exporter", telemetry.ExporterOTLP)
+		}
+		return nil
+	}
+	if len(otlp.Endpoint) == 0 {
+		return fmt.Errorf("the %s telemetry exporter requires --otlp-endpoint", telemetry.ExporterOTLP)
+	}
+	if _, _, err := net.SplitHostPort(otlp.Endpoint); err != nil {
+		return fmt.Errorf("invalid OTLP endpoint %q: %v", otlp.Endpoint, err)
+	}
+	if otlp.Insecure && len(otlp.CAFile) > 0 {
+		return fmt.Errorf("--otlp-insecure and --otlp-ca-file are mutually exclusive")
+	}
+	if otlp.Interval <= 0 {
+		return fmt.Errorf("the OTLP export interval must be positive")
+	}
+	return nil
+}
+
 // supportedMetricsTypes is the set of supported metrics arguments
 var supportedMetricsTypes = sets.NewString("haproxy")
 
@@ -418,6 +895,9 @@ func (o *TemplateRouterOptions) Validate() error {
 	if len(o.RouterName) == 0 && o.UpdateStatus {
 		return errors.New("router must have a name to identify itself in route status")
 	}
+	if err := validateTelemetryExporters(o.TelemetryExporters, o.OTLP); err != nil {
+		return err
+	}
 	if len(o.TemplateFile) == 0 {
 		return errors.New("template file must be specified")
 	}
@@ -426,19 +906,162 @@ func (o *TemplateRouterOptions) Validate() error {
 			return fmt.Errorf("unable to load default destination CA certificate: %v", err)
 		}
 	}
-	if len(o.ReloadScript) == 0 {
+	if o.InProcessReload {
+		if len(o.HAProxyBinary) == 0 {
+			return errors.New("haproxy binary must be specified when reloading in process")
+		}
+	} else if len(o.ReloadScript) == 0 {
 		return errors.New("reload script must be specified")
 	}
+	if len(o.RouterStateConfigMap) > 0 {
+		if !o.UpdateStatus {
+			return errors.New("router state config map requires route status updates to be enabled")
+		}
+		if len(o.StatusLease) == 0 {
+			return errors.New("router state config map requires a status lease, so that only the status writer publishes it")
+		}
+		if parts := strings.Split(o.RouterStateConfigMap, "/"); len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return fmt.Errorf("router state config map %q must be of the form namespace/name", o.RouterStateConfigMap)
+		}
+	}
+	if len(o.StandbyLease) > 0 {
+		if parts := strings.Split(o.StandbyLease, "/"); len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return fmt.Errorf("standby lease %q must be of the form namespace/name", o.StandbyLease)
+		}
+		if o.StandbyLeaseDuration < time.Second {
+			return fmt.Errorf("invalid standby lease duration: %v - must be at least one second", o.StandbyLeaseDuration)
+		}
+	}
+	if o.AnnotationWarnings && !o.UpdateStatus {
+		return errors.New("annotation warnings require route status updates to be enabled")
+	}
+	if o.BackendAvailabilityCondition && !o.UpdateStatus {
+		return errors.New("the backend availability condition requires route status updates to be enabled")
+	}
+	if o.ServiceCheck && !o.UpdateStatus {
+		return errors.New("the service check requires route status updates to be enabled")
+	}
+	if o.CertificateCheckInterval < 0 || o.CertificateCheckTimeout < 0 || o.CertificateDistrustWarning < 0 {
+		return errors.New("the certificate check interval, timeout and distrust warning must not be negative")
+	}
+	if o.CertificateCheckInterval > 0 && !o.UpdateStatus {
+		return errors.New("certificate checks require route status updates to be enabled")
+	}
+	if o.StatusReconcileInterval < 0 {
+		return errors.New("the status reconcile interval must not be negative")
+	}
+	if o.StatusReconcileInterval > 0 && !o.UpdateStatus {
+		return errors.New("status reconciliation requires route status updates to be enabled")
+	}
+	if len(o.StatusLease) > 0 {
+		if !o.UpdateStatus {
+			return errors.New("status lease requires route status updates to be enabled")
+		}
+		if parts := strings.Split(o.StatusLease, "/"); len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return fmt.Errorf("status lease %q must be of the form namespace/name", o.StatusLease)
+		}
+		if o.StatusLeaseDuration < time.Second {
+			return fmt.Errorf("invalid status lease duration: %v - must be at least one second", o.StatusLeaseDuration)
+		}
+	}
 	return nil
 }
 
+// admissionPlugins wraps next in the admission plugins of the router, from
+// the route class filter that sees the routes first down to the TCP port
+// allocator.  The router and simulate-shard both build their chain with it.
+func (o *TemplateRouterOptions) admissionPlugins(next router.Plugin, recorder controller.RejectionRecorder, ingressRemover controller.IngressRemover) (router.Plugin, error) {
+	plugin := next
+	tcpPorts := controller.NewTCPPortAllocator(plugin, o.TCPPortRange, o.reservedPorts(), recorder)
+	tcpPorts.SetRouterName(o.RouterName)
+	plugin = tcpPorts
+	if o.ExtendedValidation {
+		timeouts := routerTimeoutsFromEnv()
+		if err := routeapihelpers.ValidateRouterTimeouts(timeouts); err != nil {
+			log.V(0).Info("router timeouts are inconsistent", "error", err.Error())
+		}
+		validator := controller.NewExtendedValidator(plugin, recorder)
+		validator.SetRouterTimeouts(timeouts)
+		validator.SetRouteTimeoutPolicy(o.RouteTimeoutPolicy)
+		validator.SetHTTPCompatOptions(sets.NewString(o.HTTPCompatOptions...))
+		disableHTTP2, _ := strconv.ParseBool(env("ROUTER_DISABLE_HTTP2", ""))
+		validator.SetALPNProtocols(routeapihelpers.AllowedALPNProtocols(disableHTTP2))
+		validator.SetAllowIDNHosts(o.AllowIDNHosts)
+		plugin = validator
+	}
+	if len(o.ConfigSnippetDirectives) > 0 {
+		// Snippets are checked with haproxy whenever they are allowed, the
+		// router would not reload with a snippet haproxy rejects.
+		checker := controller.NewHAProxyConfigSnippetChecker(o.HAProxyBinary, filepath.Join(o.WorkingDir, "config-snippet-check"))
+		plugin = controller.NewConfigSnippetValidator(plugin, sets.NewString(o.ConfigSnippetDirectives...), checker, recorder)
+	} else if o.ExtendedValidation {
+		plugin = controller.NewConfigSnippetValidator(plugin, sets.NewString(), nil, recorder)
+	}
+	if o.StrictFIPSTLSPolicy {
+		plugin = controller.NewFIPSCompliance(plugin, recorder)
+	}
+	uniqueHost := controller.NewUniqueHost(plugin, o.DisableNamespaceOwnershipCheck, recorder)
+	if err := uniqueHost.SetHostArbitration(o.HostArbitration()); err != nil {
+		return nil, err
+	}
+	if len(o.HostClaimCache) > 0 {
+		if err := uniqueHost.SetHostClaimStore(controller.NewFileHostClaimStore(o.HostClaimCache)); err != nil {
+			log.Error(err, "unable to restore host claims, host ownership will be determined from the initial sync", "path", o.HostClaimCache)
+		}
+	}
+	plugin = uniqueHost
+	plugin = controller.NewHostAdmitter(plugin, o.RouteAdmissionFunc(), o.AllowWildcardRoutes, o.DisableNamespaceOwnershipCheck, recorder)
+	classes := o.RouteClasses
+	if len(classes) == 0 {
+		// routes annotated for another class are left to the routers of
+		// that class.
+		classes = []string{routeapihelpers.DefaultRouteClass}
+	}
+	routeClasses := controller.NewRouteClassFilter(plugin, classes, ingressRemover)
+	if o.RouteClassHandoff {
+		routeClasses.EnableHandoff(o.RouterName)
+	}
+	plugin = routeClasses
+	return plugin, nil
+}
+
+// reservedPorts returns the ports the router listens on itself, which are
+// never allocated to TCP routes.
+func (o *TemplateRouterOptions) reservedPorts() []int32 {
+	ports := []int32{envInt("ROUTER_SERVICE_HTTP_PORT", 80, 1), envInt("ROUTER_SERVICE_HTTPS_PORT", 443, 1)}
+	if o.StatsPort != 0 {
+		ports = append(ports, int32(o.StatsPort))
+	} else {
+		ports = append(ports, 1936)
+	}
+	return ports
+}
+
 // Run launches a template router using the provided options. It never exits.
 func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 	log.V(0).Info("starting router", "version", version.String())
 	var ptrTemplatePlugin *templateplugin.TemplatePlugin
+	var ptrRouterController *controller.RouterController
 
 	var reloadCallbacks []func()
 
+	if sets.NewString(o.TelemetryExporters...).Has(telemetry.ExporterOTLP) {
+		o.OTLP.RouterName = o.RouterName
+		o.OTLP.RouterNamespace = env("POD_NAMESPACE", "")
+		stopTelemetry, err := telemetry.StartOTLP(context.Background(), o.OTLP)
+		if err != nil {
+			return err
+		}
+		go func() {
+			<-stopCh
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := stopTelemetry(ctx); err != nil {
+				log.Error(err, "unable to flush the telemetry")
+			}
+		}()
+	}
+
 	statsPort := o.StatsPort
 	switch {
 	case o.MetricsType == "haproxy" && statsPort != 0:
@@ -470,6 +1093,15 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 			serverThreshold = i
 		}
 		// Exposed to allow tuning in production if this becomes an issue
+		var routeBudget int
+		if t := env("ROUTER_METRICS_HAPROXY_ROUTE_BUDGET", ""); len(t) > 0 {
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 {
+				return fmt.Errorf("ROUTER_METRICS_HAPROXY_ROUTE_BUDGET is not a valid non-negative integer: %v", t)
+			}
+			routeBudget = i
+		}
+		// Exposed to allow tuning in production if this becomes an issue
 		var exported []int
 		if t := env("ROUTER_METRICS_HAPROXY_EXPORTED", ""); len(t) > 0 {
 			for _, s := range strings.Split(t, ",") {
@@ -490,6 +1122,7 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 			ServerThreshold:    serverThreshold,
 			BaseScrapeInterval: baseScrapeInterval,
 			ExportedMetrics:    exported,
+			RouteBudget:        routeBudget,
 		})
 		if err != nil {
 			return err
@@ -511,6 +1144,14 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		if err != nil {
 			return err
 		}
+		readyChecks := []healthz.HealthChecker{checkBackend, checkSync, metrics.ProcessRunning(stopCh)}
+		if o.ReadinessLevel > metrics.ReadinessNone {
+			checkReadiness, err := metrics.ReadinessReached(&ptrTemplatePlugin, &ptrRouterController, o.ReadinessLevel)
+			if err != nil {
+				return err
+			}
+			readyChecks = append(readyChecks, checkReadiness)
+		}
 		checkController := metrics.ControllerLive()
 		liveChecks := []healthz.HealthChecker{checkController}
 		if !(isTrue(env("ROUTER_BIND_PORTS_BEFORE_SYNC", ""))) {
@@ -564,8 +1205,18 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 				Resource:        "routers",
 				Name:            o.RouterName,
 			},
-			LiveChecks:  liveChecks,
-			ReadyChecks: []healthz.HealthChecker{checkBackend, checkSync, metrics.ProcessRunning(stopCh)},
+			LiveChecks:     liveChecks,
+			ReadyChecks:    readyChecks,
+			DisableMetrics: !sets.NewString(o.TelemetryExporters...).Has(telemetry.ExporterPrometheus),
+			DebugHandlers: map[string]http.Handler{
+				"/debug/reloads":        metrics.ReloadHistory(&ptrTemplatePlugin),
+				"/debug/routes/explain": metrics.RouteExplain(&ptrTemplatePlugin),
+				"/debug/state":          metrics.StateSnapshot(&ptrTemplatePlugin),
+				"/debug/resync":         metrics.Resync(&ptrTemplatePlugin, &ptrRouterController),
+				"/debug/support-bundle": metrics.SupportBundle(&ptrTemplatePlugin),
+				"/debug/readiness":      metrics.ReadinessStatus(&ptrTemplatePlugin, &ptrRouterController),
+				"/debug/events":         metrics.EventHistory(&ptrRouterController),
+			},
 		}
 
 		if tlsConfig, err := makeTLSConfig(30 * time.Second); err != nil {
@@ -612,6 +1263,7 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 			MaxDynamicServers:      o.MaxDynamicServers,
 			WildcardRoutesAllowed:  o.AllowWildcardRoutes,
 			ExtendedValidation:     o.ExtendedValidation,
+			BatchErrorThreshold:    float64(o.BatchErrorPercent) / 100,
 		}
 		cfgManager = haproxyconfigmanager.NewHAProxyConfigManager(cmopts)
 		if len(o.BlueprintRouteNamespace) > 0 {
@@ -619,6 +1271,25 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		}
 	}
 
+	var capabilities *templateplugin.HAProxyCapabilities
+	if len(o.HAProxyBinary) > 0 {
+		probed, err := templateplugin.ProbeHAProxyCapabilities(o.HAProxyBinary)
+		switch {
+		case err == nil:
+			capabilities = probed
+		case o.TransparentProxy:
+			return err
+		default:
+			log.V(0).Info("unable to probe the capabilities of haproxy, only the directives every version supports are used", "error", err)
+		}
+	}
+	if o.TransparentProxy {
+		if err := templateplugin.CheckTransparentProxy(capabilities); err != nil {
+			return fmt.Errorf("--transparent-proxy cannot be used: %v", err)
+		}
+		log.V(0).Info("connecting to the backends from the addresses of the clients", "haproxyVersion", capabilities.Version)
+	}
+
 	statsUsername, statsPassword, err := getStatsAuth(o.StatsUsernameFile, o.StatsPasswordFile, o.StatsUsername, o.StatsPassword)
 	if err != nil {
 		return err
@@ -627,9 +1298,13 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 	pluginCfg := templateplugin.TemplatePluginConfig{
 		WorkingDir:                    o.WorkingDir,
 		TemplatePath:                  o.TemplateFile,
+		TemplateOverridePaths:         o.TemplateOverrides,
 		ReloadScriptPath:              o.ReloadScript,
+		HAProxyBinary:                 o.HAProxyBinary,
+		InProcessReload:               o.InProcessReload,
 		ReloadInterval:                o.ReloadInterval,
 		ReloadCallbacks:               reloadCallbacks,
+		MasterSocketPath:              o.MasterSocket,
 		DefaultCertificate:            o.DefaultCertificate,
 		DefaultCertificatePath:        o.DefaultCertificatePath,
 		DefaultCertificateDir:         o.DefaultCertificateDir,
@@ -638,7 +1313,11 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		StatsUsername:                 statsUsername,
 		StatsPassword:                 statsPassword,
 		BindPortsAfterSync:            o.BindPortsAfterSync,
+		Standby:                       o.Standby,
+		ConfigSnippetDirectives:       sets.NewString(o.ConfigSnippetDirectives...),
+		HTTPCompatOptions:             sets.NewString(o.HTTPCompatOptions...),
 		IncludeUDP:                    o.RouterSelection.IncludeUDP,
+		TopologyAwareRouting:          o.RouterSelection.TopologyAwareRouting,
 		AllowWildcardRoutes:           o.RouterSelection.AllowWildcardRoutes,
 		MaxConnections:                o.MaxConnections,
 		Ciphers:                       o.Ciphers,
@@ -648,6 +1327,31 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		CaptureHTTPResponseHeaders:    o.CaptureHTTPResponseHeaders,
 		CaptureHTTPCookie:             o.CaptureHTTPCookie,
 		HTTPHeaderNameCaseAdjustments: o.HTTPHeaderNameCaseAdjustments,
+		URINormalizers:                o.URINormalizers,
+		ResponseHeaderPolicy:          o.ResponseHeaderPolicy,
+		TLSSession:                    o.TLSSession,
+		AdaptiveHealthChecks:          o.AdaptiveHealthChecks,
+		LatencyWeighting:              o.LatencyWeighting,
+		LeastRequestWeighting:         o.LeastRequestWeighting,
+		CapacityLimits:                o.CapacityLimits,
+		SNIHostMismatchPolicy:         o.SNIHostMismatchPolicy,
+		CertificateConflictPolicy:     o.CertificateConflictPolicy,
+		SetForwardedHeaders:           o.SetForwardedHeaders,
+		WAF:                           o.WAF,
+		ResponseCacheSize:             o.ResponseCacheSize,
+		MaxMapFileEntries:             o.MaxMapFileEntries,
+		TransparentProxy:              o.TransparentProxy,
+		HAProxyCapabilities:           capabilities,
+		ReloadVerificationTimeout:     o.ReloadVerificationTimeout,
+		CommitPartitions:              o.CommitPartitions,
+		ActivationWindowInterval:      o.ActivationWindowInterval,
+		EndpointMetadata:              o.EndpointMetadata,
+		ReloadState:                   o.ReloadState,
+		OldWorkers:                    o.oldWorkers(),
+		StableServerNames:             o.StableServerNames,
+		RouterTimeouts:                routerTimeoutsFromEnv(),
+		RouteTimeoutPolicy:            o.RouteTimeoutPolicy,
+		Tuning:                        o.Tuning,
 	}
 
 	svcFetcher := templateplugin.NewListWatchServiceLookup(kc.CoreV1(), o.ResyncInterval, o.Namespace)
@@ -656,12 +1360,49 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		return err
 	}
 	ptrTemplatePlugin = templatePlugin
+	if len(o.EndpointMetadata.Labels) > 0 {
+		templatePlugin.PodLabels = templateplugin.NewListWatchPodLabelLookup(kc.CoreV1(), o.ResyncInterval, o.Namespace, o.EndpointMetadata.Labels)
+	}
+	if o.TLSSession.TicketKeyRotationInterval > 0 {
+		if err := templatePlugin.RunTLSTicketKeyRotation(stopCh); err != nil {
+			return err
+		}
+	}
+	if o.AdaptiveHealthChecks.MaxInterval > 0 {
+		if err := templatePlugin.RunBackendStabilityTracking(stopCh); err != nil {
+			return err
+		}
+	}
+	if o.LatencyWeighting.Interval > 0 {
+		if err := templatePlugin.RunLatencyWeighting(stopCh); err != nil {
+			return err
+		}
+	}
+	if o.LeastRequestWeighting.Interval > 0 {
+		if err := templatePlugin.RunLeastRequestWeighting(stopCh); err != nil {
+			return err
+		}
+	}
+	if o.ActivationWindowInterval > 0 {
+		if err := templatePlugin.RunActivationScheduler(stopCh); err != nil {
+			return err
+		}
+	}
+	promoteFns := []func(){templatePlugin.Promote}
 
 	factory := o.RouterSelection.NewFactory(routeclient, projectclient.ProjectV1().Projects(), kc)
-	factory.RouteModifierFn = o.RouteUpdate
+	factory.Registerer = prometheus.DefaultRegisterer
+	factory.RouteModifierFn = func(route *routev1.Route) {
+		o.RouteUpdate(route)
+		// Share the certificates and hosts of routes held by the informer
+		// cache with the router state.
+		templatePlugin.InternRoute(route)
+	}
 
 	var plugin router.Plugin = templatePlugin
 	var recorder controller.RejectionRecorder = controller.LogRejections
+	var statusWriter *controller.StatusAdmitter
+	var ingressRemover controller.IngressRemover
 	if o.UpdateStatus {
 		lease := writerlease.New(time.Minute, 3*time.Second)
 		go lease.Run(stopCh)
@@ -670,18 +1411,80 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		tracker.SetConflictMessage(fmt.Sprintf("The router detected another process is writing conflicting updates to route status with name %q. Please ensure that the configuration of all routers is consistent. Route status will not be updated as long as conflicts are detected.", o.RouterName))
 		go tracker.Run(stopCh)
 		routeLister := routelisters.NewRouteLister(informer.GetIndexer())
-		status := controller.NewStatusAdmitter(plugin, routeclient.RouteV1(), routeLister, o.RouterName, o.RouterCanonicalHostname, lease, tracker)
+		status := controller.NewStatusAdmitter(plugin, routeclient.RouteV1(), o.SubdomainHosts.Lister(routeLister), o.RouterName, o.RouterCanonicalHostname, lease, tracker)
+		if len(o.RouterStateConfigMap) > 0 {
+			parts := strings.Split(o.RouterStateConfigMap, "/")
+			summary := controller.NewRouterStateSummary(o.RouterName, controller.NewConfigMapRouterStatePublisher(kc.CoreV1(), parts[0], parts[1]))
+			summary.SetWriter(status.IsWriting)
+			go summary.Run(o.ResyncInterval/10, stopCh)
+			status.AddStatusSink(summary)
+		}
+		if o.Standby {
+			status.EnableStandby()
+			promoteFns = append(promoteFns, status.Promote)
+		}
+		if o.AnnotationWarnings {
+			status.EnableAnnotationWarnings()
+		}
+		if o.BackendAvailabilityCondition {
+			status.EnableBackendAvailability()
+		}
+		if o.ServiceCheck {
+			status.EnableServiceCheck()
+			status.WatchServices(svcFetcher.Informer(), stopCh)
+		}
+		if o.CertificateCheckInterval > 0 {
+			checker := controller.NewCertificateChecker(o.CertificateDistrustedCAs, o.CertificateDistrustWarning, o.CertificateCheckTimeout)
+			status.EnableCertificateMonitor(checker, o.CertificateCheckInterval, prometheus.DefaultRegisterer, stopCh)
+		}
+		if o.StatusReconcileInterval > 0 {
+			status.EnableStatusReconciliation(o.StatusReconcileInterval, stopCh)
+		}
+		if len(o.StatusLease) > 0 {
+			status.EnableLeaderElection()
+			statusWriter = status
+		}
 		recorder = status
+		ingressRemover = status
 		plugin = status
 	}
-	if o.ExtendedValidation {
-		plugin = controller.NewExtendedValidator(plugin, recorder)
+	plugin, err = o.admissionPlugins(plugin, recorder, ingressRemover)
+	if err != nil {
+		return err
+	}
+	if len(o.NamespaceDefaultAnnotations) > 0 {
+		// The routes of the initial sync need the defaults of their
+		// namespace, which are listed first.
+		namespaceDefaults := controller.NewNamespaceDefaults(plugin, o.NamespaceDefaultAnnotations)
+		namespaceDefaults.Run(kc.CoreV1(), o.ResyncInterval, stopCh)
+		plugin = namespaceDefaults
+	}
+	templatePlugin.SetRejectionRecorder(recorder)
+	if conflicts, ok := recorder.(templateplugin.CertificateConflictRecorder); ok {
+		templatePlugin.SetCertificateConflictRecorder(conflicts)
+	}
+	if o.CapacityLimits.Enabled() {
+		if podRecorder := newPodEventRecorder(kc); podRecorder != nil {
+			templatePlugin.SetCapacityEventRecorder(podRecorder)
+		}
 	}
-	plugin = controller.NewUniqueHost(plugin, o.RouterSelection.DisableNamespaceOwnershipCheck, recorder)
-	plugin = controller.NewHostAdmitter(plugin, o.RouteAdmissionFunc(), o.AllowWildcardRoutes, o.RouterSelection.DisableNamespaceOwnershipCheck, recorder)
 
+	routeErrors, _ := recorder.(controller.RouteErrorRecorder)
 	controller := factory.Create(plugin, false, stopCh)
+	controller.RouteErrors = routeErrors
+	if o.CapacityLimits.Enabled() {
+		templatePlugin.SetCapacityRequeuer(func(namespace, name string) { controller.Resync(namespace, name) })
+	}
+	if templatePlugin.PodLabels != nil {
+		// The endpoints of the routes of a namespace pick up the labels
+		// of its pods when they change.
+		templatePlugin.PodLabels.OnLabelsChanged(func(namespace string) { controller.Resync(namespace, "") })
+	}
 	controller.Run()
+	ptrRouterController = controller
+	if len(o.RouterDomainFile) > 0 {
+		o.SubdomainHosts.WatchDomainFile(o.RouterDomainFile, 30*time.Second, controller, stopCh)
+	}
 
 	if blueprintPlugin != nil {
 		// f is like factory but filters the routes based on the
@@ -694,23 +1497,68 @@ func (o *TemplateRouterOptions) Run(stopCh <-chan struct{}) error {
 		c.Run()
 	}
 
+	identity := env("POD_NAME", "")
+	if len(identity) == 0 {
+		if identity, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	if statusWriter != nil {
+		parts := strings.Split(o.StatusLease, "/")
+		elector := leaderelection.NewLeaseElector(kc.CoordinationV1(), parts[0], parts[1], identity, o.StatusLeaseDuration)
+		// keep competing for the lease after losing it, every replica serves
+		// traffic regardless.  Wait a renewal period in between so a lost
+		// lease is not contended in a tight loop.
+		go wait.Until(func() {
+			elector.Run(stopCh, statusWriter.StartWriting, statusWriter.StopWriting)
+		}, o.StatusLeaseDuration/3, stopCh)
+	}
+	if len(o.StandbyLease) > 0 {
+		parts := strings.Split(o.StandbyLease, "/")
+		elector := leaderelection.NewLeaseElector(kc.CoordinationV1(), parts[0], parts[1], identity, o.StandbyLeaseDuration)
+		go elector.Run(stopCh, func() {
+			for _, fn := range promoteFns {
+				fn()
+			}
+		}, func() {
+			// another router may be active, restart as a standby router.
+			log.Error(nil, "standby lease lost, exiting", "lease", o.StandbyLease)
+			os.Exit(1)
+		})
+	}
+
 	proc.StartReaper(6 * time.Second)
 
 	select {
 	case <-stopCh:
-		// 45s is the default interval that almost all cloud load balancers require to take an unhealthy
-		// endpoint out of rotation.
-		delay := getIntervalFromEnv("ROUTER_GRACEFUL_SHUTDOWN_DELAY", 45)
-		log.Info(fmt.Sprintf("Shutdown requested, waiting %s for new connections to cease", delay))
-		time.Sleep(delay)
-		log.Info("Instructing the template router to terminate")
-		if err := templatePlugin.Stop(); err != nil {
+		log.Info("Shutdown requested")
+		// The readiness probe fails as soon as stopCh is closed.
+		coordinator := shutdown.NewCoordinator(prometheus.DefaultRegisterer)
+		coordinator.AddPhase(shutdown.Phase{
+			Name:   "stop-route-updates",
+			Action: templatePlugin.StopRouteUpdates,
+		})
+		coordinator.AddPhase(shutdown.Phase{
+			Name: "deregister",
+			// 45s is the default interval that almost all cloud load balancers require to take an unhealthy
+			// endpoint out of rotation.
+			Delay: getIntervalFromEnv("ROUTER_GRACEFUL_SHUTDOWN_DELAY", 45),
+		})
+		coordinator.AddPhase(shutdown.Phase{
+			Name: "drain",
+			// HAProxy stops accepting connections and waits for in-flight requests to complete.
+			Action: templatePlugin.Stop,
+		})
+		coordinator.AddPhase(shutdown.Phase{
+			Name: "settle",
+			// wait to let any remaining actions settle
+			Delay: getIntervalFromEnv("ROUTER_SHUTDOWN_SETTLE_DELAY", 1),
+		})
+		if err := coordinator.Run(); err != nil {
 			log.Error(err, "Router did not shut down cleanly")
 		} else {
 			log.Info("Shutdown complete, exiting")
 		}
-		// wait one second to let any remaining actions settle
-		time.Sleep(time.Second)
 	}
 	return nil
 }
@@ -833,3 +1681,29 @@ func getStatsAuth(statsUsernameFile, statsPasswordFile, statsUsername, statsPass
 
 	return statsUsername, statsPassword, nil
 }
+
+// podEventRecorder records the capacity events of the router on its pod.
+type podEventRecorder struct {
+	recorder record.EventRecorder
+	pod      *kapi.ObjectReference
+}
+
+// newPodEventRecorder returns a recorder of events on the pod of the router,
+// or nil if the pod is not known.
+func newPodEventRecorder(kc kclientset.Interface) *podEventRecorder {
+	name, namespace := env("POD_NAME", ""), env("POD_NAMESPACE", "")
+	if len(name) == 0 || len(namespace) == 0 {
+		log.V(0).Info("POD_NAME and POD_NAMESPACE are not set, router capacity events are only logged")
+		return nil
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: kc.CoreV1().Events(namespace)})
+	return &podEventRecorder{
+		recorder: broadcaster.NewRecorder(scheme.Scheme, kapi.EventSource{Component: "openshift-router"}),
+		pod:      &kapi.ObjectReference{Kind: "Pod", Namespace: namespace, Name: name},
+	}
+}
+
+func (r *podEventRecorder) RecordCapacityEvent(eventType, reason, message string) {
+	r.recorder.Event(r.pod, eventType, reason, message)
+}
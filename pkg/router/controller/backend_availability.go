@@ -0,0 +1,319 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// RouteBackendsAvailable is the condition reported on routes whose services
+// have no ready endpoints, so that requests to them fail with a 503.  It is
+// false with the number of ready and total endpoints of the services of the
+// route until an endpoint is ready again, when it is set to true.
+const RouteBackendsAvailable routev1.RouteIngressConditionType = "BackendsAvailable"
+
+// RouteEndpointsSkipped is the condition reported on routes whose target
+// port some ready endpoints of their services do not serve, so that the
+// router does not send requests to them.  It is true with the endpoints
+// that are skipped and why until none is, when it is set to false.
+const RouteEndpointsSkipped routev1.RouteIngressConditionType = "EndpointsSkipped"
+
+// maxSkippedEndpoints is the number of skipped endpoints listed in the
+// message of the EndpointsSkipped condition.
+const maxSkippedEndpoints = 5
+
+// endpointCounts are the number of ready and total endpoints of a service.
+type endpointCounts struct {
+	ready int
+	total int
+}
+
+// backendAvailability tracks the endpoints of the services of the admitted
+// routes to report their BackendsAvailable condition.
+type backendAvailability struct {
+	// synced is true once the admitter has committed, so that the routes
+	// are not reported before the endpoints of their services are known.
+	synced bool
+	// endpoints are the endpoint counts of services, keyed by
+	// namespace/name.
+	endpoints map[string]endpointCounts
+	// ports are the ports of the ready endpoints of services, keyed by
+	// namespace/name.
+	ports map[string][]endpointsubset.AddressPort
+	// routes are the admitted routes, keyed by namespace/name.
+	routes map[string]*routev1.Route
+	// serviceRoutes are the keys of the routes of each service.
+	serviceRoutes map[string]sets.String
+	// pending are the keys of the routes to report on the next commit.
+	pending sets.String
+	// unavailable are the keys of the routes reported without available
+	// backends.
+	unavailable sets.String
+	// skipped are the keys of the routes reported with skipped endpoints.
+	skipped sets.String
+}
+
+// EnableBackendAvailability makes the admitter report a BackendsAvailable
+// condition on the admitted routes whose services have no ready endpoints,
+// and an EndpointsSkipped condition on the admitted routes whose target port
+// some ready endpoints do not serve.
+func (a *StatusAdmitter) EnableBackendAvailability() {
+	a.backendsLock.Lock()
+	defer a.backendsLock.Unlock()
+	a.backends = &backendAvailability{
+		endpoints:     make(map[string]endpointCounts),
+		ports:         make(map[string][]endpointsubset.AddressPort),
+		routes:        make(map[string]*routev1.Route),
+		serviceRoutes: make(map[string]sets.String),
+		pending:       sets.NewString(),
+		unavailable:   sets.NewString(),
+		skipped:       sets.NewString(),
+	}
+}
+
+// routeServices returns the keys of the services of a route.
+func routeServices(route *routev1.Route) []string {
+	services := []string{route.Namespace + "/" + route.Spec.To.Name}
+	for _, backend := range route.Spec.AlternateBackends {
+		if backend.Kind == "Service" || len(backend.Kind) == 0 {
+			services = append(services, route.Namespace+"/"+backend.Name)
+		}
+	}
+	return services
+}
+
+// countEndpoints returns the number of ready and total endpoint addresses
+// of endpoints.
+func countEndpoints(endpoints *kapi.Endpoints) endpointCounts {
+	ready, notReady := sets.NewString(), sets.NewString()
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			ready.Insert(address.IP)
+		}
+		for _, address := range subset.NotReadyAddresses {
+			notReady.Insert(address.IP)
+		}
+	}
+	return endpointCounts{ready: ready.Len(), total: ready.Union(notReady).Len()}
+}
+
+// recordRoute tracks the services of an admitted route, or forgets the
+// route if it is no longer admitted.
+func (b *backendAvailability) recordRoute(route *routev1.Route, admitted bool) {
+	key := routeNameKey(route)
+	if old, ok := b.routes[key]; ok {
+		for _, service := range routeServices(old) {
+			if routes, ok := b.serviceRoutes[service]; ok {
+				routes.Delete(key)
+				if routes.Len() == 0 {
+					delete(b.serviceRoutes, service)
+				}
+			}
+		}
+		delete(b.routes, key)
+	}
+	if !admitted {
+		b.pending.Delete(key)
+		b.unavailable.Delete(key)
+		b.skipped.Delete(key)
+		return
+	}
+	b.routes[key] = route
+	for _, service := range routeServices(route) {
+		if _, ok := b.serviceRoutes[service]; !ok {
+			b.serviceRoutes[service] = sets.NewString()
+		}
+		b.serviceRoutes[service].Insert(key)
+	}
+}
+
+// recordEndpoints updates the endpoint counts of a service and marks the
+// routes whose availability changed to be reported.
+func (b *backendAvailability) recordEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) {
+	key := endpoints.Namespace + "/" + endpoints.Name
+	old, oldPorts := b.endpoints[key], b.ports[key]
+	counts := endpointCounts{}
+	var ports []endpointsubset.AddressPort
+	if eventType == watch.Deleted {
+		delete(b.endpoints, key)
+		delete(b.ports, key)
+	} else {
+		counts = countEndpoints(endpoints)
+		b.endpoints[key] = counts
+		ports = endpointsubset.ReadyAddressPorts(endpoints.Subsets)
+		b.ports[key] = ports
+	}
+	if counts == old && reflect.DeepEqual(ports, oldPorts) {
+		return
+	}
+	for routeKey := range b.serviceRoutes[key] {
+		b.pending.Insert(routeKey)
+	}
+}
+
+// reported returns true if the router reported a condition of a route with
+// a status.
+func reported(route *routev1.Route, routerName string, conditionType routev1.RouteIngressConditionType, status corev1.ConditionStatus) bool {
+	for i := range route.Status.Ingress {
+		ingress := &route.Status.Ingress[i]
+		if ingress.RouterName != routerName {
+			continue
+		}
+		if condition := findCondition(ingress, conditionType); condition != nil && condition.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// conditions returns the BackendsAvailable and EndpointsSkipped conditions
+// to report on a route, if any.  The conditions are only reported to clear
+// the ones the router reported before when the backends are fine again, so
+// that the status of routes with healthy backends is left alone.
+func (b *backendAvailability) conditions(route *routev1.Route, routerName string) []routev1.RouteIngressCondition {
+	return append(b.availableConditions(route, routerName), b.skippedConditions(route, routerName)...)
+}
+
+// availableConditions returns the BackendsAvailable condition to report on
+// a route, if any.
+func (b *backendAvailability) availableConditions(route *routev1.Route, routerName string) []routev1.RouteIngressCondition {
+	key := routeNameKey(route)
+	counts := endpointCounts{}
+	for _, service := range routeServices(route) {
+		c := b.endpoints[service]
+		counts.ready += c.ready
+		counts.total += c.total
+	}
+
+	if counts.ready > 0 {
+		wasReported := b.unavailable.Has(key) || reported(route, routerName, RouteBackendsAvailable, corev1.ConditionFalse)
+		b.unavailable.Delete(key)
+		if !wasReported {
+			return nil
+		}
+		return []routev1.RouteIngressCondition{{Type: RouteBackendsAvailable, Status: corev1.ConditionTrue}}
+	}
+
+	b.unavailable.Insert(key)
+	return []routev1.RouteIngressCondition{{
+		Type:    RouteBackendsAvailable,
+		Status:  corev1.ConditionFalse,
+		Reason:  reasons.NoReadyEndpoints,
+		Message: fmt.Sprintf("%d/%d endpoints ready", counts.ready, counts.total),
+	}}
+}
+
+// skippedConditions returns the EndpointsSkipped condition to report on a
+// route, if any.
+func (b *backendAvailability) skippedConditions(route *routev1.Route, routerName string) []routev1.RouteIngressCondition {
+	key := routeNameKey(route)
+	var skipped []string
+	if route.Spec.Port != nil {
+		target := route.Spec.Port.TargetPort.String()
+		for _, service := range routeServices(route) {
+			_, addresses := endpointsubset.SelectTargetPort(b.ports[service], target)
+			for _, address := range addresses {
+				skipped = append(skipped, fmt.Sprintf("%s of service %s (%s)", address.Address, service[strings.Index(service, "/")+1:], address.Reason))
+			}
+		}
+	}
+
+	if len(skipped) == 0 {
+		wasReported := b.skipped.Has(key) || reported(route, routerName, RouteEndpointsSkipped, corev1.ConditionTrue)
+		b.skipped.Delete(key)
+		if !wasReported {
+			return nil
+		}
+		return []routev1.RouteIngressCondition{{Type: RouteEndpointsSkipped, Status: corev1.ConditionFalse}}
+	}
+
+	b.skipped.Insert(key)
+	message := fmt.Sprintf("%d endpoints do not serve target port %s: %s", len(skipped), route.Spec.Port.TargetPort.String(), strings.Join(skipped, ", "))
+	if len(skipped) > maxSkippedEndpoints {
+		message = fmt.Sprintf("%d endpoints do not serve target port %s: %s, ...", len(skipped), route.Spec.Port.TargetPort.String(), strings.Join(skipped[:maxSkippedEndpoints], ", "))
+	}
+	return []routev1.RouteIngressCondition{{
+		Type:    RouteEndpointsSkipped,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasons.TargetPortNotServed,
+		Message: message,
+	}}
+}
+
+// backendConditions records an admitted route and returns the
+// BackendsAvailable condition to report on it, if any.
+func (a *StatusAdmitter) backendConditions(route *routev1.Route) []routev1.RouteIngressCondition {
+	a.backendsLock.Lock()
+	defer a.backendsLock.Unlock()
+	if a.backends == nil {
+		return nil
+	}
+	a.backends.recordRoute(route, true)
+	if !a.backends.synced {
+		a.backends.pending.Insert(routeNameKey(route))
+		return nil
+	}
+	a.backends.pending.Delete(routeNameKey(route))
+	return a.backends.conditions(route, a.routerName)
+}
+
+// forgetBackends stops reporting the BackendsAvailable condition on a route
+// that is no longer admitted.
+func (a *StatusAdmitter) forgetBackends(route *routev1.Route) {
+	a.backendsLock.Lock()
+	defer a.backendsLock.Unlock()
+	if a.backends != nil {
+		a.backends.recordRoute(route, false)
+	}
+}
+
+// recordBackendEndpoints updates the endpoints of the services of the
+// routes.
+func (a *StatusAdmitter) recordBackendEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) {
+	a.backendsLock.Lock()
+	defer a.backendsLock.Unlock()
+	if a.backends != nil {
+		a.backends.recordEndpoints(eventType, endpoints)
+	}
+}
+
+// reportBackends reports the BackendsAvailable condition of the routes
+// whose availability changed since the last commit.
+func (a *StatusAdmitter) reportBackends() {
+	type update struct {
+		route      *routev1.Route
+		conditions []routev1.RouteIngressCondition
+	}
+	var updates []update
+
+	a.backendsLock.Lock()
+	if a.backends == nil {
+		a.backendsLock.Unlock()
+		return
+	}
+	a.backends.synced = true
+	for key := range a.backends.pending {
+		if route, ok := a.backends.routes[key]; ok {
+			if conditions := a.backends.conditions(route, a.routerName); len(conditions) > 0 {
+				updates = append(updates, update{route: route, conditions: conditions})
+			}
+		}
+	}
+	a.backends.pending = sets.NewString()
+	a.backendsLock.Unlock()
+
+	for _, update := range updates {
+		conditions := append(append(a.standbyConditions(), a.annotationConditions(update.route)...), update.conditions...)
+		a.updateCondition("backends", update.route, admittedCondition(update.route), conditions...)
+	}
+}
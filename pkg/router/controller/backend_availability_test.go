@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgotesting "k8s.io/client-go/testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+)
+
+func TestStatusBackendAvailability(t *testing.T) {
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec: routev1.RouteSpec{
+			Host:              "route1.test.local",
+			To:                routev1.RouteTargetReference{Kind: "Service", Name: "svc1"},
+			AlternateBackends: []routev1.RouteTargetReference{{Kind: "Service", Name: "svc2"}},
+		},
+	}
+	endpoints := func(name string, ready, notReady int) *kapi.Endpoints {
+		subset := kapi.EndpointSubset{}
+		for i := 0; i < ready; i++ {
+			subset.Addresses = append(subset.Addresses, kapi.EndpointAddress{IP: "10.0.0." + string(rune('1'+i))})
+		}
+		for i := 0; i < notReady; i++ {
+			subset.NotReadyAddresses = append(subset.NotReadyAddresses, kapi.EndpointAddress{IP: "10.0.1." + string(rune('1'+i))})
+		}
+		return &kapi.Endpoints{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Subsets: []kapi.EndpointSubset{subset}}
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(&recordingPlugin{}, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableBackendAvailability()
+
+	lastBackendsCondition := func(expectedActions int) *routev1.RouteIngressCondition {
+		t.Helper()
+		if len(c.Actions()) != expectedActions {
+			t.Fatalf("expected %d actions, got %#v", expectedActions, c.Actions())
+		}
+		obj := c.Actions()[expectedActions-1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+		lister.items = []*routev1.Route{obj}
+		ingress := &obj.Status.Ingress[0]
+		if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+			t.Fatalf("expected the route to be admitted: %#v", ingress.Conditions)
+		}
+		return findCondition(ingress, RouteBackendsAvailable)
+	}
+
+	// the route is not reported before the endpoints are synced
+	admitter.HandleEndpoints(watch.Added, endpoints("svc1", 0, 2))
+	admitter.HandleRoute(watch.Added, route)
+	if condition := lastBackendsCondition(1); condition != nil {
+		t.Fatalf("expected no backends condition before the first commit: %#v", condition)
+	}
+	admitter.HandleEndpoints(watch.Added, endpoints("svc2", 0, 1))
+	admitter.Commit()
+	condition := lastBackendsCondition(2)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != "NoReadyEndpoints" || condition.Message != "0/3 endpoints ready" {
+		t.Fatalf("expected a false backends condition: %#v", condition)
+	}
+
+	// endpoints that remain not ready are reported with their new count
+	admitter.HandleEndpoints(watch.Modified, endpoints("svc2", 0, 2))
+	admitter.Commit()
+	if condition := lastBackendsCondition(3); condition == nil || condition.Status != corev1.ConditionFalse || condition.Message != "0/4 endpoints ready" {
+		t.Fatalf("expected a false backends condition: %#v", condition)
+	}
+
+	// the condition is cleared once an endpoint is ready
+	admitter.HandleEndpoints(watch.Modified, endpoints("svc1", 1, 1))
+	admitter.Commit()
+	if condition := lastBackendsCondition(4); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected a true backends condition: %#v", condition)
+	}
+
+	// routes with ready endpoints are not updated
+	admitter.HandleEndpoints(watch.Modified, endpoints("svc1", 2, 0))
+	admitter.Commit()
+	lastBackendsCondition(4)
+
+	// nor are routes that are no longer admitted
+	admitter.RecordRouteRejection(route, "Rejected", "")
+	admitter.HandleEndpoints(watch.Deleted, endpoints("svc1", 0, 0))
+	admitter.Commit()
+	if len(c.Actions()) != 5 {
+		t.Fatalf("expected only the rejection to be recorded, got %#v", c.Actions())
+	}
+}
+
+func TestStatusEndpointsSkipped(t *testing.T) {
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec: routev1.RouteSpec{
+			Host: "route1.test.local",
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "svc1"},
+			Port: &routev1.RoutePort{TargetPort: intstr.FromString("http")},
+		},
+	}
+	endpoints := func(ports ...kapi.EndpointPort) *kapi.Endpoints {
+		return &kapi.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "svc1", Namespace: "default"},
+			Subsets: []kapi.EndpointSubset{
+				{Addresses: []kapi.EndpointAddress{{IP: "10.0.0.1"}}, Ports: []kapi.EndpointPort{{Name: "http", Port: 8080}}},
+				{Addresses: []kapi.EndpointAddress{{IP: "10.0.0.2"}}, Ports: ports},
+			},
+		}
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(&recordingPlugin{}, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableBackendAvailability()
+
+	lastSkippedCondition := func(expectedActions int) *routev1.RouteIngressCondition {
+		t.Helper()
+		if len(c.Actions()) != expectedActions {
+			t.Fatalf("expected %d actions, got %#v", expectedActions, c.Actions())
+		}
+		obj := c.Actions()[expectedActions-1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+		lister.items = []*routev1.Route{obj}
+		if condition := findCondition(&obj.Status.Ingress[0], RouteBackendsAvailable); condition != nil {
+			t.Fatalf("expected no backends condition: %#v", condition)
+		}
+		return findCondition(&obj.Status.Ingress[0], RouteEndpointsSkipped)
+	}
+
+	admitter.HandleEndpoints(watch.Added, endpoints(kapi.EndpointPort{Name: "web", Port: 8000}, kapi.EndpointPort{Name: "metrics", Port: 9090}))
+	admitter.HandleRoute(watch.Added, route)
+	admitter.Commit()
+	condition := lastSkippedCondition(2)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != "TargetPortNotServed" || condition.Message != "1 endpoints do not serve target port http: 10.0.0.2 of service svc1 (NamedPortNotExposed)" {
+		t.Fatalf("expected a true skipped condition: %#v", condition)
+	}
+
+	// an endpoint exposing the port number the name resolves to is not
+	// skipped
+	admitter.HandleEndpoints(watch.Modified, endpoints(kapi.EndpointPort{Port: 8080}, kapi.EndpointPort{Port: 9090}))
+	admitter.Commit()
+	if condition := lastSkippedCondition(3); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false skipped condition: %#v", condition)
+	}
+
+	// routes without skipped endpoints are not updated
+	admitter.HandleEndpoints(watch.Modified, endpoints(kapi.EndpointPort{Name: "http", Port: 8080}))
+	admitter.Commit()
+	lastSkippedCondition(3)
+}
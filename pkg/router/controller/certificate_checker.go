@@ -0,0 +1,322 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// The reasons of the certificate warnings of a route.
+const (
+	// CertificateRevoked is the reason a route serves a certificate its
+	// CA revoked.
+	CertificateRevoked = reasons.CertificateRevoked
+	// IssuerDistrusted is the reason a route serves a certificate issued
+	// by a distrusted CA.
+	IssuerDistrusted = reasons.IssuerDistrusted
+	// IssuerDistrustScheduled is the reason a route serves a certificate
+	// issued by a CA that is soon to be distrusted.
+	IssuerDistrustScheduled = reasons.IssuerDistrustScheduled
+)
+
+// maxRevocationResponseBytes is the size of the largest OCSP response or CRL
+// read.
+const maxRevocationResponseBytes = 16 << 20
+
+// CertificateWarning is a problem found with a certificate after its route
+// was admitted.
+type CertificateWarning struct {
+	Reason  string
+	Message string
+}
+
+// DistrustedCA is a CA that browsers distrust, or are going to, from a date.
+type DistrustedCA struct {
+	// SubjectKeyID is the subject key identifier of the CA certificate.
+	SubjectKeyID []byte
+	// Date is when the CA is distrusted.
+	Date time.Time
+	// Name describes the CA.
+	Name string
+}
+
+// ParseDistrustedCAs parses a list of distrusted CAs, one per line as the
+// hexadecimal subject key identifier of the CA certificate, the date it is
+// distrusted from as YYYY-MM-DD, and a name.  Empty lines and lines starting
+// with # are ignored.
+func ParseDistrustedCAs(r io.Reader) ([]DistrustedCA, error) {
+	var cas []DistrustedCA
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a subject key identifier and a date", line)
+		}
+		id, err := hex.DecodeString(strings.ReplaceAll(fields[0], ":", ""))
+		if err != nil || len(id) == 0 {
+			return nil, fmt.Errorf("line %d: invalid subject key identifier %q", line, fields[0])
+		}
+		date, err := time.Parse("2006-01-02", fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, fields[1])
+		}
+		cas = append(cas, DistrustedCA{SubjectKeyID: id, Date: date, Name: strings.Join(fields[2:], " ")})
+	}
+	return cas, scanner.Err()
+}
+
+// LoadDistrustedCAs reads a list of distrusted CAs from a file.
+func LoadDistrustedCAs(path string) ([]DistrustedCA, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	cas, err := ParseDistrustedCAs(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid distrusted CAs file %s: %v", path, err)
+	}
+	return cas, nil
+}
+
+// cachedCRL is a certificate revocation list kept until its next update.
+type cachedCRL struct {
+	list       *pkix.CertificateList
+	nextUpdate time.Time
+}
+
+// CertificateChecker checks the certificates routes serve for revocation,
+// through OCSP or the CRLs of their CAs, and for CAs that are distrusted or
+// soon to be.
+type CertificateChecker struct {
+	client *http.Client
+	// distrusted are the distrusted CAs, and distrustWarning how long
+	// before they are distrusted the certificates they issued are
+	// reported.
+	distrusted      []DistrustedCA
+	distrustWarning time.Duration
+
+	// now allows the checker to be tested.
+	now func() time.Time
+
+	// lock protects crls.
+	lock sync.Mutex
+	// crls are the CRLs fetched, keyed by URL.
+	crls map[string]cachedCRL
+}
+
+// NewCertificateChecker returns a checker whose revocation requests time out
+// after timeout.
+func NewCertificateChecker(distrusted []DistrustedCA, distrustWarning, timeout time.Duration) *CertificateChecker {
+	return &CertificateChecker{
+		client:          &http.Client{Timeout: timeout},
+		distrusted:      distrusted,
+		distrustWarning: distrustWarning,
+		now:             time.Now,
+		crls:            make(map[string]cachedCRL),
+	}
+}
+
+// Check returns the warnings of a certificate chain, leaf first.  The issuer
+// of the leaf must follow it for the revocation of the leaf to be checked.
+// OCSP is preferred, and the CRLs of the leaf are only fetched if its OCSP
+// responders do not answer.  The error is set if the revocation of the leaf
+// could not be checked.
+func (c *CertificateChecker) Check(chain []*x509.Certificate) ([]CertificateWarning, error) {
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	leaf := chain[0]
+	var warnings []CertificateWarning
+
+	var issuer *x509.Certificate
+	if len(chain) > 1 && leaf.CheckSignatureFrom(chain[1]) == nil {
+		issuer = chain[1]
+	}
+	revoked, err := c.revoked(leaf, issuer)
+	if revoked != nil {
+		warnings = append(warnings, *revoked)
+	}
+
+	warnings = append(warnings, c.distrust(chain)...)
+	return warnings, err
+}
+
+// revoked returns the warning of a revoked leaf, if it is.
+func (c *CertificateChecker) revoked(leaf, issuer *x509.Certificate) (*CertificateWarning, error) {
+	if issuer == nil {
+		if len(leaf.OCSPServer) > 0 || len(leaf.CRLDistributionPoints) > 0 {
+			return nil, fmt.Errorf("the issuer of the certificate is not in its chain")
+		}
+		return nil, nil
+	}
+
+	var errs []string
+	for _, server := range leaf.OCSPServer {
+		response, err := c.queryOCSP(server, leaf, issuer)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		switch response.Status {
+		case ocsp.Revoked:
+			return &CertificateWarning{
+				Reason:  CertificateRevoked,
+				Message: fmt.Sprintf("certificate %s was revoked on %s according to %s", leaf.SerialNumber.Text(16), response.RevokedAt.UTC().Format(time.RFC3339), server),
+			}, nil
+		case ocsp.Good:
+			return nil, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s does not know the certificate", server))
+	}
+
+	for _, url := range leaf.CRLDistributionPoints {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		list, err := c.fetchCRL(url, issuer)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, entry := range list.TBSCertList.RevokedCertificates {
+			if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return &CertificateWarning{
+					Reason:  CertificateRevoked,
+					Message: fmt.Sprintf("certificate %s was revoked on %s according to %s", leaf.SerialNumber.Text(16), entry.RevocationTime.UTC().Format(time.RFC3339), url),
+				}, nil
+			}
+		}
+		return nil, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("unable to check the revocation of the certificate: %s", strings.Join(errs, "; "))
+	}
+	return nil, nil
+}
+
+// queryOCSP asks an OCSP responder for the status of a certificate.
+func (c *CertificateChecker) queryOCSP(server string, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	request, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Post(server, "application/ocsp-request", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", server, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	response, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %v", server, err)
+	}
+	return response, nil
+}
+
+// fetchCRL returns the CRL at url signed by issuer, from the cache until its
+// next update.
+func (c *CertificateChecker) fetchCRL(url string, issuer *x509.Certificate) (*pkix.CertificateList, error) {
+	c.lock.Lock()
+	cached, ok := c.crls[url]
+	c.lock.Unlock()
+	if ok && c.now().Before(cached.nextUpdate) {
+		return cached.list, nil
+	}
+
+	resp, err := c.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	list, err := x509.ParseCRL(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRL from %s: %v", url, err)
+	}
+	if err := issuer.CheckCRLSignature(list); err != nil {
+		return nil, fmt.Errorf("CRL from %s is not signed by the issuer of the certificate: %v", url, err)
+	}
+
+	c.lock.Lock()
+	c.crls[url] = cachedCRL{list: list, nextUpdate: list.TBSCertList.NextUpdate}
+	c.lock.Unlock()
+	return list, nil
+}
+
+// distrust returns the warnings of the certificates of a chain issued by
+// distrusted CAs, or CAs distrusted within the warning period.  The CAs are
+// matched by the subject key identifiers of the certificates of the chain,
+// and by the authority key identifier of its last certificate as chains
+// usually do not include their root.
+func (c *CertificateChecker) distrust(chain []*x509.Certificate) []CertificateWarning {
+	if len(c.distrusted) == 0 {
+		return nil
+	}
+	ids := [][]byte{chain[len(chain)-1].AuthorityKeyId}
+	for _, cert := range chain[1:] {
+		ids = append(ids, cert.SubjectKeyId)
+	}
+
+	now := c.now()
+	var warnings []CertificateWarning
+	for _, ca := range c.distrusted {
+		found := false
+		for _, id := range ids {
+			found = found || (len(id) > 0 && bytes.Equal(id, ca.SubjectKeyID))
+		}
+		switch {
+		case !found:
+		case !now.Before(ca.Date):
+			warnings = append(warnings, CertificateWarning{
+				Reason:  IssuerDistrusted,
+				Message: fmt.Sprintf("the certificate is issued by %s, distrusted since %s", distrustedCAName(ca), ca.Date.Format("2006-01-02")),
+			})
+		case ca.Date.Sub(now) <= c.distrustWarning:
+			warnings = append(warnings, CertificateWarning{
+				Reason:  IssuerDistrustScheduled,
+				Message: fmt.Sprintf("the certificate is issued by %s, distrusted from %s", distrustedCAName(ca), ca.Date.Format("2006-01-02")),
+			})
+		}
+	}
+	return warnings
+}
+
+// distrustedCAName returns the name of a distrusted CA, or its subject key
+// identifier if it has none.
+func distrustedCAName(ca DistrustedCA) string {
+	if len(ca.Name) > 0 {
+		return ca.Name
+	}
+	return "the CA with subject key identifier " + hex.EncodeToString(ca.SubjectKeyID)
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testCA is a CA issuing the certificates of the checker tests.
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T, subjectKeyID []byte) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		SubjectKeyId:          subjectKeyID,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{key: key, cert: cert}
+}
+
+// issue returns a leaf certificate with a serial number, OCSP responders and
+// CRLs.
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServers, crls []string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "www.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		OCSPServer:            ocspServers,
+		CRLDistributionPoints: crls,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestParseDistrustedCAs(t *testing.T) {
+	cas, err := ParseDistrustedCAs(strings.NewReader(`
+# distrusted CAs
+01:02:0a 2024-01-02 Example Root CA
+ff03 2025-06-30
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []DistrustedCA{
+		{SubjectKeyID: []byte{1, 2, 10}, Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Name: "Example Root CA"},
+		{SubjectKeyID: []byte{0xff, 3}, Date: time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC), Name: ""},
+	}
+	if !reflect.DeepEqual(cas, expected) {
+		t.Errorf("expected %#v, got %#v", expected, cas)
+	}
+
+	for _, invalid := range []string{"0102", "zz 2024-01-02", "0102 2024-13-01"} {
+		if _, err := ParseDistrustedCAs(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestCertificateCheckerOCSP(t *testing.T) {
+	ca := newTestCA(t, []byte{1})
+	revokedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		template := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		switch request.SerialNumber.Int64() {
+		case 2:
+			template.Status = ocsp.Revoked
+			template.RevokedAt = revokedAt
+		case 3:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		response, err := ocsp.CreateResponse(ca.cert, ca.cert, template, ca.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(response)
+	}))
+	defer server.Close()
+	checker := NewCertificateChecker(nil, 0, 5*time.Second)
+
+	warnings, err := checker.Check([]*x509.Certificate{ca.issue(t, 1, []string{server.URL}, nil), ca.cert})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected a good certificate, got %v, %v", warnings, err)
+	}
+
+	warnings, err = checker.Check([]*x509.Certificate{ca.issue(t, 2, []string{server.URL}, nil), ca.cert})
+	expected := []CertificateWarning{{Reason: CertificateRevoked, Message: "certificate 2 was revoked on 2024-01-02T03:04:05Z according to " + server.URL}}
+	if err != nil || !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %v, got %v, %v", expected, warnings, err)
+	}
+
+	if _, err := checker.Check([]*x509.Certificate{ca.issue(t, 3, []string{server.URL}, nil), ca.cert}); err == nil {
+		t.Errorf("expected an error for an unavailable responder")
+	}
+
+	if _, err := checker.Check([]*x509.Certificate{ca.issue(t, 1, []string{server.URL}, nil)}); err == nil {
+		t.Errorf("expected an error for a chain without the issuer")
+	}
+}
+
+func TestCertificateCheckerCRL(t *testing.T) {
+	ca := newTestCA(t, []byte{1})
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Minute),
+			NextUpdate: time.Now().Add(time.Hour),
+			RevokedCertificates: []pkix.RevokedCertificate{
+				{SerialNumber: big.NewInt(2), RevocationTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+			},
+		}, ca.cert, ca.key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(crl)
+	}))
+	defer server.Close()
+	checker := NewCertificateChecker(nil, 0, 5*time.Second)
+	crls := []string{"ldap://ldap.example.com/crl", server.URL}
+
+	warnings, err := checker.Check([]*x509.Certificate{ca.issue(t, 1, nil, crls), ca.cert})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected a good certificate, got %v, %v", warnings, err)
+	}
+
+	warnings, err = checker.Check([]*x509.Certificate{ca.issue(t, 2, nil, crls), ca.cert})
+	expected := []CertificateWarning{{Reason: CertificateRevoked, Message: "certificate 2 was revoked on 2024-01-02T03:04:05Z according to " + server.URL}}
+	if err != nil || !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %v, got %v, %v", expected, warnings, err)
+	}
+	if requests != 1 {
+		t.Errorf("expected the CRL to be fetched once until its next update, got %d requests", requests)
+	}
+
+	other := newTestCA(t, []byte{2})
+	if _, err := checker.Check([]*x509.Certificate{other.issue(t, 1, nil, []string{server.URL + "/other"}), other.cert}); err == nil {
+		t.Errorf("expected an error for a CRL signed by another CA")
+	}
+}
+
+func TestCertificateCheckerDistrust(t *testing.T) {
+	id, _ := hex.DecodeString("0a0b")
+	ca := newTestCA(t, id)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		date     time.Time
+		expected []CertificateWarning
+	}{
+		{
+			name:     "distrusted",
+			date:     now,
+			expected: []CertificateWarning{{Reason: IssuerDistrusted, Message: "the certificate is issued by Example CA, distrusted since 2024-01-01"}},
+		},
+		{
+			name:     "distrusted within the warning period",
+			date:     now.Add(72 * time.Hour),
+			expected: []CertificateWarning{{Reason: IssuerDistrustScheduled, Message: "the certificate is issued by Example CA, distrusted from 2024-01-04"}},
+		},
+		{
+			name: "distrusted after the warning period",
+			date: now.Add(30 * 24 * time.Hour),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := NewCertificateChecker([]DistrustedCA{{SubjectKeyID: id, Date: tc.date, Name: "Example CA"}}, 7*24*time.Hour, time.Second)
+			checker.now = func() time.Time { return now }
+
+			// the CA is found in the chain, or as the authority of the
+			// last certificate of a chain without it
+			for _, chain := range [][]*x509.Certificate{{ca.issue(t, 1, nil, nil), ca.cert}, {ca.issue(t, 1, nil, nil)}} {
+				warnings, err := checker.Check(chain)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(warnings, tc.expected) {
+					t.Errorf("expected %v, got %v", tc.expected, warnings)
+				}
+			}
+		})
+	}
+}
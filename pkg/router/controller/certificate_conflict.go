@@ -0,0 +1,43 @@
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// RouteCertificateConflict is the condition reported on admitted routes
+// whose certificates are not presented because another route supplies a
+// different certificate for the same server name.  It is true with the
+// route whose certificate is presented until the conflict is resolved, when
+// it is set to false.
+const RouteCertificateConflict routev1.RouteIngressConditionType = "CertificateConflict"
+
+// RecordCertificateConflict reports a CertificateConflict condition on a
+// route whose certificate is not presented.
+func (a *StatusAdmitter) RecordCertificateConflict(namespace, name, message string) {
+	route, err := a.lister.Routes(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	a.updateCondition("certificate conflict", route, admittedCondition(route), routev1.RouteIngressCondition{
+		Type:    RouteCertificateConflict,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasons.CertificateNotPresented,
+		Message: message,
+	})
+}
+
+// ClearCertificateConflict sets the CertificateConflict condition of a
+// route whose certificate is presented again to false.
+func (a *StatusAdmitter) ClearCertificateConflict(namespace, name string) {
+	route, err := a.lister.Routes(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	a.updateCondition("certificate conflict", route, admittedCondition(route), routev1.RouteIngressCondition{
+		Type:   RouteCertificateConflict,
+		Status: corev1.ConditionFalse,
+	})
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// RouteCertificateWarnings is the condition reported on admitted routes
+// whose certificates were revoked or are issued by CAs that are, or are
+// soon to be, distrusted.  It is true with the warnings until the route
+// serves a certificate without any, when it is set to false.
+const RouteCertificateWarnings routev1.RouteIngressConditionType = "CertificateWarnings"
+
+// certificateMonitor tracks the certificates of the admitted routes to check
+// them in the background.
+type certificateMonitor struct {
+	checker *CertificateChecker
+	// routes are the admitted routes with certificates, keyed by
+	// namespace/name.
+	routes map[string]*routev1.Route
+	// warned are the messages of the CertificateWarnings conditions
+	// reported, keyed by namespace/name.
+	warned map[string]string
+
+	metricWarnings    *prometheus.GaugeVec
+	metricCheckErrors prometheus.Counter
+}
+
+// EnableCertificateMonitor makes the admitter check the certificates of the
+// routes it admits every interval until stopCh is closed, and report a
+// CertificateWarnings condition on the routes whose certificates were
+// revoked or whose CAs are distrusted.  Routes admitted before the
+// certificates of their CAs were revoked or distrusted are reported too.
+// The metrics of the checks are registered with registerer.
+func (a *StatusAdmitter) EnableCertificateMonitor(checker *CertificateChecker, interval time.Duration, registerer prometheus.Registerer, stopCh <-chan struct{}) {
+	monitor := &certificateMonitor{
+		checker: checker,
+		routes:  make(map[string]*routev1.Route),
+		warned:  make(map[string]string),
+		metricWarnings: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "certificate_warnings",
+			Help:      "Set to 1 for each warning of the certificate of a route found by the last check.",
+		}, []string{"namespace", "route", "reason"}),
+		metricCheckErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "template_router",
+			Name:      "certificate_check_errors_total",
+			Help:      "Number of route certificates whose revocation could not be checked.",
+		}),
+	}
+	registerer.MustRegister(monitor.metricWarnings, monitor.metricCheckErrors)
+
+	a.certificatesLock.Lock()
+	a.certificates = monitor
+	a.certificatesLock.Unlock()
+	go wait.Until(a.checkCertificates, interval, stopCh)
+}
+
+// routeCertificateChain returns the certificate of a route followed by the
+// certificates of its CA, or nil if the route has no certificate.
+func routeCertificateChain(route *routev1.Route) []*x509.Certificate {
+	tls := route.Spec.TLS
+	if tls == nil || len(tls.Certificate) == 0 || tls.Termination == routev1.TLSTerminationPassthrough {
+		return nil
+	}
+	var chain []*x509.Certificate
+	for _, data := range []string{tls.Certificate, tls.CACertificate} {
+		rest := []byte(data)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				chain = append(chain, cert)
+			}
+		}
+	}
+	return chain
+}
+
+// recordCertificates tracks the certificate of an admitted route, or
+// forgets the route if it is no longer admitted or has no certificate.
+func (a *StatusAdmitter) recordCertificates(route *routev1.Route, admitted bool) {
+	a.certificatesLock.Lock()
+	defer a.certificatesLock.Unlock()
+	if a.certificates == nil {
+		return
+	}
+	key := routeNameKey(route)
+	if !admitted || route.Spec.TLS == nil || len(route.Spec.TLS.Certificate) == 0 || route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		delete(a.certificates.routes, key)
+		delete(a.certificates.warned, key)
+		return
+	}
+	a.certificates.routes[key] = route
+}
+
+// checkCertificates checks the certificates of the admitted routes and
+// reports the CertificateWarnings condition of the routes whose warnings
+// changed.  The condition is left alone if the revocation of a certificate
+// could not be checked, so that an unreachable OCSP responder neither
+// raises nor clears it.
+func (a *StatusAdmitter) checkCertificates() {
+	a.certificatesLock.Lock()
+	monitor := a.certificates
+	routes := make([]*routev1.Route, 0, len(monitor.routes))
+	for _, route := range monitor.routes {
+		routes = append(routes, route)
+	}
+	a.certificatesLock.Unlock()
+
+	monitor.metricWarnings.Reset()
+	for _, route := range routes {
+		chain := routeCertificateChain(route)
+		if len(chain) == 0 {
+			continue
+		}
+		warnings, err := monitor.checker.Check(chain)
+		if err != nil {
+			monitor.metricCheckErrors.Inc()
+			log.V(2).Info("unable to check the certificate of route", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
+		}
+		for _, warning := range warnings {
+			monitor.metricWarnings.WithLabelValues(route.Namespace, route.Name, warning.Reason).Set(1)
+		}
+		if err != nil && len(warnings) == 0 {
+			continue
+		}
+		if condition := a.certificateCondition(route, warnings); condition != nil {
+			conditions := append(append(a.standbyConditions(), a.annotationConditions(route)...), *condition)
+			a.updateCondition("certificates", route, admittedCondition(route), conditions...)
+		}
+	}
+}
+
+// certificateCondition records the warnings of the certificate of a route
+// and returns the CertificateWarnings condition to report on it if they
+// changed.  The condition is only reported as false to clear one the router
+// reported before, so that the status of routes with sound certificates is
+// left alone.  Nothing is returned for a route that changed or was
+// forgotten since its certificate was checked.
+func (a *StatusAdmitter) certificateCondition(route *routev1.Route, warnings []CertificateWarning) *routev1.RouteIngressCondition {
+	a.certificatesLock.Lock()
+	defer a.certificatesLock.Unlock()
+	key := routeNameKey(route)
+	if a.certificates.routes[key] != route {
+		return nil
+	}
+	previous, warned := a.certificates.warned[key]
+
+	if len(warnings) == 0 {
+		delete(a.certificates.warned, key)
+		if !warned && !reported(route, a.routerName, RouteCertificateWarnings, corev1.ConditionTrue) {
+			return nil
+		}
+		return &routev1.RouteIngressCondition{Type: RouteCertificateWarnings, Status: corev1.ConditionFalse}
+	}
+
+	messages := make([]string, 0, len(warnings))
+	for _, warning := range warnings {
+		messages = append(messages, warning.Message)
+	}
+	message := strings.Join(messages, "; ")
+	if warned && message == previous {
+		return nil
+	}
+	a.certificates.warned[key] = message
+	return &routev1.RouteIngressCondition{
+		Type:    RouteCertificateWarnings,
+		Status:  corev1.ConditionTrue,
+		Reason:  warnings[0].Reason,
+		Message: message,
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgotesting "k8s.io/client-go/testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+)
+
+func TestStatusCertificateWarnings(t *testing.T) {
+	ca := newTestCA(t, []byte{1, 2})
+	leaf := ca.issue(t, 1, nil, nil)
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec: routev1.RouteSpec{
+			Host: "route1.test.local",
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "svc1"},
+			TLS: &routev1.TLSConfig{
+				Termination:   routev1.TLSTerminationEdge,
+				Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})),
+				CACertificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})),
+			},
+		},
+	}
+	c := fake.NewSimpleClientset()
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(&recordingPlugin{}, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	checker := NewCertificateChecker([]DistrustedCA{{SubjectKeyID: []byte{1, 2}, Date: now.Add(24 * time.Hour), Name: "Example CA"}}, 48*time.Hour, time.Second)
+	checker.now = func() time.Time { return now }
+	stopCh := make(chan struct{})
+	close(stopCh)
+	admitter.EnableCertificateMonitor(checker, time.Hour, prometheus.NewRegistry(), stopCh)
+
+	lastCertificateCondition := func(expectedActions int) *routev1.RouteIngressCondition {
+		t.Helper()
+		if len(c.Actions()) != expectedActions {
+			t.Fatalf("expected %d actions, got %#v", expectedActions, c.Actions())
+		}
+		obj := c.Actions()[expectedActions-1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+		lister.items = []*routev1.Route{obj}
+		ingress := &obj.Status.Ingress[0]
+		if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+			t.Fatalf("expected the route to be admitted: %#v", ingress.Conditions)
+		}
+		return findCondition(ingress, RouteCertificateWarnings)
+	}
+
+	admitter.HandleRoute(watch.Added, route)
+	if condition := lastCertificateCondition(1); condition != nil {
+		t.Fatalf("expected no certificate condition on admission: %#v", condition)
+	}
+
+	// the distrust of the CA is reported ahead of time
+	admitter.checkCertificates()
+	condition := lastCertificateCondition(2)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != IssuerDistrustScheduled || condition.Message != "the certificate is issued by Example CA, distrusted from 2024-01-02" {
+		t.Fatalf("expected a true certificate condition: %#v", condition)
+	}
+
+	// unchanged warnings are not reported again
+	admitter.checkCertificates()
+	lastCertificateCondition(2)
+
+	// and changed ones are
+	now = now.Add(24 * time.Hour)
+	admitter.checkCertificates()
+	if condition := lastCertificateCondition(3); condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != IssuerDistrusted {
+		t.Fatalf("expected a true certificate condition: %#v", condition)
+	}
+
+	// the condition is cleared once the route serves another certificate
+	other := newTestCA(t, []byte{3})
+	updated := route.DeepCopy()
+	updated.Spec.TLS.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.issue(t, 1, nil, nil).Raw}))
+	updated.Spec.TLS.CACertificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: other.cert.Raw}))
+	admitter.HandleRoute(watch.Modified, updated)
+	lastCertificateCondition(3)
+	admitter.checkCertificates()
+	if condition := lastCertificateCondition(4); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false certificate condition: %#v", condition)
+	}
+
+	// routes that are no longer admitted are not checked
+	admitter.HandleRoute(watch.Modified, route)
+	admitter.RecordRouteRejection(route, "Rejected", "")
+	admitter.checkCertificates()
+	if len(c.Actions()) != 5 {
+		t.Fatalf("expected only the rejection to be recorded, got %#v", c.Actions())
+	}
+}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+	haproxyutil "github.com/openshift/router/pkg/router/template/util/haproxy"
+)
+
+// configSnippetCheckTimeout bounds how long haproxy may take to check a
+// config snippet.
+const configSnippetCheckTimeout = 10 * time.Second
+
+// ConfigSnippetChecker checks the lines of a route's config snippet.
+type ConfigSnippetChecker func(lines []string) error
+
+// ConfigSnippetValidator implements the router.Plugin interface to reject
+// routes whose config snippet uses a directive the router does not allow or
+// that haproxy rejects.
+type ConfigSnippetValidator struct {
+	// plugin is the next plugin in the chain.
+	plugin router.Plugin
+
+	// recorder is an interface for indicating route rejections.
+	recorder RejectionRecorder
+
+	// directives are the directives allowed in route config snippets.
+	// Routes with a snippet are rejected if it is empty.
+	directives sets.String
+
+	// check, if set, checks config snippets with haproxy that the linter
+	// could not fully verify.
+	check ConfigSnippetChecker
+}
+
+// NewConfigSnippetValidator creates a plugin wrapper that ensures only routes
+// whose config snippet uses the allowed directives and passes check are
+// relayed to the next plugin in the chain.  Recorder is an interface for
+// indicating why a route was rejected.
+func NewConfigSnippetValidator(plugin router.Plugin, directives sets.String, check ConfigSnippetChecker, recorder RejectionRecorder) *ConfigSnippetValidator {
+	return &ConfigSnippetValidator{
+		plugin:     plugin,
+		recorder:   recorder,
+		directives: directives,
+		check:      check,
+	}
+}
+
+// HandleNode processes watch events on the Node resource.
+func (p *ConfigSnippetValidator) HandleNode(eventType watch.EventType, node *kapi.Node) error {
+	return p.plugin.HandleNode(eventType, node)
+}
+
+// HandleEndpoints processes watch events on the Endpoints resource.
+func (p *ConfigSnippetValidator) HandleEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) error {
+	return p.plugin.HandleEndpoints(eventType, endpoints)
+}
+
+// HandleRoute processes watch events on the Route resource.
+func (p *ConfigSnippetValidator) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	switch eventType {
+	case watch.Added, watch.Modified:
+		routeName := routeNameKey(route)
+		if err := p.validate(route); err != nil {
+			if router.IsRetriable(err) {
+				// The route keeps its previous configuration until its
+				// snippet can be checked.
+				log.Error(err, "unable to check route config snippet", "route", routeName)
+				return err
+			}
+			log.Error(err, "skipping route due to invalid config snippet", "route", routeName)
+			p.recorder.RecordRouteRejection(route, reasons.InvalidConfigSnippet, err.Error())
+			p.plugin.HandleRoute(watch.Deleted, route)
+			return router.NewRouteError(reasons.InvalidConfigSnippet, err.Error())
+		}
+	}
+
+	return p.plugin.HandleRoute(eventType, route)
+}
+
+// HandleNamespaces limits the scope of valid routes to only those that match
+// the provided namespace list.
+func (p *ConfigSnippetValidator) HandleNamespaces(namespaces sets.String) error {
+	return p.plugin.HandleNamespaces(namespaces)
+}
+
+// Commit invokes the nested plugin to commit.
+func (p *ConfigSnippetValidator) Commit() error {
+	return p.plugin.Commit()
+}
+
+// validate checks the config snippet of a route against the allowed
+// directives and, if the snippet passes, against haproxy.
+func (p *ConfigSnippetValidator) validate(route *routev1.Route) error {
+	if err := routeapihelpers.ValidateConfigSnippet(route, p.directives).ToAggregate(); err != nil {
+		return err
+	}
+	lines := routeapihelpers.ConfigSnippetLines(route)
+	if len(lines) == 0 {
+		return nil
+	}
+	// The linter reports the errors it knows with their line, haproxy
+	// checks the names of fetches, converters, timeouts and options.
+	if err := haproxyutil.LintConfigLines(lines); err != nil {
+		return err
+	}
+	if p.check != nil {
+		return p.check(lines)
+	}
+	return nil
+}
+
+// configSnippetCheckDirPrefix prefixes the names of the temporary
+// directories config snippets are checked in.
+const configSnippetCheckDirPrefix = "config-snippet"
+
+// NewHAProxyConfigSnippetChecker returns a ConfigSnippetChecker that embeds
+// a snippet in a minimal configuration of its own and runs the haproxy
+// binary in check mode on it.  The configuration is written to a private
+// temporary directory in dir, which the router owns, and never shares any
+// state with the running router.  The directories a previous router left
+// behind in dir when it stopped during a check are removed.
+func NewHAProxyConfigSnippetChecker(binary, dir string) ConfigSnippetChecker {
+	removeConfigSnippetCheckDirs(dir)
+	return func(lines []string) error {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return router.NewRetriableRouteError(reasons.ConfigSnippetCheckFailed, "unable to check the config snippet", err)
+		}
+		checkDir, err := ioutil.TempDir(dir, configSnippetCheckDirPrefix)
+		if err != nil {
+			return router.NewRetriableRouteError(reasons.ConfigSnippetCheckFailed, "unable to check the config snippet", err)
+		}
+		defer os.RemoveAll(checkDir)
+
+		path := filepath.Join(checkDir, "haproxy.config")
+		if err := ioutil.WriteFile(path, configSnippetCheckConfig(lines), 0600); err != nil {
+			return router.NewRetriableRouteError(reasons.ConfigSnippetCheckFailed, "unable to check the config snippet", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), configSnippetCheckTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, binary, "-c", "-q", "-f", path)
+		cmd.Dir = checkDir
+		cmd.Env = []string{}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return router.NewRetriableRouteError(reasons.ConfigSnippetCheckFailed, "timed out checking the config snippet with haproxy", ctx.Err())
+			}
+			return fmt.Errorf("haproxy rejected the config snippet: %v\n%s", err, string(out))
+		}
+		return nil
+	}
+}
+
+// configSnippetCheckConfig returns a configuration with a single backend
+// that contains the snippet lines.
+func configSnippetCheckConfig(lines []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("defaults\n  mode http\n  timeout connect 5s\n  timeout client 30s\n  timeout server 30s\n\n")
+	buf.WriteString("backend be_config_snippet_check\n")
+	for _, line := range lines {
+		buf.WriteString("  " + line + "\n")
+	}
+	return buf.Bytes()
+}
+
+// removeConfigSnippetCheckDirs removes the config snippet check directories
+// in dir.
+func removeConfigSnippetCheckDirs(dir string) {
+	dirs, err := filepath.Glob(filepath.Join(dir, configSnippetCheckDirPrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, d := range dirs {
+		log.V(0).Info("removing leftover config snippet check directory", "dir", d)
+		if err := os.RemoveAll(d); err != nil {
+			log.V(0).Info("ignoring error removing config snippet check directory", "dir", d, "error", err)
+		}
+	}
+}
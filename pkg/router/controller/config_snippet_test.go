@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func TestConfigSnippetValidator(t *testing.T) {
+	var checked []string
+	check := func(lines []string) error {
+		checked = append(checked, lines...)
+		if strings.Contains(strings.Join(lines, "\n"), "bogus") {
+			return fmt.Errorf("unknown keyword")
+		}
+		if strings.Contains(strings.Join(lines, "\n"), "set-nice 20") {
+			return router.NewRetriableRouteError(reasons.ConfigSnippetCheckFailed, "timed out checking the config snippet with haproxy", context.DeadlineExceeded)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		snippet    string
+		directives sets.String
+		checked    bool
+		rejection  string
+		retriable  bool
+	}{
+		{
+			name:       "no snippet",
+			directives: sets.NewString("http-request"),
+		},
+		{
+			name:      "snippets not enabled",
+			snippet:   "http-request deny",
+			rejection: "InvalidConfigSnippet",
+		},
+		{
+			name:       "directive not allowed",
+			snippet:    "option forwardfor",
+			directives: sets.NewString("http-request"),
+			rejection:  "InvalidConfigSnippet",
+		},
+		{
+			name:       "snippet passed by the linter is checked by haproxy",
+			snippet:    "http-request deny",
+			directives: sets.NewString("http-request"),
+			checked:    true,
+		},
+		{
+			name:       "snippet rejected by the linter",
+			snippet:    "http-request deny if missing",
+			directives: sets.NewString("http-request"),
+			rejection:  "InvalidConfigSnippet",
+		},
+		{
+			name:       "snippet checked by haproxy",
+			snippet:    "http-request set-nice 10",
+			directives: sets.NewString("http-request"),
+			checked:    true,
+		},
+		{
+			name:       "snippet rejected by haproxy",
+			snippet:    "http-request bogus",
+			directives: sets.NewString("http-request"),
+			checked:    true,
+			rejection:  "InvalidConfigSnippet",
+		},
+		{
+			name:       "snippet check timed out",
+			snippet:    "http-request set-nice 20",
+			directives: sets.NewString("http-request"),
+			checked:    true,
+			retriable:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checked = nil
+			p := &fakePlugin{}
+			recorder := rejectionRecorder{rejections: make(map[string]string)}
+			validator := NewConfigSnippetValidator(p, tc.directives, check, recorder)
+
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r", Annotations: map[string]string{}},
+				Spec: routev1.RouteSpec{
+					Host: "r.example.com",
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: "svc"},
+				},
+			}
+			if len(tc.snippet) > 0 {
+				route.Annotations[routeapihelpers.ConfigSnippetAnnotation] = tc.snippet
+			}
+
+			err := validator.HandleRoute(watch.Added, route)
+			if tc.checked != (len(checked) > 0) {
+				t.Errorf("expected snippet checked %v, got %v", tc.checked, checked)
+			}
+			if rejection := recorder.rejections["ns-r"]; rejection != tc.rejection {
+				t.Fatalf("expected rejection %q, got %q", tc.rejection, rejection)
+			}
+			if tc.retriable {
+				if !router.IsRetriable(err) || len(p.t) > 0 {
+					t.Errorf("expected the route to be kept for a retry, got event %v and error %v", p.t, err)
+				}
+			} else if len(tc.rejection) > 0 {
+				if err == nil || p.t != watch.Deleted {
+					t.Errorf("expected the route to be removed, got event %v and error %v", p.t, err)
+				}
+			} else if err != nil || p.t != watch.Added {
+				t.Errorf("expected the route to be relayed, got event %v and error %v", p.t, err)
+			}
+		})
+	}
+}
+
+func TestConfigSnippetCheckConfig(t *testing.T) {
+	expected := "defaults\n  mode http\n  timeout connect 5s\n  timeout client 30s\n  timeout server 30s\n\n" +
+		"backend be_config_snippet_check\n  http-request deny\n  option forwardfor\n"
+	if config := string(configSnippetCheckConfig([]string{"http-request deny", "option forwardfor"})); config != expected {
+		t.Errorf("expected config %q, got %q", expected, config)
+	}
+}
+
+func TestHAProxyConfigSnippetCheckerDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "config-snippet-check")
+	if err := os.MkdirAll(filepath.Join(dir, "config-snippet123"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	check := NewHAProxyConfigSnippetChecker("true", dir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected the leftover check directories to be removed, got %v", entries)
+	}
+	if err := check([]string{"http-request deny"}); err != nil {
+		t.Errorf("expected the snippet to pass, got %v", err)
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the check directory to be removed, got %v", entries)
+	}
+}
+
+func TestRemoveConfigSnippetCheckDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config-snippet123", "config-snippet456/check", "other"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeConfigSnippetCheckDirs(dir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "other" {
+		t.Errorf("expected only the other directory to be kept, got %v", entries)
+	}
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// NewDeniedDomains returns the set of denied domains, such as the apps
+// domain of another shard or the hostnames of platform services, in the
+// form DeniedDomain matches hosts against.
+func NewDeniedDomains(domains []string) sets.String {
+	denied := sets.NewString()
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(normalizeDomain(domain), "*.")
+		if len(domain) > 0 {
+			denied.Insert(domain)
+		}
+	}
+	return denied
+}
+
+// DeniedDomain returns the denied domain the host of a route is, or is a
+// subdomain of.  A wildcard route is also denied if its wildcard covers a
+// denied domain.
+func DeniedDomain(route *routev1.Route, denied sets.String) (string, bool) {
+	host := normalizeDomain(route.Spec.Host)
+	if len(host) == 0 || denied.Len() == 0 {
+		return "", false
+	}
+	for domain := host; ; {
+		if denied.Has(domain) {
+			return domain, true
+		}
+		idx := strings.IndexRune(domain, '.')
+		if idx < 0 {
+			break
+		}
+		domain = domain[idx+1:]
+	}
+
+	if route.Spec.WildcardPolicy == routev1.WildcardPolicySubdomain {
+		// The wildcard of a route serves the hosts one label below the
+		// domain of its host.
+		idx := strings.IndexRune(host, '.')
+		if idx < 0 {
+			return "", false
+		}
+		wildcardDomain := host[idx+1:]
+		for domain := range denied {
+			if parent := strings.SplitN(domain, ".", 2); len(parent) == 2 && parent[1] == wildcardDomain {
+				return domain, true
+			}
+		}
+	}
+	return "", false
+}
+
+// normalizeDomain returns domain in lower case without a trailing dot.
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+func TestDeniedDomains(t *testing.T) {
+	denied := NewDeniedDomains([]string{"apps.shard-b.example.com", "*.Console.Example.com.", " "})
+	admitter := func(route *routev1.Route) error {
+		if domain, ok := DeniedDomain(route, denied); ok {
+			return router.NewRouteError(reasons.HostForbidden, fmt.Sprintf("host %s is in the denied domain %s", route.Spec.Host, domain))
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		wildcard bool
+		rejected bool
+	}{
+		{
+			name: "unrelated host",
+			host: "www.example.com",
+		},
+		{
+			name:     "denied domain",
+			host:     "apps.shard-b.example.com",
+			rejected: true,
+		},
+		{
+			name:     "subdomain of a denied domain",
+			host:     "app.apps.shard-b.example.com",
+			rejected: true,
+		},
+		{
+			name:     "mixed case and trailing dot",
+			host:     "App.Apps.Shard-B.Example.com.",
+			rejected: true,
+		},
+		{
+			name:     "wildcard domain in the configuration",
+			host:     "www.console.example.com",
+			rejected: true,
+		},
+		{
+			name: "domain sharing a suffix without a dot",
+			host: "myapps.shard-b.example.com",
+		},
+		{
+			name: "parent of a denied domain",
+			host: "shard-b.example.com",
+		},
+		{
+			name:     "wildcard covering a denied domain",
+			host:     "www.example.com",
+			wildcard: true,
+			rejected: true,
+		},
+		{
+			name:     "wildcard not covering a denied domain",
+			host:     "www.other.com",
+			wildcard: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &fakePlugin{}
+			recorder := rejectionRecorder{rejections: make(map[string]string)}
+			plugin := NewHostAdmitter(p, admitter, true, false, recorder)
+
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r"},
+				Spec:       routev1.RouteSpec{Host: tc.host},
+			}
+			if tc.wildcard {
+				route.Spec.WildcardPolicy = routev1.WildcardPolicySubdomain
+			}
+
+			err := plugin.HandleRoute(watch.Added, route)
+			if tc.rejected {
+				if router.ErrorReason(err) != reasons.HostForbidden || recorder.rejections["ns-r"] != reasons.HostForbidden || p.t != watch.Deleted {
+					t.Errorf("expected the route to be rejected, got error %v, rejection %q and event %v", err, recorder.rejections["ns-r"], p.t)
+				}
+				return
+			}
+			if err != nil || len(recorder.rejections) > 0 || p.t != watch.Added {
+				t.Errorf("expected the route to be admitted, got error %v, rejections %v and event %v", err, recorder.rejections, p.t)
+			}
+		})
+	}
+}
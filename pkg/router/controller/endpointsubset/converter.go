@@ -19,15 +19,15 @@ func ConvertEndpointSlice(items []discoveryv1.EndpointSlice, addressOrderByFuncs
 				epa := corev1.EndpointAddress{
 					IP:        items[i].Endpoints[j].Addresses[k],
 					TargetRef: items[i].Endpoints[j].TargetRef,
+					NodeName:  items[i].Endpoints[j].NodeName,
 				}
 				if items[i].Endpoints[j].Hostname != nil {
 					epa.Hostname = *items[i].Endpoints[j].Hostname
 				}
-				// A nil Ready condition indicates an unknown state and should be interpreted as ready.
-				if items[i].Endpoints[j].Conditions.Ready != nil && !*items[i].Endpoints[j].Conditions.Ready {
-					notReadyAddresses = append(notReadyAddresses, epa)
-				} else {
+				if isReady(&items[i].Endpoints[j]) {
 					addresses = append(addresses, epa)
+				} else {
+					notReadyAddresses = append(notReadyAddresses, epa)
 				}
 			}
 		}
@@ -0,0 +1,44 @@
+package endpointsubset
+
+import (
+	"sort"
+	"strings"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// ZonesAnnotation is set on the Endpoints converted from EndpointSlices to
+// the zones of their addresses, which EndpointAddress has no field for, as
+// comma separated <address>=<zone> pairs.
+const ZonesAnnotation = "router.openshift.io/endpoint-zones"
+
+// Zones returns the ZonesAnnotation value for the addresses of items, or an
+// empty string if none of their endpoints has a zone.
+func Zones(items []discoveryv1.EndpointSlice) string {
+	var pairs []string
+	for i := range items {
+		for j := range items[i].Endpoints {
+			zone := items[i].Endpoints[j].Zone
+			if zone == nil || len(*zone) == 0 {
+				continue
+			}
+			for _, address := range items[i].Endpoints[j].Addresses {
+				pairs = append(pairs, address+"="+*zone)
+			}
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// ParseZones returns the zones of the addresses listed by a ZonesAnnotation
+// value.
+func ParseZones(value string) map[string]string {
+	zones := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if address, zone, ok := strings.Cut(pair, "="); ok {
+			zones[address] = zone
+		}
+	}
+	return zones
+}
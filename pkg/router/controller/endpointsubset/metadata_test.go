@@ -0,0 +1,39 @@
+package endpointsubset
+
+import (
+	"reflect"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestZones(t *testing.T) {
+	zone := func(name string) *string { return &name }
+	items := []discoveryv1.EndpointSlice{
+		{
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.2"}, Zone: zone("zone-b")},
+				{Addresses: []string{"10.0.0.1"}, Zone: zone("zone-a")},
+				{Addresses: []string{"10.0.0.3"}},
+			},
+		},
+		{
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.1.1"}, Zone: zone("")},
+				{Addresses: []string{"10.0.1.2"}, Zone: zone("zone-a")},
+			},
+		},
+	}
+
+	value := Zones(items)
+	if expected := "10.0.0.1=zone-a,10.0.0.2=zone-b,10.0.1.2=zone-a"; value != expected {
+		t.Fatalf("expected %q, got %q", expected, value)
+	}
+	expected := map[string]string{"10.0.0.1": "zone-a", "10.0.0.2": "zone-b", "10.0.1.2": "zone-a"}
+	if zones := ParseZones(value); !reflect.DeepEqual(zones, expected) {
+		t.Errorf("expected %v, got %v", expected, zones)
+	}
+	if zones := ParseZones(Zones(items[:0])); len(zones) != 0 {
+		t.Errorf("expected no zones, got %v", zones)
+	}
+}
@@ -0,0 +1,126 @@
+package endpointsubset
+
+import (
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The reasons an endpoint address is skipped for a target port.
+const (
+	// PortNotExposed is the reason an address that does not expose a
+	// numeric target port is skipped.
+	PortNotExposed = "PortNotExposed"
+	// NamedPortNotExposed is the reason an address is skipped that
+	// exposes neither a named target port nor the port number the name
+	// resolves to on the other addresses.
+	NamedPortNotExposed = "NamedPortNotExposed"
+	// NamedPortAmbiguous is the reason an address is skipped that does
+	// not expose a named target port, when the name resolves to several
+	// port numbers on the other addresses or the address exposes several
+	// ports the name may refer to.
+	NamedPortAmbiguous = "NamedPortAmbiguous"
+)
+
+// AddressPort is a port an endpoint address exposes.
+type AddressPort struct {
+	Address string
+	Name    string
+	// Port is the port number.
+	Port string
+}
+
+// SkippedAddress is an endpoint address none of whose ports serve a target
+// port.
+type SkippedAddress struct {
+	Address string
+	Reason  string
+}
+
+// ReadyAddressPorts returns the ports of the ready addresses of subsets,
+// other than their UDP ports.
+func ReadyAddressPorts(subsets []corev1.EndpointSubset) []AddressPort {
+	var ports []AddressPort
+	for _, s := range subsets {
+		for _, p := range s.Ports {
+			if p.Protocol == corev1.ProtocolUDP {
+				continue
+			}
+			for _, a := range s.Addresses {
+				ports = append(ports, AddressPort{Address: a.IP, Name: p.Name, Port: strconv.Itoa(int(p.Port))})
+			}
+		}
+	}
+	return ports
+}
+
+// SelectTargetPort returns the indexes of the ports that serve target, a
+// port name or number, and the addresses none of whose ports do.  The ports
+// of an address whose name or number is target serve it.  An address that
+// does not expose a named target port falls back to the port number the
+// name resolves to on the other addresses, as the subsets of an
+// EndpointSlice that lists its ports without names would, and if no address
+// exposes the name, to the only port of the address.
+func SelectTargetPort(ports []AddressPort, target string) ([]int, []SkippedAddress) {
+	var addresses []string
+	byAddress := map[string][]int{}
+	for i, p := range ports {
+		if _, ok := byAddress[p.Address]; !ok {
+			addresses = append(addresses, p.Address)
+		}
+		byAddress[p.Address] = append(byAddress[p.Address], i)
+	}
+
+	_, err := strconv.Atoi(target)
+	named := err != nil
+	matches := func(p AddressPort) bool {
+		return p.Name == target || p.Port == target
+	}
+
+	// The port numbers the name of the target port resolves to.
+	resolved := map[string]bool{}
+	if named {
+		for _, p := range ports {
+			if p.Name == target {
+				resolved[p.Port] = true
+			}
+		}
+	}
+
+	var selected []int
+	var skipped []SkippedAddress
+	for _, address := range addresses {
+		indexes := byAddress[address]
+		var matched []int
+		for _, i := range indexes {
+			if matches(ports[i]) {
+				matched = append(matched, i)
+			}
+		}
+		switch {
+		case len(matched) > 0:
+		case !named:
+			skipped = append(skipped, SkippedAddress{Address: address, Reason: PortNotExposed})
+		case len(resolved) > 1:
+			skipped = append(skipped, SkippedAddress{Address: address, Reason: NamedPortAmbiguous})
+		case len(resolved) == 1:
+			for _, i := range indexes {
+				if resolved[ports[i].Port] {
+					matched = append(matched, i)
+				}
+			}
+			if len(matched) == 0 {
+				skipped = append(skipped, SkippedAddress{Address: address, Reason: NamedPortNotExposed})
+			}
+		case len(indexes) == 1:
+			matched = indexes
+		default:
+			skipped = append(skipped, SkippedAddress{Address: address, Reason: NamedPortAmbiguous})
+		}
+		selected = append(selected, matched...)
+	}
+	// The ports are selected in their order.
+	sort.Ints(selected)
+	return selected, skipped
+}
@@ -0,0 +1,125 @@
+package endpointsubset_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func TestSelectTargetPort(t *testing.T) {
+	port := func(name string, number int32) discoveryv1.EndpointPort {
+		return discoveryv1.EndpointPort{Name: &name, Port: &number}
+	}
+	udp := func(name string, number int32) discoveryv1.EndpointPort {
+		p := port(name, number)
+		protocol := v1.ProtocolUDP
+		p.Protocol = &protocol
+		return p
+	}
+	slice := func(address string, ports ...discoveryv1.EndpointPort) discoveryv1.EndpointSlice {
+		return discoveryv1.EndpointSlice{
+			Endpoints: []discoveryv1.Endpoint{{Addresses: []string{address}, Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(true)}}},
+			Ports:     ports,
+		}
+	}
+
+	tests := []struct {
+		name             string
+		slices           []discoveryv1.EndpointSlice
+		target           string
+		expectedSelected []endpointsubset.AddressPort
+		expectedSkipped  []endpointsubset.SkippedAddress
+	}{
+		{
+			name:             "named port",
+			slices:           []discoveryv1.EndpointSlice{slice("10.0.0.1", port("http", 8080), port("metrics", 9090))},
+			target:           "http",
+			expectedSelected: []endpointsubset.AddressPort{{Address: "10.0.0.1", Name: "http", Port: "8080"}},
+		},
+		{
+			name:             "numeric port",
+			slices:           []discoveryv1.EndpointSlice{slice("10.0.0.1", port("http", 8080), port("metrics", 9090))},
+			target:           "9090",
+			expectedSelected: []endpointsubset.AddressPort{{Address: "10.0.0.1", Name: "metrics", Port: "9090"}},
+		},
+		{
+			name: "numeric port missing from a slice",
+			slices: []discoveryv1.EndpointSlice{
+				slice("10.0.0.1", port("http", 8080)),
+				slice("10.0.0.2", port("http", 8081)),
+			},
+			target:           "8080",
+			expectedSelected: []endpointsubset.AddressPort{{Address: "10.0.0.1", Name: "http", Port: "8080"}},
+			expectedSkipped:  []endpointsubset.SkippedAddress{{Address: "10.0.0.2", Reason: endpointsubset.PortNotExposed}},
+		},
+		{
+			name: "named port resolved to its number on a slice without names",
+			slices: []discoveryv1.EndpointSlice{
+				slice("10.0.0.1", port("http", 8080), port("metrics", 9090)),
+				slice("10.0.0.2", port("", 8080), port("", 9090)),
+			},
+			target: "http",
+			expectedSelected: []endpointsubset.AddressPort{
+				{Address: "10.0.0.1", Name: "http", Port: "8080"},
+				{Address: "10.0.0.2", Name: "", Port: "8080"},
+			},
+		},
+		{
+			name: "named port not resolved on a slice without its number",
+			slices: []discoveryv1.EndpointSlice{
+				slice("10.0.0.1", port("http", 8080)),
+				slice("10.0.0.2", port("web", 8000), port("metrics", 9090)),
+			},
+			target:           "http",
+			expectedSelected: []endpointsubset.AddressPort{{Address: "10.0.0.1", Name: "http", Port: "8080"}},
+			expectedSkipped:  []endpointsubset.SkippedAddress{{Address: "10.0.0.2", Reason: endpointsubset.NamedPortNotExposed}},
+		},
+		{
+			name: "named port resolved to several numbers",
+			slices: []discoveryv1.EndpointSlice{
+				slice("10.0.0.1", port("http", 8080)),
+				slice("10.0.0.2", port("http", 8081)),
+				slice("10.0.0.3", port("", 8080)),
+			},
+			target: "http",
+			expectedSelected: []endpointsubset.AddressPort{
+				{Address: "10.0.0.1", Name: "http", Port: "8080"},
+				{Address: "10.0.0.2", Name: "http", Port: "8081"},
+			},
+			expectedSkipped: []endpointsubset.SkippedAddress{{Address: "10.0.0.3", Reason: endpointsubset.NamedPortAmbiguous}},
+		},
+		{
+			name: "single port inferred",
+			slices: []discoveryv1.EndpointSlice{
+				slice("10.0.0.1", port("web", 8080), udp("dns", 53)),
+				slice("10.0.0.2", port("web", 8080), port("metrics", 9090)),
+			},
+			target:           "http",
+			expectedSelected: []endpointsubset.AddressPort{{Address: "10.0.0.1", Name: "web", Port: "8080"}},
+			expectedSkipped:  []endpointsubset.SkippedAddress{{Address: "10.0.0.2", Reason: endpointsubset.NamedPortAmbiguous}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			subsets := endpointsubset.ConvertEndpointSlice(tc.slices, endpointsubset.DefaultEndpointAddressOrderByFuncs(), endpointsubset.DefaultEndpointPortOrderByFuncs())
+			ports := endpointsubset.ReadyAddressPorts(subsets)
+			selected, skipped := endpointsubset.SelectTargetPort(ports, tc.target)
+			var selectedPorts []endpointsubset.AddressPort
+			for _, i := range selected {
+				selectedPorts = append(selectedPorts, ports[i])
+			}
+			if diff := cmp.Diff(tc.expectedSelected, selectedPorts); diff != "" {
+				t.Errorf("unexpected selected ports (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.expectedSkipped, skipped); diff != "" {
+				t.Errorf("unexpected skipped addresses (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
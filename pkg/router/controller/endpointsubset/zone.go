@@ -0,0 +1,79 @@
+package endpointsubset
+
+import (
+	"sort"
+	"strings"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// OtherZonesAnnotation is set on the Endpoints converted from EndpointSlices
+// to the ready addresses that do not serve the zone of the router, when
+// some ready addresses do, as comma separated addresses.
+const OtherZonesAnnotation = "router.openshift.io/endpoint-other-zones"
+
+// OtherZoneAddresses returns the OtherZonesAnnotation value for the
+// addresses of items: the ready endpoints that should not serve traffic
+// from zone. An endpoint serves a zone if its topology hints name the zone,
+// or if it has no hints and is located in the zone. It returns an empty
+// string when no ready endpoint serves the zone, so that traffic goes to
+// all the ready endpoints.
+func OtherZoneAddresses(items []discoveryv1.EndpointSlice, zone string) string {
+	if len(zone) == 0 || !hasReadyEndpointForZone(items, zone) {
+		return ""
+	}
+
+	var addresses []string
+	for i := range items {
+		for j := range items[i].Endpoints {
+			if isReady(&items[i].Endpoints[j]) && !servesZone(&items[i].Endpoints[j], zone) {
+				addresses = append(addresses, items[i].Endpoints[j].Addresses...)
+			}
+		}
+	}
+	sort.Strings(addresses)
+	return strings.Join(addresses, ",")
+}
+
+// ParseOtherZoneAddresses returns the addresses listed by an
+// OtherZonesAnnotation value.
+func ParseOtherZoneAddresses(value string) map[string]bool {
+	addresses := map[string]bool{}
+	for _, address := range strings.Split(value, ",") {
+		if len(address) > 0 {
+			addresses[address] = true
+		}
+	}
+	return addresses
+}
+
+// hasReadyEndpointForZone returns true if any ready endpoint serves zone.
+func hasReadyEndpointForZone(items []discoveryv1.EndpointSlice, zone string) bool {
+	for i := range items {
+		for j := range items[i].Endpoints {
+			if isReady(&items[i].Endpoints[j]) && servesZone(&items[i].Endpoints[j], zone) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// servesZone returns true if the endpoint should serve traffic from zone.
+func servesZone(endpoint *discoveryv1.Endpoint, zone string) bool {
+	if endpoint.Hints != nil && len(endpoint.Hints.ForZones) > 0 {
+		for _, z := range endpoint.Hints.ForZones {
+			if z.Name == zone {
+				return true
+			}
+		}
+		return false
+	}
+	return endpoint.Zone != nil && *endpoint.Zone == zone
+}
+
+// isReady returns true if the endpoint is ready. A nil Ready condition
+// indicates an unknown state and is interpreted as ready.
+func isReady(endpoint *discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
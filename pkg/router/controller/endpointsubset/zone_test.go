@@ -0,0 +1,81 @@
+package endpointsubset_test
+
+import (
+	"testing"
+
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+// stringPtr returns a pointer to a string
+func stringPtr(s string) *string {
+	return &s
+}
+
+func zonedEndpoint(ip, zone string, ready bool, hints ...string) discoveryv1.Endpoint {
+	ep := discoveryv1.Endpoint{
+		Addresses:  []string{ip},
+		Conditions: discoveryv1.EndpointConditions{Ready: boolPtr(ready)},
+		Zone:       stringPtr(zone),
+	}
+	if len(hints) > 0 {
+		ep.Hints = &discoveryv1.EndpointHints{}
+		for _, hint := range hints {
+			ep.Hints.ForZones = append(ep.Hints.ForZones, discoveryv1.ForZone{Name: hint})
+		}
+	}
+	return ep
+}
+
+func TestOtherZoneAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		zone      string
+		endpoints []discoveryv1.Endpoint
+		want      string
+	}{{
+		name: "no zone serves from all endpoints",
+		zone: "",
+		endpoints: []discoveryv1.Endpoint{
+			zonedEndpoint("10.0.0.1", "a", true),
+			zonedEndpoint("10.0.0.2", "b", true),
+		},
+		want: "",
+	}, {
+		name: "other zone endpoints are listed",
+		zone: "a",
+		endpoints: []discoveryv1.Endpoint{
+			zonedEndpoint("10.0.0.1", "a", true),
+			zonedEndpoint("10.0.0.2", "b", true),
+			zonedEndpoint("10.0.0.3", "b", false),
+		},
+		want: "10.0.0.2",
+	}, {
+		name: "hints take precedence over zones",
+		zone: "a",
+		endpoints: []discoveryv1.Endpoint{
+			zonedEndpoint("10.0.0.1", "a", true, "b"),
+			zonedEndpoint("10.0.0.2", "b", true, "a"),
+		},
+		want: "10.0.0.1",
+	}, {
+		name: "fall back to all endpoints without ready local endpoints",
+		zone: "a",
+		endpoints: []discoveryv1.Endpoint{
+			zonedEndpoint("10.0.0.1", "a", false),
+			zonedEndpoint("10.0.0.2", "b", true),
+			zonedEndpoint("10.0.0.3", "c", true),
+		},
+		want: "",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			items := []discoveryv1.EndpointSlice{{Endpoints: tc.endpoints}}
+			if got := endpointsubset.OtherZoneAddresses(items, tc.zone); got != tc.want {
+				t.Errorf("expected the other zone addresses %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router"
+)
+
+// The kinds of the resources whose events are recorded.
+const (
+	EventKindRoute     = "Route"
+	EventKindEndpoints = "Endpoints"
+	EventKindNamespace = "Namespace"
+	EventKindNode      = "Node"
+)
+
+// The decisions recorded for the events the plugin chain handled.
+const (
+	// EventDecisionHandled is the decision of an event the plugin chain
+	// handled without an error.
+	EventDecisionHandled = "Handled"
+	// EventDecisionRejected is the decision of an event the plugin chain
+	// rejected for good.
+	EventDecisionRejected = "Rejected"
+	// EventDecisionRetrying is the decision of an event the plugin chain
+	// failed to handle with a retriable error.
+	EventDecisionRetrying = "Retrying"
+	// EventDecisionFailed is the decision of an event the plugin chain
+	// failed to handle with an error that is not a route error.
+	EventDecisionFailed = "Failed"
+)
+
+// RecordedEvent is a watch event of the router controller and the decision
+// of the plugin chain.  Only the identity of the object and a few fields
+// that do not hold secrets are recorded.
+type RecordedEvent struct {
+	Time            time.Time       `json:"time"`
+	Kind            string          `json:"kind"`
+	Type            watch.EventType `json:"type"`
+	Namespace       string          `json:"namespace,omitempty"`
+	Name            string          `json:"name"`
+	UID             string          `json:"uid,omitempty"`
+	ResourceVersion string          `json:"resourceVersion,omitempty"`
+	// Host and Path are those of a route.
+	Host string `json:"host,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Addresses is the number of ready addresses of endpoints.
+	Addresses *int `json:"addresses,omitempty"`
+	// Decision is what the plugin chain did with the event.
+	Decision string `json:"decision"`
+	// Reason and Message are those of the error of the plugin chain, if
+	// any.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// EventHistory records the most recent watch events of the router
+// controller for each kind of resource, and what the plugin chain decided
+// for them, to diagnose routes that went away and came back without raising
+// the log level.
+type EventHistory struct {
+	lock sync.Mutex
+
+	size   int
+	seq    uint64
+	events map[string]*eventRing
+}
+
+// sequencedEvent is a recorded event and its rank in the order the events
+// were recorded, as the events of different kinds may share a timestamp.
+type sequencedEvent struct {
+	seq uint64
+	RecordedEvent
+}
+
+// eventRing is a ring buffer of the most recent events of a kind.
+type eventRing struct {
+	events []sequencedEvent
+	// next is the index the next event is written to.
+	next int
+}
+
+// NewEventHistory returns a history that records the last size events of
+// each kind of resource.  A nil history records nothing.
+func NewEventHistory(size int) *EventHistory {
+	return &EventHistory{size: size, events: map[string]*eventRing{}}
+}
+
+// RecordRoute records a route event and the error the plugin chain returned
+// for it.
+func (h *EventHistory) RecordRoute(eventType watch.EventType, route *routev1.Route, err error) {
+	h.record(RecordedEvent{
+		Kind:            EventKindRoute,
+		Type:            eventType,
+		Namespace:       route.Namespace,
+		Name:            route.Name,
+		UID:             string(route.UID),
+		ResourceVersion: route.ResourceVersion,
+		Host:            route.Spec.Host,
+		Path:            route.Spec.Path,
+	}, err)
+}
+
+// RecordEndpoints records an endpoints event and the error the plugin chain
+// returned for it.
+func (h *EventHistory) RecordEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints, err error) {
+	addresses := 0
+	for _, subset := range endpoints.Subsets {
+		addresses += len(subset.Addresses)
+	}
+	h.record(RecordedEvent{
+		Kind:            EventKindEndpoints,
+		Type:            eventType,
+		Namespace:       endpoints.Namespace,
+		Name:            endpoints.Name,
+		UID:             string(endpoints.UID),
+		ResourceVersion: endpoints.ResourceVersion,
+		Addresses:       &addresses,
+	}, err)
+}
+
+// RecordNamespace records a namespace event.
+func (h *EventHistory) RecordNamespace(eventType watch.EventType, ns *kapi.Namespace) {
+	h.record(RecordedEvent{
+		Kind:            EventKindNamespace,
+		Type:            eventType,
+		Name:            ns.Name,
+		UID:             string(ns.UID),
+		ResourceVersion: ns.ResourceVersion,
+	}, nil)
+}
+
+// RecordNode records a node event and the error the plugin chain returned
+// for it.
+func (h *EventHistory) RecordNode(eventType watch.EventType, node *kapi.Node, err error) {
+	h.record(RecordedEvent{
+		Kind:            EventKindNode,
+		Type:            eventType,
+		Name:            node.Name,
+		UID:             string(node.UID),
+		ResourceVersion: node.ResourceVersion,
+	}, err)
+}
+
+func (h *EventHistory) record(event RecordedEvent, err error) {
+	if h == nil {
+		return
+	}
+	event.Time = time.Now()
+	switch {
+	case err == nil:
+		event.Decision = EventDecisionHandled
+	case router.IsRetriable(err):
+		event.Decision = EventDecisionRetrying
+	case len(router.ErrorReason(err)) > 0:
+		event.Decision = EventDecisionRejected
+	default:
+		event.Decision = EventDecisionFailed
+	}
+	if err != nil {
+		event.Reason = router.ErrorReason(err)
+		event.Message = err.Error()
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.size <= 0 {
+		return
+	}
+	ring, ok := h.events[event.Kind]
+	if !ok {
+		ring = &eventRing{events: make([]sequencedEvent, 0, h.size)}
+		h.events[event.Kind] = ring
+	}
+	h.seq++
+	if len(ring.events) < h.size {
+		ring.events = append(ring.events, sequencedEvent{h.seq, event})
+	} else {
+		ring.events[ring.next] = sequencedEvent{h.seq, event}
+	}
+	ring.next = (ring.next + 1) % h.size
+}
+
+// Events returns the recorded events of a kind, or of all kinds if kind is
+// empty, oldest first.  A namespace and a name limit the events to those of
+// the objects in the namespace and with the name.
+func (h *EventHistory) Events(kind, namespace, name string) []RecordedEvent {
+	if h == nil {
+		return []RecordedEvent{}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var sequenced []sequencedEvent
+	for k, ring := range h.events {
+		if len(kind) > 0 && k != kind {
+			continue
+		}
+		// The oldest event is the next one overwritten once the ring
+		// is full.
+		start := 0
+		if len(ring.events) == h.size {
+			start = ring.next
+		}
+		for i := range ring.events {
+			event := ring.events[(start+i)%len(ring.events)]
+			if len(namespace) > 0 && event.Namespace != namespace {
+				continue
+			}
+			if len(name) > 0 && event.Name != name {
+				continue
+			}
+			sequenced = append(sequenced, event)
+		}
+	}
+	sort.Slice(sequenced, func(i, j int) bool { return sequenced[i].seq < sequenced[j].seq })
+	events := make([]RecordedEvent, 0, len(sequenced))
+	for _, event := range sequenced {
+		events = append(events, event.RecordedEvent)
+	}
+	return events
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router"
+)
+
+func TestEventHistory(t *testing.T) {
+	route := func(name, version string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, ResourceVersion: version},
+			Spec: routev1.RouteSpec{
+				Host: name + ".example.com",
+				TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, Key: "secret"},
+			},
+		}
+	}
+
+	history := NewEventHistory(3)
+	history.RecordRoute(watch.Added, route("a", "1"), nil)
+	history.RecordRoute(watch.Modified, route("a", "2"), router.NewRouteError("InvalidHost", "host is invalid"))
+	history.RecordRoute(watch.Modified, route("b", "3"), router.NewRetriableRouteError("ConfigSnippetCheckFailed", "unable to check the snippet", errors.New("timed out")))
+	history.RecordRoute(watch.Deleted, route("a", "4"), errors.New("boom"))
+	history.RecordEndpoints(watch.Modified, &kapi.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc"},
+		Subsets:    []kapi.EndpointSubset{{Addresses: []kapi.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}}},
+	}, nil)
+	history.RecordNamespace(watch.Added, &kapi.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}})
+
+	type summary struct {
+		kind, name, version, decision, reason string
+	}
+	summarize := func(events []RecordedEvent) []summary {
+		result := []summary{}
+		for _, event := range events {
+			result = append(result, summary{event.Kind, event.Name, event.ResourceVersion, event.Decision, event.Reason})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name            string
+		kind, ns, oname string
+		expected        []summary
+	}{
+		{
+			name: "oldest route event dropped",
+			kind: EventKindRoute,
+			expected: []summary{
+				{EventKindRoute, "a", "2", EventDecisionRejected, "InvalidHost"},
+				{EventKindRoute, "b", "3", EventDecisionRetrying, "ConfigSnippetCheckFailed"},
+				{EventKindRoute, "a", "4", EventDecisionFailed, ""},
+			},
+		},
+		{
+			name:  "one route",
+			kind:  EventKindRoute,
+			ns:    "ns",
+			oname: "a",
+			expected: []summary{
+				{EventKindRoute, "a", "2", EventDecisionRejected, "InvalidHost"},
+				{EventKindRoute, "a", "4", EventDecisionFailed, ""},
+			},
+		},
+		{
+			name: "all kinds",
+			expected: []summary{
+				{EventKindRoute, "a", "2", EventDecisionRejected, "InvalidHost"},
+				{EventKindRoute, "b", "3", EventDecisionRetrying, "ConfigSnippetCheckFailed"},
+				{EventKindRoute, "a", "4", EventDecisionFailed, ""},
+				{EventKindEndpoints, "svc", "", EventDecisionHandled, ""},
+				{EventKindNamespace, "ns", "", EventDecisionHandled, ""},
+			},
+		},
+		{
+			name:     "other namespace",
+			ns:       "other",
+			expected: []summary{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := summarize(history.Events(tc.kind, tc.ns, tc.oname)); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	endpoints := history.Events(EventKindEndpoints, "", "")
+	if len(endpoints) != 1 || endpoints[0].Addresses == nil || *endpoints[0].Addresses != 2 {
+		t.Errorf("expected the endpoints event to record 2 addresses, got %v", endpoints)
+	}
+
+	var disabled *EventHistory
+	disabled.RecordRoute(watch.Added, route("a", "1"), nil)
+	if events := disabled.Events("", "", ""); len(events) != 0 {
+		t.Errorf("expected a nil history to record nothing, got %v", events)
+	}
+}
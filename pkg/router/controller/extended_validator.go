@@ -1,8 +1,6 @@
 package controller
 
 import (
-	"fmt"
-
 	kapi "k8s.io/api/core/v1"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -10,6 +8,7 @@ import (
 
 	routev1 "github.com/openshift/api/route/v1"
 	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
 	"github.com/openshift/router/pkg/router/routeapihelpers"
 )
 
@@ -21,6 +20,24 @@ type ExtendedValidator struct {
 
 	// recorder is an interface for indicating route rejections.
 	recorder RejectionRecorder
+
+	// timeouts are the router wide timeouts that route timeouts are
+	// checked against.
+	timeouts routeapihelpers.RouterTimeouts
+	// timeoutPolicy is what happens to routes whose timeouts contradict
+	// each other.  Only the Reject policy rejects them, the router clamps
+	// them otherwise.
+	timeoutPolicy string
+
+	// httpCompatOptions are the HTTP/1 compatibility options routes may
+	// set.
+	httpCompatOptions sets.String
+
+	// allowIDNHosts allows routes with internationalized host names.
+	allowIDNHosts bool
+
+	// alpnProtocols are the ALPN protocols routes may advertise.
+	alpnProtocols sets.String
 }
 
 // NewExtendedValidator creates a plugin wrapper that ensures only routes that
@@ -28,11 +45,44 @@ type ExtendedValidator struct {
 // Recorder is an interface for indicating why a route was rejected.
 func NewExtendedValidator(plugin router.Plugin, recorder RejectionRecorder) *ExtendedValidator {
 	return &ExtendedValidator{
-		plugin:   plugin,
-		recorder: recorder,
+		plugin:            plugin,
+		recorder:          recorder,
+		timeoutPolicy:     routeapihelpers.RouteTimeoutPolicyClamp,
+		httpCompatOptions: sets.NewString(routeapihelpers.DefaultHTTPCompatOptions...),
+		allowIDNHosts:     true,
+		alpnProtocols:     routeapihelpers.AllowedALPNProtocols(false),
 	}
 }
 
+// SetRouterTimeouts sets the router wide timeouts that route timeout
+// annotations are checked against.
+func (p *ExtendedValidator) SetRouterTimeouts(timeouts routeapihelpers.RouterTimeouts) {
+	p.timeouts = timeouts
+}
+
+// SetRouteTimeoutPolicy sets what happens to routes whose timeouts
+// contradict each other: they are rejected with the Reject policy, and left
+// to the router to clamp with the Clamp policy.
+func (p *ExtendedValidator) SetRouteTimeoutPolicy(policy string) {
+	p.timeoutPolicy = policy
+}
+
+// SetHTTPCompatOptions sets the HTTP/1 compatibility options routes may set.
+func (p *ExtendedValidator) SetHTTPCompatOptions(options sets.String) {
+	p.httpCompatOptions = options
+}
+
+// SetALPNProtocols sets the ALPN protocols routes may advertise.
+func (p *ExtendedValidator) SetALPNProtocols(protocols sets.String) {
+	p.alpnProtocols = protocols
+}
+
+// SetAllowIDNHosts sets whether routes may have internationalized host
+// names.
+func (p *ExtendedValidator) SetAllowIDNHosts(allow bool) {
+	p.allowIDNHosts = allow
+}
+
 // HandleNode processes watch events on the node resource
 func (p *ExtendedValidator) HandleNode(eventType watch.EventType, node *kapi.Node) error {
 	return p.plugin.HandleNode(eventType, node)
@@ -49,15 +99,172 @@ func (p *ExtendedValidator) HandleRoute(eventType watch.EventType, route *routev
 	routeName := routeNameKey(route)
 	if err := routeapihelpers.ExtendedValidateRoute(route).ToAggregate(); err != nil {
 		log.Error(err, "skipping route due to invalid configuration", "route", routeName)
+		return p.reject(route, reasons.ExtendedValidationFailed, err)
+	}
+
+	if err := routeapihelpers.ValidateRouteHostIDN(route, p.allowIDNHosts).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid host", "route", routeName)
+		return p.reject(route, reasons.InvalidHost, err)
+	}
+
+	if p.timeoutPolicy == routeapihelpers.RouteTimeoutPolicyReject {
+		if err := routeapihelpers.ValidateRouteTimeouts(route, p.timeouts).ToAggregate(); err != nil {
+			log.Error(err, "skipping route due to invalid timeouts", "route", routeName)
+			return p.reject(route, reasons.InvalidTimeout, err)
+		}
+	}
+
+	if err := routeapihelpers.ValidateRouteHostRewrite(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid host rewrite", "route", routeName)
+		return p.reject(route, reasons.InvalidHostRewrite, err)
+	}
+
+	if err := routeapihelpers.ValidateBackendTLSOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid backend TLS options", "route", routeName)
+		return p.reject(route, reasons.InvalidBackendTLSOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateBackendTCPOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid backend TCP options", "route", routeName)
+		return p.reject(route, reasons.InvalidTCPOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateConnectionPoolOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid connection pool options", "route", routeName)
+		return p.reject(route, reasons.InvalidConnectionPoolOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateQueueOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid queue options", "route", routeName)
+		return p.reject(route, reasons.InvalidQueueOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateBandwidthLimits(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid bandwidth limits", "route", routeName)
+		return p.reject(route, reasons.InvalidBandwidthLimits, err)
+	}
+
+	if err := routeapihelpers.ValidateResponseCache(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid response cache", "route", routeName)
+		return p.reject(route, reasons.InvalidResponseCache, err)
+	}
+
+	if err := routeapihelpers.ValidateConsistentHash(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid consistent hash", "route", routeName)
+		return p.reject(route, reasons.InvalidConsistentHash, err)
+	}
+
+	if err := routeapihelpers.ValidateAccessLog(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid access log mode", "route", routeName)
+		return p.reject(route, reasons.InvalidAccessLog, err)
+	}
 
-		p.recorder.RecordRouteRejection(route, "ExtendedValidationFailed", err.Error())
-		p.plugin.HandleRoute(watch.Deleted, route)
-		return fmt.Errorf("invalid route configuration")
+	if err := routeapihelpers.ValidateResponseHeaderPolicy(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid response header policy", "route", routeName)
+		return p.reject(route, reasons.InvalidResponseHeaderPolicy, err)
+	}
+
+	if err := routeapihelpers.ValidateDenyRules(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid deny rules", "route", routeName)
+		return p.reject(route, reasons.InvalidDenyRules, err)
+	}
+
+	if err := routeapihelpers.ValidateRedirectRules(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid redirect rules", "route", routeName)
+		return p.reject(route, reasons.InvalidRedirectRules, err)
+	}
+
+	if err := routeapihelpers.ValidateRedirectHost(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid redirect host", "route", routeName)
+		return p.reject(route, reasons.InvalidRedirectHost, err)
+	}
+
+	if err := routeapihelpers.ValidateExternalServerOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid external server options", "route", routeName)
+		return p.reject(route, reasons.InvalidExternalServerOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateIPWhitelist(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid IP whitelist", "route", routeName)
+		return p.reject(route, reasons.InvalidIPWhitelist, err)
+	}
+
+	if err := routeapihelpers.ValidateGRPC(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid gRPC option", "route", routeName)
+		return p.reject(route, reasons.InvalidGRPC, err)
+	}
+
+	if err := routeapihelpers.ValidateBackupService(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid backup service", "route", routeName)
+		return p.reject(route, reasons.InvalidBackupService, err)
+	}
+
+	if err := routeapihelpers.ValidateBlueGreen(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid blue/green services", "route", routeName)
+		return p.reject(route, reasons.InvalidBlueGreen, err)
+	}
+
+	if err := routeapihelpers.ValidateCookieOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid cookie attributes", "route", routeName)
+		return p.reject(route, reasons.InvalidCookieAttributes, err)
+	}
+
+	if err := routeapihelpers.ValidateLeastRequestWeighting(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid least-request weighting option", "route", routeName)
+		return p.reject(route, reasons.InvalidLeastRequestWeighting, err)
+	}
+
+	if err := routeapihelpers.ValidateWAF(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid web application firewall option", "route", routeName)
+		return p.reject(route, reasons.InvalidWAF, err)
+	}
+
+	if err := routeapihelpers.ValidateTracingOptions(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid tracing options", "route", routeName)
+		return p.reject(route, reasons.InvalidTracingOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateURINormalizers(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid URI normalizers", "route", routeName)
+		return p.reject(route, reasons.InvalidURINormalizers, err)
+	}
+
+	if err := routeapihelpers.ValidateHealthCheckMaxInterval(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid maximum health check interval", "route", routeName)
+		return p.reject(route, reasons.InvalidHealthCheckMaxInterval, err)
+	}
+
+	if err := routeapihelpers.ValidateActivationWindows(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid activation windows", "route", routeName)
+		return p.reject(route, reasons.InvalidActivationWindows, err)
+	}
+
+	if err := routeapihelpers.ValidateHTTPCompatOptions(route, p.httpCompatOptions).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid HTTP compatibility options", "route", routeName)
+		return p.reject(route, reasons.InvalidHTTPCompatOptions, err)
+	}
+
+	if err := routeapihelpers.ValidateSetForwardedHeaders(route).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid set-forwarded-headers policy", "route", routeName)
+		return p.reject(route, reasons.InvalidSetForwardedHeaders, err)
+	}
+
+	if err := routeapihelpers.ValidateALPNProtocols(route, p.alpnProtocols).ToAggregate(); err != nil {
+		log.Error(err, "skipping route due to invalid ALPN protocols", "route", routeName)
+		return p.reject(route, reasons.InvalidALPNProtocols, err)
 	}
 
 	return p.plugin.HandleRoute(eventType, route)
 }
 
+// reject records the rejection of a route for reason, removes the route from
+// the next plugins and returns the error of the rejection.
+func (p *ExtendedValidator) reject(route *routev1.Route, reason string, err error) error {
+	p.recorder.RecordRouteRejection(route, reason, err.Error())
+	p.plugin.HandleRoute(watch.Deleted, route)
+	return router.NewRouteError(reason, err.Error())
+}
+
 // HandleNamespaces limits the scope of valid routes to only those that match
 // the provided namespace list.
 func (p *ExtendedValidator) HandleNamespaces(namespaces sets.String) error {
@@ -0,0 +1,170 @@
+package factory
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	kapi "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+)
+
+const (
+	// EndpointsSourceEndpoints serves the services from their Endpoints.
+	EndpointsSourceEndpoints = "endpoints"
+	// EndpointsSourceEndpointSlices serves the services from their
+	// EndpointSlices.
+	EndpointsSourceEndpointSlices = "endpointslices"
+)
+
+// endpointsComparator compares the Endpoints and the EndpointSlices of the
+// services while both are watched, and reports the services whose two views
+// diverge.
+type endpointsComparator struct {
+	lock sync.Mutex
+	// divergent are the differences between the two views of the
+	// divergent services, keyed by namespace/name.
+	divergent map[string]string
+
+	metricDivergentServices prometheus.Gauge
+	metricDivergences       prometheus.Counter
+}
+
+// newEndpointsComparator returns a comparator whose metrics are registered
+// with registerer, if any.
+func newEndpointsComparator(registerer prometheus.Registerer) *endpointsComparator {
+	c := &endpointsComparator{
+		divergent: make(map[string]string),
+		metricDivergentServices: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "endpoints_divergent_services",
+			Help:      "Number of services whose Endpoints and EndpointSlices list different endpoints.",
+		}),
+		metricDivergences: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "template_router",
+			Name:      "endpoints_divergences_total",
+			Help:      "Number of times the Endpoints and EndpointSlices of a service started to list different endpoints.",
+		}),
+	}
+	if registerer != nil {
+		registerer.MustRegister(c.metricDivergentServices, c.metricDivergences)
+	}
+	return c
+}
+
+// compare records whether the endpoints of the service namespace/name,
+// listed by its Endpoints, which are nil if it has none, and by its
+// EndpointSlices, diverge, and logs the services whose views start or stop
+// diverging.
+func (c *endpointsComparator) compare(namespace, name string, endpoints *kapi.Endpoints, slices []discoveryv1.EndpointSlice) {
+	var fromEndpoints []kapi.EndpointSubset
+	if endpoints != nil {
+		fromEndpoints = endpoints.Subsets
+	}
+	fromSlices := endpointsubset.ConvertEndpointSlice(slices, endpointsubset.DefaultEndpointAddressOrderByFuncs(), endpointsubset.DefaultEndpointPortOrderByFuncs())
+	diff := endpointsDifference(endpointSet(fromEndpoints), endpointSet(fromSlices))
+
+	key := path.Join(namespace, name)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	previous, wasDivergent := c.divergent[key]
+	switch {
+	case len(diff) == 0 && wasDivergent:
+		delete(c.divergent, key)
+		log.V(2).Info("the Endpoints and EndpointSlices of the service agree again", "namespace", namespace, "name", name)
+	case len(diff) == 0:
+		return
+	case !wasDivergent:
+		c.divergent[key] = diff
+		c.metricDivergences.Inc()
+		log.V(0).Info("the Endpoints and EndpointSlices of the service diverge", "namespace", namespace, "name", name, "difference", diff)
+	case previous != diff:
+		c.divergent[key] = diff
+		log.V(2).Info("the Endpoints and EndpointSlices of the service still diverge", "namespace", namespace, "name", name, "difference", diff)
+	}
+	c.metricDivergentServices.Set(float64(len(c.divergent)))
+}
+
+// endpointSet returns the endpoints of subsets as "ip:port/protocol"
+// strings, with the name of the port if it has one and a " (not ready)"
+// suffix for the addresses that are not ready.
+func endpointSet(subsets []kapi.EndpointSubset) sets.String {
+	set := sets.NewString()
+	for _, subset := range subsets {
+		for _, port := range subset.Ports {
+			protocol := port.Protocol
+			if len(protocol) == 0 {
+				protocol = kapi.ProtocolTCP
+			}
+			prefix := ""
+			if len(port.Name) > 0 {
+				prefix = port.Name + " "
+			}
+			for _, address := range subset.Addresses {
+				set.Insert(fmt.Sprintf("%s%s:%d/%s", prefix, address.IP, port.Port, protocol))
+			}
+			for _, address := range subset.NotReadyAddresses {
+				set.Insert(fmt.Sprintf("%s%s:%d/%s (not ready)", prefix, address.IP, port.Port, protocol))
+			}
+		}
+	}
+	return set
+}
+
+// endpointsDifference describes the endpoints listed by only one of the
+// Endpoints and the EndpointSlices of a service, or returns an empty string
+// if both list the same endpoints.
+func endpointsDifference(fromEndpoints, fromSlices sets.String) string {
+	var parts []string
+	if only := fromEndpoints.Difference(fromSlices); only.Len() > 0 {
+		parts = append(parts, "only in Endpoints: "+strings.Join(only.List(), ", "))
+	}
+	if only := fromSlices.Difference(fromEndpoints); only.Len() > 0 {
+		parts = append(parts, "only in EndpointSlices: "+strings.Join(only.List(), ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// watchesEndpoints returns true if the factory watches Endpoints.
+func (f *RouterControllerFactory) watchesEndpoints() bool {
+	return f.watchEndpoints || len(f.EndpointsPrecedence) > 0
+}
+
+// watchesEndpointSlices returns true if the factory watches EndpointSlices.
+func (f *RouterControllerFactory) watchesEndpointSlices() bool {
+	return !f.watchEndpoints || len(f.EndpointsPrecedence) > 0
+}
+
+// servesFromEndpointSlices returns true if the services of namespace are
+// served from their EndpointSlices rather than their Endpoints.
+func (f *RouterControllerFactory) servesFromEndpointSlices(namespace string) bool {
+	switch {
+	case len(f.EndpointsPrecedence) == 0:
+		return !f.watchEndpoints
+	case f.EndpointSliceNamespaces.Has(namespace):
+		return true
+	default:
+		return f.EndpointsPrecedence == EndpointsSourceEndpointSlices
+	}
+}
+
+// compareEndpoints compares the Endpoints and the EndpointSlices of the
+// service namespace/name if both are watched.
+func (f *RouterControllerFactory) compareEndpoints(namespace, name string) {
+	if f.comparator == nil {
+		return
+	}
+	var endpoints *kapi.Endpoints
+	obj, exists, _ := f.informers[reflect.TypeOf(&kapi.Endpoints{})].GetStore().GetByKey(path.Join(namespace, name))
+	if exists {
+		endpoints = obj.(*kapi.Endpoints)
+	}
+	f.comparator.compare(namespace, name, endpoints, f.aggregateEndpointSlice(namespace, name))
+}
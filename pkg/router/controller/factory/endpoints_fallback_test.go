@@ -0,0 +1,115 @@
+package factory_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	fakeproject "github.com/openshift/client-go/project/clientset/versioned/typed/project/v1/fake"
+	fakerouterclient "github.com/openshift/client-go/route/clientset/versioned/fake"
+	kapi "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fakekubeclient "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/openshift/router/pkg/router/controller/factory"
+)
+
+func TestEndpointsPrecedence(t *testing.T) {
+	endpoints := func(namespace, ip string) *kapi.Endpoints {
+		return &kapi.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: namespace},
+			Subsets: []kapi.EndpointSubset{{
+				Addresses: []kapi.EndpointAddress{{IP: ip}},
+				Ports:     []kapi.EndpointPort{{Port: 8080, Protocol: kapi.ProtocolTCP}},
+			}},
+		}
+	}
+	slice := func(namespace, ip string) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "service-1",
+				Namespace: namespace,
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "service"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints:   []discoveryv1.Endpoint{{Addresses: []string{ip}}},
+			Ports:       []discoveryv1.EndpointPort{{Port: int32Ptr(8080)}},
+		}
+	}
+
+	plugin := &endpointSlicesTestPlugin{
+		handleEndpointsCh: make(chan handleEndpointsEvent, 10),
+	}
+	client := fakekubeclient.NewSimpleClientset(
+		// the services of the legacy namespace agree
+		endpoints("legacy", "10.0.0.1"), slice("legacy", "10.0.0.1"),
+		// the services of the migrated namespace diverge
+		endpoints("migrated", "10.0.1.1"), slice("migrated", "10.0.1.2"),
+	)
+	registry := prometheus.NewRegistry()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	f := factory.NewDefaultRouterControllerFactory(fakerouterclient.NewSimpleClientset(), &fakeproject.FakeProjects{}, client, false)
+	f.EndpointsPrecedence = factory.EndpointsSourceEndpoints
+	f.EndpointSliceNamespaces = sets.NewString("migrated")
+	f.Registerer = registry
+	f.Create(plugin, false, stopCh)
+
+	expectDivergent := func(count int) {
+		t.Helper()
+		expected := fmt.Sprintf(`# HELP template_router_endpoints_divergent_services Number of services whose Endpoints and EndpointSlices list different endpoints.
+# TYPE template_router_endpoints_divergent_services gauge
+template_router_endpoints_divergent_services %d
+`, count)
+		var err error
+		if pollErr := wait.PollImmediate(10*time.Millisecond, endpointSliceTestTimeout, func() (bool, error) {
+			err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "template_router_endpoints_divergent_services")
+			return err == nil, nil
+		}); pollErr != nil {
+			t.Fatalf("expected %d divergent services: %v", count, err)
+		}
+	}
+	expectDivergent(1)
+
+	// the Endpoints of a service that is served from its EndpointSlices
+	// catch up
+	if _, err := client.CoreV1().Endpoints("migrated").Update(context.TODO(), endpoints("migrated", "10.0.1.2"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectDivergent(0)
+
+	// the EndpointSlices of a service that is served from its Endpoints
+	// diverge
+	if _, err := client.DiscoveryV1().EndpointSlices("legacy").Update(context.TODO(), slice("legacy", "10.0.0.2"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expectDivergent(1)
+	expected := `# HELP template_router_endpoints_divergences_total Number of times the Endpoints and EndpointSlices of a service started to list different endpoints.
+# TYPE template_router_endpoints_divergences_total counter
+template_router_endpoints_divergences_total 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "template_router_endpoints_divergences_total"); err != nil {
+		t.Error(err)
+	}
+
+	// each namespace is served from its source only
+	served := map[string]sets.String{}
+	for len(plugin.handleEndpointsCh) > 0 {
+		event := <-plugin.handleEndpointsCh
+		if served[event.endpoints.Namespace] == nil {
+			served[event.endpoints.Namespace] = sets.NewString()
+		}
+		served[event.endpoints.Namespace].Insert(event.endpoints.Subsets[0].Addresses[0].IP)
+	}
+	if !served["legacy"].Equal(sets.NewString("10.0.0.1")) || !served["migrated"].Equal(sets.NewString("10.0.1.2")) {
+		t.Errorf("expected the legacy namespace to be served from its Endpoints and the migrated namespace from its EndpointSlices, got %v", served)
+	}
+}
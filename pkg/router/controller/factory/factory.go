@@ -18,6 +18,9 @@ import (
 	"k8s.io/apimachinery/pkg/watch"
 	kclientset "k8s.io/client-go/kubernetes"
 	kcache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/prometheus/client_golang/prometheus"
 
 	routev1 "github.com/openshift/api/route/v1"
 	projectclient "github.com/openshift/client-go/project/clientset/versioned/typed/project/v1"
@@ -53,9 +56,32 @@ type RouterControllerFactory struct {
 	NamespaceLabels labels.Selector
 	ProjectLabels   labels.Selector
 	RouteModifierFn func(route *routev1.Route)
+	// Zone, if set, is the zone the router runs in, for the plugin to
+	// prefer the endpoints that serve it. Only supported when watching
+	// EndpointSlices.
+	Zone string
+	// SubdomainHosts, if set, generates the host of the routes with a
+	// subdomain again when the domain of the router changes.
+	SubdomainHosts *routercontroller.SubdomainHosts
+	// EventHistorySize, if positive, is the number of recent events of
+	// each kind of resource the controller records for debugging.
+	EventHistorySize int
+	// EndpointsPrecedence, if set, watches both the Endpoints and the
+	// EndpointSlices of the services and serves them from the source it
+	// names, EndpointsSourceEndpoints or EndpointsSourceEndpointSlices,
+	// reporting the services whose two views diverge.
+	EndpointsPrecedence string
+	// EndpointSliceNamespaces are the namespaces whose services are served
+	// from their EndpointSlices when the Endpoints take precedence, so that
+	// namespaces can be migrated one at a time.
+	EndpointSliceNamespaces sets.String
+	// Registerer, if set, registers the metrics of the divergence between
+	// the Endpoints and the EndpointSlices of the services.
+	Registerer prometheus.Registerer
 
 	informers      map[reflect.Type]kcache.SharedIndexInformer
 	watchEndpoints bool
+	comparator     *endpointsComparator
 }
 
 // NewDefaultRouterControllerFactory initializes a default router controller factory.
@@ -88,6 +114,17 @@ func (f *RouterControllerFactory) Create(plugin router.Plugin, watchNodes bool,
 		ProjectLabels:       f.ProjectLabels,
 		ProjectWaitInterval: 10 * time.Second,
 		ProjectRetries:      5,
+
+		Zone:           f.Zone,
+		SubdomainHosts: f.SubdomainHosts,
+
+		RouteRetries: workqueue.NewItemExponentialFailureRateLimiter(time.Second, 5*time.Minute),
+	}
+	if f.EventHistorySize > 0 {
+		rc.Events = routercontroller.NewEventHistory(f.EventHistorySize)
+	}
+	if len(f.EndpointsPrecedence) > 0 {
+		f.comparator = newEndpointsComparator(f.Registerer)
 	}
 
 	// Check projects a bit more often than we resync events, so that we aren't always waiting
@@ -108,9 +145,10 @@ func (f *RouterControllerFactory) initInformers(rc *routercontroller.RouterContr
 	if f.NamespaceLabels != nil {
 		f.createNamespacesSharedInformer()
 	}
-	if f.watchEndpoints {
+	if f.watchesEndpoints() {
 		f.createEndpointsSharedInformer()
-	} else {
+	}
+	if f.watchesEndpointSlices() {
 		f.createEndpointSliceSharedInformer()
 	}
 	f.CreateRoutesSharedInformer()
@@ -136,17 +174,27 @@ func (f *RouterControllerFactory) registerInformerEventHandlers(rc *routercontro
 	if f.NamespaceLabels != nil {
 		f.registerSharedInformerEventHandlers(&kapi.Namespace{}, rc.HandleNamespace)
 	}
-	if f.watchEndpoints {
-		f.registerSharedInformerEventHandlers(&kapi.Endpoints{}, rc.HandleEndpoints)
-	} else {
+	if f.watchesEndpoints() {
+		f.registerSharedInformerEventHandlers(&kapi.Endpoints{}, func(eventType watch.EventType, obj interface{}) {
+			ep := obj.(*kapi.Endpoints)
+			if !f.servesFromEndpointSlices(ep.Namespace) {
+				rc.HandleEndpoints(eventType, obj)
+			}
+			f.compareEndpoints(ep.Namespace, ep.Name)
+		})
+	}
+	if f.watchesEndpointSlices() {
 		f.registerSharedInformerEventHandlers(&discoveryv1.EndpointSlice{}, func(eventType watch.EventType, obj interface{}) {
 			eps := obj.(*discoveryv1.EndpointSlice)
 			if serviceName := endpointSliceServiceName(eps); len(serviceName) == 0 {
 				log.V(4).Info("EndpointSlice has no service name", "namespace", eps.Namespace, "name", eps.Name, "label", discoveryv1.LabelServiceName)
 			} else {
-				objMeta := eps.ObjectMeta.DeepCopy()
-				objMeta.Name = serviceName
-				rc.HandleEndpointSlice(eventType, *objMeta, f.aggregateEndpointSlice(eps.Namespace, serviceName))
+				if f.servesFromEndpointSlices(eps.Namespace) {
+					objMeta := eps.ObjectMeta.DeepCopy()
+					objMeta.Name = serviceName
+					rc.HandleEndpointSlice(eventType, *objMeta, f.aggregateEndpointSlice(eps.Namespace, serviceName))
+				}
+				f.compareEndpoints(eps.Namespace, serviceName)
 			}
 		})
 	}
@@ -209,11 +257,16 @@ func (f *RouterControllerFactory) processExistingItems(rc *routercontroller.Rout
 		}
 	}
 
-	if f.watchEndpoints {
+	if f.watchesEndpoints() {
 		for _, item := range f.informerStoreList(&kapi.Endpoints{}) {
-			rc.HandleEndpoints(watch.Added, item.(*kapi.Endpoints))
+			ep := item.(*kapi.Endpoints)
+			if !f.servesFromEndpointSlices(ep.Namespace) {
+				rc.HandleEndpoints(watch.Added, ep)
+			}
+			f.compareEndpoints(ep.Namespace, ep.Name)
 		}
-	} else {
+	}
+	if f.watchesEndpointSlices() {
 		processedServices := map[string]bool{}
 
 		for _, item := range f.informerStoreList(&discoveryv1.EndpointSlice{}) {
@@ -225,16 +278,21 @@ func (f *RouterControllerFactory) processExistingItems(rc *routercontroller.Rout
 			}
 
 			serviceKey := path.Join(eps.Namespace, serviceName)
-			if !processedServices[serviceKey] {
+			if !processedServices[serviceKey] && f.servesFromEndpointSlices(eps.Namespace) {
 				log.V(4).Info("processing existing items", "namespace", eps.Namespace, "serviceName", serviceName)
 				objMeta := eps.ObjectMeta.DeepCopy()
 				objMeta.Name = serviceName
 				rc.HandleEndpointSlice(watch.Added, *objMeta, f.aggregateEndpointSlice(eps.Namespace, serviceName))
+			}
+			if !processedServices[serviceKey] {
+				f.compareEndpoints(eps.Namespace, serviceName)
 				processedServices[serviceKey] = true
 			}
 		}
 	}
 
+	rc.MarkEndpointsSynced()
+
 	items := []routev1.Route{}
 	for _, item := range f.informerStoreList(&routev1.Route{}) {
 		items = append(items, *(item.(*routev1.Route)))
@@ -244,6 +302,7 @@ func (f *RouterControllerFactory) processExistingItems(rc *routercontroller.Rout
 	for i := range items {
 		rc.HandleRoute(watch.Added, &items[i])
 	}
+	rc.MarkRoutesSynced()
 
 	if rc.WatchNodes {
 		for _, item := range f.informerStoreList(&kapi.Node{}) {
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// ComplianceViolationReason is the reason of the rejection of routes whose
+// certificates do not comply with the FIPS policy.
+const ComplianceViolationReason = reasons.ComplianceViolation
+
+// minFIPSRSAKeyBits is the smallest RSA key size FIPS approves.
+const minFIPSRSAKeyBits = 2048
+
+// fipsSignatureAlgorithms are the certificate signature algorithms FIPS
+// approves.
+var fipsSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.SHA256WithRSA:    true,
+	x509.SHA384WithRSA:    true,
+	x509.SHA512WithRSA:    true,
+	x509.SHA256WithRSAPSS: true,
+	x509.SHA384WithRSAPSS: true,
+	x509.SHA512WithRSAPSS: true,
+	x509.ECDSAWithSHA256:  true,
+	x509.ECDSAWithSHA384:  true,
+	x509.ECDSAWithSHA512:  true,
+}
+
+// fipsCurves are the elliptic curves of ECDSA keys FIPS approves.
+var fipsCurves = map[elliptic.Curve]bool{
+	elliptic.P256(): true,
+	elliptic.P384(): true,
+	elliptic.P521(): true,
+}
+
+// FIPSCompliance implements the router.Plugin interface to reject routes
+// whose certificates use algorithms or key sizes FIPS does not approve, for
+// regulated environments.  Unlike the warnings of the status of routes, the
+// routes are not admitted.
+type FIPSCompliance struct {
+	// plugin is the next plugin in the chain.
+	plugin router.Plugin
+
+	// recorder is an interface for indicating route rejections.
+	recorder RejectionRecorder
+}
+
+// NewFIPSCompliance creates a plugin wrapper that rejects routes whose
+// certificates are not FIPS compliant, and relays the other routes to the
+// next plugin in the chain.  Recorder is an interface for indicating why a
+// route was rejected.
+func NewFIPSCompliance(plugin router.Plugin, recorder RejectionRecorder) *FIPSCompliance {
+	return &FIPSCompliance{
+		plugin:   plugin,
+		recorder: recorder,
+	}
+}
+
+// HandleNode processes watch events on the Node resource.
+func (p *FIPSCompliance) HandleNode(eventType watch.EventType, node *kapi.Node) error {
+	return p.plugin.HandleNode(eventType, node)
+}
+
+// HandleEndpoints processes watch events on the Endpoints resource.
+func (p *FIPSCompliance) HandleEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) error {
+	return p.plugin.HandleEndpoints(eventType, endpoints)
+}
+
+// HandleRoute processes watch events on the Route resource.
+func (p *FIPSCompliance) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	switch eventType {
+	case watch.Added, watch.Modified:
+		if violations := fipsViolations(route); len(violations) > 0 {
+			log.V(4).Info("route not admitted: certificates are not FIPS compliant", "namespace", route.Namespace, "name", route.Name, "violations", violations)
+
+			msg := fmt.Sprintf("certificates are not FIPS compliant: %s", strings.Join(violations, "; "))
+			p.recorder.RecordRouteRejection(route, ComplianceViolationReason, msg)
+			p.plugin.HandleRoute(watch.Deleted, route)
+			return router.NewRouteError(ComplianceViolationReason, msg)
+		}
+	}
+
+	return p.plugin.HandleRoute(eventType, route)
+}
+
+// HandleNamespaces limits the scope of valid routes to only those that match
+// the provided namespace list.
+func (p *FIPSCompliance) HandleNamespaces(namespaces sets.String) error {
+	return p.plugin.HandleNamespaces(namespaces)
+}
+
+// Commit invokes the nested plugin to commit.
+func (p *FIPSCompliance) Commit() error {
+	return p.plugin.Commit()
+}
+
+// fipsViolations returns why the certificates of a route are not FIPS
+// compliant.  Certificates that cannot be parsed are left to the extended
+// validation.
+func fipsViolations(route *routev1.Route) []string {
+	tls := route.Spec.TLS
+	if tls == nil {
+		return nil
+	}
+	var violations []string
+	for _, field := range []struct {
+		name string
+		data string
+	}{
+		{"certificate", tls.Certificate},
+		{"caCertificate", tls.CACertificate},
+		{"destinationCACertificate", tls.DestinationCACertificate},
+	} {
+		for _, cert := range parsePEMCertificates(field.data) {
+			for _, violation := range certificateFIPSViolations(cert) {
+				violations = append(violations, fmt.Sprintf("%s %q %s", field.name, cert.Subject.CommonName, violation))
+			}
+		}
+	}
+	return violations
+}
+
+// certificateFIPSViolations returns why cert is not FIPS compliant.  The
+// signatures of self-signed certificates are not checked, as clients trust
+// them without verifying their signature.
+func certificateFIPSViolations(cert *x509.Certificate) []string {
+	var violations []string
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < minFIPSRSAKeyBits {
+			violations = append(violations, fmt.Sprintf("has a %d bit RSA key, at least %d bits are required", bits, minFIPSRSAKeyBits))
+		}
+	case *ecdsa.PublicKey:
+		if !fipsCurves[key.Curve] {
+			violations = append(violations, fmt.Sprintf("has an ECDSA key on the %s curve", key.Curve.Params().Name))
+		}
+	default:
+		violations = append(violations, fmt.Sprintf("has a %s key", cert.PublicKeyAlgorithm))
+	}
+	if selfSigned := bytes.Equal(cert.RawIssuer, cert.RawSubject); !selfSigned && !fipsSignatureAlgorithms[cert.SignatureAlgorithm] {
+		violations = append(violations, fmt.Sprintf("is signed with %s", cert.SignatureAlgorithm))
+	}
+	return violations
+}
+
+// parsePEMCertificates returns the certificates of the PEM encoded data.
+func parsePEMCertificates(data string) []*x509.Certificate {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
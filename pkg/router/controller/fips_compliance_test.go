@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestFIPSCompliance(t *testing.T) {
+	rsaKey := func(bits int) crypto.Signer {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatalf("unable to generate a key: %v", err)
+		}
+		return key
+	}
+	ecdsaKey := func(curve elliptic.Curve) crypto.Signer {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("unable to generate a key: %v", err)
+		}
+		return key
+	}
+	caKey := rsaKey(2048)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	encode := func(template, parent *x509.Certificate, key crypto.PublicKey, signer crypto.Signer) string {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, key, signer)
+		if err != nil {
+			t.Fatalf("unable to create a certificate: %v", err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	ca := encode(caTemplate, caTemplate, caKey.Public(), caKey)
+	leaf := func(key crypto.Signer, algorithm x509.SignatureAlgorithm) string {
+		return encode(&x509.Certificate{
+			SerialNumber:       big.NewInt(2),
+			Subject:            pkix.Name{CommonName: "www.example.com"},
+			NotBefore:          time.Now(),
+			NotAfter:           time.Now().Add(time.Hour),
+			SignatureAlgorithm: algorithm,
+		}, caTemplate, key.Public(), caKey)
+	}
+
+	tests := []struct {
+		name      string
+		tls       *routev1.TLSConfig
+		violation string
+	}{
+		{
+			name: "insecure route",
+		},
+		{
+			name: "compliant certificates",
+			tls: &routev1.TLSConfig{
+				Termination:   routev1.TLSTerminationEdge,
+				Certificate:   leaf(ecdsaKey(elliptic.P256()), x509.SHA256WithRSA),
+				CACertificate: ca,
+			},
+		},
+		{
+			name:      "small RSA key",
+			tls:       &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, Certificate: leaf(rsaKey(1024), x509.SHA256WithRSA)},
+			violation: `certificate "www.example.com" has a 1024 bit RSA key`,
+		},
+		{
+			name:      "unapproved curve",
+			tls:       &routev1.TLSConfig{Termination: routev1.TLSTerminationReencrypt, DestinationCACertificate: leaf(ecdsaKey(elliptic.P224()), x509.SHA256WithRSA)},
+			violation: `destinationCACertificate "www.example.com" has an ECDSA key on the P-224 curve`,
+		},
+		{
+			name:      "unparsable certificate",
+			tls:       &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, Certificate: "-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydGlmaWNhdGU=\n-----END CERTIFICATE-----\n"},
+			violation: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &fakePlugin{}
+			recorder := rejectionRecorder{rejections: make(map[string]string)}
+			plugin := NewFIPSCompliance(p, recorder)
+
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r"},
+				Spec:       routev1.RouteSpec{Host: "www.example.com", TLS: tc.tls},
+			}
+			err := plugin.HandleRoute(watch.Added, route)
+			if len(tc.violation) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.violation) || recorder.rejections["ns-r"] != ComplianceViolationReason || p.t != watch.Deleted {
+					t.Errorf("expected the route to be rejected with %q, got error %v, rejection %q and event %v", tc.violation, err, recorder.rejections["ns-r"], p.t)
+				}
+				return
+			}
+			if err != nil || len(recorder.rejections) > 0 || p.t != watch.Added {
+				t.Errorf("expected the route to be admitted, got error %v, rejections %v and event %v", err, recorder.rejections, p.t)
+			}
+		})
+	}
+}
+
+func TestCertificateFIPSViolations(t *testing.T) {
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		violations int
+	}{
+		{
+			name:       "SHA1 signature",
+			cert:       &x509.Certificate{PublicKey: &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047)}, SignatureAlgorithm: x509.SHA1WithRSA, RawIssuer: []byte("ca"), RawSubject: []byte("leaf")},
+			violations: 1,
+		},
+		{
+			name:       "self-signed SHA1 signature",
+			cert:       &x509.Certificate{PublicKey: &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 2047)}, SignatureAlgorithm: x509.SHA1WithRSA, RawIssuer: []byte("ca"), RawSubject: []byte("ca")},
+			violations: 0,
+		},
+		{
+			name:       "DSA key",
+			cert:       &x509.Certificate{PublicKeyAlgorithm: x509.DSA, SignatureAlgorithm: x509.DSAWithSHA256, RawIssuer: []byte("ca"), RawSubject: []byte("leaf")},
+			violations: 2,
+		},
+	}
+	for _, tc := range tests {
+		if violations := certificateFIPSViolations(tc.cert); len(violations) != tc.violations {
+			t.Errorf("%s: expected %d violations, got %v", tc.name, tc.violations, violations)
+		}
+	}
+}
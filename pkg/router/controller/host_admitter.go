@@ -9,10 +9,13 @@ import (
 
 	routev1 "github.com/openshift/api/route/v1"
 	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
 	"github.com/openshift/router/pkg/router/routeapihelpers"
 )
 
-// RouteAdmissionFunc determines whether or not to admit a route.
+// RouteAdmissionFunc determines whether or not to admit a route.  The
+// reason of a route error it returns is the reason the route is rejected
+// with, RouteNotAdmitted for other errors.
 type RouteAdmissionFunc func(*routev1.Route) error
 
 // RouteMap contains all routes associated with a key
@@ -134,9 +137,13 @@ func (p *HostAdmitter) HandleRoute(eventType watch.EventType, route *routev1.Rou
 
 	if err := p.admitter(route); err != nil {
 		log.V(4).Info("route not admitted", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
-		p.recorder.RecordRouteRejection(route, "RouteNotAdmitted", err.Error())
+		reason := router.ErrorReason(err)
+		if len(reason) == 0 {
+			reason = reasons.RouteNotAdmitted
+		}
+		p.recorder.RecordRouteRejection(route, reason, err.Error())
 		p.plugin.HandleRoute(watch.Deleted, route)
-		return err
+		return router.NewRouteError(reason, err.Error())
 	}
 
 	if p.allowWildcardRoutes && len(route.Spec.Host) > 0 {
@@ -180,8 +187,8 @@ func (p *HostAdmitter) addRoute(route *routev1.Route) error {
 			// route in our namespace.
 			msg = err.Error()
 		}
-		p.recorder.RecordRouteRejection(route, "HostAlreadyClaimed", msg)
-		return err
+		p.recorder.RecordRouteRejection(route, reasons.HostAlreadyClaimed, msg)
+		return router.NewRouteError(reasons.HostAlreadyClaimed, msg)
 	}
 
 	// Remove displaced routes
@@ -202,7 +209,7 @@ func (p *HostAdmitter) addRoute(route *routev1.Route) error {
 			msg = fmt.Sprintf("a route in another namespace holds host %s", displacedRoute.Spec.Host)
 		}
 
-		p.recorder.RecordRouteRejection(displacedRoute, "HostAlreadyClaimed", msg)
+		p.recorder.RecordRouteRejection(displacedRoute, reasons.HostAlreadyClaimed, msg)
 		p.plugin.HandleRoute(watch.Deleted, displacedRoute)
 	}
 
@@ -231,8 +238,8 @@ func (p *HostAdmitter) addRoute(route *routev1.Route) error {
 		p.claimedHosts.RemoveRoute(route.Spec.Host, route)
 		p.claimedWildcards.RemoveRoute(wildcardKey, route)
 		p.blockedWildcards.RemoveRoute(wildcardKey, route)
-		err := fmt.Errorf("unsupported wildcard policy %s", route.Spec.WildcardPolicy)
-		p.recorder.RecordRouteRejection(route, "RouteNotAdmitted", err.Error())
+		err := router.NewRouteError(reasons.RouteNotAdmitted, fmt.Sprintf("unsupported wildcard policy %s", route.Spec.WildcardPolicy))
+		p.recorder.RecordRouteRejection(route, err.Reason, err.Message)
 		return err
 	}
 
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/controller/hostindex"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+// The policies that decide which of the routes contending for a host
+// exposes it.
+const (
+	// HostArbitrationOldest awards a host to the oldest route.
+	HostArbitrationOldest = "oldest"
+	// HostArbitrationNamespacePriority awards a host to the routes in the
+	// first namespace of a priority list, and to the oldest route among
+	// routes of the same priority.  Namespaces that are not in the list
+	// come after those that are.
+	HostArbitrationNamespacePriority = "namespace-priority"
+	// HostArbitrationLabel awards a host to the route with the highest
+	// HostPrecedenceLabel, and to the oldest route among routes of the same
+	// precedence.
+	HostArbitrationLabel = "label"
+	// HostArbitrationSameNamespaceLabel awards a host to the oldest route,
+	// except that a route with a higher HostPrecedenceLabel overrides the
+	// routes of its own namespace.  It requires the namespace ownership
+	// check, so that the namespace owning a host is still that of its
+	// oldest route.
+	HostArbitrationSameNamespaceLabel = "same-namespace-label"
+)
+
+// HostArbitrationPolicies are the supported host arbitration policies.
+var HostArbitrationPolicies = []string{HostArbitrationOldest, HostArbitrationNamespacePriority, HostArbitrationLabel, HostArbitrationSameNamespaceLabel}
+
+// HostPrecedenceLabel is the label whose integer value ranks a route among
+// the routes contending for its host under the label host arbitration
+// policies.  A route without it, or with an invalid value, has a precedence
+// of zero.
+const HostPrecedenceLabel = "router.openshift.io/host-precedence"
+
+// HostArbitration configures how UniqueHost decides which of the routes
+// contending for a host exposes it.
+type HostArbitration struct {
+	// Policy is one of HostArbitrationPolicies.  Empty means
+	// HostArbitrationOldest.
+	Policy string
+	// Namespaces are the namespaces in decreasing order of priority for
+	// HostArbitrationNamespacePriority.
+	Namespaces []string
+}
+
+// Validate returns an error if the arbitration is not valid, or cannot be
+// combined with disabling the namespace ownership check.
+func (a HostArbitration) Validate(disableOwnershipCheck bool) error {
+	switch a.Policy {
+	case "", HostArbitrationOldest, HostArbitrationLabel:
+	case HostArbitrationNamespacePriority:
+		if len(a.Namespaces) == 0 {
+			return fmt.Errorf("the %s host arbitration policy requires a list of namespaces", a.Policy)
+		}
+	case HostArbitrationSameNamespaceLabel:
+		if disableOwnershipCheck {
+			return fmt.Errorf("the %s host arbitration policy requires the namespace ownership check", a.Policy)
+		}
+	default:
+		return fmt.Errorf("unknown host arbitration policy %q, expected one of %s", a.Policy, strings.Join(HostArbitrationPolicies, ", "))
+	}
+	if len(a.Namespaces) > 0 && a.Policy != HostArbitrationNamespacePriority {
+		return fmt.Errorf("a list of namespaces is only used by the %s host arbitration policy", HostArbitrationNamespacePriority)
+	}
+	return nil
+}
+
+// activationFunc returns the function of the host index that activates the
+// routes contending for a host.  Hosts transferred from one namespace to
+// another are awarded to the receiving namespace under every policy.
+func (a HostArbitration) activationFunc(disableOwnershipCheck bool) hostindex.RouteActivationFunc {
+	if a.Policy == "" || a.Policy == HostArbitrationOldest {
+		if disableOwnershipCheck {
+			return withHostTransfers(hostindex.OldestFirst, routeapihelpers.RouteLessThan, nil)
+		}
+		return withHostTransfers(hostindex.SameNamespace, routeapihelpers.RouteLessThan, routeapihelpers.RouteLessThan)
+	}
+
+	less := func(x, y *routev1.Route) bool {
+		if c := a.compare(x, y); c != 0 {
+			return c > 0
+		}
+		return routeapihelpers.RouteLessThan(x, y)
+	}
+	owner := less
+	if disableOwnershipCheck {
+		owner = nil
+	} else if a.Policy == HostArbitrationSameNamespaceLabel {
+		owner = routeapihelpers.RouteLessThan
+	}
+	return withHostTransfers(hostindex.Precedence(less, owner), less, owner)
+}
+
+// compare returns a positive number if x takes precedence over y under the
+// policy regardless of their age, a negative number if y takes precedence
+// over x, and zero if the older route does.
+func (a HostArbitration) compare(x, y *routev1.Route) int {
+	switch a.Policy {
+	case HostArbitrationNamespacePriority:
+		return a.namespaceRank(y.Namespace) - a.namespaceRank(x.Namespace)
+	case HostArbitrationLabel:
+		return hostPrecedence(x) - hostPrecedence(y)
+	case HostArbitrationSameNamespaceLabel:
+		if x.Namespace == y.Namespace {
+			return hostPrecedence(x) - hostPrecedence(y)
+		}
+	}
+	return 0
+}
+
+// namespaceRank returns the position of namespace in the priority list, or
+// the length of the list if it is not in it.
+func (a HostArbitration) namespaceRank(namespace string) int {
+	for i, ns := range a.Namespaces {
+		if ns == namespace {
+			return i
+		}
+	}
+	return len(a.Namespaces)
+}
+
+// olderReason is the reason a route takes precedence by its age.
+const olderReason = "is older"
+
+// reason describes why winner took precedence over loser, e.g. "is older",
+// for the status of the route that lost the host.
+func (a HostArbitration) reason(winner, loser *routev1.Route) string {
+	c := a.compare(winner, loser)
+	if transferredFrom(winner, loser) && (c < 0 || c == 0 && routeapihelpers.RouteLessThan(loser, winner)) {
+		return transferredReason(loser.Namespace)
+	}
+	if c <= 0 {
+		return olderReason
+	}
+	if a.Policy == HostArbitrationNamespacePriority {
+		return fmt.Sprintf("is in namespace %s, which has a higher priority under the %s host arbitration policy", winner.Namespace, a.Policy)
+	}
+	return fmt.Sprintf("has a higher %s label under the %s host arbitration policy", HostPrecedenceLabel, a.Policy)
+}
+
+// hostPrecedence returns the value of the HostPrecedenceLabel of route, or
+// zero if it has none or its value is not an integer.
+func hostPrecedence(route *routev1.Route) int {
+	value, ok := route.Labels[HostPrecedenceLabel]
+	if !ok {
+		return 0
+	}
+	precedence, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int(precedence)
+}
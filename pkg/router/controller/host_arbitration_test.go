@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// messageRecorder records the messages of the route rejections.
+type messageRecorder map[string]string
+
+func (r messageRecorder) RecordRouteRejection(route *routev1.Route, reason, message string) {
+	r[route.Namespace+"/"+route.Name] = reason + ": " + message
+}
+
+func TestHostArbitration(t *testing.T) {
+	now := time.Now()
+	route := func(ns, name string, age time.Duration, precedence string) *routev1.Route {
+		route := makeRoute(ns, name, "www.example.com", "", false, metav1.NewTime(now.Add(-age)))
+		if len(precedence) > 0 {
+			route.Labels = map[string]string{HostPrecedenceLabel: precedence}
+		}
+		return route
+	}
+
+	tests := []struct {
+		name                  string
+		arbitration           HostArbitration
+		disableOwnershipCheck bool
+		routes                []*routev1.Route
+		expectedActive        []string
+		expectedRejections    map[string]string
+	}{
+		{
+			name:           "oldest",
+			arbitration:    HostArbitration{Policy: HostArbitrationOldest},
+			routes:         []*routev1.Route{route("b", "new", time.Minute, "10"), route("a", "old", time.Hour, "")},
+			expectedActive: []string{"a/old"},
+			expectedRejections: map[string]string{
+				"b/new": "HostAlreadyClaimed: replaced by older route old",
+			},
+		},
+		{
+			name:           "namespace priority",
+			arbitration:    HostArbitration{Policy: HostArbitrationNamespacePriority, Namespaces: []string{"a", "b"}},
+			routes:         []*routev1.Route{route("b", "old", time.Hour, ""), route("a", "new", time.Minute, ""), route("c", "oldest", 2*time.Hour, "")},
+			expectedActive: []string{"a/new"},
+			expectedRejections: map[string]string{
+				"b/old":    "HostAlreadyClaimed: replaced by route new, which is in namespace a, which has a higher priority under the namespace-priority host arbitration policy",
+				"c/oldest": "HostAlreadyClaimed: a route in another namespace holds www.example.com and is in namespace a, which has a higher priority under the namespace-priority host arbitration policy",
+			},
+		},
+		{
+			name:           "namespace priority within a namespace",
+			arbitration:    HostArbitration{Policy: HostArbitrationNamespacePriority, Namespaces: []string{"a"}},
+			routes:         []*routev1.Route{route("a", "old", time.Hour, ""), route("a", "new", time.Minute, "")},
+			expectedActive: []string{"a/old"},
+			expectedRejections: map[string]string{
+				"a/new": "HostAlreadyClaimed: route old already exposes www.example.com and is older",
+			},
+		},
+		{
+			name:           "label",
+			arbitration:    HostArbitration{Policy: HostArbitrationLabel},
+			routes:         []*routev1.Route{route("a", "old", time.Hour, ""), route("b", "new", time.Minute, "10"), route("b", "invalid", 2*time.Hour, "high")},
+			expectedActive: []string{"b/new"},
+			expectedRejections: map[string]string{
+				"a/old":     "HostAlreadyClaimed: replaced by route new, which has a higher router.openshift.io/host-precedence label under the label host arbitration policy",
+				"b/invalid": "HostAlreadyClaimed: route new already exposes www.example.com and has a higher router.openshift.io/host-precedence label under the label host arbitration policy",
+			},
+		},
+		{
+			name:                  "label without the namespace ownership check",
+			arbitration:           HostArbitration{Policy: HostArbitrationLabel},
+			disableOwnershipCheck: true,
+			routes:                []*routev1.Route{route("a", "old", time.Hour, "1"), route("b", "new", time.Minute, "2")},
+			expectedActive:        []string{"b/new"},
+			expectedRejections: map[string]string{
+				"a/old": "HostAlreadyClaimed: replaced by route new, which has a higher router.openshift.io/host-precedence label under the label host arbitration policy",
+			},
+		},
+		{
+			name:           "same namespace label",
+			arbitration:    HostArbitration{Policy: HostArbitrationSameNamespaceLabel},
+			routes:         []*routev1.Route{route("a", "old", time.Hour, ""), route("b", "other", time.Minute, "10"), route("a", "new", time.Minute, "10")},
+			expectedActive: []string{"a/new"},
+			expectedRejections: map[string]string{
+				"a/old":   "HostAlreadyClaimed: replaced by route new, which has a higher router.openshift.io/host-precedence label under the same-namespace-label host arbitration policy",
+				"b/other": "HostAlreadyClaimed: a route in another namespace holds www.example.com and is older than other",
+			},
+		},
+	}
+	for _, tc := range tests {
+		recorder := messageRecorder{}
+		uniqueHost := NewUniqueHost(&fakePlugin{}, tc.disableOwnershipCheck, recorder)
+		if err := uniqueHost.SetHostArbitration(tc.arbitration); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		for _, route := range tc.routes {
+			uniqueHost.HandleRoute(watch.Added, route)
+		}
+
+		routes, _ := uniqueHost.RoutesForHost("www.example.com")
+		var active []string
+		for _, route := range routes {
+			active = append(active, route.Namespace+"/"+route.Name)
+		}
+		if strings.Join(active, ",") != strings.Join(tc.expectedActive, ",") {
+			t.Errorf("%s: expected the active routes %v, got %v", tc.name, tc.expectedActive, active)
+		}
+		for key, expected := range tc.expectedRejections {
+			if recorder[key] != expected {
+				t.Errorf("%s: expected %s to be rejected with %q, got %q", tc.name, key, expected, recorder[key])
+			}
+		}
+	}
+}
+
+func TestHostArbitrationValidate(t *testing.T) {
+	tests := []struct {
+		name                  string
+		arbitration           HostArbitration
+		disableOwnershipCheck bool
+		expectErr             bool
+	}{
+		{name: "default"},
+		{name: "oldest", arbitration: HostArbitration{Policy: HostArbitrationOldest}},
+		{name: "label", arbitration: HostArbitration{Policy: HostArbitrationLabel}, disableOwnershipCheck: true},
+		{name: "namespace priority", arbitration: HostArbitration{Policy: HostArbitrationNamespacePriority, Namespaces: []string{"a"}}},
+		{name: "namespace priority without namespaces", arbitration: HostArbitration{Policy: HostArbitrationNamespacePriority}, expectErr: true},
+		{name: "namespaces without namespace priority", arbitration: HostArbitration{Policy: HostArbitrationLabel, Namespaces: []string{"a"}}, expectErr: true},
+		{name: "same namespace label", arbitration: HostArbitration{Policy: HostArbitrationSameNamespaceLabel}},
+		{name: "same namespace label without the namespace ownership check", arbitration: HostArbitration{Policy: HostArbitrationSameNamespaceLabel}, disableOwnershipCheck: true, expectErr: true},
+		{name: "unknown", arbitration: HostArbitration{Policy: "newest"}, expectErr: true},
+	}
+	for _, tc := range tests {
+		if err := tc.arbitration.Validate(tc.disableOwnershipCheck); (err != nil) != tc.expectErr {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, err)
+		}
+	}
+
+	uniqueHost := NewUniqueHost(&fakePlugin{}, false, messageRecorder{})
+	uniqueHost.HandleRoute(watch.Added, makeRoute("a", "r", "www.example.com", "", false, metav1.Now()))
+	if err := uniqueHost.SetHostArbitration(HostArbitration{Policy: HostArbitrationLabel}); err == nil {
+		t.Errorf("expected an error changing the policy once routes are handled")
+	}
+}
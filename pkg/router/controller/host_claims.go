@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// HostClaim identifies the route that owned a host when the claims were
+// last persisted.
+type HostClaim struct {
+	Namespace         string      `json:"namespace"`
+	Name              string      `json:"name"`
+	UID               types.UID   `json:"uid"`
+	CreationTimestamp metav1.Time `json:"creationTimestamp"`
+}
+
+// HostClaims maps a host to the route that owns it.
+type HostClaims map[string]HostClaim
+
+// hosts returns the claimed hosts.
+func (c HostClaims) hosts() []string {
+	hosts := make([]string, 0, len(c))
+	for host := range c {
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// HostClaimStore persists host claims across router restarts.
+type HostClaimStore interface {
+	// Load returns the previously persisted claims. A store that has
+	// never been written returns an empty set of claims.
+	Load() (HostClaims, error)
+	// Save replaces the persisted claims.
+	Save(claims HostClaims) error
+}
+
+// claimForRoute returns the claim held by the provided route.
+func claimForRoute(route *routev1.Route) HostClaim {
+	return HostClaim{
+		Namespace:         route.Namespace,
+		Name:              route.Name,
+		UID:               route.UID,
+		CreationTimestamp: route.CreationTimestamp,
+	}
+}
+
+// sameClaimant returns true if both claims are held by the same route.
+func (c HostClaim) sameClaimant(other HostClaim) bool {
+	return c.UID == other.UID && c.Namespace == other.Namespace && c.Name == other.Name
+}
+
+// fileHostClaimStore stores host claims as JSON in a local file.
+type fileHostClaimStore struct {
+	path string
+}
+
+// NewFileHostClaimStore returns a HostClaimStore that keeps claims in the
+// file at path. The file is replaced atomically on every save so that a
+// crash never leaves a partially written cache behind.
+func NewFileHostClaimStore(path string) HostClaimStore {
+	return &fileHostClaimStore{path: path}
+}
+
+func (s *fileHostClaimStore) Load() (HostClaims, error) {
+	claims := HostClaims{}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return claims, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("unable to parse host claims in %s: %v", s.path, err)
+	}
+	return claims, nil
+}
+
+func (s *fileHostClaimStore) Save(claims HostClaims) error {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
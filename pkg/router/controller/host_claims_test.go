@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type memoryHostClaimStore struct {
+	claims HostClaims
+	saves  int
+}
+
+func (s *memoryHostClaimStore) Load() (HostClaims, error) {
+	claims := HostClaims{}
+	for host, claim := range s.claims {
+		claims[host] = claim
+	}
+	return claims, nil
+}
+
+func (s *memoryHostClaimStore) Save(claims HostClaims) error {
+	s.claims = HostClaims{}
+	for host, claim := range claims {
+		s.claims[host] = claim
+	}
+	s.saves++
+	return nil
+}
+
+func TestFileHostClaimStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "host-claims")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileHostClaimStore(filepath.Join(dir, "cache", "claims.json"))
+	claims, err := store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading missing cache: %v", err)
+	}
+	if len(claims) != 0 {
+		t.Fatalf("expected no claims, got %v", claims)
+	}
+
+	route := makeRoute("ns1", "r1", "www.example.test", "", false, metav1.Time{Time: time.Unix(100, 0)})
+	if err := store.Save(HostClaims{"www.example.test": claimForRoute(route)}); err != nil {
+		t.Fatalf("unexpected error saving claims: %v", err)
+	}
+	claims, err = store.Load()
+	if err != nil {
+		t.Fatalf("unexpected error loading claims: %v", err)
+	}
+	claim, ok := claims["www.example.test"]
+	if !ok || !claim.sameClaimant(claimForRoute(route)) {
+		t.Fatalf("expected claim for %s, got %v", routeNameKey(route), claims)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "cache", "claims.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); err == nil {
+		t.Fatalf("expected an error loading a corrupt cache")
+	}
+}
+
+func TestUniqueHostRestoredClaims(t *testing.T) {
+	owner := makeRoute("ns1", "owner", "www.example.test", "", false, metav1.Time{Time: time.Unix(100, 0)})
+	contender := makeRoute("ns2", "contender", "www.example.test", "", false, metav1.Time{Time: time.Unix(200, 0)})
+	other := makeRoute("ns2", "other", "other.example.test", "", false, metav1.Time{Time: time.Unix(200, 0)})
+
+	p := &fakePlugin{}
+	recorder := rejectionRecorder{rejections: make(map[string]string)}
+	store := &memoryHostClaimStore{claims: HostClaims{"www.example.test": claimForRoute(owner)}}
+	uniqueHost := NewUniqueHost(p, false, recorder)
+	if err := uniqueHost.SetHostClaimStore(store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The contender is seen first but must not be handed the host.
+	if err := uniqueHost.HandleRoute(watch.Added, contender); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.route != nil {
+		t.Fatalf("expected contender to be deferred, got %s", routeNameKey(p.route))
+	}
+	if _, ok := recorder.rejections[recorder.rejectionKey(contender)]; ok {
+		t.Fatalf("expected contender not to be rejected before the owner is seen")
+	}
+
+	// Routes without a restored claim are unaffected.
+	if err := uniqueHost.HandleRoute(watch.Added, other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.route != other {
+		t.Fatalf("expected %s to be admitted", routeNameKey(other))
+	}
+
+	// Once the owner shows up, the contender is released and rejected.
+	if err := uniqueHost.HandleRoute(watch.Added, owner); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reason := recorder.rejections[recorder.rejectionKey(contender)]; reason != "HostAlreadyClaimed" {
+		t.Fatalf("expected contender to be rejected with HostAlreadyClaimed, got %q", reason)
+	}
+	if routes, _ := uniqueHost.RoutesForHost("www.example.test"); len(routes) != 1 || routes[0] != owner {
+		t.Fatalf("expected owner to hold the host, got %v", routes)
+	}
+
+	// The fakePlugin does not support commits, so ignore the not expected error.
+	if err := uniqueHost.Commit(); err != nil && err.Error() != "not expected" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !store.claims["www.example.test"].sameClaimant(claimForRoute(owner)) {
+		t.Fatalf("expected owner claim to be persisted, got %v", store.claims)
+	}
+	if !store.claims["other.example.test"].sameClaimant(claimForRoute(other)) {
+		t.Fatalf("expected other claim to be persisted, got %v", store.claims)
+	}
+
+	// Nothing changed, so the claims are not written again.
+	saves := store.saves
+	if err := uniqueHost.Commit(); err != nil && err.Error() != "not expected" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.saves != saves {
+		t.Fatalf("expected claims not to be saved without changes")
+	}
+
+	// Deleting the owner hands the host over to the contender.
+	if err := uniqueHost.HandleRoute(watch.Deleted, owner); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := uniqueHost.Commit(); err != nil && err.Error() != "not expected" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !store.claims["www.example.test"].sameClaimant(claimForRoute(contender)) {
+		t.Fatalf("expected contender claim to be persisted, got %v", store.claims)
+	}
+}
+
+func TestUniqueHostRestoredClaimMissingOwner(t *testing.T) {
+	owner := makeRoute("ns1", "owner", "www.example.test", "", false, metav1.Time{Time: time.Unix(100, 0)})
+	contender := makeRoute("ns2", "contender", "www.example.test", "", false, metav1.Time{Time: time.Unix(200, 0)})
+
+	p := &fakePlugin{}
+	recorder := rejectionRecorder{rejections: make(map[string]string)}
+	store := &memoryHostClaimStore{claims: HostClaims{"www.example.test": claimForRoute(owner)}}
+	uniqueHost := NewUniqueHost(p, false, recorder)
+	if err := uniqueHost.SetHostClaimStore(store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := uniqueHost.HandleRoute(watch.Added, contender); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.route != nil {
+		t.Fatalf("expected contender to be deferred, got %s", routeNameKey(p.route))
+	}
+
+	// The owner was deleted while the router was down, so the initial
+	// sync completes without it and the contender is admitted.
+	if err := uniqueHost.Commit(); err != nil && err.Error() != "not expected" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.route != contender || p.t != watch.Added {
+		t.Fatalf("expected contender to be admitted on commit")
+	}
+	if !store.claims["www.example.test"].sameClaimant(claimForRoute(contender)) {
+		t.Fatalf("expected contender claim to be persisted, got %v", store.claims)
+	}
+}
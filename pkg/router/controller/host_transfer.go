@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"fmt"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/controller/hostindex"
+)
+
+// The annotations that transfer a host from the routes of the namespace that
+// holds it to the routes of another namespace.  The transfer takes effect
+// once a route of the receiving namespace requests the host from the
+// namespace that holds it, and a route of that namespace grants the host to
+// the receiving namespace.  The routes of the receiving namespace then take
+// precedence over those of the granting namespace, whatever their age or the
+// host arbitration policy, for as long as both annotations are set.  The
+// routes of the granting namespace can be deleted once the transfer took
+// effect.
+const (
+	// HostTransferFromAnnotation requests the host of a route from the
+	// namespace set as its value.
+	HostTransferFromAnnotation = "router.openshift.io/host-transfer-from"
+	// HostTransferToAnnotation grants the host of a route to the namespace
+	// set as its value.
+	HostTransferToAnnotation = "router.openshift.io/host-transfer-to"
+)
+
+// hostTransfers maps the namespaces a host was transferred to to the
+// namespaces that granted it.
+type hostTransfers map[string]string
+
+// findHostTransfers returns the transfers of a host that both a route of the
+// receiving namespace requested and a route of the granting namespace
+// granted.
+func findHostTransfers(routes []*routev1.Route) hostTransfers {
+	requests := map[string]string{}
+	grants := map[string]map[string]bool{}
+	for _, route := range routes {
+		if from := route.Annotations[HostTransferFromAnnotation]; len(from) > 0 && from != route.Namespace {
+			requests[route.Namespace] = from
+		}
+		if to := route.Annotations[HostTransferToAnnotation]; len(to) > 0 && to != route.Namespace {
+			if grants[route.Namespace] == nil {
+				grants[route.Namespace] = map[string]bool{}
+			}
+			grants[route.Namespace][to] = true
+		}
+	}
+	var transfers hostTransfers
+	for to, from := range requests {
+		if grants[from][to] {
+			if transfers == nil {
+				transfers = hostTransfers{}
+			}
+			transfers[to] = from
+		}
+	}
+	return transfers
+}
+
+// order returns the order less with the routes of the namespaces a host was
+// transferred to ranked right before the first route, in the order of less,
+// of the namespace that granted it.  A receiving namespace that granted the
+// host on in turn is ranked by its own routes.  The order is nil if less is
+// nil.
+func (t hostTransfers) order(routes []*routev1.Route, less func(a, b *routev1.Route) bool) func(a, b *routev1.Route) bool {
+	if less == nil {
+		return nil
+	}
+	first := map[string]*routev1.Route{}
+	for _, route := range routes {
+		if f, ok := first[route.Namespace]; !ok || less(route, f) {
+			first[route.Namespace] = route
+		}
+	}
+	// rank returns the route a route is ranked by, and whether it was
+	// transferred the host.
+	rank := func(route *routev1.Route) (*routev1.Route, bool) {
+		if from, ok := t[route.Namespace]; ok {
+			if granting, ok := first[from]; ok {
+				return granting, true
+			}
+		}
+		return route, false
+	}
+	return func(a, b *routev1.Route) bool {
+		ra, ta := rank(a)
+		rb, tb := rank(b)
+		switch {
+		case ra != rb:
+			return less(ra, rb)
+		case ta != tb:
+			return ta
+		default:
+			return less(a, b)
+		}
+	}
+}
+
+// withHostTransfers returns an activation function that activates the routes
+// of a host with fn unless the host was transferred, in which case the routes
+// are activated in the orders less and owner of hostindex.Precedence with the
+// routes of the receiving namespace ranked before those of the granting
+// namespace.
+func withHostTransfers(fn hostindex.RouteActivationFunc, less, owner func(a, b *routev1.Route) bool) hostindex.RouteActivationFunc {
+	return func(changed hostindex.Changed, active []*routev1.Route, inactive ...*routev1.Route) ([]*routev1.Route, []*routev1.Route) {
+		routes := make([]*routev1.Route, 0, len(active)+len(inactive))
+		routes = append(append(routes, active...), inactive...)
+		transfers := findHostTransfers(routes)
+		if len(transfers) == 0 {
+			return fn(changed, active, inactive...)
+		}
+		return hostindex.Precedence(transfers.order(routes, less), transfers.order(routes, owner))(changed, active, inactive...)
+	}
+}
+
+// hostTransferChanged returns true if the change from old to route changes
+// the transfer annotations of the route.
+func hostTransferChanged(old, route *routev1.Route) bool {
+	return old.Annotations[HostTransferFromAnnotation] != route.Annotations[HostTransferFromAnnotation] ||
+		old.Annotations[HostTransferToAnnotation] != route.Annotations[HostTransferToAnnotation]
+}
+
+// transferredReason is the reason a route takes precedence after the
+// namespace granted its host to the namespace of the route.
+func transferredReason(namespace string) string {
+	return fmt.Sprintf("was transferred the host by namespace %s", namespace)
+}
+
+// transferredFrom returns true if winner requested its host from the
+// namespace of loser.
+func transferredFrom(winner, loser *routev1.Route) bool {
+	return winner.Namespace != loser.Namespace && winner.Annotations[HostTransferFromAnnotation] == loser.Namespace
+}
+
+// pendingTransferMessage returns the rejection message of a route that
+// requested its host from the namespace of owner, which did not grant it.
+func pendingTransferMessage(route, owner *routev1.Route) string {
+	return fmt.Sprintf("a route in namespace %s holds %s, and none of its routes grants the host to namespace %s with the %s annotation yet", owner.Namespace, route.Spec.Host, route.Namespace, HostTransferToAnnotation)
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestHostTransfer(t *testing.T) {
+	now := time.Now()
+	route := func(ns, name string, age time.Duration, version, from, to string) *routev1.Route {
+		route := makeRoute(ns, name, "www.example.com", "", false, metav1.NewTime(now.Add(-age)))
+		route.ResourceVersion = version
+		route.Annotations = map[string]string{}
+		if len(from) > 0 {
+			route.Annotations[HostTransferFromAnnotation] = from
+		}
+		if len(to) > 0 {
+			route.Annotations[HostTransferToAnnotation] = to
+		}
+		return route
+	}
+	type step struct {
+		event              watch.EventType
+		route              *routev1.Route
+		expectedActive     []string
+		expectedRejections map[string]string
+	}
+
+	tests := []struct {
+		name        string
+		arbitration HostArbitration
+		steps       []step
+	}{
+		{
+			name: "request, then grant",
+			steps: []step{
+				{
+					event:          watch.Added,
+					route:          route("a", "old", time.Hour, "1", "", ""),
+					expectedActive: []string{"a/old"},
+				},
+				{
+					event:          watch.Added,
+					route:          route("b", "new", time.Minute, "1", "a", ""),
+					expectedActive: []string{"a/old"},
+					expectedRejections: map[string]string{
+						"b/new": "HostAlreadyClaimed: a route in namespace a holds www.example.com, and none of its routes grants the host to namespace b with the router.openshift.io/host-transfer-to annotation yet",
+					},
+				},
+				{
+					event:          watch.Modified,
+					route:          route("a", "old", time.Hour, "2", "", "b"),
+					expectedActive: []string{"b/new"},
+					expectedRejections: map[string]string{
+						"a/old": "HostTransferred: namespace a granted www.example.com to namespace b, where route new exposes it",
+					},
+				},
+				{
+					event:          watch.Deleted,
+					route:          route("a", "old", time.Hour, "2", "", "b"),
+					expectedActive: []string{"b/new"},
+				},
+			},
+		},
+		{
+			name: "grant, then request",
+			steps: []step{
+				{
+					event:          watch.Added,
+					route:          route("a", "old", time.Hour, "1", "", "b"),
+					expectedActive: []string{"a/old"},
+				},
+				{
+					event:          watch.Added,
+					route:          route("b", "new", time.Minute, "1", "a", ""),
+					expectedActive: []string{"b/new"},
+					expectedRejections: map[string]string{
+						"a/old": "HostTransferred: replaced by route new, which was transferred the host by namespace a",
+					},
+				},
+			},
+		},
+		{
+			name: "revoked grant",
+			steps: []step{
+				{
+					event:          watch.Added,
+					route:          route("a", "old", time.Hour, "1", "", "b"),
+					expectedActive: []string{"a/old"},
+				},
+				{
+					event:          watch.Added,
+					route:          route("b", "new", time.Minute, "1", "a", ""),
+					expectedActive: []string{"b/new"},
+				},
+				{
+					event:          watch.Modified,
+					route:          route("a", "old", time.Hour, "2", "", ""),
+					expectedActive: []string{"a/old"},
+					expectedRejections: map[string]string{
+						"b/new": "HostAlreadyClaimed: a route in namespace a holds www.example.com, and none of its routes grants the host to namespace b with the router.openshift.io/host-transfer-to annotation yet",
+					},
+				},
+			},
+		},
+		{
+			name: "grant to another namespace",
+			steps: []step{
+				{
+					event:          watch.Added,
+					route:          route("a", "old", time.Hour, "1", "", "c"),
+					expectedActive: []string{"a/old"},
+				},
+				{
+					event:          watch.Added,
+					route:          route("b", "new", time.Minute, "1", "a", ""),
+					expectedActive: []string{"a/old"},
+				},
+			},
+		},
+		{
+			name:        "transfer over the host precedence label",
+			arbitration: HostArbitration{Policy: HostArbitrationLabel},
+			steps: []step{
+				{
+					event: watch.Added,
+					route: func() *routev1.Route {
+						r := route("a", "old", time.Hour, "1", "", "b")
+						r.Labels = map[string]string{HostPrecedenceLabel: "10"}
+						return r
+					}(),
+					expectedActive: []string{"a/old"},
+				},
+				{
+					event:          watch.Added,
+					route:          route("b", "new", time.Minute, "1", "a", ""),
+					expectedActive: []string{"b/new"},
+					expectedRejections: map[string]string{
+						"a/old": "HostTransferred: replaced by route new, which was transferred the host by namespace a",
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		recorder := messageRecorder{}
+		uniqueHost := NewUniqueHost(&fakePlugin{}, false, recorder)
+		if err := uniqueHost.SetHostArbitration(tc.arbitration); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		for i, step := range tc.steps {
+			for key := range recorder {
+				delete(recorder, key)
+			}
+			uniqueHost.HandleRoute(step.event, step.route)
+
+			routes, _ := uniqueHost.RoutesForHost("www.example.com")
+			var active []string
+			for _, route := range routes {
+				active = append(active, route.Namespace+"/"+route.Name)
+			}
+			if strings.Join(active, ",") != strings.Join(step.expectedActive, ",") {
+				t.Errorf("%s, step %d: expected the active routes %v, got %v", tc.name, i, step.expectedActive, active)
+			}
+			for key, expected := range step.expectedRejections {
+				if recorder[key] != expected {
+					t.Errorf("%s, step %d: expected %s to be rejected with %q, got %q", tc.name, i, key, expected, recorder[key])
+				}
+			}
+		}
+	}
+}
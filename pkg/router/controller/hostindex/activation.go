@@ -76,6 +76,43 @@ func SameNamespace(changed Changed, active []*routev1.Route, inactive ...*routev
 	})
 }
 
+// Precedence returns a route activation function that identifies all unique host+path combinations
+// in active and inactive in the order of less rather than oldest first. Duplicates are returned in
+// displaced. If owner is not nil, only the routes from the same namespace as the first route in the
+// order of owner are activated, as for SameNamespace. Both orders must be total, e.g. by falling back
+// to routeapihelpers.RouteLessThan, and the active routes are returned in the order of less.
+func Precedence(less, owner func(a, b *routev1.Route) bool) RouteActivationFunc {
+	return func(changed Changed, active []*routev1.Route, inactive ...*routev1.Route) (updated, displaced []*routev1.Route) {
+		if len(inactive) == 0 {
+			return active, nil
+		}
+
+		isActive := make(map[*routev1.Route]bool, len(active))
+		routes := make([]*routev1.Route, 0, len(active)+len(inactive))
+		for _, route := range active {
+			isActive[route] = true
+			routes = append(routes, route)
+		}
+		routes = append(routes, inactive...)
+		sort.Slice(routes, func(i, j int) bool { return less(routes[i], routes[j]) })
+
+		ns := ""
+		if owner != nil {
+			first := routes[0]
+			for _, route := range routes[1:] {
+				if owner(route, first) {
+					first = route
+				}
+			}
+			ns = first.Namespace
+		}
+		for _, route := range routes {
+			updated, displaced = appendRoute(changed, updated, displaced, route, owner == nil || route.Namespace == ns, isActive[route])
+		}
+		return updated, displaced
+	}
+}
+
 // zipperMerge assumes both active and inactive are in order and takes the oldest route from either
 // list until all items are processed. If fn returns false the item will be skipped.
 func zipperMerge(active, inactive []*routev1.Route, changed Changed, fn func(*routev1.Route) bool) (updated, displaced []*routev1.Route) {
@@ -7,6 +7,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/diff"
 
 	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 )
 
 func TestOldestFirst(t *testing.T) {
@@ -279,3 +280,124 @@ func TestSameNamespace(t *testing.T) {
 		})
 	}
 }
+
+func TestPrecedence(t *testing.T) {
+	test1 := newRoute("test", "1", 1, 1, routev1.RouteSpec{Host: "test.com"})
+	test2 := newRoute("test", "2", 11, 2, routev1.RouteSpec{Host: "test.com"})
+	test3a := newRoute("test", "3", 12, 3, routev1.RouteSpec{Host: "test.com", Path: "/a"})
+	other1 := newRoute("other", "1", 2, 4, routev1.RouteSpec{Host: "test.com"})
+	other2 := newRoute("other", "2", 13, 5, routev1.RouteSpec{Host: "test.com"})
+
+	// routes in the other namespace take precedence over older routes
+	otherFirst := func(a, b *routev1.Route) bool {
+		if a.Namespace != b.Namespace {
+			return a.Namespace == "other"
+		}
+		return routeapihelpers.RouteLessThan(a, b)
+	}
+
+	type args struct {
+		active   []*routev1.Route
+		inactive []*routev1.Route
+	}
+	tests := []struct {
+		name          string
+		owner         func(a, b *routev1.Route) bool
+		args          args
+		wantUpdated   []*routev1.Route
+		wantDisplaced []*routev1.Route
+		activates     map[string]struct{}
+		displaces     map[string]struct{}
+	}{
+		{
+			name: "no contention",
+			args: args{
+				active: []*routev1.Route{test1},
+			},
+			wantUpdated: []*routev1.Route{test1},
+		},
+		{
+			name: "newer route takes precedence",
+			args: args{
+				active:   []*routev1.Route{test1},
+				inactive: []*routev1.Route{other2},
+			},
+			wantUpdated:   []*routev1.Route{other2},
+			activates:     map[string]struct{}{"013": {}},
+			wantDisplaced: []*routev1.Route{test1},
+			displaces:     map[string]struct{}{"001": {}},
+		},
+		{
+			name: "older route does not take precedence",
+			args: args{
+				active:   []*routev1.Route{other2},
+				inactive: []*routev1.Route{test1},
+			},
+			wantUpdated:   []*routev1.Route{other2},
+			wantDisplaced: []*routev1.Route{test1},
+		},
+		{
+			name: "unordered input",
+			args: args{
+				active:   []*routev1.Route{test2},
+				inactive: []*routev1.Route{test3a, other2, test1},
+			},
+			wantUpdated:   []*routev1.Route{other2, test3a},
+			activates:     map[string]struct{}{"012": {}, "013": {}},
+			wantDisplaced: []*routev1.Route{test1, test2},
+			displaces:     map[string]struct{}{"011": {}},
+		},
+		{
+			name:  "owner namespace",
+			owner: otherFirst,
+			args: args{
+				active:   []*routev1.Route{test1, test3a},
+				inactive: []*routev1.Route{other2},
+			},
+			wantUpdated:   []*routev1.Route{other2},
+			activates:     map[string]struct{}{"013": {}},
+			wantDisplaced: []*routev1.Route{test1, test3a},
+			displaces:     map[string]struct{}{"001": {}, "012": {}},
+		},
+		{
+			name:  "owner namespace by age",
+			owner: routeapihelpers.RouteLessThan,
+			args: args{
+				active:   []*routev1.Route{other1},
+				inactive: []*routev1.Route{test1, test3a},
+			},
+			wantUpdated:   []*routev1.Route{test1, test3a},
+			activates:     map[string]struct{}{"001": {}, "012": {}},
+			wantDisplaced: []*routev1.Route{other1},
+			displaces:     map[string]struct{}{"002": {}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.activates == nil {
+				tt.activates = make(map[string]struct{})
+			}
+			if tt.displaces == nil {
+				tt.displaces = make(map[string]struct{})
+			}
+
+			changes := &routeChanges{}
+			gotUpdated, gotDisplaced := Precedence(otherFirst, tt.owner)(changes, tt.args.active, tt.args.inactive...)
+			if !reflect.DeepEqual(gotUpdated, tt.wantUpdated) {
+				t.Errorf("Precedence() updated: %s", diff.ObjectReflectDiff(tt.wantUpdated, gotUpdated))
+			}
+			if !reflect.DeepEqual(gotDisplaced, tt.wantDisplaced) {
+				t.Errorf("Precedence() displaced: %s", diff.ObjectReflectDiff(tt.wantDisplaced, gotDisplaced))
+			}
+
+			activates := changesToMap(changes.GetActivated())
+			if !reflect.DeepEqual(tt.activates, activates) {
+				t.Errorf("Unexpected activated changes: %s", diff.ObjectReflectDiff(tt.activates, activates))
+			}
+			displaces := changesToMap(changes.GetDisplaced())
+			if !reflect.DeepEqual(tt.displaces, displaces) {
+				t.Errorf("Unexpected displaced changes: %s", diff.ObjectReflectDiff(tt.displaces, displaces))
+			}
+		})
+	}
+}
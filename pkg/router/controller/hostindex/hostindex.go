@@ -52,6 +52,9 @@ func sameRouteForKey(a *routev1.Route, key routeKey) bool {
 
 type hostIndex struct {
 	activateFn RouteActivationFunc
+	// changedFn, if set, tells whether a change to a route that keeps its
+	// host and path requires activating the routes of the host again.
+	changedFn RouteChangedFunc
 
 	hostToRoute map[string]*hostRules
 	routeToHost map[routeKey]string
@@ -60,8 +63,20 @@ type hostIndex struct {
 // New returns a new host index that uses the provided route activation function to determine
 // which routes for a given host should be active.
 func New(fn RouteActivationFunc) Interface {
+	return NewWithChangedFunc(fn, nil)
+}
+
+// RouteChangedFunc returns true if the change from old to route, which have
+// the same host and path, may change which routes of the host are active.
+type RouteChangedFunc func(old, route *routev1.Route) bool
+
+// NewWithChangedFunc returns a new host index like New that activates the
+// routes of a host again when changed returns true for a change to one of
+// them that keeps its host and path.
+func NewWithChangedFunc(fn RouteActivationFunc, changed RouteChangedFunc) Interface {
 	return &hostIndex{
 		activateFn:  fn,
+		changedFn:   changed,
 		hostToRoute: make(map[string]*hostRules),
 		routeToHost: make(map[routeKey]string),
 	}
@@ -112,6 +127,10 @@ func (hi *hostIndex) add(route *routev1.Route, changes *routeChanges) bool {
 			}
 			// no other significant changes, we can update the cache and then exit
 			rules.replace(existing, route)
+			if hi.changedFn != nil && hi.changedFn(existing, route) {
+				rules.reset(hi.activateFn, changes)
+				active = rules.isActive(route)
+			}
 			// a route that is active should be notified
 			if active {
 				changes.Activated(route)
@@ -247,6 +266,15 @@ func (r *hostRules) Empty() bool {
 	return len(r.active) == 0 && len(r.inactive) == 0
 }
 
+func (r *hostRules) isActive(route *routev1.Route) bool {
+	for _, existing := range r.active {
+		if existing == route {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *hostRules) replace(old, route *routev1.Route) {
 	for i, existing := range r.active {
 		if existing == old {
@@ -500,3 +500,68 @@ func changesToMap(routes []*routev1.Route) map[string]struct{} {
 	}
 	return m
 }
+
+func Test_ChangedFunc(t *testing.T) {
+	// last activates the newest route, unless it is labeled as a standby.
+	last := func(changes Changed, active []*routev1.Route, routes ...*routev1.Route) (updated, displaced []*routev1.Route) {
+		all := append(append([]*routev1.Route{}, active...), routes...)
+		var winner *routev1.Route
+		for _, route := range all {
+			if route.Labels["standby"] != "true" && (winner == nil || routeapihelpers.RouteLessThan(winner, route)) {
+				winner = route
+			}
+		}
+		isActive := map[*routev1.Route]bool{}
+		for _, route := range active {
+			isActive[route] = true
+		}
+		for _, route := range all {
+			if route == winner {
+				if !isActive[route] {
+					changes.Activated(route)
+				}
+				updated = append(updated, route)
+				continue
+			}
+			if isActive[route] {
+				changes.Displaced(route)
+			}
+			displaced = append(displaced, route)
+		}
+		return updated, displaced
+	}
+	standby := func(old, route *routev1.Route) bool {
+		return old.Labels["standby"] != route.Labels["standby"]
+	}
+
+	hi := NewWithChangedFunc(last, standby)
+	old := newRoute("test", "old", 1, 1, routev1.RouteSpec{Host: "test.com"})
+	current := newRoute("test", "new", 2, 1, routev1.RouteSpec{Host: "test.com"})
+	hi.Add(old)
+	hi.Add(current)
+
+	// A change the function ignores keeps the active routes.
+	relabeled := newRoute("test", "new", 2, 2, routev1.RouteSpec{Host: "test.com"})
+	relabeled.Labels = map[string]string{"other": "true"}
+	changes, _ := hi.Add(relabeled)
+	if active, _ := hi.RoutesForHost("test.com"); len(active) != 1 || active[0] != relabeled {
+		t.Fatalf("expected the relabeled route to stay active, got %v", active)
+	}
+	if activated := changes.GetActivated(); len(activated) != 1 || activated[0] != relabeled {
+		t.Errorf("expected the relabeled route to be reported as active, got %v", activated)
+	}
+
+	// A change the function reports activates the routes of the host again.
+	standbyRoute := newRoute("test", "new", 2, 3, routev1.RouteSpec{Host: "test.com"})
+	standbyRoute.Labels = map[string]string{"standby": "true"}
+	changes, _ = hi.Add(standbyRoute)
+	if active, _ := hi.RoutesForHost("test.com"); len(active) != 1 || active[0] != old {
+		t.Fatalf("expected the old route to be activated, got %v", active)
+	}
+	if !reflect.DeepEqual(changesToMap(changes.GetActivated()), map[string]struct{}{"001": {}}) {
+		t.Errorf("expected the old route to be activated, got %v", changes.GetActivated())
+	}
+	if !reflect.DeepEqual(changesToMap(changes.GetDisplaced()), map[string]struct{}{"002": {}}) {
+		t.Errorf("expected the standby route to be displaced, got %v", changes.GetDisplaced())
+	}
+}
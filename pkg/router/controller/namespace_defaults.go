@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	kcoreclient "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+)
+
+// NamespaceDefaults implements the router.Plugin interface to default the
+// annotations of routes to the annotations of their namespace.  Only the
+// annotations it is configured with are inherited, and the annotations a
+// route sets override the ones of its namespace.
+//
+// The plugin keeps the routes it was given so that it can pass them down
+// again when the annotations of their namespace change.  It serializes the
+// calls to the next plugins, which it makes from the namespace watch as well
+// as from the router controller, so it must be the first plugin of the
+// chain.
+type NamespaceDefaults struct {
+	// plugin is the next plugin in the chain.
+	plugin router.Plugin
+	// annotations are the annotations routes inherit from their namespace.
+	annotations sets.String
+
+	lock sync.Mutex
+	// defaults are the inherited annotations of each namespace that sets
+	// any.
+	defaults map[string]map[string]string
+	// routes are the routes of each namespace, as they were given to the
+	// plugin.
+	routes map[string]map[string]*routev1.Route
+	// committed is true once the router controller committed the initial
+	// sync, after which changes to the namespaces are committed too.
+	committed bool
+}
+
+// NewNamespaceDefaults creates a plugin wrapper that defaults the given
+// annotations of routes to the ones of their namespace, and relays the
+// routes to the next plugin in the chain.
+func NewNamespaceDefaults(plugin router.Plugin, annotations []string) *NamespaceDefaults {
+	return &NamespaceDefaults{
+		plugin:      plugin,
+		annotations: sets.NewString(annotations...),
+		defaults:    make(map[string]map[string]string),
+		routes:      make(map[string]map[string]*routev1.Route),
+	}
+}
+
+// Run watches the namespaces for the annotations their routes inherit,
+// and returns once they have all been listed so that the routes of the
+// initial sync have their defaults.
+func (p *NamespaceDefaults) Run(client kcoreclient.NamespacesGetter, resync time.Duration, stopCh <-chan struct{}) {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.Namespaces().List(context.TODO(), options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.Namespaces().Watch(context.TODO(), options)
+		},
+	}
+	_, informer := cache.NewInformer(lw, &kapi.Namespace{}, resync, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.HandleNamespace(watch.Added, obj.(*kapi.Namespace))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			p.HandleNamespace(watch.Modified, obj.(*kapi.Namespace))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*kapi.Namespace); ok {
+				p.HandleNamespace(watch.Deleted, ns)
+			}
+		},
+	})
+	go informer.Run(stopCh)
+	cache.WaitForCacheSync(stopCh, informer.HasSynced)
+}
+
+// HandleNamespace records the annotations of a namespace its routes
+// inherit and, if they changed, passes the routes of the namespace down
+// again with their new defaults.
+func (p *NamespaceDefaults) HandleNamespace(eventType watch.EventType, ns *kapi.Namespace) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var defaults map[string]string
+	if eventType != watch.Deleted {
+		for key, value := range ns.Annotations {
+			if p.annotations.Has(key) {
+				if defaults == nil {
+					defaults = make(map[string]string)
+				}
+				defaults[key] = value
+			}
+		}
+	}
+	if reflect.DeepEqual(defaults, p.defaults[ns.Name]) {
+		return
+	}
+	log.V(4).Info("namespace route defaults changed", "namespace", ns.Name, "defaults", defaults)
+	if defaults == nil {
+		delete(p.defaults, ns.Name)
+	} else {
+		p.defaults[ns.Name] = defaults
+	}
+
+	routes := p.routes[ns.Name]
+	for _, route := range routes {
+		if err := p.plugin.HandleRoute(watch.Modified, p.withDefaults(route)); err != nil {
+			utilruntime.HandleError(err)
+		}
+	}
+	if len(routes) > 0 && p.committed {
+		if err := p.plugin.Commit(); err != nil {
+			utilruntime.HandleError(err)
+		}
+	}
+}
+
+// WithDefaults returns route with the annotations it does not set
+// defaulted to the ones of its namespace.  The route is not modified.
+func (p *NamespaceDefaults) WithDefaults(route *routev1.Route) *routev1.Route {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.withDefaults(route)
+}
+
+func (p *NamespaceDefaults) withDefaults(route *routev1.Route) *routev1.Route {
+	var defaulted *routev1.Route
+	for key, value := range p.defaults[route.Namespace] {
+		if _, ok := route.Annotations[key]; ok {
+			continue
+		}
+		if defaulted == nil {
+			defaulted = route.DeepCopy()
+			if defaulted.Annotations == nil {
+				defaulted.Annotations = make(map[string]string)
+			}
+		}
+		defaulted.Annotations[key] = value
+	}
+	if defaulted == nil {
+		return route
+	}
+	return defaulted
+}
+
+// HandleNode processes watch events on the Node resource.
+func (p *NamespaceDefaults) HandleNode(eventType watch.EventType, node *kapi.Node) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.plugin.HandleNode(eventType, node)
+}
+
+// HandleEndpoints processes watch events on the Endpoints resource.
+func (p *NamespaceDefaults) HandleEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.plugin.HandleEndpoints(eventType, endpoints)
+}
+
+// HandleRoute processes watch events on the Route resource.
+func (p *NamespaceDefaults) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	switch eventType {
+	case watch.Added, watch.Modified:
+		if _, ok := p.routes[route.Namespace]; !ok {
+			p.routes[route.Namespace] = make(map[string]*routev1.Route)
+		}
+		p.routes[route.Namespace][route.Name] = route
+	case watch.Deleted:
+		delete(p.routes[route.Namespace], route.Name)
+		if len(p.routes[route.Namespace]) == 0 {
+			delete(p.routes, route.Namespace)
+		}
+	}
+	return p.plugin.HandleRoute(eventType, p.withDefaults(route))
+}
+
+// HandleNamespaces limits the scope of valid routes to only those that match
+// the provided namespace list.
+func (p *NamespaceDefaults) HandleNamespaces(namespaces sets.String) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.plugin.HandleNamespaces(namespaces)
+}
+
+// Commit invokes the nested plugin to commit.
+func (p *NamespaceDefaults) Commit() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.committed = true
+	return p.plugin.Commit()
+}
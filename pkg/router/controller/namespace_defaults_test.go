@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"testing"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const timeoutAnnotation = "haproxy.router.openshift.io/timeout"
+
+// committingPlugin records the routes and commits passed to it.
+type committingPlugin struct {
+	fakePlugin
+	commits int
+}
+
+func (p *committingPlugin) Commit() error {
+	p.commits++
+	return nil
+}
+
+func TestNamespaceDefaults(t *testing.T) {
+	p := &committingPlugin{}
+	plugin := NewNamespaceDefaults(p, []string{timeoutAnnotation})
+
+	ns := &kapi.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ns",
+			Annotations: map[string]string{
+				timeoutAnnotation:  "30s",
+				"example.com/team": "a",
+			},
+		},
+	}
+	plugin.HandleNamespace(watch.Added, ns)
+
+	route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r"}}
+	if err := plugin.HandleRoute(watch.Added, route); err != nil {
+		t.Fatal(err)
+	}
+	if p.t != watch.Added || p.route.Annotations[timeoutAnnotation] != "30s" {
+		t.Errorf("expected the route to inherit the timeout of its namespace, got %v %v", p.t, p.route.Annotations)
+	}
+	if _, ok := p.route.Annotations["example.com/team"]; ok {
+		t.Errorf("expected the route not to inherit an annotation that is not configured, got %v", p.route.Annotations)
+	}
+	if len(route.Annotations) > 0 {
+		t.Errorf("expected the route to be left unmodified, got %v", route.Annotations)
+	}
+
+	other := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "other", Annotations: map[string]string{timeoutAnnotation: "5s"}}}
+	if err := plugin.HandleRoute(watch.Added, other); err != nil {
+		t.Fatal(err)
+	}
+	if p.route.Annotations[timeoutAnnotation] != "5s" {
+		t.Errorf("expected the annotation of the route to override the one of its namespace, got %v", p.route.Annotations)
+	}
+
+	// Namespace changes before the initial sync is committed are not
+	// committed.
+	ns.Annotations[timeoutAnnotation] = "1m"
+	plugin.HandleNamespace(watch.Modified, ns)
+	if p.commits != 0 {
+		t.Errorf("expected no commit before the initial sync, got %d", p.commits)
+	}
+	if err := plugin.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	ns.Annotations[timeoutAnnotation] = "2m"
+	p.route = nil
+	plugin.HandleNamespace(watch.Modified, ns)
+	if p.commits != 2 {
+		t.Errorf("expected the namespace change to be committed, got %d commits", p.commits)
+	}
+	if p.route == nil || p.t != watch.Modified {
+		t.Fatalf("expected the routes of the namespace to be handled again, got %v", p.t)
+	}
+	if p.route.Name == "r" && p.route.Annotations[timeoutAnnotation] != "2m" {
+		t.Errorf("expected the route to have the new default, got %v", p.route.Annotations)
+	}
+
+	// Changes to other annotations do not handle the routes again.
+	ns.Annotations["example.com/team"] = "b"
+	p.route = nil
+	plugin.HandleNamespace(watch.Modified, ns)
+	if p.route != nil || p.commits != 2 {
+		t.Errorf("expected an unrelated change to be ignored, got %v and %d commits", p.route, p.commits)
+	}
+
+	plugin.HandleNamespace(watch.Deleted, ns)
+	if err := plugin.HandleRoute(watch.Modified, route); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.route.Annotations[timeoutAnnotation]; ok {
+		t.Errorf("expected the defaults of a deleted namespace to be dropped, got %v", p.route.Annotations)
+	}
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+// IngressRemover removes the status a router recorded on a route.
+type IngressRemover interface {
+	RemoveRouteIngress(route *routev1.Route)
+}
+
+// RouteClassFilter implements the router.Plugin interface to serve only the
+// routes of the route classes of the router, so that routes can target a
+// shard explicitly instead of through label selectors.
+type RouteClassFilter struct {
+	// plugin is the next plugin in the chain.
+	plugin router.Plugin
+
+	// classes are the route classes the router serves.
+	classes sets.String
+
+	// remover, if set, removes the status of the router from the routes
+	// it no longer serves.
+	remover IngressRemover
+
+	// served are the routes relayed to the next plugin, by namespace and
+	// name.
+	served sets.String
+
+	// handoff is true if the routes that move to another class are served
+	// until a router of that class admits them.
+	handoff bool
+	// routerName is the name of the router in the status of the routes.
+	routerName string
+	// migrating are the served routes that moved to another class, by
+	// namespace and name.
+	migrating sets.String
+}
+
+// NewRouteClassFilter creates a plugin wrapper that relays the routes of the
+// given classes to the next plugin in the chain and ignores the others.  A
+// route that moves to another class is removed from the next plugin, after
+// another router admitted it if handoffs are enabled, and, if remover is
+// set, its status for this router is removed.
+func NewRouteClassFilter(plugin router.Plugin, classes []string, remover IngressRemover) *RouteClassFilter {
+	return &RouteClassFilter{
+		plugin:    plugin,
+		classes:   sets.NewString(classes...),
+		remover:   remover,
+		served:    sets.NewString(),
+		migrating: sets.NewString(),
+	}
+}
+
+// EnableHandoff keeps serving the routes that move to another class, with a
+// Migrating condition in the status of the router named routerName, until
+// another router admits them, so that they are served throughout the move.
+func (p *RouteClassFilter) EnableHandoff(routerName string) {
+	p.handoff = true
+	p.routerName = routerName
+}
+
+// HandleNode processes watch events on the Node resource.
+func (p *RouteClassFilter) HandleNode(eventType watch.EventType, node *kapi.Node) error {
+	return p.plugin.HandleNode(eventType, node)
+}
+
+// HandleEndpoints processes watch events on the Endpoints resource.
+func (p *RouteClassFilter) HandleEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) error {
+	return p.plugin.HandleEndpoints(eventType, endpoints)
+}
+
+// HandleRoute processes watch events on the Route resource.
+func (p *RouteClassFilter) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	key := route.Namespace + "/" + route.Name
+
+	// The migration is only ever set by this plugin.
+	if _, ok := route.Annotations[routeapihelpers.RouteMigratingAnnotation]; ok {
+		route = route.DeepCopy()
+		delete(route.Annotations, routeapihelpers.RouteMigratingAnnotation)
+	}
+
+	switch eventType {
+	case watch.Added, watch.Modified:
+		class, err := routeapihelpers.GetRouteClass(route)
+		if err == nil && p.classes.Has(class) {
+			p.served.Insert(key)
+			p.migrating.Delete(key)
+			break
+		}
+		if err == nil && p.handoff && p.served.Has(key) && !admittedByAnotherRouter(route, p.routerName) {
+			if !p.migrating.Has(key) {
+				log.V(0).Info("route moved to another class, serving it until a router of that class admits it", "namespace", route.Namespace, "name", route.Name, "class", class)
+				p.migrating.Insert(key)
+			}
+			route = route.DeepCopy()
+			if route.Annotations == nil {
+				route.Annotations = map[string]string{}
+			}
+			route.Annotations[routeapihelpers.RouteMigratingAnnotation] = class
+			return p.plugin.HandleRoute(eventType, route)
+		}
+		if err != nil {
+			log.V(4).Info("route ignored: invalid route class", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
+		} else if p.migrating.Has(key) {
+			log.V(0).Info("route admitted by a router of its new class, no longer serving it", "namespace", route.Namespace, "name", route.Name, "class", class)
+		} else {
+			log.V(4).Info("route ignored: not in a route class of the router", "namespace", route.Namespace, "name", route.Name, "class", class)
+		}
+		p.migrating.Delete(key)
+		if p.remover != nil {
+			p.remover.RemoveRouteIngress(route)
+		}
+		if !p.served.Has(key) {
+			return nil
+		}
+		p.served.Delete(key)
+		return p.plugin.HandleRoute(watch.Deleted, route)
+	case watch.Deleted:
+		if !p.served.Has(key) {
+			return nil
+		}
+		p.served.Delete(key)
+		p.migrating.Delete(key)
+	}
+
+	return p.plugin.HandleRoute(eventType, route)
+}
+
+// HandleNamespaces limits the scope of valid routes to only those that match
+// the provided namespace list, and forgets the served routes of the other
+// namespaces.
+func (p *RouteClassFilter) HandleNamespaces(namespaces sets.String) error {
+	for _, key := range p.served.UnsortedList() {
+		if namespace := strings.SplitN(key, "/", 2)[0]; !namespaces.Has(namespace) {
+			p.served.Delete(key)
+			p.migrating.Delete(key)
+		}
+	}
+	return p.plugin.HandleNamespaces(namespaces)
+}
+
+// Commit invokes the nested plugin to commit.
+func (p *RouteClassFilter) Commit() error {
+	return p.plugin.Commit()
+}
+
+// admittedByAnotherRouter returns whether a router other than the named one
+// admitted the route and is not migrating it away itself.
+func admittedByAnotherRouter(route *routev1.Route, routerName string) bool {
+	for i := range route.Status.Ingress {
+		ingress := &route.Status.Ingress[i]
+		if ingress.RouterName == routerName {
+			continue
+		}
+		admitted, migrating := findCondition(ingress, routev1.RouteAdmitted), findCondition(ingress, RouteMigrating)
+		if admitted != nil && admitted.Status == corev1.ConditionTrue && (migrating == nil || migrating.Status != corev1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
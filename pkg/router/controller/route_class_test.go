@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgotesting "k8s.io/client-go/testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+type fakeIngressRemover struct {
+	removed []string
+}
+
+func (r *fakeIngressRemover) RemoveRouteIngress(route *routev1.Route) {
+	r.removed = append(r.removed, route.Name)
+}
+
+func TestRouteClassFilter(t *testing.T) {
+	p := &fakePlugin{}
+	remover := &fakeIngressRemover{}
+	filter := NewRouteClassFilter(p, []string{routeapihelpers.DefaultRouteClass, "internal"}, remover)
+
+	route := func(class string) *routev1.Route {
+		route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r"}}
+		if len(class) > 0 {
+			route.Annotations = map[string]string{routeapihelpers.RouteClassAnnotation: class}
+		}
+		return route
+	}
+
+	tests := []struct {
+		name      string
+		eventType watch.EventType
+		route     *routev1.Route
+		expected  watch.EventType
+		removed   bool
+	}{
+		{
+			name:      "route of another class is ignored",
+			eventType: watch.Added,
+			route:     route("external"),
+			removed:   true,
+		},
+		{
+			name:      "deleting an ignored route",
+			eventType: watch.Deleted,
+			route:     route("external"),
+		},
+		{
+			name:      "route without a class",
+			eventType: watch.Added,
+			route:     route(""),
+			expected:  watch.Added,
+		},
+		{
+			name:      "route moved to another class served by the router",
+			eventType: watch.Modified,
+			route:     route("internal"),
+			expected:  watch.Modified,
+		},
+		{
+			name:      "route moved to a class not served by the router",
+			eventType: watch.Modified,
+			route:     route("external"),
+			expected:  watch.Deleted,
+			removed:   true,
+		},
+		{
+			name:      "route with an invalid class",
+			eventType: watch.Modified,
+			route:     route("Internal"),
+			removed:   true,
+		},
+		{
+			name:      "route moved back",
+			eventType: watch.Modified,
+			route:     route("internal"),
+			expected:  watch.Modified,
+		},
+		{
+			name:      "deleting a served route",
+			eventType: watch.Deleted,
+			route:     route("internal"),
+			expected:  watch.Deleted,
+		},
+	}
+
+	for _, tc := range tests {
+		p.t, p.route = "", nil
+		remover.removed = nil
+		if err := filter.HandleRoute(tc.eventType, tc.route); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if p.t != tc.expected {
+			t.Errorf("%s: expected the next plugin to receive %q, got %q", tc.name, tc.expected, p.t)
+		}
+		if removed := len(remover.removed) > 0; removed != tc.removed {
+			t.Errorf("%s: expected the ingress to be removed: %v", tc.name, tc.removed)
+		}
+	}
+}
+
+func TestRouteClassFilterHandleNamespaces(t *testing.T) {
+	p := &recordingPlugin{}
+	filter := NewRouteClassFilter(p, []string{routeapihelpers.DefaultRouteClass}, nil)
+	route := func(namespace string) *routev1.Route {
+		return &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "r"}}
+	}
+	for _, namespace := range []string{"a", "b"} {
+		if err := filter.HandleRoute(watch.Added, route(namespace)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := filter.HandleNamespaces(sets.NewString("b")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := sets.NewString("b/r"); !filter.served.Equal(expected) {
+		t.Errorf("expected the served routes %v, got %v", expected.List(), filter.served.List())
+	}
+
+	// The routes of a namespace out of scope are no longer relayed when
+	// they move to another class.
+	p.routes = nil
+	moved := route("a")
+	moved.Annotations = map[string]string{routeapihelpers.RouteClassAnnotation: "external"}
+	if err := filter.HandleRoute(watch.Modified, moved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.routes) > 0 {
+		t.Errorf("expected the route of a namespace out of scope not to be relayed, got %v", p.routes)
+	}
+}
+
+func TestStatusRemoveRouteIngress(t *testing.T) {
+	p := &fakePlugin{}
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec:       routev1.RouteSpec{Host: "route1.test.local"},
+		Status: routev1.RouteStatus{
+			Ingress: []routev1.RouteIngress{
+				{RouterName: "other", Host: "route1.test.local"},
+				{RouterName: "test", Host: "route1.test.local"},
+			},
+		},
+	}
+	c := fake.NewSimpleClientset(route)
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+
+	admitter.RemoveRouteIngress(route)
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	if len(obj.Status.Ingress) != 1 || obj.Status.Ingress[0].RouterName != "other" {
+		t.Fatalf("expected only the ingress of the other router to remain: %#v", obj.Status.Ingress)
+	}
+	if len(route.Status.Ingress) != 2 {
+		t.Fatalf("expected the cached route to be left alone: %#v", route.Status.Ingress)
+	}
+
+	// routes without an ingress of the router are left alone
+	admitter.RemoveRouteIngress(obj)
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+
+	// only the elected status writer removes the ingress
+	admitter.EnableLeaderElection()
+	admitter.RemoveRouteIngress(route)
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+}
+
+func TestRouteClassFilterHandoff(t *testing.T) {
+	p := &fakePlugin{}
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec:       routev1.RouteSpec{Host: "route1.test.local"},
+	}
+	c := fake.NewSimpleClientset(route)
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	filter := NewRouteClassFilter(admitter, []string{routeapihelpers.DefaultRouteClass}, admitter)
+	filter.EnableHandoff("test")
+
+	update := func(eventType watch.EventType, route *routev1.Route) *routev1.Route {
+		t.Helper()
+		actions := len(c.Actions())
+		lister.items = []*routev1.Route{route}
+		if err := filter.HandleRoute(eventType, route); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(c.Actions()) != actions+1 {
+			t.Fatalf("expected the status to be updated: %#v", c.Actions())
+		}
+		obj := c.Actions()[actions].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+		lister.items = []*routev1.Route{obj}
+		return obj
+	}
+
+	obj := update(watch.Added, route)
+
+	// The route moves to another class and is still served.
+	moved := obj.DeepCopy()
+	moved.Annotations = map[string]string{routeapihelpers.RouteClassAnnotation: "internal"}
+	obj = update(watch.Modified, moved)
+	if p.t != watch.Modified || p.route.Annotations[routeapihelpers.RouteMigratingAnnotation] != "internal" {
+		t.Fatalf("expected the route to be served while migrating, got %q %#v", p.t, p.route.Annotations)
+	}
+	ingress := findIngressForRoute(obj, "test")
+	if condition := findCondition(ingress, RouteMigrating); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected a true migrating condition: %#v", ingress.Conditions)
+	}
+
+	// A router migrating the route away as well does not take it over.
+	obj = obj.DeepCopy()
+	obj.Status.Ingress = append(obj.Status.Ingress, routev1.RouteIngress{
+		RouterName: "old",
+		Host:       obj.Spec.Host,
+		Conditions: []routev1.RouteIngressCondition{
+			{Type: routev1.RouteAdmitted, Status: corev1.ConditionTrue},
+			{Type: RouteMigrating, Status: corev1.ConditionTrue},
+		},
+	})
+	lister.items = []*routev1.Route{obj}
+	p.t, p.route = "", nil
+	if err := filter.HandleRoute(watch.Modified, obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.t != watch.Modified {
+		t.Fatalf("expected the route to still be served, got %q", p.t)
+	}
+
+	// Once a router of the new class admits the route, it is removed.
+	obj = obj.DeepCopy()
+	obj.Status.Ingress = append(obj.Status.Ingress, routev1.RouteIngress{
+		RouterName: "internal",
+		Host:       obj.Spec.Host,
+		Conditions: []routev1.RouteIngressCondition{{Type: routev1.RouteAdmitted, Status: corev1.ConditionTrue}},
+	})
+	obj = update(watch.Modified, obj)
+	if p.t != watch.Deleted {
+		t.Fatalf("expected the route to be removed, got %q", p.t)
+	}
+	if findIngressForRoute(obj, "test") != nil {
+		t.Fatalf("expected the ingress of the router to be removed: %#v", obj.Status.Ingress)
+	}
+	if filter.migrating.Len() != 0 || filter.served.Len() != 0 {
+		t.Fatalf("expected the route to be forgotten, got %v and %v", filter.migrating.List(), filter.served.List())
+	}
+}
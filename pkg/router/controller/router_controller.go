@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,10 +17,12 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	utilwait "k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/workqueue"
 
 	logf "github.com/openshift/router/log"
 	"github.com/openshift/router/pkg/router"
 	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+	"github.com/openshift/router/pkg/router/telemetry"
 )
 
 var log = logf.Logger.WithName("controller")
@@ -32,6 +35,10 @@ type RouterController struct {
 	Plugin router.Plugin
 
 	firstSyncDone bool
+	// routesSynced and endpointsSynced are true once the existing routes
+	// and endpoints were passed to the plugin.
+	routesSynced    bool
+	endpointsSynced bool
 
 	FilteredNamespaceNames sets.String
 	NamespaceLabels        labels.Selector
@@ -47,6 +54,30 @@ type RouterController struct {
 	ProjectRetries      int
 
 	WatchNodes bool
+
+	// Zone, if set, is the zone the router runs in. The ready endpoints
+	// that do not serve this zone are annotated, unless none of them
+	// serve it, for the plugin to only send them traffic as a fallback.
+	Zone string
+
+	// SubdomainHosts, if set, generates the host of the routes with a
+	// subdomain from the domain of the router.
+	SubdomainHosts *SubdomainHosts
+
+	// RouteRetries, if set, paces handling again the routes the plugin
+	// failed to handle with a retriable error.
+	RouteRetries workqueue.RateLimiter
+	// RouteErrors, if set, records the errors the plugin failed to handle
+	// routes with.
+	RouteErrors RouteErrorRecorder
+	// retries holds the keys of the routes to handle again, each at most
+	// once, and retrying the route each key was last queued for.
+	retries  workqueue.DelayingInterface
+	retrying map[string]*routev1.Route
+
+	// Events, if set, records the most recent events and what the plugin
+	// did with them.
+	Events *EventHistory
 }
 
 // Run begins watching and syncing.
@@ -189,6 +220,7 @@ func (c *RouterController) HandleNamespace(eventType watch.EventType, obj interf
 
 	log.V(4).Info("processing namespace", "namespace", ns.Name, "event", eventType)
 
+	c.Events.RecordNamespace(eventType, ns)
 	c.processNamespace(eventType, ns)
 	c.Commit()
 }
@@ -201,7 +233,9 @@ func (c *RouterController) HandleNode(eventType watch.EventType, obj interface{}
 
 	log.V(4).Info("processing node", "node", node.Name, "event", eventType)
 
-	if err := c.Plugin.HandleNode(eventType, node); err != nil {
+	err := c.Plugin.HandleNode(eventType, node)
+	c.Events.RecordNode(eventType, node, err)
+	if err != nil {
 		utilruntime.HandleError(err)
 	}
 }
@@ -209,6 +243,12 @@ func (c *RouterController) HandleNode(eventType watch.EventType, obj interface{}
 // HandleRoute handles a single Route event and synchronizes the router backend.
 func (c *RouterController) HandleRoute(eventType watch.EventType, obj interface{}) {
 	route := obj.(*routev1.Route)
+	if c.SubdomainHosts != nil && c.SubdomainHosts.Outdated(route) {
+		// The route is shared with the informer cache, and its host was
+		// generated before the domain of the router changed.
+		route = route.DeepCopy()
+		c.SubdomainHosts.UpdateRoute(route)
+	}
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
@@ -223,7 +263,11 @@ func (c *RouterController) HandleEndpoints(eventType watch.EventType, obj interf
 	defer c.lock.Unlock()
 
 	c.RecordNamespaceEndpoints(eventType, endpoints)
-	if err := c.Plugin.HandleEndpoints(eventType, endpoints); err != nil {
+	span := telemetry.StartEvent("Endpoints", string(eventType), endpoints.Namespace, endpoints.Name)
+	err := c.Plugin.HandleEndpoints(eventType, endpoints)
+	span.End(err)
+	c.Events.RecordEndpoints(eventType, endpoints, err)
+	if err != nil {
 		utilruntime.HandleError(err)
 	}
 	c.Commit()
@@ -241,6 +285,22 @@ func (c *RouterController) HandleEndpointSlice(eventType watch.EventType, objMet
 		},
 		Subsets: endpointsubset.ConvertEndpointSlice(items, endpointsubset.DefaultEndpointAddressOrderByFuncs(), endpointsubset.DefaultEndpointPortOrderByFuncs()),
 	}
+	// The annotations of the EndpointSlice are shared with the informer
+	// cache.
+	zones, otherZones := endpointsubset.Zones(items), endpointsubset.OtherZoneAddresses(items, c.Zone)
+	if len(zones) > 0 || len(otherZones) > 0 {
+		annotations := make(map[string]string, len(objMeta.Annotations)+2)
+		for k, v := range objMeta.Annotations {
+			annotations[k] = v
+		}
+		if len(zones) > 0 {
+			annotations[endpointsubset.ZonesAnnotation] = zones
+		}
+		if len(otherZones) > 0 {
+			annotations[endpointsubset.OtherZonesAnnotation] = otherZones
+		}
+		endpoints.Annotations = annotations
+	}
 
 	// RecordNamespaceEndpoints and all HandleEndpoints
 	// implementations treat watch.Modified and watch.Added the
@@ -264,16 +324,152 @@ func (c *RouterController) Commit() {
 	}
 }
 
+// Resync passes the routes of the router and the endpoints of their
+// services down the plugin chain again, as if they had changed, and commits
+// them.  A namespace limits the resync to its routes, and a name to the route
+// of the namespace with that name.  It returns the number of routes that
+// were resynced.
+func (c *RouterController) Resync(namespace, name string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var routes []*routev1.Route
+	for ns, routeMap := range c.NamespaceRoutes {
+		if len(namespace) > 0 && ns != namespace {
+			continue
+		}
+		for _, route := range routeMap {
+			if len(name) > 0 && route.Name != name {
+				continue
+			}
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		return 0
+	}
+
+	services := sets.NewString()
+	for _, route := range routes {
+		services.Insert(route.Namespace + "/" + route.Spec.To.Name)
+		for _, backend := range route.Spec.AlternateBackends {
+			services.Insert(route.Namespace + "/" + backend.Name)
+		}
+	}
+	for ns, epMap := range c.NamespaceEndpoints {
+		for _, ep := range epMap {
+			if !services.Has(ns + "/" + ep.Name) {
+				continue
+			}
+			if err := c.Plugin.HandleEndpoints(watch.Modified, ep); err != nil {
+				utilruntime.HandleError(err)
+			}
+		}
+	}
+
+	// Process the routes in order of age to avoid rejections.
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].CreationTimestamp.Equal(&routes[j].CreationTimestamp) {
+			return routes[i].UID < routes[j].UID
+		}
+		return routes[i].CreationTimestamp.Before(&routes[j].CreationTimestamp)
+	})
+	for _, route := range routes {
+		c.processRoute(watch.Modified, route)
+	}
+	c.Commit()
+	return len(routes)
+}
+
 // processRoute logs and propagates a route event to the plugin
 func (c *RouterController) processRoute(eventType watch.EventType, route *routev1.Route) {
 	log.V(4).Info("processing route", "event", eventType, "route", route)
 
 	c.RecordNamespaceRoutes(eventType, route)
-	if err := c.Plugin.HandleRoute(eventType, route); err != nil {
+	span := telemetry.StartEvent("Route", string(eventType), route.Namespace, route.Name)
+	err := c.Plugin.HandleRoute(eventType, route)
+	span.End(err)
+	c.Events.RecordRoute(eventType, route, err)
+	if err != nil {
 		utilruntime.HandleError(err)
+		if c.RouteErrors != nil {
+			c.RouteErrors.RecordRouteError(route, err)
+		}
+	}
+	c.retryRoute(eventType, route, err)
+}
+
+// retryRoute schedules handling a route again if the plugin failed to handle
+// it with a retriable error, and forgets the past failures of a route the
+// plugin handled or rejected for good.  A route has at most one pending
+// retry, which is dropped if the route changes in the meantime, as the
+// change is handled instead.
+func (c *RouterController) retryRoute(eventType watch.EventType, route *routev1.Route, err error) {
+	if c.RouteRetries == nil {
+		return
+	}
+	key := route.Namespace + "/" + route.Name
+	if eventType == watch.Deleted || !router.IsRetriable(err) {
+		c.RouteRetries.Forget(key)
+		delete(c.retrying, key)
+		return
+	}
+
+	if c.retries == nil {
+		c.retries = workqueue.NewNamedDelayingQueue("route-retries")
+		c.retrying = make(map[string]*routev1.Route)
+		go c.runRetries()
+	}
+	delay := c.RouteRetries.When(key)
+	log.V(0).Info("retrying route", "route", key, "reason", router.ErrorReason(err), "delay", delay)
+	c.retrying[key] = route
+	c.retries.AddAfter(key, delay)
+}
+
+// runRetries handles again the routes whose retry is due, unless they
+// changed since their retry was queued.
+func (c *RouterController) runRetries() {
+	for {
+		item, shutdown := c.retries.Get()
+		if shutdown {
+			return
+		}
+		key := item.(string)
+		c.lock.Lock()
+		if route, ok := c.retrying[key]; ok && c.NamespaceRoutes[route.Namespace][route.Name] == route {
+			delete(c.retrying, key)
+			c.processRoute(watch.Modified, route)
+			c.Commit()
+		}
+		c.lock.Unlock()
+		c.retries.Done(item)
 	}
 }
 
+// MarkRoutesSynced records that the existing routes were passed to the
+// plugin.
+func (c *RouterController) MarkRoutesSynced() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.routesSynced = true
+}
+
+// MarkEndpointsSynced records that the existing endpoints were passed to the
+// plugin.
+func (c *RouterController) MarkEndpointsSynced() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.endpointsSynced = true
+}
+
+// Synced returns whether the existing routes and endpoints were passed to
+// the plugin.
+func (c *RouterController) Synced() (routes, endpoints bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.routesSynced, c.endpointsSynced
+}
+
 func (c *RouterController) handleFirstSync() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilwait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/workqueue"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+)
+
+// recordingPlugin records the routes and endpoints passed to it, and fails
+// to handle routes with errs in turn.
+type recordingPlugin struct {
+	routes    []string
+	endpoints []string
+	commits   int
+	errs      []error
+}
+
+func (p *recordingPlugin) HandleRoute(t watch.EventType, route *routev1.Route) error {
+	p.routes = append(p.routes, route.Namespace+"/"+route.Name)
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (p *recordingPlugin) HandleNode(watch.EventType, *kapi.Node) error {
+	return nil
+}
+
+func (p *recordingPlugin) HandleEndpoints(t watch.EventType, endpoints *kapi.Endpoints) error {
+	p.endpoints = append(p.endpoints, endpoints.Namespace+"/"+endpoints.Name)
+	return nil
+}
+
+func (p *recordingPlugin) HandleNamespaces(sets.String) error {
+	return nil
+}
+
+func (p *recordingPlugin) Commit() error {
+	p.commits++
+	return nil
+}
+
+func TestRouterControllerResync(t *testing.T) {
+	now := time.Now()
+	route := func(namespace, name, service string, age time.Duration) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+			Spec:       routev1.RouteSpec{To: routev1.RouteTargetReference{Name: service}},
+		}
+	}
+	endpoints := func(namespace, name string) *kapi.Endpoints {
+		return &kapi.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	testCases := []struct {
+		name              string
+		namespace         string
+		route             string
+		expectedRoutes    []string
+		expectedEndpoints []string
+	}{
+		{
+			name:              "all routes",
+			expectedRoutes:    []string{"a/old", "b/r", "a/new"},
+			expectedEndpoints: []string{"a/svc", "b/svc"},
+		},
+		{
+			name:              "namespace",
+			namespace:         "a",
+			expectedRoutes:    []string{"a/old", "a/new"},
+			expectedEndpoints: []string{"a/svc"},
+		},
+		{
+			name:              "route",
+			namespace:         "b",
+			route:             "r",
+			expectedRoutes:    []string{"b/r"},
+			expectedEndpoints: []string{"b/svc"},
+		},
+		{
+			name:      "no matching route",
+			namespace: "c",
+		},
+	}
+	for _, tc := range testCases {
+		plugin := &recordingPlugin{}
+		c := &RouterController{
+			Plugin:             plugin,
+			firstSyncDone:      true,
+			NamespaceRoutes:    make(map[string]map[string]*routev1.Route),
+			NamespaceEndpoints: make(map[string]map[string]*kapi.Endpoints),
+		}
+		c.RecordNamespaceRoutes(watch.Added, route("a", "new", "svc", time.Minute))
+		c.RecordNamespaceRoutes(watch.Added, route("a", "old", "svc", time.Hour))
+		c.RecordNamespaceRoutes(watch.Added, route("b", "r", "svc", 30*time.Minute))
+		c.RecordNamespaceEndpoints(watch.Added, endpoints("a", "svc"))
+		c.RecordNamespaceEndpoints(watch.Added, endpoints("a", "unused"))
+		c.RecordNamespaceEndpoints(watch.Added, endpoints("b", "svc"))
+
+		if count := c.Resync(tc.namespace, tc.route); count != len(tc.expectedRoutes) {
+			t.Errorf("%s: expected %d routes, got %d", tc.name, len(tc.expectedRoutes), count)
+		}
+		if !reflect.DeepEqual(plugin.routes, tc.expectedRoutes) {
+			t.Errorf("%s: expected the routes %v in order of age, got %v", tc.name, tc.expectedRoutes, plugin.routes)
+		}
+		if !sets.NewString(plugin.endpoints...).Equal(sets.NewString(tc.expectedEndpoints...)) {
+			t.Errorf("%s: expected the endpoints %v, got %v", tc.name, tc.expectedEndpoints, plugin.endpoints)
+		}
+		if expected := len(tc.expectedRoutes) > 0; (plugin.commits == 1) != expected {
+			t.Errorf("%s: expected a commit %t, got %d commits", tc.name, expected, plugin.commits)
+		}
+	}
+}
+
+func TestRouterControllerRetryRoute(t *testing.T) {
+	transient := router.NewRetriableRouteError("CheckFailed", "unable to check the route", fmt.Errorf("timed out"))
+	plugin := &recordingPlugin{errs: []error{transient, transient, router.NewRouteError("Invalid", "invalid route")}}
+	c := &RouterController{
+		Plugin:             plugin,
+		firstSyncDone:      true,
+		NamespaceRoutes:    make(map[string]map[string]*routev1.Route),
+		NamespaceEndpoints: make(map[string]map[string]*kapi.Endpoints),
+		RouteRetries:       workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond),
+	}
+
+	// The route is handled again until the plugin fails with a permanent
+	// error.
+	route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r"}}
+	c.HandleRoute(watch.Added, route)
+	err := utilwait.PollImmediate(time.Millisecond, 5*time.Second, func() (bool, error) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return len(plugin.routes) == 3, nil
+	})
+	if err != nil {
+		t.Fatalf("expected the route to be handled 3 times, got %v", plugin.routes)
+	}
+	c.lock.Lock()
+	if n := c.RouteRetries.NumRequeues("ns/r"); n != 0 {
+		t.Errorf("expected the retries of the route to be forgotten, got %d", n)
+	}
+	c.lock.Unlock()
+
+	// A retry of a route that changed meanwhile is dropped.
+	plugin.errs = []error{transient}
+	c.RouteRetries = workqueue.NewItemExponentialFailureRateLimiter(100*time.Millisecond, 100*time.Millisecond)
+	c.HandleRoute(watch.Modified, route)
+	c.HandleRoute(watch.Modified, route.DeepCopy())
+	time.Sleep(200 * time.Millisecond)
+	c.lock.Lock()
+	if len(plugin.routes) != 5 {
+		t.Errorf("expected the stale retry to be dropped, got %v", plugin.routes)
+	}
+	c.lock.Unlock()
+
+	// A route failing again before its retry is due has a single pending
+	// retry, and its errors are recorded.
+	errs := &recordingRouteErrors{}
+	plugin.errs = []error{transient, transient}
+	c.RouteErrors = errs
+	changed := route.DeepCopy()
+	c.HandleRoute(watch.Modified, changed)
+	c.HandleRoute(watch.Modified, changed)
+	time.Sleep(300 * time.Millisecond)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(plugin.routes) != 8 {
+		t.Errorf("expected a single retry of the route, got %v", plugin.routes)
+	}
+	if len(errs.reasons) != 2 || errs.reasons[0] != "CheckFailed" {
+		t.Errorf("expected the retriable errors to be recorded, got %v", errs.reasons)
+	}
+}
+
+type recordingRouteErrors struct {
+	reasons []string
+}
+
+func (r *recordingRouteErrors) RecordRouteError(route *routev1.Route, err error) {
+	r.reasons = append(r.reasons, router.ErrorReason(err))
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// RouteServiceNotFound is the condition reported on admitted routes whose
+// services do not exist, or do not have the port the route targets by
+// name, so that requests to them fail with a 503.  It is true with the
+// missing services and ports until they all exist, when it is set to false.
+const RouteServiceNotFound routev1.RouteIngressConditionType = "ServiceNotFound"
+
+// serviceCheck tracks the services of the namespaces of the admitted routes
+// to report their ServiceNotFound condition.
+type serviceCheck struct {
+	// services are the names of the ports of the services, keyed by
+	// namespace/name.
+	services map[string]sets.String
+	// routes are the admitted routes, keyed by namespace/name.
+	routes map[string]*routev1.Route
+	// serviceRoutes are the keys of the routes of each service.
+	serviceRoutes map[string]sets.String
+	// pending are the keys of the routes to report on the next commit.
+	pending sets.String
+	// missing are the keys of the routes reported with missing services or
+	// ports.
+	missing sets.String
+}
+
+// EnableServiceCheck makes the admitter report a ServiceNotFound condition
+// on the admitted routes whose services do not exist, or do not have the
+// port the route targets by name.  The services are given to HandleService,
+// or watched with WatchServices.
+func (a *StatusAdmitter) EnableServiceCheck() {
+	a.servicesLock.Lock()
+	defer a.servicesLock.Unlock()
+	a.services = &serviceCheck{
+		services:      make(map[string]sets.String),
+		routes:        make(map[string]*routev1.Route),
+		serviceRoutes: make(map[string]sets.String),
+		pending:       sets.NewString(),
+		missing:       sets.NewString(),
+	}
+}
+
+// WatchServices watches the services of informer, which the router already
+// watches its services with, and returns once they have all been listed so
+// that the routes of the initial sync are checked against them.
+func (a *StatusAdmitter) WatchServices(informer cache.SharedInformer, stopCh <-chan struct{}) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			a.HandleService(watch.Added, obj.(*kapi.Service))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			a.HandleService(watch.Modified, obj.(*kapi.Service))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if svc, ok := obj.(*kapi.Service); ok {
+				a.HandleService(watch.Deleted, svc)
+			}
+		},
+	})
+	// The handler is given the services the informer already holds in the
+	// background, record them now.
+	cache.WaitForCacheSync(stopCh, informer.HasSynced)
+	for _, obj := range informer.GetStore().List() {
+		if svc, ok := obj.(*kapi.Service); ok {
+			a.HandleService(watch.Added, svc)
+		}
+	}
+}
+
+// HandleService records the ports of a service and marks the routes of the
+// service to be reported on the next commit if they changed.
+func (a *StatusAdmitter) HandleService(eventType watch.EventType, svc *kapi.Service) {
+	a.servicesLock.Lock()
+	defer a.servicesLock.Unlock()
+	if a.services != nil {
+		a.services.recordService(eventType, svc)
+	}
+}
+
+// recordService updates the ports of a service and marks the routes whose
+// services changed to be reported.
+func (c *serviceCheck) recordService(eventType watch.EventType, svc *kapi.Service) {
+	key := svc.Namespace + "/" + svc.Name
+	old, existed := c.services[key]
+	var ports sets.String
+	if eventType == watch.Deleted {
+		delete(c.services, key)
+	} else {
+		ports = sets.NewString()
+		for _, port := range svc.Spec.Ports {
+			if len(port.Name) > 0 {
+				ports.Insert(port.Name)
+			}
+		}
+		c.services[key] = ports
+	}
+	if existed == (eventType != watch.Deleted) && old.Equal(ports) {
+		return
+	}
+	for routeKey := range c.serviceRoutes[key] {
+		c.pending.Insert(routeKey)
+	}
+}
+
+// recordRoute tracks the services of an admitted route, or forgets the
+// route if it is no longer admitted.
+func (c *serviceCheck) recordRoute(route *routev1.Route, admitted bool) {
+	key := routeNameKey(route)
+	if old, ok := c.routes[key]; ok {
+		for _, service := range routeServices(old) {
+			if routes, ok := c.serviceRoutes[service]; ok {
+				routes.Delete(key)
+				if routes.Len() == 0 {
+					delete(c.serviceRoutes, service)
+				}
+			}
+		}
+		delete(c.routes, key)
+	}
+	if !admitted {
+		c.pending.Delete(key)
+		c.missing.Delete(key)
+		return
+	}
+	c.routes[key] = route
+	for _, service := range routeServices(route) {
+		if _, ok := c.serviceRoutes[service]; !ok {
+			c.serviceRoutes[service] = sets.NewString()
+		}
+		c.serviceRoutes[service].Insert(key)
+	}
+}
+
+// conditions returns the ServiceNotFound condition to report on a route, if
+// any.  The condition is only reported as false to clear one the router
+// reported before, so that the status of routes whose services exist is
+// left alone.
+func (c *serviceCheck) conditions(route *routev1.Route, routerName string) []routev1.RouteIngressCondition {
+	key := routeNameKey(route)
+	var services, ports []string
+	for _, service := range routeServices(route) {
+		name := service[strings.Index(service, "/")+1:]
+		servicePorts, ok := c.services[service]
+		switch {
+		case !ok:
+			services = append(services, name)
+		case route.Spec.Port != nil && route.Spec.Port.TargetPort.Type == intstr.String && !servicePorts.Has(route.Spec.Port.TargetPort.StrVal):
+			ports = append(ports, name)
+		}
+	}
+
+	if len(services) == 0 && len(ports) == 0 {
+		wasReported := c.missing.Has(key) || reported(route, routerName, RouteServiceNotFound, corev1.ConditionTrue)
+		c.missing.Delete(key)
+		if !wasReported {
+			return nil
+		}
+		return []routev1.RouteIngressCondition{{Type: RouteServiceNotFound, Status: corev1.ConditionFalse}}
+	}
+
+	c.missing.Insert(key)
+	var messages []string
+	reason := reasons.TargetPortNotFound
+	if len(services) > 0 {
+		reason = reasons.ServiceNotFound
+		messages = append(messages, fmt.Sprintf("services not found in namespace %s: %s", route.Namespace, strings.Join(services, ", ")))
+	}
+	if len(ports) > 0 {
+		messages = append(messages, fmt.Sprintf("target port %s is not a port of services: %s", route.Spec.Port.TargetPort.StrVal, strings.Join(ports, ", ")))
+	}
+	return []routev1.RouteIngressCondition{{
+		Type:    RouteServiceNotFound,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: strings.Join(messages, "; "),
+	}}
+}
+
+// serviceConditions records an admitted route and returns the
+// ServiceNotFound condition to report on it, if any.
+func (a *StatusAdmitter) serviceConditions(route *routev1.Route) []routev1.RouteIngressCondition {
+	a.servicesLock.Lock()
+	defer a.servicesLock.Unlock()
+	if a.services == nil {
+		return nil
+	}
+	a.services.recordRoute(route, true)
+	a.services.pending.Delete(routeNameKey(route))
+	return a.services.conditions(route, a.routerName)
+}
+
+// forgetServices stops reporting the ServiceNotFound condition on a route
+// that is no longer admitted.
+func (a *StatusAdmitter) forgetServices(route *routev1.Route) {
+	a.servicesLock.Lock()
+	defer a.servicesLock.Unlock()
+	if a.services != nil {
+		a.services.recordRoute(route, false)
+	}
+}
+
+// reportServices reports the ServiceNotFound condition of the routes whose
+// services changed since the last commit.
+func (a *StatusAdmitter) reportServices() {
+	type update struct {
+		route      *routev1.Route
+		conditions []routev1.RouteIngressCondition
+	}
+	var updates []update
+
+	a.servicesLock.Lock()
+	if a.services == nil {
+		a.servicesLock.Unlock()
+		return
+	}
+	for key := range a.services.pending {
+		if route, ok := a.services.routes[key]; ok {
+			if conditions := a.services.conditions(route, a.routerName); len(conditions) > 0 {
+				updates = append(updates, update{route: route, conditions: conditions})
+			}
+		}
+	}
+	a.services.pending = sets.NewString()
+	a.servicesLock.Unlock()
+
+	for _, update := range updates {
+		conditions := append(append(a.standbyConditions(), a.annotationConditions(update.route)...), update.conditions...)
+		a.updateCondition("services", update.route, admittedCondition(update.route), conditions...)
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	clientgotesting "k8s.io/client-go/testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+)
+
+func TestStatusServiceCheck(t *testing.T) {
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec: routev1.RouteSpec{
+			Host:              "route1.test.local",
+			To:                routev1.RouteTargetReference{Kind: "Service", Name: "svc1"},
+			AlternateBackends: []routev1.RouteTargetReference{{Kind: "Service", Name: "svc2"}},
+			Port:              &routev1.RoutePort{TargetPort: intstr.FromString("http")},
+		},
+	}
+	service := func(name string, ports ...string) *kapi.Service {
+		svc := &kapi.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		for i, port := range ports {
+			svc.Spec.Ports = append(svc.Spec.Ports, kapi.ServicePort{Name: port, Port: int32(8080 + i)})
+		}
+		return svc
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(&recordingPlugin{}, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableServiceCheck()
+
+	lastServiceCondition := func(expectedActions int) *routev1.RouteIngressCondition {
+		t.Helper()
+		if len(c.Actions()) != expectedActions {
+			t.Fatalf("expected %d actions, got %#v", expectedActions, c.Actions())
+		}
+		obj := c.Actions()[expectedActions-1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+		lister.items = []*routev1.Route{obj}
+		ingress := &obj.Status.Ingress[0]
+		if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+			t.Fatalf("expected the route to be admitted: %#v", ingress.Conditions)
+		}
+		return findCondition(ingress, RouteServiceNotFound)
+	}
+
+	// a missing service is reported when the route is admitted
+	admitter.HandleService(watch.Added, service("svc1", "http"))
+	admitter.HandleRoute(watch.Added, route)
+	condition := lastServiceCondition(1)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != "ServiceNotFound" || condition.Message != "services not found in namespace default: svc2" {
+		t.Fatalf("expected a true service condition: %#v", condition)
+	}
+
+	// a service without the target port is reported on the next commit
+	admitter.HandleService(watch.Added, service("svc2", "web"))
+	admitter.Commit()
+	condition = lastServiceCondition(2)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != "TargetPortNotFound" || condition.Message != "target port http is not a port of services: svc2" {
+		t.Fatalf("expected a true service condition: %#v", condition)
+	}
+
+	// the condition is cleared once the services have the target port
+	admitter.HandleService(watch.Modified, service("svc2", "web", "http"))
+	admitter.Commit()
+	if condition := lastServiceCondition(3); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false service condition: %#v", condition)
+	}
+
+	// routes whose services exist are not updated
+	admitter.HandleService(watch.Modified, service("svc1", "http", "metrics"))
+	admitter.Commit()
+	lastServiceCondition(3)
+
+	// nor are routes that are no longer admitted
+	admitter.RecordRouteRejection(route, "Rejected", "")
+	admitter.HandleService(watch.Deleted, service("svc1"))
+	admitter.Commit()
+	if len(c.Actions()) != 4 {
+		t.Fatalf("expected only the rejection to be recorded, got %#v", c.Actions())
+	}
+}
+
+func TestStatusWatchServicesSharesInformer(t *testing.T) {
+	kc := kfake.NewSimpleClientset(&kapi.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc1", Namespace: "default"},
+		Spec:       kapi.ServiceSpec{Ports: []kapi.ServicePort{{Name: "http", Port: 8080}}},
+	})
+	informer := informers.NewSharedInformerFactory(kc, 0).Core().V1().Services().Informer()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go informer.Run(stopCh)
+
+	admitter := NewStatusAdmitter(&recordingPlugin{}, fake.NewSimpleClientset().RouteV1(), &routeLister{}, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableServiceCheck()
+	// the informer is already running when the admitter starts watching
+	// it, the services it holds are recorded before WatchServices returns.
+	admitter.WatchServices(informer, stopCh)
+	if ports, ok := admitter.services.services["default/svc1"]; !ok || !ports.Has("http") {
+		t.Fatalf("expected the service of the informer to be recorded, got %v", admitter.services.services)
+	}
+}
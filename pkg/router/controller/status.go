@@ -3,12 +3,17 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	kapi "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/watch"
@@ -17,6 +22,8 @@ import (
 	client "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 	routelisters "github.com/openshift/client-go/route/listers/route/v1"
 	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 	"github.com/openshift/router/pkg/router/writerlease"
 )
 
@@ -34,6 +41,37 @@ func (logRecorder) RecordRouteRejection(route *routev1.Route, reason, message st
 	log.V(3).Info("rejected route", "name", route.Name, "namespace", route.Namespace, "reason", reason, "message", message)
 }
 
+// RouteStandby is the condition a standby router reports on the routes it
+// admits.  It is true until the router is promoted and starts serving them.
+const RouteStandby routev1.RouteIngressConditionType = "Standby"
+
+// RouteMigrating is the condition a router reports on the routes that moved
+// to a route class it does not serve while it keeps serving them until a
+// router of that class admits them.
+const RouteMigrating routev1.RouteIngressConditionType = "Migrating"
+
+// RouteTCPPortAllocated is the condition a router reports on the TCP routes
+// it allocated a dedicated port.  Its message is the port number alone, from
+// which the router allocates the same port to the route when it restarts.
+const RouteTCPPortAllocated routev1.RouteIngressConditionType = "TCPPortAllocated"
+
+// RouteAnnotationWarnings is the condition reported on routes with haproxy
+// router annotations that are unknown, and so have no effect, or that are
+// deprecated.  It lists the offending annotations.
+const RouteAnnotationWarnings routev1.RouteIngressConditionType = "AnnotationWarnings"
+
+// RouteRetrying is the condition reported on routes the router failed to
+// handle with a retriable error, with the reason of the error.  The router
+// handles them again later, and clears the condition once it admits or
+// rejects them.
+const RouteRetrying routev1.RouteIngressConditionType = "Retrying"
+
+// RouteErrorRecorder records the errors the router failed to handle routes
+// with, which the recorder tells apart by router.IsRetriable.
+type RouteErrorRecorder interface {
+	RecordRouteError(route *routev1.Route, err error)
+}
+
 // StatusAdmitter ensures routes added to the plugin have status set.
 type StatusAdmitter struct {
 	plugin router.Plugin
@@ -45,6 +83,67 @@ type StatusAdmitter struct {
 
 	lease   writerlease.Lease
 	tracker ContentionTracker
+
+	// sinks additionally receive the admission state of routes.
+	sinks []StatusSink
+	// rejectedLock protects rejected.
+	rejectedLock sync.Mutex
+	// rejected are the resource versions of the routes just rejected,
+	// keyed by route UID.  The plugins that reject a route delete it from
+	// the plugins they wrap, which is not a deletion of the route for the
+	// sinks.
+	rejected map[types.UID]string
+
+	// standbyLock protects standby.
+	standbyLock sync.Mutex
+	// standby is nil unless the router reports the Standby condition, in
+	// which case it is true until the router is promoted.
+	standby *bool
+
+	// annotationWarnings reports the AnnotationWarnings condition.
+	annotationWarnings bool
+
+	// backendsLock protects backends.
+	backendsLock sync.Mutex
+	// backends is nil unless the router reports the BackendsAvailable
+	// condition.
+	backends *backendAvailability
+
+	// certificatesLock protects certificates.
+	certificatesLock sync.Mutex
+	// certificates is nil unless the router reports the
+	// CertificateWarnings condition.
+	certificates *certificateMonitor
+
+	// servicesLock protects services.
+	servicesLock sync.Mutex
+	// services is nil unless the router reports the ServiceNotFound
+	// condition.
+	services *serviceCheck
+
+	// reportedLock protects reported.
+	reportedLock sync.Mutex
+	// reported is nil unless the status of routes is reconciled, in which
+	// case it holds the conditions last reported on each route, keyed by
+	// route UID.
+	reported map[types.UID]*reportedConditions
+
+	// writerLock protects writer and deferred.
+	writerLock sync.Mutex
+	// writer is nil unless status writes are leader elected, in which case
+	// it is true while this router is the elected status writer.
+	writer *bool
+	// deferred are the latest status updates of each route skipped while
+	// this router is not the elected status writer, keyed by route UID.
+	deferred map[types.UID]deferredStatusUpdate
+}
+
+// deferredStatusUpdate is a status update skipped because another router is
+// the elected status writer.
+type deferredStatusUpdate struct {
+	action     string
+	route      *routev1.Route
+	conditions []routev1.RouteIngressCondition
 }
 
 // NewStatusAdmitter creates a plugin wrapper that ensures every accepted
@@ -74,16 +173,337 @@ func getRfc3339Timestamp() metav1.Time {
 // nowFn allows the package to be tested
 var nowFn = getRfc3339Timestamp
 
+// AddStatusSink publishes the admission state of routes to sink in addition
+// to the route status.
+func (a *StatusAdmitter) AddStatusSink(sink StatusSink) {
+	a.sinks = append(a.sinks, sink)
+}
+
+// EnableLeaderElection restricts status writes to the periods between
+// StartWriting and StopWriting.  Updates made in between are deferred and
+// written once this router is elected as the status writer.
+func (a *StatusAdmitter) EnableLeaderElection() {
+	a.writerLock.Lock()
+	defer a.writerLock.Unlock()
+	writer := false
+	a.writer = &writer
+	a.deferred = make(map[types.UID]deferredStatusUpdate)
+}
+
+// StartWriting makes this router the status writer and writes the updates
+// deferred while another router was.
+func (a *StatusAdmitter) StartWriting() {
+	a.writerLock.Lock()
+	if a.writer == nil || *a.writer {
+		a.writerLock.Unlock()
+		return
+	}
+	log.V(0).Info("elected as route status writer", "routerName", a.routerName)
+	*a.writer = true
+	deferred := a.deferred
+	a.deferred = make(map[types.UID]deferredStatusUpdate)
+	a.writerLock.Unlock()
+
+	for uid, update := range deferred {
+		if !a.IsWriting() {
+			// Another router was elected meanwhile, keep the remaining
+			// updates for the next time this router is.
+			a.redefer(uid, update)
+			continue
+		}
+		// The updates may be old, only write those of routes that still
+		// exist in the cache, against the route as it is now.
+		current, err := a.lister.Routes(update.route.Namespace).Get(update.route.Name)
+		if err != nil || current.UID != uid {
+			log.V(4).Info("dropping deferred status update of a deleted route", "namespace", update.route.Namespace, "name", update.route.Name)
+			continue
+		}
+		performIngressConditionUpdate(update.action, a.lease, a.tracker, a.client, a.lister, current, a.routerName, a.routerCanonicalHostname, update.conditions[0], update.conditions[1:]...)
+	}
+}
+
+// IsWriting returns whether this router is the elected status writer.  It
+// is always true unless status writes are leader elected.
+func (a *StatusAdmitter) IsWriting() bool {
+	a.writerLock.Lock()
+	defer a.writerLock.Unlock()
+	return a.writer == nil || *a.writer
+}
+
+// redefer defers an update again unless a later update of the route was
+// deferred since.
+func (a *StatusAdmitter) redefer(uid types.UID, update deferredStatusUpdate) {
+	a.writerLock.Lock()
+	defer a.writerLock.Unlock()
+	if _, ok := a.deferred[uid]; !ok {
+		a.deferred[uid] = update
+	}
+}
+
+// StopWriting defers status updates until this router is elected as the
+// status writer again.
+func (a *StatusAdmitter) StopWriting() {
+	a.writerLock.Lock()
+	defer a.writerLock.Unlock()
+	if a.writer == nil || !*a.writer {
+		return
+	}
+	log.V(0).Info("no longer the route status writer", "routerName", a.routerName)
+	*a.writer = false
+}
+
+// updateCondition records the conditions in the status of the route, or
+// defers the update if another router is the elected status writer.
+func (a *StatusAdmitter) updateCondition(action string, route *routev1.Route, condition routev1.RouteIngressCondition, additional ...routev1.RouteIngressCondition) {
+	a.recordReported(route, append([]routev1.RouteIngressCondition{condition}, additional...)...)
+
+	a.writerLock.Lock()
+	if a.writer != nil && !*a.writer {
+		a.deferred[route.UID] = deferredStatusUpdate{
+			action:     action,
+			route:      route,
+			conditions: append([]routev1.RouteIngressCondition{condition}, additional...),
+		}
+		a.writerLock.Unlock()
+		return
+	}
+	a.writerLock.Unlock()
+
+	performIngressConditionUpdate(action, a.lease, a.tracker, a.client, a.lister, route, a.routerName, a.routerCanonicalHostname, condition, additional...)
+}
+
+// forgetDeferred drops the deferred status update of a deleted route.
+func (a *StatusAdmitter) forgetDeferred(route *routev1.Route) {
+	a.writerLock.Lock()
+	defer a.writerLock.Unlock()
+	delete(a.deferred, route.UID)
+}
+
+// EnableStandby makes the admitter report a Standby condition alongside the
+// admission of routes, which remains true until Promote is called.
+func (a *StatusAdmitter) EnableStandby() {
+	a.standbyLock.Lock()
+	defer a.standbyLock.Unlock()
+	standby := true
+	a.standby = &standby
+}
+
+// Promote reports that the router is no longer a standby router on every
+// route it admitted while in standby.
+func (a *StatusAdmitter) Promote() {
+	a.standbyLock.Lock()
+	if a.standby == nil || !*a.standby {
+		a.standbyLock.Unlock()
+		return
+	}
+	*a.standby = false
+	a.standbyLock.Unlock()
+
+	routes, err := a.lister.List(labels.Everything())
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to list routes to report the promotion of router %s: %v", a.routerName, err))
+		return
+	}
+	for _, route := range routes {
+		for i := range route.Status.Ingress {
+			ingress := &route.Status.Ingress[i]
+			if ingress.RouterName != a.routerName {
+				continue
+			}
+			admitted, standby := findCondition(ingress, routev1.RouteAdmitted), findCondition(ingress, RouteStandby)
+			if admitted == nil || standby == nil || standby.Status != corev1.ConditionTrue {
+				continue
+			}
+			a.updateCondition("promote", route, *admitted, a.standbyConditions()...)
+		}
+	}
+}
+
+// standbyConditions returns the Standby condition to report, if any.
+func (a *StatusAdmitter) standbyConditions() []routev1.RouteIngressCondition {
+	a.standbyLock.Lock()
+	defer a.standbyLock.Unlock()
+	if a.standby == nil {
+		return nil
+	}
+	condition := routev1.RouteIngressCondition{
+		Type:   RouteStandby,
+		Status: corev1.ConditionFalse,
+	}
+	if *a.standby {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = reasons.StandbyRouter
+		condition.Message = "the router does not serve the route until it is promoted"
+	}
+	return []routev1.RouteIngressCondition{condition}
+}
+
+// EnableAnnotationWarnings makes the admitter report an AnnotationWarnings
+// condition on the routes it admits that have unknown or deprecated haproxy
+// router annotations.
+func (a *StatusAdmitter) EnableAnnotationWarnings() {
+	a.annotationWarnings = true
+}
+
+// annotationConditions returns the AnnotationWarnings condition to report
+// on an admitted route, if any.  The condition is only reported as false
+// to clear one the router reported before, so that the status of routes
+// without warnings is left alone.
+func (a *StatusAdmitter) annotationConditions(route *routev1.Route) []routev1.RouteIngressCondition {
+	if !a.annotationWarnings {
+		return nil
+	}
+	warnings := routeapihelpers.GetAnnotationWarnings(route)
+	if len(warnings) == 0 {
+		for i := range route.Status.Ingress {
+			ingress := &route.Status.Ingress[i]
+			if ingress.RouterName != a.routerName {
+				continue
+			}
+			if condition := findCondition(ingress, RouteAnnotationWarnings); condition != nil && condition.Status == corev1.ConditionTrue {
+				return []routev1.RouteIngressCondition{{Type: RouteAnnotationWarnings, Status: corev1.ConditionFalse}}
+			}
+		}
+		return nil
+	}
+
+	reason := reasons.DeprecatedAnnotations
+	messages := make([]string, 0, len(warnings))
+	for _, warning := range warnings {
+		if !warning.Deprecated {
+			reason = reasons.UnknownAnnotations
+		}
+		messages = append(messages, warning.String())
+	}
+	return []routev1.RouteIngressCondition{{
+		Type:    RouteAnnotationWarnings,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: strings.Join(messages, "; "),
+	}}
+}
+
+// migratingConditions returns the Migrating condition to report on an
+// admitted route, if any.  The condition is only reported as false to clear
+// one the router reported before, for a route that moved back.
+func (a *StatusAdmitter) migratingConditions(route *routev1.Route) []routev1.RouteIngressCondition {
+	class, ok := route.Annotations[routeapihelpers.RouteMigratingAnnotation]
+	if !ok {
+		for i := range route.Status.Ingress {
+			ingress := &route.Status.Ingress[i]
+			if ingress.RouterName != a.routerName {
+				continue
+			}
+			if condition := findCondition(ingress, RouteMigrating); condition != nil && condition.Status == corev1.ConditionTrue {
+				return []routev1.RouteIngressCondition{{Type: RouteMigrating, Status: corev1.ConditionFalse}}
+			}
+		}
+		return nil
+	}
+	return []routev1.RouteIngressCondition{{
+		Type:    RouteMigrating,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasons.RouteClassChanged,
+		Message: fmt.Sprintf("the route moved to route class %q, the router serves it until a router of that class admits it", class),
+	}}
+}
+
+// tcpPortConditions returns the TCPPortAllocated condition of a TCP route
+// with its allocated port, or clears the condition reported before for a
+// route that no longer has a port.
+func (a *StatusAdmitter) tcpPortConditions(route *routev1.Route) []routev1.RouteIngressCondition {
+	port := routeapihelpers.AllocatedTCPPort(route)
+	if port == 0 {
+		for i := range route.Status.Ingress {
+			ingress := &route.Status.Ingress[i]
+			if ingress.RouterName != a.routerName {
+				continue
+			}
+			if condition := findCondition(ingress, RouteTCPPortAllocated); condition != nil && condition.Status == corev1.ConditionTrue {
+				return []routev1.RouteIngressCondition{{Type: RouteTCPPortAllocated, Status: corev1.ConditionFalse}}
+			}
+		}
+		return nil
+	}
+	return []routev1.RouteIngressCondition{{
+		Type:    RouteTCPPortAllocated,
+		Status:  corev1.ConditionTrue,
+		Reason:  reasons.TCPPortAllocated,
+		Message: strconv.Itoa(int(port)),
+	}}
+}
+
+// admittedCondition returns the Admitted condition of an admitted route.
+func admittedCondition(route *routev1.Route) routev1.RouteIngressCondition {
+	condition := routev1.RouteIngressCondition{
+		Type:   routev1.RouteAdmitted,
+		Status: corev1.ConditionTrue,
+	}
+	// report the dedicated port of TCP routes as they cannot be reached through the route host alone.
+	if port := routeapihelpers.AllocatedTCPPort(route); port != 0 {
+		condition.Message = fmt.Sprintf("TCP port %d", port)
+	}
+	return condition
+}
+
 // HandleRoute attempts to admit the provided route on watch add / modifications.
 func (a *StatusAdmitter) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
 	switch eventType {
 	case watch.Added, watch.Modified:
-		performIngressConditionUpdate("admit", a.lease, a.tracker, a.client, a.lister, route, a.routerName, a.routerCanonicalHostname, routev1.RouteIngressCondition{
-			Type:   routev1.RouteAdmitted,
-			Status: corev1.ConditionTrue,
-		})
+		conditions := append(append(a.standbyConditions(), a.annotationConditions(route)...), a.backendConditions(route)...)
+		conditions = append(conditions, a.serviceConditions(route)...)
+		conditions = append(conditions, a.migratingConditions(route)...)
+		conditions = append(conditions, a.tcpPortConditions(route)...)
+		conditions = append(conditions, a.retryingConditions(route)...)
+		a.updateCondition("admit", route, admittedCondition(route), conditions...)
+		a.recordCertificates(route, true)
+		for _, sink := range a.sinks {
+			sink.RecordRouteAdmission(route)
+		}
+	case watch.Deleted:
+		a.forgetDeferred(route)
+		a.forgetReported(route)
+		a.forgetBackends(route)
+		a.forgetServices(route)
+		a.recordCertificates(route, false)
+		if !a.justRejected(route) {
+			for _, sink := range a.sinks {
+				sink.RecordRouteRemoval(route)
+			}
+		}
+	}
+	err := a.plugin.HandleRoute(eventType, route)
+	// The rejections of the plugins this one wraps are not followed by a
+	// deletion through it.
+	a.forgetRejected(route)
+	return err
+}
+
+// markRejected records that route was just rejected, so that its deletion
+// by the plugin that rejected it is not reported to the sinks.
+func (a *StatusAdmitter) markRejected(route *routev1.Route) {
+	a.rejectedLock.Lock()
+	defer a.rejectedLock.Unlock()
+	if a.rejected == nil {
+		a.rejected = make(map[types.UID]string)
 	}
-	return a.plugin.HandleRoute(eventType, route)
+	a.rejected[route.UID] = route.ResourceVersion
+}
+
+// justRejected returns whether the deletion of route follows its rejection
+// rather than the deletion of the route, whose resource version is newer.
+func (a *StatusAdmitter) justRejected(route *routev1.Route) bool {
+	a.rejectedLock.Lock()
+	defer a.rejectedLock.Unlock()
+	version, ok := a.rejected[route.UID]
+	return ok && version == route.ResourceVersion
+}
+
+// forgetRejected drops the rejection of route recorded by markRejected.
+func (a *StatusAdmitter) forgetRejected(route *routev1.Route) {
+	a.rejectedLock.Lock()
+	defer a.rejectedLock.Unlock()
+	delete(a.rejected, route.UID)
 }
 
 func (a *StatusAdmitter) HandleNode(eventType watch.EventType, node *kapi.Node) error {
@@ -91,6 +511,7 @@ func (a *StatusAdmitter) HandleNode(eventType watch.EventType, node *kapi.Node)
 }
 
 func (a *StatusAdmitter) HandleEndpoints(eventType watch.EventType, route *kapi.Endpoints) error {
+	a.recordBackendEndpoints(eventType, route)
 	return a.plugin.HandleEndpoints(eventType, route)
 }
 
@@ -99,21 +520,91 @@ func (a *StatusAdmitter) HandleNamespaces(namespaces sets.String) error {
 }
 
 func (a *StatusAdmitter) Commit() error {
+	a.reportBackends()
+	a.reportServices()
 	return a.plugin.Commit()
 }
 
 // RecordRouteRejection attempts to update the route status with a reason for a route being rejected.
 func (a *StatusAdmitter) RecordRouteRejection(route *routev1.Route, reason, message string) {
-	performIngressConditionUpdate("reject", a.lease, a.tracker, a.client, a.lister, route, a.routerName, a.routerCanonicalHostname, routev1.RouteIngressCondition{
+	a.forgetBackends(route)
+	a.forgetServices(route)
+	a.recordCertificates(route, false)
+	a.updateCondition("reject", route, routev1.RouteIngressCondition{
 		Type:    routev1.RouteAdmitted,
 		Status:  corev1.ConditionFalse,
 		Reason:  reason,
 		Message: message,
-	})
+	}, append(a.standbyConditions(), a.retryingConditions(route)...)...)
+	if len(a.sinks) > 0 {
+		a.markRejected(route)
+	}
+	for _, sink := range a.sinks {
+		sink.RecordRouteRejection(route, reason, message)
+	}
+}
+
+// RecordRouteError records the reason of a retriable error in the Retrying
+// condition of the route, next to the Admitted condition the router reported
+// before.  Permanent errors are recorded as rejections by the plugins that
+// return them.
+func (a *StatusAdmitter) RecordRouteError(route *routev1.Route, err error) {
+	if !router.IsRetriable(err) {
+		return
+	}
+	retrying := routev1.RouteIngressCondition{
+		Type:    RouteRetrying,
+		Status:  corev1.ConditionTrue,
+		Reason:  router.ErrorReason(err),
+		Message: err.Error(),
+	}
+	for i := range route.Status.Ingress {
+		ingress := &route.Status.Ingress[i]
+		if ingress.RouterName != a.routerName {
+			continue
+		}
+		if admitted := findCondition(ingress, routev1.RouteAdmitted); admitted != nil {
+			a.updateCondition("retry", route, *admitted, retrying)
+			return
+		}
+	}
+	a.updateCondition("retry", route, retrying)
+}
+
+// retryingConditions clears the Retrying condition reported before on a
+// route the router admits or rejects, if any.
+func (a *StatusAdmitter) retryingConditions(route *routev1.Route) []routev1.RouteIngressCondition {
+	for i := range route.Status.Ingress {
+		ingress := &route.Status.Ingress[i]
+		if ingress.RouterName != a.routerName {
+			continue
+		}
+		if condition := findCondition(ingress, RouteRetrying); condition != nil && condition.Status == corev1.ConditionTrue {
+			return []routev1.RouteIngressCondition{{Type: RouteRetrying, Status: corev1.ConditionFalse}}
+		}
+	}
+	return nil
+}
+
+// RemoveRouteIngress removes the status this router recorded on a route it
+// no longer serves.  The status is left to the elected status writer if
+// status writes are leader elected.
+func (a *StatusAdmitter) RemoveRouteIngress(route *routev1.Route) {
+	a.forgetDeferred(route)
+	a.forgetReported(route)
+	if !hasIngress(route, a.routerName) {
+		return
+	}
+	a.writerLock.Lock()
+	writer := a.writer == nil || *a.writer
+	a.writerLock.Unlock()
+	if writer {
+		performIngressRemoval(a.lease, a.client, a.lister, route, a.routerName)
+	}
 }
 
 // performIngressConditionUpdate updates the route to the appropriate status for the provided condition.
-func performIngressConditionUpdate(action string, lease writerlease.Lease, tracker ContentionTracker, oc client.RoutesGetter, lister routelisters.RouteLister, route *routev1.Route, routerName, hostName string, condition routev1.RouteIngressCondition) {
+func performIngressConditionUpdate(action string, lease writerlease.Lease, tracker ContentionTracker, oc client.RoutesGetter, lister routelisters.RouteLister, route *routev1.Route, routerName, hostName string, condition routev1.RouteIngressCondition, additional ...routev1.RouteIngressCondition) {
 	key := string(route.UID)
 	routeNamespace, routeName := route.Namespace, route.Name
 
@@ -128,7 +619,7 @@ func performIngressConditionUpdate(action string, lease writerlease.Lease, track
 		}
 
 		route = route.DeepCopy()
-		changed, created, now, latest, original := recordIngressCondition(route, routerName, hostName, condition)
+		changed, created, now, latest, original := recordIngressCondition(route, routerName, hostName, condition, additional...)
 		if !changed {
 			log.V(4).Info("no changes to route needed", "action", action, "namespace", route.Namespace, "name", route.Name)
 			// if the most recent change was to our ingress status, consider the current lease extended
@@ -167,10 +658,65 @@ func performIngressConditionUpdate(action string, lease writerlease.Lease, track
 	})
 }
 
+// performIngressRemoval removes the ingress of the router from the status
+// of the route.
+func performIngressRemoval(lease writerlease.Lease, oc client.RoutesGetter, lister routelisters.RouteLister, route *routev1.Route, routerName string) {
+	key := string(route.UID)
+	routeNamespace, routeName := route.Namespace, route.Name
+
+	lease.Try(key, func() (writerlease.WorkResult, bool) {
+		route, err := lister.Routes(routeNamespace).Get(routeName)
+		if err != nil {
+			return writerlease.None, false
+		}
+		if string(route.UID) != key {
+			log.V(4).Info("skipped ingress removal due to route UID changing (likely delete and recreate)", "namespace", route.Namespace, "name", route.Name)
+			return writerlease.None, false
+		}
+		if !hasIngress(route, routerName) {
+			return writerlease.None, false
+		}
+
+		route = route.DeepCopy()
+		ingresses := route.Status.Ingress[:0]
+		for _, ingress := range route.Status.Ingress {
+			if ingress.RouterName != routerName {
+				ingresses = append(ingresses, ingress)
+			}
+		}
+		route.Status.Ingress = ingresses
+
+		switch _, err := oc.Routes(route.Namespace).UpdateStatus(context.TODO(), route, metav1.UpdateOptions{}); {
+		case err == nil:
+			log.V(4).Info("removed route ingress status", "namespace", route.Namespace, "name", route.Name)
+			return writerlease.Extend, false
+		case errors.IsNotFound(err):
+			return writerlease.Release, false
+		case errors.IsConflict(err):
+			log.V(4).Info("removing route ingress status failed due to write conflict", "namespace", route.Namespace, "name", route.Name)
+			return writerlease.Release, true
+		default:
+			utilruntime.HandleError(fmt.Errorf("Unable to remove router status for %s/%s: %v", route.Namespace, route.Name, err))
+			return writerlease.Release, true
+		}
+	})
+}
+
+// hasIngress returns true if the route has an ingress status of the router.
+func hasIngress(route *routev1.Route, routerName string) bool {
+	for i := range route.Status.Ingress {
+		if route.Status.Ingress[i].RouterName == routerName {
+			return true
+		}
+	}
+	return false
+}
+
 // recordIngressCondition updates the matching ingress on the route (or adds a new one) with the specified
-// condition, returning whether the route was updated or created, the time assigned to the condition, and
-// a pointer to the current ingress record.
-func recordIngressCondition(route *routev1.Route, name, hostName string, condition routev1.RouteIngressCondition) (changed, created bool, at time.Time, latest, original *routev1.RouteIngress) {
+// condition, and any additional conditions, returning whether the route was updated or created, the time
+// assigned to the conditions, and a pointer to the current ingress record.
+func recordIngressCondition(route *routev1.Route, name, hostName string, condition routev1.RouteIngressCondition, additional ...routev1.RouteIngressCondition) (changed, created bool, at time.Time, latest, original *routev1.RouteIngress) {
+	conditions := append([]routev1.RouteIngressCondition{condition}, additional...)
 	for i := range route.Status.Ingress {
 		existing := &route.Status.Ingress[i]
 		if existing.RouterName != name {
@@ -182,10 +728,14 @@ func recordIngressCondition(route *routev1.Route, name, hostName string, conditi
 			existing.WildcardPolicy != route.Spec.WildcardPolicy ||
 			existing.RouterCanonicalHostname != hostName
 
-		existingCondition := findCondition(existing, condition.Type)
-		if existingCondition != nil {
-			condition.LastTransitionTime = existingCondition.LastTransitionTime
-			if *existingCondition != condition {
+		for j := range conditions {
+			existingCondition := findCondition(existing, conditions[j].Type)
+			if existingCondition != nil {
+				conditions[j].LastTransitionTime = existingCondition.LastTransitionTime
+				if *existingCondition != conditions[j] {
+					changed = true
+				}
+			} else if j > 0 {
 				changed = true
 			}
 		}
@@ -201,14 +751,17 @@ func recordIngressCondition(route *routev1.Route, name, hostName string, conditi
 		existing.Host = route.Spec.Host
 		existing.WildcardPolicy = route.Spec.WildcardPolicy
 		existing.RouterCanonicalHostname = hostName
-		if existingCondition == nil {
-			existing.Conditions = append(existing.Conditions, condition)
-			existingCondition = &existing.Conditions[len(existing.Conditions)-1]
-		} else {
-			*existingCondition = condition
-		}
 		now := nowFn()
-		existingCondition.LastTransitionTime = &now
+		for _, condition := range conditions {
+			existingCondition := findCondition(existing, condition.Type)
+			if existingCondition == nil {
+				existing.Conditions = append(existing.Conditions, condition)
+				existingCondition = &existing.Conditions[len(existing.Conditions)-1]
+			} else {
+				*existingCondition = condition
+			}
+			existingCondition.LastTransitionTime = &now
+		}
 
 		return true, false, now.Time, existing, &original
 	}
@@ -219,13 +772,13 @@ func recordIngressCondition(route *routev1.Route, name, hostName string, conditi
 		Host:                    route.Spec.Host,
 		WildcardPolicy:          route.Spec.WildcardPolicy,
 		RouterCanonicalHostname: hostName,
-		Conditions: []routev1.RouteIngressCondition{
-			condition,
-		},
+		Conditions:              conditions,
 	})
 	ingress := &route.Status.Ingress[len(route.Status.Ingress)-1]
 	now := nowFn()
-	ingress.Conditions[0].LastTransitionTime = &now
+	for i := range ingress.Conditions {
+		ingress.Conditions[i].LastTransitionTime = &now
+	}
 
 	return true, true, now.Time, ingress, nil
 }
@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// reportedConditions are the conditions the admitter last reported on a
+// route, keyed by type.
+type reportedConditions struct {
+	namespace  string
+	name       string
+	conditions map[routev1.RouteIngressConditionType]routev1.RouteIngressCondition
+}
+
+// EnableStatusReconciliation makes the admitter remember the conditions it
+// reports on routes and check them against the status of the routes every
+// interval until stopCh is closed.  The conditions another controller
+// removed from the ingress of the router, or the whole ingress, are reported
+// again.
+func (a *StatusAdmitter) EnableStatusReconciliation(interval time.Duration, stopCh <-chan struct{}) {
+	a.reportedLock.Lock()
+	a.reported = make(map[types.UID]*reportedConditions)
+	a.reportedLock.Unlock()
+	go wait.Until(a.reconcileStatus, interval, stopCh)
+}
+
+// recordReported remembers the conditions reported on a route, if status
+// reconciliation is enabled.
+func (a *StatusAdmitter) recordReported(route *routev1.Route, conditions ...routev1.RouteIngressCondition) {
+	a.reportedLock.Lock()
+	defer a.reportedLock.Unlock()
+	if a.reported == nil {
+		return
+	}
+	reported, ok := a.reported[route.UID]
+	if !ok {
+		reported = &reportedConditions{conditions: make(map[routev1.RouteIngressConditionType]routev1.RouteIngressCondition)}
+		a.reported[route.UID] = reported
+	}
+	reported.namespace, reported.name = route.Namespace, route.Name
+	for _, condition := range conditions {
+		condition.LastTransitionTime = nil
+		reported.conditions[condition.Type] = condition
+	}
+}
+
+// forgetReported forgets the conditions reported on a route the router no
+// longer reports a status for.
+func (a *StatusAdmitter) forgetReported(route *routev1.Route) {
+	a.reportedLock.Lock()
+	defer a.reportedLock.Unlock()
+	delete(a.reported, route.UID)
+}
+
+// missingConditions returns the conditions the admitter reported on a route
+// that are missing from the ingress of the router in its status, with the
+// Admitted condition first.  It returns nil if none are missing.
+func (a *StatusAdmitter) missingConditions(route *routev1.Route, reported *reportedConditions) []routev1.RouteIngressCondition {
+	admitted, ok := reported.conditions[routev1.RouteAdmitted]
+	if !ok {
+		return nil
+	}
+	var ingress *routev1.RouteIngress
+	for i := range route.Status.Ingress {
+		if route.Status.Ingress[i].RouterName == a.routerName {
+			ingress = &route.Status.Ingress[i]
+			break
+		}
+	}
+	missing := false
+	for conditionType := range reported.conditions {
+		if ingress == nil || findCondition(ingress, conditionType) == nil {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+	var additional []routev1.RouteIngressCondition
+	for conditionType, condition := range reported.conditions {
+		if conditionType != routev1.RouteAdmitted {
+			additional = append(additional, condition)
+		}
+	}
+	sort.Slice(additional, func(i, j int) bool { return additional[i].Type < additional[j].Type })
+	return append([]routev1.RouteIngressCondition{admitted}, additional...)
+}
+
+// reconcileStatus reports again the conditions missing from the status of
+// the routes the admitter reported conditions on.
+func (a *StatusAdmitter) reconcileStatus() {
+	if !a.IsWriting() {
+		return
+	}
+	a.reportedLock.Lock()
+	reported := make(map[types.UID]reportedConditions, len(a.reported))
+	for uid, conditions := range a.reported {
+		copied := *conditions
+		copied.conditions = make(map[routev1.RouteIngressConditionType]routev1.RouteIngressCondition, len(conditions.conditions))
+		for conditionType, condition := range conditions.conditions {
+			copied.conditions[conditionType] = condition
+		}
+		reported[uid] = copied
+	}
+	a.reportedLock.Unlock()
+
+	for uid, conditions := range reported {
+		route, err := a.lister.Routes(conditions.namespace).Get(conditions.name)
+		switch {
+		case errors.IsNotFound(err):
+			continue
+		case err != nil:
+			utilruntime.HandleError(fmt.Errorf("unable to get route %s/%s to reconcile its status: %v", conditions.namespace, conditions.name, err))
+			continue
+		case route.UID != uid:
+			continue
+		}
+		missing := a.missingConditions(route, &conditions)
+		if len(missing) == 0 {
+			continue
+		}
+		log.V(0).Info("restoring route status conditions removed by another controller", "namespace", route.Namespace, "name", route.Name, "routerName", a.routerName)
+		a.updateCondition("reconcile", route, missing[0], missing[1:]...)
+	}
+}
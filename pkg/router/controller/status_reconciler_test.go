@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgotesting "k8s.io/client-go/testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+)
+
+func TestStatusReconciliation(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "route1",
+			Namespace:   "default",
+			UID:         types.UID("uid1"),
+			Annotations: map[string]string{"haproxy.router.openshift.io/timout": "5s"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "route1.test.local",
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "svc1"},
+		},
+	}
+	c := fake.NewSimpleClientset()
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(&recordingPlugin{}, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableAnnotationWarnings()
+	stopCh := make(chan struct{})
+	close(stopCh)
+	admitter.EnableStatusReconciliation(time.Hour, stopCh)
+
+	lastUpdate := func(expectedActions int) *routev1.Route {
+		t.Helper()
+		if len(c.Actions()) != expectedActions {
+			t.Fatalf("expected %d actions, got %#v", expectedActions, c.Actions())
+		}
+		obj := c.Actions()[expectedActions-1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+		lister.items = []*routev1.Route{obj}
+		return obj
+	}
+
+	admitter.HandleRoute(watch.Added, route)
+	admitted := lastUpdate(1)
+
+	// nothing is restored while the status holds the conditions
+	admitter.reconcileStatus()
+	lastUpdate(1)
+
+	// another controller strips the AnnotationWarnings condition
+	stripped := admitted.DeepCopy()
+	stripped.Status.Ingress[0].Conditions = stripped.Status.Ingress[0].Conditions[:1]
+	lister.items = []*routev1.Route{stripped}
+	admitter.reconcileStatus()
+	restored := lastUpdate(2)
+	ingress := findIngressForRoute(restored, "test")
+	if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the route to stay admitted: %#v", ingress.Conditions)
+	}
+	if condition := findCondition(ingress, RouteAnnotationWarnings); condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != "UnknownAnnotations" {
+		t.Fatalf("expected the annotation warnings to be restored: %#v", ingress.Conditions)
+	}
+
+	// and then the whole ingress of the router
+	stripped = restored.DeepCopy()
+	stripped.Status.Ingress = nil
+	lister.items = []*routev1.Route{stripped}
+	admitter.reconcileStatus()
+	if ingress := findIngressForRoute(lastUpdate(3), "test"); ingress == nil || len(ingress.Conditions) != 2 {
+		t.Fatalf("expected the ingress of the router to be restored: %#v", ingress)
+	}
+
+	// the conditions of deleted routes are forgotten
+	admitter.HandleRoute(watch.Deleted, route)
+	stripped = stripped.DeepCopy()
+	lister.items = []*routev1.Route{stripped}
+	admitter.reconcileStatus()
+	lastUpdate(3)
+}
@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// StatusSink receives the admission state of routes in addition to the
+// route status written by the StatusAdmitter.
+type StatusSink interface {
+	// RecordRouteAdmission is called when the router admits a route.
+	RecordRouteAdmission(route *routev1.Route)
+	// RecordRouteRejection is called when the router rejects a route.
+	RecordRouteRejection(route *routev1.Route, reason, message string)
+	// RecordRouteRemoval is called when a route is deleted.
+	RecordRouteRemoval(route *routev1.Route)
+}
+
+// RejectedRouteState describes a route rejected by the router.
+type RejectedRouteState struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Host      string `json:"host,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// RouterState summarizes the routes handled by a router shard.
+type RouterState struct {
+	RouterName     string               `json:"routerName"`
+	LastUpdated    metav1.Time          `json:"lastUpdated"`
+	AdmittedRoutes int                  `json:"admittedRoutes"`
+	RejectedRoutes []RejectedRouteState `json:"rejectedRoutes,omitempty"`
+	// OmittedRejectedRoutes is the number of rejected routes left out of
+	// RejectedRoutes to keep the summary within the size of a config map.
+	OmittedRejectedRoutes int `json:"omittedRejectedRoutes,omitempty"`
+}
+
+// RouterStatePublisher publishes the router state summary.
+type RouterStatePublisher interface {
+	Publish(state *RouterState) error
+}
+
+// RouterStateSummary is a StatusSink that tracks which routes are admitted
+// or rejected and periodically publishes a summary, so that the state of a
+// shard can be learned without listing every route.
+type RouterStateSummary struct {
+	lock sync.Mutex
+
+	routerName string
+	publisher  RouterStatePublisher
+	// isWriter returns whether this replica of the router publishes the
+	// summary, if set.
+	isWriter func() bool
+
+	admitted map[string]struct{}
+	rejected map[string]RejectedRouteState
+	// changed is true if the summary changed since it was last published.
+	changed bool
+}
+
+// NewRouterStateSummary returns a summary of the routes handled by the
+// router with the given name that is published with publisher.
+func NewRouterStateSummary(routerName string, publisher RouterStatePublisher) *RouterStateSummary {
+	return &RouterStateSummary{
+		routerName: routerName,
+		publisher:  publisher,
+		admitted:   make(map[string]struct{}),
+		rejected:   make(map[string]RejectedRouteState),
+		changed:    true,
+	}
+}
+
+// SetWriter restricts publishing the summary to the periods isWriter
+// returns true, so that the replicas of a router do not all write it.
+func (s *RouterStateSummary) SetWriter(isWriter func() bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.isWriter = isWriter
+}
+
+func (s *RouterStateSummary) RecordRouteAdmission(route *routev1.Route) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := routeNameKey(route)
+	if _, ok := s.admitted[key]; ok {
+		return
+	}
+	delete(s.rejected, key)
+	s.admitted[key] = struct{}{}
+	s.changed = true
+}
+
+func (s *RouterStateSummary) RecordRouteRejection(route *routev1.Route, reason, message string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := routeNameKey(route)
+	state := RejectedRouteState{
+		Namespace: route.Namespace,
+		Name:      route.Name,
+		Host:      route.Spec.Host,
+		Reason:    reason,
+		Message:   message,
+	}
+	if existing, ok := s.rejected[key]; ok && existing == state {
+		return
+	}
+	delete(s.admitted, key)
+	s.rejected[key] = state
+	s.changed = true
+}
+
+func (s *RouterStateSummary) RecordRouteRemoval(route *routev1.Route) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := routeNameKey(route)
+	_, admitted := s.admitted[key]
+	_, rejected := s.rejected[key]
+	if !admitted && !rejected {
+		return
+	}
+	delete(s.admitted, key)
+	delete(s.rejected, key)
+	s.changed = true
+}
+
+// State returns the current summary.
+func (s *RouterStateSummary) State() *RouterState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.stateLocked()
+}
+
+func (s *RouterStateSummary) stateLocked() *RouterState {
+	state := &RouterState{
+		RouterName:     s.routerName,
+		LastUpdated:    nowFn(),
+		AdmittedRoutes: len(s.admitted),
+	}
+	for _, rejected := range s.rejected {
+		state.RejectedRoutes = append(state.RejectedRoutes, rejected)
+	}
+	sort.Slice(state.RejectedRoutes, func(i, j int) bool {
+		a, b := state.RejectedRoutes[i], state.RejectedRoutes[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return state
+}
+
+// publish publishes the summary if it changed since it was last published.
+func (s *RouterStateSummary) publish() {
+	s.lock.Lock()
+	if !s.changed || (s.isWriter != nil && !s.isWriter()) {
+		s.lock.Unlock()
+		return
+	}
+	state := s.stateLocked()
+	s.changed = false
+	s.lock.Unlock()
+
+	if err := s.publisher.Publish(state); err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to publish router state for %s: %v", s.routerName, err))
+		s.lock.Lock()
+		s.changed = true
+		s.lock.Unlock()
+	}
+}
+
+// Run publishes the summary at most once per interval until stopCh is
+// closed.
+func (s *RouterStateSummary) Run(interval time.Duration, stopCh <-chan struct{}) {
+	wait.Until(s.publish, interval, stopCh)
+}
+
+// configMapRouterStatePublisher publishes the router state as JSON in a
+// config map.
+type configMapRouterStatePublisher struct {
+	client    corev1client.ConfigMapsGetter
+	namespace string
+	name      string
+}
+
+// routerStateKey is the config map key holding the router state.
+const routerStateKey = "state.json"
+
+// maxRouterStateSize is the size the router state is kept within, well
+// below the size of a config map.
+const maxRouterStateSize = 512 * 1024
+
+// marshalRouterState returns the router state as JSON of at most limit
+// bytes, leaving out as few rejected routes as needed.
+func marshalRouterState(state *RouterState, limit int) ([]byte, error) {
+	data, err := json.Marshal(state)
+	if err != nil || len(data) <= limit {
+		return data, err
+	}
+	truncated := *state
+	rejected := state.RejectedRoutes
+	// Find the most rejected routes that fit.
+	n := sort.Search(len(rejected)+1, func(n int) bool {
+		truncated.RejectedRoutes = rejected[:len(rejected)-n]
+		truncated.OmittedRejectedRoutes = state.OmittedRejectedRoutes + n
+		data, err := json.Marshal(&truncated)
+		return err != nil || len(data) <= limit
+	})
+	if n > len(rejected) {
+		return nil, fmt.Errorf("the router state does not fit in %d bytes", limit)
+	}
+	truncated.RejectedRoutes = rejected[:len(rejected)-n]
+	truncated.OmittedRejectedRoutes = state.OmittedRejectedRoutes + n
+	return json.Marshal(&truncated)
+}
+
+// NewConfigMapRouterStatePublisher returns a RouterStatePublisher that
+// writes the router state to the config map with the given namespace and
+// name, creating it if needed.
+func NewConfigMapRouterStatePublisher(client corev1client.ConfigMapsGetter, namespace, name string) RouterStatePublisher {
+	return &configMapRouterStatePublisher{client: client, namespace: namespace, name: name}
+}
+
+func (p *configMapRouterStatePublisher) Publish(state *RouterState) error {
+	data, err := marshalRouterState(state, maxRouterStateSize)
+	if err != nil {
+		return err
+	}
+
+	configMaps := p.client.ConfigMaps(p.namespace)
+	existing, err := configMaps.Get(context.TODO(), p.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: p.namespace, Name: p.name},
+			Data:       map[string]string{routerStateKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	existing = existing.DeepCopy()
+	if existing.Data == nil {
+		existing.Data = map[string]string{}
+	}
+	existing.Data[routerStateKey] = string(data)
+	_, err = configMaps.Update(context.TODO(), existing, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+)
+
+type fakeRouterStatePublisher struct {
+	published []*RouterState
+	err       error
+}
+
+func (p *fakeRouterStatePublisher) Publish(state *RouterState) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, state)
+	return nil
+}
+
+func sinkTestRoute(namespace, name, host string) *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       routev1.RouteSpec{Host: host},
+	}
+}
+
+func TestRouterStateSummary(t *testing.T) {
+	publisher := &fakeRouterStatePublisher{}
+	summary := NewRouterStateSummary("default", publisher)
+
+	a := sinkTestRoute("ns1", "a", "a.example.com")
+	b := sinkTestRoute("ns2", "b", "b.example.com")
+	c := sinkTestRoute("ns1", "c", "c.example.com")
+
+	summary.RecordRouteAdmission(a)
+	summary.RecordRouteAdmission(b)
+	summary.RecordRouteRejection(b, "HostAlreadyClaimed", "host claimed")
+	summary.RecordRouteRejection(c, "ExtendedValidationFailed", "invalid")
+	summary.publish()
+
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected 1 published state, got %d", len(publisher.published))
+	}
+	state := publisher.published[0]
+	if state.RouterName != "default" || state.AdmittedRoutes != 1 {
+		t.Fatalf("unexpected state: %#v", state)
+	}
+	expected := []RejectedRouteState{
+		{Namespace: "ns1", Name: "c", Host: "c.example.com", Reason: "ExtendedValidationFailed", Message: "invalid"},
+		{Namespace: "ns2", Name: "b", Host: "b.example.com", Reason: "HostAlreadyClaimed", Message: "host claimed"},
+	}
+	if !reflect.DeepEqual(state.RejectedRoutes, expected) {
+		t.Fatalf("unexpected rejected routes: %#v", state.RejectedRoutes)
+	}
+
+	// Nothing changed, so nothing should be published.
+	summary.RecordRouteAdmission(a)
+	summary.RecordRouteRejection(c, "ExtendedValidationFailed", "invalid")
+	summary.publish()
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected no publish without changes, got %d", len(publisher.published))
+	}
+
+	summary.RecordRouteRemoval(a)
+	summary.RecordRouteRemoval(b)
+	summary.publish()
+	if len(publisher.published) != 2 {
+		t.Fatalf("expected 2 published states, got %d", len(publisher.published))
+	}
+	state = publisher.published[1]
+	if state.AdmittedRoutes != 0 || len(state.RejectedRoutes) != 1 || state.RejectedRoutes[0].Name != "c" {
+		t.Fatalf("unexpected state after removal: %#v", state)
+	}
+}
+
+func TestRouterStateSummaryRetriesFailedPublish(t *testing.T) {
+	publisher := &fakeRouterStatePublisher{err: fmt.Errorf("unavailable")}
+	summary := NewRouterStateSummary("default", publisher)
+	summary.RecordRouteAdmission(sinkTestRoute("ns", "a", "a.example.com"))
+
+	summary.publish()
+	publisher.err = nil
+	summary.publish()
+	if len(publisher.published) != 1 || publisher.published[0].AdmittedRoutes != 1 {
+		t.Fatalf("expected the summary to be published after a failure, got %#v", publisher.published)
+	}
+}
+
+func TestStatusAdmitterSinks(t *testing.T) {
+	publisher := &fakeRouterStatePublisher{}
+	summary := NewRouterStateSummary("default", publisher)
+	p := &fakePlugin{}
+	c := fake.NewSimpleClientset()
+	admitter := NewStatusAdmitter(p, c.RouteV1(), &routeLister{}, "default", "", noopLease{}, &fakeTracker{})
+	admitter.AddStatusSink(summary)
+
+	a := sinkTestRoute("ns", "a", "a.example.com")
+	b := sinkTestRoute("ns", "b", "b.example.com")
+	if err := admitter.HandleRoute(watch.Added, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := admitter.HandleRoute(watch.Added, b); err != nil {
+		t.Fatal(err)
+	}
+	admitter.RecordRouteRejection(b, "Failed", "attempt failed")
+	if state := summary.State(); state.AdmittedRoutes != 1 || len(state.RejectedRoutes) != 1 {
+		t.Fatalf("unexpected state: %#v", state)
+	}
+
+	// The plugin that rejected the route deletes it from the plugins it
+	// wraps, which keeps the rejection.
+	if err := admitter.HandleRoute(watch.Deleted, b); err != nil {
+		t.Fatal(err)
+	}
+	if state := summary.State(); state.AdmittedRoutes != 1 || len(state.RejectedRoutes) != 1 {
+		t.Fatalf("unexpected state after the rejection: %#v", state)
+	}
+
+	deleted := b.DeepCopy()
+	deleted.ResourceVersion = "2"
+	if err := admitter.HandleRoute(watch.Deleted, deleted); err != nil {
+		t.Fatal(err)
+	}
+	if state := summary.State(); state.AdmittedRoutes != 1 || len(state.RejectedRoutes) != 0 {
+		t.Fatalf("unexpected state after deletion: %#v", state)
+	}
+}
+
+func TestRouterStateSummaryWriter(t *testing.T) {
+	publisher := &fakeRouterStatePublisher{}
+	summary := NewRouterStateSummary("default", publisher)
+	writer := false
+	summary.SetWriter(func() bool { return writer })
+	summary.RecordRouteAdmission(sinkTestRoute("ns", "a", "a.example.com"))
+
+	summary.publish()
+	if len(publisher.published) != 0 {
+		t.Fatalf("expected a replica that is not the writer not to publish, got %#v", publisher.published)
+	}
+	writer = true
+	summary.publish()
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected the writer to publish the changes made meanwhile, got %#v", publisher.published)
+	}
+}
+
+func TestMarshalRouterState(t *testing.T) {
+	state := &RouterState{RouterName: "default"}
+	for i := 0; i < 100; i++ {
+		state.RejectedRoutes = append(state.RejectedRoutes, RejectedRouteState{Namespace: "ns", Name: fmt.Sprintf("route-%03d", i), Reason: "HostAlreadyClaimed"})
+	}
+	full, err := marshalRouterState(state, maxRouterStateSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := len(full) / 2
+	data, err := marshalRouterState(state, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var truncated RouterState
+	if err := json.Unmarshal(data, &truncated); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > limit || len(truncated.RejectedRoutes) == 0 || len(truncated.RejectedRoutes)+truncated.OmittedRejectedRoutes != 100 {
+		t.Fatalf("expected the state to be truncated to %d bytes, got %d bytes with %d routes and %d omitted", limit, len(data), len(truncated.RejectedRoutes), truncated.OmittedRejectedRoutes)
+	}
+
+	if _, err := marshalRouterState(state, 10); err == nil {
+		t.Fatalf("expected an error for a state that cannot fit")
+	}
+}
+
+func TestConfigMapRouterStatePublisher(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	publisher := NewConfigMapRouterStatePublisher(client.CoreV1(), "openshift-ingress", "router-state")
+
+	for _, admitted := range []int{1, 2} {
+		if err := publisher.Publish(&RouterState{RouterName: "default", AdmittedRoutes: admitted}); err != nil {
+			t.Fatal(err)
+		}
+		cm, err := client.CoreV1().ConfigMaps("openshift-ingress").Get(context.TODO(), "router-state", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var state RouterState
+		if err := json.Unmarshal([]byte(cm.Data[routerStateKey]), &state); err != nil {
+			t.Fatal(err)
+		}
+		if state.RouterName != "default" || state.AdmittedRoutes != admitted {
+			t.Fatalf("unexpected published state: %#v", state)
+		}
+	}
+}
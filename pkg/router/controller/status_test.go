@@ -21,6 +21,9 @@ import (
 	routev1 "github.com/openshift/api/route/v1"
 	"github.com/openshift/client-go/route/clientset/versioned/fake"
 	routelisters "github.com/openshift/client-go/route/listers/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 	"github.com/openshift/router/pkg/router/writerlease"
 )
 
@@ -900,3 +903,290 @@ func (i *fakeInformer) LastSyncResourceVersion() string {
 func (i *fakeInformer) SetTransform(handler cache.TransformFunc) error {
 	panic("not implemented")
 }
+
+func TestStatusStandby(t *testing.T) {
+	p := &fakePlugin{}
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec:       routev1.RouteSpec{Host: "route1.test.local"},
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableStandby()
+
+	if err := admitter.HandleRoute(watch.Added, route); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	ingress := &obj.Status.Ingress[0]
+	if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the route to be admitted: %#v", ingress.Conditions)
+	}
+	if condition := findCondition(ingress, RouteStandby); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected a true standby condition: %#v", ingress.Conditions)
+	}
+
+	// promotion updates the routes admitted in standby
+	lister.items = []*routev1.Route{obj}
+	admitter.Promote()
+	if len(c.Actions()) != 2 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj = c.Actions()[1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	ingress = &obj.Status.Ingress[0]
+	if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the route to remain admitted: %#v", ingress.Conditions)
+	}
+	if condition := findCondition(ingress, RouteStandby); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false standby condition: %#v", ingress.Conditions)
+	}
+
+	// routes are no longer updated once promoted
+	lister.items = []*routev1.Route{obj}
+	if err := admitter.HandleRoute(watch.Modified, obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	admitter.Promote()
+	if len(c.Actions()) != 2 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+}
+
+func TestStatusLeaderElection(t *testing.T) {
+	p := &fakePlugin{}
+	c := fake.NewSimpleClientset()
+	route1 := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec:       routev1.RouteSpec{Host: "route1.test.local"},
+	}
+	route2 := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route2", Namespace: "default", UID: types.UID("uid2")},
+		Spec:       routev1.RouteSpec{Host: "route2.test.local"},
+	}
+	route3 := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route3", Namespace: "default", UID: types.UID("uid3")},
+		Spec:       routev1.RouteSpec{Host: "route3.test.local"},
+	}
+	recreated := route3.DeepCopy()
+	recreated.UID = types.UID("uid4")
+	lister := &routeLister{items: []*routev1.Route{route1, route2, recreated}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableLeaderElection()
+
+	// status updates are deferred until the router is elected
+	if err := admitter.HandleRoute(watch.Added, route1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	admitter.RecordRouteRejection(route1, "Rejected", "rejected")
+	if err := admitter.HandleRoute(watch.Added, route2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := admitter.HandleRoute(watch.Deleted, route2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// route3 was deleted and created again since its update was deferred
+	if err := admitter.HandleRoute(watch.Added, route3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 0 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	// route1 changed its host since its update was deferred
+	moved := route1.DeepCopy()
+	moved.Spec.Host = "moved.test.local"
+	lister.items[0] = moved
+
+	// only the latest update of routes that still exist is written
+	admitter.StartWriting()
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	if obj.Name != "route1" {
+		t.Fatalf("unexpected route updated: %s", obj.Name)
+	}
+	if condition := findCondition(&obj.Status.Ingress[0], routev1.RouteAdmitted); condition == nil || condition.Reason != "Rejected" {
+		t.Fatalf("expected the route to be rejected: %#v", obj.Status.Ingress[0].Conditions)
+	}
+	if host := obj.Status.Ingress[0].Host; host != "moved.test.local" {
+		t.Fatalf("expected the status of the current route, got host %s", host)
+	}
+
+	admitter.StopWriting()
+	if err := admitter.HandleRoute(watch.Added, route2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+}
+
+func TestStatusAnnotationWarnings(t *testing.T) {
+	p := &fakePlugin{}
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "route1",
+			Namespace:   "default",
+			UID:         types.UID("uid1"),
+			Annotations: map[string]string{"haproxy.router.openshift.io/timout": "5s"},
+		},
+		Spec: routev1.RouteSpec{Host: "route1.test.local"},
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+	admitter.EnableAnnotationWarnings()
+
+	if err := admitter.HandleRoute(watch.Added, route); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	ingress := &obj.Status.Ingress[0]
+	if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the route to be admitted: %#v", ingress.Conditions)
+	}
+	condition := findCondition(ingress, RouteAnnotationWarnings)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != "UnknownAnnotations" {
+		t.Fatalf("expected a true annotation warnings condition: %#v", ingress.Conditions)
+	}
+	if expected := "haproxy.router.openshift.io/timout is unknown, did you mean haproxy.router.openshift.io/timeout?"; condition.Message != expected {
+		t.Fatalf("expected the message %q, got %q", expected, condition.Message)
+	}
+
+	// fixing the annotation clears the condition
+	fixed := obj.DeepCopy()
+	fixed.Annotations = map[string]string{"haproxy.router.openshift.io/timeout": "5s"}
+	lister.items = []*routev1.Route{fixed}
+	if err := admitter.HandleRoute(watch.Modified, fixed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 2 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj = c.Actions()[1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	ingress = &obj.Status.Ingress[0]
+	if condition := findCondition(ingress, RouteAnnotationWarnings); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false annotation warnings condition: %#v", ingress.Conditions)
+	}
+
+	// routes without warnings are left alone
+	lister.items = []*routev1.Route{obj}
+	if err := admitter.HandleRoute(watch.Modified, obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	route2 := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route2", Namespace: "default", UID: types.UID("uid2")},
+		Spec:       routev1.RouteSpec{Host: "route2.test.local"},
+	}
+	lister.items = []*routev1.Route{route2}
+	if err := admitter.HandleRoute(watch.Added, route2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 3 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj = c.Actions()[2].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	if condition := findCondition(&obj.Status.Ingress[0], RouteAnnotationWarnings); condition != nil {
+		t.Fatalf("expected no annotation warnings condition: %#v", obj.Status.Ingress[0].Conditions)
+	}
+}
+
+func TestStatusTCPPortAllocated(t *testing.T) {
+	p := &fakePlugin{}
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "route1",
+			Namespace:   "default",
+			UID:         types.UID("uid1"),
+			Annotations: map[string]string{routeapihelpers.TCPAllocatedPortAnnotation: "10000"},
+		},
+		Spec: routev1.RouteSpec{Host: "route1.test.local"},
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+
+	if err := admitter.HandleRoute(watch.Added, route); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	ingress := &obj.Status.Ingress[0]
+	if condition := findCondition(ingress, RouteTCPPortAllocated); condition == nil || condition.Status != corev1.ConditionTrue || condition.Message != "10000" {
+		t.Fatalf("expected a true TCP port condition with the port: %#v", ingress.Conditions)
+	}
+
+	// the condition is cleared once the route no longer has a port
+	plain := obj.DeepCopy()
+	plain.Annotations = nil
+	lister.items = []*routev1.Route{plain}
+	if err := admitter.HandleRoute(watch.Modified, plain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 2 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj = c.Actions()[1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	if condition := findCondition(&obj.Status.Ingress[0], RouteTCPPortAllocated); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false TCP port condition: %#v", obj.Status.Ingress[0].Conditions)
+	}
+}
+
+func TestStatusRecordRouteError(t *testing.T) {
+	p := &fakePlugin{}
+	c := fake.NewSimpleClientset()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "route1", Namespace: "default", UID: types.UID("uid1")},
+		Spec:       routev1.RouteSpec{Host: "route1.test.local"},
+	}
+	lister := &routeLister{items: []*routev1.Route{route}}
+	admitter := NewStatusAdmitter(p, c.RouteV1(), lister, "test", "a.b.c.d", noopLease{}, &fakeTracker{})
+
+	if err := admitter.HandleRoute(watch.Added, route); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	admitted := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	lister.items = []*routev1.Route{admitted}
+
+	// permanent errors are recorded by the plugins that reject the route
+	admitter.RecordRouteError(admitted, router.NewRouteError(reasons.InvalidConfigSnippet, "invalid snippet"))
+	if len(c.Actions()) != 1 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+
+	// a retriable error is recorded next to the Admitted condition
+	admitter.RecordRouteError(admitted, router.NewRetriableRouteError(reasons.ConfigSnippetCheckFailed, "unable to check the config snippet", fmt.Errorf("timed out")))
+	if len(c.Actions()) != 2 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj := c.Actions()[1].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	ingress := &obj.Status.Ingress[0]
+	if condition := findCondition(ingress, routev1.RouteAdmitted); condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Fatalf("expected the route to stay admitted: %#v", ingress.Conditions)
+	}
+	if condition := findCondition(ingress, RouteRetrying); condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != reasons.ConfigSnippetCheckFailed {
+		t.Fatalf("expected a true Retrying condition with the reason of the error: %#v", ingress.Conditions)
+	}
+
+	// the condition is cleared once the route is admitted again
+	lister.items = []*routev1.Route{obj}
+	if err := admitter.HandleRoute(watch.Modified, obj); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Actions()) != 3 {
+		t.Fatalf("unexpected actions: %#v", c.Actions())
+	}
+	obj = c.Actions()[2].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	if condition := findCondition(&obj.Status.Ingress[0], RouteRetrying); condition == nil || condition.Status != corev1.ConditionFalse {
+		t.Fatalf("expected a false Retrying condition: %#v", obj.Status.Ingress[0].Conditions)
+	}
+}
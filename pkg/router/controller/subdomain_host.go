@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	utilwait "k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routelisters "github.com/openshift/client-go/route/listers/route/v1"
+)
+
+// SubdomainHosts generates the host of the routes with a subdomain and
+// without a host from the domain of the router, and generates them again when
+// the domain changes.
+type SubdomainHosts struct {
+	lock sync.Mutex
+	// domain is the current domain of the router, empty if routes with a
+	// subdomain are not given a host.
+	domain string
+	// previous are the domains the router had before, whose generated
+	// hosts are outdated.
+	previous map[string]struct{}
+}
+
+// NewSubdomainHosts returns a SubdomainHosts generating hosts from domain.
+func NewSubdomainHosts(domain string) *SubdomainHosts {
+	return &SubdomainHosts{domain: domain, previous: map[string]struct{}{}}
+}
+
+// Domain returns the current domain of the router.
+func (s *SubdomainHosts) Domain() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.domain
+}
+
+// SetDomain changes the domain of the router and returns whether it changed.
+// The hosts generated from the previous domain are outdated from now on.
+func (s *SubdomainHosts) SetDomain(domain string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if domain == s.domain {
+		return false
+	}
+	if len(s.domain) > 0 {
+		s.previous[s.domain] = struct{}{}
+	}
+	delete(s.previous, domain)
+	s.domain = domain
+	return true
+}
+
+// UpdateRoute sets the host of a route with a subdomain and without a host,
+// or with a host generated from a previous domain, to the subdomain in the
+// domain of the router, and returns whether it changed the route.
+func (s *SubdomainHosts) UpdateRoute(route *routev1.Route) bool {
+	if len(route.Spec.Subdomain) == 0 {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(route.Spec.Host) > 0 && !s.outdated(route) {
+		return false
+	}
+	host := ""
+	if len(s.domain) > 0 {
+		host = fmt.Sprintf("%s.%s", route.Spec.Subdomain, s.domain)
+	}
+	if host == route.Spec.Host {
+		return false
+	}
+	route.Spec.Host = host
+	return true
+}
+
+// Outdated returns whether route has a subdomain and no host while the
+// router has a domain, or a host generated from a previous domain of the
+// router.
+func (s *SubdomainHosts) Outdated(route *routev1.Route) bool {
+	if len(route.Spec.Subdomain) == 0 {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(route.Spec.Host) == 0 {
+		return len(s.domain) > 0
+	}
+	return s.outdated(route)
+}
+
+// outdated returns whether the host of route was generated from a previous
+// domain of the router.
+func (s *SubdomainHosts) outdated(route *routev1.Route) bool {
+	prefix := route.Spec.Subdomain + "."
+	if !strings.HasPrefix(route.Spec.Host, prefix) {
+		return false
+	}
+	_, ok := s.previous[strings.TrimPrefix(route.Spec.Host, prefix)]
+	return ok
+}
+
+// ReadDomainFile returns the domain in the file at path, with its
+// surrounding whitespace and dots removed.
+func ReadDomainFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	domain := strings.ToLower(strings.Trim(strings.TrimSpace(string(data)), "."))
+	if errs := kvalidation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+		return "", fmt.Errorf("%q in %s is not a valid domain: %s", domain, path, strings.Join(errs, ", "))
+	}
+	return domain, nil
+}
+
+// WatchDomainFile reads the domain of the router from the file at path every
+// interval until stopCh is closed, and generates the hosts of the routes of
+// c with a subdomain again when it changes.
+func (s *SubdomainHosts) WatchDomainFile(path string, interval time.Duration, c *RouterController, stopCh <-chan struct{}) {
+	go utilwait.Until(func() {
+		domain, err := ReadDomainFile(path)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("unable to read the router domain: %v", err))
+			return
+		}
+		if !s.SetDomain(domain) {
+			return
+		}
+		log.V(0).Info("router domain changed", "domain", domain)
+		c.RegenerateSubdomainHosts()
+	}, interval, stopCh)
+}
+
+// RegenerateSubdomainHosts passes the routes with a subdomain whose host is
+// outdated down the plugin chain again with the host generated from the
+// current domain, so their status reports it, and returns how many it
+// updated.
+func (c *RouterController) RegenerateSubdomainHosts() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.SubdomainHosts == nil {
+		return 0
+	}
+
+	updated := 0
+	for _, routeMap := range c.NamespaceRoutes {
+		for _, route := range routeMap {
+			if !c.SubdomainHosts.Outdated(route) {
+				continue
+			}
+			// The route is shared with the informer cache.
+			route = route.DeepCopy()
+			c.SubdomainHosts.UpdateRoute(route)
+			c.processRoute(watch.Modified, route)
+			updated++
+		}
+	}
+	if updated > 0 {
+		c.Commit()
+	}
+	return updated
+}
+
+// Lister returns a lister of the routes of lister with their outdated hosts
+// generated again, so that the status written from the routes of the informer
+// cache reports the hosts the router serves them at.
+func (s *SubdomainHosts) Lister(lister routelisters.RouteLister) routelisters.RouteLister {
+	return &subdomainRouteLister{hosts: s, lister: lister}
+}
+
+// subdomainRouteLister generates the outdated hosts of the routes of lister
+// again.
+type subdomainRouteLister struct {
+	hosts  *SubdomainHosts
+	lister routelisters.RouteLister
+}
+
+func (l *subdomainRouteLister) List(selector labels.Selector) ([]*routev1.Route, error) {
+	routes, err := l.lister.List(selector)
+	return l.hosts.update(routes), err
+}
+
+func (l *subdomainRouteLister) Routes(namespace string) routelisters.RouteNamespaceLister {
+	return &subdomainRouteNamespaceLister{hosts: l.hosts, lister: l.lister.Routes(namespace)}
+}
+
+// subdomainRouteNamespaceLister generates the outdated hosts of the routes of
+// lister again.
+type subdomainRouteNamespaceLister struct {
+	hosts  *SubdomainHosts
+	lister routelisters.RouteNamespaceLister
+}
+
+func (l *subdomainRouteNamespaceLister) List(selector labels.Selector) ([]*routev1.Route, error) {
+	routes, err := l.lister.List(selector)
+	return l.hosts.update(routes), err
+}
+
+func (l *subdomainRouteNamespaceLister) Get(name string) (*routev1.Route, error) {
+	route, err := l.lister.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.hosts.update([]*routev1.Route{route})[0], nil
+}
+
+// update returns routes with copies of the routes whose host is outdated,
+// with their host generated again.
+func (s *SubdomainHosts) update(routes []*routev1.Route) []*routev1.Route {
+	// routes may be shared with the lister.
+	var updated []*routev1.Route
+	for i, route := range routes {
+		if !s.Outdated(route) {
+			continue
+		}
+		if updated == nil {
+			updated = append([]*routev1.Route(nil), routes...)
+		}
+		route = route.DeepCopy()
+		s.UpdateRoute(route)
+		updated[i] = route
+	}
+	if updated == nil {
+		return routes
+	}
+	return updated
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgotesting "k8s.io/client-go/testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/client-go/route/clientset/versioned/fake"
+)
+
+func TestSubdomainHostsUpdateRoute(t *testing.T) {
+	hosts := NewSubdomainHosts("")
+	route := &routev1.Route{Spec: routev1.RouteSpec{Subdomain: "web"}}
+	if hosts.UpdateRoute(route) || len(route.Spec.Host) > 0 {
+		t.Fatalf("expected no host without a domain, got %q", route.Spec.Host)
+	}
+
+	hosts.SetDomain("apps.old.example.com")
+	if !hosts.Outdated(route) || !hosts.UpdateRoute(route) || route.Spec.Host != "web.apps.old.example.com" {
+		t.Fatalf("expected the host to be generated, got %q", route.Spec.Host)
+	}
+	custom := &routev1.Route{Spec: routev1.RouteSpec{Subdomain: "web", Host: "www.apps.old.example.com"}}
+
+	if hosts.SetDomain("apps.old.example.com") {
+		t.Errorf("expected the same domain not to be a change")
+	}
+	if !hosts.SetDomain("apps.new.example.com") {
+		t.Fatalf("expected the domain to change")
+	}
+	if !hosts.Outdated(route) || !hosts.UpdateRoute(route) || route.Spec.Host != "web.apps.new.example.com" {
+		t.Errorf("expected the host to be generated again, got %q", route.Spec.Host)
+	}
+	if hosts.Outdated(custom) || hosts.UpdateRoute(custom) || custom.Spec.Host != "www.apps.old.example.com" {
+		t.Errorf("expected a host not generated from the subdomain to be kept, got %q", custom.Spec.Host)
+	}
+}
+
+func TestReadDomainFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "domain")
+	if err := ioutil.WriteFile(path, []byte(" Apps.Example.com.\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if domain, err := ReadDomainFile(path); err != nil || domain != "apps.example.com" {
+		t.Errorf("expected apps.example.com, got %q and error %v", domain, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("not a domain!\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDomainFile(path); err == nil {
+		t.Errorf("expected an error for an invalid domain")
+	}
+}
+
+func TestRegenerateSubdomainHosts(t *testing.T) {
+	now := metav1.Now()
+	nowFn = func() metav1.Time { return now }
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "ns", UID: types.UID("uid1")},
+		Spec:       routev1.RouteSpec{Subdomain: "web", Host: "web.apps.old.example.com"},
+		Status: routev1.RouteStatus{
+			Ingress: []routev1.RouteIngress{{
+				Host:       "web.apps.old.example.com",
+				RouterName: "test",
+				Conditions: []routev1.RouteIngressCondition{{
+					Type:               routev1.RouteAdmitted,
+					Status:             corev1.ConditionTrue,
+					LastTransitionTime: &now,
+				}},
+			}},
+		},
+	}
+	c := fake.NewSimpleClientset(route.DeepCopy())
+	hosts := NewSubdomainHosts("apps.old.example.com")
+	lister := hosts.Lister(&routeLister{items: []*routev1.Route{route}})
+	plugin := &recordingPlugin{}
+	admitter := NewStatusAdmitter(plugin, c.RouteV1(), lister, "test", "", noopLease{}, &fakeTracker{})
+	controller := &RouterController{
+		Plugin:          admitter,
+		NamespaceRoutes: map[string]map[string]*routev1.Route{},
+		SubdomainHosts:  hosts,
+	}
+
+	controller.HandleRoute(watch.Added, route)
+	if len(c.Actions()) != 0 {
+		t.Fatalf("expected the admitted route not to be updated, got %#v", c.Actions())
+	}
+	if n := controller.RegenerateSubdomainHosts(); n != 0 {
+		t.Fatalf("expected no route to be updated before the domain changes, got %d", n)
+	}
+
+	hosts.SetDomain("apps.new.example.com")
+	if n := controller.RegenerateSubdomainHosts(); n != 1 {
+		t.Fatalf("expected the route to be updated, got %d", n)
+	}
+	if route.Spec.Host != "web.apps.old.example.com" {
+		t.Errorf("expected the cached route not to be modified, got %q", route.Spec.Host)
+	}
+	if len(c.Actions()) != 1 {
+		t.Fatalf("expected the status to be updated, got %#v", c.Actions())
+	}
+	updated := c.Actions()[0].(clientgotesting.UpdateAction).GetObject().(*routev1.Route)
+	if ingress := findIngressForRoute(updated, "test"); ingress == nil || ingress.Host != "web.apps.new.example.com" {
+		t.Errorf("expected the status to report the new host, got %#v", updated.Status.Ingress)
+	}
+	if recorded := controller.NamespaceRoutes["ns"]["web"]; recorded.Spec.Host != "web.apps.new.example.com" {
+		t.Errorf("expected the controller to record the new host, got %q", recorded.Spec.Host)
+	}
+
+	// An informer resync passes the cached route with the outdated host.
+	controller.HandleRoute(watch.Modified, route)
+	if recorded := controller.NamespaceRoutes["ns"]["web"]; recorded.Spec.Host != "web.apps.new.example.com" {
+		t.Errorf("expected the host to be generated again on resync, got %q", recorded.Spec.Host)
+	}
+}
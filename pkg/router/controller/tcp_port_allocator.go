@@ -0,0 +1,321 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+// TCPPortAllocator implements the router.Plugin interface to assign the
+// dedicated ports of TCP routes from a pool of router ports.  A port is held
+// by the first route that claims it until that route is deleted or stops
+// being a TCP route; routes contending for a held port are rejected.  Routes
+// that do not request a port get the port reported in their status again, so
+// their port survives a restart of the router.
+type TCPPortAllocator struct {
+	// plugin is the next plugin in the chain.
+	plugin router.Plugin
+
+	// recorder is an interface for indicating route rejections.
+	recorder RejectionRecorder
+
+	// portRange is the pool ports are allocated from.  TCP routes are
+	// rejected if it is empty.
+	portRange routeapihelpers.PortRange
+
+	// reserved are ports in use by the router itself.
+	reserved sets.Int32
+
+	// routerName is the name of the router in the status of the routes.
+	// The ports reported in its status are not seeded if empty.
+	routerName string
+	// recorded maps the ports reported in the status of the routes that
+	// do not hold them yet to those routes' name keys.
+	recorded map[int32]string
+	// unreported are the name keys of the routes allocated a port that
+	// was not reported in their status, which the routes it is reported
+	// for may take over.
+	unreported sets.String
+
+	// owners maps allocated ports to the route holding them.
+	owners map[int32]*routev1.Route
+	// ports maps route name keys to their allocated port.
+	ports map[string]int32
+}
+
+// NewTCPPortAllocator creates a plugin wrapper that allocates a port from
+// portRange to every TCP route and relays the route, annotated with its
+// port, to the next plugin in the chain.  Reserved ports are never
+// allocated.  Recorder is an interface for indicating why a route was
+// rejected.
+func NewTCPPortAllocator(plugin router.Plugin, portRange routeapihelpers.PortRange, reserved []int32, recorder RejectionRecorder) *TCPPortAllocator {
+	return &TCPPortAllocator{
+		plugin:     plugin,
+		recorder:   recorder,
+		portRange:  portRange,
+		reserved:   sets.NewInt32(reserved...),
+		owners:     make(map[int32]*routev1.Route),
+		ports:      make(map[string]int32),
+		recorded:   make(map[int32]string),
+		unreported: sets.NewString(),
+	}
+}
+
+// SetRouterName sets the name of the router in the status of the routes, so
+// that routes that do not request a port get the port reported there again.
+func (p *TCPPortAllocator) SetRouterName(name string) {
+	p.routerName = name
+}
+
+// HandleNode processes watch events on the Node resource.
+func (p *TCPPortAllocator) HandleNode(eventType watch.EventType, node *kapi.Node) error {
+	return p.plugin.HandleNode(eventType, node)
+}
+
+// HandleEndpoints processes watch events on the Endpoints resource.
+func (p *TCPPortAllocator) HandleEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) error {
+	return p.plugin.HandleEndpoints(eventType, endpoints)
+}
+
+// HandleRoute processes watch events on the Route resource.
+func (p *TCPPortAllocator) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	routeName := routeNameKey(route)
+
+	// The allocated port is only ever set by this plugin.
+	if _, ok := route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; ok {
+		route = route.DeepCopy()
+		delete(route.Annotations, routeapihelpers.TCPAllocatedPortAnnotation)
+	}
+
+	switch eventType {
+	case watch.Added, watch.Modified:
+		if !routeapihelpers.IsTCPRoute(route) {
+			p.release(routeName)
+			break
+		}
+
+		if err := routeapihelpers.ValidateTCPRoute(route).ToAggregate(); err != nil {
+			log.Error(err, "skipping route due to invalid TCP route configuration", "route", routeName)
+
+			p.release(routeName)
+			p.recorder.RecordRouteRejection(route, reasons.InvalidTCPRoute, err.Error())
+			p.plugin.HandleRoute(watch.Deleted, route)
+			return router.NewRouteError(reasons.InvalidTCPRoute, err.Error())
+		}
+
+		port, err := p.allocate(route)
+		if err != nil {
+			log.V(4).Info("route not admitted", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
+
+			p.release(routeName)
+			p.recorder.RecordRouteRejection(route, reasons.TCPPortUnavailable, err.Error())
+			p.plugin.HandleRoute(watch.Deleted, route)
+			return router.NewRouteError(reasons.TCPPortUnavailable, err.Error())
+		}
+
+		route = route.DeepCopy()
+		route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation] = fmt.Sprintf("%d", port)
+
+	case watch.Deleted:
+		p.release(routeName)
+	}
+
+	return p.plugin.HandleRoute(eventType, route)
+}
+
+// HandleNamespaces releases the ports of routes in namespaces that are no
+// longer served.
+func (p *TCPPortAllocator) HandleNamespaces(namespaces sets.String) error {
+	for port, owner := range p.owners {
+		if !namespaces.Has(owner.Namespace) {
+			delete(p.owners, port)
+			delete(p.ports, routeNameKey(owner))
+			p.unreported.Delete(routeNameKey(owner))
+		}
+	}
+	for port, owner := range p.recorded {
+		if namespace := strings.SplitN(owner, "/", 2)[0]; !namespaces.Has(namespace) {
+			delete(p.recorded, port)
+		}
+	}
+	return p.plugin.HandleNamespaces(namespaces)
+}
+
+// Commit invokes the nested plugin to commit.
+func (p *TCPPortAllocator) Commit() error {
+	return p.plugin.Commit()
+}
+
+// allocate returns the port held by the route, claiming the requested port
+// or the lowest free port of the range if it does not hold a suitable one.
+func (p *TCPPortAllocator) allocate(route *routev1.Route) (int32, error) {
+	if p.portRange.IsEmpty() {
+		return 0, fmt.Errorf("TCP routes are not enabled on this router")
+	}
+
+	routeName := routeNameKey(route)
+	current, holdsPort := p.ports[routeName]
+	requested, err := routeapihelpers.RequestedTCPPort(route)
+	if err != nil {
+		return 0, err
+	}
+
+	if requested == 0 {
+		if holdsPort && p.portRange.Contains(current) {
+			p.owners[current] = route
+			return current, nil
+		}
+		if port := p.recordedPort(route); port != 0 && p.portRange.Contains(port) && !p.reserved.Has(port) {
+			// A route processed first may have been allocated the port
+			// reported in the status of this route.
+			owner, taken := p.owners[port]
+			if !taken || p.unreported.Has(routeNameKey(owner)) {
+				p.release(routeName)
+				p.claim(port, route)
+				if taken {
+					p.reallocate(owner)
+				}
+				return port, nil
+			}
+		}
+		port := p.freePort(routeName)
+		if port == 0 {
+			return 0, fmt.Errorf("no free port left in the TCP port range %s", p.portRange)
+		}
+		p.release(routeName)
+		p.claim(port, route)
+		p.unreported.Insert(routeName)
+		return port, nil
+	}
+
+	if !p.portRange.Contains(requested) {
+		return 0, fmt.Errorf("port %d is outside of the TCP port range %s", requested, p.portRange)
+	}
+	if p.reserved.Has(requested) {
+		return 0, fmt.Errorf("port %d is reserved by the router", requested)
+	}
+	if owner, taken := p.owners[requested]; taken && routeNameKey(owner) != routeName {
+		if owner.Namespace == route.Namespace {
+			return 0, fmt.Errorf("route %s/%s holds port %d", owner.Namespace, owner.Name, requested)
+		}
+		return 0, fmt.Errorf("a route in another namespace holds port %d", requested)
+	}
+	p.release(routeName)
+	p.claim(requested, route)
+	return requested, nil
+}
+
+// claim records the route as the holder of port.
+func (p *TCPPortAllocator) claim(port int32, route *routev1.Route) {
+	p.owners[port] = route
+	p.ports[routeNameKey(route)] = port
+	p.unreported.Delete(routeNameKey(route))
+	if p.recorded[port] == routeNameKey(route) {
+		delete(p.recorded, port)
+	}
+}
+
+// freePort returns the lowest free port of the range that is not reported in
+// the status of a route other than the named one, or 0 if there is none.
+// The reported ports are left to their routes in case they are processed
+// later.
+func (p *TCPPortAllocator) freePort(routeName string) int32 {
+	for port := p.portRange.Min; port <= p.portRange.Max; port++ {
+		if _, taken := p.owners[port]; !taken && !p.reserved.Has(port) && !p.recordedFor(port, routeName) {
+			return port
+		}
+	}
+	return 0
+}
+
+// reallocate allocates another port to a route whose port was taken over by
+// the route it is reported for, and passes the route down the plugin chain
+// again.
+func (p *TCPPortAllocator) reallocate(route *routev1.Route) {
+	routeName := routeNameKey(route)
+	delete(p.ports, routeName)
+	p.unreported.Delete(routeName)
+
+	port := p.freePort(routeName)
+	if port == 0 {
+		err := fmt.Errorf("no free port left in the TCP port range %s", p.portRange)
+		log.V(4).Info("route not admitted", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
+		p.recorder.RecordRouteRejection(route, reasons.TCPPortUnavailable, err.Error())
+		p.plugin.HandleRoute(watch.Deleted, route)
+		return
+	}
+	p.claim(port, route)
+	p.unreported.Insert(routeName)
+
+	route = route.DeepCopy()
+	route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation] = fmt.Sprintf("%d", port)
+	if err := p.plugin.HandleRoute(watch.Modified, route); err != nil {
+		log.Error(err, "unable to move route to another TCP port", "namespace", route.Namespace, "name", route.Name)
+	}
+}
+
+// recordedPort returns the port reported in the TCPPortAllocated condition
+// of the router in the status of route, or 0 if none is, and remembers it so
+// that the port is not allocated to another route.
+func (p *TCPPortAllocator) recordedPort(route *routev1.Route) int32 {
+	if len(p.routerName) == 0 {
+		return 0
+	}
+	for _, ingress := range route.Status.Ingress {
+		if ingress.RouterName != p.routerName {
+			continue
+		}
+		for _, condition := range ingress.Conditions {
+			if condition.Type != RouteTCPPortAllocated || condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			n, err := strconv.ParseInt(condition.Message, 10, 32)
+			if err != nil || n <= 0 {
+				return 0
+			}
+			port := int32(n)
+			if _, ok := p.recorded[port]; !ok {
+				p.recorded[port] = routeNameKey(route)
+			}
+			return port
+		}
+	}
+	return 0
+}
+
+// recordedFor returns whether port is reported in the status of a route
+// other than the named one that does not hold it yet.
+func (p *TCPPortAllocator) recordedFor(port int32, routeName string) bool {
+	owner, ok := p.recorded[port]
+	return ok && owner != routeName
+}
+
+// forget drops the ports reported in the status of the named route.
+func (p *TCPPortAllocator) forget(routeName string) {
+	for port, owner := range p.recorded {
+		if owner == routeName {
+			delete(p.recorded, port)
+		}
+	}
+}
+
+// release frees the port held by the named route, if any, and the ports
+// reported in its status.
+func (p *TCPPortAllocator) release(routeName string) {
+	if port, ok := p.ports[routeName]; ok {
+		delete(p.owners, port)
+		delete(p.ports, routeName)
+	}
+	p.unreported.Delete(routeName)
+	p.forget(routeName)
+}
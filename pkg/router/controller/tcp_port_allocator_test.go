@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func tcpTestRoute(namespace, name, port string) *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        name,
+			Annotations: map[string]string{routeapihelpers.TCPPortAnnotation: port},
+		},
+		Spec: routev1.RouteSpec{Host: name + ".example.com"},
+	}
+}
+
+func TestTCPPortAllocator(t *testing.T) {
+	p := &fakePlugin{}
+	recorder := rejectionRecorder{rejections: make(map[string]string)}
+	allocator := NewTCPPortAllocator(p, routeapihelpers.PortRange{Min: 10000, Max: 10002}, []int32{10001}, recorder)
+
+	tests := []struct {
+		name      string
+		eventType watch.EventType
+		route     *routev1.Route
+		port      string
+		rejection string
+	}{
+		{
+			name:      "auto allocates the lowest free port",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns1", "auto", "auto"),
+			port:      "10000",
+		},
+		{
+			name:      "auto keeps its port",
+			eventType: watch.Modified,
+			route:     tcpTestRoute("ns1", "auto", "auto"),
+			port:      "10000",
+		},
+		{
+			name:      "requested port is held",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns1", "same-namespace", "10000"),
+			rejection: "TCPPortUnavailable",
+		},
+		{
+			name:      "reserved port",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns1", "reserved", "10001"),
+			rejection: "TCPPortUnavailable",
+		},
+		{
+			name:      "port outside of the range",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns1", "outside", "9999"),
+			rejection: "TCPPortUnavailable",
+		},
+		{
+			name:      "requested port",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns2", "requested", "10002"),
+			port:      "10002",
+		},
+		{
+			name:      "range exhausted",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns2", "exhausted", "auto"),
+			rejection: "TCPPortUnavailable",
+		},
+		{
+			name:      "invalid port",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns2", "invalid", "http"),
+			rejection: "InvalidTCPRoute",
+		},
+		{
+			name:      "deleting a route releases its port",
+			eventType: watch.Deleted,
+			route:     tcpTestRoute("ns1", "auto", "auto"),
+		},
+		{
+			name:      "released port is allocated again",
+			eventType: watch.Added,
+			route:     tcpTestRoute("ns2", "exhausted", "auto"),
+			port:      "10000",
+		},
+	}
+
+	for _, tc := range tests {
+		err := allocator.HandleRoute(tc.eventType, tc.route)
+
+		if len(tc.rejection) > 0 {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			if reason := recorder.rejections[recorder.rejectionKey(tc.route)]; reason != tc.rejection {
+				t.Errorf("%s: expected rejection %q, got %q", tc.name, tc.rejection, reason)
+			}
+			if p.t != watch.Deleted {
+				t.Errorf("%s: expected the route to be deleted from the next plugin, got %s", tc.name, p.t)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if port := p.route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; port != tc.port {
+			t.Errorf("%s: expected port %q, got %q", tc.name, tc.port, port)
+		}
+		if _, ok := tc.route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; ok {
+			t.Errorf("%s: the original route must not be modified", tc.name)
+		}
+	}
+}
+
+func TestTCPPortAllocatorIgnoresAllocatedPortAnnotation(t *testing.T) {
+	p := &fakePlugin{}
+	allocator := NewTCPPortAllocator(p, routeapihelpers.PortRange{}, nil, LogRejections)
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        "http",
+			Annotations: map[string]string{routeapihelpers.TCPAllocatedPortAnnotation: "10000"},
+		},
+	}
+	if err := allocator.HandleRoute(watch.Added, route); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; ok {
+		t.Fatalf("expected the allocated port annotation to be removed")
+	}
+
+	if err := allocator.HandleRoute(watch.Added, tcpTestRoute("ns", "tcp", "auto")); err == nil {
+		t.Fatalf("expected TCP routes to be rejected without a port range")
+	}
+}
+
+func TestTCPPortAllocatorKeepsReportedPortAcrossRestarts(t *testing.T) {
+	admitted := func(route *routev1.Route, port string) *routev1.Route {
+		route.Status.Ingress = []routev1.RouteIngress{{
+			RouterName: "default",
+			Conditions: []routev1.RouteIngressCondition{
+				{Type: routev1.RouteAdmitted, Status: corev1.ConditionTrue, Message: "TCP port " + port},
+				{Type: RouteTCPPortAllocated, Status: corev1.ConditionTrue, Message: port},
+			},
+		}}
+		return route
+	}
+	portRange := routeapihelpers.PortRange{Min: 10000, Max: 10002}
+
+	p := &fakePlugin{}
+	allocator := NewTCPPortAllocator(p, portRange, nil, LogRejections)
+	allocator.SetRouterName("default")
+	for _, name := range []string{"first", "second"} {
+		if err := allocator.HandleRoute(watch.Added, tcpTestRoute("ns", name, "auto")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if port := p.route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; port != "10001" {
+		t.Fatalf("expected the second route to get port 10001, got %q", port)
+	}
+
+	// After a restart the routes are processed in another order, along
+	// with a new route.
+	p = &fakePlugin{}
+	allocator = NewTCPPortAllocator(p, portRange, nil, LogRejections)
+	allocator.SetRouterName("default")
+	tests := []struct {
+		route *routev1.Route
+		port  string
+	}{
+		{route: admitted(tcpTestRoute("ns", "second", "auto"), "10001"), port: "10001"},
+		{route: tcpTestRoute("ns", "new", "auto"), port: "10000"},
+		{route: admitted(tcpTestRoute("ns", "first", "auto"), "10000"), port: "10000"},
+	}
+	for _, tc := range tests {
+		if err := allocator.HandleRoute(watch.Added, tc.route); err != nil {
+			t.Fatal(err)
+		}
+		if port := p.route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; port != tc.port {
+			t.Errorf("%s: expected port %q, got %q", tc.route.Name, tc.port, port)
+		}
+	}
+	// The new route was moved to another port when the route its port is
+	// reported for took it over.
+	if port := allocator.ports["ns/new"]; port != 10002 {
+		t.Errorf("expected the new route to be moved to port 10002, got %d", port)
+	}
+
+	// A route seen before the new one keeps its port.
+	p = &fakePlugin{}
+	allocator = NewTCPPortAllocator(p, portRange, nil, LogRejections)
+	allocator.SetRouterName("default")
+	other := admitted(tcpTestRoute("ns", "other", "auto"), "10000")
+	other.Status.Ingress[0].RouterName = "sharded"
+	tests = []struct {
+		route *routev1.Route
+		port  string
+	}{
+		{route: admitted(tcpTestRoute("ns", "first", "auto"), "10000"), port: "10000"},
+		{route: tcpTestRoute("ns", "new", "auto"), port: "10001"},
+		{route: other, port: "10002"},
+	}
+	for _, tc := range tests {
+		if err := allocator.HandleRoute(watch.Added, tc.route); err != nil {
+			t.Fatal(err)
+		}
+		if port := p.route.Annotations[routeapihelpers.TCPAllocatedPortAnnotation]; port != tc.port {
+			t.Errorf("%s: expected port %q, got %q", tc.route.Name, tc.port, port)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	kapi "k8s.io/api/core/v1"
@@ -15,6 +16,8 @@ import (
 
 	"github.com/openshift/router/pkg/router"
 	"github.com/openshift/router/pkg/router/controller/hostindex"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 )
 
 // RouteHostFunc returns a host for a route. It may return an empty string.
@@ -35,26 +38,84 @@ type UniqueHost struct {
 	// nil means different than empty
 	allowedNamespaces sets.String
 
+	// disableOwnershipCheck allows routes in different namespaces to
+	// expose the same host with different paths.
+	disableOwnershipCheck bool
+	// arbitration decides which of the routes contending for a host
+	// exposes it.
+	arbitration HostArbitration
+
 	// index tracks the set of active routes and the set of routes
 	// that cannot be admitted due to ownership restrictions
 	index hostindex.Interface
+
+	// claimStore, if set, persists the owner of each host so that
+	// ownership survives a restart.
+	claimStore HostClaimStore
+	// claims is the last set of host claims written to claimStore.
+	claims HostClaims
+	// restoredClaims are the claims loaded from claimStore. They are
+	// only consulted until the first commit.
+	restoredClaims HostClaims
+	// deferred holds routes contending for a restored claim whose
+	// claimant has not been processed yet.
+	deferred map[string]*routev1.Route
+	// touchedHosts are the hosts changed since the claims were saved.
+	touchedHosts sets.String
 }
 
 // NewUniqueHost creates a plugin wrapper that ensures only unique routes are passed into
 // the underlying plugin. Recorder is an interface for indicating why a route was
 // rejected.
 func NewUniqueHost(plugin router.Plugin, disableOwnershipCheck bool, recorder RejectionRecorder) *UniqueHost {
-	routeActivationFn := hostindex.SameNamespace
-	if disableOwnershipCheck {
-		routeActivationFn = hostindex.OldestFirst
-	}
-	return &UniqueHost{
+	p := &UniqueHost{
 		plugin: plugin,
 
 		recorder: recorder,
 
-		index: hostindex.New(routeActivationFn),
+		disableOwnershipCheck: disableOwnershipCheck,
+	}
+	p.index = hostindex.NewWithChangedFunc(p.arbitration.activationFunc(disableOwnershipCheck), hostTransferChanged)
+	return p
+}
+
+// SetHostArbitration replaces the policy that awards a host to the oldest of
+// the routes contending for it. It must be called before any route is
+// handled.
+func (p *UniqueHost) SetHostArbitration(arbitration HostArbitration) error {
+	if err := arbitration.Validate(p.disableOwnershipCheck); err != nil {
+		return err
+	}
+	if p.index.HostLen() > 0 {
+		return fmt.Errorf("the host arbitration policy cannot be changed once routes are handled")
 	}
+	p.arbitration = arbitration
+	p.index = hostindex.NewWithChangedFunc(arbitration.activationFunc(p.disableOwnershipCheck), hostTransferChanged)
+	return nil
+}
+
+// SetHostClaimStore persists host claims to store and restores the claims
+// saved by a previous run. Until the first commit, a route contending for a
+// restored host claim is held back until the claimant has been processed, so
+// that a restart does not transiently hand the host to another route and then
+// take it back. Ownership rules are applied as usual once the claimant is
+// known or the initial sync completes. The store is used even if the
+// previous claims cannot be loaded.
+func (p *UniqueHost) SetHostClaimStore(store HostClaimStore) error {
+	p.claimStore = store
+	p.claims = HostClaims{}
+	p.deferred = make(map[string]*routev1.Route)
+	p.touchedHosts = sets.NewString()
+
+	claims, err := store.Load()
+	if err != nil {
+		return err
+	}
+	for host, claim := range claims {
+		p.claims[host] = claim
+	}
+	p.restoredClaims = claims
+	return nil
 }
 
 // RoutesForHost is a helper that allows routes to be retrieved.
@@ -94,8 +155,14 @@ func (p *UniqueHost) HandleRoute(eventType watch.EventType, route *routev1.Route
 	host := route.Spec.Host
 
 	if len(host) == 0 {
-		log.V(4).Info("route has no host value", "namespace", route.Namespace, "name", route.Name)
-		p.recorder.RecordRouteRejection(route, "NoHostValue", "no host value was defined for the route")
+		log.V(4).Info("route has no host value", "namespace", route.Namespace, "name", route.Name, "subdomain", route.Spec.Subdomain)
+		message := "no host value was defined for the route"
+		if len(route.Spec.Subdomain) > 0 {
+			// the host is generated from the subdomain only when the router
+			// has a domain configured.
+			message = fmt.Sprintf("no host value was defined for the route and the router has no domain to generate one from subdomain %q", route.Spec.Subdomain)
+		}
+		p.recorder.RecordRouteRejection(route, reasons.NoHostValue, message)
 		p.plugin.HandleRoute(watch.Deleted, route)
 		return nil
 	}
@@ -109,12 +176,17 @@ func (p *UniqueHost) HandleRoute(eventType watch.EventType, route *routev1.Route
 			errMessages[i] = errs[i].Error()
 		}
 
-		err := fmt.Errorf("host name validation errors: %s", strings.Join(errMessages, ", "))
-		p.recorder.RecordRouteRejection(route, "InvalidHost", err.Error())
+		err := router.NewRouteError(reasons.InvalidHost, fmt.Sprintf("host name validation errors: %s", strings.Join(errMessages, ", ")))
+		p.recorder.RecordRouteRejection(route, err.Reason, err.Message)
 		p.plugin.HandleRoute(watch.Deleted, route)
 		return err
 	}
 
+	if p.claimStore != nil {
+		p.touchedHosts.Insert(host)
+		delete(p.deferred, routeName)
+	}
+
 	// Add the route to the index and see whether it is exposed. If this change results in
 	// other routes being exposed, notify the lower plugin. Report back to the end user when
 	// their route does not get exposed.
@@ -138,7 +210,7 @@ func (p *UniqueHost) HandleRoute(eventType watch.EventType, route *routev1.Route
 		// displaced routes must be deleted in nested plugins
 		for _, other := range changes.GetDisplaced() {
 			log.V(4).Info("route being deleted caused another route to no longer be exposed", "routeName", routeName, "displacedNamespace", other.Namespace, "displacedName", other.Name)
-			p.recorder.RecordRouteRejection(other, "HostAlreadyClaimed", fmt.Sprintf("namespace %s owns hostname %s", owner, host))
+			p.recorder.RecordRouteRejection(other, reasons.HostAlreadyClaimed, fmt.Sprintf("namespace %s owns hostname %s", owner, host))
 
 			if err := p.plugin.HandleRoute(watch.Deleted, other); err != nil {
 				utilruntime.HandleError(fmt.Errorf("unable to clear route %s/%s that was previously exposed: %v", other.Namespace, other.Name, err))
@@ -148,6 +220,12 @@ func (p *UniqueHost) HandleRoute(eventType watch.EventType, route *routev1.Route
 		return p.plugin.HandleRoute(eventType, route)
 
 	case watch.Added, watch.Modified:
+		if p.deferForRestoredClaim(route) {
+			log.V(4).Info("deferring route until the previous owner of its host is processed", "routeName", routeName, "host", host)
+			return nil
+		}
+		defer p.releaseDeferred(route)
+
 		var nestedErr error
 		changes, newRoute := p.index.Add(route)
 
@@ -167,8 +245,20 @@ func (p *UniqueHost) HandleRoute(eventType watch.EventType, route *routev1.Route
 		for _, other := range changes.GetDisplaced() {
 			// adding this route displaced others
 			if other != route {
-				log.V(4).Info("route will replace path from another route because it is older", "routeName", routeName, "path", route.Spec.Path, "otherName", other.Name)
-				p.recorder.RecordRouteRejection(other, "HostAlreadyClaimed", fmt.Sprintf("replaced by older route %s", route.Name))
+				reason := p.arbitration.reason(route, other)
+				log.V(4).Info("route will replace path from another route", "routeName", routeName, "path", route.Spec.Path, "otherName", other.Name, "reason", reason)
+				message := fmt.Sprintf("replaced by older route %s", route.Name)
+				if reason != olderReason {
+					message = fmt.Sprintf("replaced by route %s, which %s", route.Name, reason)
+				}
+				if transferredFrom(other, route) {
+					message = pendingTransferMessage(other, route)
+				}
+				rejection := reasons.HostAlreadyClaimed
+				if reason == transferredReason(other.Namespace) {
+					rejection = reasons.HostTransferred
+				}
+				p.recorder.RecordRouteRejection(other, rejection, message)
 
 				if err := p.plugin.HandleRoute(watch.Deleted, other); err != nil {
 					utilruntime.HandleError(fmt.Errorf("unable to clear route %s/%s that was previously exposed: %v", other.Namespace, other.Name, err))
@@ -185,10 +275,18 @@ func (p *UniqueHost) HandleRoute(eventType watch.EventType, route *routev1.Route
 				owner.Name = "<unknown>"
 			}
 			log.V(4).Info("route cannot take claimed host", "routeName", routeName, "host", host, "ownerNamespace", owner.Namespace, "ownerName", owner.Name)
-			if owner.Namespace == route.Namespace {
-				p.recorder.RecordRouteRejection(route, "HostAlreadyClaimed", fmt.Sprintf("route %s already exposes %s and is older", owner.Name, host))
-			} else {
-				p.recorder.RecordRouteRejection(route, "HostAlreadyClaimed", fmt.Sprintf("a route in another namespace holds %s and is older than %s", host, route.Name))
+			reason := p.arbitration.reason(owner, route)
+			switch {
+			case owner.Namespace == route.Namespace:
+				p.recorder.RecordRouteRejection(route, reasons.HostAlreadyClaimed, fmt.Sprintf("route %s already exposes %s and %s", owner.Name, host, reason))
+			case reason == transferredReason(route.Namespace):
+				p.recorder.RecordRouteRejection(route, reasons.HostTransferred, fmt.Sprintf("namespace %s granted %s to namespace %s, where route %s exposes it", route.Namespace, host, owner.Namespace, owner.Name))
+			case transferredFrom(route, owner):
+				p.recorder.RecordRouteRejection(route, reasons.HostAlreadyClaimed, pendingTransferMessage(route, owner))
+			case reason == olderReason:
+				p.recorder.RecordRouteRejection(route, reasons.HostAlreadyClaimed, fmt.Sprintf("a route in another namespace holds %s and is older than %s", host, route.Name))
+			default:
+				p.recorder.RecordRouteRejection(route, reasons.HostAlreadyClaimed, fmt.Sprintf("a route in another namespace holds %s and %s", host, reason))
 			}
 
 			// if this is the first time we've seen this route, we don't have to notify nested plugins
@@ -214,20 +312,124 @@ func (p *UniqueHost) HandleNamespaces(namespaces sets.String) error {
 	p.index.Filter(func(route *routev1.Route) bool {
 		return namespaces.Has(route.Namespace)
 	})
+	if p.claimStore != nil {
+		for key, route := range p.deferred {
+			if !namespaces.Has(route.Namespace) {
+				delete(p.deferred, key)
+			}
+		}
+		// filtering can only drop owners, which are rechecked for every
+		// claimed host when the claims are saved.
+		p.touchedHosts.Insert(p.claims.hosts()...)
+	}
 	return p.plugin.HandleNamespaces(namespaces)
 }
 
 // Commit invokes the nested plugin to commit.
 func (p *UniqueHost) Commit() error {
+	if p.restoredClaims != nil {
+		p.restoredClaims = nil
+		p.releaseAllDeferred()
+	}
+	p.saveClaims()
 	return p.plugin.Commit()
 }
 
+// deferForRestoredClaim records the route as deferred and returns true if the
+// route contends for a host restored from the claim store whose claimant has
+// not been processed yet.
+func (p *UniqueHost) deferForRestoredClaim(route *routev1.Route) bool {
+	claim, ok := p.restoredClaims[route.Spec.Host]
+	if !ok || claim.UID == route.UID {
+		return false
+	}
+	if routes, ok := p.index.RoutesForHost(route.Spec.Host); ok {
+		for _, existing := range routes {
+			if existing.UID == claim.UID {
+				return false
+			}
+		}
+	}
+	p.deferred[routeNameKey(route)] = route
+	return true
+}
+
+// releaseDeferred processes the routes that were deferred while waiting for
+// the provided route if it is the claimant of a restored host claim.
+func (p *UniqueHost) releaseDeferred(route *routev1.Route) {
+	if claim, ok := p.restoredClaims[route.Spec.Host]; !ok || claim.UID != route.UID {
+		return
+	}
+	var waiting []*routev1.Route
+	for _, other := range p.deferred {
+		if other.Spec.Host == route.Spec.Host {
+			waiting = append(waiting, other)
+		}
+	}
+	p.handleDeferred(waiting)
+}
+
+// releaseAllDeferred processes every deferred route, regardless of whether
+// the claimant it was waiting for was ever seen.
+func (p *UniqueHost) releaseAllDeferred() {
+	waiting := make([]*routev1.Route, 0, len(p.deferred))
+	for _, route := range p.deferred {
+		waiting = append(waiting, route)
+	}
+	p.handleDeferred(waiting)
+}
+
+// handleDeferred processes the provided deferred routes from oldest to newest.
+func (p *UniqueHost) handleDeferred(routes []*routev1.Route) {
+	sort.Slice(routes, func(i, j int) bool { return routeapihelpers.RouteLessThan(routes[i], routes[j]) })
+	for _, route := range routes {
+		delete(p.deferred, routeNameKey(route))
+		if err := p.HandleRoute(watch.Added, route); err != nil {
+			utilruntime.HandleError(fmt.Errorf("unable to process deferred route %s: %v", routeNameKey(route), err))
+		}
+	}
+}
+
+// saveClaims updates the claims for every host touched since the last save
+// and persists them if any owner changed.
+func (p *UniqueHost) saveClaims() {
+	if p.claimStore == nil || len(p.touchedHosts) == 0 {
+		return
+	}
+
+	changed := false
+	for host := range p.touchedHosts {
+		existing, claimed := p.claims[host]
+		routes, ok := p.index.RoutesForHost(host)
+		if !ok || len(routes) == 0 {
+			if claimed {
+				delete(p.claims, host)
+				changed = true
+			}
+			continue
+		}
+		if claim := claimForRoute(routes[0]); !claimed || !claim.sameClaimant(existing) {
+			p.claims[host] = claim
+			changed = true
+		}
+	}
+	p.touchedHosts = sets.NewString()
+
+	if !changed {
+		return
+	}
+	if err := p.claimStore.Save(p.claims); err != nil {
+		utilruntime.HandleError(fmt.Errorf("unable to persist host claims: %v", err))
+	}
+}
+
 // routeNameKey returns a unique name for a given route
 func routeNameKey(route *routev1.Route) string {
 	return fmt.Sprintf("%s/%s", route.Namespace, route.Name)
 }
 
 // ValidateHostName checks that a route's host name satisfies DNS requirements.
+// Internationalized host names are checked in their punycode form.
 func ValidateHostName(route *routev1.Route) field.ErrorList {
 	result := field.ErrorList{}
 	if len(route.Spec.Host) < 1 {
@@ -237,11 +439,16 @@ func ValidateHostName(route *routev1.Route) field.ErrorList {
 	specPath := field.NewPath("spec")
 	hostPath := specPath.Child("host")
 
-	if len(kvalidation.IsDNS1123Subdomain(route.Spec.Host)) != 0 {
+	host, err := routeapihelpers.ASCIIHost(route.Spec.Host)
+	if err != nil {
+		return append(result, field.Invalid(hostPath, route.Spec.Host, fmt.Sprintf("invalid internationalized host name: %v", err)))
+	}
+
+	if len(kvalidation.IsDNS1123Subdomain(host)) != 0 {
 		result = append(result, field.Invalid(hostPath, route.Spec.Host, "host must conform to DNS 952 subdomain conventions"))
 	}
 
-	segments := strings.Split(route.Spec.Host, ".")
+	segments := strings.Split(host, ".")
 	for _, s := range segments {
 		errs := kvalidation.IsDNS1123Label(s)
 		for _, e := range errs {
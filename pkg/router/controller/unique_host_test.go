@@ -3,7 +3,12 @@ package controller
 import (
 	"testing"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
 	routev1 "github.com/openshift/api/route/v1"
+
+	routertesting "github.com/openshift/router/pkg/router/testing"
 )
 
 // TestValidateHostName checks that a route's host name matches DNS requirements.
@@ -67,6 +72,24 @@ func TestValidateHostName(t *testing.T) {
 			},
 			expectedErrors: true,
 		},
+		{
+			name: "valid-idn-host-name",
+			route: &routev1.Route{
+				Spec: routev1.RouteSpec{
+					Host: "café.example.test",
+				},
+			},
+			expectedErrors: false,
+		},
+		{
+			name: "invalid-idn-host-name",
+			route: &routev1.Route{
+				Spec: routev1.RouteSpec{
+					Host: "café_bar.example.test",
+				},
+			},
+			expectedErrors: true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -83,3 +106,38 @@ func TestValidateHostName(t *testing.T) {
 		}
 	}
 }
+
+// TestUniqueHostSubdomainWithoutHost checks that a route relying on a
+// subdomain that the router could not expand is rejected.
+func TestUniqueHostSubdomainWithoutHost(t *testing.T) {
+	p := &fakePlugin{}
+	recorder := rejectionRecorder{rejections: make(map[string]string)}
+	uniqueHost := NewUniqueHost(p, false, recorder)
+
+	route := makeRoute("ns1", "r1", "", "", false, metav1.Now())
+	route.Spec.Subdomain = "www"
+	if err := uniqueHost.HandleRoute(watch.Added, route); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reason := recorder.rejections[recorder.rejectionKey(route)]; reason != "NoHostValue" {
+		t.Fatalf("expected route to be rejected with NoHostValue, got %q", reason)
+	}
+	if p.t != watch.Deleted || p.route != route {
+		t.Fatalf("expected route to be removed from the nested plugin")
+	}
+}
+
+// TestUniqueHostScenarios runs the host contention scenarios shared with
+// the template plugin tests.
+func TestUniqueHostScenarios(t *testing.T) {
+	scenarios, err := routertesting.LoadScenarios("../testing/testdata/unique_host.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scenario := range scenarios {
+		rejections := routertesting.NewRejectionRecorder()
+		routes := routertesting.NewRoutePlugin()
+		plugin := NewUniqueHost(routes, false, rejections)
+		routertesting.RunScenario(t, scenario, routertesting.Harness{Plugin: plugin, Rejections: rejections, Observe: routes.State})
+	}
+}
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RouteError is the error a plugin returns from HandleRoute when it could
+// not handle a route.  Permanent errors, such as a route failing validation,
+// are recorded as the rejection of the route and handling the route again
+// fails the same way until the route changes.  Retriable errors are
+// transient, such as haproxy timing out checking the route, and the route is
+// handled again later.
+type RouteError struct {
+	// Reason is the CamelCase reason code recorded in the status of a
+	// rejected route.
+	Reason string
+	// Message is the message for the owner of the route.
+	Message string
+	// Retriable is true if handling the route again may succeed.
+	Retriable bool
+	// Err is the underlying error, if any.
+	Err error
+}
+
+// NewRouteError returns a permanent route error.
+func NewRouteError(reason, message string) *RouteError {
+	return &RouteError{Reason: reason, Message: message}
+}
+
+// NewRetriableRouteError returns a route error for the transient failure
+// err.
+func NewRetriableRouteError(reason, message string, err error) *RouteError {
+	return &RouteError{Reason: reason, Message: message, Retriable: true, Err: err}
+}
+
+func (e *RouteError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetriable returns true if err is, or wraps, a retriable route error.
+func IsRetriable(err error) bool {
+	var routeErr *RouteError
+	return errors.As(err, &routeErr) && routeErr.Retriable
+}
+
+// ErrorReason returns the reason code of err if it is, or wraps, a route
+// error, and an empty string otherwise.
+func ErrorReason(err error) string {
+	var routeErr *RouteError
+	if errors.As(err, &routeErr) {
+		return routeErr.Reason
+	}
+	return ""
+}
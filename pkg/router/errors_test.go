@@ -0,0 +1,56 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRouteError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retriable bool
+		reason    string
+		message   string
+	}{
+		{
+			name:    "permanent",
+			err:     NewRouteError("InvalidTimeout", "invalid timeout"),
+			reason:  "InvalidTimeout",
+			message: "invalid timeout",
+		},
+		{
+			name:      "retriable",
+			err:       NewRetriableRouteError("CheckFailed", "unable to check the route", fmt.Errorf("timed out")),
+			retriable: true,
+			reason:    "CheckFailed",
+			message:   "unable to check the route: timed out",
+		},
+		{
+			name:      "wrapped",
+			err:       fmt.Errorf("route ns/r: %w", NewRetriableRouteError("CheckFailed", "unable to check the route", fmt.Errorf("timed out"))),
+			retriable: true,
+			reason:    "CheckFailed",
+			message:   "route ns/r: unable to check the route: timed out",
+		},
+		{
+			name:    "untyped",
+			err:     fmt.Errorf("failed"),
+			message: "failed",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if retriable := IsRetriable(tc.err); retriable != tc.retriable {
+				t.Errorf("expected retriable %v, got %v", tc.retriable, retriable)
+			}
+			if reason := ErrorReason(tc.err); reason != tc.reason {
+				t.Errorf("expected reason %q, got %q", tc.reason, reason)
+			}
+			if message := tc.err.Error(); message != tc.message {
+				t.Errorf("expected message %q, got %q", tc.message, message)
+			}
+		})
+	}
+}
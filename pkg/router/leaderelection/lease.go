@@ -0,0 +1,154 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
+
+	logf "github.com/openshift/router/log"
+)
+
+var log = logf.Logger.WithName("leaderelection")
+
+// LeaseElector competes for a coordination lease shared by several routers.
+// Only the router holding the lease performs the work the lease guards, the
+// others take over once the holder stops renewing it.
+type LeaseElector struct {
+	client    coordinationclient.LeasesGetter
+	namespace string
+	name      string
+	identity  string
+
+	// leaseDuration is how long a lease that is not renewed is held.
+	leaseDuration time.Duration
+	// retryPeriod is how often the lease is acquired or renewed.
+	retryPeriod time.Duration
+
+	// nowFn allows the elector to be tested.
+	nowFn func() time.Time
+}
+
+// NewLeaseElector returns an elector competing for the lease namespace/name
+// as identity.  Renewals happen every leaseDuration/3.
+func NewLeaseElector(client coordinationclient.LeasesGetter, namespace, name, identity string, leaseDuration time.Duration) *LeaseElector {
+	return &LeaseElector{
+		client:        client,
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		retryPeriod:   leaseDuration / 3,
+		nowFn:         time.Now,
+	}
+}
+
+// Run competes for the lease until stopCh is closed.  onAcquired is invoked
+// once the lease is acquired and onLost as soon as another holder took it
+// over or if it could not be renewed for a whole lease duration afterwards,
+// at which point Run returns.
+func (e *LeaseElector) Run(stopCh <-chan struct{}, onAcquired, onLost func()) {
+	ticker := time.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	acquired := false
+	var renewed time.Time
+	for {
+		held, holder, err := e.tryAcquireOrRenew()
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("unable to acquire or renew lease %s/%s: %v", e.namespace, e.name, err))
+		}
+		switch {
+		case held:
+			renewed = e.nowFn()
+			if !acquired {
+				log.V(0).Info("acquired lease", "namespace", e.namespace, "name", e.name, "identity", e.identity)
+				acquired = true
+				onAcquired()
+			}
+		case acquired && len(holder) > 0:
+			log.V(0).Info("lost lease", "namespace", e.namespace, "name", e.name, "identity", e.identity, "holder", holder)
+			onLost()
+			return
+		case acquired && e.nowFn().Sub(renewed) > e.leaseDuration:
+			log.V(0).Info("lost lease", "namespace", e.namespace, "name", e.name, "identity", e.identity)
+			onLost()
+			return
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquireOrRenew records the elector as the holder of the lease if the
+// lease is free, expired, or already held by the elector, and returns
+// whether the lease is held.  Otherwise it returns the other holder of the
+// lease, if known.
+func (e *LeaseElector) tryAcquireOrRenew() (bool, string, error) {
+	now := metav1.NewMicroTime(e.nowFn())
+	durationSeconds := int32(e.leaseDuration / time.Second)
+
+	lease, err := e.client.Leases(e.namespace).Get(context.TODO(), e.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: e.namespace, Name: e.name},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &e.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err := e.client.Leases(e.namespace).Create(context.TODO(), lease, metav1.CreateOptions{}); err != nil {
+			if errors.IsAlreadyExists(err) {
+				return false, "", nil
+			}
+			return false, "", err
+		}
+		return true, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	lease = lease.DeepCopy()
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != e.identity && len(holder) > 0 && !e.expired(lease) {
+		return false, holder, nil
+	}
+	if holder != e.identity {
+		lease.Spec.HolderIdentity = &e.identity
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+	if _, err := e.client.Leases(e.namespace).Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
+		if errors.IsConflict(err) {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	return true, "", nil
+}
+
+// expired returns true if the holder of the lease did not renew it within
+// its duration.
+func (e *LeaseElector) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return e.nowFn().After(expiry)
+}
@@ -0,0 +1,98 @@
+package leaderelection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaseElector(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newElector := func(identity string) *LeaseElector {
+		e := NewLeaseElector(client.CoordinationV1(), "ns", "router", identity, 15*time.Second)
+		e.nowFn = func() time.Time { return now }
+		return e
+	}
+	a, b := newElector("a"), newElector("b")
+
+	steps := []struct {
+		name     string
+		elector  *LeaseElector
+		advance  time.Duration
+		expected bool
+		other    string
+		holder   string
+	}{
+		{name: "a creates the lease", elector: a, expected: true, holder: "a"},
+		{name: "b waits while the lease is held", elector: b, advance: 10 * time.Second, expected: false, other: "a", holder: "a"},
+		{name: "a renews the lease", elector: a, advance: time.Second, expected: true, holder: "a"},
+		{name: "b waits while the renewed lease is held", elector: b, advance: 10 * time.Second, expected: false, other: "a", holder: "a"},
+		{name: "b acquires the expired lease", elector: b, advance: 10 * time.Second, expected: true, holder: "b"},
+		{name: "a lost the lease", elector: a, advance: time.Second, expected: false, other: "b", holder: "b"},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		held, other, err := step.elector.tryAcquireOrRenew()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if held != step.expected {
+			t.Fatalf("%s: expected held=%t, got %t", step.name, step.expected, held)
+		}
+		if other != step.other {
+			t.Fatalf("%s: expected other holder %q, got %q", step.name, step.other, other)
+		}
+		lease, err := client.CoordinationV1().Leases("ns").Get(context.TODO(), "router", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if *lease.Spec.HolderIdentity != step.holder {
+			t.Fatalf("%s: expected holder %q, got %q", step.name, step.holder, *lease.Spec.HolderIdentity)
+		}
+	}
+}
+
+func TestLeaseElectorLosesLeaseToAnotherHolder(t *testing.T) {
+	client := kubefake.NewSimpleClientset()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := NewLeaseElector(client.CoordinationV1(), "ns", "router", "a", 15*time.Second)
+	e.nowFn = func() time.Time { return now }
+	e.retryPeriod = 10 * time.Millisecond
+
+	acquired, lost := make(chan struct{}), make(chan struct{})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go e.Run(stopCh, func() { close(acquired) }, func() { close(lost) })
+
+	select {
+	case <-acquired:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the lease to be acquired")
+	}
+
+	// Another router takes the lease over before it expires, e.g. after
+	// it was deleted.
+	lease, err := client.CoordinationV1().Leases("ns").Get(context.TODO(), "router", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	holder := "b"
+	lease.Spec.HolderIdentity = &holder
+	if _, err := client.CoordinationV1().Leases("ns").Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The lease is lost without waiting for a lease duration.
+	select {
+	case <-lost:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("expected the lease to be lost as soon as another holder took it over")
+	}
+}
@@ -42,6 +42,14 @@ const (
 	backendType  = "1"
 	serverType   = "2"
 	listenerType = "3"
+
+	// connectionsField is the total number of connections of a proxy or
+	// server, by which the routes are ranked for the route budget.
+	connectionsField = 7
+
+	// otherRoute is the route label of the metrics of the routes beyond
+	// the route budget, aggregated by type of backend.
+	otherRoute = "other"
 )
 
 var (
@@ -110,6 +118,11 @@ type counterValuesByMetric map[metricID][]int64
 // of the metrics exposed by haproxy_exporter by default for performance reasons.
 var defaultSelectedMetrics = []int{2, 4, 5, 7, 8, 9, 13, 14, 17, 21, 24, 33, 35, 39, 40, 41, 42, 43, 44, 58, 59, 60, 79, 85}
 
+// nonAdditiveMetrics is the list of metrics that are maximums, averages or
+// states, which are not exported for the routes aggregated beyond the route
+// budget as their sum is meaningless.
+var nonAdditiveMetrics = map[int]bool{3: true, 5: true, 17: true, 35: true, 38: true, 58: true, 59: true, 60: true}
+
 // defaultCounterMetrics is the list of metrics that are counters and should be preserved across
 // restarts. Only add metrics to this list if they are a counter.
 var defaultCounterMetrics = []int{7, 8, 9, 13, 14, 21, 24, 39, 40, 41, 42, 43, 44, 79, 85}
@@ -136,8 +149,30 @@ type Exporter struct {
 	up, nextScrapeInterval                         prometheus.Gauge
 	totalScrapes, csvParseFailures                 prometheus.Counter
 	serverThresholdCurrent, serverThresholdLimit   prometheus.Gauge
+	suppressedSeries                               prometheus.Gauge
 	frontendMetrics, backendMetrics, serverMetrics map[int]*prometheus.GaugeVec
 
+	// queuedRequests is the number of requests queued in each backend,
+	// assigned to a server or not, exported with the current_queue
+	// metric.  It is computed from the rows of all the servers, even above
+	// opts.ServerThreshold.
+	queuedRequests *prometheus.GaugeVec
+	// serverQueues is the number of requests queued on the servers of each
+	// backend seen in the current scrape.
+	serverQueues map[string]int64
+
+	// promotedRoutes are the backends of the routes whose metrics are
+	// exported with their own labels when opts.RouteBudget is set.  The
+	// metrics of the backends of the other routes are aggregated.
+	promotedRoutes map[string]bool
+	// routeConnections is the total number of connections of the backend
+	// of each route at the previous scrape, to rank the routes by their
+	// recent traffic.
+	routeConnections map[string]int64
+	// suppressed is the number of series of the current scrape that were
+	// aggregated or not exported because of the route budget.
+	suppressed int
+
 	// counterValues is added to the value specific haproxy frontend, backend, or server counter
 	// metrics. This allows metrics to be tracked across restarts. This map is updated whenever CollectNow
 	// is invoked.
@@ -218,6 +253,11 @@ func NewExporter(opts PrometheusOptions) (*Exporter, error) {
 			Name:      "exporter_csv_parse_failures",
 			Help:      "Number of errors while parsing CSV.",
 		}),
+		suppressedSeries: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "exporter_suppressed_series",
+			Help:      "Number of route series aggregated into the other route or not exported because of the route budget.",
+		}),
 		frontendMetrics: filterMetrics(opts.ExportedMetrics, metrics{
 			4:  newFrontendMetric("current_sessions", "Current number of active sessions.", nil),
 			5:  newFrontendMetric("max_sessions", "Maximum observed number of active sessions.", nil),
@@ -270,6 +310,7 @@ func NewExporter(opts PrometheusOptions) (*Exporter, error) {
 		serverMetrics: filterMetrics(opts.ExportedMetrics, metrics{
 			2:  newServerMetric("current_queue", "Current number of queued requests assigned to this server.", nil),
 			3:  newServerMetric("max_queue", "Maximum observed number of queued requests assigned to this server.", nil),
+			25: newServerMetric("limit_queue", "Configured maximum number of queued requests assigned to this server.", nil),
 			4:  newServerMetric("current_sessions", "Current number of active sessions.", nil),
 			5:  newServerMetric("max_sessions", "Maximum observed number of active sessions.", nil),
 			6:  newServerMetric("limit_sessions", "Configured session limit.", nil),
@@ -298,6 +339,9 @@ func NewExporter(opts PrometheusOptions) (*Exporter, error) {
 			60: newServerMetric("http_average_response_latency_milliseconds", "Average response latency of the last 1024 requests in milliseconds.", nil),
 			85: newServerMetric("connections_reused_total", "Total number of connections reused.", nil),
 		}),
+		queuedRequests:   newBackendMetric("queued_requests", "Current number of queued requests, assigned to a server or not.", nil),
+		promotedRoutes:   map[string]bool{},
+		routeConnections: map[string]int64{},
 		counterIndices:   counterIndices,
 		counterIndexSize: counterIndexSize + 1,
 	}, nil
@@ -315,12 +359,16 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, m := range e.serverMetrics {
 		m.Describe(ch)
 	}
+	if e.exportQueuedRequests() {
+		e.queuedRequests.Describe(ch)
+	}
 	ch <- e.up.Desc()
 	ch <- e.totalScrapes.Desc()
 	ch <- e.nextScrapeInterval.Desc()
 	ch <- e.serverThresholdCurrent.Desc()
 	ch <- e.serverThresholdLimit.Desc()
 	ch <- e.csvParseFailures.Desc()
+	ch <- e.suppressedSeries.Desc()
 }
 
 // Collect fetches the stats from configured HAProxy location and delivers them
@@ -347,6 +395,7 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 	ch <- e.serverThresholdCurrent
 	ch <- e.serverThresholdLimit
 	ch <- e.csvParseFailures
+	ch <- e.suppressedSeries
 	e.collectMetrics(ch)
 }
 
@@ -425,6 +474,11 @@ func (e *Exporter) scrape(record bool) {
 	reader.TrailingComma = true
 	reader.Comment = '#'
 
+	e.serverQueues = make(map[string]int64)
+	e.suppressed = 0
+	// routeRows are the rows of the routes, parsed once the routes within
+	// the route budget are known.
+	var routeRows [][]string
 	rows, servers := 0, 0
 loop:
 	for {
@@ -458,6 +512,9 @@ loop:
 		// If we exceed the server threshold, ignore the rest of the servers because we will be
 		// displaying only backends and frontends.
 		if row[32] == serverType {
+			if qcur, err := strconv.ParseInt(row[2], 10, 64); err == nil {
+				e.serverQueues[row[0]] += qcur
+			}
 			servers++
 			if servers > e.opts.ServerThreshold {
 				continue
@@ -465,17 +522,29 @@ loop:
 		}
 
 		rows++
+		if e.opts.RouteBudget > 0 && isRouteRow(row) {
+			routeRows = append(routeRows, row)
+			continue
+		}
 		e.parseRow(row, updatedValues)
 	}
 
+	e.serverLimited = servers > e.opts.ServerThreshold
+	if e.opts.RouteBudget > 0 {
+		e.promoteRoutes(routeRows)
+		for _, row := range routeRows {
+			e.parseRow(row, updatedValues)
+		}
+	}
+
 	// swap the counter values
 	if record {
 		e.counterValues = updatedValues
 	}
 
-	e.serverLimited = servers > e.opts.ServerThreshold
 	e.serverThresholdCurrent.Set(float64(servers))
 	e.serverThresholdLimit.Set(float64(e.opts.ServerThreshold))
+	e.suppressedSeries.Set(float64(e.suppressed))
 
 	e.scrapeInterval = time.Duration(((float32(rows) / 1000) + 1) * float32(e.opts.BaseScrapeInterval))
 	e.nextScrapeInterval.Set(float64(e.scrapeInterval / time.Second))
@@ -491,6 +560,7 @@ func (e *Exporter) resetMetrics() {
 	for _, m := range e.serverMetrics {
 		m.Reset()
 	}
+	e.queuedRequests.Reset()
 }
 
 func (e *Exporter) collectMetrics(metrics chan<- prometheus.Metric) {
@@ -500,6 +570,9 @@ func (e *Exporter) collectMetrics(metrics chan<- prometheus.Metric) {
 	for _, m := range e.backendMetrics {
 		m.Collect(metrics)
 	}
+	if e.exportQueuedRequests() {
+		e.queuedRequests.Collect(metrics)
+	}
 	if !e.serverLimited {
 		for _, m := range e.serverMetrics {
 			m.Collect(metrics)
@@ -516,28 +589,128 @@ func (e *Exporter) parseRow(csvRow []string, updatedValues counterValuesByMetric
 
 	switch typ {
 	case frontendType:
-		e.exportAndRecordRow(e.frontendMetrics, metricID{proxyType: serverType, proxyName: pxname}, updatedValues, csvRow, pxname)
+		e.exportAndRecordRow(e.frontendMetrics, metricID{proxyType: serverType, proxyName: pxname}, updatedValues, csvRow, false, pxname)
 	case backendType:
+		labels := []string{"other/" + pxname, "", ""}
+		aggregate := false
 		if mode, value, ok := knownBackendSegment(pxname); ok {
 			if namespace, name, ok := parseNameSegment(value); ok {
-				e.exportAndRecordRow(e.backendMetrics, metricID{proxyType: serverType, proxyName: pxname}, updatedValues, csvRow, mode, namespace, name)
-				return
+				labels = []string{mode, namespace, name}
+				if aggregate = e.aggregated(pxname); aggregate {
+					labels = []string{mode, "", otherRoute}
+					e.suppressed += len(e.backendMetrics)
+				}
+			}
+		}
+		e.exportAndRecordRow(e.backendMetrics, metricID{proxyType: serverType, proxyName: pxname}, updatedValues, csvRow, aggregate, labels...)
+		if qcur, err := strconv.ParseInt(csvRow[2], 10, 64); err == nil && e.exportQueuedRequests() {
+			value := float64(qcur + e.serverQueues[pxname])
+			if aggregate {
+				e.queuedRequests.WithLabelValues(labels...).Add(value)
+			} else {
+				e.queuedRequests.WithLabelValues(labels...).Set(value)
 			}
 		}
-		e.exportAndRecordRow(e.backendMetrics, metricID{proxyType: serverType, proxyName: pxname}, updatedValues, csvRow, "other/"+pxname, "", "")
 	case serverType:
 		pod, service, server, _ := knownServerSegment(svname)
 
 		if _, value, ok := knownBackendSegment(pxname); ok {
 			if namespace, name, ok := parseNameSegment(value); ok {
-				e.exportAndRecordRow(e.serverMetrics, metricID{serverType, pxname, svname}, updatedValues, csvRow, server, namespace, name, pod, service)
+				if e.aggregated(pxname) {
+					// The servers of the routes beyond the budget
+					// are only counted in their aggregated
+					// backend.
+					if !e.serverLimited {
+						e.suppressed += len(e.serverMetrics)
+					}
+					return
+				}
+				e.exportAndRecordRow(e.serverMetrics, metricID{serverType, pxname, svname}, updatedValues, csvRow, false, server, namespace, name, pod, service)
 				return
 			}
 		}
-		e.exportAndRecordRow(e.serverMetrics, metricID{proxyType: serverType, serverName: svname}, updatedValues, csvRow, server, "", "", pod, service)
+		e.exportAndRecordRow(e.serverMetrics, metricID{proxyType: serverType, serverName: svname}, updatedValues, csvRow, false, server, "", "", pod, service)
 	}
 }
 
+// isRouteRow returns true if a row is the backend or a server of a route.
+func isRouteRow(csvRow []string) bool {
+	pxname, typ := csvRow[0], csvRow[32]
+	if typ != backendType && typ != serverType {
+		return false
+	}
+	if _, value, ok := knownBackendSegment(pxname); ok {
+		_, _, ok := parseNameSegment(value)
+		return ok
+	}
+	return false
+}
+
+// promoteRoutes ranks the routes by the number of connections to their
+// backend since the previous scrape and promotes the first
+// opts.RouteBudget routes, whose metrics are exported with their own
+// labels.  Routes that were promoted rank first among routes with as many
+// connections, so routes are only demoted by routes with more traffic.
+func (e *Exporter) promoteRoutes(routeRows [][]string) {
+	type route struct {
+		pxname      string
+		connections int64
+	}
+	var routes []route
+	connections := map[string]int64{}
+	for _, row := range routeRows {
+		if row[32] != backendType {
+			continue
+		}
+		pxname := row[0]
+		total, err := strconv.ParseInt(row[connectionsField], 10, 64)
+		if err != nil {
+			total = 0
+		}
+		connections[pxname] = total
+		recent := total
+		// The counters of haproxy start over when it reloads.
+		if previous, ok := e.routeConnections[pxname]; ok && previous <= total {
+			recent = total - previous
+		}
+		routes = append(routes, route{pxname: pxname, connections: recent})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i], routes[j]
+		switch {
+		case a.connections != b.connections:
+			return a.connections > b.connections
+		case e.promotedRoutes[a.pxname] != e.promotedRoutes[b.pxname]:
+			return e.promotedRoutes[a.pxname]
+		default:
+			return a.pxname < b.pxname
+		}
+	})
+
+	promoted := map[string]bool{}
+	for i := 0; i < len(routes) && i < e.opts.RouteBudget; i++ {
+		promoted[routes[i].pxname] = true
+	}
+	for pxname := range promoted {
+		if !e.promotedRoutes[pxname] {
+			log.V(4).Info("promoted route metrics", "backend", pxname)
+		}
+	}
+	for pxname := range e.promotedRoutes {
+		if !promoted[pxname] {
+			log.V(4).Info("demoted route metrics", "backend", pxname)
+		}
+	}
+	e.promotedRoutes = promoted
+	e.routeConnections = connections
+}
+
+// aggregated returns true if the metrics of the route of a backend are
+// aggregated because the route is beyond the route budget.
+func (e *Exporter) aggregated(pxname string) bool {
+	return e.opts.RouteBudget > 0 && !e.promotedRoutes[pxname]
+}
+
 // knownServerSegment takes a server name that has a known prefix and returns
 // the pod, service, and simpler service name label for that type. If the prefix does not
 // match false is returned.
@@ -558,6 +731,12 @@ func knownServerSegment(value string) (string, string, string, bool) {
 					}
 				}
 			}
+		case "slot":
+			// the servers named after the slots of their service are not
+			// tied to a pod, the slot is their server label.
+			if service, slot, ok := parseNameSegment(value[i+1:]); ok {
+				return "", service, slot, true
+			}
 		}
 	}
 	return "", "", value, false
@@ -604,8 +783,9 @@ func parseStatusField(value string) int64 {
 
 // exportAndRecordRow parses the provided csvRow labels for the specified metrics and then updates their value given labels. If updatedValues is
 // non-nil the current value of the metric will be written back to rowID. This allows baseline values to be recorded and used across restarts of
-// HAProxy.
-func (e *Exporter) exportAndRecordRow(metrics metrics, rowID metricID, updatedValues counterValuesByMetric, csvRow []string, labels ...string) {
+// HAProxy.  If aggregate is true the values are added to the metrics rather than set, and the metrics that cannot be summed are
+// skipped.
+func (e *Exporter) exportAndRecordRow(metrics metrics, rowID metricID, updatedValues counterValuesByMetric, csvRow []string, aggregate bool, labels ...string) {
 	var updatedBaseValues []int64
 	baseValues := e.counterValues[rowID]
 	if updatedValues != nil {
@@ -616,18 +796,22 @@ func (e *Exporter) exportAndRecordRow(metrics metrics, rowID metricID, updatedVa
 		updatedValues[rowID] = updatedBaseValues
 	}
 
-	exportCSVFields(e.csvParseFailures, metrics, baseValues, updatedBaseValues, e.counterIndices, csvRow, labels)
+	exportCSVFields(e.csvParseFailures, metrics, baseValues, updatedBaseValues, e.counterIndices, csvRow, aggregate, labels)
 }
 
 // exportCSVFields iterates over the returned CSV values and sets the appropriate metric in the map. Empty values or parse errors result in
 // no metric being scraped. If updatedBaseValues is not nil then it is updated with the latest value of the metric. If baseValues is nil
-// or the field is not a counter (according to counterIndices) then no value is incremented
-func exportCSVFields(csvParseFailures prometheus.Counter, metrics metrics, baseValues, updatedBaseValues []int64, counterIndices []byte, csvRow []string, labels []string) {
+// or the field is not a counter (according to counterIndices) then no value is incremented. If aggregate is true the value is added to
+// the metric, and the metrics that cannot be summed are skipped.
+func exportCSVFields(csvParseFailures prometheus.Counter, metrics metrics, baseValues, updatedBaseValues []int64, counterIndices []byte, csvRow []string, aggregate bool, labels []string) {
 	for fieldIdx, metric := range metrics {
 		valueStr := csvRow[fieldIdx]
 		if valueStr == "" {
 			continue
 		}
+		if aggregate && nonAdditiveMetrics[fieldIdx] {
+			continue
+		}
 
 		// the stored position of the previous value
 		storedIdx := counterIndices[fieldIdx]
@@ -652,10 +836,21 @@ func exportCSVFields(csvParseFailures prometheus.Counter, metrics metrics, baseV
 			updatedBaseValues[storedIdx] = value
 		}
 
-		metric.WithLabelValues(labels...).Set(float64(value))
+		if aggregate {
+			metric.WithLabelValues(labels...).Add(float64(value))
+		} else {
+			metric.WithLabelValues(labels...).Set(float64(value))
+		}
 	}
 }
 
+// exportQueuedRequests returns true if the number of queued requests of the
+// backends is exported, along with their current_queue metric.
+func (e *Exporter) exportQueuedRequests() bool {
+	_, ok := e.backendMetrics[2]
+	return ok
+}
+
 // filterMetrics returns the set of server metrics specified by the export array.
 func filterMetrics(export []int, available metrics) metrics {
 	metrics := map[int]*prometheus.GaugeVec{}
@@ -691,6 +886,13 @@ type PrometheusOptions struct {
 	ServerThreshold int
 	// ExportedMetrics is a list of HAProxy stats to export.
 	ExportedMetrics []int
+	// RouteBudget, if set, is the maximum number of routes whose metrics are
+	// exported with their own labels. The routes with the most connections
+	// since the previous scrape are exported, and the backend metrics of the
+	// others are summed into an "other" route for each type of backend and
+	// their server metrics are not exported. This bounds the cardinality of
+	// the metrics when there is a very large number of routes.
+	RouteBudget int
 }
 
 // NewPrometheusCollector starts collectors for prometheus metrics from the
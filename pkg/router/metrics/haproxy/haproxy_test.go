@@ -206,6 +206,108 @@ be_edge_http:openshift-console:downloads,BACKEND,0,0,0,0,1,0,0,0,0,0,,0,0,0,0,UP
 	mustHaveMetric(t, f, "haproxy_server_connections_total", 245, map[string]string{"namespace": "openshift-console", "pod": "console-6db7cbb464-gr787", "route": "console", "server": "10.129.0.43:8443", "service": "console"})
 }
 
+// TestExporterQueuedRequests tests that the requests queued on the servers of
+// a backend are exported with the backend, even above the server threshold.
+func TestExporterQueuedRequests(t *testing.T) {
+	scrape := `be_secure:openshift-console:console,pod:console-6db7cbb464-gr787:console:port:10.129.0.43:8443,3,5,0,8,,236,505655,2344127,,0,,0,0,0,0,UP,256,1,0,0,0,802,0,10,1,17,1,,0,,2,0,,57,L6OK,,1,5,226,1,4,0,0,,,,,0,0,,,,,11,,,0,0,2,1350,,,,Layer6 check passed,,2,3,4,,,,10.129.0.43:8443,7e4a3da6d0368ecb934a4910245f83b4,http,,,,,,,,0,15,221,,,0,,0,4,26,16533,
+be_secure:openshift-console:console,pod:console-6db7cbb464-8s44k:console:port:10.130.64.12:8443,2,2,0,0,,0,0,0,,0,,0,0,0,0,UP,256,1,0,0,0,802,0,10,1,17,2,,0,,2,0,,0,L6OK,,1,0,0,0,0,0,0,,,,,0,0,,,,,-1,,,0,0,0,0,,,,Layer6 check passed,,2,3,4,,,,10.130.64.12:8443,5b10765dbf34d04f53986cf7ac1bf19c,http,,,,,,,,0,0,0,,,0,,0,0,0,0,
+be_secure:openshift-console:console,BACKEND,1,4,0,8,1,236,505655,2344127,0,0,,0,0,0,0,UP,512,2,0,,0,802,0,,1,17,0,,0,,1,0,,57,,,,5,226,1,4,0,0,,,,236,0,0,0,0,0,0,11,,,0,0,2,1350,,,,,,,,,,,,,1e2670d92730b515ce3a1bb65da45062,http,leastconn,,,,,,,0,15,221,0,0,,,0,4,26,16533,
+`
+	e, err := NewExporter(defaultOptions(PrometheusOptions{ScrapeURI: "http://localhost", ServerThreshold: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.fetch = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(scrape)), nil
+	}
+	r := prometheus.NewRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+
+	f := gatherMetrics(t, r)
+	backend := map[string]string{"backend": "https", "namespace": "openshift-console", "route": "console"}
+	mustHaveMetric(t, f, "haproxy_backend_current_queue", 1, backend)
+	mustHaveMetric(t, f, "haproxy_backend_queued_requests", 6, backend)
+}
+
+// TestExporterRouteBudget tests that only the metrics of the routes with the
+// most recent connections are exported with their own labels under a route
+// budget, and that the others are aggregated.
+func TestExporterRouteBudget(t *testing.T) {
+	backendRow := `be_secure:openshift-console:console,BACKEND,1,4,0,8,1,236,505655,2344127,0,0,,0,0,0,0,UP,512,2,0,,0,802,0,,1,17,0,,0,,1,0,,57,,,,5,226,1,4,0,0,,,,236,0,0,0,0,0,0,11,,,0,0,2,1350,,,,,,,,,,,,,1e2670d92730b515ce3a1bb65da45062,http,leastconn,,,,,,,0,15,221,0,0,,,0,4,26,16533,`
+	serverRow := `be_secure:openshift-console:console,pod:console-6db7cbb464-gr787:console:port:10.129.0.43:8443,3,5,0,8,,236,505655,2344127,,0,,0,0,0,0,UP,256,1,0,0,0,802,0,10,1,17,1,,0,,2,0,,57,L6OK,,1,5,226,1,4,0,0,,,,,0,0,,,,,11,,,0,0,2,1350,,,,Layer6 check passed,,2,3,4,,,,10.129.0.43:8443,7e4a3da6d0368ecb934a4910245f83b4,http,,,,,,,,0,15,221,,,0,,0,4,26,16533,`
+	row := func(template, route string, connections string) string {
+		fields := strings.Split(template, ",")
+		fields[0] = "be_secure:ns:" + route
+		fields[connectionsField] = connections
+		return strings.Join(fields, ",") + "\n"
+	}
+	scrape := func(a, b, c string) string {
+		return row(serverRow, "a", a) + row(backendRow, "a", a) +
+			row(serverRow, "b", b) + row(backendRow, "b", b) +
+			row(serverRow, "c", c) + row(backendRow, "c", c)
+	}
+
+	e, err := NewExporter(defaultOptions(PrometheusOptions{ScrapeURI: "http://localhost", RouteBudget: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := scrape("10", "100", "20")
+	e.fetch = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(current)), nil
+	}
+	r := prometheus.NewRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := func(route string) map[string]string {
+		return map[string]string{"backend": "https", "namespace": "ns", "route": route}
+	}
+	other := map[string]string{"backend": "https", "namespace": "", "route": "other"}
+
+	f := gatherMetrics(t, r)
+	mustHaveMetric(t, f, "haproxy_backend_connections_total", 100, backend("b"))
+	mustHaveMetric(t, f, "haproxy_backend_connections_total", 30, other)
+	mustHaveMetric(t, f, "haproxy_backend_up", 1, backend("b"))
+	mustHaveMetric(t, f, "haproxy_server_connections_total", 100, map[string]string{"namespace": "ns", "route": "b"})
+	mustNotHaveSeries(t, f, "haproxy_backend_connections_total", backend("a"))
+	mustNotHaveSeries(t, f, "haproxy_backend_up", other)
+	mustNotHaveSeries(t, f, "haproxy_server_connections_total", map[string]string{"namespace": "ns", "route": "a"})
+	suppressed := float64(2 * (len(e.backendMetrics) + len(e.serverMetrics)))
+	mustHaveMetric(t, f, "haproxy_exporter_suppressed_series", suppressed)
+
+	// route c has the most connections since the previous scrape.
+	current = scrape("15", "110", "80")
+	e.lastScrape = nil
+	f = gatherMetrics(t, r)
+	mustHaveMetric(t, f, "haproxy_backend_connections_total", 80, backend("c"))
+	mustHaveMetric(t, f, "haproxy_backend_connections_total", 125, other)
+	mustNotHaveSeries(t, f, "haproxy_backend_connections_total", backend("b"))
+
+	// routes b and c tie, and c stays promoted.
+	current = scrape("15", "120", "90")
+	e.lastScrape = nil
+	f = gatherMetrics(t, r)
+	mustHaveMetric(t, f, "haproxy_backend_connections_total", 90, backend("c"))
+	mustNotHaveSeries(t, f, "haproxy_backend_connections_total", backend("b"))
+}
+
+func mustNotHaveSeries(t *testing.T, families []*client_model.MetricFamily, name string, labels map[string]string) {
+	t.Helper()
+	for _, family := range families {
+		if *family.Name != name {
+			continue
+		}
+		for _, m := range family.Metric {
+			if hasAllLabels(m.Label, []map[string]string{labels}) {
+				t.Fatalf("unexpected metric %s%v:\n\n%s", name, labels, mustMetricsToString(families, name))
+			}
+		}
+	}
+}
+
 func mustHaveMetric(t *testing.T, families []*client_model.MetricFamily, name string, value float64, labels ...map[string]string) {
 	t.Helper()
 	if !hasMetric(families, name, value, labels...) {
@@ -2,16 +2,22 @@ package metrics
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/server/healthz"
 
+	routercontroller "github.com/openshift/router/pkg/router/controller"
 	"github.com/openshift/router/pkg/router/metrics/probehttp"
 	templateplugin "github.com/openshift/router/pkg/router/template"
 )
@@ -21,6 +27,208 @@ var (
 	errShuttingDown = fmt.Errorf("process is terminating")
 )
 
+// ReloadHistory returns a handler that serves the recent reloads of the
+// router and their reasons as JSON.
+func ReloadHistory(routerPtr **templateplugin.TemplatePlugin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if routerPtr == nil || *routerPtr == nil {
+			http.Error(w, "Router not started", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode((*routerPtr).ReloadHistory()); err != nil {
+			log.Error(err, "unable to write reload history")
+		}
+	})
+}
+
+// StateSnapshot returns a handler that serves a snapshot of the routes and
+// services of the router as JSON, for bug reports.
+func StateSnapshot(routerPtr **templateplugin.TemplatePlugin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if routerPtr == nil || *routerPtr == nil {
+			http.Error(w, "Router not started", http.StatusServiceUnavailable)
+			return
+		}
+		data, err := (*routerPtr).ExportState()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Unable to export the router state: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(data); err != nil {
+			log.Error(err, "unable to write router state")
+		}
+	})
+}
+
+// SupportBundle returns a handler that serves a gzipped tarball of the
+// configuration files, state snapshot and recent reloads of the router for
+// support cases, with their secrets redacted.  The anonymizeIPs query
+// parameter also replaces the IP addresses with placeholders.  Who requested
+// the bundle is logged.
+func SupportBundle(routerPtr **templateplugin.TemplatePlugin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if routerPtr == nil || *routerPtr == nil {
+			http.Error(w, "Router not started", http.StatusServiceUnavailable)
+			return
+		}
+		options := templateplugin.SupportBundleOptions{}
+		if value := req.URL.Query().Get("anonymizeIPs"); len(value) > 0 {
+			anonymize, err := strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "The anonymizeIPs parameter must be true or false", http.StatusBadRequest)
+				return
+			}
+			options.AnonymizeIPs = anonymize
+		}
+
+		username := "unknown"
+		if u, ok := request.UserFrom(req.Context()); ok {
+			username = u.GetName()
+		}
+		log.V(0).Info("support bundle requested", "user", username, "anonymizeIPs", options.AnonymizeIPs)
+
+		var bundle bytes.Buffer
+		if err := (*routerPtr).WriteSupportBundle(&bundle, options); err != nil {
+			http.Error(w, fmt.Sprintf("Unable to write the support bundle: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=router-support-bundle-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z")))
+		if _, err := w.Write(bundle.Bytes()); err != nil {
+			log.Error(err, "unable to write support bundle")
+		}
+	})
+}
+
+// Resync returns a handler that, on POST, passes the routes of the router
+// down the plugin chain again and reloads the router with their
+// certificates written again, without restarting it.  The namespace and
+// route query parameters limit the resync to the routes of a namespace or
+// to one of its routes.  Who requested the resync is logged.
+func Resync(routerPtr **templateplugin.TemplatePlugin, controllerPtr **routercontroller.RouterController) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if routerPtr == nil || *routerPtr == nil || controllerPtr == nil || *controllerPtr == nil {
+			http.Error(w, "Router not started", http.StatusServiceUnavailable)
+			return
+		}
+		query := req.URL.Query()
+		namespace, name := query.Get("namespace"), query.Get("route")
+		if len(name) > 0 && len(namespace) == 0 {
+			http.Error(w, "The namespace parameter is required with the route parameter", http.StatusBadRequest)
+			return
+		}
+
+		username := "unknown"
+		if u, ok := request.UserFrom(req.Context()); ok {
+			username = u.GetName()
+		}
+		log.V(0).Info("resync requested", "user", username, "namespace", namespace, "route", name)
+
+		resynced := (*controllerPtr).Resync(namespace, name)
+		rerendered := (*routerPtr).Rerender(namespace, name)
+		if (len(namespace) > 0 || len(name) > 0) && resynced == 0 && rerendered == 0 {
+			http.Error(w, "No matching route", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]int{"resyncedRoutes": resynced, "rerenderedRoutes": rerendered}); err != nil {
+			log.Error(err, "unable to write resync result")
+		}
+	})
+}
+
+// EventHistory returns a handler that serves the recent events of the router
+// controller and what the plugin chain did with them as JSON, oldest first.
+// The kind, namespace and name query parameters limit the events to a kind
+// of resource and to the objects in a namespace and with a name.
+func EventHistory(controllerPtr **routercontroller.RouterController) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if controllerPtr == nil || *controllerPtr == nil {
+			http.Error(w, "Router not started", http.StatusServiceUnavailable)
+			return
+		}
+		if (*controllerPtr).Events == nil {
+			http.Error(w, "The event history is disabled", http.StatusNotFound)
+			return
+		}
+		query := req.URL.Query()
+		kind := query.Get("kind")
+		switch kind {
+		case "", routercontroller.EventKindRoute, routercontroller.EventKindEndpoints, routercontroller.EventKindNamespace, routercontroller.EventKindNode:
+		default:
+			http.Error(w, fmt.Sprintf("Invalid kind parameter %q, must be one of %s, %s, %s or %s", kind, routercontroller.EventKindRoute, routercontroller.EventKindEndpoints, routercontroller.EventKindNamespace, routercontroller.EventKindNode), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode((*controllerPtr).Events.Events(kind, query.Get("namespace"), query.Get("name"))); err != nil {
+			log.Error(err, "unable to write event history")
+		}
+	})
+}
+
+// RouteExplain returns a handler that explains which route and backend the
+// router selects for the request described by the query parameters: host,
+// path, method, tls, sni, header (repeated "Name: value") and runtime, which
+// also looks the request up in the maps of the running haproxy.
+func RouteExplain(routerPtr **templateplugin.TemplatePlugin) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if routerPtr == nil || *routerPtr == nil {
+			http.Error(w, "Router not started", http.StatusServiceUnavailable)
+			return
+		}
+		query := req.URL.Query()
+		explain := templateplugin.ExplainRequest{
+			Host:    query.Get("host"),
+			Path:    query.Get("path"),
+			Method:  query.Get("method"),
+			Headers: http.Header{},
+			SNI:     query.Get("sni"),
+		}
+		if len(explain.Host) == 0 {
+			http.Error(w, "The host parameter is required", http.StatusBadRequest)
+			return
+		}
+		if len(explain.Path) == 0 {
+			explain.Path = "/"
+		}
+		if len(explain.Method) == 0 {
+			explain.Method = http.MethodGet
+		}
+		for _, param := range []struct {
+			name  string
+			value *bool
+		}{{"tls", &explain.TLS}, {"runtime", &explain.Runtime}} {
+			if value := query.Get(param.name); len(value) > 0 {
+				b, err := strconv.ParseBool(value)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid %s parameter: %v", param.name, err), http.StatusBadRequest)
+					return
+				}
+				*param.value = b
+			}
+		}
+		for _, header := range query["header"] {
+			name, value, ok := strings.Cut(header, ":")
+			if !ok || len(strings.TrimSpace(name)) == 0 {
+				http.Error(w, fmt.Sprintf("Invalid header parameter %q, must be \"Name: value\"", header), http.StatusBadRequest)
+				return
+			}
+			explain.Headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode((*routerPtr).ExplainRoute(explain)); err != nil {
+			log.Error(err, "unable to write route explanation")
+		}
+	})
+}
+
 // ProcessRunning returns a healthz check that returns true as long as the provided
 // stopCh is not closed.
 func ProcessRunning(stopCh <-chan struct{}) healthz.HealthChecker {
@@ -68,6 +276,116 @@ func HasSynced(routerPtr **templateplugin.TemplatePlugin) (healthz.HealthChecker
 	}), nil
 }
 
+// ReadinessLevel is how far the router got in loading the routes, each level
+// implying the ones before it.
+type ReadinessLevel int
+
+const (
+	// ReadinessNone is the level of a router that did not sync yet.
+	ReadinessNone ReadinessLevel = iota
+	// ReadinessSyncedRoutes is reached once the existing routes were passed
+	// to the plugin chain.
+	ReadinessSyncedRoutes
+	// ReadinessSyncedEndpoints is reached once the existing endpoints were
+	// passed to the plugin chain.
+	ReadinessSyncedEndpoints
+	// ReadinessConfigWritten is reached once the configuration was written
+	// from the synced routes and endpoints.
+	ReadinessConfigWritten
+	// ReadinessHAProxyLoaded is reached once haproxy loaded that
+	// configuration successfully.
+	ReadinessHAProxyLoaded
+)
+
+var readinessLevelNames = []string{"none", "synced-routes", "synced-endpoints", "first-config-written", "haproxy-loaded"}
+
+func (l ReadinessLevel) String() string {
+	if l < 0 || int(l) >= len(readinessLevelNames) {
+		return fmt.Sprintf("ReadinessLevel(%d)", int(l))
+	}
+	return readinessLevelNames[l]
+}
+
+// ParseReadinessLevel returns the readiness level with the given name.
+func ParseReadinessLevel(name string) (ReadinessLevel, error) {
+	for i, n := range readinessLevelNames {
+		if n == name {
+			return ReadinessLevel(i), nil
+		}
+	}
+	return ReadinessNone, fmt.Errorf("unknown readiness level %q, must be one of %s", name, strings.Join(readinessLevelNames[1:], ", "))
+}
+
+// Readiness is the readiness level of the router and when it last committed
+// its state and haproxy last loaded it, for liveness heuristics.
+type Readiness struct {
+	Level      string     `json:"level"`
+	LastCommit *time.Time `json:"lastCommit,omitempty"`
+	LastReload *time.Time `json:"lastReload,omitempty"`
+}
+
+// readinessOf returns the readiness level of the router and its freshness.
+func readinessOf(router *templateplugin.TemplatePlugin, controller *routercontroller.RouterController) (ReadinessLevel, templateplugin.Freshness) {
+	if router == nil || controller == nil {
+		return ReadinessNone, templateplugin.Freshness{}
+	}
+	freshness := router.Freshness()
+	routes, endpoints := controller.Synced()
+	switch {
+	case !routes:
+		return ReadinessNone, freshness
+	case !endpoints:
+		return ReadinessSyncedRoutes, freshness
+	case freshness.LastCommit.IsZero():
+		return ReadinessSyncedEndpoints, freshness
+	case freshness.LastReload.IsZero():
+		return ReadinessConfigWritten, freshness
+	}
+	return ReadinessHAProxyLoaded, freshness
+}
+
+// ReadinessReached returns a healthz check that verifies the router reached
+// at least the given readiness level.
+// routerPtr and controllerPtr are pointers for the same reason as in
+// HasSynced.
+func ReadinessReached(routerPtr **templateplugin.TemplatePlugin, controllerPtr **routercontroller.RouterController, min ReadinessLevel) (healthz.HealthChecker, error) {
+	if routerPtr == nil || controllerPtr == nil {
+		return nil, fmt.Errorf("Nil routerPtr or controllerPtr passed to ReadinessReached")
+	}
+
+	return healthz.NamedCheck("readiness-level", func(r *http.Request) error {
+		level, _ := readinessOf(*routerPtr, *controllerPtr)
+		if level < min {
+			return fmt.Errorf("Router readiness level is %s, %s is required", level, min)
+		}
+		return nil
+	}), nil
+}
+
+// ReadinessStatus returns a handler that serves the readiness level of the
+// router and when it last committed its state and haproxy last loaded it as
+// JSON.
+func ReadinessStatus(routerPtr **templateplugin.TemplatePlugin, controllerPtr **routercontroller.RouterController) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var level ReadinessLevel
+		var freshness templateplugin.Freshness
+		if routerPtr != nil && controllerPtr != nil {
+			level, freshness = readinessOf(*routerPtr, *controllerPtr)
+		}
+		readiness := Readiness{Level: level.String()}
+		if !freshness.LastCommit.IsZero() {
+			readiness.LastCommit = &freshness.LastCommit
+		}
+		if !freshness.LastReload.IsZero() {
+			readiness.LastReload = &freshness.LastReload
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(readiness); err != nil {
+			log.Error(err, "unable to write readiness")
+		}
+	})
+}
+
 func ControllerLive() healthz.HealthChecker {
 	return healthz.NamedCheck("controller", func(r *http.Request) error {
 		return nil
@@ -18,7 +18,9 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
 
 	logf "github.com/openshift/router/log"
 	"github.com/openshift/router/pkg/router/shutdown"
@@ -40,6 +42,13 @@ type Listener struct {
 
 	LiveChecks  []healthz.HealthChecker
 	ReadyChecks []healthz.HealthChecker
+
+	// DisableMetrics stops serving the Prometheus metrics at /metrics.
+	DisableMetrics bool
+
+	// DebugHandlers are served by path behind the same authorization as
+	// the metrics.
+	DebugHandlers map[string]http.Handler
 }
 
 func (l Listener) handler() http.Handler {
@@ -52,7 +61,12 @@ func (l Listener) handler() http.Handler {
 		protected.HandleFunc("/debug/pprof/", pprof.Index)
 		protected.HandleFunc("/debug/pprof/profile", pprof.Profile)
 		protected.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-		protected.Handle("/metrics", promhttp.Handler())
+		if !l.DisableMetrics {
+			protected.Handle("/metrics", promhttp.Handler())
+		}
+		for path, handler := range l.DebugHandlers {
+			protected.Handle(path, handler)
+		}
 		mux.Handle("/", l.authorizeHandler(protected))
 	}
 	return mux
@@ -63,7 +77,7 @@ func (l Listener) authorizeHandler(protected http.Handler) http.Handler {
 		if len(l.Username) > 0 || len(l.Password) > 0 {
 			if u, p, ok := req.BasicAuth(); ok {
 				if u == l.Username && p == l.Password {
-					protected.ServeHTTP(w, req)
+					protected.ServeHTTP(w, req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: u})))
 				} else {
 					http.Error(w, fmt.Sprintf("Unauthorized"), http.StatusUnauthorized)
 				}
@@ -71,7 +85,7 @@ func (l Listener) authorizeHandler(protected http.Handler) http.Handler {
 			}
 		}
 
-		user, ok, err := l.Authenticator.AuthenticateRequest(req)
+		resp, ok, err := l.Authenticator.AuthenticateRequest(req)
 		if !ok || err != nil {
 			// older routers will not have permission to check token access review, so treat this
 			// as an authorization denied if so
@@ -105,7 +119,7 @@ func (l Listener) authorizeHandler(protected http.Handler) http.Handler {
 		case strings.HasPrefix(req.URL.Path, "/debug/"):
 			scopedRecord.Subresource = "debug"
 		}
-		scopedRecord.User = user.User
+		scopedRecord.User = resp.User
 		authorized, reason, err := l.Authorizer.Authorize(context.TODO(), scopedRecord)
 		if err != nil {
 			log.V(3).Info("unable to authorize", "error", err)
@@ -117,7 +131,7 @@ func (l Listener) authorizeHandler(protected http.Handler) http.Handler {
 			http.Error(w, fmt.Sprintf("Forbidden: %s", reason), http.StatusForbidden)
 			return
 		}
-		protected.ServeHTTP(w, req)
+		protected.ServeHTTP(w, req.WithContext(request.WithUser(req.Context(), resp.User)))
 	})
 }
 
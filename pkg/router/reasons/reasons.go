@@ -0,0 +1,225 @@
+// Package reasons is the registry of the reasons the router reports in the
+// conditions it sets on routes, in the rejections it records and in the
+// errors of the routes it retries.  The reasons are stable, CamelCase and
+// machine readable, so that automation can act on them; the messages that
+// come with them are for people and carry the details, such as the value
+// that failed validation, and may change at any time.
+package reasons
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// The reasons of the rejections of routes, reported in an Admitted
+// condition that is false.
+const (
+	ExtendedValidationFailed      = "ExtendedValidationFailed"
+	InvalidHost                   = "InvalidHost"
+	InvalidTimeout                = "InvalidTimeout"
+	InvalidHostRewrite            = "InvalidHostRewrite"
+	InvalidBackendTLSOptions      = "InvalidBackendTLSOptions"
+	InvalidTCPOptions             = "InvalidTCPOptions"
+	InvalidConnectionPoolOptions  = "InvalidConnectionPoolOptions"
+	InvalidQueueOptions           = "InvalidQueueOptions"
+	InvalidBandwidthLimits        = "InvalidBandwidthLimits"
+	InvalidResponseCache          = "InvalidResponseCache"
+	InvalidConsistentHash         = "InvalidConsistentHash"
+	InvalidAccessLog              = "InvalidAccessLog"
+	InvalidResponseHeaderPolicy   = "InvalidResponseHeaderPolicy"
+	InvalidDenyRules              = "InvalidDenyRules"
+	InvalidRedirectRules          = "InvalidRedirectRules"
+	InvalidRedirectHost           = "InvalidRedirectHost"
+	InvalidExternalServerOptions  = "InvalidExternalServerOptions"
+	InvalidIPWhitelist            = "InvalidIPWhitelist"
+	InvalidGRPC                   = "InvalidGRPC"
+	InvalidBackupService          = "InvalidBackupService"
+	InvalidBlueGreen              = "InvalidBlueGreen"
+	InvalidCookieAttributes       = "InvalidCookieAttributes"
+	InvalidLeastRequestWeighting  = "InvalidLeastRequestWeighting"
+	InvalidWAF                    = "InvalidWAF"
+	InvalidTracingOptions         = "InvalidTracingOptions"
+	InvalidURINormalizers         = "InvalidURINormalizers"
+	InvalidHealthCheckMaxInterval = "InvalidHealthCheckMaxInterval"
+	InvalidActivationWindows      = "InvalidActivationWindows"
+	InvalidHTTPCompatOptions      = "InvalidHTTPCompatOptions"
+	InvalidSetForwardedHeaders    = "InvalidSetForwardedHeaders"
+	InvalidALPNProtocols          = "InvalidALPNProtocols"
+	InvalidConfigSnippet          = "InvalidConfigSnippet"
+	InvalidTCPRoute               = "InvalidTCPRoute"
+	TCPPortUnavailable            = "TCPPortUnavailable"
+	RouteNotAdmitted              = "RouteNotAdmitted"
+	NoHostValue                   = "NoHostValue"
+	HostAlreadyClaimed            = "HostAlreadyClaimed"
+	HostTransferred               = "HostTransferred"
+	HostForbidden                 = "HostForbidden"
+	ComplianceViolation           = "ComplianceViolation"
+	InvalidConfiguration          = "InvalidConfiguration"
+	RouterCapacityExceeded        = "RouterCapacityExceeded"
+)
+
+// The reasons of the other conditions of routes.
+const (
+	StandbyRouter            = "StandbyRouter"
+	DeprecatedAnnotations    = "DeprecatedAnnotations"
+	UnknownAnnotations       = "UnknownAnnotations"
+	RouteClassChanged        = "RouteClassChanged"
+	NoReadyEndpoints         = "NoReadyEndpoints"
+	TargetPortNotServed      = "TargetPortNotServed"
+	ServiceNotFound          = "ServiceNotFound"
+	TargetPortNotFound       = "TargetPortNotFound"
+	CertificateNotPresented  = "CertificateNotPresented"
+	CertificateRevoked       = "CertificateRevoked"
+	IssuerDistrusted         = "IssuerDistrusted"
+	IssuerDistrustScheduled  = "IssuerDistrustScheduled"
+	TCPPortAllocated         = "TCPPortAllocated"
+	ConfigSnippetCheckFailed = "ConfigSnippetCheckFailed"
+)
+
+// The reasons only found in events: the changes of the capacity of the
+// router, in the Kubernetes events it records.
+const (
+	RouterCapacityNearing   = "RouterCapacityNearing"
+	RouterCapacityAvailable = "RouterCapacityAvailable"
+)
+
+// Reason describes a reason of the registry.
+type Reason struct {
+	// Name is the value of the reason field.
+	Name string
+	// Condition is the type of the route conditions the reason is reported
+	// in, or empty if it is only reported in events.
+	Condition routev1.RouteIngressConditionType
+	// Description tells what the reason means and what to do about it.
+	Description string
+}
+
+// The types of the route conditions the router reports.  They are defined
+// again here, rather than imported, as the registry sits below the packages
+// that report them.
+const (
+	conditionAdmitted            routev1.RouteIngressConditionType = routev1.RouteAdmitted
+	conditionStandby             routev1.RouteIngressConditionType = "Standby"
+	conditionAnnotationWarnings  routev1.RouteIngressConditionType = "AnnotationWarnings"
+	conditionMigrating           routev1.RouteIngressConditionType = "Migrating"
+	conditionBackendsAvailable   routev1.RouteIngressConditionType = "BackendsAvailable"
+	conditionEndpointsSkipped    routev1.RouteIngressConditionType = "EndpointsSkipped"
+	conditionServiceNotFound     routev1.RouteIngressConditionType = "ServiceNotFound"
+	conditionCertificateConflict routev1.RouteIngressConditionType = "CertificateConflict"
+	conditionCertificateWarnings routev1.RouteIngressConditionType = "CertificateWarnings"
+	conditionTCPPortAllocated    routev1.RouteIngressConditionType = "TCPPortAllocated"
+	conditionRetrying            routev1.RouteIngressConditionType = "Retrying"
+)
+
+// registry lists every reason the router reports.
+var registry = []Reason{
+	{ExtendedValidationFailed, conditionAdmitted, "The certificates, keys or destination CA of the route failed extended validation."},
+	{InvalidHost, conditionAdmitted, "The host of the route is not a valid DNS name, or an internationalized name the router does not allow."},
+	{InvalidTimeout, conditionAdmitted, "The timeout annotations of the route make its tunnel timeout shorter than its server timeout, and the router rejects such routes."},
+	{InvalidHostRewrite, conditionAdmitted, "The rewrite-host annotation of the route is invalid."},
+	{InvalidBackendTLSOptions, conditionAdmitted, "A backend TLS annotation of the route is invalid."},
+	{InvalidTCPOptions, conditionAdmitted, "A backend TCP option annotation of the route is invalid."},
+	{InvalidConnectionPoolOptions, conditionAdmitted, "A connection pool annotation of the route is invalid."},
+	{InvalidQueueOptions, conditionAdmitted, "A queue annotation of the route is invalid."},
+	{InvalidBandwidthLimits, conditionAdmitted, "A bandwidth limit annotation of the route is invalid."},
+	{InvalidResponseCache, conditionAdmitted, "A response cache annotation of the route is invalid."},
+	{InvalidConsistentHash, conditionAdmitted, "The consistent-hash annotation of the route is invalid."},
+	{InvalidAccessLog, conditionAdmitted, "The access-log annotation of the route is invalid."},
+	{InvalidResponseHeaderPolicy, conditionAdmitted, "The response header policy annotation of the route is invalid."},
+	{InvalidDenyRules, conditionAdmitted, "The deny-rules annotation of the route is invalid."},
+	{InvalidRedirectRules, conditionAdmitted, "The redirect-rules annotation of the route is invalid or redirects in a loop."},
+	{InvalidRedirectHost, conditionAdmitted, "The redirect-host annotation of the route is invalid or redirects in a loop."},
+	{InvalidExternalServerOptions, conditionAdmitted, "An external server annotation of the route is invalid."},
+	{InvalidIPWhitelist, conditionAdmitted, "The ip_whitelist annotation of the route is invalid."},
+	{InvalidGRPC, conditionAdmitted, "The grpc annotation of the route is invalid."},
+	{InvalidBackupService, conditionAdmitted, "The backup-service annotation of the route is invalid."},
+	{InvalidBlueGreen, conditionAdmitted, "The blue-green annotations of the route are invalid."},
+	{InvalidCookieAttributes, conditionAdmitted, "A cookie annotation of the route is invalid."},
+	{InvalidLeastRequestWeighting, conditionAdmitted, "The least-request weighting annotation of the route is invalid."},
+	{InvalidWAF, conditionAdmitted, "The waf annotation of the route is invalid."},
+	{InvalidTracingOptions, conditionAdmitted, "A tracing annotation of the route is invalid."},
+	{InvalidURINormalizers, conditionAdmitted, "The normalize-uri annotation of the route is invalid."},
+	{InvalidHealthCheckMaxInterval, conditionAdmitted, "The health check interval annotation of the route is invalid."},
+	{InvalidActivationWindows, conditionAdmitted, "The activation window annotation of the route is invalid."},
+	{InvalidHTTPCompatOptions, conditionAdmitted, "The http-compat annotation of the route is invalid."},
+	{InvalidSetForwardedHeaders, conditionAdmitted, "The set-forwarded-headers annotation of the route is invalid."},
+	{InvalidALPNProtocols, conditionAdmitted, "The ALPN annotation of the route is invalid."},
+	{InvalidConfigSnippet, conditionAdmitted, "The config snippet of the route uses a directive the router does not allow or haproxy rejects it."},
+	{InvalidTCPRoute, conditionAdmitted, "The TCP port annotation of the route is invalid or the route cannot be a TCP route."},
+	{TCPPortUnavailable, conditionAdmitted, "The TCP port the route asks for is taken or out of the range of the router."},
+	{RouteNotAdmitted, conditionAdmitted, "The admission policy of the router, such as its wildcard policy, does not allow the route."},
+	{NoHostValue, conditionAdmitted, "The route has no host and the router cannot generate one."},
+	{HostAlreadyClaimed, conditionAdmitted, "An older route, or a route of the namespace that owns the host, exposes the host and path of the route."},
+	{HostTransferred, conditionAdmitted, "The namespace of the route transferred its host to another namespace."},
+	{HostForbidden, conditionAdmitted, "The host of the route is in a domain the router forbids."},
+	{ComplianceViolation, conditionAdmitted, "The certificates of the route do not comply with the FIPS policy of the router."},
+	{InvalidConfiguration, conditionAdmitted, "haproxy rejected the configuration of the route."},
+	{RouterCapacityExceeded, conditionAdmitted, "Admitting the route would exceed a capacity limit of the router, such as its ACLs, map entries or certificates."},
+	{StandbyRouter, conditionStandby, "The router is a standby and does not serve the route until it is promoted."},
+	{DeprecatedAnnotations, conditionAnnotationWarnings, "The route has deprecated haproxy router annotations."},
+	{UnknownAnnotations, conditionAnnotationWarnings, "The route has haproxy router annotations the router does not know."},
+	{RouteClassChanged, conditionMigrating, "The route moved to another route class, and the router serves it until a router of that class admits it."},
+	{NoReadyEndpoints, conditionBackendsAvailable, "No endpoint of the services of the route is ready."},
+	{TargetPortNotServed, conditionEndpointsSkipped, "Endpoints of the services of the route do not serve its target port."},
+	{ServiceNotFound, conditionServiceNotFound, "A service of the route does not exist."},
+	{TargetPortNotFound, conditionServiceNotFound, "A service of the route does not have the target port of the route."},
+	{CertificateNotPresented, conditionCertificateConflict, "Another route presents a certificate for the host of the route in place of its own."},
+	{CertificateRevoked, conditionCertificateWarnings, "The CA of the certificate of the route revoked it."},
+	{IssuerDistrusted, conditionCertificateWarnings, "The certificate of the route was issued by a distrusted CA."},
+	{IssuerDistrustScheduled, conditionCertificateWarnings, "The certificate of the route was issued by a CA that is soon to be distrusted."},
+	{TCPPortAllocated, conditionTCPPortAllocated, "The router allocated a dedicated port to the TCP route.  The message is the port number, which the router allocates to the route again when it restarts."},
+	{ConfigSnippetCheckFailed, conditionRetrying, "haproxy could not check the config snippet of the route, which is retried."},
+	{RouterCapacityNearing, "", "The configuration of the router nears a capacity limit, or went back under it but still nears it."},
+	{RouterCapacityAvailable, "", "The configuration of the router is well below a capacity limit again."},
+}
+
+// All returns the reasons of the registry, sorted by condition and name.
+// The reasons reported in no condition come last.
+func All() []Reason {
+	all := append([]Reason(nil), registry...)
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].Condition != all[j].Condition {
+			if len(all[i].Condition) == 0 || len(all[j].Condition) == 0 {
+				return len(all[j].Condition) == 0
+			}
+			return all[i].Condition < all[j].Condition
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// Lookup returns the reason of the registry named name, if there is one.
+func Lookup(name string) (Reason, bool) {
+	for _, reason := range registry {
+		if reason.Name == name {
+			return reason, true
+		}
+	}
+	return Reason{}, false
+}
+
+// Markdown returns the documentation of the registry, a table of the
+// reasons per condition.
+func Markdown() []byte {
+	var b bytes.Buffer
+	b.WriteString("# Route status reasons\n\n")
+	b.WriteString("<!-- Generated by hack/reasons-doc from pkg/router/reasons. DO NOT EDIT. -->\n\n")
+	b.WriteString("The reasons the router reports in the conditions of routes, in the rejections\n")
+	b.WriteString("it records and in the errors of the routes it retries.  The reasons are stable\n")
+	b.WriteString("and meant for automation; the messages that come with them carry the details\n")
+	b.WriteString("and may change.\n\n")
+	b.WriteString("| Condition | Reason | Description |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for _, reason := range All() {
+		condition := string(reason.Condition)
+		if len(condition) == 0 {
+			condition = "(events only)"
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", condition, reason.Name, reason.Description)
+	}
+	return b.Bytes()
+}
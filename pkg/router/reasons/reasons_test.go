@@ -0,0 +1,151 @@
+package reasons
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// reasonPattern matches the CamelCase reasons of the registry.
+var reasonPattern = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// TestRegistry tests that every reason constant of the package is in the
+// registry once, with a description.
+func TestRegistry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, reason := range registry {
+		if seen[reason.Name] {
+			t.Errorf("%s is registered more than once", reason.Name)
+		}
+		seen[reason.Name] = true
+		if !reasonPattern.MatchString(reason.Name) {
+			t.Errorf("%s is not CamelCase", reason.Name)
+		}
+		if len(reason.Description) == 0 || !strings.HasSuffix(reason.Description, ".") {
+			t.Errorf("%s needs a description that is a sentence", reason.Name)
+		}
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "reasons.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for i, name := range spec.(*ast.ValueSpec).Names {
+				if !name.IsExported() {
+					continue
+				}
+				value, ok := spec.(*ast.ValueSpec).Values[i].(*ast.BasicLit)
+				if !ok || value.Value != `"`+name.Name+`"` {
+					t.Errorf("reason %s must be its own name", name.Name)
+				}
+				if _, ok := Lookup(name.Name); !ok {
+					t.Errorf("reason %s is not registered", name.Name)
+				}
+			}
+		}
+	}
+}
+
+// TestMarkdown tests that the documentation of the reasons is up to date.
+func TestMarkdown(t *testing.T) {
+	doc, err := ioutil.ReadFile("../../../docs/route-status-reasons.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(doc, Markdown()) {
+		t.Errorf("docs/route-status-reasons.md is out of date, run make update-reasons-doc")
+	}
+}
+
+// TestNoFreeFormReasons tests that the router only reports the reasons of
+// the registry: the reasons of the rejections, route errors and conditions
+// of the router packages must not be string literals.
+func TestNoFreeFormReasons(t *testing.T) {
+	// reasonArgs are the functions taking a reason, and the index of the
+	// reason in their arguments.
+	reasonArgs := map[string]int{
+		"RecordRouteRejection":   1,
+		"reject":                 1,
+		"NewRouteError":          0,
+		"NewRetriableRouteError": 0,
+	}
+	// isReason returns true if the assignment of a variable or field is
+	// that of a reason.
+	isReason := func(expr ast.Expr) bool {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return strings.Contains(strings.ToLower(e.Name), "reason") || e.Name == "rejection"
+		case *ast.SelectorExpr:
+			return e.Sel.Name == "Reason"
+		}
+		return false
+	}
+	isLiteral := func(expr ast.Expr) bool {
+		lit, ok := expr.(*ast.BasicLit)
+		return ok && lit.Kind == token.STRING
+	}
+
+	fset := token.NewFileSet()
+	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && filepath.Base(path) == "reasons" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			var literal ast.Expr
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				name := ""
+				switch fun := n.Fun.(type) {
+				case *ast.Ident:
+					name = fun.Name
+				case *ast.SelectorExpr:
+					name = fun.Sel.Name
+				}
+				if i, ok := reasonArgs[name]; ok && i < len(n.Args) && isLiteral(n.Args[i]) {
+					literal = n.Args[i]
+				}
+			case *ast.KeyValueExpr:
+				if key, ok := n.Key.(*ast.Ident); ok && key.Name == "Reason" && isLiteral(n.Value) {
+					literal = n.Value
+				}
+			case *ast.AssignStmt:
+				for i, lhs := range n.Lhs {
+					if i < len(n.Rhs) && isReason(lhs) && isLiteral(n.Rhs[i]) {
+						literal = n.Rhs[i]
+					}
+				}
+			}
+			if literal != nil {
+				t.Errorf("%s: free-form reason %s, add it to the registry of pkg/router/reasons", fset.Position(literal.Pos()), literal.(*ast.BasicLit).Value)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
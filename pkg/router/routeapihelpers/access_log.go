@@ -0,0 +1,82 @@
+package routeapihelpers
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// AccessLogAnnotation sets which requests of a route are logged to the
+// syslog of the router: all of them (all), one in N of them (sample:<N>),
+// or only those that fail with a server error (errors).  The logged
+// requests pass the log level of the router.
+const AccessLogAnnotation = "haproxy.router.openshift.io/access-log"
+
+// The access log modes of a route.
+const (
+	AccessLogAll    = "all"
+	AccessLogSample = "sample"
+	AccessLogErrors = "errors"
+)
+
+// maxAccessLogSampleRatio bounds the ratio of the sampled access logs.
+const maxAccessLogSampleRatio = 1000000
+
+// AccessLog is the access log mode of a route.
+type AccessLog struct {
+	// Mode is all, sample or errors, or empty if the requests of the
+	// route are logged like those of the other routes.
+	Mode string
+	// SampleRatio is N if one in N requests are logged.
+	SampleRatio int
+}
+
+// Enabled returns whether the route sets its access log mode.
+func (l AccessLog) Enabled() bool {
+	return len(l.Mode) > 0
+}
+
+// GetAccessLog returns the access log mode of a route.  Passthrough and TCP
+// routes have no HTTP requests to log one by one, so they are rejected.  No
+// mode is returned with the errors of an invalid annotation.
+func GetAccessLog(route *routev1.Route) (AccessLog, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[AccessLogAnnotation]
+	if !ok {
+		return AccessLog{}, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(AccessLogAnnotation)
+
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return AccessLog{}, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	if IsTCPRoute(route) {
+		return AccessLog{}, append(result, field.Invalid(fldPath, value, "is not supported for TCP routes"))
+	}
+
+	mode, ratio, hasRatio := strings.Cut(strings.TrimSpace(value), ":")
+	switch mode {
+	case AccessLogAll, AccessLogErrors:
+		if hasRatio {
+			return AccessLog{}, append(result, field.Invalid(fldPath, value, mode+" takes no ratio"))
+		}
+		return AccessLog{Mode: mode}, result
+	case AccessLogSample:
+		n, err := strconv.Atoi(ratio)
+		if err != nil || n < 1 || n > maxAccessLogSampleRatio {
+			return AccessLog{}, append(result, field.Invalid(fldPath, value, "must set the ratio as sample:<N>, with N between 1 and "+strconv.Itoa(maxAccessLogSampleRatio)))
+		}
+		return AccessLog{Mode: mode, SampleRatio: n}, result
+	}
+	return AccessLog{}, append(result, field.Invalid(fldPath, value, "must be all, errors or sample:<N>"))
+}
+
+// ValidateAccessLog checks that the access log annotation of a route is
+// valid.
+func ValidateAccessLog(route *routev1.Route) field.ErrorList {
+	_, result := GetAccessLog(route)
+	return result
+}
@@ -0,0 +1,87 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetAccessLog(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		tls         *routev1.TLSConfig
+		expected    AccessLog
+		expectErr   bool
+	}{
+		{name: "none"},
+		{
+			name:        "all",
+			annotations: map[string]string{AccessLogAnnotation: " all "},
+			expected:    AccessLog{Mode: AccessLogAll},
+		},
+		{
+			name:        "errors",
+			annotations: map[string]string{AccessLogAnnotation: "errors"},
+			tls:         &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+			expected:    AccessLog{Mode: AccessLogErrors},
+		},
+		{
+			name:        "sample",
+			annotations: map[string]string{AccessLogAnnotation: "sample:100"},
+			expected:    AccessLog{Mode: AccessLogSample, SampleRatio: 100},
+		},
+		{
+			name:        "sample without a ratio",
+			annotations: map[string]string{AccessLogAnnotation: "sample"},
+			expectErr:   true,
+		},
+		{
+			name:        "zero ratio",
+			annotations: map[string]string{AccessLogAnnotation: "sample:0"},
+			expectErr:   true,
+		},
+		{
+			name:        "ratio too large",
+			annotations: map[string]string{AccessLogAnnotation: "sample:1000001"},
+			expectErr:   true,
+		},
+		{
+			name:        "all with a ratio",
+			annotations: map[string]string{AccessLogAnnotation: "all:2"},
+			expectErr:   true,
+		},
+		{
+			name:        "unknown mode",
+			annotations: map[string]string{AccessLogAnnotation: "verbose"},
+			expectErr:   true,
+		},
+		{
+			name:        "passthrough",
+			annotations: map[string]string{AccessLogAnnotation: "all"},
+			tls:         &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough},
+			expectErr:   true,
+		},
+		{
+			name:        "tcp",
+			annotations: map[string]string{AccessLogAnnotation: "all", TCPPortAnnotation: ""},
+			expectErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations},
+			Spec:       routev1.RouteSpec{TLS: tc.tls},
+		}
+		accessLog, errs := GetAccessLog(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if accessLog != tc.expected {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, accessLog)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// ActiveWindowsAnnotation limits when a route is served to the given
+	// windows; the route is in maintenance outside of them.
+	ActiveWindowsAnnotation = "router.openshift.io/active-windows"
+	// MaintenanceWindowsAnnotation puts a route in maintenance during the
+	// given windows, even within its active windows.
+	MaintenanceWindowsAnnotation = "router.openshift.io/maintenance-windows"
+
+	// maxActivationWindowDuration is how long a window lasts at most.
+	maxActivationWindowDuration = 7 * 24 * time.Hour
+)
+
+// ActivationWindows are the windows a route is served or in maintenance in.
+// A route in maintenance has its servers disabled, so that its requests are
+// answered by the router with a 503.
+type ActivationWindows struct {
+	// Active are the windows the route is served in.  The route is
+	// always served if there are none.
+	Active []ActivationWindow
+	// Maintenance are the windows the route is in maintenance.
+	Maintenance []ActivationWindow
+}
+
+// ActivationWindow is a window that opens at the minutes a cron schedule
+// matches, in UTC, and stays open for a duration.
+type ActivationWindow struct {
+	schedule cronSchedule
+	// Duration is how long the window stays open.
+	Duration time.Duration
+}
+
+// IsZero returns whether there are no windows.
+func (w ActivationWindows) IsZero() bool {
+	return len(w.Active) == 0 && len(w.Maintenance) == 0
+}
+
+// InMaintenance returns whether a route with the windows is in maintenance
+// at t: within one of its maintenance windows, or outside of all of its
+// active windows.
+func (w ActivationWindows) InMaintenance(t time.Time) bool {
+	for _, window := range w.Maintenance {
+		if window.Contains(t) {
+			return true
+		}
+	}
+	if len(w.Active) == 0 {
+		return false
+	}
+	for _, window := range w.Active {
+		if window.Contains(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains returns whether the window is open at t.
+func (w ActivationWindow) Contains(t time.Time) bool {
+	t = t.UTC()
+	return w.schedule.matchesSince(t, t.Add(-w.Duration))
+}
+
+// GetActivationWindows returns the activation windows of a route.
+func GetActivationWindows(route *routev1.Route) (ActivationWindows, field.ErrorList) {
+	return ParseActivationWindows(route.Annotations)
+}
+
+// ParseActivationWindows returns the activation windows set by the
+// annotations of a route.  Each annotation is a list of windows separated
+// by semicolons, written as a five-field cron schedule of the minutes the
+// window opens at followed by how long it stays open, e.g. "0 2 * * 6 4h"
+// for four hours from 2am UTC every Saturday.
+func ParseActivationWindows(annotations map[string]string) (ActivationWindows, field.ErrorList) {
+	windows := ActivationWindows{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	for _, annotation := range []string{ActiveWindowsAnnotation, MaintenanceWindowsAnnotation} {
+		value, ok := annotations[annotation]
+		if !ok {
+			continue
+		}
+		var parsed []ActivationWindow
+		for _, spec := range strings.Split(value, ";") {
+			if len(strings.TrimSpace(spec)) == 0 {
+				continue
+			}
+			window, err := parseActivationWindow(spec)
+			if err != nil {
+				result = append(result, field.Invalid(fldPath.Key(annotation), value, err.Error()))
+				continue
+			}
+			parsed = append(parsed, window)
+		}
+		if len(parsed) == 0 && len(result) == 0 {
+			result = append(result, field.Invalid(fldPath.Key(annotation), value, "must list at least one window"))
+		}
+		if annotation == ActiveWindowsAnnotation {
+			windows.Active = parsed
+		} else {
+			windows.Maintenance = parsed
+		}
+	}
+
+	if len(result) > 0 {
+		return ActivationWindows{}, result
+	}
+	return windows, result
+}
+
+// ValidateActivationWindows checks that the activation windows of a route
+// are valid.
+func ValidateActivationWindows(route *routev1.Route) field.ErrorList {
+	_, result := GetActivationWindows(route)
+	return result
+}
+
+// parseActivationWindow parses a window written as a cron schedule followed
+// by a duration.
+func parseActivationWindow(spec string) (ActivationWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 6 {
+		return ActivationWindow{}, fmt.Errorf("window %q must be a cron schedule of 5 fields followed by a duration", strings.TrimSpace(spec))
+	}
+	schedule, err := parseCronSchedule(fields[:5])
+	if err != nil {
+		return ActivationWindow{}, fmt.Errorf("window %q: %v", strings.TrimSpace(spec), err)
+	}
+	duration, err := time.ParseDuration(fields[5])
+	if err != nil || duration < time.Minute || duration > maxActivationWindowDuration {
+		return ActivationWindow{}, fmt.Errorf("window %q: duration must be between 1m and %v", strings.TrimSpace(spec), maxActivationWindowDuration)
+	}
+	return ActivationWindow{schedule: schedule, Duration: duration}, nil
+}
+
+// cronSchedule is a cron schedule with one bit set per matching value of each
+// field.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// anyDay is true if the day of the month or the day of the week is
+	// "*", in which case both must match, as opposed to either.
+	anyDay bool
+}
+
+// cronFields are the names and bounds of the fields of a cron schedule.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCronSchedule parses the minute, hour, day of month, month and day of
+// week fields of a cron schedule, each a list of values, ranges and "*",
+// optionally with a step.  Sunday is either 0 or 7.
+func parseCronSchedule(fields []string) (cronSchedule, error) {
+	bits := make([]uint64, len(cronFields))
+	for i, f := range cronFields {
+		b, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid %s %q: %v", f.name, fields[i], err)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	return cronSchedule{
+		minute:     bits[0],
+		hour:       bits[1],
+		dayOfMonth: bits[2],
+		month:      bits[3],
+		dayOfWeek:  bits[4],
+		anyDay:     strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField returns the bits of the values between min and max a cron
+// field matches.
+func parseCronField(value string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		values, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("step of %q must be a positive integer", part)
+			}
+			values, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case values == "*":
+		case strings.Contains(values, "-"):
+			bounds := strings.SplitN(values, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("%q is not a range of integers", part)
+			}
+		default:
+			n, err := strconv.Atoi(values)
+			if err != nil {
+				return 0, fmt.Errorf("%q is not an integer", part)
+			}
+			lo = n
+			// A single value with a step starts a range.
+			if step == 1 {
+				hi = n
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is not within %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matchesDay returns whether the schedule matches the day of t.
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.anyDay {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// matchesSince returns whether the schedule matches a minute after since and
+// up to t, skipping the days and hours it does not match.
+func (s cronSchedule) matchesSince(t, since time.Time) bool {
+	m := t.Truncate(time.Minute)
+	for m.After(since) {
+		switch {
+		case !s.matchesDay(m):
+			m = time.Date(m.Year(), m.Month(), m.Day(), 0, 0, 0, 0, m.Location()).Add(-time.Minute)
+		case s.hour&(1<<uint(m.Hour())) == 0:
+			m = time.Date(m.Year(), m.Month(), m.Day(), m.Hour(), 0, 0, 0, m.Location()).Add(-time.Minute)
+		case s.minute&(1<<uint(m.Minute())) == 0:
+			m = m.Add(-time.Minute)
+		default:
+			return true
+		}
+	}
+	return false
+}
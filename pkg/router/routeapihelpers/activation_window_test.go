@@ -0,0 +1,145 @@
+package routeapihelpers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseActivationWindows(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		active      int
+		maintenance int
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "both annotations",
+			annotations: map[string]string{
+				ActiveWindowsAnnotation:      "0 8 * * 1-5 10h",
+				MaintenanceWindowsAnnotation: "0 2 * * 6 4h; */15 * 1 * * 5m",
+			},
+			active:      1,
+			maintenance: 2,
+		},
+		{
+			name:        "sunday as 7",
+			annotations: map[string]string{MaintenanceWindowsAnnotation: "30 23 * * 7 1h"},
+			maintenance: 1,
+		},
+		{
+			name:        "missing duration",
+			annotations: map[string]string{MaintenanceWindowsAnnotation: "0 2 * * 6"},
+			errs:        1,
+		},
+		{
+			name:        "minute out of range",
+			annotations: map[string]string{MaintenanceWindowsAnnotation: "60 2 * * 6 1h"},
+			errs:        1,
+		},
+		{
+			name:        "reversed range",
+			annotations: map[string]string{ActiveWindowsAnnotation: "0 17-8 * * * 1h"},
+			errs:        1,
+		},
+		{
+			name:        "zero step",
+			annotations: map[string]string{ActiveWindowsAnnotation: "*/0 * * * * 1h"},
+			errs:        1,
+		},
+		{
+			name:        "duration too long",
+			annotations: map[string]string{MaintenanceWindowsAnnotation: "0 0 1 * * 200h"},
+			errs:        1,
+		},
+		{
+			name:        "duration too short",
+			annotations: map[string]string{MaintenanceWindowsAnnotation: "0 0 1 * * 30s"},
+			errs:        1,
+		},
+		{
+			name:        "empty list",
+			annotations: map[string]string{ActiveWindowsAnnotation: " ; "},
+			errs:        1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			windows, errs := ParseActivationWindows(tc.annotations)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if len(windows.Active) != tc.active || len(windows.Maintenance) != tc.maintenance {
+				t.Errorf("expected %d active and %d maintenance windows, got %#v", tc.active, tc.maintenance, windows)
+			}
+		})
+	}
+}
+
+func TestActivationWindowsInMaintenance(t *testing.T) {
+	windows, errs := ParseActivationWindows(map[string]string{
+		// Weekdays from 8am to 6pm.
+		ActiveWindowsAnnotation: "0 8 * * 1-5 10h",
+		// The first day of the month from noon to 1pm.
+		MaintenanceWindowsAnnotation: "0 12 1 * * 1h",
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	tests := []struct {
+		time        string
+		maintenance bool
+	}{
+		// Wednesday.
+		{"2026-07-15T07:59:00Z", true},
+		{"2026-07-15T08:00:00Z", false},
+		{"2026-07-15T17:59:59Z", false},
+		{"2026-07-15T18:00:00Z", true},
+		// Saturday.
+		{"2026-07-18T10:00:00Z", true},
+		// Wednesday the first.
+		{"2026-07-01T11:59:00Z", false},
+		{"2026-07-01T12:30:00+02:00", false},
+		{"2026-07-01T12:30:00Z", true},
+		{"2026-07-01T13:00:00Z", false},
+	}
+	for _, tc := range tests {
+		now, err := time.Parse(time.RFC3339, tc.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maintenance := windows.InMaintenance(now); maintenance != tc.maintenance {
+			t.Errorf("%s: expected maintenance %t, got %t", tc.time, tc.maintenance, maintenance)
+		}
+	}
+}
+
+func TestActivationWindowAcrossDays(t *testing.T) {
+	windows, errs := ParseActivationWindows(map[string]string{
+		// From Friday 10pm for the whole weekend.
+		MaintenanceWindowsAnnotation: "0 22 * * 5 56h",
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, tc := range []struct {
+		time        string
+		maintenance bool
+	}{
+		{"2026-07-17T21:59:00Z", false},
+		{"2026-07-17T22:00:00Z", true},
+		{"2026-07-19T12:00:00Z", true},
+		{"2026-07-20T05:59:00Z", true},
+		{"2026-07-20T06:00:00Z", false},
+	} {
+		now, _ := time.Parse(time.RFC3339, tc.time)
+		if maintenance := windows.InMaintenance(now); maintenance != tc.maintenance {
+			t.Errorf("%s: expected maintenance %t, got %t", tc.time, tc.maintenance, maintenance)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// ALPNAnnotation is a comma separated list of the ALPN protocols the router
+// advertises to the clients of the host of a route, in order of preference,
+// such as "http/1.1" to keep the clients of a legacy backend on HTTP/1.1.
+// The protocols are set on the crt-list entry of the certificate of the
+// route, so they only apply to edge and re-encrypt routes with a
+// certificate of their own.
+const ALPNAnnotation = "haproxy.router.openshift.io/alpn"
+
+const (
+	// ALPNProtocolH2 is the ALPN protocol of HTTP/2.
+	ALPNProtocolH2 = "h2"
+	// ALPNProtocolHTTP11 is the ALPN protocol of HTTP/1.1.
+	ALPNProtocolHTTP11 = "http/1.1"
+)
+
+// SupportedALPNProtocols are the ALPN protocols routes may advertise.
+var SupportedALPNProtocols = []string{ALPNProtocolH2, ALPNProtocolHTTP11}
+
+// AllowedALPNProtocols returns the ALPN protocols routes may advertise on a
+// router, which are all the supported protocols unless the router disables
+// HTTP/2.
+func AllowedALPNProtocols(disableHTTP2 bool) sets.String {
+	if disableHTTP2 {
+		return sets.NewString(ALPNProtocolHTTP11)
+	}
+	return sets.NewString(SupportedALPNProtocols...)
+}
+
+// GetALPNProtocols returns the ALPN protocols advertised for the host of a
+// route, in order of preference, or nil if the route advertises the router
+// defaults.  The protocols must be in allowed.
+func GetALPNProtocols(route *routev1.Route, allowed sets.String) ([]string, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[ALPNAnnotation]
+	if !ok {
+		return nil, result
+	}
+
+	fldPath := field.NewPath("metadata", "annotations").Key(ALPNAnnotation)
+	if route.Spec.TLS == nil {
+		return nil, append(result, field.Invalid(fldPath, value, "is only supported for routes that terminate TLS"))
+	}
+	if route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return nil, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+
+	var protocols []string
+	seen := sets.NewString()
+	for _, protocol := range strings.Split(value, ",") {
+		protocol = strings.TrimSpace(protocol)
+		if len(protocol) == 0 || seen.Has(protocol) {
+			continue
+		}
+		seen.Insert(protocol)
+		if !allowed.Has(protocol) {
+			if sets.NewString(SupportedALPNProtocols...).Has(protocol) {
+				result = append(result, field.Forbidden(fldPath, fmt.Sprintf("%s is not allowed on this router", protocol)))
+			} else {
+				result = append(result, field.NotSupported(fldPath, protocol, SupportedALPNProtocols))
+			}
+			continue
+		}
+		protocols = append(protocols, protocol)
+	}
+	if len(result) == 0 && len(protocols) == 0 {
+		result = append(result, field.Invalid(fldPath, value, "must list at least one protocol"))
+	}
+
+	if len(result) > 0 {
+		return nil, result
+	}
+	return protocols, result
+}
+
+// ValidateALPNProtocols checks that the ALPN protocols of a route are valid
+// and allowed.
+func ValidateALPNProtocols(route *routev1.Route, allowed sets.String) field.ErrorList {
+	_, result := GetALPNProtocols(route, allowed)
+	return result
+}
@@ -0,0 +1,84 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetALPNProtocols(t *testing.T) {
+	tests := []struct {
+		name         string
+		termination  routev1.TLSTerminationType
+		annotations  map[string]string
+		disableHTTP2 bool
+		expected     []string
+		errs         int
+	}{
+		{
+			name:        "no annotation",
+			termination: routev1.TLSTerminationEdge,
+		},
+		{
+			name:        "http/1.1 only",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{ALPNAnnotation: "http/1.1"},
+			expected:    []string{"http/1.1"},
+		},
+		{
+			name:        "order of preference",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{ALPNAnnotation: "http/1.1, h2,http/1.1"},
+			expected:    []string{"http/1.1", "h2"},
+		},
+		{
+			name:         "h2 with HTTP/2 disabled",
+			termination:  routev1.TLSTerminationEdge,
+			annotations:  map[string]string{ALPNAnnotation: "h2,http/1.1"},
+			disableHTTP2: true,
+			errs:         1,
+		},
+		{
+			name:        "unsupported protocol",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{ALPNAnnotation: "http/1.0"},
+			errs:        1,
+		},
+		{
+			name:        "no protocol",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{ALPNAnnotation: " , "},
+			errs:        1,
+		},
+		{
+			name:        "passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{ALPNAnnotation: "http/1.1"},
+			errs:        1,
+		},
+		{
+			name:        "insecure route",
+			annotations: map[string]string{ALPNAnnotation: "http/1.1"},
+			errs:        1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			protocols, errs := GetALPNProtocols(route, AllowedALPNProtocols(tc.disableHTTP2))
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if !reflect.DeepEqual(protocols, tc.expected) {
+				t.Errorf("expected protocols %v, got %v", tc.expected, protocols)
+			}
+		})
+	}
+}
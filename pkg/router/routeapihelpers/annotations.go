@@ -0,0 +1,188 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// haproxyAnnotationPrefix is the prefix of the annotations that configure
+// the haproxy router.
+const haproxyAnnotationPrefix = "haproxy.router.openshift.io/"
+
+// maxAnnotationTypoDistance is the largest edit distance between an unknown
+// annotation and a known one for the unknown annotation to be reported as a
+// likely typo of the known one.
+const maxAnnotationTypoDistance = 3
+
+// knownAnnotations are the haproxy router annotations routes may set.
+var knownAnnotations = sets.NewString(
+	AccessLogAnnotation,
+	ActiveColorAnnotation,
+	BackendTLSSPKISHA256Annotation,
+	BackendTLSMinVersionAnnotation,
+	BackendTLSVerifyHostnameAnnotation,
+	BackupServiceAnnotation,
+	BandwidthLimitDownloadAnnotation,
+	BandwidthLimitDownloadTotalAnnotation,
+	BandwidthLimitUploadAnnotation,
+	BandwidthLimitUploadTotalAnnotation,
+	ConfigSnippetAnnotation,
+	ConnectTimeoutAnnotation,
+	ConsistentHashAnnotation,
+	DenyRulesAnnotation,
+	ExternalServerCheckAnnotation,
+	ExternalServerProxyProtocolAnnotation,
+	ExternalServerVerifyHostnameAnnotation,
+	GRPCAnnotation,
+	GreenServicesAnnotation,
+	HostRewriteAnnotation,
+	HTTPCompatAnnotation,
+	HTTPReuseAnnotation,
+	LeastRequestWeightingAnnotation,
+	MaxQueueAnnotation,
+	NormalizeURIAnnotation,
+	PodConcurrentConnectionsAnnotation,
+	PoolMaxConnAnnotation,
+	PoolPurgeDelayAnnotation,
+	QueueFullRetryAfterAnnotation,
+	QueueTimeoutAnnotation,
+	RedirectHostAnnotation,
+	RedirectRulesAnnotation,
+	RequestIDHeaderAnnotation,
+	ResponseCacheMaxObjectSizeAnnotation,
+	ResponseCacheSizeAnnotation,
+	ResponseCacheTTLAnnotation,
+	ResponseHeaderPolicyAnnotation,
+	SetForwardedHeadersAnnotation,
+	ALPNAnnotation,
+	TCPAllocatedPortAnnotation,
+	TCPKeepaliveAnnotation,
+	TCPKeepaliveCountAnnotation,
+	TCPKeepaliveIdleAnnotation,
+	TCPKeepaliveIntervalAnnotation,
+	TCPPortAnnotation,
+	TimeoutAnnotation,
+	TraceContextAnnotation,
+	TracingHeaderPolicyAnnotation,
+	TunnelTimeoutAnnotation,
+	WAFAnnotation,
+	// The annotations only the router template reads.
+	"haproxy.router.openshift.io/allow-sni-host-mismatch",
+	"haproxy.router.openshift.io/balance",
+	"haproxy.router.openshift.io/client-concurrent-connections",
+	"haproxy.router.openshift.io/disable_cookies",
+	"haproxy.router.openshift.io/h1-adjust-case",
+	"haproxy.router.openshift.io/hsts_header",
+	"haproxy.router.openshift.io/ip_whitelist",
+	"haproxy.router.openshift.io/rate-limit-connections",
+	"haproxy.router.openshift.io/rate-limit-connections.concurrent-tcp",
+	"haproxy.router.openshift.io/rate-limit-connections.rate-http",
+	"haproxy.router.openshift.io/rate-limit-connections.rate-tcp",
+	"haproxy.router.openshift.io/rewrite-target",
+	"haproxy.router.openshift.io/weight-by-endpoints",
+)
+
+// deprecatedAnnotations are the haproxy router annotations that are still
+// honored but superseded, and the annotations that replace them.  They are
+// added here when an annotation is superseded so that routes still using
+// it are told what to use instead.
+var deprecatedAnnotations = map[string]string{}
+
+// AnnotationWarning is a haproxy router annotation of a route that is
+// unknown to the router, and so has no effect, or that is deprecated.
+type AnnotationWarning struct {
+	// Key is the annotation of the route.
+	Key string
+	// Deprecated is true if the annotation is known but deprecated.
+	Deprecated bool
+	// Suggestion is the known annotation closest to an unknown one, or the
+	// annotation that replaces a deprecated one.  It may be empty.
+	Suggestion string
+}
+
+// String describes the warning.
+func (w AnnotationWarning) String() string {
+	switch {
+	case w.Deprecated && len(w.Suggestion) > 0:
+		return fmt.Sprintf("%s is deprecated, use %s", w.Key, w.Suggestion)
+	case w.Deprecated:
+		return fmt.Sprintf("%s is deprecated", w.Key)
+	case len(w.Suggestion) > 0:
+		return fmt.Sprintf("%s is unknown, did you mean %s?", w.Key, w.Suggestion)
+	default:
+		return fmt.Sprintf("%s is unknown", w.Key)
+	}
+}
+
+// GetAnnotationWarnings returns the haproxy router annotations of a route
+// that are unknown or deprecated, sorted by key.  Unknown annotations close
+// to a known one are reported with the known annotation as a suggestion.
+func GetAnnotationWarnings(route *routev1.Route) []AnnotationWarning {
+	var warnings []AnnotationWarning
+	for key := range route.Annotations {
+		if !strings.HasPrefix(key, haproxyAnnotationPrefix) {
+			continue
+		}
+		if replacement, ok := deprecatedAnnotations[key]; ok {
+			warnings = append(warnings, AnnotationWarning{Key: key, Deprecated: true, Suggestion: replacement})
+			continue
+		}
+		if knownAnnotations.Has(key) {
+			continue
+		}
+		warnings = append(warnings, AnnotationWarning{Key: key, Suggestion: closestKnownAnnotation(key)})
+	}
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Key < warnings[j].Key })
+	return warnings
+}
+
+// closestKnownAnnotation returns the known annotation closest to key, if it
+// is close enough to be a likely typo.  Ties are broken alphabetically.
+func closestKnownAnnotation(key string) string {
+	name := strings.TrimPrefix(key, haproxyAnnotationPrefix)
+	closest, closestDistance := "", maxAnnotationTypoDistance+1
+	for _, known := range knownAnnotations.List() {
+		if distance := editDistance(name, strings.TrimPrefix(known, haproxyAnnotationPrefix)); distance < closestDistance {
+			closest, closestDistance = known, distance
+		}
+	}
+	return closest
+}
+
+// editDistance returns the Levenshtein distance between a and b, case
+// insensitively.
+func editDistance(a, b string) int {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,102 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetAnnotationWarnings(t *testing.T) {
+	deprecatedAnnotations["haproxy.router.openshift.io/test-old"] = "haproxy.router.openshift.io/test-new"
+	deprecatedAnnotations["haproxy.router.openshift.io/test-gone"] = ""
+	defer func() {
+		delete(deprecatedAnnotations, "haproxy.router.openshift.io/test-old")
+		delete(deprecatedAnnotations, "haproxy.router.openshift.io/test-gone")
+	}()
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    []string
+	}{
+		{
+			name: "known annotations",
+			annotations: map[string]string{
+				TimeoutAnnotation:                         "5s",
+				"haproxy.router.openshift.io/balance":     "roundrobin",
+				"router.openshift.io/cookie_name":         "session",
+				"haproxy.router.openshift.io.example/foo": "bar",
+			},
+		},
+		{
+			name: "typos",
+			annotations: map[string]string{
+				"haproxy.router.openshift.io/timout":            "5s",
+				"haproxy.router.openshift.io/ip_allowlist":      "10.0.0.0/8",
+				"haproxy.router.openshift.io/Disable_Cookies":   "true",
+				"haproxy.router.openshift.io/something-else":    "value",
+				"haproxy.router.openshift.io/rate-limit-conns":  "true",
+				"haproxy.router.openshift.io/timeout-tunnel":    "1h",
+				"haproxy.router.openshift.io/hsts-header":       "max-age=31536000",
+				"haproxy.router.openshift.io/tcp-keepalive-cnt": "3",
+			},
+			expected: []string{
+				"haproxy.router.openshift.io/Disable_Cookies is unknown, did you mean haproxy.router.openshift.io/disable_cookies?",
+				"haproxy.router.openshift.io/hsts-header is unknown, did you mean haproxy.router.openshift.io/hsts_header?",
+				"haproxy.router.openshift.io/ip_allowlist is unknown",
+				"haproxy.router.openshift.io/rate-limit-conns is unknown",
+				"haproxy.router.openshift.io/something-else is unknown",
+				"haproxy.router.openshift.io/tcp-keepalive-cnt is unknown, did you mean haproxy.router.openshift.io/tcp-keepalive-count?",
+				"haproxy.router.openshift.io/timout is unknown, did you mean haproxy.router.openshift.io/timeout?",
+			},
+		},
+		{
+			name: "deprecated annotations",
+			annotations: map[string]string{
+				"haproxy.router.openshift.io/test-old":  "true",
+				"haproxy.router.openshift.io/test-gone": "true",
+			},
+			expected: []string{
+				"haproxy.router.openshift.io/test-gone is deprecated",
+				"haproxy.router.openshift.io/test-old is deprecated, use haproxy.router.openshift.io/test-new",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+			}
+			var got []string
+			for _, warning := range GetAnnotationWarnings(route) {
+				got = append(got, warning.String())
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"timeout", "timeout", 0},
+		{"timout", "timeout", 1},
+		{"Timeout", "timeout", 0},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, tc := range tests {
+		if got := editDistance(tc.a, tc.b); got != tc.expected {
+			t.Errorf("expected the distance between %q and %q to be %d, got %d", tc.a, tc.b, tc.expected, got)
+		}
+	}
+}
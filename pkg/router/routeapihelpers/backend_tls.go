@@ -0,0 +1,138 @@
+package routeapihelpers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/cert"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// BackendTLSVerifyHostnameAnnotation sets the name the certificate of
+	// the backend of a reencrypt route is verified against.
+	BackendTLSVerifyHostnameAnnotation = "haproxy.router.openshift.io/backend-tls-verify-hostname"
+	// BackendTLSSPKISHA256Annotation pins the SHA-256 hash of the public key
+	// (SPKI) of a certificate of the destination CA certificate of a
+	// reencrypt route: the certificate of the backend is only verified
+	// against the certificates with that key, when the connection is set up.
+	BackendTLSSPKISHA256Annotation = "haproxy.router.openshift.io/backend-tls-spki-sha256"
+	// BackendTLSMinVersionAnnotation sets the minimum TLS version used to
+	// connect to the backend of a reencrypt route.
+	BackendTLSMinVersionAnnotation = "haproxy.router.openshift.io/backend-tls-min-version"
+)
+
+// backendTLSVersions are the TLS versions accepted by haproxy's ssl-min-ver.
+var backendTLSVersions = []string{"TLSv1.0", "TLSv1.1", "TLSv1.2", "TLSv1.3"}
+
+// BackendTLSOptions are the verification options for the connections a
+// reencrypt route makes to its backend.  Empty fields are not enforced.
+type BackendTLSOptions struct {
+	// VerifyHostname is the name the backend certificate must be valid for.
+	VerifyHostname string
+	// PinnedCACertificate are the certificates of the destination CA
+	// certificate with the pinned public key, in PEM format.  The backend
+	// certificate is only verified against them.
+	PinnedCACertificate string
+	// MinVersion is the minimum TLS version, e.g. "TLSv1.2".
+	MinVersion string
+}
+
+// GetBackendTLSOptions returns the backend TLS verification options of a
+// reencrypt route.  Options of routes with other terminations are empty.
+func GetBackendTLSOptions(route *routev1.Route) (BackendTLSOptions, field.ErrorList) {
+	options := BackendTLSOptions{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	_, hasHostname := route.Annotations[BackendTLSVerifyHostnameAnnotation]
+	_, hasPin := route.Annotations[BackendTLSSPKISHA256Annotation]
+	_, hasMinVersion := route.Annotations[BackendTLSMinVersionAnnotation]
+	if !hasHostname && !hasPin && !hasMinVersion {
+		return options, result
+	}
+	if route.Spec.TLS == nil || route.Spec.TLS.Termination != routev1.TLSTerminationReencrypt {
+		result = append(result, field.Invalid(field.NewPath("spec", "tls", "termination"), "",
+			"backend TLS verification options require reencrypt termination"))
+		return options, result
+	}
+
+	if value, ok := route.Annotations[BackendTLSVerifyHostnameAnnotation]; ok {
+		if errs := kvalidation.IsDNS1123Subdomain(value); len(errs) > 0 {
+			result = append(result, field.Invalid(fldPath.Key(BackendTLSVerifyHostnameAnnotation), value, strings.Join(errs, ", ")))
+		} else {
+			options.VerifyHostname = value
+		}
+	}
+
+	if value, ok := route.Annotations[BackendTLSSPKISHA256Annotation]; ok {
+		if pin, err := parseSPKIPin(value); err != nil {
+			result = append(result, field.Invalid(fldPath.Key(BackendTLSSPKISHA256Annotation), value, err.Error()))
+		} else if pinned := pinnedCertificates(route.Spec.TLS.DestinationCACertificate, pin); len(pinned) == 0 {
+			result = append(result, field.Invalid(fldPath.Key(BackendTLSSPKISHA256Annotation), value, "does not match the public key of a certificate of spec.tls.destinationCACertificate"))
+		} else {
+			options.PinnedCACertificate = pinned
+		}
+	}
+
+	if value, ok := route.Annotations[BackendTLSMinVersionAnnotation]; ok {
+		valid := false
+		for _, version := range backendTLSVersions {
+			if value == version {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			result = append(result, field.NotSupported(fldPath.Key(BackendTLSMinVersionAnnotation), value, backendTLSVersions))
+		} else {
+			options.MinVersion = value
+		}
+	}
+
+	return options, result
+}
+
+// parseSPKIPin parses the SHA-256 hash of a public key, either base64
+// encoded as in the pin-sha256 directive of HTTP public key pinning, or hex
+// encoded with optional colons as printed by openssl.
+func parseSPKIPin(value string) ([]byte, error) {
+	if pin, err := base64.StdEncoding.DecodeString(value); err == nil && len(pin) == sha256.Size {
+		return pin, nil
+	}
+	if pin, err := hex.DecodeString(strings.ReplaceAll(value, ":", "")); err == nil && len(pin) == sha256.Size {
+		return pin, nil
+	}
+	return nil, fmt.Errorf("must be a base64 or hex encoded SHA-256 hash of a public key")
+}
+
+// pinnedCertificates returns the certificates of caPEM whose public key has
+// the SHA-256 hash pin, in PEM format.
+func pinnedCertificates(caPEM string, pin []byte) string {
+	certs, err := cert.ParseCertsPEM([]byte(caPEM))
+	if err != nil {
+		return ""
+	}
+	var pinned []byte
+	for _, c := range certs {
+		if hash := sha256.Sum256(c.RawSubjectPublicKeyInfo); bytes.Equal(hash[:], pin) {
+			pinned = append(pinned, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+	}
+	return string(pinned)
+}
+
+// ValidateBackendTLSOptions checks that the backend TLS verification
+// annotations of a route, if any, are well formed.
+func ValidateBackendTLSOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetBackendTLSOptions(route)
+	return result
+}
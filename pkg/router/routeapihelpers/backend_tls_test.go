@@ -0,0 +1,102 @@
+package routeapihelpers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/cert"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetBackendTLSOptions(t *testing.T) {
+	ca, err := cert.ParseCertsPEM([]byte(testCACertificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(ca[0].RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	pinned := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca[0].Raw}))
+	// The destination CA bundle holds another certificate the pin excludes.
+	bundle := testCertificate + "\n" + testCACertificate
+
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		annotations map[string]string
+		expected    BackendTLSOptions
+		errs        int
+	}{
+		{
+			name:        "no annotations",
+			termination: routev1.TLSTerminationReencrypt,
+		},
+		{
+			name:        "no annotations on edge route",
+			termination: routev1.TLSTerminationEdge,
+		},
+		{
+			name:        "all options",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{
+				BackendTLSVerifyHostnameAnnotation: "backend.example.com",
+				BackendTLSSPKISHA256Annotation:     pin,
+				BackendTLSMinVersionAnnotation:     "TLSv1.3",
+			},
+			expected: BackendTLSOptions{VerifyHostname: "backend.example.com", PinnedCACertificate: pinned, MinVersion: "TLSv1.3"},
+		},
+		{
+			name:        "openssl hex hash",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{
+				BackendTLSSPKISHA256Annotation: strings.ToUpper(hex.EncodeToString(hash[:])),
+			},
+			expected: BackendTLSOptions{PinnedCACertificate: pinned},
+		},
+		{
+			name:        "pin of no destination CA certificate",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{
+				BackendTLSSPKISHA256Annotation: "a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90",
+			},
+			errs: 1,
+		},
+		{
+			name:        "edge route",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{BackendTLSMinVersionAnnotation: "TLSv1.2"},
+			errs:        1,
+		},
+		{
+			name:        "invalid options",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{
+				BackendTLSVerifyHostnameAnnotation: "backend example.com",
+				BackendTLSSPKISHA256Annotation:     "a1b2",
+				BackendTLSMinVersionAnnotation:     "SSLv3",
+			},
+			errs: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+				Spec:       routev1.RouteSpec{TLS: &routev1.TLSConfig{Termination: tc.termination, DestinationCACertificate: bundle}},
+			}
+			options, errs := GetBackendTLSOptions(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if options != tc.expected {
+				t.Fatalf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package routeapihelpers
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// BackupServiceAnnotation names the backing service of a route whose
+// servers only receive traffic when all the servers of its other backing
+// services are down, e.g. a service that reaches the route's application in
+// another region or cluster.
+const BackupServiceAnnotation = "haproxy.router.openshift.io/backup-service"
+
+// GetBackupService returns the name of the backup service of a route, if
+// any.  It must be one of the backing services of the route, and not its
+// only one with a weight as the route would then have no primary servers.
+func GetBackupService(route *routev1.Route) (string, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[BackupServiceAnnotation]
+	if !ok {
+		return "", result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(BackupServiceAnnotation)
+	name := strings.TrimSpace(value)
+
+	found, primaries := false, 0
+	for _, backend := range append([]routev1.RouteTargetReference{route.Spec.To}, route.Spec.AlternateBackends...) {
+		if backend.Name == name {
+			found = true
+		} else if backend.Weight == nil || *backend.Weight > 0 {
+			primaries++
+		}
+	}
+	if !found {
+		return "", append(result, field.Invalid(fldPath, value, "is not a backing service of the route"))
+	}
+	if primaries == 0 {
+		return "", append(result, field.Invalid(fldPath, value, "leaves the route without a backing service with a weight to back up"))
+	}
+	return name, result
+}
+
+// ValidateBackupService checks that the backup service of a route is one of
+// its backing services.
+func ValidateBackupService(route *routev1.Route) field.ErrorList {
+	_, result := GetBackupService(route)
+	return result
+}
@@ -0,0 +1,68 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetBackupService(t *testing.T) {
+	zero := int32(0)
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		alternates  []routev1.RouteTargetReference
+		expected    string
+		expectErr   bool
+	}{
+		{name: "none", alternates: []routev1.RouteTargetReference{{Name: "remote"}}},
+		{
+			name:        "alternate backend",
+			annotations: map[string]string{BackupServiceAnnotation: "remote"},
+			alternates:  []routev1.RouteTargetReference{{Name: "remote"}},
+			expected:    "remote",
+		},
+		{
+			name:        "primary backend",
+			annotations: map[string]string{BackupServiceAnnotation: " local "},
+			alternates:  []routev1.RouteTargetReference{{Name: "remote"}},
+			expected:    "local",
+		},
+		{
+			name:        "unknown service",
+			annotations: map[string]string{BackupServiceAnnotation: "other"},
+			alternates:  []routev1.RouteTargetReference{{Name: "remote"}},
+			expectErr:   true,
+		},
+		{
+			name:        "only backend",
+			annotations: map[string]string{BackupServiceAnnotation: "local"},
+			expectErr:   true,
+		},
+		{
+			name:        "no other backend with a weight",
+			annotations: map[string]string{BackupServiceAnnotation: "local"},
+			alternates:  []routev1.RouteTargetReference{{Name: "remote", Weight: &zero}},
+			expectErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations},
+			Spec: routev1.RouteSpec{
+				To:                routev1.RouteTargetReference{Name: "local"},
+				AlternateBackends: tc.alternates,
+			},
+		}
+		name, errs := GetBackupService(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if name != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, name)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// The annotations of the bandwidth limits of a route, in bytes per second
+// with an optional k, m or g suffix for multiples of 1024, as in the
+// configuration of HAProxy.
+const (
+	// BandwidthLimitDownloadAnnotation limits the bandwidth of the
+	// responses of each connection to the route.
+	BandwidthLimitDownloadAnnotation = "haproxy.router.openshift.io/bandwidth-limit-download"
+	// BandwidthLimitUploadAnnotation limits the bandwidth of the requests
+	// of each connection to the route.
+	BandwidthLimitUploadAnnotation = "haproxy.router.openshift.io/bandwidth-limit-upload"
+	// BandwidthLimitDownloadTotalAnnotation limits the bandwidth of the
+	// responses of all the connections to the route together.
+	BandwidthLimitDownloadTotalAnnotation = "haproxy.router.openshift.io/bandwidth-limit-download-total"
+	// BandwidthLimitUploadTotalAnnotation limits the bandwidth of the
+	// requests of all the connections to the route together.
+	BandwidthLimitUploadTotalAnnotation = "haproxy.router.openshift.io/bandwidth-limit-upload-total"
+)
+
+// maxBandwidthLimit is the largest bandwidth limit HAProxy accepts.
+const maxBandwidthLimit = math.MaxUint32
+
+var bandwidthLimitPattern = regexp.MustCompile(`^([0-9]+)([kKmMgG]?)$`)
+
+// BandwidthLimits are the bandwidth limits of a route in bytes per second.
+// Zero fields do not limit the bandwidth.
+type BandwidthLimits struct {
+	// Download is the limit of the responses of each connection.
+	Download int64
+	// Upload is the limit of the requests of each connection.
+	Upload int64
+	// DownloadTotal is the limit of the responses of all the connections.
+	DownloadTotal int64
+	// UploadTotal is the limit of the requests of all the connections.
+	UploadTotal int64
+}
+
+// Limited returns true if any bandwidth of the route is limited.
+func (l BandwidthLimits) Limited() bool {
+	return l.Download > 0 || l.Upload > 0 || l.DownloadTotal > 0 || l.UploadTotal > 0
+}
+
+// parseBandwidthLimit parses a bandwidth limit in bytes per second.
+func parseBandwidthLimit(value string) (int64, error) {
+	match := bandwidthLimitPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("must be a number of bytes per second with an optional k, m or g suffix")
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || n > maxBandwidthLimit {
+		return 0, fmt.Errorf("must not exceed %d bytes per second", int64(maxBandwidthLimit))
+	}
+	switch strings.ToLower(match[2]) {
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	case "g":
+		n <<= 30
+	}
+	if n < 1 || n > maxBandwidthLimit {
+		return 0, fmt.Errorf("must be between 1 and %d bytes per second", int64(maxBandwidthLimit))
+	}
+	return n, nil
+}
+
+// GetBandwidthLimits returns the bandwidth limits of a route.  The limits
+// only apply to routes whose HTTP traffic the router terminates, and the
+// limit of each connection may not exceed the limit of all of them.  No
+// limits are returned with the errors of invalid limits.
+func GetBandwidthLimits(route *routev1.Route) (BandwidthLimits, field.ErrorList) {
+	limits := BandwidthLimits{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	annotations := []struct {
+		key   string
+		limit *int64
+	}{
+		{BandwidthLimitDownloadAnnotation, &limits.Download},
+		{BandwidthLimitUploadAnnotation, &limits.Upload},
+		{BandwidthLimitDownloadTotalAnnotation, &limits.DownloadTotal},
+		{BandwidthLimitUploadTotalAnnotation, &limits.UploadTotal},
+	}
+
+	passthrough := route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough
+	for _, annotation := range annotations {
+		value, ok := route.Annotations[annotation.key]
+		if !ok {
+			continue
+		}
+		if passthrough {
+			result = append(result, field.Invalid(fldPath.Key(annotation.key), value, "is not supported for passthrough routes"))
+			continue
+		}
+		n, err := parseBandwidthLimit(value)
+		if err != nil {
+			result = append(result, field.Invalid(fldPath.Key(annotation.key), value, err.Error()))
+			continue
+		}
+		*annotation.limit = n
+	}
+
+	if limits.DownloadTotal > 0 && limits.Download > limits.DownloadTotal {
+		result = append(result, field.Invalid(fldPath.Key(BandwidthLimitDownloadAnnotation), route.Annotations[BandwidthLimitDownloadAnnotation], fmt.Sprintf("exceeds %s", BandwidthLimitDownloadTotalAnnotation)))
+	}
+	if limits.UploadTotal > 0 && limits.Upload > limits.UploadTotal {
+		result = append(result, field.Invalid(fldPath.Key(BandwidthLimitUploadAnnotation), route.Annotations[BandwidthLimitUploadAnnotation], fmt.Sprintf("exceeds %s", BandwidthLimitUploadTotalAnnotation)))
+	}
+
+	if len(result) > 0 {
+		return BandwidthLimits{}, result
+	}
+	return limits, result
+}
+
+// ValidateBandwidthLimits checks that the bandwidth limits of a route are
+// valid.
+func ValidateBandwidthLimits(route *routev1.Route) field.ErrorList {
+	_, result := GetBandwidthLimits(route)
+	return result
+}
@@ -0,0 +1,96 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetBandwidthLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		annotations map[string]string
+		expected    BandwidthLimits
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "all limits",
+			annotations: map[string]string{
+				BandwidthLimitDownloadAnnotation:      "512k",
+				BandwidthLimitUploadAnnotation:        "1000",
+				BandwidthLimitDownloadTotalAnnotation: "10M",
+				BandwidthLimitUploadTotalAnnotation:   "1g",
+			},
+			expected: BandwidthLimits{
+				Download:      512 << 10,
+				Upload:        1000,
+				DownloadTotal: 10 << 20,
+				UploadTotal:   1 << 30,
+			},
+		},
+		{
+			name:        "edge route",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{BandwidthLimitDownloadTotalAnnotation: "100m"},
+			expected:    BandwidthLimits{DownloadTotal: 100 << 20},
+		},
+		{
+			name:        "passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{
+				BandwidthLimitDownloadAnnotation: "1m",
+				BandwidthLimitUploadAnnotation:   "1m",
+			},
+			errs: 2,
+		},
+		{
+			name: "invalid limits",
+			annotations: map[string]string{
+				BandwidthLimitDownloadAnnotation:      "0",
+				BandwidthLimitUploadAnnotation:        "1mb",
+				BandwidthLimitDownloadTotalAnnotation: "4g",
+				BandwidthLimitUploadTotalAnnotation:   "-1",
+			},
+			errs: 4,
+		},
+		{
+			name: "connection limits exceeding the total",
+			annotations: map[string]string{
+				BandwidthLimitDownloadAnnotation:      "2m",
+				BandwidthLimitDownloadTotalAnnotation: "1m",
+				BandwidthLimitUploadAnnotation:        "2m",
+				BandwidthLimitUploadTotalAnnotation:   "1m",
+			},
+			errs: 2,
+		},
+		{
+			name: "connection limit without a total",
+			annotations: map[string]string{
+				BandwidthLimitUploadAnnotation: "2m",
+			},
+			expected: BandwidthLimits{Upload: 2 << 20},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			limits, errs := GetBandwidthLimits(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if limits != tc.expected {
+				t.Errorf("expected %#v, got %#v", tc.expected, limits)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package routeapihelpers
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// GreenServicesAnnotation lists, separated by commas, the backing
+	// services of a route that form its green set.  The other backing
+	// services of the route form its blue set.
+	GreenServicesAnnotation = "haproxy.router.openshift.io/green-services"
+
+	// ActiveColorAnnotation is the set of a route with green services
+	// that receives its traffic by default, "blue" or "green".  Defaults
+	// to blue.
+	ActiveColorAnnotation = "haproxy.router.openshift.io/active-color"
+
+	// ColorBlue and ColorGreen are the sets of the backing services of a
+	// route.
+	ColorBlue  = "blue"
+	ColorGreen = "green"
+
+	// BlueGreenOverrideCookie and BlueGreenOverrideHeader send a request
+	// to the set they name, "blue" or "green", rather than to the active
+	// set of the route.  The header takes precedence over the cookie.
+	BlueGreenOverrideCookie = "router-color"
+	BlueGreenOverrideHeader = "X-Router-Color"
+)
+
+// BlueGreen splits the backing services of a route into a blue and a green
+// set.  The zero value does not split them.
+type BlueGreen struct {
+	// Green are the names of the services of the green set.
+	Green []string
+	// Active is the set that receives the traffic of the route by
+	// default.
+	Active string
+}
+
+// Enabled returns true if the backing services are split.
+func (b BlueGreen) Enabled() bool {
+	return len(b.Green) > 0
+}
+
+// GetBlueGreen returns how the backing services of a route are split into
+// a blue and a green set.  The green services must be backing services of
+// the route and leave at least one of them blue.  Passthrough and TCP
+// routes cannot be split since the override cookie and header of their
+// requests cannot be read.
+func GetBlueGreen(route *routev1.Route) (BlueGreen, field.ErrorList) {
+	result := field.ErrorList{}
+	annotationsPath := field.NewPath("metadata", "annotations")
+	value, ok := route.Annotations[GreenServicesAnnotation]
+	if !ok {
+		if color, ok := route.Annotations[ActiveColorAnnotation]; ok {
+			result = append(result, field.Invalid(annotationsPath.Key(ActiveColorAnnotation), color, "requires the "+GreenServicesAnnotation+" annotation"))
+		}
+		return BlueGreen{}, result
+	}
+	fldPath := annotationsPath.Key(GreenServicesAnnotation)
+
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return BlueGreen{}, append(result, field.Invalid(fldPath, value, "is not supported by passthrough routes"))
+	}
+	if IsTCPRoute(route) {
+		return BlueGreen{}, append(result, field.Invalid(fldPath, value, "is not supported by TCP routes"))
+	}
+
+	backends := sets.NewString(route.Spec.To.Name)
+	for _, backend := range route.Spec.AlternateBackends {
+		backends.Insert(backend.Name)
+	}
+	green := sets.NewString()
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if !backends.Has(name) {
+			result = append(result, field.Invalid(fldPath, value, name+" is not a backing service of the route"))
+			continue
+		}
+		green.Insert(name)
+	}
+	if len(result) > 0 {
+		return BlueGreen{}, result
+	}
+	if green.Len() == 0 {
+		return BlueGreen{}, append(result, field.Required(fldPath, "must name at least one backing service"))
+	}
+	if green.Len() == backends.Len() {
+		return BlueGreen{}, append(result, field.Invalid(fldPath, value, "leaves the route without a blue backing service"))
+	}
+
+	active := ColorBlue
+	if color, ok := route.Annotations[ActiveColorAnnotation]; ok {
+		active = strings.ToLower(strings.TrimSpace(color))
+		if active != ColorBlue && active != ColorGreen {
+			return BlueGreen{}, append(result, field.NotSupported(annotationsPath.Key(ActiveColorAnnotation), color, []string{ColorBlue, ColorGreen}))
+		}
+	}
+	return BlueGreen{Green: green.List(), Active: active}, result
+}
+
+// ValidateBlueGreen checks that the blue/green annotations of a route split
+// its backing services.
+func ValidateBlueGreen(route *routev1.Route) field.ErrorList {
+	_, result := GetBlueGreen(route)
+	return result
+}
@@ -0,0 +1,87 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetBlueGreen(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		tls         *routev1.TLSConfig
+		expected    BlueGreen
+		expectErr   bool
+	}{
+		{name: "none"},
+		{
+			name:        "green services",
+			annotations: map[string]string{GreenServicesAnnotation: "v2, v3"},
+			expected:    BlueGreen{Green: []string{"v2", "v3"}, Active: ColorBlue},
+		},
+		{
+			name:        "green active",
+			annotations: map[string]string{GreenServicesAnnotation: "v2", ActiveColorAnnotation: " Green "},
+			tls:         &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+			expected:    BlueGreen{Green: []string{"v2"}, Active: ColorGreen},
+		},
+		{
+			name:        "active color without green services",
+			annotations: map[string]string{ActiveColorAnnotation: "green"},
+			expectErr:   true,
+		},
+		{
+			name:        "unknown color",
+			annotations: map[string]string{GreenServicesAnnotation: "v2", ActiveColorAnnotation: "red"},
+			expectErr:   true,
+		},
+		{
+			name:        "unknown service",
+			annotations: map[string]string{GreenServicesAnnotation: "v2,other"},
+			expectErr:   true,
+		},
+		{
+			name:        "no green service",
+			annotations: map[string]string{GreenServicesAnnotation: " , "},
+			expectErr:   true,
+		},
+		{
+			name:        "no blue service",
+			annotations: map[string]string{GreenServicesAnnotation: "v1,v2,v3"},
+			expectErr:   true,
+		},
+		{
+			name:        "passthrough",
+			annotations: map[string]string{GreenServicesAnnotation: "v2"},
+			tls:         &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough},
+			expectErr:   true,
+		},
+		{
+			name:        "tcp",
+			annotations: map[string]string{GreenServicesAnnotation: "v2", TCPPortAnnotation: ""},
+			expectErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations},
+			Spec: routev1.RouteSpec{
+				To:                routev1.RouteTargetReference{Name: "v1"},
+				AlternateBackends: []routev1.RouteTargetReference{{Name: "v2"}, {Name: "v3"}},
+				TLS:               tc.tls,
+			},
+		}
+		blueGreen, errs := GetBlueGreen(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if !reflect.DeepEqual(blueGreen, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, blueGreen)
+		}
+	}
+}
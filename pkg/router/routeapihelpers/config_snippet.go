@@ -0,0 +1,114 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// ConfigSnippetAnnotation holds raw haproxy configuration lines that are
+// appended to the HTTP backend of a route.  Every line must start with one
+// of the directives the router allows.  Passthrough and TCP routes ignore
+// it.
+const ConfigSnippetAnnotation = "haproxy.router.openshift.io/backend-config-snippet"
+
+// deniedSnippetDirectives are never allowed in a config snippet, even when
+// listed in the router's allowlist, as they start new sections, change how
+// the backend reaches its servers or access the router's file system and
+// processes.
+var deniedSnippetDirectives = sets.NewString(
+	"global", "defaults", "frontend", "backend", "listen", "userlist", "peers",
+	"resolvers", "mailers", "program", "ring", "cache", "http-errors",
+	"bind", "mode", "server", "server-template", "default-server", "use-server",
+	"stats", "log", "errorfile", "errorfiles", "errorloc", "errorloc302", "errorloc303",
+	"external-check", "load-server-state-from-file", "server-state-file-name",
+	"lua-load", "lua-prepend-path", "lua-load-per-thread",
+)
+
+// deniedSnippetFlags are arguments that are rejected anywhere in a config
+// snippet as they load patterns or maps from the router's files.
+var deniedSnippetFlags = sets.NewString("-f", "-M")
+
+// deniedSnippetKeywords are words that are rejected anywhere in a config
+// snippet, on their own or as part of a keyword such as lua.evil, map_ip or
+// ca-file, as they run lua code or read files from the router.
+var deniedSnippetKeywords = sets.NewString("lua", "map", "file")
+
+// ConfigSnippetLines returns the non-empty, non-comment lines of the config
+// snippet of a route.
+func ConfigSnippetLines(route *routev1.Route) []string {
+	var lines []string
+	for _, line := range strings.Split(route.Annotations[ConfigSnippetAnnotation], "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ValidateConfigSnippet checks that every line of the config snippet of a
+// route uses a directive from allowed.  Routes with a snippet are rejected
+// if allowed is empty.
+func ValidateConfigSnippet(route *routev1.Route, allowed sets.String) field.ErrorList {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[ConfigSnippetAnnotation]
+	if !ok {
+		return result
+	}
+
+	fldPath := field.NewPath("metadata", "annotations").Key(ConfigSnippetAnnotation)
+	if allowed.Len() == 0 {
+		return append(result, field.Forbidden(fldPath, "config snippets are not enabled on this router"))
+	}
+
+	for _, line := range ConfigSnippetLines(route) {
+		if err := validateConfigSnippetLine(line, allowed); err != nil {
+			result = append(result, field.Invalid(fldPath, value, err.Error()))
+		}
+	}
+	return result
+}
+
+// validateConfigSnippetLine checks a single trimmed snippet line.
+func validateConfigSnippetLine(line string, allowed sets.String) error {
+	for _, r := range line {
+		if r > unicode.MaxASCII || (unicode.IsControl(r) && r != '\t') {
+			return fmt.Errorf("line %q contains a non printable character", line)
+		}
+	}
+
+	directive := strings.Fields(line)[0]
+	if deniedSnippetDirectives.Has(directive) {
+		return fmt.Errorf("directive %q is not allowed", directive)
+	}
+	if !allowed.Has(directive) {
+		return fmt.Errorf("directive %q is not in the allowed directives %s", directive, strings.Join(allowed.List(), ", "))
+	}
+
+	for _, arg := range strings.Fields(line) {
+		if deniedSnippetFlags.Has(arg) {
+			return fmt.Errorf("line %q must not contain %q", line, arg)
+		}
+	}
+	for _, keyword := range snippetKeywords(line) {
+		if deniedSnippetKeywords.Has(keyword) {
+			return fmt.Errorf("line %q must not contain %q", line, keyword)
+		}
+	}
+	return nil
+}
+
+// snippetKeywords splits a snippet line into the lowercased words its
+// keywords, converters and fetches are made of.
+func snippetKeywords(line string) []string {
+	return strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
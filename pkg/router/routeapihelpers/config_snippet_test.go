@@ -0,0 +1,121 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestValidateConfigSnippet(t *testing.T) {
+	allowed := sets.NewString("http-request", "http-response", "option", "server", "lua-load")
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		allowed     sets.String
+		expected    []string
+		err         bool
+	}{
+		{
+			name:    "no annotation",
+			allowed: allowed,
+		},
+		{
+			name:        "snippets not enabled",
+			annotations: map[string]string{ConfigSnippetAnnotation: "option forwardfor"},
+			err:         true,
+		},
+		{
+			name: "allowed directives",
+			annotations: map[string]string{ConfigSnippetAnnotation: `
+# add a request id
+http-request set-header X-Request-Id %[uuid()]
+
+  http-response del-header Server
+`},
+			allowed:  allowed,
+			expected: []string{"http-request set-header X-Request-Id %[uuid()]", "http-response del-header Server"},
+		},
+		{
+			name:        "directive not allowed",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request deny\nbalance source"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "denied directive in allowlist",
+			annotations: map[string]string{ConfigSnippetAnnotation: "server evil 10.0.0.1:80"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "lua directive",
+			annotations: map[string]string{ConfigSnippetAnnotation: "lua-load /tmp/evil.lua"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "lua action",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request lua.evil"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "pattern file",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request deny if { src -f /etc/passwd }"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "map converter",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request set-header X %[src,map_ip(/etc/hosts)]"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "map file keyword",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request set-map(/etc/hosts) %[src] %[req.hdr(host)]"},
+			allowed:     allowed,
+			err:         true,
+		},
+		{
+			name:        "keywords containing denied words",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request set-header X-Profile evaluate if { path -m beg /profile }"},
+			allowed:     allowed,
+			expected:    []string{"http-request set-header X-Profile evaluate if { path -m beg /profile }"},
+		},
+		{
+			name:        "non printable character",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request deny\r"},
+			allowed:     allowed,
+			expected:    []string{"http-request deny"},
+		},
+		{
+			name:        "control character",
+			annotations: map[string]string{ConfigSnippetAnnotation: "http-request set-header X \x00"},
+			allowed:     allowed,
+			err:         true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r", Annotations: tc.annotations},
+			}
+			errs := ValidateConfigSnippet(route, tc.allowed)
+			if tc.err != (len(errs) > 0) {
+				t.Fatalf("expected error %v, got %v", tc.err, errs)
+			}
+			if tc.err {
+				return
+			}
+			if lines := ConfigSnippetLines(route); !reflect.DeepEqual(lines, tc.expected) {
+				t.Errorf("expected lines %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
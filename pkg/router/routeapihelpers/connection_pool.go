@@ -0,0 +1,133 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// HTTPReuseAnnotation sets when the router may send a request over an
+	// idle connection to a backend of a route opened for another request:
+	// "never", "safe", "aggressive" or "always".
+	HTTPReuseAnnotation = "haproxy.router.openshift.io/http-reuse"
+	// PoolMaxConnAnnotation sets how many idle connections to each backend
+	// of a route are kept for reuse.  -1 keeps them all, 0 keeps none.
+	PoolMaxConnAnnotation = "haproxy.router.openshift.io/pool-max-conn"
+	// PoolPurgeDelayAnnotation sets how often half of the idle backend
+	// connections of a route are closed.
+	PoolPurgeDelayAnnotation = "haproxy.router.openshift.io/pool-purge-delay"
+)
+
+const (
+	HTTPReuseNever      = "never"
+	HTTPReuseSafe       = "safe"
+	HTTPReuseAggressive = "aggressive"
+	HTTPReuseAlways     = "always"
+)
+
+// ConnectionPoolOptions are the options of the backend connection pool of a
+// route.  Zero fields use the router defaults.
+type ConnectionPoolOptions struct {
+	// HTTPReuse is the connection reuse mode.
+	HTTPReuse string
+	// PoolMaxConn is the number of idle connections kept per server, or
+	// nil for the router default.
+	PoolMaxConn *int32
+	// PoolPurgeDelay is the delay between the purges of idle connections.
+	PoolPurgeDelay time.Duration
+}
+
+// GetConnectionPoolOptions returns the backend connection pool options of a
+// route.  The options only apply to routes whose HTTP traffic the router
+// terminates, "always" is not allowed on reencrypt routes as it reuses TLS
+// connections the backend may not keep open, and the pool cannot be sized
+// when connections are never reused or reused without a pool.
+func GetConnectionPoolOptions(route *routev1.Route) (ConnectionPoolOptions, field.ErrorList) {
+	options := ConnectionPoolOptions{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	reuse, hasReuse := route.Annotations[HTTPReuseAnnotation]
+	maxConn, hasMaxConn := route.Annotations[PoolMaxConnAnnotation]
+	purgeDelay, hasPurgeDelay := route.Annotations[PoolPurgeDelayAnnotation]
+	if !hasReuse && !hasMaxConn && !hasPurgeDelay {
+		return options, result
+	}
+
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		for _, annotation := range []string{HTTPReuseAnnotation, PoolMaxConnAnnotation, PoolPurgeDelayAnnotation} {
+			if value, ok := route.Annotations[annotation]; ok {
+				result = append(result, field.Invalid(fldPath.Key(annotation), value, "is not supported for passthrough routes"))
+			}
+		}
+		return options, result
+	}
+
+	if hasReuse {
+		value := strings.TrimSpace(reuse)
+		switch value {
+		case HTTPReuseNever, HTTPReuseSafe, HTTPReuseAggressive:
+			options.HTTPReuse = value
+		case HTTPReuseAlways:
+			if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationReencrypt {
+				result = append(result, field.Invalid(fldPath.Key(HTTPReuseAnnotation), reuse, fmt.Sprintf("is not supported for reencrypt routes, use %s", HTTPReuseAggressive)))
+			} else {
+				options.HTTPReuse = value
+			}
+		default:
+			result = append(result, field.NotSupported(fldPath.Key(HTTPReuseAnnotation), reuse, []string{HTTPReuseNever, HTTPReuseSafe, HTTPReuseAggressive, HTTPReuseAlways}))
+		}
+	}
+
+	if hasMaxConn {
+		n, err := strconv.ParseInt(strings.TrimSpace(maxConn), 10, 32)
+		switch {
+		case err != nil || n < -1:
+			result = append(result, field.Invalid(fldPath.Key(PoolMaxConnAnnotation), maxConn, fmt.Sprintf("must be an integer between -1 and %d", math.MaxInt32)))
+		case n == 0 && len(options.HTTPReuse) > 0 && options.HTTPReuse != HTTPReuseNever:
+			result = append(result, field.Invalid(fldPath.Key(PoolMaxConnAnnotation), maxConn, fmt.Sprintf("disables the connection pool %s=%s reuses connections from", HTTPReuseAnnotation, options.HTTPReuse)))
+		default:
+			max := int32(n)
+			options.PoolMaxConn = &max
+		}
+	}
+
+	if hasPurgeDelay {
+		d, err := ParseHAProxyTimeout(purgeDelay)
+		switch {
+		case err != nil:
+			result = append(result, field.Invalid(fldPath.Key(PoolPurgeDelayAnnotation), purgeDelay, err.Error()))
+		case d < time.Millisecond || d > haproxyMaxTimeout:
+			result = append(result, field.Invalid(fldPath.Key(PoolPurgeDelayAnnotation), purgeDelay, fmt.Sprintf("must be between 1ms and %v", haproxyMaxTimeout)))
+		default:
+			options.PoolPurgeDelay = d
+		}
+	}
+
+	if options.HTTPReuse == HTTPReuseNever {
+		for _, annotation := range []string{PoolMaxConnAnnotation, PoolPurgeDelayAnnotation} {
+			if value, ok := route.Annotations[annotation]; ok {
+				result = append(result, field.Invalid(fldPath.Key(annotation), value, fmt.Sprintf("has no effect when %s is %s", HTTPReuseAnnotation, HTTPReuseNever)))
+			}
+		}
+	}
+
+	if len(result) > 0 {
+		return ConnectionPoolOptions{}, result
+	}
+	return options, result
+}
+
+// ValidateConnectionPoolOptions checks that the backend connection pool
+// options of a route are valid.
+func ValidateConnectionPoolOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetConnectionPoolOptions(route)
+	return result
+}
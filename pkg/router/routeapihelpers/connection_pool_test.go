@@ -0,0 +1,114 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetConnectionPoolOptions(t *testing.T) {
+	maxConn := func(n int32) *int32 { return &n }
+
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		annotations map[string]string
+		expected    ConnectionPoolOptions
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "all options",
+			annotations: map[string]string{
+				HTTPReuseAnnotation:      "always",
+				PoolMaxConnAnnotation:    "100",
+				PoolPurgeDelayAnnotation: "10s",
+			},
+			expected: ConnectionPoolOptions{
+				HTTPReuse:      HTTPReuseAlways,
+				PoolMaxConn:    maxConn(100),
+				PoolPurgeDelay: 10 * time.Second,
+			},
+		},
+		{
+			name:        "unlimited pool on an edge route",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{PoolMaxConnAnnotation: "-1"},
+			expected:    ConnectionPoolOptions{PoolMaxConn: maxConn(-1)},
+		},
+		{
+			name:        "aggressive reuse on a reencrypt route",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{HTTPReuseAnnotation: "aggressive"},
+			expected:    ConnectionPoolOptions{HTTPReuse: HTTPReuseAggressive},
+		},
+		{
+			name:        "always reuse on a reencrypt route",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{HTTPReuseAnnotation: "always"},
+			errs:        1,
+		},
+		{
+			name:        "passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{
+				HTTPReuseAnnotation:   "safe",
+				PoolMaxConnAnnotation: "10",
+			},
+			errs: 2,
+		},
+		{
+			name: "pool without reuse",
+			annotations: map[string]string{
+				HTTPReuseAnnotation:      "never",
+				PoolMaxConnAnnotation:    "10",
+				PoolPurgeDelayAnnotation: "1s",
+			},
+			errs: 2,
+		},
+		{
+			name: "reuse without a pool",
+			annotations: map[string]string{
+				HTTPReuseAnnotation:   "safe",
+				PoolMaxConnAnnotation: "0",
+			},
+			errs: 1,
+		},
+		{
+			name:        "pool disabled",
+			annotations: map[string]string{PoolMaxConnAnnotation: "0"},
+			expected:    ConnectionPoolOptions{PoolMaxConn: maxConn(0)},
+		},
+		{
+			name: "invalid options",
+			annotations: map[string]string{
+				HTTPReuseAnnotation:      "sometimes",
+				PoolMaxConnAnnotation:    "-2",
+				PoolPurgeDelayAnnotation: "0s",
+			},
+			errs: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			options, errs := GetConnectionPoolOptions(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if !reflect.DeepEqual(options, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package routeapihelpers
+
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// ConsistentHashAnnotation balances the requests of a route over its servers
+// with a consistent hash of a key of the requests, so that the requests with
+// the same key keep going to the same server as servers come and go.  The
+// key is the URI of the request (uri), a header (header:<name>) or a cookie
+// (cookie:<name>).  Requests without the header or cookie are balanced
+// round robin.
+const ConsistentHashAnnotation = "haproxy.router.openshift.io/consistent-hash"
+
+// The sources of the key of the consistent hash.
+const (
+	ConsistentHashURI    = "uri"
+	ConsistentHashHeader = "header"
+	ConsistentHashCookie = "cookie"
+)
+
+// balanceAnnotation is the annotation that sets the balance algorithm of a
+// route, which the consistent hash replaces.
+const balanceAnnotation = "haproxy.router.openshift.io/balance"
+
+// consistentHashHeaderNamePattern matches the names of the headers the key
+// of a consistent hash may be taken from.  It is stricter than the HTTP
+// token so that the name is safe in the haproxy configuration.
+var consistentHashHeaderNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ConsistentHash is the key of the consistent hash the requests of a route
+// are balanced with.
+type ConsistentHash struct {
+	// Source is uri, header or cookie, or empty if the requests of the
+	// route are not balanced with a consistent hash.
+	Source string
+	// Name is the name of the header or cookie.
+	Name string
+}
+
+// Enabled returns whether the requests are balanced with a consistent hash.
+func (h ConsistentHash) Enabled() bool {
+	return len(h.Source) > 0
+}
+
+// Balance returns the haproxy balance algorithm hashing the key.
+func (h ConsistentHash) Balance() string {
+	switch h.Source {
+	case ConsistentHashURI:
+		return "uri"
+	case ConsistentHashHeader:
+		return "hdr(" + h.Name + ")"
+	case ConsistentHashCookie:
+		return "hash req.cook(" + h.Name + ")"
+	}
+	return ""
+}
+
+// GetConsistentHash returns the key of the consistent hash of a route.
+// Passthrough routes have no HTTP requests to hash, and the hash replaces
+// the balance algorithm and weights the route may otherwise set, so such
+// routes are rejected.  No hash is returned with the errors of an invalid
+// annotation.
+func GetConsistentHash(route *routev1.Route) (ConsistentHash, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[ConsistentHashAnnotation]
+	if !ok {
+		return ConsistentHash{}, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(ConsistentHashAnnotation)
+
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return ConsistentHash{}, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	if _, ok := route.Annotations[balanceAnnotation]; ok {
+		result = append(result, field.Invalid(fldPath, value, "may not be set with "+balanceAnnotation))
+	}
+	if enabled, _ := GetLeastRequestWeighting(route); enabled {
+		result = append(result, field.Invalid(fldPath, value, "may not be set with "+LeastRequestWeightingAnnotation))
+	}
+
+	source, name, named := strings.Cut(strings.TrimSpace(value), ":")
+	switch source {
+	case ConsistentHashURI:
+		if named {
+			result = append(result, field.Invalid(fldPath, value, "uri takes no name"))
+		}
+	case ConsistentHashHeader:
+		if !consistentHashHeaderNamePattern.MatchString(name) {
+			result = append(result, field.Invalid(fldPath, value, "must name the header as header:<name>, of letters, digits, '-', '_' and '.'"))
+		}
+	case ConsistentHashCookie:
+		if !cookieNamePattern.MatchString(name) {
+			result = append(result, field.Invalid(fldPath, value, "must name the cookie as cookie:<name>, of letters, digits, '-' and '_'"))
+		}
+	default:
+		result = append(result, field.Invalid(fldPath, value, "must be uri, header:<name> or cookie:<name>"))
+	}
+	if len(result) > 0 {
+		return ConsistentHash{}, result
+	}
+	return ConsistentHash{Source: source, Name: name}, result
+}
+
+// ValidateConsistentHash checks that the consistent hash annotation of a
+// route is valid.
+func ValidateConsistentHash(route *routev1.Route) field.ErrorList {
+	_, result := GetConsistentHash(route)
+	return result
+}
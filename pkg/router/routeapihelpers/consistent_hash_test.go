@@ -0,0 +1,51 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetConsistentHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		termination routev1.TLSTerminationType
+		expected    ConsistentHash
+		balance     string
+		expectErr   bool
+	}{
+		{name: "unset"},
+		{name: "uri", annotations: map[string]string{ConsistentHashAnnotation: "uri"}, expected: ConsistentHash{Source: "uri"}, balance: "uri"},
+		{name: "header", annotations: map[string]string{ConsistentHashAnnotation: "header:X-Cache-Key"}, expected: ConsistentHash{Source: "header", Name: "X-Cache-Key"}, balance: "hdr(X-Cache-Key)"},
+		{name: "cookie on an edge route", annotations: map[string]string{ConsistentHashAnnotation: "cookie:session_id"}, termination: routev1.TLSTerminationEdge, expected: ConsistentHash{Source: "cookie", Name: "session_id"}, balance: "hash req.cook(session_id)"},
+		{name: "uri with a name", annotations: map[string]string{ConsistentHashAnnotation: "uri:path"}, expectErr: true},
+		{name: "header without a name", annotations: map[string]string{ConsistentHashAnnotation: "header"}, expectErr: true},
+		{name: "header with an invalid name", annotations: map[string]string{ConsistentHashAnnotation: "header:x key)"}, expectErr: true},
+		{name: "cookie without a name", annotations: map[string]string{ConsistentHashAnnotation: "cookie:"}, expectErr: true},
+		{name: "cookie with an invalid name", annotations: map[string]string{ConsistentHashAnnotation: "cookie:a;b"}, expectErr: true},
+		{name: "unknown source", annotations: map[string]string{ConsistentHashAnnotation: "src"}, expectErr: true},
+		{name: "passthrough", annotations: map[string]string{ConsistentHashAnnotation: "uri"}, termination: routev1.TLSTerminationPassthrough, expectErr: true},
+		{name: "with a balance algorithm", annotations: map[string]string{ConsistentHashAnnotation: "uri", "haproxy.router.openshift.io/balance": "leastconn"}, expectErr: true},
+		{name: "with least-request weighting", annotations: map[string]string{ConsistentHashAnnotation: "uri", LeastRequestWeightingAnnotation: "true"}, expectErr: true},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		if len(tc.termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+		}
+		hash, errs := GetConsistentHash(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if hash != tc.expected {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, hash)
+		}
+		if hash.Enabled() != (len(tc.balance) > 0) || hash.Balance() != tc.balance {
+			t.Errorf("%s: expected balance %q, got %q", tc.name, tc.balance, hash.Balance())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package routeapihelpers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// The annotations of the cookie the router inserts for session affinity.
+const (
+	// CookieNameAnnotation is the name of the cookie.
+	CookieNameAnnotation = "router.openshift.io/cookie_name"
+	// CookieSameSiteAnnotation is the SameSite attribute of the cookie:
+	// Lax, Strict or None.
+	CookieSameSiteAnnotation = "router.openshift.io/cookie-same-site"
+	// CookieSecureAnnotation sets whether the cookie has the Secure
+	// attribute, which it has by default on the routes that terminate TLS
+	// and do not allow insecure requests.
+	CookieSecureAnnotation = "router.openshift.io/cookie-secure"
+	// CookieHTTPOnlyAnnotation sets whether the cookie has the HttpOnly
+	// attribute, which it has by default.
+	CookieHTTPOnlyAnnotation = "router.openshift.io/cookie-httponly"
+	// CookiePathAnnotation is the Path attribute of the cookie.
+	CookiePathAnnotation = "router.openshift.io/cookie-path"
+	// CookieMaxAgeAnnotation is the Max-Age attribute of the cookie, in
+	// seconds.  The cookie is a session cookie without it.
+	CookieMaxAgeAnnotation = "router.openshift.io/cookie-max-age"
+)
+
+// MaxCookieMaxAge is the largest Max-Age of the cookie, 400 days, past which
+// browsers cap the lifetime of cookies anyway.
+const MaxCookieMaxAge = 400 * 24 * 60 * 60
+
+var (
+	cookieNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	cookiePathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+)
+
+// CookieOptions are the attributes of the cookie the router inserts for
+// session affinity.
+type CookieOptions struct {
+	// Name is the name of the cookie, if the route sets one.
+	Name string
+	// Secure is true if the cookie has the Secure attribute.
+	Secure bool
+	// SameSite is the SameSite attribute of the cookie, if it has one.
+	SameSite string
+	// HTTPOnly is true if the cookie has the HttpOnly attribute.
+	HTTPOnly bool
+	// Path is the Path attribute of the cookie, if it has one.
+	Path string
+	// MaxAge is the Max-Age attribute of the cookie in seconds, if it has
+	// one.
+	MaxAge int
+}
+
+// GetCookieOptions returns the attributes of the session affinity cookie of
+// a route.  The cookie of a route that terminates TLS and does not allow
+// insecure requests is Secure with SameSite=None by default, as it always
+// has been.  SameSite=None is rejected for a cookie that is not Secure, as
+// browsers drop such cookies, and only routes that terminate TLS may have
+// Secure cookies.  Passthrough routes have no cookie, so the attributes they
+// set are rejected.  The default attributes are
+// returned with the errors of invalid attributes.
+func GetCookieOptions(route *routev1.Route) (CookieOptions, field.ErrorList) {
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+	terminates := route.Spec.TLS != nil && (route.Spec.TLS.Termination == routev1.TLSTerminationEdge || route.Spec.TLS.Termination == routev1.TLSTerminationReencrypt)
+	secureByDefault := terminates && route.Spec.TLS.InsecureEdgeTerminationPolicy != routev1.InsecureEdgeTerminationPolicyAllow
+
+	defaults := CookieOptions{Secure: secureByDefault, HTTPOnly: true}
+	if secureByDefault {
+		defaults.SameSite = "None"
+	}
+	options := defaults
+
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		for _, key := range []string{CookieSecureAnnotation, CookieHTTPOnlyAnnotation, CookiePathAnnotation, CookieMaxAgeAnnotation} {
+			if value, ok := route.Annotations[key]; ok {
+				result = append(result, field.Invalid(fldPath.Key(key), value, "is not supported for passthrough routes"))
+			}
+		}
+		return CookieOptions{}, result
+	}
+
+	if value, ok := route.Annotations[CookieNameAnnotation]; ok {
+		if !cookieNamePattern.MatchString(value) {
+			result = append(result, field.Invalid(fldPath.Key(CookieNameAnnotation), value, "must consist of letters, digits, '-' and '_'"))
+		}
+		options.Name = value
+	}
+
+	if secure, ok := route.Annotations[CookieSecureAnnotation]; ok {
+		enabled, err := strconv.ParseBool(strings.TrimSpace(secure))
+		switch {
+		case err != nil:
+			result = append(result, field.Invalid(fldPath.Key(CookieSecureAnnotation), secure, "must be true or false"))
+		case enabled && !terminates:
+			result = append(result, field.Invalid(fldPath.Key(CookieSecureAnnotation), secure, "requires a route that terminates TLS"))
+		default:
+			options.Secure = enabled
+			if !enabled {
+				options.SameSite = ""
+			}
+		}
+	}
+
+	if value, ok := route.Annotations[CookieSameSiteAnnotation]; ok {
+		switch value {
+		case "Lax", "Strict":
+			options.SameSite = value
+		case "None":
+			if !options.Secure {
+				result = append(result, field.Invalid(fldPath.Key(CookieSameSiteAnnotation), value, "requires a Secure cookie"))
+				break
+			}
+			options.SameSite = value
+		default:
+			result = append(result, field.Invalid(fldPath.Key(CookieSameSiteAnnotation), value, "must be Lax, Strict or None"))
+		}
+	}
+
+	if value, ok := route.Annotations[CookieHTTPOnlyAnnotation]; ok {
+		if enabled, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+			result = append(result, field.Invalid(fldPath.Key(CookieHTTPOnlyAnnotation), value, "must be true or false"))
+		} else {
+			options.HTTPOnly = enabled
+		}
+	}
+
+	if value, ok := route.Annotations[CookiePathAnnotation]; ok {
+		if !cookiePathPattern.MatchString(value) {
+			result = append(result, field.Invalid(fldPath.Key(CookiePathAnnotation), value, "must be an absolute path of letters, digits and '.', '_', '~', '/' or '-'"))
+		}
+		options.Path = value
+	}
+
+	if value, ok := route.Annotations[CookieMaxAgeAnnotation]; ok {
+		maxAge, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || maxAge < 1 || maxAge > MaxCookieMaxAge {
+			result = append(result, field.Invalid(fldPath.Key(CookieMaxAgeAnnotation), value, "must be a number of seconds between 1 and "+strconv.Itoa(MaxCookieMaxAge)))
+		}
+		options.MaxAge = maxAge
+	}
+
+	if len(result) > 0 {
+		return defaults, result
+	}
+	return options, result
+}
+
+// ValidateCookieOptions checks that the session affinity cookie attributes
+// of a route are valid.
+func ValidateCookieOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetCookieOptions(route)
+	return result
+}
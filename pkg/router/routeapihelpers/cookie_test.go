@@ -0,0 +1,98 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetCookieOptions(t *testing.T) {
+	edge := &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge}
+	allow := &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyAllow}
+	passthrough := &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough}
+	secureDefaults := CookieOptions{Secure: true, SameSite: "None", HTTPOnly: true}
+
+	tests := []struct {
+		name        string
+		tls         *routev1.TLSConfig
+		annotations map[string]string
+		expected    CookieOptions
+		expectErr   bool
+	}{
+		{name: "plain defaults", expected: CookieOptions{HTTPOnly: true}},
+		{name: "edge defaults", tls: edge, expected: secureDefaults},
+		{name: "insecure allowed defaults", tls: allow, expected: CookieOptions{HTTPOnly: true}},
+		{
+			name: "all attributes",
+			tls:  edge,
+			annotations: map[string]string{
+				CookieNameAnnotation:     "session",
+				CookieSameSiteAnnotation: "Strict",
+				CookieHTTPOnlyAnnotation: "false",
+				CookiePathAnnotation:     "/app",
+				CookieMaxAgeAnnotation:   "3600",
+			},
+			expected: CookieOptions{Name: "session", Secure: true, SameSite: "Strict", Path: "/app", MaxAge: 3600},
+		},
+		{
+			name:        "insecure cookie",
+			tls:         edge,
+			annotations: map[string]string{CookieSecureAnnotation: "false"},
+			expected:    CookieOptions{HTTPOnly: true},
+		},
+		{
+			name:        "insecure cookie with lax same site",
+			tls:         edge,
+			annotations: map[string]string{CookieSecureAnnotation: "false", CookieSameSiteAnnotation: "Lax"},
+			expected:    CookieOptions{SameSite: "Lax", HTTPOnly: true},
+		},
+		{
+			name:        "secure cookie with insecure requests allowed",
+			tls:         allow,
+			annotations: map[string]string{CookieSecureAnnotation: "true", CookieSameSiteAnnotation: "None"},
+			expected:    secureDefaults,
+		},
+		{
+			name:        "same site none without secure",
+			tls:         edge,
+			annotations: map[string]string{CookieSecureAnnotation: "false", CookieSameSiteAnnotation: "None"},
+			expectErr:   true,
+		},
+		{
+			name:        "same site none on a plain route",
+			annotations: map[string]string{CookieSameSiteAnnotation: "None"},
+			expectErr:   true,
+		},
+		{
+			name:        "secure on a plain route",
+			annotations: map[string]string{CookieSecureAnnotation: "true"},
+			expectErr:   true,
+		},
+		{name: "invalid same site", tls: edge, annotations: map[string]string{CookieSameSiteAnnotation: "lax"}, expectErr: true},
+		{name: "invalid name", tls: edge, annotations: map[string]string{CookieNameAnnotation: "bad name"}, expectErr: true},
+		{name: "invalid httponly", tls: edge, annotations: map[string]string{CookieHTTPOnlyAnnotation: "maybe"}, expectErr: true},
+		{name: "invalid path", tls: edge, annotations: map[string]string{CookiePathAnnotation: "/a;Domain=x"}, expectErr: true},
+		{name: "relative path", tls: edge, annotations: map[string]string{CookiePathAnnotation: "app"}, expectErr: true},
+		{name: "zero max age", tls: edge, annotations: map[string]string{CookieMaxAgeAnnotation: "0"}, expectErr: true},
+		{name: "max age too large", tls: edge, annotations: map[string]string{CookieMaxAgeAnnotation: "34560001"}, expectErr: true},
+		{name: "passthrough", tls: passthrough, annotations: map[string]string{CookiePathAnnotation: "/"}, expectErr: true},
+		{name: "passthrough cookie name", tls: passthrough, annotations: map[string]string{CookieNameAnnotation: "session"}},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations},
+			Spec:       routev1.RouteSpec{TLS: tc.tls},
+		}
+		options, errs := GetCookieOptions(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if !tc.expectErr && !reflect.DeepEqual(options, tc.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, options)
+		}
+	}
+}
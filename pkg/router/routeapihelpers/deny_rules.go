@@ -0,0 +1,299 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// DenyRulesAnnotation lists the rules of the requests the router denies
+// with a 403 instead of forwarding them to the backends of a route.
+const DenyRulesAnnotation = "haproxy.router.openshift.io/deny-rules"
+
+// MaxDenyRules is the largest number of deny rules a route may have, as
+// every rule is evaluated for every request of the route.
+const MaxDenyRules = 16
+
+var (
+	// denyRuleMethodPattern matches the methods of deny rules.
+	denyRuleMethodPattern = regexp.MustCompile(`^[A-Z]+$`)
+	// denyRulePathPattern matches the paths of deny rules, which are
+	// written as is in the haproxy configuration and matched against the
+	// decoded paths of the requests.
+	denyRulePathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~!$&+,=:@/-]*$`)
+	// denyRuleHeaderValuePattern matches the header values of deny rules.
+	denyRuleHeaderValuePattern = regexp.MustCompile(`^[A-Za-z0-9._~!$&+,=:@%/-]+$`)
+)
+
+// denyRulePathFetch is the path of the requests deny rules match: decoded,
+// so that encoded slashes do not get a request past the rules, with the
+// slashes decoding repeats merged.
+const denyRulePathFetch = "path,url_dec,regsub(/+,/,g)"
+
+// denyRuleNormalizers are the normalizers applied to the request URI before
+// deny rules match its path, so that encoded unreserved characters, dot
+// segments and repeated slashes do not get a request past the rules.
+var denyRuleNormalizers = []string{"percent-decode-unreserved", "path-strip-dotdot full", "path-merge-slashes"}
+
+// DenyRule matches the requests a route denies.  A request matches the
+// rule if it matches all of the fields set.
+type DenyRule struct {
+	// Methods are the methods of the matching requests, if set.
+	Methods []string
+	// Path is the path of the matching requests, if set.
+	Path string
+	// PathPrefix is true if Path matches the paths it prefixes.
+	PathPrefix bool
+	// Headers are the headers the matching requests have.
+	Headers []DenyRuleHeader
+	// MissingHeaders are the headers the matching requests do not have.
+	MissingHeaders []string
+}
+
+// DenyRuleHeader matches the requests with a header, or with a given value
+// of the header if Value is set.
+type DenyRuleHeader struct {
+	Name  string
+	Value string
+}
+
+// ACL returns the haproxy condition matching the requests of the rule.
+func (r DenyRule) ACL() string {
+	var terms []string
+	if len(r.Methods) > 0 {
+		terms = append(terms, fmt.Sprintf("{ method %s }", strings.Join(r.Methods, " ")))
+	}
+	if len(r.Path) > 0 {
+		if r.PathPrefix {
+			terms = append(terms, fmt.Sprintf("{ %s -m beg %s }", denyRulePathFetch, r.Path))
+		} else {
+			terms = append(terms, fmt.Sprintf("{ %s -m str %s }", denyRulePathFetch, r.Path))
+		}
+	}
+	for _, header := range r.Headers {
+		if len(header.Value) > 0 {
+			terms = append(terms, fmt.Sprintf("{ req.hdr(%s) -m str %s }", header.Name, header.Value))
+		} else {
+			terms = append(terms, fmt.Sprintf("{ req.hdr(%s) -m found }", header.Name))
+		}
+	}
+	for _, name := range r.MissingHeaders {
+		terms = append(terms, fmt.Sprintf("!{ req.hdr(%s) -m found }", name))
+	}
+	return strings.Join(terms, " ")
+}
+
+// Matches returns whether a request matches the rule, the way haproxy
+// evaluates its ACL: the path is normalized and decoded, and header values
+// are the comma separated values of all the occurrences of the header.
+func (r DenyRule) Matches(method, requestPath string, headers http.Header) bool {
+	if len(r.Methods) > 0 {
+		matched := false
+		for _, m := range r.Methods {
+			if m == method {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Path) > 0 {
+		p := denyRulePath(requestPath)
+		if r.PathPrefix && !strings.HasPrefix(p, r.Path) {
+			return false
+		}
+		if !r.PathPrefix && p != r.Path {
+			return false
+		}
+	}
+	for _, header := range r.Headers {
+		values := headerValues(headers, header.Name)
+		if len(values) == 0 {
+			return false
+		}
+		if len(header.Value) > 0 {
+			matched := false
+			for _, value := range values {
+				if value == header.Value {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+	for _, name := range r.MissingHeaders {
+		if len(headerValues(headers, name)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// denyRulePath returns the path deny rules match for the path of a request:
+// decoded, without dot segments and repeated slashes.
+func denyRulePath(requestPath string) string {
+	if decoded, err := url.PathUnescape(requestPath); err == nil {
+		requestPath = decoded
+	}
+	cleaned := path.Clean("/" + requestPath)
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// DenyRuleURINormalizers returns the URI normalizers of a route with deny
+// rules: its own normalizers followed by the ones its rules on paths
+// require that it does not have.
+func DenyRuleURINormalizers(normalizers []string, rules []DenyRule) []string {
+	hasPath := false
+	for _, rule := range rules {
+		hasPath = hasPath || len(rule.Path) > 0
+	}
+	if !hasPath {
+		return normalizers
+	}
+	names := map[string]bool{}
+	for _, normalizer := range normalizers {
+		names[strings.Fields(normalizer)[0]] = true
+	}
+	result := append([]string{}, normalizers...)
+	for _, normalizer := range denyRuleNormalizers {
+		if !names[strings.Fields(normalizer)[0]] {
+			result = append(result, normalizer)
+		}
+	}
+	return result
+}
+
+// headerValues returns the comma separated values of the occurrences of the
+// header name, as req.hdr() does.
+func headerValues(headers http.Header, name string) []string {
+	var values []string
+	for _, occurrence := range headers.Values(name) {
+		for _, value := range strings.Split(occurrence, ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+	return values
+}
+
+// ParseDenyRules parses deny rules separated by semicolons or new lines.  A
+// rule is a space separated list of matchers the denied requests match
+// together:
+//
+//	method=<method>[,<method>...]	one of the methods
+//	path=<path>			the path, or any path it prefixes if it ends with /*
+//	header=<name>[:<value>]		the header, with the value if set
+//	missing-header=<name>		not the header
+//
+// e.g. "method=TRACE; path=/internal/*; method=POST missing-header=X-Token".
+func ParseDenyRules(value string) ([]DenyRule, error) {
+	var rules []DenyRule
+	for _, line := range strings.Split(value, "\n") {
+		for _, item := range strings.Split(line, ";") {
+			matchers := strings.Fields(item)
+			if len(matchers) == 0 {
+				continue
+			}
+			rule, err := parseDenyRule(matchers)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q %v", strings.TrimSpace(item), err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) > MaxDenyRules {
+		return nil, fmt.Errorf("has %d rules, at most %d are allowed", len(rules), MaxDenyRules)
+	}
+	return rules, nil
+}
+
+func parseDenyRule(matchers []string) (DenyRule, error) {
+	rule := DenyRule{}
+	for _, matcher := range matchers {
+		key, value, ok := strings.Cut(matcher, "=")
+		if !ok || len(value) == 0 {
+			return rule, fmt.Errorf("has a matcher %q without a value", matcher)
+		}
+		switch key {
+		case "method":
+			if len(rule.Methods) > 0 {
+				return rule, fmt.Errorf("has more than one method matcher")
+			}
+			for _, method := range strings.Split(value, ",") {
+				if !denyRuleMethodPattern.MatchString(method) {
+					return rule, fmt.Errorf("has an invalid method %q", method)
+				}
+				rule.Methods = append(rule.Methods, method)
+			}
+		case "path":
+			if len(rule.Path) > 0 {
+				return rule, fmt.Errorf("has more than one path matcher")
+			}
+			path := value
+			if strings.HasSuffix(path, "/*") {
+				path = strings.TrimSuffix(path, "*")
+				rule.PathPrefix = true
+			}
+			if !denyRulePathPattern.MatchString(path) {
+				return rule, fmt.Errorf("has an invalid path %q", value)
+			}
+			rule.Path = path
+		case "header":
+			name, headerValue, hasValue := strings.Cut(value, ":")
+			if !responseHeaderNamePattern.MatchString(name) {
+				return rule, fmt.Errorf("has an invalid header name %q", name)
+			}
+			if hasValue && !denyRuleHeaderValuePattern.MatchString(headerValue) {
+				return rule, fmt.Errorf("has an invalid value for header %q", name)
+			}
+			rule.Headers = append(rule.Headers, DenyRuleHeader{Name: name, Value: headerValue})
+		case "missing-header":
+			if !responseHeaderNamePattern.MatchString(value) {
+				return rule, fmt.Errorf("has an invalid header name %q", value)
+			}
+			rule.MissingHeaders = append(rule.MissingHeaders, value)
+		default:
+			return rule, fmt.Errorf("has an unknown matcher %q, must be method, path, header or missing-header", key)
+		}
+	}
+	return rule, nil
+}
+
+// GetDenyRules returns the deny rules of a route.  Passthrough routes do
+// not support them as the router does not see their requests.
+func GetDenyRules(route *routev1.Route) ([]DenyRule, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[DenyRulesAnnotation]
+	if !ok {
+		return nil, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(DenyRulesAnnotation)
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return nil, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	rules, err := ParseDenyRules(value)
+	if err != nil {
+		return nil, append(result, field.Invalid(fldPath, value, err.Error()))
+	}
+	return rules, result
+}
+
+// ValidateDenyRules checks that the deny rules of a route are valid.
+func ValidateDenyRules(route *routev1.Route) field.ErrorList {
+	_, result := GetDenyRules(route)
+	return result
+}
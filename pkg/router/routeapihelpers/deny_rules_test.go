@@ -0,0 +1,165 @@
+package routeapihelpers
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestParseDenyRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "single matchers",
+			value: "method=TRACE,TRACK; path=/internal/*\npath=/metrics;",
+			expected: []string{
+				"{ method TRACE TRACK }",
+				"{ path,url_dec,regsub(/+,/,g) -m beg /internal/ }",
+				"{ path,url_dec,regsub(/+,/,g) -m str /metrics }",
+			},
+		},
+		{
+			name:  "combined matchers",
+			value: "method=POST path=/admin/* missing-header=X-Token header=X-Debug header=X-Env:test",
+			expected: []string{
+				"{ method POST } { path,url_dec,regsub(/+,/,g) -m beg /admin/ } { req.hdr(X-Debug) -m found } { req.hdr(X-Env) -m str test } !{ req.hdr(X-Token) -m found }",
+			},
+		},
+		{
+			name:      "unknown matcher",
+			value:     "query=debug",
+			expectErr: true,
+		},
+		{
+			name:      "no value",
+			value:     "method=",
+			expectErr: true,
+		},
+		{
+			name:      "lower case method",
+			value:     "method=trace",
+			expectErr: true,
+		},
+		{
+			name:      "relative path",
+			value:     "path=internal",
+			expectErr: true,
+		},
+		{
+			name:      "path with a brace",
+			value:     "path=/a}",
+			expectErr: true,
+		},
+		{
+			name:      "two paths",
+			value:     "path=/a path=/b",
+			expectErr: true,
+		},
+		{
+			name:      "invalid header",
+			value:     "missing-header=X(Token)",
+			expectErr: true,
+		},
+		{
+			name:      "invalid header value",
+			value:     "header=X-Env:a'b",
+			expectErr: true,
+		},
+		{
+			name:      "too many rules",
+			value:     strings.Repeat("method=TRACE;", MaxDenyRules+1),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseDenyRules(tc.value)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			var acls []string
+			for _, rule := range rules {
+				acls = append(acls, rule.ACL())
+			}
+			if !reflect.DeepEqual(acls, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, acls)
+			}
+		})
+	}
+}
+
+func TestGetDenyRules(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{DenyRulesAnnotation: "method=TRACE"}},
+	}
+	if rules, errs := GetDenyRules(route); len(errs) > 0 || len(rules) != 1 {
+		t.Errorf("expected a rule, got %v %v", rules, errs)
+	}
+
+	route.Spec.TLS = &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough}
+	if errs := ValidateDenyRules(route); len(errs) != 1 {
+		t.Errorf("expected the deny rules of a passthrough route to be invalid, got %v", errs)
+	}
+}
+
+func TestDenyRuleMatches(t *testing.T) {
+	rules, err := ParseDenyRules("method=POST path=/admin/* header=X-Env:test missing-header=X-Token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rule := rules[0]
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		headers  http.Header
+		expected bool
+	}{
+		{name: "all matchers", method: "POST", path: "/admin/users", headers: http.Header{"X-Env": {"prod, test"}}, expected: true},
+		{name: "other method", method: "GET", path: "/admin/users", headers: http.Header{"X-Env": {"test"}}},
+		{name: "other path", method: "POST", path: "/users", headers: http.Header{"X-Env": {"test"}}},
+		{name: "other header value", method: "POST", path: "/admin/users", headers: http.Header{"X-Env": {"prod"}}},
+		{name: "present header", method: "POST", path: "/admin/users", headers: http.Header{"X-Env": {"test"}, "X-Token": {"secret"}}},
+		{name: "encoded slash", method: "POST", path: "/admin%2Fusers", headers: http.Header{"X-Env": {"test"}}, expected: true},
+		{name: "repeated slashes", method: "POST", path: "//admin//users", headers: http.Header{"X-Env": {"test"}}, expected: true},
+		{name: "dot segments", method: "POST", path: "/public/../admin/users", headers: http.Header{"X-Env": {"test"}}, expected: true},
+	}
+	for _, tc := range tests {
+		if matched := rule.Matches(tc.method, tc.path, tc.headers); matched != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, matched)
+		}
+	}
+}
+
+func TestDenyRuleURINormalizers(t *testing.T) {
+	pathRules, _ := ParseDenyRules("path=/admin/*")
+	methodRules, _ := ParseDenyRules("method=TRACE")
+	tests := []struct {
+		name        string
+		normalizers []string
+		rules       []DenyRule
+		expected    []string
+	}{
+		{name: "no path rule", normalizers: []string{"path-merge-slashes"}, rules: methodRules, expected: []string{"path-merge-slashes"}},
+		{name: "path rule", rules: pathRules, expected: []string{"percent-decode-unreserved", "path-strip-dotdot full", "path-merge-slashes"}},
+		{name: "route normalizers kept", normalizers: []string{"path-strip-dotdot"}, rules: pathRules, expected: []string{"path-strip-dotdot", "percent-decode-unreserved", "path-merge-slashes"}},
+	}
+	for _, tc := range tests {
+		if got := DenyRuleURINormalizers(tc.normalizers, tc.rules); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
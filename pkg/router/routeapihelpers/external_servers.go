@@ -0,0 +1,95 @@
+package routeapihelpers
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// External servers are the servers of a route whose endpoints are not pods,
+// such as the addresses of another cluster listed in the EndpointSlices of a
+// service without a selector.
+const (
+	// ExternalServerCheckAnnotation health checks the external servers of
+	// a route even when it has a single server.
+	ExternalServerCheckAnnotation = "haproxy.router.openshift.io/external-server-check"
+	// ExternalServerVerifyHostnameAnnotation sets the host name the
+	// certificates of the external servers of a reencrypt route are
+	// verified against, and sent as SNI, instead of the service host name.
+	ExternalServerVerifyHostnameAnnotation = "haproxy.router.openshift.io/external-server-verify-hostname"
+	// ExternalServerProxyProtocolAnnotation sends the PROXY protocol
+	// header of the given version, "v1" or "v2", to the external servers of
+	// a route.
+	ExternalServerProxyProtocolAnnotation = "haproxy.router.openshift.io/external-server-proxy-protocol"
+)
+
+const (
+	ProxyProtocolV1 = "v1"
+	ProxyProtocolV2 = "v2"
+)
+
+// ExternalServerOptions are the options of the external servers of a route.
+type ExternalServerOptions struct {
+	// HealthCheck is true if the external servers are always checked.
+	HealthCheck bool
+	// VerifyHostname is the host name of the certificates of the external
+	// servers of a reencrypt route.
+	VerifyHostname string
+	// ProxyProtocol is the version of the PROXY protocol header sent to
+	// the external servers, if any.
+	ProxyProtocol string
+}
+
+// GetExternalServerOptions returns the options of the external servers of a
+// route.  The verified host name only applies to reencrypt routes, as the
+// router only opens TLS connections to the servers of those.
+func GetExternalServerOptions(route *routev1.Route) (ExternalServerOptions, field.ErrorList) {
+	options := ExternalServerOptions{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	if value, ok := route.Annotations[ExternalServerCheckAnnotation]; ok {
+		check, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			result = append(result, field.Invalid(fldPath.Key(ExternalServerCheckAnnotation), value, "must be true or false"))
+		}
+		options.HealthCheck = check
+	}
+
+	if value, ok := route.Annotations[ExternalServerVerifyHostnameAnnotation]; ok {
+		hostname := strings.ToLower(strings.TrimSpace(value))
+		switch {
+		case route.Spec.TLS == nil || route.Spec.TLS.Termination != routev1.TLSTerminationReencrypt:
+			result = append(result, field.Invalid(fldPath.Key(ExternalServerVerifyHostnameAnnotation), value, "is only supported for reencrypt routes"))
+		case len(validation.IsDNS1123Subdomain(hostname)) > 0:
+			result = append(result, field.Invalid(fldPath.Key(ExternalServerVerifyHostnameAnnotation), value, "must be a valid host name"))
+		default:
+			options.VerifyHostname = hostname
+		}
+	}
+
+	if value, ok := route.Annotations[ExternalServerProxyProtocolAnnotation]; ok {
+		switch version := strings.TrimSpace(value); version {
+		case ProxyProtocolV1, ProxyProtocolV2:
+			options.ProxyProtocol = version
+		default:
+			result = append(result, field.NotSupported(fldPath.Key(ExternalServerProxyProtocolAnnotation), value, []string{ProxyProtocolV1, ProxyProtocolV2}))
+		}
+	}
+
+	if len(result) > 0 {
+		return ExternalServerOptions{}, result
+	}
+	return options, result
+}
+
+// ValidateExternalServerOptions checks that the options of the external
+// servers of a route are valid.
+func ValidateExternalServerOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetExternalServerOptions(route)
+	return result
+}
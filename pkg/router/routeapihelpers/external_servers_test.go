@@ -0,0 +1,79 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetExternalServerOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		annotations map[string]string
+		expected    ExternalServerOptions
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name:        "all options",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{
+				ExternalServerCheckAnnotation:          "true",
+				ExternalServerVerifyHostnameAnnotation: "App.Other-Cluster.Example.com",
+				ExternalServerProxyProtocolAnnotation:  "v2",
+			},
+			expected: ExternalServerOptions{
+				HealthCheck:    true,
+				VerifyHostname: "app.other-cluster.example.com",
+				ProxyProtocol:  ProxyProtocolV2,
+			},
+		},
+		{
+			name:        "passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{
+				ExternalServerCheckAnnotation:         "true",
+				ExternalServerProxyProtocolAnnotation: "v1",
+			},
+			expected: ExternalServerOptions{HealthCheck: true, ProxyProtocol: ProxyProtocolV1},
+		},
+		{
+			name:        "verified host name on an edge route",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{ExternalServerVerifyHostnameAnnotation: "app.example.com"},
+			errs:        1,
+		},
+		{
+			name:        "invalid options",
+			termination: routev1.TLSTerminationReencrypt,
+			annotations: map[string]string{
+				ExternalServerCheckAnnotation:          "always",
+				ExternalServerVerifyHostnameAnnotation: "app example com",
+				ExternalServerProxyProtocolAnnotation:  "v3",
+			},
+			errs: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			options, errs := GetExternalServerOptions(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if !reflect.DeepEqual(options, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package routeapihelpers
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// SetForwardedHeadersAnnotation sets how the router sets the Forwarded and
+// X-Forwarded-* headers of the requests to a route, overriding the policy of
+// the router.
+const SetForwardedHeadersAnnotation = "haproxy.router.openshift.io/set-forwarded-headers"
+
+// The policies for the Forwarded and X-Forwarded-* headers.
+const (
+	// SetForwardedHeadersAppend appends the headers of the router to the
+	// headers of the request, so that the backends see every proxy the
+	// request went through.
+	SetForwardedHeadersAppend = "append"
+	// SetForwardedHeadersReplace replaces the headers of the request with
+	// those of the router, for backends that must only trust the router.
+	SetForwardedHeadersReplace = "replace"
+	// SetForwardedHeadersIfNone only sets the headers the request does not
+	// have, so that the backends see the client of the first proxy.
+	SetForwardedHeadersIfNone = "if-none"
+	// SetForwardedHeadersNever leaves the headers of the request as they
+	// are.
+	SetForwardedHeadersNever = "never"
+)
+
+// SetForwardedHeadersPolicies are the supported policies for the Forwarded
+// and X-Forwarded-* headers.
+var SetForwardedHeadersPolicies = []string{
+	SetForwardedHeadersAppend,
+	SetForwardedHeadersReplace,
+	SetForwardedHeadersIfNone,
+	SetForwardedHeadersNever,
+}
+
+// GetSetForwardedHeaders returns the policy for the Forwarded and
+// X-Forwarded-* headers of a route, or defaultPolicy if the route does not
+// set one.
+func GetSetForwardedHeaders(route *routev1.Route, defaultPolicy string) (string, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[SetForwardedHeadersAnnotation]
+	if !ok {
+		return defaultPolicy, result
+	}
+	for _, policy := range SetForwardedHeadersPolicies {
+		if value == policy {
+			return policy, result
+		}
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(SetForwardedHeadersAnnotation)
+	return defaultPolicy, append(result, field.NotSupported(fldPath, value, SetForwardedHeadersPolicies))
+}
+
+// ValidateSetForwardedHeaders checks that the policy of a route for the
+// Forwarded and X-Forwarded-* headers is supported.
+func ValidateSetForwardedHeaders(route *routev1.Route) field.ErrorList {
+	_, result := GetSetForwardedHeaders(route, "")
+	return result
+}
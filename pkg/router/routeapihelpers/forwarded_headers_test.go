@@ -0,0 +1,63 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetSetForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		errs        int
+	}{
+		{
+			name:     "router default",
+			expected: SetForwardedHeadersReplace,
+		},
+		{
+			name:        "append",
+			annotations: map[string]string{SetForwardedHeadersAnnotation: "append"},
+			expected:    SetForwardedHeadersAppend,
+		},
+		{
+			name:        "if-none",
+			annotations: map[string]string{SetForwardedHeadersAnnotation: "if-none"},
+			expected:    SetForwardedHeadersIfNone,
+		},
+		{
+			name:        "never",
+			annotations: map[string]string{SetForwardedHeadersAnnotation: "never"},
+			expected:    SetForwardedHeadersNever,
+		},
+		{
+			name:        "unsupported policy",
+			annotations: map[string]string{SetForwardedHeadersAnnotation: "Append"},
+			expected:    SetForwardedHeadersReplace,
+			errs:        1,
+		},
+		{
+			name:        "empty policy",
+			annotations: map[string]string{SetForwardedHeadersAnnotation: ""},
+			expected:    SetForwardedHeadersReplace,
+			errs:        1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			policy, errs := GetSetForwardedHeaders(route, SetForwardedHeadersReplace)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if policy != tc.expected {
+				t.Errorf("expected policy %q, got %q", tc.expected, policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package routeapihelpers
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// GRPCAnnotation sets whether the backends of a route serve gRPC, which
+// the router otherwise detects from the "grpc" appProtocol of the ports of
+// their endpoints.  The router applies defaults suited to gRPC to the
+// routes that do.
+const GRPCAnnotation = "haproxy.router.openshift.io/grpc"
+
+// GetGRPC returns whether a route sets its backends to serve gRPC, or nil
+// if it leaves it to be detected.  Passthrough routes are not supported, as
+// the router does not see their requests.
+func GetGRPC(route *routev1.Route) (*bool, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[GRPCAnnotation]
+	if !ok {
+		return nil, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(GRPCAnnotation)
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return nil, append(result, field.Invalid(fldPath, value, "must be true or false"))
+	}
+	if enabled && route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return nil, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	return &enabled, result
+}
+
+// ValidateGRPC checks that the gRPC annotation of a route is valid.
+func ValidateGRPC(route *routev1.Route) field.ErrorList {
+	_, result := GetGRPC(route)
+	return result
+}
@@ -0,0 +1,44 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetGRPC(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		termination routev1.TLSTerminationType
+		expected    *bool
+		expectErr   bool
+	}{
+		{name: "detected"},
+		{name: "enabled", annotations: map[string]string{GRPCAnnotation: "true"}, expected: boolPtr(true)},
+		{name: "disabled", annotations: map[string]string{GRPCAnnotation: "false"}, expected: boolPtr(false)},
+		{name: "invalid", annotations: map[string]string{GRPCAnnotation: "h2"}, expectErr: true},
+		{name: "passthrough", annotations: map[string]string{GRPCAnnotation: "true"}, termination: routev1.TLSTerminationPassthrough, expectErr: true},
+		{name: "disabled passthrough", annotations: map[string]string{GRPCAnnotation: "false"}, termination: routev1.TLSTerminationPassthrough, expected: boolPtr(false)},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		if len(tc.termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+		}
+		grpc, errs := GetGRPC(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if (grpc == nil) != (tc.expected == nil) || (grpc != nil && *grpc != *tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, grpc)
+		}
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
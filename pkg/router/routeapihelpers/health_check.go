@@ -0,0 +1,42 @@
+package routeapihelpers
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// HealthCheckIntervalAnnotation sets the interval between the health
+	// checks of the servers of a route.
+	HealthCheckIntervalAnnotation = "router.openshift.io/haproxy.health.check.interval"
+	// HealthCheckMaxIntervalAnnotation sets how far the health check
+	// interval of a route grows while its servers stay healthy, overriding
+	// the router wide maximum.  A maximum that does not exceed the health
+	// check interval keeps the interval of the route fixed.
+	HealthCheckMaxIntervalAnnotation = "router.openshift.io/haproxy.health.check.max-interval"
+)
+
+// GetHealthCheckMaxInterval returns the maximum adaptive health check
+// interval of a route, zero if the route does not set one.
+func GetHealthCheckMaxInterval(route *routev1.Route) (time.Duration, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[HealthCheckMaxIntervalAnnotation]
+	if !ok {
+		return 0, result
+	}
+	interval, err := ParseHAProxyTimeout(value)
+	if err != nil {
+		result = append(result, field.Invalid(field.NewPath("metadata", "annotations").Key(HealthCheckMaxIntervalAnnotation), value, err.Error()))
+	}
+	return interval, result
+}
+
+// ValidateHealthCheckMaxInterval checks that the maximum adaptive health
+// check interval of a route is valid.
+func ValidateHealthCheckMaxInterval(route *routev1.Route) field.ErrorList {
+	_, result := GetHealthCheckMaxInterval(route)
+	return result
+}
@@ -0,0 +1,58 @@
+package routeapihelpers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetHealthCheckMaxInterval(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    time.Duration
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name:        "minutes",
+			annotations: map[string]string{HealthCheckMaxIntervalAnnotation: "5m"},
+			expected:    5 * time.Minute,
+		},
+		{
+			name:        "milliseconds without a unit",
+			annotations: map[string]string{HealthCheckMaxIntervalAnnotation: "30000"},
+			expected:    30 * time.Second,
+		},
+		{
+			name:        "zero",
+			annotations: map[string]string{HealthCheckMaxIntervalAnnotation: "0"},
+			errs:        1,
+		},
+		{
+			name:        "go duration",
+			annotations: map[string]string{HealthCheckMaxIntervalAnnotation: "1m30s"},
+			errs:        1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+			}
+			interval, errs := GetHealthCheckMaxInterval(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if interval != tc.expected {
+				t.Fatalf("expected %v, got %v", tc.expected, interval)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// HostRewriteAnnotation rewrites the Host header of requests sent to
+	// the backend of a route.
+	HostRewriteAnnotation = "haproxy.router.openshift.io/rewrite-host"
+
+	// HostRewriteService is the HostRewriteAnnotation value that rewrites
+	// the Host header to the internal DNS name of the route's service.
+	HostRewriteService = "service"
+)
+
+// BackendHostHeader returns the Host header that requests sent to the
+// backend of the route should carry, or the empty string if the route does
+// not rewrite it.  The annotation value is either HostRewriteService, for
+// the "service.namespace.svc" name of the route's service, or a host name
+// with an optional port.
+func BackendHostHeader(route *routev1.Route) (string, error) {
+	value, ok := route.Annotations[HostRewriteAnnotation]
+	if !ok {
+		return "", nil
+	}
+	value = strings.TrimSpace(value)
+	if value == HostRewriteService {
+		if route.Spec.To.Kind != "" && route.Spec.To.Kind != "Service" {
+			return "", fmt.Errorf("route does not point to a service")
+		}
+		if len(route.Spec.To.Name) == 0 {
+			return "", fmt.Errorf("route does not specify a service")
+		}
+		return fmt.Sprintf("%s.%s.svc", route.Spec.To.Name, route.Namespace), nil
+	}
+
+	host, port := value, ""
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		host, port = value[:i], value[i+1:]
+		n, err := strconv.Atoi(port)
+		if err != nil || len(kvalidation.IsValidPortNum(n)) > 0 {
+			return "", fmt.Errorf("%q has an invalid port", value)
+		}
+	}
+	if errs := kvalidation.IsDNS1123Subdomain(host); len(errs) > 0 {
+		return "", fmt.Errorf("must be %q or a host name with an optional port: %s", HostRewriteService, strings.Join(errs, ", "))
+	}
+	return value, nil
+}
+
+// ValidateRouteHostRewrite checks that the host rewrite annotation of a
+// route, if any, is well formed.
+func ValidateRouteHostRewrite(route *routev1.Route) field.ErrorList {
+	result := field.ErrorList{}
+	if _, err := BackendHostHeader(route); err != nil {
+		fldPath := field.NewPath("metadata", "annotations").Key(HostRewriteAnnotation)
+		result = append(result, field.Invalid(fldPath, route.Annotations[HostRewriteAnnotation], err.Error()))
+	}
+	return result
+}
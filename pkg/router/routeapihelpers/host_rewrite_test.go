@@ -0,0 +1,96 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestBackendHostHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		to          routev1.RouteTargetReference
+		expected    string
+		err         bool
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:        "service",
+			annotations: map[string]string{HostRewriteAnnotation: "service"},
+			to:          routev1.RouteTargetReference{Kind: "Service", Name: "svc"},
+			expected:    "svc.ns.svc",
+		},
+		{
+			name:        "service without kind",
+			annotations: map[string]string{HostRewriteAnnotation: " service "},
+			to:          routev1.RouteTargetReference{Name: "svc"},
+			expected:    "svc.ns.svc",
+		},
+		{
+			name:        "service with other kind",
+			annotations: map[string]string{HostRewriteAnnotation: "service"},
+			to:          routev1.RouteTargetReference{Kind: "Pod", Name: "svc"},
+			err:         true,
+		},
+		{
+			name:        "fixed host",
+			annotations: map[string]string{HostRewriteAnnotation: "backend.example.com"},
+			expected:    "backend.example.com",
+		},
+		{
+			name:        "fixed host and port",
+			annotations: map[string]string{HostRewriteAnnotation: "backend.example.com:8080"},
+			expected:    "backend.example.com:8080",
+		},
+		{
+			name:        "invalid port",
+			annotations: map[string]string{HostRewriteAnnotation: "backend.example.com:99999"},
+			err:         true,
+		},
+		{
+			name:        "invalid host",
+			annotations: map[string]string{HostRewriteAnnotation: "backend example.com"},
+			err:         true,
+		},
+		{
+			name:        "header injection",
+			annotations: map[string]string{HostRewriteAnnotation: "backend.example.com\r\nX-Injected: 1"},
+			err:         true,
+		},
+		{
+			name:        "empty",
+			annotations: map[string]string{HostRewriteAnnotation: ""},
+			err:         true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+				Spec:       routev1.RouteSpec{To: tc.to},
+			}
+			host, err := BackendHostHeader(route)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", host)
+				}
+				if errs := ValidateRouteHostRewrite(route); len(errs) != 1 {
+					t.Fatalf("expected 1 validation error, got %v", errs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if host != tc.expected {
+				t.Fatalf("expected %q, got %q", tc.expected, host)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// HTTPCompatAnnotation is a comma separated list of the HTTP/1 compatibility
+// options of a route for legacy clients and backends.  The router only
+// allows the options of its allowlist.
+const HTTPCompatAnnotation = "haproxy.router.openshift.io/http-compat"
+
+const (
+	// HTTPCompatH1CaseAdjust sends the headers to the backends of the
+	// route with the case of the header name case adjustments of the
+	// router.
+	HTTPCompatH1CaseAdjust = "h1-case-adjust"
+	// HTTPCompatAcceptInvalidRequest accepts requests with invalid
+	// characters in their header names or URI.  Requests are parsed before
+	// their route is known, so it applies to all the requests of the
+	// frontends the route is served by.
+	HTTPCompatAcceptInvalidRequest = "accept-invalid-http-request"
+	// HTTPCompatAcceptInvalidResponse accepts responses with invalid
+	// characters in their header names from the backends of the route.
+	HTTPCompatAcceptInvalidResponse = "accept-invalid-http-response"
+	// HTTPCompatServerClose closes the connection to the backend after
+	// each response, for backends that mishandle keep-alive.
+	HTTPCompatServerClose = "http-server-close"
+	// HTTPCompatPretendKeepalive asks the backends of the route to keep
+	// the connection alive, for HTTP/1.0 backends that otherwise close it
+	// before the client has the whole response.
+	HTTPCompatPretendKeepalive = "http-pretend-keepalive"
+)
+
+// SupportedHTTPCompatOptions are the HTTP/1 compatibility options routes may
+// set.
+var SupportedHTTPCompatOptions = []string{
+	HTTPCompatH1CaseAdjust,
+	HTTPCompatAcceptInvalidRequest,
+	HTTPCompatAcceptInvalidResponse,
+	HTTPCompatServerClose,
+	HTTPCompatPretendKeepalive,
+}
+
+// DefaultHTTPCompatOptions are the HTTP/1 compatibility options routers
+// allow unless configured otherwise.  They only change how the router talks
+// to the backends of the route that sets them, the options that relax the
+// parsing of requests and responses must be allowed explicitly.
+var DefaultHTTPCompatOptions = []string{
+	HTTPCompatH1CaseAdjust,
+	HTTPCompatServerClose,
+	HTTPCompatPretendKeepalive,
+}
+
+// HTTPCompatOptions are the HTTP/1 compatibility options of a route.
+type HTTPCompatOptions struct {
+	H1CaseAdjust          bool
+	AcceptInvalidRequest  bool
+	AcceptInvalidResponse bool
+	ServerClose           bool
+	PretendKeepalive      bool
+}
+
+// GetHTTPCompatOptions returns the HTTP/1 compatibility options of a route.
+// The options only apply to routes whose HTTP traffic the router terminates,
+// and must be in allowed.
+func GetHTTPCompatOptions(route *routev1.Route, allowed sets.String) (HTTPCompatOptions, field.ErrorList) {
+	options := HTTPCompatOptions{}
+	result := field.ErrorList{}
+	value, ok := route.Annotations[HTTPCompatAnnotation]
+	if !ok {
+		return options, result
+	}
+
+	fldPath := field.NewPath("metadata", "annotations").Key(HTTPCompatAnnotation)
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return options, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	if _, ok := route.Annotations[TCPPortAnnotation]; ok {
+		return options, append(result, field.Invalid(fldPath, value, fmt.Sprintf("is not supported for routes with %s", TCPPortAnnotation)))
+	}
+
+	for _, option := range strings.Split(value, ",") {
+		option = strings.TrimSpace(option)
+		if len(option) == 0 {
+			continue
+		}
+		if !allowed.Has(option) {
+			if sets.NewString(SupportedHTTPCompatOptions...).Has(option) {
+				result = append(result, field.Forbidden(fldPath, fmt.Sprintf("%s is not allowed on this router", option)))
+			} else {
+				result = append(result, field.NotSupported(fldPath, option, SupportedHTTPCompatOptions))
+			}
+			continue
+		}
+		switch option {
+		case HTTPCompatH1CaseAdjust:
+			options.H1CaseAdjust = true
+		case HTTPCompatAcceptInvalidRequest:
+			options.AcceptInvalidRequest = true
+		case HTTPCompatAcceptInvalidResponse:
+			options.AcceptInvalidResponse = true
+		case HTTPCompatServerClose:
+			options.ServerClose = true
+		case HTTPCompatPretendKeepalive:
+			options.PretendKeepalive = true
+		default:
+			result = append(result, field.NotSupported(fldPath, option, SupportedHTTPCompatOptions))
+		}
+	}
+
+	if len(result) > 0 {
+		return HTTPCompatOptions{}, result
+	}
+	return options, result
+}
+
+// ValidateHTTPCompatOptions checks that the HTTP/1 compatibility options of a
+// route are valid and allowed.
+func ValidateHTTPCompatOptions(route *routev1.Route, allowed sets.String) field.ErrorList {
+	_, result := GetHTTPCompatOptions(route, allowed)
+	return result
+}
@@ -0,0 +1,80 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetHTTPCompatOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		annotations map[string]string
+		allowed     []string
+		expected    HTTPCompatOptions
+		errs        int
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:        "default options",
+			annotations: map[string]string{HTTPCompatAnnotation: "h1-case-adjust, http-server-close,http-pretend-keepalive"},
+			expected:    HTTPCompatOptions{H1CaseAdjust: true, ServerClose: true, PretendKeepalive: true},
+		},
+		{
+			name:        "relaxed parsing allowed",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{HTTPCompatAnnotation: "accept-invalid-http-request,accept-invalid-http-response"},
+			allowed:     SupportedHTTPCompatOptions,
+			expected:    HTTPCompatOptions{AcceptInvalidRequest: true, AcceptInvalidResponse: true},
+		},
+		{
+			name:        "relaxed parsing not allowed",
+			annotations: map[string]string{HTTPCompatAnnotation: "http-server-close,accept-invalid-http-request,accept-invalid-http-response"},
+			errs:        2,
+		},
+		{
+			name:        "unknown option",
+			annotations: map[string]string{HTTPCompatAnnotation: "http10"},
+			allowed:     SupportedHTTPCompatOptions,
+			errs:        1,
+		},
+		{
+			name:        "passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{HTTPCompatAnnotation: "http-server-close"},
+			errs:        1,
+		},
+		{
+			name:        "tcp port route",
+			annotations: map[string]string{HTTPCompatAnnotation: "http-server-close", TCPPortAnnotation: "true"},
+			errs:        1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			allowed := tc.allowed
+			if allowed == nil {
+				allowed = DefaultHTTPCompatOptions
+			}
+			options, errs := GetHTTPCompatOptions(route, sets.NewString(allowed...))
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if !reflect.DeepEqual(options, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
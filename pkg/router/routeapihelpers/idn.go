@@ -0,0 +1,83 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// idnaProfile converts internationalized host names the way browsers look
+// them up, and checks that the labels of ASCII host names that are already
+// punycode encoded decode to valid labels.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.ValidateLabels(true),
+	idna.VerifyDNSLength(true),
+	idna.Transitional(false),
+)
+
+// IsIDNHost returns true if host has non-ASCII characters.
+func IsIDNHost(host string) bool {
+	for i := 0; i < len(host); i++ {
+		if host[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// ASCIIHost returns the ASCII form haproxy matches requests with of a route
+// host: the punycode encoding of an internationalized host name, or the
+// host itself if it only has ASCII characters.
+func ASCIIHost(host string) (string, error) {
+	if !IsIDNHost(host) {
+		return host, nil
+	}
+	ascii, err := idnaProfile.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// ValidateRouteHostIDN checks that the host of a route is a valid
+// internationalized host name, or that it only has ASCII characters if the
+// router does not allow internationalized host names.  Punycode encoded
+// labels of ASCII hosts must decode to valid labels.
+func ValidateRouteHostIDN(route *routev1.Route, allowIDN bool) field.ErrorList {
+	result := field.ErrorList{}
+	host := route.Spec.Host
+	if len(host) == 0 {
+		return result
+	}
+
+	fldPath := field.NewPath("spec", "host")
+	if IsIDNHost(host) {
+		if !allowIDN {
+			return append(result, field.Invalid(fldPath, host, "internationalized host names are not allowed"))
+		}
+		ascii, err := ASCIIHost(host)
+		if err != nil {
+			return append(result, field.Invalid(fldPath, host, fmt.Sprintf("invalid internationalized host name: %v", err)))
+		}
+		if errs := kvalidation.IsDNS1123Subdomain(ascii); len(errs) > 0 {
+			return append(result, field.Invalid(fldPath, host, fmt.Sprintf("host name %s is invalid: %s", ascii, strings.Join(errs, ", "))))
+		}
+		return result
+	}
+
+	if strings.Contains(host, "xn--") {
+		if _, err := idnaProfile.ToUnicode(host); err != nil {
+			result = append(result, field.Invalid(fldPath, host, fmt.Sprintf("invalid punycode label: %v", err)))
+		}
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestASCIIHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+		err      bool
+	}{
+		{host: "www.example.com", expected: "www.example.com"},
+		{host: "café.example.com", expected: "xn--caf-dma.example.com"},
+		{host: "Bücher.example.com", expected: "xn--bcher-kva.example.com"},
+		{host: "straße.example.com", expected: "xn--strae-oqa.example.com"},
+		{host: "例え.テスト", expected: "xn--r8jz45g.xn--zckzah"},
+		{host: "a‍.example.com", err: true},
+	}
+
+	for _, tc := range tests {
+		host, err := ASCIIHost(tc.host)
+		if tc.err != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tc.host, tc.err, err)
+			continue
+		}
+		if host != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.host, tc.expected, host)
+		}
+	}
+}
+
+func TestValidateRouteHostIDN(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		allowIDN bool
+		errs     int
+	}{
+		{name: "no host", allowIDN: false},
+		{name: "ascii host", host: "www.example.com"},
+		{name: "idn host", host: "café.example.com", allowIDN: true},
+		{name: "idn host not allowed", host: "café.example.com", errs: 1},
+		{name: "punycode host", host: "xn--caf-dma.example.com"},
+		{name: "invalid punycode host", host: "xn--a-ecp.example.com", errs: 1},
+		{name: "invalid idn host", host: "a‍.example.com", allowIDN: true, errs: 1},
+		{name: "idn host too long", host: "üaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.example.com", allowIDN: true, errs: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{Spec: routev1.RouteSpec{Host: tc.host}}
+			if errs := ValidateRouteHostIDN(route, tc.allowIDN); len(errs) != tc.errs {
+				t.Errorf("expected %d errors, got %v", tc.errs, errs)
+			}
+		})
+	}
+}
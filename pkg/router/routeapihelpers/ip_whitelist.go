@@ -0,0 +1,53 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// IPWhitelistAnnotation restricts the source addresses allowed to
+	// connect to a route to a white space separated list of IPs and CIDRs.
+	IPWhitelistAnnotation = "haproxy.router.openshift.io/ip_whitelist"
+
+	// MaxIPWhitelistEntries is the maximum number of IPs and CIDRs in the
+	// whitelist of a route.
+	MaxIPWhitelistEntries = 10000
+)
+
+// ValidateIPWhitelist checks that the whitelist of a route only has IPs and
+// CIDRs and does not have more entries than the router loads.  The router
+// otherwise ignores the invalid entries and truncates a longer whitelist,
+// denying the addresses they were meant to allow.
+func ValidateIPWhitelist(route *routev1.Route) field.ErrorList {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[IPWhitelistAnnotation]
+	if !ok {
+		return result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(IPWhitelistAnnotation)
+	entries := strings.Fields(value)
+	if n := len(entries); n > MaxIPWhitelistEntries {
+		result = append(result, field.Invalid(fldPath, fmt.Sprintf("%d entries", n), fmt.Sprintf("must have at most %d entries", MaxIPWhitelistEntries)))
+	}
+	for _, entry := range entries {
+		if !IsIPOrCIDR(entry) {
+			result = append(result, field.Invalid(fldPath, entry, "must be an IP or a CIDR"))
+		}
+	}
+	return result
+}
+
+// IsIPOrCIDR returns whether value is an IPv4 or IPv6 address or CIDR.
+func IsIPOrCIDR(value string) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+	return err == nil
+}
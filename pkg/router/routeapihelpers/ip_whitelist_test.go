@@ -0,0 +1,52 @@
+package routeapihelpers
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestValidateIPWhitelist(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expectErr   bool
+	}{
+		{name: "none"},
+		{
+			name:        "short list",
+			annotations: map[string]string{IPWhitelistAnnotation: "10.0.0.0/8 192.168.1.1"},
+		},
+		{
+			name:        "at the limit",
+			annotations: map[string]string{IPWhitelistAnnotation: strings.Repeat("10.0.0.1 ", MaxIPWhitelistEntries)},
+		},
+		{
+			name:        "invalid entry",
+			annotations: map[string]string{IPWhitelistAnnotation: "10.0.0.0/8 192.168."},
+			expectErr:   true,
+		},
+		{
+			name:        "invalid CIDR",
+			annotations: map[string]string{IPWhitelistAnnotation: "192.168.10.5/64"},
+			expectErr:   true,
+		},
+		{
+			name:        "too many entries",
+			annotations: map[string]string{IPWhitelistAnnotation: strings.Repeat("10.0.0.1 ", MaxIPWhitelistEntries+1)},
+			expectErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			errs := ValidateIPWhitelist(route)
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
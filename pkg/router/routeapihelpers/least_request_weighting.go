@@ -0,0 +1,39 @@
+package routeapihelpers
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// LeastRequestWeightingAnnotation enables the least-request weighting of
+// the servers of a route: the router lowers the weights of the servers with
+// the most outstanding requests, within its configured bounds, on top of the
+// weights of their services.
+const LeastRequestWeightingAnnotation = "haproxy.router.openshift.io/least-request-weighting"
+
+// GetLeastRequestWeighting returns whether the least-request weighting of
+// the servers of a route is enabled.
+func GetLeastRequestWeighting(route *routev1.Route) (bool, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[LeastRequestWeightingAnnotation]
+	if !ok {
+		return false, result
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		fldPath := field.NewPath("metadata", "annotations").Key(LeastRequestWeightingAnnotation)
+		return false, append(result, field.Invalid(fldPath, value, "must be true or false"))
+	}
+	return enabled, result
+}
+
+// ValidateLeastRequestWeighting checks that the least-request weighting
+// annotation of a route is valid.
+func ValidateLeastRequestWeighting(route *routev1.Route) field.ErrorList {
+	_, result := GetLeastRequestWeighting(route)
+	return result
+}
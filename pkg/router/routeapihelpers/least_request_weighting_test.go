@@ -0,0 +1,34 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetLeastRequestWeighting(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+		expectErr   bool
+	}{
+		{name: "unset"},
+		{name: "enabled", annotations: map[string]string{LeastRequestWeightingAnnotation: "true"}, expected: true},
+		{name: "disabled", annotations: map[string]string{LeastRequestWeightingAnnotation: "false"}},
+		{name: "invalid", annotations: map[string]string{LeastRequestWeightingAnnotation: "leastconn"}, expectErr: true},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		enabled, errs := GetLeastRequestWeighting(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if enabled != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, enabled)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// NormalizeURIAnnotation lists the normalizers applied to the request URI
+// in the backend of a route, before the path is rewritten and the request
+// is forwarded.  Normalizers applied router wide run before the route is
+// selected.
+const NormalizeURIAnnotation = "haproxy.router.openshift.io/normalize-uri"
+
+// uriNormalizers maps the haproxy normalize-uri normalizers to the option
+// each of them accepts, if any.
+var uriNormalizers = map[string]string{
+	"fragment-encode":           "",
+	"fragment-strip":            "",
+	"path-merge-slashes":        "",
+	"path-strip-dot":            "",
+	"path-strip-dotdot":         "full",
+	"percent-decode-unreserved": "strict",
+	"percent-to-uppercase":      "strict",
+	"query-sort-by-name":        "",
+}
+
+// ParseURINormalizers parses a comma separated list of haproxy normalize-uri
+// normalizers, each optionally followed by its option separated by a space,
+// e.g. "path-merge-slashes,path-strip-dotdot full".  The normalizers are
+// returned in order, as haproxy applies them in the order they are listed.
+func ParseURINormalizers(value string) ([]string, error) {
+	var normalizers []string
+	seen := sets.NewString()
+	for _, item := range strings.Split(value, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		name := fields[0]
+		option, ok := uriNormalizers[name]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("unknown normalizer %q", name)
+		case seen.Has(name):
+			return nil, fmt.Errorf("normalizer %q is listed more than once", name)
+		case len(fields) > 2, len(fields) == 2 && fields[1] != option:
+			if len(option) == 0 {
+				return nil, fmt.Errorf("normalizer %q does not accept options", name)
+			}
+			return nil, fmt.Errorf("normalizer %q only accepts the option %q", name, option)
+		}
+		seen.Insert(name)
+		normalizers = append(normalizers, strings.Join(fields, " "))
+	}
+	return normalizers, nil
+}
+
+// GetURINormalizers returns the URI normalizers of a route.
+func GetURINormalizers(route *routev1.Route) ([]string, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[NormalizeURIAnnotation]
+	if !ok {
+		return nil, result
+	}
+	normalizers, err := ParseURINormalizers(value)
+	if err != nil {
+		fldPath := field.NewPath("metadata", "annotations").Key(NormalizeURIAnnotation)
+		return nil, append(result, field.Invalid(fldPath, value, err.Error()))
+	}
+	return normalizers, result
+}
+
+// ValidateURINormalizers checks that the URI normalizers of a route are
+// valid.
+func ValidateURINormalizers(route *routev1.Route) field.ErrorList {
+	_, result := GetURINormalizers(route)
+	return result
+}
@@ -0,0 +1,60 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestParseURINormalizers(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+		err      bool
+	}{
+		{value: ""},
+		{value: " , "},
+		{
+			value:    "path-merge-slashes, path-strip-dotdot  full,percent-decode-unreserved",
+			expected: []string{"path-merge-slashes", "path-strip-dotdot full", "percent-decode-unreserved"},
+		},
+		{
+			value:    "percent-to-uppercase strict,path-strip-dot,query-sort-by-name",
+			expected: []string{"percent-to-uppercase strict", "path-strip-dot", "query-sort-by-name"},
+		},
+		{value: "path-merge-slash", err: true},
+		{value: "path-strip-dot,path-strip-dot", err: true},
+		{value: "path-strip-dot full", err: true},
+		{value: "path-strip-dotdot strict", err: true},
+		{value: "percent-decode-unreserved strict strict", err: true},
+	}
+
+	for _, tc := range tests {
+		normalizers, err := ParseURINormalizers(tc.value)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: expected error %t, got %v", tc.value, tc.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(normalizers, tc.expected) {
+			t.Errorf("%q: expected %q, got %q", tc.value, tc.expected, normalizers)
+		}
+	}
+}
+
+func TestValidateURINormalizers(t *testing.T) {
+	route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route"}}
+	if errs := ValidateURINormalizers(route); len(errs) != 0 {
+		t.Errorf("unexpected errors without the annotation: %v", errs)
+	}
+	route.Annotations = map[string]string{NormalizeURIAnnotation: "path-merge-slashes,fragment-strip"}
+	if errs := ValidateURINormalizers(route); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	route.Annotations[NormalizeURIAnnotation] = "path-merge-slashes,uppercase"
+	if errs := ValidateURINormalizers(route); len(errs) != 1 {
+		t.Errorf("expected 1 error, got %v", errs)
+	}
+}
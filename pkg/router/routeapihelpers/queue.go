@@ -0,0 +1,108 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// PodConcurrentConnectionsAnnotation sets the maximum number of
+	// concurrent connections to each backend of a route.  Requests over
+	// the limit are queued.
+	PodConcurrentConnectionsAnnotation = "haproxy.router.openshift.io/pod-concurrent-connections"
+	// MaxQueueAnnotation sets how many requests may be queued on each
+	// backend of a route.  Requests over the limit are queued on the route
+	// until a backend has room for them.
+	MaxQueueAnnotation = "haproxy.router.openshift.io/max-queue"
+	// QueueFullRetryAfterAnnotation makes the router answer the requests
+	// of a route whose backends have full queues with a 503 and a
+	// Retry-After header of the given number of seconds, rather than queue
+	// them on the route.
+	QueueFullRetryAfterAnnotation = "haproxy.router.openshift.io/queue-full-retry-after"
+)
+
+// maxRetryAfterSeconds is the longest Retry-After accepted, a day.
+const maxRetryAfterSeconds = 86400
+
+// QueueOptions are the options of the queues of the requests to the backends
+// of a route.  Zero fields use the router defaults.
+type QueueOptions struct {
+	// MaxQueue is the number of requests that may be queued on each
+	// backend.
+	MaxQueue int32
+	// RetryAfterSeconds, if MaxQueue is set, makes the router answer the
+	// requests received while the queues are full with a 503 with this
+	// Retry-After.
+	RetryAfterSeconds *int32
+}
+
+// GetQueueOptions returns the request queue options of a route.  Requests
+// are only queued when the number of connections to the backends is
+// limited, and the router can only answer the requests of routes whose HTTP
+// traffic it terminates.
+func GetQueueOptions(route *routev1.Route) (QueueOptions, field.ErrorList) {
+	options := QueueOptions{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	maxQueue, hasMaxQueue := route.Annotations[MaxQueueAnnotation]
+	retryAfter, hasRetryAfter := route.Annotations[QueueFullRetryAfterAnnotation]
+	if !hasMaxQueue && !hasRetryAfter {
+		return options, result
+	}
+
+	if n, err := strconv.Atoi(route.Annotations[PodConcurrentConnectionsAnnotation]); err != nil || n < 1 {
+		for _, annotation := range []string{MaxQueueAnnotation, QueueFullRetryAfterAnnotation} {
+			if value, ok := route.Annotations[annotation]; ok {
+				result = append(result, field.Invalid(fldPath.Key(annotation), value, fmt.Sprintf("requests are only queued when %s is set", PodConcurrentConnectionsAnnotation)))
+			}
+		}
+		return options, result
+	}
+
+	if hasMaxQueue {
+		n, err := strconv.ParseInt(strings.TrimSpace(maxQueue), 10, 32)
+		if err != nil || n < 1 {
+			result = append(result, field.Invalid(fldPath.Key(MaxQueueAnnotation), maxQueue, fmt.Sprintf("must be an integer between 1 and %d", math.MaxInt32)))
+		} else {
+			options.MaxQueue = int32(n)
+		}
+	}
+
+	if hasRetryAfter {
+		fld := fldPath.Key(QueueFullRetryAfterAnnotation)
+		_, hasTCPPort := route.Annotations[TCPPortAnnotation]
+		n, err := strconv.ParseInt(strings.TrimSpace(retryAfter), 10, 32)
+		switch {
+		case !hasMaxQueue:
+			result = append(result, field.Invalid(fld, retryAfter, fmt.Sprintf("requires %s", MaxQueueAnnotation)))
+		case route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough:
+			result = append(result, field.Invalid(fld, retryAfter, "is not supported for passthrough routes"))
+		case hasTCPPort:
+			result = append(result, field.Invalid(fld, retryAfter, fmt.Sprintf("is not supported for routes with %s", TCPPortAnnotation)))
+		case err != nil || n < 0 || n > maxRetryAfterSeconds:
+			result = append(result, field.Invalid(fld, retryAfter, fmt.Sprintf("must be a number of seconds between 0 and %d", maxRetryAfterSeconds)))
+		default:
+			seconds := int32(n)
+			options.RetryAfterSeconds = &seconds
+		}
+	}
+
+	if len(result) > 0 {
+		return QueueOptions{}, result
+	}
+	return options, result
+}
+
+// ValidateQueueOptions checks that the request queue options of a route are
+// valid.
+func ValidateQueueOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetQueueOptions(route)
+	return result
+}
@@ -0,0 +1,114 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetQueueOptions(t *testing.T) {
+	seconds := func(n int32) *int32 { return &n }
+
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		annotations map[string]string
+		expected    QueueOptions
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "max queue",
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				MaxQueueAnnotation:                 "20",
+			},
+			expected: QueueOptions{MaxQueue: 20},
+		},
+		{
+			name:        "fast 503 when the queues are full",
+			termination: routev1.TLSTerminationEdge,
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				MaxQueueAnnotation:                 "20",
+				QueueFullRetryAfterAnnotation:      "5",
+			},
+			expected: QueueOptions{MaxQueue: 20, RetryAfterSeconds: seconds(5)},
+		},
+		{
+			name:        "max queue on a passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				MaxQueueAnnotation:                 "20",
+			},
+			expected: QueueOptions{MaxQueue: 20},
+		},
+		{
+			name:        "fast 503 on a passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				MaxQueueAnnotation:                 "20",
+				QueueFullRetryAfterAnnotation:      "5",
+			},
+			errs: 1,
+		},
+		{
+			name: "fast 503 on a tcp port route",
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				MaxQueueAnnotation:                 "20",
+				QueueFullRetryAfterAnnotation:      "5",
+				TCPPortAnnotation:                  "auto",
+			},
+			errs: 1,
+		},
+		{
+			name: "no connection limit",
+			annotations: map[string]string{
+				MaxQueueAnnotation:            "20",
+				QueueFullRetryAfterAnnotation: "5",
+			},
+			errs: 2,
+		},
+		{
+			name: "fast 503 without max queue",
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				QueueFullRetryAfterAnnotation:      "5",
+			},
+			errs: 1,
+		},
+		{
+			name: "invalid values",
+			annotations: map[string]string{
+				PodConcurrentConnectionsAnnotation: "10",
+				MaxQueueAnnotation:                 "0",
+				QueueFullRetryAfterAnnotation:      "1d",
+			},
+			errs: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			options, errs := GetQueueOptions(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if !reflect.DeepEqual(options, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
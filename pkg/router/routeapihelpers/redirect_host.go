@@ -0,0 +1,138 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// RedirectHostAnnotation redirects the requests of a route to https on a
+// canonical host, e.g. to strip www from the host or to move the route to a
+// vanity domain.
+const RedirectHostAnnotation = "haproxy.router.openshift.io/redirect-host"
+
+const (
+	// RedirectHostScopeInsecure only redirects the insecure requests of a
+	// route to the canonical host, the secure requests are served.
+	RedirectHostScopeInsecure = "insecure"
+	// RedirectHostScopeAll redirects all the requests of a route to the
+	// canonical host.
+	RedirectHostScopeAll = "all"
+)
+
+// RedirectHost redirects the requests of a route to https on a canonical
+// host.  The path and the query string of the requests are kept.
+type RedirectHost struct {
+	// Host is the canonical host, with an optional port.
+	Host string
+	// All is true if the secure requests of the route are redirected as
+	// well as the insecure ones.
+	All bool
+	// Code is the status code of the redirect.
+	Code int
+}
+
+// Hostname returns the canonical host without its port.
+func (r RedirectHost) Hostname() string {
+	return strings.ToLower(strings.SplitN(r.Host, ":", 2)[0])
+}
+
+// Redirect returns the arguments of the http-request redirect rule of the
+// canonical host.
+func (r RedirectHost) Redirect() string {
+	redirect := fmt.Sprintf("prefix https://%s code %d", r.Host, r.Code)
+	if !r.All {
+		redirect += " if !{ ssl_fc }"
+	}
+	return redirect
+}
+
+// ParseRedirectHost parses the canonical host of a route, written as a
+// space separated list of fields:
+//
+//	<host>[:<port>]			the canonical host
+//	code=<301|302|308>		the status code of the redirect, 302 by default
+//	scope=<insecure|all>		the requests redirected, the insecure ones by default
+//
+// e.g. "example.com code=301 scope=all".
+func ParseRedirectHost(value string) (RedirectHost, error) {
+	redirect := RedirectHost{Code: http.StatusFound}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return redirect, fmt.Errorf("does not set the canonical host")
+	}
+	if err := validateRedirectHostPort(fields[0]); err != nil {
+		return redirect, fmt.Errorf("has %v", err)
+	}
+	redirect.Host = fields[0]
+
+	seen := map[string]bool{}
+	for _, f := range fields[1:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || len(value) == 0 {
+			return redirect, fmt.Errorf("has a field %q without a value", f)
+		}
+		if seen[key] {
+			return redirect, fmt.Errorf("has more than one %s field", key)
+		}
+		seen[key] = true
+		switch key {
+		case "code":
+			code, err := strconv.Atoi(value)
+			if err != nil || !redirectCodes[code] {
+				return redirect, fmt.Errorf("has an invalid code %q, must be 301, 302 or 308", value)
+			}
+			redirect.Code = code
+		case "scope":
+			switch value {
+			case RedirectHostScopeInsecure:
+			case RedirectHostScopeAll:
+				redirect.All = true
+			default:
+				return redirect, fmt.Errorf("has an invalid scope %q, must be %s or %s", value, RedirectHostScopeInsecure, RedirectHostScopeAll)
+			}
+		default:
+			return redirect, fmt.Errorf("has an unknown field %q, must be code or scope", key)
+		}
+	}
+	return redirect, nil
+}
+
+// GetRedirectHost returns the canonical host of a route, if it has one.
+// Passthrough and TCP routes do not support it as the router does not see
+// their requests, and a route that redirects all its requests to its own
+// host would redirect them forever.  Loops through the canonical hosts of
+// other routes are left to the router, which knows them.
+func GetRedirectHost(route *routev1.Route) (RedirectHost, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[RedirectHostAnnotation]
+	if !ok {
+		return RedirectHost{}, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(RedirectHostAnnotation)
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return RedirectHost{}, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	if IsTCPRoute(route) {
+		return RedirectHost{}, append(result, field.Invalid(fldPath, value, "is not supported for TCP routes"))
+	}
+	redirect, err := ParseRedirectHost(value)
+	if err != nil {
+		return RedirectHost{}, append(result, field.Invalid(fldPath, value, err.Error()))
+	}
+	if redirect.All && redirect.Hostname() == strings.ToLower(route.Spec.Host) {
+		return RedirectHost{}, append(result, field.Invalid(fldPath, value, "redirects the requests of the route to the route in a loop"))
+	}
+	return redirect, result
+}
+
+// ValidateRedirectHost checks that the canonical host of a route is valid.
+func ValidateRedirectHost(route *routev1.Route) field.ErrorList {
+	_, result := GetRedirectHost(route)
+	return result
+}
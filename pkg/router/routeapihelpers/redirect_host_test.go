@@ -0,0 +1,102 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetRedirectHost(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		termination routev1.TLSTerminationType
+		expected    string
+		expectErr   bool
+	}{
+		{
+			name:     "canonical host",
+			value:    "example.com",
+			expected: "prefix https://example.com code 302 if !{ ssl_fc }",
+		},
+		{
+			name:     "all requests",
+			value:    "example.com:8443 code=301 scope=all",
+			expected: "prefix https://example.com:8443 code 301",
+		},
+		{
+			name:     "own host for insecure requests",
+			value:    "www.example.com scope=insecure",
+			expected: "prefix https://www.example.com code 302 if !{ ssl_fc }",
+		},
+		{
+			name:      "own host for all requests",
+			value:     "WWW.example.com scope=all",
+			expectErr: true,
+		},
+		{
+			name:      "empty",
+			value:     " ",
+			expectErr: true,
+		},
+		{
+			name:      "invalid host",
+			value:     "Example_com",
+			expectErr: true,
+		},
+		{
+			name:      "invalid port",
+			value:     "example.com:0",
+			expectErr: true,
+		},
+		{
+			name:      "unsupported code",
+			value:     "example.com code=307",
+			expectErr: true,
+		},
+		{
+			name:      "invalid scope",
+			value:     "example.com scope=secure",
+			expectErr: true,
+		},
+		{
+			name:      "two codes",
+			value:     "example.com code=301 code=302",
+			expectErr: true,
+		},
+		{
+			name:      "unknown field",
+			value:     "example.com path=/",
+			expectErr: true,
+		},
+		{
+			name:        "passthrough",
+			value:       "example.com",
+			termination: routev1.TLSTerminationPassthrough,
+			expectErr:   true,
+		},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RedirectHostAnnotation: tc.value}},
+			Spec:       routev1.RouteSpec{Host: "www.example.com"},
+		}
+		if len(tc.termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+		}
+		redirect, errs := GetRedirectHost(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if !tc.expectErr && redirect.Redirect() != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, redirect.Redirect())
+		}
+	}
+
+	if redirect, errs := GetRedirectHost(&routev1.Route{}); len(errs) > 0 || len(redirect.Host) > 0 {
+		t.Errorf("expected no redirect host without the annotation, got %v, %v", redirect, errs)
+	}
+}
@@ -0,0 +1,336 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// RedirectRulesAnnotation lists the rules of the requests the router
+// redirects instead of forwarding them to the backends of a route.
+const RedirectRulesAnnotation = "haproxy.router.openshift.io/redirect-rules"
+
+// MaxRedirectRules is the largest number of redirect rules a route may
+// have, as every rule is evaluated for every request of the route.
+const MaxRedirectRules = 16
+
+// redirectRulePathPattern matches the paths of redirect rules.  They are
+// written as is in regsub() arguments, which rules out the characters
+// special to regular expressions and to haproxy arguments.
+var redirectRulePathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+
+// redirectCodes are the status codes of the redirects rules may send.
+var redirectCodes = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusPermanentRedirect: true,
+}
+
+// RedirectRule redirects the requests of a route with a path, or with any
+// path From prefixes, to another scheme, host or path.  The parts of the
+// requests a rule does not change are kept, as is the query string.
+type RedirectRule struct {
+	// From is the path of the redirected requests, if set.
+	From string
+	// FromPrefix is true if From matches the paths it prefixes.
+	FromPrefix bool
+	// Scheme is the scheme requests are redirected to, if set.  Only the
+	// requests with the other scheme are redirected.
+	Scheme string
+	// Host is the host, with an optional port, requests are redirected to,
+	// if set.
+	Host string
+	// Path is the path requests are redirected to, if set.  If From is a
+	// prefix, Path replaces it.
+	Path string
+	// Code is the status code of the redirect.
+	Code int
+}
+
+// ACL returns the haproxy condition matching the requests of the rule.
+func (r RedirectRule) ACL() string {
+	var terms []string
+	switch r.Scheme {
+	case "https":
+		terms = append(terms, "!{ ssl_fc }")
+	case "http":
+		terms = append(terms, "{ ssl_fc }")
+	}
+	if len(r.From) > 0 {
+		if r.FromPrefix {
+			terms = append(terms, fmt.Sprintf("{ path_beg %s }", r.From))
+		} else {
+			terms = append(terms, fmt.Sprintf("{ path %s }", r.From))
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// Redirects returns the arguments of the http-request redirect rules of the
+// rule.  Redirects to another path are written as two rules, as the query
+// string of the requests that have one is appended to their location.
+func (r RedirectRule) Redirects() []string {
+	acl := r.ACL()
+	withCondition := func(redirect, acl string) string {
+		redirect = fmt.Sprintf("%s code %d", redirect, r.Code)
+		if len(acl) > 0 {
+			redirect += " if " + acl
+		}
+		return redirect
+	}
+	if len(r.Path) == 0 {
+		if len(r.Host) == 0 {
+			return []string{withCondition("scheme "+r.Scheme, acl)}
+		}
+		// A prefix keeps the path and the query string of the request.
+		return []string{withCondition("prefix "+r.origin(), acl)}
+	}
+
+	location := r.origin() + r.Path
+	if r.FromPrefix {
+		location = fmt.Sprintf("%s%%[path,regsub(^%s,%s)]", r.origin(), regexpLiteral(r.From), r.Path)
+	}
+	return []string{
+		withCondition("location "+location+"?%[query]", strings.TrimSpace(acl+" { query -m found }")),
+		withCondition("location "+location, acl),
+	}
+}
+
+// origin returns the scheme and host the location of the redirects starts
+// with, or nothing for the redirects that keep both.
+func (r RedirectRule) origin() string {
+	switch {
+	case len(r.Scheme) > 0 && len(r.Host) > 0:
+		return r.Scheme + "://" + r.Host
+	case len(r.Scheme) > 0:
+		return r.Scheme + "://%[req.hdr(host)]"
+	case len(r.Host) > 0:
+		// A network-path reference keeps the scheme of the request.
+		return "//" + r.Host
+	}
+	return ""
+}
+
+// regexpLiteral returns a regular expression matching path, whose only
+// character special to regular expressions is the dot.
+func regexpLiteral(path string) string {
+	return strings.ReplaceAll(path, ".", "[.]")
+}
+
+// Matches returns whether a request with the scheme and path matches the
+// rule.
+func (r RedirectRule) Matches(tls bool, path string) bool {
+	if (r.Scheme == "https" && tls) || (r.Scheme == "http" && !tls) {
+		return false
+	}
+	if len(r.From) > 0 {
+		if r.FromPrefix && !strings.HasPrefix(path, r.From) {
+			return false
+		}
+		if !r.FromPrefix && path != r.From {
+			return false
+		}
+	}
+	return true
+}
+
+// redirect returns the scheme and path of a request the rule redirected,
+// and whether the redirect stays on host.
+func (r RedirectRule) redirect(tls bool, path, host string) (bool, string, bool) {
+	if len(r.Scheme) > 0 {
+		tls = r.Scheme == "https"
+	}
+	if len(r.Path) > 0 {
+		if r.FromPrefix {
+			path = r.Path + strings.TrimPrefix(path, r.From)
+		} else {
+			path = r.Path
+		}
+	}
+	sameHost := len(r.Host) == 0 || strings.EqualFold(strings.SplitN(r.Host, ":", 2)[0], host)
+	return tls, path, sameHost
+}
+
+// ParseRedirectRules parses redirect rules separated by semicolons or new
+// lines.  A rule is a space separated list of fields:
+//
+//	from=<path>		the path of the redirected requests, or any path it prefixes if it ends with /*
+//	scheme=<http|https>	the scheme to redirect to
+//	host=<host>[:<port>]	the host to redirect to
+//	path=<path>		the path to redirect to, which replaces the prefix of from if it is one
+//	code=<301|302|308>	the status code of the redirect, 302 by default
+//
+// At least one of scheme, host and path must be set, e.g.
+// "from=/docs/* host=docs.example.com path=/ code=301; scheme=https".
+func ParseRedirectRules(value string) ([]RedirectRule, error) {
+	var rules []RedirectRule
+	for _, line := range strings.Split(value, "\n") {
+		for _, item := range strings.Split(line, ";") {
+			fields := strings.Fields(item)
+			if len(fields) == 0 {
+				continue
+			}
+			rule, err := parseRedirectRule(fields)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q %v", strings.TrimSpace(item), err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) > MaxRedirectRules {
+		return nil, fmt.Errorf("has %d rules, at most %d are allowed", len(rules), MaxRedirectRules)
+	}
+	return rules, nil
+}
+
+func parseRedirectRule(fields []string) (RedirectRule, error) {
+	rule := RedirectRule{Code: http.StatusFound}
+	seen := map[string]bool{}
+	for _, f := range fields {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || len(value) == 0 {
+			return rule, fmt.Errorf("has a field %q without a value", f)
+		}
+		if seen[key] {
+			return rule, fmt.Errorf("has more than one %s field", key)
+		}
+		seen[key] = true
+		switch key {
+		case "from":
+			path := value
+			if strings.HasSuffix(path, "/*") {
+				path = strings.TrimSuffix(path, "*")
+				rule.FromPrefix = true
+			}
+			if !redirectRulePathPattern.MatchString(path) {
+				return rule, fmt.Errorf("has an invalid from path %q", value)
+			}
+			rule.From = path
+		case "scheme":
+			if value != "http" && value != "https" {
+				return rule, fmt.Errorf("has an invalid scheme %q, must be http or https", value)
+			}
+			rule.Scheme = value
+		case "host":
+			if err := validateRedirectHostPort(value); err != nil {
+				return rule, fmt.Errorf("has %v", err)
+			}
+			rule.Host = value
+		case "path":
+			if !redirectRulePathPattern.MatchString(value) {
+				return rule, fmt.Errorf("has an invalid path %q", value)
+			}
+			rule.Path = value
+		case "code":
+			code, err := strconv.Atoi(value)
+			if err != nil || !redirectCodes[code] {
+				return rule, fmt.Errorf("has an invalid code %q, must be 301, 302 or 308", value)
+			}
+			rule.Code = code
+		default:
+			return rule, fmt.Errorf("has an unknown field %q, must be from, scheme, host, path or code", key)
+		}
+	}
+	if len(rule.Scheme) == 0 && len(rule.Host) == 0 && len(rule.Path) == 0 {
+		return rule, fmt.Errorf("does not redirect anywhere, set scheme, host or path")
+	}
+	if rule.FromPrefix && len(rule.Path) > 0 && !strings.HasSuffix(rule.Path, "/") {
+		return rule, fmt.Errorf("has a path %q that does not end with / to replace the prefix %q with", rule.Path, rule.From)
+	}
+	return rule, nil
+}
+
+// validateRedirectHostPort checks that value is a host name with an
+// optional port requests may be redirected to.
+func validateRedirectHostPort(value string) error {
+	host := value
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		n, err := strconv.Atoi(value[i+1:])
+		if err != nil || len(kvalidation.IsValidPortNum(n)) > 0 {
+			return fmt.Errorf("a host %q with an invalid port", value)
+		}
+		host = value[:i]
+	}
+	if errs := kvalidation.IsDNS1123Subdomain(host); len(errs) > 0 {
+		return fmt.Errorf("an invalid host %q: %s", value, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// redirectLoop returns the rule whose redirects the route redirects again
+// and again, if any.  It follows the redirects of a request matching each
+// rule, for both schemes, until the request leaves the host of the route or
+// is no longer redirected.  A request redirected more times than there are
+// rules went through a rule twice, which is taken for a loop: such rules
+// redirect to the same location again, or to ever longer paths.
+func redirectLoop(rules []RedirectRule, host string) (int, bool) {
+	match := func(tls bool, path string) (RedirectRule, bool) {
+		for _, rule := range rules {
+			if rule.Matches(tls, path) {
+				return rule, true
+			}
+		}
+		return RedirectRule{}, false
+	}
+	for i, rule := range rules {
+		path := rule.From
+		if len(path) == 0 {
+			path = "/"
+		}
+		for _, tls := range []bool{false, true} {
+			tls, path := tls, path
+			for redirects := 0; ; redirects++ {
+				r, ok := match(tls, path)
+				if !ok {
+					break
+				}
+				if redirects == len(rules) {
+					return i, true
+				}
+				var sameHost bool
+				if tls, path, sameHost = r.redirect(tls, path, host); !sameHost {
+					break
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// GetRedirectRules returns the redirect rules of a route.  Passthrough
+// routes do not support them as the router does not see their requests, and
+// rules that redirect requests of the route back to the route forever are
+// rejected.
+func GetRedirectRules(route *routev1.Route) ([]RedirectRule, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[RedirectRulesAnnotation]
+	if !ok {
+		return nil, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(RedirectRulesAnnotation)
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return nil, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	rules, err := ParseRedirectRules(value)
+	if err != nil {
+		return nil, append(result, field.Invalid(fldPath, value, err.Error()))
+	}
+	if i, loop := redirectLoop(rules, route.Spec.Host); loop {
+		return nil, append(result, field.Invalid(fldPath, value, fmt.Sprintf("rule %d redirects requests in a loop", i+1)))
+	}
+	return rules, result
+}
+
+// ValidateRedirectRules checks that the redirect rules of a route are
+// valid.
+func ValidateRedirectRules(route *routev1.Route) field.ErrorList {
+	_, result := GetRedirectRules(route)
+	return result
+}
@@ -0,0 +1,146 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestParseRedirectRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "scheme",
+			value:    "scheme=https code=308",
+			expected: []string{"scheme https code 308 if !{ ssl_fc }"},
+		},
+		{
+			name:     "host",
+			value:    "from=/docs/* host=docs.example.com:8443 code=301",
+			expected: []string{"prefix //docs.example.com:8443 code 301 if { path_beg /docs/ }"},
+		},
+		{
+			name:  "path prefix",
+			value: "from=/v1.0/* scheme=https host=api.example.com path=/api/",
+			expected: []string{
+				"location https://api.example.com%[path,regsub(^/v1[.]0/,/api/)]?%[query] code 302 if !{ ssl_fc } { path_beg /v1.0/ } { query -m found }",
+				"location https://api.example.com%[path,regsub(^/v1[.]0/,/api/)] code 302 if !{ ssl_fc } { path_beg /v1.0/ }",
+			},
+		},
+		{
+			name:  "path",
+			value: "from=/old path=/new",
+			expected: []string{
+				"location /new?%[query] code 302 if { path /old } { query -m found }",
+				"location /new code 302 if { path /old }",
+			},
+		},
+		{
+			name:      "nowhere",
+			value:     "from=/old code=301",
+			expectErr: true,
+		},
+		{
+			name:      "unsupported code",
+			value:     "scheme=https code=307",
+			expectErr: true,
+		},
+		{
+			name:      "invalid host",
+			value:     "host=Docs_Example",
+			expectErr: true,
+		},
+		{
+			name:      "invalid port",
+			value:     "host=docs.example.com:99999",
+			expectErr: true,
+		},
+		{
+			name:      "path with a comma",
+			value:     "path=/a,b",
+			expectErr: true,
+		},
+		{
+			name:      "prefix replaced by a file",
+			value:     "from=/old/* path=/new",
+			expectErr: true,
+		},
+		{
+			name:      "two schemes",
+			value:     "scheme=https scheme=http",
+			expectErr: true,
+		},
+		{
+			name:      "unknown field",
+			value:     "to=/new",
+			expectErr: true,
+		},
+		{
+			name:      "too many rules",
+			value:     strings.Repeat("scheme=https;", MaxRedirectRules+1),
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseRedirectRules(tc.value)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			var redirects []string
+			for _, rule := range rules {
+				redirects = append(redirects, rule.Redirects()...)
+			}
+			if !reflect.DeepEqual(redirects, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, redirects)
+			}
+		})
+	}
+}
+
+func TestGetRedirectRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		loop  bool
+	}{
+		{name: "scheme upgrade", rules: "scheme=https"},
+		{name: "other host", rules: "host=www.example.com"},
+		{name: "moved prefix", rules: "from=/old/* path=/new/; scheme=https"},
+		{name: "same host", rules: "host=example.com:443", loop: true},
+		{name: "same path", rules: "from=/old path=/old", loop: true},
+		{name: "growing path", rules: "from=/a/* path=/a/b/", loop: true},
+		{name: "back and forth", rules: "from=/a/* path=/b/; from=/b/* path=/a/", loop: true},
+		{name: "scheme flip", rules: "scheme=https; scheme=http", loop: true},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RedirectRulesAnnotation: tc.rules}},
+			Spec:       routev1.RouteSpec{Host: "example.com"},
+		}
+		_, errs := GetRedirectRules(route)
+		if loop := len(errs) > 0 && strings.Contains(errs.ToAggregate().Error(), "loop"); loop != tc.loop || (!tc.loop && len(errs) > 0) {
+			t.Errorf("%s: expected loop %t, got %v", tc.name, tc.loop, errs)
+		}
+	}
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{RedirectRulesAnnotation: "scheme=https"}},
+		Spec:       routev1.RouteSpec{TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough}},
+	}
+	if errs := ValidateRedirectRules(route); len(errs) != 1 {
+		t.Errorf("expected the redirect rules of a passthrough route to be invalid, got %v", errs)
+	}
+}
@@ -0,0 +1,158 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// The annotations of the cache of the responses of a route, which the
+// router serves small static assets from instead of the backends.
+const (
+	// ResponseCacheTTLAnnotation enables the cache, and is how long a
+	// response is cached at most, as an haproxy time in whole seconds.
+	// Responses whose Cache-Control or Expires headers allow a shorter
+	// lifetime are cached for that long, and those that forbid caching are
+	// not cached.
+	ResponseCacheTTLAnnotation = "haproxy.router.openshift.io/cache-ttl"
+	// ResponseCacheMaxObjectSizeAnnotation is the size of the largest
+	// response cached, in bytes with an optional k or m suffix.
+	ResponseCacheMaxObjectSizeAnnotation = "haproxy.router.openshift.io/cache-max-object-size"
+	// ResponseCacheSizeAnnotation is the size of the cache in megabytes,
+	// which the router takes from its total cache budget.
+	ResponseCacheSizeAnnotation = "haproxy.router.openshift.io/cache-size"
+)
+
+const (
+	// DefaultResponseCacheSize is the size of the cache of a route in
+	// megabytes if it sets none.
+	DefaultResponseCacheSize = 4
+	// DefaultResponseCacheMaxObjectSize is the size of the largest response
+	// cached if the route sets none.
+	DefaultResponseCacheMaxObjectSize = 64 << 10
+	// maxResponseCacheSize is the largest cache haproxy accepts, in
+	// megabytes.
+	maxResponseCacheSize = 4095
+	// maxResponseCacheTTL is the longest a response may be cached, so that
+	// stale assets do not outlive a redeployment of their route for long.
+	maxResponseCacheTTL = 24 * time.Hour
+)
+
+var responseCacheObjectSizePattern = regexp.MustCompile(`^([0-9]+)([kKmM]?)$`)
+
+// ResponseCache is the cache of the responses of a route.
+type ResponseCache struct {
+	// TTL is how long a response is cached at most.  Zero if the route
+	// has no cache.
+	TTL time.Duration
+	// MaxObjectSize is the size in bytes of the largest response cached.
+	MaxObjectSize int64
+	// Size is the size of the cache in megabytes.
+	Size int
+}
+
+// Enabled returns true if the responses of the route are cached.
+func (c ResponseCache) Enabled() bool {
+	return c.TTL > 0
+}
+
+// GetResponseCache returns the cache of the responses of a route.  The
+// largest response cached may take at most half of the cache, as haproxy
+// requires.  Passthrough routes have no responses the router can cache, so
+// they are rejected if they set the annotations.  No cache is returned with
+// the errors of invalid annotations.
+func GetResponseCache(route *routev1.Route) (ResponseCache, field.ErrorList) {
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+	annotations := []string{ResponseCacheTTLAnnotation, ResponseCacheMaxObjectSizeAnnotation, ResponseCacheSizeAnnotation}
+
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		for _, key := range annotations {
+			if value, ok := route.Annotations[key]; ok {
+				result = append(result, field.Invalid(fldPath.Key(key), value, "is not supported for passthrough routes"))
+			}
+		}
+		return ResponseCache{}, result
+	}
+
+	value, ok := route.Annotations[ResponseCacheTTLAnnotation]
+	if !ok {
+		for _, key := range annotations[1:] {
+			if value, ok := route.Annotations[key]; ok {
+				result = append(result, field.Invalid(fldPath.Key(key), value, "requires "+ResponseCacheTTLAnnotation))
+			}
+		}
+		return ResponseCache{}, result
+	}
+
+	cache := ResponseCache{MaxObjectSize: DefaultResponseCacheMaxObjectSize, Size: DefaultResponseCacheSize}
+	ttl, err := ParseHAProxyTimeout(strings.TrimSpace(value))
+	switch {
+	case err != nil:
+		result = append(result, field.Invalid(fldPath.Key(ResponseCacheTTLAnnotation), value, err.Error()))
+	case ttl < time.Second || ttl > maxResponseCacheTTL || ttl%time.Second != 0:
+		result = append(result, field.Invalid(fldPath.Key(ResponseCacheTTLAnnotation), value, fmt.Sprintf("must be a whole number of seconds between 1s and %s", maxResponseCacheTTL)))
+	default:
+		cache.TTL = ttl
+	}
+
+	if value, ok := route.Annotations[ResponseCacheSizeAnnotation]; ok {
+		size, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || size < 1 || size > maxResponseCacheSize {
+			result = append(result, field.Invalid(fldPath.Key(ResponseCacheSizeAnnotation), value, fmt.Sprintf("must be a number of megabytes between 1 and %d", maxResponseCacheSize)))
+		} else {
+			cache.Size = size
+		}
+	}
+
+	if value, ok := route.Annotations[ResponseCacheMaxObjectSizeAnnotation]; ok {
+		if size, err := parseResponseCacheObjectSize(value); err != nil {
+			result = append(result, field.Invalid(fldPath.Key(ResponseCacheMaxObjectSizeAnnotation), value, err.Error()))
+		} else {
+			cache.MaxObjectSize = size
+		}
+	}
+	if limit := int64(cache.Size) << 19; len(result) == 0 && cache.MaxObjectSize > limit {
+		result = append(result, field.Invalid(fldPath.Key(ResponseCacheMaxObjectSizeAnnotation), route.Annotations[ResponseCacheMaxObjectSizeAnnotation], fmt.Sprintf("must not exceed half of the %dm cache, %d bytes", cache.Size, limit)))
+	}
+
+	if len(result) > 0 {
+		return ResponseCache{}, result
+	}
+	return cache, result
+}
+
+// parseResponseCacheObjectSize parses the size of a response in bytes.
+func parseResponseCacheObjectSize(value string) (int64, error) {
+	match := responseCacheObjectSizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("must be a number of bytes with an optional k or m suffix")
+	}
+	n, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || n > int64(maxResponseCacheSize)<<20 {
+		return 0, fmt.Errorf("must not exceed %dm", maxResponseCacheSize)
+	}
+	switch strings.ToLower(match[2]) {
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("must be at least 1 byte")
+	}
+	return n, nil
+}
+
+// ValidateResponseCache checks that the response cache annotations of a
+// route are valid.
+func ValidateResponseCache(route *routev1.Route) field.ErrorList {
+	_, result := GetResponseCache(route)
+	return result
+}
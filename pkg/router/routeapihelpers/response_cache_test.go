@@ -0,0 +1,63 @@
+package routeapihelpers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetResponseCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		termination routev1.TLSTerminationType
+		expected    ResponseCache
+		expectErr   bool
+	}{
+		{name: "unset"},
+		{
+			name:        "defaults",
+			annotations: map[string]string{ResponseCacheTTLAnnotation: "5m"},
+			expected:    ResponseCache{TTL: 5 * time.Minute, MaxObjectSize: DefaultResponseCacheMaxObjectSize, Size: DefaultResponseCacheSize},
+		},
+		{
+			name:        "sized",
+			annotations: map[string]string{ResponseCacheTTLAnnotation: "60s", ResponseCacheMaxObjectSizeAnnotation: "1m", ResponseCacheSizeAnnotation: "16"},
+			termination: routev1.TLSTerminationEdge,
+			expected:    ResponseCache{TTL: time.Minute, MaxObjectSize: 1 << 20, Size: 16},
+		},
+		{
+			name:        "object of half the cache",
+			annotations: map[string]string{ResponseCacheTTLAnnotation: "1s", ResponseCacheMaxObjectSizeAnnotation: "512k", ResponseCacheSizeAnnotation: "1"},
+			expected:    ResponseCache{TTL: time.Second, MaxObjectSize: 512 << 10, Size: 1},
+		},
+		{name: "object larger than half the cache", annotations: map[string]string{ResponseCacheTTLAnnotation: "1s", ResponseCacheMaxObjectSizeAnnotation: "3m"}, expectErr: true},
+		{name: "invalid object size", annotations: map[string]string{ResponseCacheTTLAnnotation: "1s", ResponseCacheMaxObjectSizeAnnotation: "1g"}, expectErr: true},
+		{name: "zero object size", annotations: map[string]string{ResponseCacheTTLAnnotation: "1s", ResponseCacheMaxObjectSizeAnnotation: "0"}, expectErr: true},
+		{name: "cache too large", annotations: map[string]string{ResponseCacheTTLAnnotation: "1s", ResponseCacheSizeAnnotation: "4096"}, expectErr: true},
+		{name: "empty cache", annotations: map[string]string{ResponseCacheTTLAnnotation: "1s", ResponseCacheSizeAnnotation: "0"}, expectErr: true},
+		{name: "invalid ttl", annotations: map[string]string{ResponseCacheTTLAnnotation: "forever"}, expectErr: true},
+		{name: "ttl below a second", annotations: map[string]string{ResponseCacheTTLAnnotation: "500ms"}, expectErr: true},
+		{name: "ttl in fractions of seconds", annotations: map[string]string{ResponseCacheTTLAnnotation: "1500ms"}, expectErr: true},
+		{name: "ttl above a day", annotations: map[string]string{ResponseCacheTTLAnnotation: "2d"}, expectErr: true},
+		{name: "size without ttl", annotations: map[string]string{ResponseCacheSizeAnnotation: "8"}, expectErr: true},
+		{name: "passthrough", annotations: map[string]string{ResponseCacheTTLAnnotation: "60s"}, termination: routev1.TLSTerminationPassthrough, expectErr: true},
+	}
+	for _, tc := range tests {
+		route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+		if len(tc.termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+		}
+		cache, errs := GetResponseCache(route)
+		if tc.expectErr != (len(errs) > 0) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, errs)
+			continue
+		}
+		if cache != tc.expected {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, cache)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// ResponseHeaderPolicyAnnotation lists the rules applied to the response
+// headers of a route, separated by semicolons, after the router wide rules.
+const ResponseHeaderPolicyAnnotation = "haproxy.router.openshift.io/response-header-policy"
+
+const (
+	// ResponseHeaderDelete removes a header from the responses.
+	ResponseHeaderDelete = "delete"
+	// ResponseHeaderReplace replaces a header of the responses with a fixed
+	// value, or adds it.
+	ResponseHeaderReplace = "replace"
+	// ResponseHeaderKeep exempts a header from the router wide rules.
+	ResponseHeaderKeep = "keep"
+)
+
+// responseHeaderNamePattern matches the header names of response header
+// rules.
+var responseHeaderNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// responseHeaderValuePattern matches the values of replaced headers, which
+// are written as is in the haproxy configuration: printable ASCII without
+// quotes, backslashes and % signs.
+var responseHeaderValuePattern = regexp.MustCompile(`^[ !#$&(-\[\]-~]+$`)
+
+// ResponseHeaderRule is a rule applied to the response headers of routes.
+type ResponseHeaderRule struct {
+	// Action is ResponseHeaderDelete, ResponseHeaderReplace or
+	// ResponseHeaderKeep.
+	Action string
+	// Name is the name of the header.
+	Name string
+	// Value is the value of a replaced header.
+	Value string
+}
+
+// ParseResponseHeaderPolicy parses response header rules separated by
+// semicolons or new lines, ignoring empty lines and lines starting with #.
+// A rule is "delete <header>", "replace <header> <value>" or
+// "keep <header>", e.g. "delete X-Powered-By; replace Server router".
+// Values are written as is in the haproxy configuration, so they may not
+// contain quotes, backslashes or % signs.
+func ParseResponseHeaderPolicy(value string) ([]ResponseHeaderRule, error) {
+	var rules []ResponseHeaderRule
+	for _, line := range strings.Split(value, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, item := range strings.Split(line, ";") {
+			fields := strings.Fields(item)
+			if len(fields) == 0 {
+				continue
+			}
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("rule %q has no header", strings.TrimSpace(item))
+			}
+			rule := ResponseHeaderRule{Action: fields[0], Name: fields[1]}
+			if !responseHeaderNamePattern.MatchString(rule.Name) {
+				return nil, fmt.Errorf("rule %q has an invalid header name", strings.TrimSpace(item))
+			}
+			switch rule.Action {
+			case ResponseHeaderDelete, ResponseHeaderKeep:
+				if len(fields) > 2 {
+					return nil, fmt.Errorf("rule %q does not accept a value", strings.TrimSpace(item))
+				}
+			case ResponseHeaderReplace:
+				if len(fields) < 3 {
+					return nil, fmt.Errorf("rule %q has no value", strings.TrimSpace(item))
+				}
+				rule.Value = strings.Join(fields[2:], " ")
+				if !responseHeaderValuePattern.MatchString(rule.Value) {
+					return nil, fmt.Errorf("rule %q has an invalid value", strings.TrimSpace(item))
+				}
+			default:
+				return nil, fmt.Errorf("rule %q has an unknown action, must be %s, %s or %s", strings.TrimSpace(item), ResponseHeaderDelete, ResponseHeaderReplace, ResponseHeaderKeep)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// MergeResponseHeaderPolicies returns the rules applied to the responses
+// of a route: the router wide rules, except those for the headers the
+// route has rules for, followed by the delete and replace rules of the
+// route.
+func MergeResponseHeaderPolicies(router, route []ResponseHeaderRule) []ResponseHeaderRule {
+	overridden := map[string]bool{}
+	for _, rule := range route {
+		overridden[strings.ToLower(rule.Name)] = true
+	}
+	var rules []ResponseHeaderRule
+	for _, rule := range router {
+		if !overridden[strings.ToLower(rule.Name)] && rule.Action != ResponseHeaderKeep {
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range route {
+		if rule.Action != ResponseHeaderKeep {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// GetResponseHeaderPolicy returns the response header rules of a route.
+// Passthrough routes do not support them as the router does not see their
+// responses.
+func GetResponseHeaderPolicy(route *routev1.Route) ([]ResponseHeaderRule, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[ResponseHeaderPolicyAnnotation]
+	if !ok {
+		return nil, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(ResponseHeaderPolicyAnnotation)
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return nil, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	rules, err := ParseResponseHeaderPolicy(value)
+	if err != nil {
+		return nil, append(result, field.Invalid(fldPath, value, err.Error()))
+	}
+	return rules, result
+}
+
+// ValidateResponseHeaderPolicy checks that the response header rules of a
+// route are valid.
+func ValidateResponseHeaderPolicy(route *routev1.Route) field.ErrorList {
+	_, result := GetResponseHeaderPolicy(route)
+	return result
+}
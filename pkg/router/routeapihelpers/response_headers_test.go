@@ -0,0 +1,176 @@
+package routeapihelpers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestParseResponseHeaderPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		expected  []ResponseHeaderRule
+		expectErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "annotation",
+			value: "delete X-Powered-By; replace Server  my router ;keep Via;",
+			expected: []ResponseHeaderRule{
+				{Action: ResponseHeaderDelete, Name: "X-Powered-By"},
+				{Action: ResponseHeaderReplace, Name: "Server", Value: "my router"},
+				{Action: ResponseHeaderKeep, Name: "Via"},
+			},
+		},
+		{
+			name:  "file",
+			value: "# Hide the backends\ndelete Server\n\n  # and their addresses\ndelete X-Backend-Server\n",
+			expected: []ResponseHeaderRule{
+				{Action: ResponseHeaderDelete, Name: "Server"},
+				{Action: ResponseHeaderDelete, Name: "X-Backend-Server"},
+			},
+		},
+		{
+			name:      "unknown action",
+			value:     "strip Server",
+			expectErr: true,
+		},
+		{
+			name:      "no header",
+			value:     "delete",
+			expectErr: true,
+		},
+		{
+			name:      "invalid header",
+			value:     "delete Server:",
+			expectErr: true,
+		},
+		{
+			name:      "value on delete",
+			value:     "delete Server router",
+			expectErr: true,
+		},
+		{
+			name:      "no value on replace",
+			value:     "replace Server",
+			expectErr: true,
+		},
+		{
+			name:      "quoted value",
+			value:     "replace Server 'router'",
+			expectErr: true,
+		},
+		{
+			name:      "log format value",
+			value:     "replace Server %[src]",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseResponseHeaderPolicy(tc.value)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(rules, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, rules)
+			}
+		})
+	}
+}
+
+func TestMergeResponseHeaderPolicies(t *testing.T) {
+	router := []ResponseHeaderRule{
+		{Action: ResponseHeaderDelete, Name: "Server"},
+		{Action: ResponseHeaderDelete, Name: "X-Powered-By"},
+		{Action: ResponseHeaderReplace, Name: "Via", Value: "router"},
+	}
+	route := []ResponseHeaderRule{
+		{Action: ResponseHeaderKeep, Name: "server"},
+		{Action: ResponseHeaderReplace, Name: "X-Powered-By", Value: "app"},
+		{Action: ResponseHeaderDelete, Name: "X-Debug"},
+	}
+	expected := []ResponseHeaderRule{
+		{Action: ResponseHeaderReplace, Name: "Via", Value: "router"},
+		{Action: ResponseHeaderReplace, Name: "X-Powered-By", Value: "app"},
+		{Action: ResponseHeaderDelete, Name: "X-Debug"},
+	}
+	if rules := MergeResponseHeaderPolicies(router, route); !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected %#v, got %#v", expected, rules)
+	}
+	if rules := MergeResponseHeaderPolicies(router, nil); !reflect.DeepEqual(rules, router) {
+		t.Errorf("expected the router rules, got %#v", rules)
+	}
+}
+
+func TestGetResponseHeaderPolicy(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{ResponseHeaderPolicyAnnotation: "delete Server"}},
+	}
+	if rules, errs := GetResponseHeaderPolicy(route); len(errs) > 0 || len(rules) != 1 {
+		t.Errorf("expected a rule, got %v %v", rules, errs)
+	}
+
+	route.Spec.TLS = &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough}
+	if errs := ValidateResponseHeaderPolicy(route); len(errs) != 1 {
+		t.Errorf("expected the policy of a passthrough route to be invalid, got %v", errs)
+	}
+}
+
+func FuzzParseResponseHeaderPolicy(f *testing.F) {
+	for _, seed := range []string{
+		"delete X-Powered-By; replace Server  my router ;keep Via;",
+		"# comment\ndelete Server\n\n",
+		"replace X-Frame-Options DENY",
+		"replace Server a\"b",
+		"replace Server %[src]",
+		"replace Server a\nbackend x",
+		"delete",
+		"keep Via extra",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		rules, err := ParseResponseHeaderPolicy(value)
+		if err != nil {
+			return
+		}
+		// The rules are written as is in the haproxy configuration, and
+		// parse back to the same rules once written as a policy.
+		var policy []string
+		for _, rule := range rules {
+			if !responseHeaderNamePattern.MatchString(rule.Name) {
+				t.Fatalf("value %q parsed to the invalid header name %q", value, rule.Name)
+			}
+			switch rule.Action {
+			case ResponseHeaderDelete, ResponseHeaderKeep:
+				if len(rule.Value) > 0 {
+					t.Fatalf("value %q parsed to a %s rule with the value %q", value, rule.Action, rule.Value)
+				}
+				policy = append(policy, rule.Action+" "+rule.Name)
+			case ResponseHeaderReplace:
+				if !responseHeaderValuePattern.MatchString(rule.Value) {
+					t.Fatalf("value %q parsed to the invalid header value %q", value, rule.Value)
+				}
+				policy = append(policy, rule.Action+" "+rule.Name+" "+rule.Value)
+			default:
+				t.Fatalf("value %q parsed to the unknown action %q", value, rule.Action)
+			}
+		}
+		reparsed, err := ParseResponseHeaderPolicy(strings.Join(policy, "; "))
+		if err != nil {
+			t.Fatalf("value %q parsed to rules %v that do not parse again: %v", value, rules, err)
+		}
+		if len(rules) > 0 && !reflect.DeepEqual(reparsed, rules) {
+			t.Fatalf("value %q parsed to rules %v, which parse again to %v", value, rules, reparsed)
+		}
+	})
+}
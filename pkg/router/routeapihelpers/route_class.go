@@ -0,0 +1,42 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strings"
+
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// RouteClassAnnotation selects the class of routers that serve a route,
+	// like the class of an ingress selects its ingress controller.
+	RouteClassAnnotation = "router.openshift.io/route-class"
+
+	// DefaultRouteClass is the class of routes that do not select one.
+	DefaultRouteClass = "default"
+
+	// RouteMigratingAnnotation carries the route class a route moved to
+	// while the router keeps serving it until a router of that class
+	// admits it.  It is set by the router on its own copy of the route and
+	// is never read from the route as stored in the API.
+	RouteMigratingAnnotation = "router.openshift.io/migrating-to-route-class"
+)
+
+// GetRouteClass returns the class a route selects, or DefaultRouteClass if
+// it does not select one.  A class is a DNS-1123 subdomain.
+func GetRouteClass(route *routev1.Route) (string, error) {
+	value, ok := route.Annotations[RouteClassAnnotation]
+	if !ok {
+		return DefaultRouteClass, nil
+	}
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return DefaultRouteClass, nil
+	}
+	if errs := kvalidation.IsDNS1123Subdomain(value); len(errs) > 0 {
+		return "", fmt.Errorf("invalid route class %q: %s", value, strings.Join(errs, ", "))
+	}
+	return value, nil
+}
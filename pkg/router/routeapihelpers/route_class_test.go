@@ -0,0 +1,51 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetRouteClass(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		expectErr   bool
+	}{
+		{
+			name:     "no class",
+			expected: DefaultRouteClass,
+		},
+		{
+			name:        "empty class",
+			annotations: map[string]string{RouteClassAnnotation: " "},
+			expected:    DefaultRouteClass,
+		},
+		{
+			name:        "class",
+			annotations: map[string]string{RouteClassAnnotation: " internal.example.com "},
+			expected:    "internal.example.com",
+		},
+		{
+			name:        "invalid class",
+			annotations: map[string]string{RouteClassAnnotation: "Internal"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			class, err := GetRouteClass(route)
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if class != tc.expected {
+				t.Errorf("expected class %q, got %q", tc.expected, class)
+			}
+		})
+	}
+}
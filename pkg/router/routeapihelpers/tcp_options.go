@@ -0,0 +1,137 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// ConnectTimeoutAnnotation sets how long the router waits for a
+	// connection to a backend of a route to be established.
+	ConnectTimeoutAnnotation = "haproxy.router.openshift.io/timeout-connect"
+	// QueueTimeoutAnnotation sets how long a request may wait for a free
+	// connection slot when the backends of a route are at their maximum
+	// number of connections.
+	QueueTimeoutAnnotation = "haproxy.router.openshift.io/timeout-queue"
+
+	// TCPKeepaliveAnnotation enables TCP keepalive probes on the
+	// connections to the backends of a route when set to "true".
+	TCPKeepaliveAnnotation = "haproxy.router.openshift.io/tcp-keepalive"
+	// TCPKeepaliveIdleAnnotation sets how long a backend connection is idle
+	// before keepalive probes are sent.
+	TCPKeepaliveIdleAnnotation = "haproxy.router.openshift.io/tcp-keepalive-idle"
+	// TCPKeepaliveIntervalAnnotation sets the time between keepalive probes.
+	TCPKeepaliveIntervalAnnotation = "haproxy.router.openshift.io/tcp-keepalive-interval"
+	// TCPKeepaliveCountAnnotation sets how many unanswered keepalive probes
+	// close a backend connection.
+	TCPKeepaliveCountAnnotation = "haproxy.router.openshift.io/tcp-keepalive-count"
+)
+
+const (
+	// haproxyMaxTimeout is the longest timeout haproxy accepts.
+	haproxyMaxTimeout = 2147483647 * time.Millisecond
+	// maxTCPKeepaliveSeconds is the longest keepalive idle time and
+	// interval accepted by Linux.
+	maxTCPKeepaliveSeconds = 32767
+	// maxTCPKeepaliveCount is the largest keepalive probe count accepted by
+	// Linux.
+	maxTCPKeepaliveCount = 127
+)
+
+// BackendTCPOptions are the options of the connections a route makes to its
+// backends.  Zero fields use the router defaults.
+type BackendTCPOptions struct {
+	// ConnectTimeout is the timeout to establish a backend connection.
+	ConnectTimeout time.Duration
+	// QueueTimeout is how long a request may be queued.
+	QueueTimeout time.Duration
+
+	// Keepalive enables TCP keepalive probes on backend connections.
+	Keepalive bool
+	// KeepaliveIdleSeconds is the idle time before probes are sent.
+	KeepaliveIdleSeconds int
+	// KeepaliveIntervalSeconds is the time between probes.
+	KeepaliveIntervalSeconds int
+	// KeepaliveCount is the number of unanswered probes that close the
+	// connection.
+	KeepaliveCount int
+}
+
+// GetBackendTCPOptions returns the backend connection options of a route.
+func GetBackendTCPOptions(route *routev1.Route) (BackendTCPOptions, field.ErrorList) {
+	options := BackendTCPOptions{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	parseTimeout := func(annotation string) time.Duration {
+		value, ok := route.Annotations[annotation]
+		if !ok {
+			return 0
+		}
+		d, err := ParseHAProxyTimeout(value)
+		switch {
+		case err != nil:
+			result = append(result, field.Invalid(fldPath.Key(annotation), value, err.Error()))
+		case d < time.Millisecond || d > haproxyMaxTimeout:
+			result = append(result, field.Invalid(fldPath.Key(annotation), value, fmt.Sprintf("must be between 1ms and %v", haproxyMaxTimeout)))
+		default:
+			return d
+		}
+		return 0
+	}
+	options.ConnectTimeout = parseTimeout(ConnectTimeoutAnnotation)
+	options.QueueTimeout = parseTimeout(QueueTimeoutAnnotation)
+
+	if value, ok := route.Annotations[TCPKeepaliveAnnotation]; ok {
+		keepalive, err := strconv.ParseBool(value)
+		if err != nil {
+			result = append(result, field.Invalid(fldPath.Key(TCPKeepaliveAnnotation), value, "must be true or false"))
+		}
+		options.Keepalive = keepalive
+	}
+
+	parseKeepalive := func(annotation string, seconds bool, max int) int {
+		value, ok := route.Annotations[annotation]
+		if !ok {
+			return 0
+		}
+		if !options.Keepalive {
+			result = append(result, field.Invalid(fldPath.Key(annotation), value, fmt.Sprintf("requires %s to be true", TCPKeepaliveAnnotation)))
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if seconds && err != nil {
+			// Accept haproxy time units as long as the value is a
+			// whole number of seconds.
+			if d, perr := ParseHAProxyTimeout(value); perr == nil && d%time.Second == 0 {
+				n, err = int(d/time.Second), nil
+			}
+		}
+		if err != nil || n < 1 || n > max {
+			msg := fmt.Sprintf("must be an integer between 1 and %d", max)
+			if seconds {
+				msg = fmt.Sprintf("must be a whole number of seconds between 1s and %ds", max)
+			}
+			result = append(result, field.Invalid(fldPath.Key(annotation), value, msg))
+			return 0
+		}
+		return n
+	}
+	options.KeepaliveIdleSeconds = parseKeepalive(TCPKeepaliveIdleAnnotation, true, maxTCPKeepaliveSeconds)
+	options.KeepaliveIntervalSeconds = parseKeepalive(TCPKeepaliveIntervalAnnotation, true, maxTCPKeepaliveSeconds)
+	options.KeepaliveCount = parseKeepalive(TCPKeepaliveCountAnnotation, false, maxTCPKeepaliveCount)
+
+	return options, result
+}
+
+// ValidateBackendTCPOptions checks that the backend connection options of a
+// route are valid.
+func ValidateBackendTCPOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetBackendTCPOptions(route)
+	return result
+}
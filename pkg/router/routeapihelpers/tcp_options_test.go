@@ -0,0 +1,87 @@
+package routeapihelpers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetBackendTCPOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    BackendTCPOptions
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "all options",
+			annotations: map[string]string{
+				ConnectTimeoutAnnotation:       "3s",
+				QueueTimeoutAnnotation:         "500",
+				TCPKeepaliveAnnotation:         "true",
+				TCPKeepaliveIdleAnnotation:     "2m",
+				TCPKeepaliveIntervalAnnotation: "15",
+				TCPKeepaliveCountAnnotation:    "4",
+			},
+			expected: BackendTCPOptions{
+				ConnectTimeout:           3 * time.Second,
+				QueueTimeout:             500 * time.Millisecond,
+				Keepalive:                true,
+				KeepaliveIdleSeconds:     120,
+				KeepaliveIntervalSeconds: 15,
+				KeepaliveCount:           4,
+			},
+		},
+		{
+			name:        "keepalive disabled",
+			annotations: map[string]string{TCPKeepaliveAnnotation: "false"},
+		},
+		{
+			name: "keepalive settings without keepalive",
+			annotations: map[string]string{
+				TCPKeepaliveIdleAnnotation:  "60",
+				TCPKeepaliveCountAnnotation: "4",
+			},
+			errs: 2,
+		},
+		{
+			name: "invalid options",
+			annotations: map[string]string{
+				ConnectTimeoutAnnotation:       "soon",
+				QueueTimeoutAnnotation:         "30d",
+				TCPKeepaliveAnnotation:         "true",
+				TCPKeepaliveIdleAnnotation:     "1500ms",
+				TCPKeepaliveIntervalAnnotation: "40000",
+				TCPKeepaliveCountAnnotation:    "0",
+			},
+			expected: BackendTCPOptions{Keepalive: true},
+			errs:     5,
+		},
+		{
+			name:        "invalid keepalive",
+			annotations: map[string]string{TCPKeepaliveAnnotation: "sometimes"},
+			errs:        1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+			}
+			options, errs := GetBackendTCPOptions(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if options != tc.expected {
+				t.Fatalf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// TCPPortAnnotation exposes a route on a dedicated router port in TCP
+	// mode, without any TLS or SNI inspection.  The value is either a port
+	// number from the router's TCP port range or TCPPortAuto.
+	TCPPortAnnotation = "haproxy.router.openshift.io/tcp-port"
+
+	// TCPPortAuto is the TCPPortAnnotation value that lets the router pick
+	// a free port from its TCP port range.
+	TCPPortAuto = "auto"
+
+	// TCPAllocatedPortAnnotation carries the port the router allocated to a
+	// TCP route.  It is set by the router on its own copy of the route and
+	// is never read from the route as stored in the API.
+	TCPAllocatedPortAnnotation = "haproxy.router.openshift.io/tcp-allocated-port"
+)
+
+// PortRange is an inclusive range of ports.  The zero value is empty.
+type PortRange struct {
+	Min int32
+	Max int32
+}
+
+// ParsePortRange parses a range of the form "min-max".  An empty value
+// returns the empty range.
+func ParsePortRange(value string) (PortRange, error) {
+	if len(value) == 0 {
+		return PortRange{}, nil
+	}
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return PortRange{}, fmt.Errorf("port range %q must be of the form min-max", value)
+	}
+	var ports [2]int32
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || len(kvalidation.IsValidPortNum(n)) > 0 {
+			return PortRange{}, fmt.Errorf("port range %q has an invalid port %q", value, part)
+		}
+		ports[i] = int32(n)
+	}
+	if ports[0] > ports[1] {
+		return PortRange{}, fmt.Errorf("port range %q is empty", value)
+	}
+	return PortRange{Min: ports[0], Max: ports[1]}, nil
+}
+
+// IsEmpty returns true if the range contains no ports.
+func (r PortRange) IsEmpty() bool {
+	return r.Min == 0 || r.Max < r.Min
+}
+
+// Contains returns true if port is within the range.
+func (r PortRange) Contains(port int32) bool {
+	return !r.IsEmpty() && port >= r.Min && port <= r.Max
+}
+
+func (r PortRange) String() string {
+	if r.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// IsTCPRoute returns true if the route asks to be exposed on a dedicated
+// TCP port.
+func IsTCPRoute(route *routev1.Route) bool {
+	_, ok := route.Annotations[TCPPortAnnotation]
+	return ok
+}
+
+// RequestedTCPPort returns the port a TCP route asks for, or 0 if the route
+// lets the router pick one.
+func RequestedTCPPort(route *routev1.Route) (int32, error) {
+	value := strings.TrimSpace(route.Annotations[TCPPortAnnotation])
+	if value == TCPPortAuto {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || len(kvalidation.IsValidPortNum(n)) > 0 {
+		return 0, fmt.Errorf("must be %q or a port number", TCPPortAuto)
+	}
+	return int32(n), nil
+}
+
+// AllocatedTCPPort returns the port the router allocated to a TCP route, or
+// 0 if none was allocated.
+func AllocatedTCPPort(route *routev1.Route) int32 {
+	n, err := strconv.Atoi(route.Annotations[TCPAllocatedPortAnnotation])
+	if err != nil || len(kvalidation.IsValidPortNum(n)) > 0 {
+		return 0
+	}
+	return int32(n)
+}
+
+// ValidateTCPRoute checks that a TCP route requests a valid port and does
+// not use any setting that requires inspecting its traffic.
+func ValidateTCPRoute(route *routev1.Route) field.ErrorList {
+	result := field.ErrorList{}
+	if !IsTCPRoute(route) {
+		return result
+	}
+
+	if _, err := RequestedTCPPort(route); err != nil {
+		fldPath := field.NewPath("metadata", "annotations").Key(TCPPortAnnotation)
+		result = append(result, field.Invalid(fldPath, route.Annotations[TCPPortAnnotation], err.Error()))
+	}
+	if route.Spec.TLS != nil && len(route.Spec.TLS.Termination) > 0 {
+		result = append(result, field.Invalid(field.NewPath("spec", "tls"), "", "TCP routes do not support TLS termination"))
+	}
+	if len(route.Spec.Path) > 0 {
+		result = append(result, field.Invalid(field.NewPath("spec", "path"), route.Spec.Path, "TCP routes do not support paths"))
+	}
+	if route.Spec.WildcardPolicy == routev1.WildcardPolicySubdomain {
+		result = append(result, field.Invalid(field.NewPath("spec", "wildcardPolicy"), route.Spec.WildcardPolicy, "TCP routes do not support wildcards"))
+	}
+	return result
+}
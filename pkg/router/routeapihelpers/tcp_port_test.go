@@ -0,0 +1,96 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected PortRange
+		err      bool
+	}{
+		{value: ""},
+		{value: "10000-10100", expected: PortRange{Min: 10000, Max: 10100}},
+		{value: "10000 - 10000", expected: PortRange{Min: 10000, Max: 10000}},
+		{value: "10000", err: true},
+		{value: "10100-10000", err: true},
+		{value: "0-100", err: true},
+		{value: "1-65536", err: true},
+		{value: "a-b", err: true},
+	}
+
+	for _, tc := range tests {
+		r, err := ParsePortRange(tc.value)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.value, err)
+		}
+		if r != tc.expected {
+			t.Errorf("%q: expected %v, got %v", tc.value, tc.expected, r)
+		}
+	}
+}
+
+func TestValidateTCPRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		spec        routev1.RouteSpec
+		valid       bool
+	}{
+		{
+			name:  "not a TCP route",
+			spec:  routev1.RouteSpec{Path: "/path", TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge}},
+			valid: true,
+		},
+		{
+			name:        "auto",
+			annotations: map[string]string{TCPPortAnnotation: "auto"},
+			valid:       true,
+		},
+		{
+			name:        "port",
+			annotations: map[string]string{TCPPortAnnotation: "10000"},
+			valid:       true,
+		},
+		{
+			name:        "invalid port",
+			annotations: map[string]string{TCPPortAnnotation: "70000"},
+		},
+		{
+			name:        "TLS",
+			annotations: map[string]string{TCPPortAnnotation: "auto"},
+			spec:        routev1.RouteSpec{TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough}},
+		},
+		{
+			name:        "path",
+			annotations: map[string]string{TCPPortAnnotation: "auto"},
+			spec:        routev1.RouteSpec{Path: "/path"},
+		},
+		{
+			name:        "wildcard",
+			annotations: map[string]string{TCPPortAnnotation: "auto"},
+			spec:        routev1.RouteSpec{WildcardPolicy: routev1.WildcardPolicySubdomain},
+		},
+	}
+
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+			Spec:       tc.spec,
+		}
+		if errs := ValidateTCPRoute(route); tc.valid != (len(errs) == 0) {
+			t.Errorf("%s: expected valid=%t, got %v", tc.name, tc.valid, errs)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// TimeoutAnnotation sets the server timeout of a route.
+	TimeoutAnnotation = "haproxy.router.openshift.io/timeout"
+	// TunnelTimeoutAnnotation sets the tunnel timeout of a route, which
+	// applies to websocket and passthrough connections.
+	TunnelTimeoutAnnotation = "haproxy.router.openshift.io/timeout-tunnel"
+)
+
+const (
+	// RouteTimeoutPolicyClamp raises the tunnel timeout of the routes whose
+	// timeouts contradict each other to their server timeout.
+	RouteTimeoutPolicyClamp = "Clamp"
+	// RouteTimeoutPolicyReject rejects the routes whose timeouts contradict
+	// each other.
+	RouteTimeoutPolicyReject = "Reject"
+)
+
+// haproxyTimeoutRE matches the time format accepted by haproxy.
+var haproxyTimeoutRE = regexp.MustCompile(`^([1-9][0-9]*)(us|ms|s|m|h|d)?$`)
+
+// RouterTimeouts are the router wide timeouts that apply to routes that do
+// not override them. A zero value means the timeout is unknown.
+type RouterTimeouts struct {
+	Client      time.Duration
+	Server      time.Duration
+	Tunnel      time.Duration
+	HTTPRequest time.Duration
+}
+
+// ParseHAProxyTimeout parses a timeout in the format accepted by haproxy: a
+// positive integer followed by an optional unit among us, ms, s, m, h and d.
+// Values without a unit are in milliseconds.
+func ParseHAProxyTimeout(value string) (time.Duration, error) {
+	m := haproxyTimeoutRE.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("%q is not a positive integer with an optional unit of us, ms, s, m, h or d", value)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	unit := map[string]time.Duration{
+		"us": time.Microsecond,
+		"":   time.Millisecond,
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+	}[m[2]]
+	return time.Duration(n) * unit, nil
+}
+
+// ValidateRouterTimeouts checks that the router wide timeouts do not
+// contradict each other.
+func ValidateRouterTimeouts(timeouts RouterTimeouts) error {
+	if timeouts.HTTPRequest > 0 && timeouts.Client > 0 && timeouts.HTTPRequest > timeouts.Client {
+		return fmt.Errorf("http-request timeout %v exceeds the client timeout %v, so the client timeout applies instead", timeouts.HTTPRequest, timeouts.Client)
+	}
+	if timeouts.Tunnel > 0 && timeouts.Server > 0 && timeouts.Tunnel < timeouts.Server {
+		return fmt.Errorf("tunnel timeout %v is shorter than the server timeout %v", timeouts.Tunnel, timeouts.Server)
+	}
+	return nil
+}
+
+// FormatHAProxyTimeout formats a timeout in the format accepted by haproxy.
+func FormatHAProxyTimeout(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// routeTimeouts returns the server and tunnel timeouts of a route, which
+// default to the router wide ones, and whether the route sets either.
+// Malformed annotations are ignored, as the router ignores them.
+func routeTimeouts(route *routev1.Route, timeouts RouterTimeouts) (server, tunnel time.Duration, set bool) {
+	server, tunnel = timeouts.Server, timeouts.Tunnel
+	if d, err := ParseHAProxyTimeout(route.Annotations[TimeoutAnnotation]); err == nil {
+		server, set = d, true
+	}
+	if d, err := ParseHAProxyTimeout(route.Annotations[TunnelTimeoutAnnotation]); err == nil {
+		tunnel, set = d, true
+	}
+	return server, tunnel, set
+}
+
+// ClampRouteTunnelTimeout returns the server timeout of a route, and true,
+// if the timeouts the route sets make its tunnel timeout shorter than its
+// server timeout.  Passthrough routes only use a tunnel timeout, which
+// defaults to their server timeout annotation.
+func ClampRouteTunnelTimeout(route *routev1.Route, timeouts RouterTimeouts) (time.Duration, bool) {
+	if route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return 0, false
+	}
+	server, tunnel, set := routeTimeouts(route, timeouts)
+	// Only report a contradiction the route itself introduced.
+	if !set || server <= 0 || tunnel <= 0 || tunnel >= server {
+		return 0, false
+	}
+	return server, true
+}
+
+// ValidateRouteTimeouts checks that the timeout annotations of a route do
+// not contradict each other or the router wide timeouts they are combined
+// with.  Malformed timeouts are ignored, as the router ignores them.
+func ValidateRouteTimeouts(route *routev1.Route, timeouts RouterTimeouts) field.ErrorList {
+	result := field.ErrorList{}
+	if server, ok := ClampRouteTunnelTimeout(route, timeouts); ok {
+		_, tunnel, _ := routeTimeouts(route, timeouts)
+		result = append(result, field.Invalid(field.NewPath("metadata", "annotations").Key(TunnelTimeoutAnnotation), tunnel.String(),
+			fmt.Sprintf("tunnel timeout must not be shorter than the server timeout %v", server)))
+	}
+	return result
+}
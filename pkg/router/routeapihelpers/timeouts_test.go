@@ -0,0 +1,197 @@
+package routeapihelpers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestParseHAProxyTimeout(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{value: "500", expected: 500 * time.Millisecond},
+		{value: "10us", expected: 10 * time.Microsecond},
+		{value: "250ms", expected: 250 * time.Millisecond},
+		{value: "30s", expected: 30 * time.Second},
+		{value: "5m", expected: 5 * time.Minute},
+		{value: "1h", expected: time.Hour},
+		{value: "2d", expected: 48 * time.Hour},
+		{value: "", err: true},
+		{value: "0s", err: true},
+		{value: "-5s", err: true},
+		{value: "5 s", err: true},
+		{value: "1h30m", err: true},
+		{value: "5w", err: true},
+	}
+
+	for _, tc := range tests {
+		d, err := ParseHAProxyTimeout(tc.value)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tc.value, d)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.value, err)
+			continue
+		}
+		if d != tc.expected {
+			t.Errorf("%q: expected %v, got %v", tc.value, tc.expected, d)
+		}
+	}
+}
+
+func TestValidateRouterTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts RouterTimeouts
+		err      bool
+	}{
+		{
+			name:     "defaults",
+			timeouts: RouterTimeouts{Client: 30 * time.Second, Server: 30 * time.Second, Tunnel: time.Hour, HTTPRequest: 10 * time.Second},
+		},
+		{
+			name:     "unknown timeouts",
+			timeouts: RouterTimeouts{},
+		},
+		{
+			name:     "http-request exceeds client",
+			timeouts: RouterTimeouts{Client: 5 * time.Second, HTTPRequest: 10 * time.Second},
+			err:      true,
+		},
+		{
+			name:     "tunnel shorter than server",
+			timeouts: RouterTimeouts{Server: 2 * time.Hour, Tunnel: time.Hour},
+			err:      true,
+		},
+	}
+
+	for _, tc := range tests {
+		err := ValidateRouterTimeouts(tc.timeouts)
+		if tc.err != (err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestValidateRouteTimeouts(t *testing.T) {
+	defaults := RouterTimeouts{Client: 30 * time.Second, Server: 30 * time.Second, Tunnel: time.Hour, HTTPRequest: 10 * time.Second}
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		termination    routev1.TLSTerminationType
+		expectedErrors int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name:        "valid timeouts",
+			annotations: map[string]string{TimeoutAnnotation: "2m", TunnelTimeoutAnnotation: "2h"},
+		},
+		{
+			name:        "malformed timeout is ignored",
+			annotations: map[string]string{TimeoutAnnotation: "2 minutes"},
+		},
+		{
+			name:        "malformed timeouts are ignored",
+			annotations: map[string]string{TimeoutAnnotation: "abc", TunnelTimeoutAnnotation: "0"},
+		},
+		{
+			name:           "server timeout exceeds default tunnel timeout",
+			annotations:    map[string]string{TimeoutAnnotation: "2h"},
+			expectedErrors: 1,
+		},
+		{
+			name:           "tunnel timeout shorter than server timeout",
+			annotations:    map[string]string{TimeoutAnnotation: "5m", TunnelTimeoutAnnotation: "1m"},
+			expectedErrors: 1,
+		},
+		{
+			name:        "passthrough only uses the tunnel timeout",
+			annotations: map[string]string{TimeoutAnnotation: "5m", TunnelTimeoutAnnotation: "1m"},
+			termination: routev1.TLSTerminationPassthrough,
+		},
+	}
+
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "r", Namespace: "ns", Annotations: tc.annotations},
+		}
+		if len(tc.termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+		}
+		errs := ValidateRouteTimeouts(route, defaults)
+		if len(errs) != tc.expectedErrors {
+			t.Errorf("%s: expected %d errors, got %d: %v", tc.name, tc.expectedErrors, len(errs), errs)
+		}
+	}
+}
+
+func TestClampRouteTunnelTimeout(t *testing.T) {
+	defaults := RouterTimeouts{Client: 30 * time.Second, Server: 30 * time.Second, Tunnel: time.Hour, HTTPRequest: 10 * time.Second}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		termination routev1.TLSTerminationType
+		expected    time.Duration
+		clamped     bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name:        "valid timeouts",
+			annotations: map[string]string{TimeoutAnnotation: "2m", TunnelTimeoutAnnotation: "2h"},
+		},
+		{
+			name:        "malformed tunnel timeout",
+			annotations: map[string]string{TimeoutAnnotation: "5m", TunnelTimeoutAnnotation: "1 second"},
+		},
+		{
+			name:        "server timeout exceeds default tunnel timeout",
+			annotations: map[string]string{TimeoutAnnotation: "2h"},
+			expected:    2 * time.Hour,
+			clamped:     true,
+		},
+		{
+			name:        "tunnel timeout shorter than server timeout",
+			annotations: map[string]string{TimeoutAnnotation: "5m", TunnelTimeoutAnnotation: "1m"},
+			expected:    5 * time.Minute,
+			clamped:     true,
+		},
+		{
+			name:        "passthrough only uses the tunnel timeout",
+			annotations: map[string]string{TimeoutAnnotation: "5m", TunnelTimeoutAnnotation: "1m"},
+			termination: routev1.TLSTerminationPassthrough,
+		},
+	}
+
+	for _, tc := range tests {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "r", Namespace: "ns", Annotations: tc.annotations},
+		}
+		if len(tc.termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+		}
+		d, clamped := ClampRouteTunnelTimeout(route, defaults)
+		if clamped != tc.clamped || (clamped && d != tc.expected) {
+			t.Errorf("%s: expected %v (%v), got %v (%v)", tc.name, tc.expected, tc.clamped, d, clamped)
+		}
+	}
+
+	if value := FormatHAProxyTimeout(5 * time.Minute); value != "300s" {
+		t.Errorf("expected 300s, got %s", value)
+	}
+	if value := FormatHAProxyTimeout(1500 * time.Millisecond); value != "1500ms" {
+		t.Errorf("expected 1500ms, got %s", value)
+	}
+}
@@ -0,0 +1,106 @@
+package routeapihelpers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+const (
+	// RequestIDHeaderAnnotation names a request header that the router
+	// sets to a unique request ID, e.g. "X-Request-ID".
+	RequestIDHeaderAnnotation = "haproxy.router.openshift.io/request-id-header"
+	// TraceContextAnnotation, when "true", makes the router start a W3C
+	// trace context by setting the traceparent header of requests.
+	TraceContextAnnotation = "haproxy.router.openshift.io/trace-context"
+	// TracingHeaderPolicyAnnotation sets what the router does with tracing
+	// headers that requests already carry: "preserve", the default, keeps
+	// them so that traces started by clients are propagated, "replace"
+	// always sets new ones.
+	TracingHeaderPolicyAnnotation = "haproxy.router.openshift.io/tracing-header-policy"
+)
+
+const (
+	// TracingHeaderPolicyPreserve keeps the tracing headers of requests.
+	TracingHeaderPolicyPreserve = "preserve"
+	// TracingHeaderPolicyReplace replaces the tracing headers of requests.
+	TracingHeaderPolicyReplace = "replace"
+)
+
+// tracingHeaderNamePattern matches the header names accepted for request IDs.
+// It is stricter than an HTTP token so that names never need quoting in the
+// haproxy configuration.
+var tracingHeaderNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// reservedTracingHeaders are headers the router or HTTP itself manage, in
+// lower case, that must not carry request IDs.
+var reservedTracingHeaders = sets.NewString(
+	"host", "connection", "content-length", "transfer-encoding", "te", "upgrade",
+	"cookie", "forwarded", "x-forwarded-for", "x-forwarded-host", "x-forwarded-port",
+	"x-forwarded-proto", "x-forwarded-proto-version", "traceparent", "tracestate",
+)
+
+// TracingOptions are the request ID and tracing headers the router sets on
+// the requests of a route.
+type TracingOptions struct {
+	// RequestIDHeader is the header set to a unique request ID, if any.
+	RequestIDHeader string
+	// TraceContext sets the W3C traceparent header.
+	TraceContext bool
+	// Replace replaces tracing headers that requests already carry.
+	Replace bool
+}
+
+// GetTracingOptions returns the tracing options of a route.
+func GetTracingOptions(route *routev1.Route) (TracingOptions, field.ErrorList) {
+	options := TracingOptions{}
+	result := field.ErrorList{}
+	fldPath := field.NewPath("metadata", "annotations")
+
+	if value, ok := route.Annotations[RequestIDHeaderAnnotation]; ok {
+		switch {
+		case !tracingHeaderNamePattern.MatchString(value):
+			result = append(result, field.Invalid(fldPath.Key(RequestIDHeaderAnnotation), value, "must be a header name made of letters, digits, '-', '_' and '.'"))
+		case reservedTracingHeaders.Has(strings.ToLower(value)):
+			result = append(result, field.Invalid(fldPath.Key(RequestIDHeaderAnnotation), value, "header is reserved"))
+		default:
+			options.RequestIDHeader = value
+		}
+	}
+
+	if value, ok := route.Annotations[TraceContextAnnotation]; ok {
+		traceContext, err := strconv.ParseBool(value)
+		if err != nil {
+			result = append(result, field.Invalid(fldPath.Key(TraceContextAnnotation), value, "must be true or false"))
+		}
+		options.TraceContext = traceContext
+	}
+
+	if value, ok := route.Annotations[TracingHeaderPolicyAnnotation]; ok {
+		switch value {
+		case TracingHeaderPolicyPreserve:
+		case TracingHeaderPolicyReplace:
+			options.Replace = true
+		default:
+			result = append(result, field.NotSupported(fldPath.Key(TracingHeaderPolicyAnnotation), value, []string{TracingHeaderPolicyPreserve, TracingHeaderPolicyReplace}))
+		}
+		if _, ok := route.Annotations[RequestIDHeaderAnnotation]; !ok && !options.TraceContext {
+			result = append(result, field.Invalid(fldPath.Key(TracingHeaderPolicyAnnotation), value, fmt.Sprintf("requires %s or %s", RequestIDHeaderAnnotation, TraceContextAnnotation)))
+		}
+	}
+
+	return options, result
+}
+
+// ValidateTracingOptions checks that the tracing options of a route are
+// valid.
+func ValidateTracingOptions(route *routev1.Route) field.ErrorList {
+	_, result := GetTracingOptions(route)
+	return result
+}
@@ -0,0 +1,87 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetTracingOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    TracingOptions
+		errs        int
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name: "request id and trace context",
+			annotations: map[string]string{
+				RequestIDHeaderAnnotation:     "X-Request-ID",
+				TraceContextAnnotation:        "true",
+				TracingHeaderPolicyAnnotation: "replace",
+			},
+			expected: TracingOptions{RequestIDHeader: "X-Request-ID", TraceContext: true, Replace: true},
+		},
+		{
+			name: "preserved request id",
+			annotations: map[string]string{
+				RequestIDHeaderAnnotation:     "x-correlation-id",
+				TracingHeaderPolicyAnnotation: "preserve",
+			},
+			expected: TracingOptions{RequestIDHeader: "x-correlation-id"},
+		},
+		{
+			name:        "invalid header name",
+			annotations: map[string]string{RequestIDHeaderAnnotation: "X-Request-ID #"},
+			errs:        1,
+		},
+		{
+			name:        "reserved header",
+			annotations: map[string]string{RequestIDHeaderAnnotation: "Traceparent"},
+			errs:        1,
+		},
+		{
+			name:        "invalid trace context",
+			annotations: map[string]string{TraceContextAnnotation: "yes please"},
+			errs:        1,
+		},
+		{
+			name: "invalid policy",
+			annotations: map[string]string{
+				TraceContextAnnotation:        "true",
+				TracingHeaderPolicyAnnotation: "merge",
+			},
+			expected: TracingOptions{TraceContext: true},
+			errs:     1,
+		},
+		{
+			name: "policy without tracing",
+			annotations: map[string]string{
+				TraceContextAnnotation:        "false",
+				TracingHeaderPolicyAnnotation: "replace",
+			},
+			expected: TracingOptions{Replace: true},
+			errs:     1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route", Annotations: tc.annotations},
+			}
+			options, errs := GetTracingOptions(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if options != tc.expected {
+				t.Fatalf("expected %#v, got %#v", tc.expected, options)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package routeapihelpers
+
+import (
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// WAFAnnotation sends the requests of a route to the web application
+// firewall agent of the router before they are forwarded to its backends.
+// The annotation is ignored by routers without an agent.
+const WAFAnnotation = "haproxy.router.openshift.io/waf"
+
+// GetWAF returns true if a route sends its requests to the web application
+// firewall agent of the router.  Passthrough routes are not supported, as
+// the router does not see their requests.
+func GetWAF(route *routev1.Route) (bool, field.ErrorList) {
+	result := field.ErrorList{}
+	value, ok := route.Annotations[WAFAnnotation]
+	if !ok {
+		return false, result
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(WAFAnnotation)
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, append(result, field.Invalid(fldPath, value, "must be true or false"))
+	}
+	if enabled && route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough {
+		return false, append(result, field.Invalid(fldPath, value, "is not supported for passthrough routes"))
+	}
+	return enabled, result
+}
+
+// ValidateWAF checks that the web application firewall annotation of a
+// route is valid.
+func ValidateWAF(route *routev1.Route) field.ErrorList {
+	_, result := GetWAF(route)
+	return result
+}
@@ -0,0 +1,69 @@
+package routeapihelpers
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestGetWAF(t *testing.T) {
+	tests := []struct {
+		name        string
+		termination routev1.TLSTerminationType
+		value       string
+		expected    bool
+		errs        int
+	}{
+		{
+			name: "no annotation",
+		},
+		{
+			name:     "enabled",
+			value:    " true",
+			expected: true,
+		},
+		{
+			name:        "enabled on an edge route",
+			termination: routev1.TLSTerminationEdge,
+			value:       "true",
+			expected:    true,
+		},
+		{
+			name:        "disabled on a passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			value:       "false",
+		},
+		{
+			name:        "enabled on a passthrough route",
+			termination: routev1.TLSTerminationPassthrough,
+			value:       "true",
+			errs:        1,
+		},
+		{
+			name:  "invalid value",
+			value: "on",
+			errs:  1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if len(tc.value) > 0 {
+				route.Annotations[WAFAnnotation] = tc.value
+			}
+			if len(tc.termination) > 0 {
+				route.Spec.TLS = &routev1.TLSConfig{Termination: tc.termination}
+			}
+			enabled, errs := GetWAF(route)
+			if len(errs) != tc.errs {
+				t.Fatalf("expected %d errors, got %v", tc.errs, errs)
+			}
+			if enabled != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, enabled)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package routeconvert converts Kubernetes Ingresses and Gateway API
+// HTTPRoutes to the equivalent routes, so that users can preview how the
+// router serves them.
+package routeconvert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// gatewayAPIGroup is the API group of HTTPRoutes.
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+// maxRouteNameBase is the longest prefix of a route name that leaves room
+// for the suffix that makes it unique.
+const maxRouteNameBase = 253 - 9
+
+// Convert returns the routes equivalent to the Ingresses and HTTPRoutes of a
+// stream of YAML or JSON manifests, and warnings about what routes cannot
+// express.  Other objects are skipped with a warning.
+func Convert(manifests io.Reader) ([]*routev1.Route, []string, error) {
+	var routes []*routev1.Route
+	var warnings []string
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(manifests, 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode the manifests: %v", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		items := []unstructured.Unstructured{*obj}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to decode the list of manifests: %v", err)
+			}
+			items = list.Items
+		}
+
+		for _, item := range items {
+			data, err := json.Marshal(item.Object)
+			if err != nil {
+				return nil, nil, err
+			}
+			gvk := item.GroupVersionKind()
+			switch {
+			case gvk.Group == networkingv1.GroupName && gvk.Kind == "Ingress":
+				ingress := &networkingv1.Ingress{}
+				if err := json.NewDecoder(bytes.NewReader(data)).Decode(ingress); err != nil {
+					return nil, nil, fmt.Errorf("unable to decode ingress %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+				}
+				r, w := IngressToRoutes(ingress)
+				routes, warnings = append(routes, r...), append(warnings, w...)
+			case gvk.Group == gatewayAPIGroup && gvk.Kind == "HTTPRoute":
+				httpRoute := &HTTPRoute{}
+				if err := json.NewDecoder(bytes.NewReader(data)).Decode(httpRoute); err != nil {
+					return nil, nil, fmt.Errorf("unable to decode httproute %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+				}
+				r, w := HTTPRouteToRoutes(httpRoute)
+				routes, warnings = append(routes, r...), append(warnings, w...)
+			default:
+				warnings = append(warnings, fmt.Sprintf("%s %s/%s is skipped, only ingresses and httproutes are converted", strings.ToLower(gvk.Kind), item.GetNamespace(), item.GetName()))
+			}
+		}
+	}
+
+	return routes, warnings, nil
+}
+
+// routeName returns the name of the route for a host and path of the object
+// named base.  Names are derived from the host and path so that converting
+// the same object twice gives the same routes.
+func routeName(base, host, path string) string {
+	h := fnv.New32a()
+	h.Write([]byte(host + path))
+	if len(base) > maxRouteNameBase {
+		base = base[:maxRouteNameBase]
+	}
+	return fmt.Sprintf("%s-%08x", base, h.Sum32())
+}
@@ -0,0 +1,239 @@
+package routeconvert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifests string
+		expected  []routev1.RouteSpec
+		warnings  []string
+	}{
+		{
+			name: "ingress with tls",
+			manifests: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  namespace: demo
+spec:
+  tls:
+  - hosts: [www.example.com]
+  rules:
+  - host: www.example.com
+    http:
+      paths:
+      - path: /api
+        pathType: Prefix
+        backend:
+          service:
+            name: api
+            port:
+              name: http
+      - path: /
+        pathType: Exact
+        backend:
+          service:
+            name: web
+            port:
+              number: 8080
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: web
+            port:
+              number: 8080
+`,
+			expected: []routev1.RouteSpec{
+				{
+					Host: "www.example.com",
+					Path: "/api",
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: "api", Weight: int32Ptr(100)},
+					Port: &routev1.RoutePort{TargetPort: intstr.FromString("http")},
+					TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect},
+				},
+				{
+					Host: "www.example.com",
+					Path: "/",
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: "web", Weight: int32Ptr(100)},
+					Port: &routev1.RoutePort{TargetPort: intstr.FromInt(8080)},
+					TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect},
+				},
+			},
+			warnings: []string{"exact path /", "service port 8080", "rules without a host"},
+		},
+		{
+			name: "passthrough ingress",
+			manifests: `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: db
+  namespace: demo
+  annotations:
+    route.openshift.io/termination: passthrough
+spec:
+  tls:
+  - hosts: [db.example.com]
+    secretName: db-tls
+  rules:
+  - host: db.example.com
+    http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: db
+            port:
+              name: tls
+`,
+			expected: []routev1.RouteSpec{
+				{
+					Host: "db.example.com",
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: "db", Weight: int32Ptr(100)},
+					Port: &routev1.RoutePort{TargetPort: intstr.FromString("tls")},
+					TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough, InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyNone},
+				},
+			},
+		},
+		{
+			name: "weighted httproute",
+			manifests: `
+apiVersion: gateway.networking.k8s.io/v1beta1
+kind: HTTPRoute
+metadata:
+  name: shop
+  namespace: demo
+spec:
+  hostnames: [shop.example.com, "*.shop.example.com"]
+  rules:
+  - matches:
+    - path:
+        type: PathPrefix
+        value: /cart
+      headers:
+      - name: X-Canary
+        value: "true"
+    - path:
+        type: RegularExpression
+        value: /cart/.*
+    filters:
+    - type: RequestHeaderModifier
+    backendRefs:
+    - name: cart-v1
+      weight: 900
+    - name: cart-v2
+      weight: 100
+    - name: cart-v3
+      namespace: other
+`,
+			expected: []routev1.RouteSpec{
+				{
+					Host:              "shop.example.com",
+					Path:              "/cart",
+					To:                routev1.RouteTargetReference{Kind: "Service", Name: "cart-v1", Weight: int32Ptr(256)},
+					AlternateBackends: []routev1.RouteTargetReference{{Kind: "Service", Name: "cart-v2", Weight: int32Ptr(28)}},
+				},
+				{
+					Host:              "wildcard.shop.example.com",
+					Path:              "/cart",
+					To:                routev1.RouteTargetReference{Kind: "Service", Name: "cart-v1", Weight: int32Ptr(256)},
+					AlternateBackends: []routev1.RouteTargetReference{{Kind: "Service", Name: "cart-v2", Weight: int32Ptr(28)}},
+					WildcardPolicy:    routev1.WildcardPolicySubdomain,
+				},
+			},
+			warnings: []string{"RequestHeaderModifier filter", "other/cart-v3 is ignored", "scaled", "header, query parameter and method", "RegularExpression path"},
+		},
+		{
+			name: "httproute without matches",
+			manifests: `
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: site
+  namespace: demo
+spec:
+  hostnames: [site.example.com]
+  rules:
+  - backendRefs:
+    - name: site
+      port: 8080
+`,
+			expected: []routev1.RouteSpec{
+				{
+					Host: "site.example.com",
+					To:   routev1.RouteTargetReference{Kind: "Service", Name: "site", Weight: int32Ptr(1)},
+					Port: &routev1.RoutePort{TargetPort: intstr.FromInt(8080)},
+				},
+			},
+			warnings: []string{"service port 8080"},
+		},
+		{
+			name: "other objects",
+			manifests: `
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: web
+    namespace: demo
+`,
+			warnings: []string{"service demo/web is skipped"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			routes, warnings, err := Convert(strings.NewReader(tc.manifests))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(routes) != len(tc.expected) {
+				t.Fatalf("expected %d routes, got %d: %#v", len(tc.expected), len(routes), routes)
+			}
+			names := map[string]bool{}
+			for i, route := range routes {
+				expected := tc.expected[i]
+				if len(expected.WildcardPolicy) == 0 {
+					expected.WildcardPolicy = routev1.WildcardPolicyNone
+				}
+				if !reflect.DeepEqual(route.Spec, expected) {
+					t.Errorf("route %d: expected %#v, got %#v", i, expected, route.Spec)
+				}
+				if route.Kind != "Route" || route.Namespace != "demo" {
+					t.Errorf("route %d: unexpected type or namespace: %#v", i, route)
+				}
+				if names[route.Name] {
+					t.Errorf("route %d: duplicate name %s", i, route.Name)
+				}
+				names[route.Name] = true
+			}
+
+			all := strings.Join(warnings, "\n")
+			for _, warning := range tc.warnings {
+				if !strings.Contains(all, warning) {
+					t.Errorf("expected a warning about %q, got:\n%s", warning, all)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertInvalidManifests(t *testing.T) {
+	if _, _, err := Convert(strings.NewReader("kind: [")); err == nil {
+		t.Fatalf("expected an error for invalid manifests")
+	}
+}
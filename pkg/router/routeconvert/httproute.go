@@ -0,0 +1,226 @@
+package routeconvert
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// maxAlternateBackends is the number of alternate backends a route can have.
+const maxAlternateBackends = 3
+
+// maxRouteWeight is the largest weight of a route backend.
+const maxRouteWeight = 256
+
+// HTTPRoute is the subset of a Gateway API HTTPRoute that routes can
+// express.  It is decoded from manifests of any HTTPRoute API version, as
+// the fields it holds are the same in all of them.
+type HTTPRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec HTTPRouteSpec `json:"spec"`
+}
+
+// HTTPRouteSpec is the spec of an HTTPRoute.
+type HTTPRouteSpec struct {
+	Hostnames []string        `json:"hostnames,omitempty"`
+	Rules     []HTTPRouteRule `json:"rules,omitempty"`
+}
+
+// HTTPRouteRule is a rule of an HTTPRoute.
+type HTTPRouteRule struct {
+	Matches     []HTTPRouteMatch  `json:"matches,omitempty"`
+	Filters     []HTTPRouteFilter `json:"filters,omitempty"`
+	BackendRefs []HTTPBackendRef  `json:"backendRefs,omitempty"`
+}
+
+// HTTPRouteMatch is a match of an HTTPRoute rule.  Only the path can be
+// expressed by routes, the other matches are recorded to warn about them.
+type HTTPRouteMatch struct {
+	Path        *HTTPPathMatch           `json:"path,omitempty"`
+	Headers     []map[string]interface{} `json:"headers,omitempty"`
+	QueryParams []map[string]interface{} `json:"queryParams,omitempty"`
+	Method      *string                  `json:"method,omitempty"`
+}
+
+// HTTPPathMatch is the path match of an HTTPRoute rule.
+type HTTPPathMatch struct {
+	Type  *string `json:"type,omitempty"`
+	Value *string `json:"value,omitempty"`
+}
+
+// HTTPRouteFilter is a filter of an HTTPRoute rule.
+type HTTPRouteFilter struct {
+	Type string `json:"type"`
+}
+
+// HTTPBackendRef is a backend of an HTTPRoute rule.
+type HTTPBackendRef struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      *string `json:"kind,omitempty"`
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+	Port      *int32  `json:"port,omitempty"`
+	Weight    *int32  `json:"weight,omitempty"`
+}
+
+// HTTPRouteToRoutes returns the routes equivalent to an HTTPRoute, one for
+// each host name and path match of its rules, and warnings about the parts
+// of the HTTPRoute routes cannot express.
+func HTTPRouteToRoutes(httpRoute *HTTPRoute) ([]*routev1.Route, []string) {
+	var routes []*routev1.Route
+	var warnings []string
+	warnf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("httproute %s/%s: ", httpRoute.Namespace, httpRoute.Name)+fmt.Sprintf(format, args...))
+	}
+
+	if len(httpRoute.Spec.Hostnames) == 0 {
+		warnf("no routes are created without host names, routes need a host")
+		return nil, warnings
+	}
+
+	for i, rule := range httpRoute.Spec.Rules {
+		for _, filter := range rule.Filters {
+			warnf("the %s filter of rule %d is ignored", filter.Type, i)
+		}
+
+		to, alternates, port := httpRouteBackends(httpRoute.Namespace, rule.BackendRefs, func(format string, args ...interface{}) {
+			warnf("rule %d: "+format, append([]interface{}{i}, args...)...)
+		})
+		if to == nil {
+			warnf("rule %d has no service backend, it is ignored", i)
+			continue
+		}
+
+		paths := []string{"/"}
+		if len(rule.Matches) > 0 {
+			paths = nil
+		}
+		for _, match := range rule.Matches {
+			if len(match.Headers) > 0 || len(match.QueryParams) > 0 || match.Method != nil {
+				warnf("the header, query parameter and method matches of rule %d are ignored", i)
+			}
+			path, pathType := "/", "PathPrefix"
+			if match.Path != nil {
+				if match.Path.Value != nil {
+					path = *match.Path.Value
+				}
+				if match.Path.Type != nil {
+					pathType = *match.Path.Type
+				}
+			}
+			switch pathType {
+			case "PathPrefix":
+			case "Exact":
+				warnf("the exact path %s of rule %d is matched as a prefix by routes", path, i)
+			default:
+				warnf("the %s path %s of rule %d cannot be expressed by routes, it is ignored", pathType, path, i)
+				continue
+			}
+			paths = append(paths, path)
+		}
+
+		for _, host := range httpRoute.Spec.Hostnames {
+			for _, path := range paths {
+				route := &routev1.Route{
+					TypeMeta: metav1.TypeMeta{APIVersion: routev1.GroupVersion.String(), Kind: "Route"},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        routeName(httpRoute.Name, host, path),
+						Namespace:   httpRoute.Namespace,
+						Labels:      httpRoute.Labels,
+						Annotations: httpRoute.Annotations,
+					},
+					Spec: routev1.RouteSpec{
+						Host:              host,
+						Path:              path,
+						To:                *to,
+						AlternateBackends: alternates,
+						WildcardPolicy:    routev1.WildcardPolicyNone,
+					},
+				}
+				if path == "/" {
+					route.Spec.Path = ""
+				}
+				if port != nil {
+					route.Spec.Port = &routev1.RoutePort{TargetPort: intstr.FromInt(int(*port))}
+				}
+				if len(host) > 2 && host[:2] == "*." {
+					route.Spec.Host = "wildcard" + host[1:]
+					route.Spec.WildcardPolicy = routev1.WildcardPolicySubdomain
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	return routes, warnings
+}
+
+// httpRouteBackends returns the backends of a route for the backend refs of
+// an HTTPRoute rule, and the port of the backends if they share one.
+// Gateway API weights are scaled to the range of route weights if needed.
+func httpRouteBackends(namespace string, refs []HTTPBackendRef, warnf func(string, ...interface{})) (*routev1.RouteTargetReference, []routev1.RouteTargetReference, *int32) {
+	var backends []routev1.RouteTargetReference
+	ports := map[int32]bool{}
+	maxWeight := int32(0)
+	for _, ref := range refs {
+		if (ref.Group != nil && len(*ref.Group) > 0) || (ref.Kind != nil && *ref.Kind != "Service") {
+			warnf("backend %s is ignored, routes only route to services", ref.Name)
+			continue
+		}
+		if ref.Namespace != nil && *ref.Namespace != namespace {
+			warnf("backend %s/%s is ignored, routes only route to services of their namespace", *ref.Namespace, ref.Name)
+			continue
+		}
+		weight := int32(1)
+		if ref.Weight != nil {
+			weight = *ref.Weight
+		}
+		if weight > maxWeight {
+			maxWeight = weight
+		}
+		if ref.Port != nil {
+			ports[*ref.Port] = true
+		}
+		backends = append(backends, routev1.RouteTargetReference{Kind: "Service", Name: ref.Name, Weight: int32Ptr(weight)})
+	}
+	if len(backends) == 0 {
+		return nil, nil, nil
+	}
+
+	if maxWeight > maxRouteWeight {
+		warnf("backend weights are scaled to the range of route weights, 0-%d", maxRouteWeight)
+		for i := range backends {
+			weight := int64(*backends[i].Weight) * maxRouteWeight / int64(maxWeight)
+			if weight == 0 && *backends[i].Weight > 0 {
+				weight = 1
+			}
+			backends[i].Weight = int32Ptr(int32(weight))
+		}
+	}
+
+	var port *int32
+	switch len(ports) {
+	case 0:
+	case 1:
+		for p := range ports {
+			port = int32Ptr(p)
+		}
+		warnf("service port %d is used as the target port of the route, check that it matches the target port of the services", *port)
+	default:
+		warnf("backend ports are ignored, a route has a single target port for all its services")
+	}
+
+	if len(backends) > maxAlternateBackends+1 {
+		warnf("only the first %d backends are used, routes have at most %d alternate backends", maxAlternateBackends+1, maxAlternateBackends)
+		backends = backends[:maxAlternateBackends+1]
+	}
+	if len(backends) == 1 {
+		return &backends[0], nil, port
+	}
+	return &backends[0], backends[1:], port
+}
@@ -0,0 +1,137 @@
+package routeconvert
+
+import (
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// terminationAnnotation selects the TLS termination of the routes of an
+// ingress, like it does for the routes openshift creates for ingresses.
+const terminationAnnotation = "route.openshift.io/termination"
+
+// IngressToRoutes returns the routes equivalent to an ingress, one for each
+// host and path of its rules, and warnings about the parts of the ingress
+// routes cannot express or that depend on cluster state.
+func IngressToRoutes(ingress *networkingv1.Ingress) ([]*routev1.Route, []string) {
+	var routes []*routev1.Route
+	var warnings []string
+	warnf := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf("ingress %s/%s: ", ingress.Namespace, ingress.Name)+fmt.Sprintf(format, args...))
+	}
+
+	if ingress.Spec.DefaultBackend != nil {
+		warnf("the default backend is ignored, routes need a host")
+	}
+
+	termination := routev1.TLSTerminationEdge
+	if value, ok := ingress.Annotations[terminationAnnotation]; ok {
+		switch t := routev1.TLSTerminationType(value); t {
+		case routev1.TLSTerminationEdge, routev1.TLSTerminationPassthrough, routev1.TLSTerminationReencrypt:
+			termination = t
+		default:
+			warnf("unsupported %s annotation %q, using edge termination", terminationAnnotation, value)
+		}
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if len(rule.Host) == 0 {
+			warnf("rules without a host are ignored, routes need a host")
+			continue
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		secret, hasTLS := tlsSecretForHost(ingress, rule.Host)
+
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service == nil {
+				warnf("the resource backend of %s%s is ignored, routes only route to services", rule.Host, path.Path)
+				continue
+			}
+			if path.PathType != nil && *path.PathType == networkingv1.PathTypeExact {
+				warnf("the exact path %s of %s is matched as a prefix by routes", path.Path, rule.Host)
+			}
+
+			route := &routev1.Route{
+				TypeMeta: metav1.TypeMeta{APIVersion: routev1.GroupVersion.String(), Kind: "Route"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        routeName(ingress.Name, rule.Host, path.Path),
+					Namespace:   ingress.Namespace,
+					Labels:      ingress.Labels,
+					Annotations: ingress.Annotations,
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: networkingv1.SchemeGroupVersion.String(),
+						Kind:       "Ingress",
+						Name:       ingress.Name,
+						UID:        ingress.UID,
+						Controller: boolPtr(true),
+					}},
+				},
+				Spec: routev1.RouteSpec{
+					Host: rule.Host,
+					Path: path.Path,
+					To: routev1.RouteTargetReference{
+						Kind:   "Service",
+						Name:   path.Backend.Service.Name,
+						Weight: int32Ptr(100),
+					},
+					WildcardPolicy: routev1.WildcardPolicyNone,
+				},
+			}
+
+			port := path.Backend.Service.Port
+			if len(port.Name) > 0 {
+				route.Spec.Port = &routev1.RoutePort{TargetPort: intstr.FromString(port.Name)}
+			} else if port.Number > 0 {
+				route.Spec.Port = &routev1.RoutePort{TargetPort: intstr.FromInt(int(port.Number))}
+				warnf("service port %d of %s is used as the target port of the route, check that it matches the target port of the service", port.Number, path.Backend.Service.Name)
+			}
+
+			if hasTLS {
+				route.Spec.TLS = &routev1.TLSConfig{
+					Termination:                   termination,
+					InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+				}
+				if termination == routev1.TLSTerminationPassthrough {
+					route.Spec.TLS.InsecureEdgeTerminationPolicy = routev1.InsecureEdgeTerminationPolicyNone
+					if len(route.Spec.Path) > 0 && route.Spec.Path != "/" {
+						warnf("the path %s of %s is dropped, passthrough routes cannot match paths", path.Path, rule.Host)
+					}
+					route.Spec.Path = ""
+				} else if len(secret) > 0 {
+					warnf("the certificate of secret %s is not copied to the route of %s, the router serves its default certificate until it is added", secret, rule.Host)
+				}
+			}
+
+			routes = append(routes, route)
+		}
+	}
+
+	return routes, warnings
+}
+
+// tlsSecretForHost returns the TLS secret of the ingress for host, and
+// whether the ingress terminates TLS for host.
+func tlsSecretForHost(ingress *networkingv1.Ingress, host string) (string, bool) {
+	for _, tls := range ingress.Spec.TLS {
+		for _, h := range tls.Hosts {
+			if h == host {
+				return tls.SecretName, true
+			}
+		}
+	}
+	return "", false
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
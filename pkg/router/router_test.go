@@ -25,6 +25,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 
 	kubefake "k8s.io/client-go/kubernetes/fake"
@@ -33,10 +34,12 @@ import (
 
 	haproxyconfparser "github.com/haproxytech/config-parser/v4"
 	haproxyconfparseroptions "github.com/haproxytech/config-parser/v4/options"
+	haproxyconfparserparams "github.com/haproxytech/config-parser/v4/params"
 	haproxyconfparsertypes "github.com/haproxytech/config-parser/v4/types"
 	routercmd "github.com/openshift/router/pkg/cmd/infra/router"
 	"github.com/openshift/router/pkg/router"
 	"github.com/openshift/router/pkg/router/controller"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 	templateplugin "github.com/openshift/router/pkg/router/template"
 	"github.com/openshift/router/pkg/router/writerlease"
 )
@@ -109,11 +112,12 @@ func TestMain(m *testing.M) {
 	// The template plugin which is wrapped
 	svcFetcher := templateplugin.NewListWatchServiceLookup(client.CoreV1(), 60*time.Second, namespace)
 	pluginCfg := templateplugin.TemplatePluginConfig{
-		WorkingDir:            workdir,
-		DefaultCertificateDir: workdir,
-		ReloadFn:              func(shutdown bool) error { return nil },
-		TemplatePath:          "../../images/router/haproxy/conf/haproxy-config.template",
-		ReloadInterval:        reloadInterval,
+		WorkingDir:              workdir,
+		DefaultCertificateDir:   workdir,
+		ReloadFn:                func(shutdown bool) error { return nil },
+		TemplatePath:            "../../images/router/haproxy/conf/haproxy-config.template",
+		ReloadInterval:          reloadInterval,
+		ConfigSnippetDirectives: sets.NewString("http-response"),
 	}
 	plugin, err = templateplugin.NewTemplatePlugin(pluginCfg, svcFetcher)
 	if err != nil {
@@ -125,6 +129,7 @@ func TestMain(m *testing.M) {
 	// Wrap the template plugin with other stuff
 	statusPlugin := controller.NewStatusAdmitter(plugin, routeClient.RouteV1(), routeLister, "default", "example.com", lease, tracker)
 	plugin = statusPlugin
+	plugin = controller.NewTCPPortAllocator(plugin, routeapihelpers.PortRange{Min: 10000, Max: 10099}, nil, statusPlugin)
 	plugin = controller.NewUniqueHost(plugin, routerSelection.DisableNamespaceOwnershipCheck, statusPlugin)
 	plugin = controller.NewHostAdmitter(plugin, routerSelection.RouteAdmissionFunc(), false, false, statusPlugin)
 
@@ -240,7 +245,46 @@ func TestConfigTemplate(t *testing.T) {
 					section:     "backend",
 					sectionName: edgeBackendName(h.namespace, "a1"),
 					attribute:   "acl",
-					value:       "whitelist src 192.168.1.0 2001:0db8:85a3:0000:0000:8a2e:0370:7334 172.16.14.10/24 2001:0db8:85a3::8a2e:370:10/64 64:ff9b::192.168.0.1 2600:14a0::/40",
+					value:       "whitelist src -f " + filepath.Join(h.workdir, "router", "whitelists", h.namespace+":a1.txt"),
+				},
+			},
+		},
+		"Client concurrent connections": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "cc",
+					host: "ccexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/client-concurrent-connections": "5",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "cc"),
+					attribute:   "tcp-request",
+					value:       "content reject if { src_conn_cur(client_connections) gt 5 }",
+				},
+			},
+		},
+		"TCP route on a dedicated port": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "tcp",
+					host: "tcpexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/tcp-port": "10050",
+					},
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "frontend",
+					sectionName: "fe_tcp_port:" + h.namespace + ":tcp",
+					attribute:   "default_backend",
+					value:       "be_tcp_port:" + h.namespace + ":tcp",
 				},
 			},
 		},
@@ -408,6 +452,150 @@ func TestConfigTemplate(t *testing.T) {
 				},
 			},
 		},
+		"Backend TCP options": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "l",
+					host: "lexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/timeout-connect": "3s",
+						"haproxy.router.openshift.io/timeout-queue":   "500",
+						"haproxy.router.openshift.io/tcp-keepalive":   "true",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "l"),
+					attribute:   "timeout connect",
+					value:       "3000ms",
+				},
+			},
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "m",
+					host: "mexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/timeout-connect": "3s",
+						"haproxy.router.openshift.io/timeout-queue":   "500",
+						"haproxy.router.openshift.io/tcp-keepalive":   "true",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "m"),
+					attribute:   "timeout queue",
+					value:       "500ms",
+				},
+			},
+		},
+		"URI normalizers": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "n",
+					host: "nexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/normalize-uri": "path-merge-slashes,path-strip-dotdot full",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "n"),
+					attribute:   "",
+					value:       "http-request normalize-uri path-strip-dotdot full",
+				},
+			},
+		},
+		"Tracing headers": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "o",
+					host: "oexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/request-id-header": "X-Request-ID",
+						"haproxy.router.openshift.io/trace-context":     "true",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "o"),
+					attribute:   "http-request",
+					value:       "set-header X-Request-ID %[uuid] unless { req.hdr(X-Request-ID) -m found }",
+				},
+			},
+		},
+		"Server options shared through default-server": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "p",
+					host: "pexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/pod-concurrent-connections": "20",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "p"),
+					attribute:   "default-server",
+					value:       "maxconn 20",
+				},
+			},
+		},
+		"Config snippet": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "j",
+					host: "jexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/backend-config-snippet": "# snippet\nhttp-response set-header X-Snippet yes",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "j"),
+					attribute:   "http-response",
+					value:       "set-header X-Snippet yes",
+				},
+			},
+		},
+		"Config snippet with a directive that is not allowed": {
+			mustCreateWithConfig{
+				mustCreate: mustCreate{
+					name: "k",
+					host: "kexample.com",
+					path: "",
+					time: start,
+					annotations: map[string]string{
+						"haproxy.router.openshift.io/backend-config-snippet": "http-response set-header X-Snippet yes\nhttp-request set-header X-Snippet yes",
+					},
+					tlsTermination: routev1.TLSTerminationEdge,
+				},
+				mustMatchConfig: mustMatchConfig{
+					section:     "backend",
+					sectionName: edgeBackendName(h.namespace, "k"),
+					attribute:   "http-response",
+					value:       "set-header X-Snippet yes",
+					notFound:    true,
+				},
+			},
+		},
 	}
 
 	defer cleanUpRoutes(t)
@@ -538,6 +726,32 @@ func (m mustMatchConfig) Match(parser haproxyconfparser.Parser) error {
 				break
 			}
 		}
+	case []haproxyconfparsertypes.TCPType:
+		for _, a := range data {
+			if a.String() == m.value {
+				contains = true
+				break
+			}
+		}
+	case *haproxyconfparsertypes.StringC:
+		contains = data.Value == m.value
+	case *haproxyconfparsertypes.SimpleTimeout:
+		contains = data.Value == m.value
+	case []haproxyconfparsertypes.DefaultServer:
+		for _, a := range data {
+			if haproxyconfparserparams.ServerOptionsString(a.Params) == m.value {
+				contains = true
+				break
+			}
+		}
+	case []haproxyconfparsertypes.UnProcessed:
+		// Lines the parser does not know, matched in full.
+		for _, a := range data {
+			if a.Value == m.value {
+				contains = true
+				break
+			}
+		}
 	}
 
 	if !contains && !m.notFound {
@@ -0,0 +1,86 @@
+package shutdown
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	logf "github.com/openshift/router/log"
+)
+
+var log = logf.Logger.WithName("shutdown")
+
+// Phase is a step of the graceful shutdown of the router.
+type Phase struct {
+	// Name identifies the phase in logs and metrics.
+	Name string
+	// Action is invoked when the phase starts.  It may be nil.
+	Action func() error
+	// Delay is how long to wait after Action before the next phase starts.
+	Delay time.Duration
+}
+
+// Coordinator runs the phases of a graceful shutdown in order and records
+// how long each of them took.
+type Coordinator struct {
+	phases []Phase
+
+	// sleep allows the coordinator to be tested.
+	sleep func(time.Duration)
+
+	metricPhase         *prometheus.GaugeVec
+	metricPhaseDuration *prometheus.GaugeVec
+}
+
+// NewCoordinator returns a Coordinator without phases whose metrics are
+// registered with registerer.
+func NewCoordinator(registerer prometheus.Registerer) *Coordinator {
+	c := &Coordinator{
+		sleep: time.Sleep,
+		metricPhase: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "shutdown_phase",
+			Help:      "Set to 1 for the shutdown phase the router is in.",
+		}, []string{"phase"}),
+		metricPhaseDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "shutdown_phase_duration_seconds",
+			Help:      "Time spent in each completed shutdown phase in seconds.",
+		}, []string{"phase"}),
+	}
+	registerer.MustRegister(c.metricPhase, c.metricPhaseDuration)
+	return c
+}
+
+// AddPhase appends a phase to the shutdown sequence.
+func (c *Coordinator) AddPhase(phase Phase) {
+	c.phases = append(c.phases, phase)
+}
+
+// Run runs every phase in order.  A phase whose action fails is logged and
+// the sequence continues so that the router always terminates; the first
+// error is returned.
+func (c *Coordinator) Run() error {
+	var result error
+	for _, phase := range c.phases {
+		log.V(0).Info("starting shutdown phase", "phase", phase.Name, "delay", phase.Delay.String())
+		c.metricPhase.WithLabelValues(phase.Name).Set(1)
+		start := time.Now()
+
+		if phase.Action != nil {
+			if err := phase.Action(); err != nil {
+				log.Error(err, "shutdown phase failed", "phase", phase.Name)
+				if result == nil {
+					result = err
+				}
+			}
+		}
+		if phase.Delay > 0 {
+			c.sleep(phase.Delay)
+		}
+
+		c.metricPhase.WithLabelValues(phase.Name).Set(0)
+		c.metricPhaseDuration.WithLabelValues(phase.Name).Set(time.Since(start).Seconds())
+	}
+	return result
+}
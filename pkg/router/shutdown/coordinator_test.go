@@ -0,0 +1,46 @@
+package shutdown
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCoordinatorRun(t *testing.T) {
+	var events []string
+	c := NewCoordinator(prometheus.NewRegistry())
+	c.sleep = func(d time.Duration) {
+		events = append(events, fmt.Sprintf("sleep %s", d))
+	}
+
+	action := func(name string, err error) func() error {
+		return func() error {
+			events = append(events, name)
+			return err
+		}
+	}
+	c.AddPhase(Phase{Name: "stop-route-updates", Action: action("stop-route-updates", nil)})
+	c.AddPhase(Phase{Name: "deregister", Delay: 45 * time.Second})
+	c.AddPhase(Phase{Name: "drain", Action: action("drain", fmt.Errorf("drain failed"))})
+	c.AddPhase(Phase{Name: "settle", Action: action("settle", fmt.Errorf("settle failed")), Delay: time.Second})
+
+	err := c.Run()
+	if err == nil || err.Error() != "drain failed" {
+		t.Fatalf("expected the first error to be returned, got %v", err)
+	}
+
+	expected := []string{"stop-route-updates", "sleep 45s", "drain", "settle", "sleep 1s"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+
+	for _, phase := range []string{"stop-route-updates", "deregister", "drain", "settle"} {
+		if v := testutil.ToFloat64(c.metricPhase.WithLabelValues(phase)); v != 0 {
+			t.Errorf("expected phase %q to be inactive after shutdown, got %v", phase, v)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package telemetry exports the operational telemetry of the router, the
+// durations of its commits and reloads and the handling of the events of
+// the plugin chain, as OpenTelemetry traces and metrics.  Nothing is exported
+// until StartOTLP installs an exporter.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/unit"
+	"google.golang.org/grpc/credentials"
+
+	logf "github.com/openshift/router/log"
+)
+
+var log = logf.Logger.WithName("telemetry")
+
+const (
+	// instrumentationName names the tracer and meter of the router.
+	instrumentationName = "github.com/openshift/router"
+
+	// serviceName is the service the telemetry of the router is
+	// exported for.
+	serviceName = "openshift-router"
+)
+
+// The exporters the telemetry of the router can be selected from.
+const (
+	// ExporterPrometheus serves the metrics of the router at /metrics.
+	ExporterPrometheus = "prometheus"
+	// ExporterOTLP pushes the traces and metrics of the router to an
+	// OpenTelemetry collector.
+	ExporterOTLP = "otlp"
+)
+
+// Exporters are the exporters the telemetry of the router can be selected
+// from.
+var Exporters = []string{ExporterPrometheus, ExporterOTLP}
+
+// OTLPConfig configures the export of the telemetry of the router to an
+// OpenTelemetry collector.
+type OTLPConfig struct {
+	// Endpoint is the host and port of the gRPC OTLP receiver of the
+	// collector.
+	Endpoint string
+	// Insecure disables TLS to the collector.
+	Insecure bool
+	// CAFile is the CA bundle the certificate of the collector is
+	// verified with, the system roots if empty.
+	CAFile string
+	// Interval is how often the metrics are pushed.
+	Interval time.Duration
+	// RouterName and RouterNamespace identify the router in the
+	// exported telemetry.
+	RouterName      string
+	RouterNamespace string
+}
+
+// StartOTLP installs an exporter pushing the traces and metrics of the router
+// to the collector of config, and returns a function that flushes and stops
+// it.
+func StartOTLP(ctx context.Context, config OTLPConfig) (func(context.Context) error, error) {
+	if len(config.Endpoint) == 0 {
+		return nil, fmt.Errorf("an OTLP endpoint is required")
+	}
+	if config.Interval <= 0 {
+		return nil, fmt.Errorf("the OTLP export interval must be positive")
+	}
+
+	options := []otlpgrpc.Option{otlpgrpc.WithEndpoint(config.Endpoint)}
+	switch {
+	case config.Insecure:
+		options = append(options, otlpgrpc.WithInsecure())
+	case len(config.CAFile) > 0:
+		creds, err := credentials.NewClientTLSFromFile(config.CAFile, "")
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the OTLP CA bundle: %v", err)
+		}
+		options = append(options, otlpgrpc.WithTLSCredentials(creds))
+	default:
+		options = append(options, otlpgrpc.WithTLSCredentials(credentials.NewClientTLSFromCert(nil, "")))
+	}
+
+	// The exporter connects in the background, so that the router starts
+	// while the collector is unavailable.
+	exporter, err := otlp.NewExporter(ctx, otlpgrpc.NewDriver(options...))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the OTLP exporter: %v", err)
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceInstanceIDKey.String(config.RouterNamespace+"/"+config.RouterName),
+	)
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	controller := basic.New(
+		processor.New(simple.NewWithInexpensiveDistribution(), exporter),
+		basic.WithExporter(exporter),
+		basic.WithResource(res),
+		basic.WithCollectPeriod(config.Interval),
+	)
+	if err := controller.Start(ctx); err != nil {
+		tracerProvider.Shutdown(ctx)
+		exporter.Shutdown(ctx)
+		return nil, fmt.Errorf("unable to start the OTLP metrics export: %v", err)
+	}
+	otel.SetTracerProvider(tracerProvider)
+	global.SetMeterProvider(controller.MeterProvider())
+	log.V(0).Info("exporting telemetry over OTLP", "endpoint", config.Endpoint, "interval", config.Interval.String())
+
+	return func(ctx context.Context) error {
+		var errs []error
+		if err := controller.Stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if err := exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("unable to stop the OTLP export: %v", errs)
+		}
+		return nil
+	}, nil
+}
+
+var (
+	meter = metric.Must(global.Meter(instrumentationName))
+
+	writeConfigDuration = meter.NewFloat64ValueRecorder("router.config.write.duration",
+		metric.WithDescription("How long writing the configuration of the router took."),
+		metric.WithUnit(unit.Milliseconds))
+	reloadDuration = meter.NewFloat64ValueRecorder("router.reload.duration",
+		metric.WithDescription("How long reloading haproxy took."),
+		metric.WithUnit(unit.Milliseconds))
+	eventDuration = meter.NewFloat64ValueRecorder("router.event.duration",
+		metric.WithDescription("How long the plugin chain took to handle an event."),
+		metric.WithUnit(unit.Milliseconds))
+)
+
+// Span is an operation of the router being traced and measured.
+type Span struct {
+	span     trace.Span
+	start    time.Time
+	recorder metric.Float64ValueRecorder
+	attrs    []attribute.KeyValue
+}
+
+// start starts a span named name, whose duration is recorded by recorder.
+func start(name string, recorder metric.Float64ValueRecorder, attrs ...attribute.KeyValue) *Span {
+	_, span := otel.Tracer(instrumentationName).Start(context.Background(), name, trace.WithAttributes(attrs...))
+	return &Span{span: span, start: time.Now(), recorder: recorder, attrs: attrs}
+}
+
+// StartWriteConfig starts the span of a write of the configuration of the
+// router.
+func StartWriteConfig() *Span {
+	return start("router.WriteConfig", writeConfigDuration)
+}
+
+// StartReload starts the span of a reload of haproxy for the given reasons.
+func StartReload(reasons []string) *Span {
+	return start("router.Reload", reloadDuration, attribute.Array("router.reload.reasons", reasons))
+}
+
+// StartEvent starts the span of the plugin chain handling an event of kind
+// on the named object.
+func StartEvent(kind, eventType, namespace, name string) *Span {
+	return start("router.Handle"+kind, eventDuration,
+		attribute.String("router.event.kind", kind),
+		attribute.String("router.event.type", eventType),
+		attribute.String("k8s.namespace.name", namespace),
+		attribute.String("router.object.name", name),
+	)
+}
+
+// End ends the span and records its duration, marking it failed if err is
+// set.
+func (s *Span) End(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+
+	// The name of the object is only part of the span, as it would give
+	// the metric one series per object.
+	labels := []attribute.KeyValue{attribute.String("result", result)}
+	for _, attr := range s.attrs {
+		if attr.Key == "router.event.kind" || attr.Key == "router.event.type" {
+			labels = append(labels, attr)
+		}
+	}
+	s.recorder.Record(context.Background(), float64(time.Since(s.start))/float64(time.Millisecond), labels...)
+}
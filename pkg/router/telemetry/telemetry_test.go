@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric/global"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// recordingExporter records the spans it exports.
+type recordingExporter struct {
+	spans []*sdktrace.SpanSnapshot
+}
+
+func (e *recordingExporter) ExportSpans(ctx context.Context, spans []*sdktrace.SpanSnapshot) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestSpans(t *testing.T) {
+	exporter := &recordingExporter{}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	controller := basic.New(processor.New(simple.NewWithExactDistribution(), export.CumulativeExportKindSelector()))
+	global.SetMeterProvider(controller.MeterProvider())
+
+	StartEvent("Route", "ADDED", "ns", "web").End(nil)
+	StartReload([]string{"route-added"}).End(fmt.Errorf("haproxy failed"))
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exporter.spans))
+	}
+	event, reload := exporter.spans[0], exporter.spans[1]
+	if event.Name != "router.HandleRoute" || event.StatusCode == codes.Error {
+		t.Errorf("unexpected event span %q with status %v", event.Name, event.StatusCode)
+	}
+	attrs := map[string]string{}
+	for _, attr := range event.Attributes {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["k8s.namespace.name"] != "ns" || attrs["router.object.name"] != "web" || attrs["router.event.type"] != "ADDED" {
+		t.Errorf("unexpected event span attributes %v", attrs)
+	}
+	if reload.Name != "router.Reload" || reload.StatusCode != codes.Error || reload.StatusMessage != "haproxy failed" {
+		t.Errorf("expected the reload span to be failed, got %q with status %v %q", reload.Name, reload.StatusCode, reload.StatusMessage)
+	}
+
+	if err := controller.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	recorded := map[string]bool{}
+	if err := controller.ForEach(export.CumulativeExportKindSelector(), func(record export.Record) error {
+		recorded[record.Descriptor().Name()] = true
+		for _, label := range record.Labels().ToSlice() {
+			if label.Key == "router.object.name" {
+				t.Errorf("expected the object name not to be a metric label")
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"router.event.duration", "router.reload.duration"} {
+		if !recorded[name] {
+			t.Errorf("expected %s to be recorded, got %v", name, recorded)
+		}
+	}
+}
+
+func TestStartOTLPValidation(t *testing.T) {
+	if _, err := StartOTLP(context.Background(), OTLPConfig{Interval: time.Minute}); err == nil {
+		t.Errorf("expected an error without an endpoint")
+	}
+	if _, err := StartOTLP(context.Background(), OTLPConfig{Endpoint: "collector:4317"}); err == nil {
+		t.Errorf("expected an error without an interval")
+	}
+	if _, err := StartOTLP(context.Background(), OTLPConfig{Endpoint: "collector:4317", Interval: time.Minute, CAFile: "/nonexistent"}); err == nil {
+		t.Errorf("expected an error for a missing CA bundle")
+	}
+}
@@ -0,0 +1,104 @@
+package templaterouter
+
+import (
+	"fmt"
+	"time"
+
+	utilwait "k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+// activationScheduler puts the routes in and out of maintenance as their
+// activation windows open and close.
+type activationScheduler struct {
+	// interval is how often the windows are checked.
+	interval time.Duration
+
+	now func() time.Time
+}
+
+func newActivationScheduler(interval time.Duration) *activationScheduler {
+	return &activationScheduler{interval: interval, now: time.Now}
+}
+
+// inMaintenance returns whether a route with the given annotations is in
+// maintenance now.  Invalid windows are ignored.
+func (s *activationScheduler) inMaintenance(annotations map[string]string) bool {
+	_, hasActive := annotations[routeapihelpers.ActiveWindowsAnnotation]
+	_, hasMaintenance := annotations[routeapihelpers.MaintenanceWindowsAnnotation]
+	if !hasActive && !hasMaintenance {
+		return false
+	}
+	windows, errs := routeapihelpers.ParseActivationWindows(annotations)
+	if len(errs) > 0 {
+		return false
+	}
+	return windows.InMaintenance(s.now())
+}
+
+// RunActivationScheduler checks the activation windows of the routes every
+// interval until stopCh is closed, and puts the routes in and out of
+// maintenance as their windows open and close.
+func (r *templateRouter) RunActivationScheduler(stopCh <-chan struct{}) error {
+	if r.activation == nil {
+		return fmt.Errorf("activation windows are not enabled")
+	}
+	go utilwait.Until(func() {
+		if r.updateMaintenance() > 0 {
+			r.Commit()
+		}
+	}, r.activation.interval, stopCh)
+	return nil
+}
+
+// updateMaintenance puts the routes whose activation windows opened or
+// closed since they were last checked in or out of maintenance, and returns
+// how many it changed.  The servers of the routes are disabled or enabled
+// through the dynamic config manager if possible, the configuration is
+// otherwise reloaded.
+func (r *templateRouter) updateMaintenance() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// The initial sync sets the maintenance of the routes it commits.
+	if !r.synced {
+		return 0
+	}
+
+	changed := 0
+	for key, cfg := range r.state {
+		maintenance := r.activation.inMaintenance(cfg.Annotations)
+		if maintenance == cfg.Maintenance {
+			continue
+		}
+		if maintenance {
+			log.V(0).Info("route entering maintenance", "namespace", cfg.Namespace, "name", cfg.Name)
+		} else {
+			log.V(0).Info("route leaving maintenance", "namespace", cfg.Namespace, "name", cfg.Name)
+		}
+		cfg.Maintenance = maintenance
+		r.state[key] = cfg
+		r.stateChanged = true
+		r.recordReloadReason(ReloadReasonMaintenance, fmt.Sprintf("route/%s/%s", cfg.Namespace, cfg.Name))
+		if !r.dynamicallySetMaintenance(key, maintenance) {
+			r.dynamicallyConfigured = false
+		}
+		changed++
+	}
+	return changed
+}
+
+// dynamicallySetMaintenance disables or enables the servers of a route with
+// the dynamic config manager.  Returns true if the change was applied.
+// Must be called while holding r.lock
+func (r *templateRouter) dynamicallySetMaintenance(backendKey ServiceAliasConfigKey, maintenance bool) bool {
+	if r.dynamicConfigManager == nil {
+		return false
+	}
+	if err := r.dynamicConfigManager.SetRouteMaintenance(backendKey, maintenance); err != nil {
+		log.V(4).Info("router will reload as the ConfigManager could not dynamically change the route maintenance", "backendKey", backendKey, "error", err)
+		return false
+	}
+	return true
+}
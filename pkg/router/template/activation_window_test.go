@@ -0,0 +1,166 @@
+package templaterouter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+// TestUpdateMaintenance tests that routes are put in and out of maintenance
+// as their windows open and close, without a reload if the dynamic config
+// manager applies the change.
+func TestUpdateMaintenance(t *testing.T) {
+	// Wednesday, an hour before the maintenance window.
+	now := time.Date(2026, 7, 15, 1, 0, 0, 0, time.UTC)
+	cm := &whitelistConfigManager{whitelists: map[string][]string{}, maintenance: map[ServiceAliasConfigKey]bool{}}
+	router := NewFakeTemplateRouter()
+	router.activation = newActivationScheduler(time.Minute)
+	router.activation.now = func() time.Time { return now }
+	router.dynamicConfigManager = cm
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "foo",
+			Name:        "bar",
+			Annotations: map[string]string{routeapihelpers.MaintenanceWindowsAnnotation: "0 2 * * 3 1h"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "host",
+			To:   routev1.RouteTargetReference{Name: "TestService"},
+		},
+	}
+	other := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "other"},
+		Spec: routev1.RouteSpec{
+			Host: "other",
+			To:   routev1.RouteTargetReference{Name: "TestService"},
+		},
+	}
+	router.AddRoute(route)
+	router.AddRoute(other)
+	key := routeKey(route)
+
+	if n := router.updateMaintenance(); n != 0 {
+		t.Fatalf("expected no change before the initial sync, got %d", n)
+	}
+	router.synced = true
+	router.stateChanged = false
+	router.dynamicallyConfigured = true
+
+	if n := router.updateMaintenance(); n != 0 || router.state[key].Maintenance {
+		t.Fatalf("expected the route not to be in maintenance before its window, got %d changes", n)
+	}
+
+	now = now.Add(time.Hour)
+	if n := router.updateMaintenance(); n != 1 || !router.state[key].Maintenance {
+		t.Fatalf("expected the route to enter maintenance, got %d changes", n)
+	}
+	if !cm.maintenance[key] {
+		t.Errorf("expected the servers to be disabled dynamically, got %v", cm.maintenance)
+	}
+	if !router.stateChanged || !router.dynamicallyConfigured {
+		t.Errorf("expected the change to be written without a reload")
+	}
+	if n := router.updateMaintenance(); n != 0 {
+		t.Errorf("expected no change within the window, got %d", n)
+	}
+
+	// A route updated within its window is still in maintenance.
+	updated := route.DeepCopy()
+	updated.Spec.Host = "updated"
+	router.AddRoute(updated)
+	if !router.state[key].Maintenance {
+		t.Errorf("expected the updated route to be in maintenance")
+	}
+
+	now = now.Add(time.Hour)
+	cm.err = fmt.Errorf("reload in progress")
+	router.dynamicallyConfigured = true
+	if n := router.updateMaintenance(); n != 1 || router.state[key].Maintenance {
+		t.Fatalf("expected the route to leave maintenance, got %d changes", n)
+	}
+	if router.dynamicallyConfigured {
+		t.Errorf("expected a reload when the dynamic config manager fails")
+	}
+	if router.state[routeKey(other)].Maintenance {
+		t.Errorf("expected a route without windows never to be in maintenance")
+	}
+}
+
+// TestMaintenanceTemplate tests that the servers of a route in maintenance
+// are disabled, so that haproxy starts with them in maintenance.
+func TestMaintenanceTemplate(t *testing.T) {
+	routes := []*routev1.Route{}
+	for _, name := range []string{"maint", "plain"} {
+		routes = append(routes, &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Spec: routev1.RouteSpec{
+				Host: name + ".example.com",
+				To:   routev1.RouteTargetReference{Name: "svc"},
+			},
+		})
+	}
+
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	state := renderer.RouteState(routes)
+	key := routeKey(routes[0])
+	cfg := state.Routes[key]
+	cfg.Maintenance = true
+	state.Routes[key] = cfg
+	renderer.AddEndpoints(state, &kapi.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "svc"},
+		Subsets: []kapi.EndpointSubset{{
+			Addresses: []kapi.EndpointAddress{{IP: "10.128.0.5"}},
+			Ports:     []kapi.EndpointPort{{Port: 8080}},
+		}},
+	}, false, nil)
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	var config string
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" {
+			config = string(file.Contents)
+		}
+	}
+
+	for name, disabled := range map[string]bool{"maint": true, "plain": false} {
+		backend := "backend be_http:ns:" + name + "\n"
+		i := strings.Index(config, backend)
+		if i < 0 {
+			t.Fatalf("%s not found", backend)
+		}
+		section := config[i+1:]
+		if j := strings.Index(section, "\nbackend "); j >= 0 {
+			section = section[:j]
+		}
+		found := false
+		for _, line := range strings.Split(section, "\n") {
+			if !strings.HasPrefix(line, "  server ") {
+				continue
+			}
+			found = true
+			if strings.HasSuffix(line, " disabled") != disabled {
+				t.Errorf("%s: expected disabled %t, got %q", name, disabled, line)
+			}
+		}
+		if !found {
+			t.Errorf("%s: no server found", name)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package templaterouter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+const (
+	// backendStabilityPollInterval is how often the server states of the
+	// backends are read from haproxy.
+	backendStabilityPollInterval = 30 * time.Second
+
+	// defaultHealthCheckInterval is the health check interval of routes
+	// that do not set one, when ROUTER_BACKEND_CHECK_INTERVAL is not set.
+	defaultHealthCheckInterval = 5 * time.Second
+
+	// The columns of the "show stat" output that describe servers.
+	statProxyNameField = 0
+	statStatusField    = 17
+	statTypeField      = 32
+	statServerType     = "2"
+)
+
+// backendStability tracks how long the servers of each backend have been
+// continuously healthy, as reported by the haproxy health checks.
+type backendStability struct {
+	lock sync.Mutex
+	// healthySince is when the servers of each backend were first seen
+	// healthy since their last failure.
+	healthySince map[ServiceAliasConfigKey]time.Time
+
+	// now allows the stability to be tested.
+	now func() time.Time
+}
+
+func newBackendStability() *backendStability {
+	return &backendStability{healthySince: map[ServiceAliasConfigKey]time.Time{}, now: time.Now}
+}
+
+// update records the server states of the "show stat" output of haproxy.
+// Backends with a failing server become unstable, backends that are not in
+// the output are forgotten.
+func (s *backendStability) update(stats io.Reader) error {
+	reader := csv.NewReader(stats)
+	reader.TrailingComma = true
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	healthy := map[ServiceAliasConfigKey]bool{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read the haproxy stats: %v", err)
+		}
+		if len(row) <= statTypeField || row[statTypeField] != statServerType {
+			continue
+		}
+		// Route backends are named <type>:<namespace>:<name>.
+		proxy := row[statProxyNameField]
+		i := strings.Index(proxy, ":")
+		if !strings.HasPrefix(proxy, "be_") || i < 0 {
+			continue
+		}
+		key := ServiceAliasConfigKey(proxy[i+1:])
+		if _, ok := healthy[key]; !ok {
+			healthy[key] = true
+		}
+		// Servers going down report "UP 1/3" until they reach the fall
+		// threshold, servers without checks or in maintenance do not
+		// tell anything about the stability of the backend.
+		status := row[statStatusField]
+		if strings.HasPrefix(status, "DOWN") || strings.HasPrefix(status, "UP ") {
+			healthy[key] = false
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.now()
+	for key := range s.healthySince {
+		if !healthy[key] {
+			delete(s.healthySince, key)
+		}
+	}
+	for key, ok := range healthy {
+		if _, seen := s.healthySince[key]; ok && !seen {
+			s.healthySince[key] = now
+		}
+	}
+	return nil
+}
+
+// healthyFor returns how long the servers of a backend have been healthy.
+func (s *backendStability) healthyFor(key ServiceAliasConfigKey) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	since, ok := s.healthySince[key]
+	if !ok {
+		return 0
+	}
+	return s.now().Sub(since)
+}
+
+// adaptiveHealthCheckInterval returns the health check interval of a
+// backend that has been healthy for the given time: the base interval
+// doubles for every stable period, up to the maximum interval.
+func adaptiveHealthCheckInterval(base, maxInterval, healthy, stablePeriod time.Duration) time.Duration {
+	if stablePeriod <= 0 {
+		return base
+	}
+	interval := base
+	for periods := healthy / stablePeriod; periods > 0 && interval < maxInterval; periods-- {
+		interval *= 2
+	}
+	if interval > maxInterval && maxInterval > base {
+		return maxInterval
+	}
+	return interval
+}
+
+// healthCheckIntervals returns the adaptive health check intervals of the
+// backends with health checks whose interval exceeds their base interval.
+// haproxy checks servers at the base interval again as soon as a check
+// fails, and the backend is back to its base interval from the next
+// configuration written after the failure.
+func (r *templateRouter) healthCheckIntervals() map[ServiceAliasConfigKey]string {
+	if r.backendStability == nil {
+		return nil
+	}
+
+	defaultInterval := defaultHealthCheckInterval
+	if interval, err := routeapihelpers.ParseHAProxyTimeout(os.Getenv("ROUTER_BACKEND_CHECK_INTERVAL")); err == nil {
+		defaultInterval = interval
+	}
+
+	intervals := map[ServiceAliasConfigKey]string{}
+	for key, cfg := range r.state {
+		if cfg.ActiveEndpoints <= 1 {
+			continue
+		}
+		base := defaultInterval
+		if interval, err := routeapihelpers.ParseHAProxyTimeout(cfg.Annotations[routeapihelpers.HealthCheckIntervalAnnotation]); err == nil {
+			base = interval
+		}
+		maxInterval := r.adaptiveHealthChecks.MaxInterval
+		if cfg.HealthCheckMaxInterval > 0 {
+			maxInterval = cfg.HealthCheckMaxInterval
+		}
+		interval := adaptiveHealthCheckInterval(base, maxInterval, r.backendStability.healthyFor(key), r.adaptiveHealthChecks.StablePeriod)
+		if interval > base {
+			intervals[key] = fmt.Sprintf("%dms", interval.Milliseconds())
+		}
+	}
+	return intervals
+}
+
+// RunBackendStabilityTracking reads the server states of the backends from
+// haproxy until stopCh is closed, so that the health check intervals of
+// stable backends grow.
+func (r *templateRouter) RunBackendStabilityTracking(stopCh <-chan struct{}) error {
+	if r.backendStability == nil {
+		return fmt.Errorf("adaptive health checks are not enabled")
+	}
+	cli := newMasterCLI(filepath.Join(r.dir, statsSocketFile))
+	go func() {
+		ticker := time.NewTicker(backendStabilityPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				out, err := cli.execute("show stat")
+				if err == errMasterNotRunning {
+					continue
+				}
+				if err == nil {
+					err = r.backendStability.update(strings.NewReader(out))
+				}
+				if err != nil {
+					log.Error(err, "failed to track the stability of the backends")
+				}
+			}
+		}
+	}()
+	return nil
+}
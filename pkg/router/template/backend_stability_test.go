@@ -0,0 +1,244 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// showStat returns "show stat" output with a row per server, in the given
+// backend and with the given status.
+func showStat(servers ...[2]string) string {
+	lines := []string{"# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type,"}
+	for i, server := range servers {
+		row := make([]string, 33)
+		row[statProxyNameField] = server[0]
+		row[1] = "pod:" + string(rune('a'+i))
+		row[statStatusField] = server[1]
+		row[statTypeField] = statServerType
+		lines = append(lines, strings.Join(row, ",")+",")
+	}
+	// Frontends and backends themselves are ignored.
+	frontend := make([]string, 33)
+	frontend[statProxyNameField] = "fe_sni"
+	frontend[statStatusField] = "DOWN"
+	frontend[statTypeField] = "0"
+	lines = append(lines, strings.Join(frontend, ","))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestBackendStability(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stability := newBackendStability()
+	stability.now = func() time.Time { return now }
+
+	update := func(stats string) {
+		t.Helper()
+		if err := stability.update(strings.NewReader(stats)); err != nil {
+			t.Fatalf("unable to update the stability: %v", err)
+		}
+	}
+	expect := func(key ServiceAliasConfigKey, healthy time.Duration) {
+		t.Helper()
+		if got := stability.healthyFor(key); got != healthy {
+			t.Errorf("expected %s to be healthy for %v, got %v", key, healthy, got)
+		}
+	}
+
+	update(showStat(
+		[2]string{"be_http:ns:stable", "UP"},
+		[2]string{"be_http:ns:stable", "no check"},
+		[2]string{"be_secure:ns:failing", "UP"},
+		[2]string{"be_secure:ns:failing", "DOWN"},
+		[2]string{"be_tcp:ns:going-down", "UP 1/3"},
+		[2]string{"be_edge_http:ns:maintenance", "MAINT"},
+		[2]string{"openshift_default", "UP"},
+	))
+	now = now.Add(time.Hour)
+	expect("ns:stable", time.Hour)
+	expect("ns:failing", 0)
+	expect("ns:going-down", 0)
+	expect("ns:maintenance", time.Hour)
+	expect("openshift_default", 0)
+
+	update(showStat(
+		[2]string{"be_http:ns:stable", "DOWN 1/2"},
+		[2]string{"be_secure:ns:failing", "UP"},
+		[2]string{"be_tcp:ns:going-down", "UP"},
+	))
+	now = now.Add(time.Minute)
+	expect("ns:stable", 0)
+	expect("ns:failing", time.Minute)
+	expect("ns:going-down", time.Minute)
+	// Backends that are no longer in the configuration are forgotten.
+	expect("ns:maintenance", 0)
+
+	if err := stability.update(strings.NewReader("\"unterminated")); err == nil {
+		t.Errorf("expected invalid stats to be reported")
+	}
+}
+
+func TestAdaptiveHealthCheckInterval(t *testing.T) {
+	tests := []struct {
+		name         string
+		base         time.Duration
+		maxInterval  time.Duration
+		healthy      time.Duration
+		stablePeriod time.Duration
+		expected     time.Duration
+	}{
+		{
+			name:         "not stable yet",
+			base:         5 * time.Second,
+			maxInterval:  time.Minute,
+			healthy:      9 * time.Minute,
+			stablePeriod: 10 * time.Minute,
+			expected:     5 * time.Second,
+		},
+		{
+			name:         "doubles every stable period",
+			base:         5 * time.Second,
+			maxInterval:  time.Minute,
+			healthy:      25 * time.Minute,
+			stablePeriod: 10 * time.Minute,
+			expected:     20 * time.Second,
+		},
+		{
+			name:         "capped",
+			base:         5 * time.Second,
+			maxInterval:  time.Minute,
+			healthy:      24 * time.Hour,
+			stablePeriod: 10 * time.Minute,
+			expected:     time.Minute,
+		},
+		{
+			name:         "maximum below the base interval",
+			base:         5 * time.Second,
+			maxInterval:  time.Second,
+			healthy:      24 * time.Hour,
+			stablePeriod: 10 * time.Minute,
+			expected:     5 * time.Second,
+		},
+		{
+			name:         "adaptation disabled",
+			base:         5 * time.Second,
+			healthy:      24 * time.Hour,
+			stablePeriod: 10 * time.Minute,
+			expected:     5 * time.Second,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := adaptiveHealthCheckInterval(tc.base, tc.maxInterval, tc.healthy, tc.stablePeriod); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestHealthCheckIntervals(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stability := newBackendStability()
+	stability.now = func() time.Time { return now }
+	router := &templateRouter{
+		adaptiveHealthChecks: AdaptiveHealthCheckConfig{MaxInterval: time.Minute, StablePeriod: 10 * time.Minute},
+		backendStability:     stability,
+		state: map[ServiceAliasConfigKey]ServiceAliasConfig{
+			"ns:default": {ActiveEndpoints: 2},
+			"ns:annotated": {
+				ActiveEndpoints: 2,
+				Annotations:     map[string]string{"router.openshift.io/haproxy.health.check.interval": "2s"},
+			},
+			"ns:override":        {ActiveEndpoints: 2, HealthCheckMaxInterval: 8 * time.Second},
+			"ns:single-endpoint": {ActiveEndpoints: 1},
+			"ns:unstable":        {ActiveEndpoints: 2},
+		},
+	}
+	if err := stability.update(strings.NewReader(showStat(
+		[2]string{"be_http:ns:default", "UP"},
+		[2]string{"be_http:ns:annotated", "UP"},
+		[2]string{"be_http:ns:override", "UP"},
+		[2]string{"be_http:ns:single-endpoint", "UP"},
+		[2]string{"be_http:ns:unstable", "DOWN"},
+	))); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+
+	expected := map[ServiceAliasConfigKey]string{
+		"ns:default":   "60000ms",
+		"ns:annotated": "60000ms",
+		"ns:override":  "8000ms",
+	}
+	intervals := router.healthCheckIntervals()
+	if len(intervals) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, intervals)
+	}
+	for key, interval := range expected {
+		if intervals[key] != interval {
+			t.Errorf("expected the interval of %s to be %s, got %q", key, interval, intervals[key])
+		}
+	}
+}
+
+func TestHealthCheckIntervalsTemplate(t *testing.T) {
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+
+	serviceKey := ServiceUnitKey("ns/svc")
+	state := RenderState{
+		Routes: map[ServiceAliasConfigKey]ServiceAliasConfig{
+			"ns:stable": {
+				Name:         "stable",
+				Namespace:    "ns",
+				Host:         "stable.example.com",
+				ServiceUnits: map[ServiceUnitKey]int32{serviceKey: 100},
+				Annotations:  map[string]string{"router.openshift.io/haproxy.health.check.interval": "2s"},
+			},
+			"ns:unstable": {
+				Name:         "unstable",
+				Namespace:    "ns",
+				Host:         "unstable.example.com",
+				ServiceUnits: map[ServiceUnitKey]int32{serviceKey: 100},
+			},
+		},
+		ServiceUnits: map[ServiceUnitKey]ServiceUnit{
+			serviceKey: {
+				Name: string(serviceKey),
+				EndpointTable: []Endpoint{
+					{ID: "ep1", IP: "10.0.0.1", Port: "8080", IdHash: "hash1"},
+					{ID: "ep2", IP: "10.0.0.2", Port: "8080", IdHash: "hash2"},
+				},
+			},
+		},
+		HealthCheckIntervals: map[ServiceAliasConfigKey]string{"ns:stable": "32000ms"},
+	}
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+
+	var config string
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" {
+			config = string(file.Contents)
+		}
+	}
+	for _, expected := range []string{
+		"backend be_http:ns:stable\n",
+		"  default-server inter 32000ms fastinter 2s downinter 2s\n",
+		"backend be_http:ns:unstable\n",
+		"  default-server inter 5000ms\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected %q in the rendered configuration", expected)
+		}
+	}
+}
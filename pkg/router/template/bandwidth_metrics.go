@@ -0,0 +1,171 @@
+package templaterouter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	templateutil "github.com/openshift/router/pkg/router/template/util"
+)
+
+const (
+	// The columns of the "show stat" output with the bytes a backend
+	// received from the clients and sent to them.
+	statBytesInField  = 8
+	statBytesOutField = 9
+	statBackendType   = "1"
+)
+
+// The directions of the bandwidth limits of a route.
+const (
+	bandwidthDownload = "download"
+	bandwidthUpload   = "upload"
+)
+
+// bandwidthLimit is a bandwidth limit of a route, reported as a metric.
+type bandwidthLimit struct {
+	namespace string
+	name      string
+	direction string
+	// scope is "connection" for the limit of each connection, or "route"
+	// for the limit of all of them.
+	scope string
+	limit int64
+}
+
+// throttledBytes are the bytes a route transferred through its bandwidth
+// limits in a direction.
+type throttledBytes struct {
+	namespace string
+	name      string
+	direction string
+	bytes     int64
+}
+
+// bandwidthCollector exports the bandwidth limits of the routes and the bytes
+// transferred through them.  HAProxy does not count the bytes it delays to
+// enforce a limit, so the rate of the throttled bytes of a route reaching its
+// limit is what shows the route is throttled.
+type bandwidthCollector struct {
+	router *templateRouter
+	cli    *masterCLI
+
+	limitDesc     *prometheus.Desc
+	throttledDesc *prometheus.Desc
+}
+
+func newBandwidthCollector(router *templateRouter) *bandwidthCollector {
+	return &bandwidthCollector{
+		router: router,
+		cli:    newMasterCLI(filepath.Join(router.dir, statsSocketFile)),
+		limitDesc: prometheus.NewDesc(
+			"template_router_bandwidth_limit_bytes",
+			"The bandwidth limit of a route in bytes per second, for each connection or for the whole route.",
+			[]string{"namespace", "route", "direction", "scope"}, nil),
+		throttledDesc: prometheus.NewDesc(
+			"template_router_bandwidth_throttled_bytes_total",
+			"Number of bytes a route transferred through its bandwidth limits.",
+			[]string{"namespace", "route", "direction"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *bandwidthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.limitDesc
+	ch <- c.throttledDesc
+}
+
+// Collect implements prometheus.Collector.  The bytes are only read from
+// haproxy while a route limits its bandwidth.
+func (c *bandwidthCollector) Collect(ch chan<- prometheus.Metric) {
+	limits, backends := c.router.bandwidthLimits()
+	for _, l := range limits {
+		ch <- prometheus.MustNewConstMetric(c.limitDesc, prometheus.GaugeValue, float64(l.limit), l.namespace, l.name, l.direction, l.scope)
+	}
+	if len(backends) == 0 {
+		return
+	}
+
+	out, err := c.cli.execute("show stat")
+	if err == errMasterNotRunning {
+		return
+	}
+	if err != nil {
+		log.Error(err, "failed to read the bytes transferred by the routes with bandwidth limits")
+		return
+	}
+	throttled, err := parseThrottledBytes(strings.NewReader(out), backends)
+	if err != nil {
+		log.Error(err, "failed to read the bytes transferred by the routes with bandwidth limits")
+		return
+	}
+	for _, t := range throttled {
+		ch <- prometheus.MustNewConstMetric(c.throttledDesc, prometheus.CounterValue, float64(t.bytes), t.namespace, t.name, t.direction)
+	}
+}
+
+// bandwidthLimits returns the bandwidth limits of the routes, and the
+// routes that limit their bandwidth keyed by the names of their backends.
+func (r *templateRouter) bandwidthLimits() ([]bandwidthLimit, map[string]ServiceAliasConfig) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var limits []bandwidthLimit
+	backends := map[string]ServiceAliasConfig{}
+	for key, cfg := range r.state {
+		if !cfg.Bandwidth.Limited() {
+			continue
+		}
+		for _, l := range []bandwidthLimit{
+			{direction: bandwidthDownload, scope: "connection", limit: cfg.Bandwidth.Download},
+			{direction: bandwidthUpload, scope: "connection", limit: cfg.Bandwidth.Upload},
+			{direction: bandwidthDownload, scope: "route", limit: cfg.Bandwidth.DownloadTotal},
+			{direction: bandwidthUpload, scope: "route", limit: cfg.Bandwidth.UploadTotal},
+		} {
+			if l.limit > 0 {
+				l.namespace, l.name = cfg.Namespace, cfg.Name
+				limits = append(limits, l)
+			}
+		}
+		backends[fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(cfg.TLSTermination), key)] = cfg
+	}
+	return limits, backends
+}
+
+// parseThrottledBytes returns the bytes the backends of the routes with
+// bandwidth limits transferred in the directions they limit, from the
+// "show stat" output of haproxy.
+func parseThrottledBytes(stats io.Reader, backends map[string]ServiceAliasConfig) ([]throttledBytes, error) {
+	reader := csv.NewReader(stats)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var throttled []throttledBytes
+	for _, row := range rows {
+		if len(row) <= statTypeField || row[statTypeField] != statBackendType {
+			continue
+		}
+		cfg, ok := backends[row[statProxyNameField]]
+		if !ok {
+			continue
+		}
+		if cfg.Bandwidth.Download > 0 || cfg.Bandwidth.DownloadTotal > 0 {
+			if n, err := strconv.ParseInt(row[statBytesOutField], 10, 64); err == nil {
+				throttled = append(throttled, throttledBytes{namespace: cfg.Namespace, name: cfg.Name, direction: bandwidthDownload, bytes: n})
+			}
+		}
+		if cfg.Bandwidth.Upload > 0 || cfg.Bandwidth.UploadTotal > 0 {
+			if n, err := strconv.ParseInt(row[statBytesInField], 10, 64); err == nil {
+				throttled = append(throttled, throttledBytes{namespace: cfg.Namespace, name: cfg.Name, direction: bandwidthUpload, bytes: n})
+			}
+		}
+	}
+	return throttled, nil
+}
@@ -0,0 +1,34 @@
+package templaterouter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func TestParseThrottledBytes(t *testing.T) {
+	stats := `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,act,bck,chkfail,chkdown,lastchg,downtime,qlimit,pid,iid,sid,throttle,lbtot,tracked,type
+be_http:ns:download,pod:a:svc:8080-tcp:10.0.0.1:8080,0,0,0,0,,0,100,2000,,0,,0,0,0,0,UP,256,1,0,0,0,0,0,,1,1,1,,0,,2
+be_http:ns:download,BACKEND,0,0,0,0,,0,100,2000,,0,,0,0,0,0,UP,256,1,0,0,0,0,0,,1,1,0,,0,,1
+be_edge_http:ns:both,BACKEND,0,0,0,0,,0,300,4000,,0,,0,0,0,0,UP,256,1,0,0,0,0,0,,1,2,0,,0,,1
+be_http:ns:other,BACKEND,0,0,0,0,,0,500,6000,,0,,0,0,0,0,UP,256,1,0,0,0,0,0,,1,3,0,,0,,1
+`
+	backends := map[string]ServiceAliasConfig{
+		"be_http:ns:download":  {Namespace: "ns", Name: "download", Bandwidth: routeapihelpers.BandwidthLimits{Download: 1024}},
+		"be_edge_http:ns:both": {Namespace: "ns", Name: "both", Bandwidth: routeapihelpers.BandwidthLimits{DownloadTotal: 1024, Upload: 1024}},
+	}
+	throttled, err := parseThrottledBytes(strings.NewReader(stats), backends)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []throttledBytes{
+		{namespace: "ns", name: "download", direction: bandwidthDownload, bytes: 2000},
+		{namespace: "ns", name: "both", direction: bandwidthDownload, bytes: 4000},
+		{namespace: "ns", name: "both", direction: bandwidthUpload, bytes: 300},
+	}
+	if !reflect.DeepEqual(throttled, expected) {
+		t.Errorf("expected %#v, got %#v", expected, throttled)
+	}
+}
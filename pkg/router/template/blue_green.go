@@ -0,0 +1,61 @@
+package templaterouter
+
+import (
+	"fmt"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+	templateutil "github.com/openshift/router/pkg/router/template/util"
+)
+
+// blueGreenColors returns the suffixes of the backends of a route: one
+// backend per color if its backing services are split into a blue and a
+// green set, a single backend without a suffix otherwise.
+func blueGreenColors(cfg ServiceAliasConfig) []string {
+	if len(cfg.ActiveColor) == 0 {
+		return []string{""}
+	}
+	return []string{routeapihelpers.ColorBlue, routeapihelpers.ColorGreen}
+}
+
+// hasColor returns true if the service unit belongs to the backend of a
+// route with the given color suffix.
+func hasColor(cfg ServiceAliasConfig, serviceUnitName ServiceUnitKey, color string) bool {
+	if len(color) == 0 {
+		return true
+	}
+	return cfg.GreenServiceUnits[serviceUnitName] == (color == routeapihelpers.ColorGreen)
+}
+
+// hasBlueGreenRoutes returns true if the backing services of any route are
+// split into a blue and a green set.
+func hasBlueGreenRoutes(state map[ServiceAliasConfigKey]ServiceAliasConfig) bool {
+	for _, cfg := range state {
+		if len(cfg.ActiveColor) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dynamicallySwitchColor points the map entries of a route at the backend
+// of its new active color with the dynamic config manager if that is the
+// only change made to the route.  Returns true if the change was applied.
+// Must be called while holding r.lock
+func (r *templateRouter) dynamicallySwitchColor(backendKey ServiceAliasConfigKey, newConfig, oldConfig *ServiceAliasConfig) bool {
+	if r.dynamicConfigManager == nil || !r.synced {
+		return false
+	}
+	if len(oldConfig.ActiveColor) == 0 || len(newConfig.ActiveColor) == 0 || newConfig.ActiveColor == oldConfig.ActiveColor {
+		return false
+	}
+	if !configsAreEqual(withoutAnnotation(newConfig, routeapihelpers.ActiveColorAnnotation), withoutAnnotation(oldConfig, routeapihelpers.ActiveColorAnnotation)) {
+		return false
+	}
+
+	backendName := fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(newConfig.TLSTermination), backendKey)
+	if err := r.dynamicConfigManager.SetRouteActiveColor(backendKey, backendName, newConfig.ActiveColor); err != nil {
+		log.V(4).Info("router will reload as the ConfigManager could not dynamically switch the route active color", "backendKey", backendKey, "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func TestBlueGreenTemplate(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        "app",
+			Annotations: map[string]string{routeapihelpers.GreenServicesAnnotation: "v2", routeapihelpers.ActiveColorAnnotation: "green"},
+		},
+		Spec: routev1.RouteSpec{
+			Host:              "app.example.com",
+			To:                routev1.RouteTargetReference{Name: "v1"},
+			AlternateBackends: []routev1.RouteTargetReference{{Name: "v2"}},
+			TLS:               &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyAllow},
+		},
+	}
+
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	state := renderer.RouteState([]*routev1.Route{route})
+	for svc, ip := range map[string]string{"v1": "10.128.0.5", "v2": "10.129.0.5"} {
+		renderer.AddEndpoints(state, &kapi.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: svc},
+			Subsets: []kapi.EndpointSubset{{
+				Addresses: []kapi.EndpointAddress{{IP: ip}},
+				Ports:     []kapi.EndpointPort{{Port: 8080}},
+			}},
+		}, false, nil)
+	}
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	contents := map[string]string{}
+	for _, file := range files {
+		contents[file.Name] = string(file.Contents)
+	}
+	config := contents["conf/haproxy.config"]
+
+	// each color has a backend of its own with the servers of its services
+	for backend, ip := range map[string]string{
+		"backend be_edge_http:ns:app:blue\n":  "10.128.0.5:8080",
+		"backend be_edge_http:ns:app:green\n": "10.129.0.5:8080",
+	} {
+		i := strings.Index(config, backend)
+		if i < 0 {
+			t.Fatalf("%s not found", strings.TrimSpace(backend))
+		}
+		section := config[i+1:]
+		if j := strings.Index(section, "\nbackend "); j >= 0 {
+			section = section[:j]
+		}
+		servers := 0
+		for _, line := range strings.Split(section, "\n") {
+			if strings.HasPrefix(line, "  server ") {
+				servers++
+				if !strings.Contains(line, ip) {
+					t.Errorf("unexpected server in %s: %q", strings.TrimSpace(backend), line)
+				}
+			}
+		}
+		if servers != 1 {
+			t.Errorf("expected 1 server in %s, got %d", strings.TrimSpace(backend), servers)
+		}
+	}
+	if strings.Contains(config, "backend be_edge_http:ns:app\n") {
+		t.Errorf("unexpected backend without a color")
+	}
+
+	// the maps send the requests to the active color
+	for _, name := range []string{"conf/os_http_be.map", "conf/os_edge_reencrypt_be.map"} {
+		if !strings.Contains(contents[name], " be_edge_http:ns:app:green\n") {
+			t.Errorf("expected %s to send the requests to the green backend, got:\n%s", name, contents[name])
+		}
+	}
+
+	// the frontends of the http requests honor the override
+	if count := strings.Count(config, "http-request set-var(txn.bg_color) req.hdr(X-Router-Color),lower"); count != 3 {
+		t.Errorf("expected 3 frontends to honor the override header, got %d", count)
+	}
+	if count := strings.Count(config, ",field(1,:,3)]:%[var(txn.bg_color)] if { var(txn.bg_color) -m found }"); count != 3 {
+		t.Errorf("expected 3 frontends to send the overridden requests to their color, got %d", count)
+	}
+
+	// the frontends are unchanged without blue/green routes
+	route.Annotations = nil
+	files, err = renderer.Render(renderer.RouteState([]*routev1.Route{route}))
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" && strings.Contains(string(file.Contents), "txn.bg_color") {
+			t.Errorf("unexpected override without blue/green routes")
+		}
+	}
+}
+
+// TestDynamicallySwitchColor tests that switching the active color of a
+// route is applied without a reload.
+func TestDynamicallySwitchColor(t *testing.T) {
+	cm := &whitelistConfigManager{colors: map[string]string{}}
+	router := NewFakeTemplateRouter()
+	router.dynamicConfigManager = cm
+	router.synced = true
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "foo",
+			Name:        "bar",
+			Annotations: map[string]string{routeapihelpers.GreenServicesAnnotation: "v2"},
+		},
+		Spec: routev1.RouteSpec{
+			Host:              "host",
+			To:                routev1.RouteTargetReference{Name: "v1"},
+			AlternateBackends: []routev1.RouteTargetReference{{Name: "v2"}},
+		},
+	}
+	router.AddRoute(route)
+	if cfg := router.state["foo:bar"]; cfg.ActiveColor != routeapihelpers.ColorBlue || !cfg.GreenServiceUnits["foo/v2"] || cfg.GreenServiceUnits["foo/v1"] {
+		t.Fatalf("unexpected colors %q %v", cfg.ActiveColor, cfg.GreenServiceUnits)
+	}
+	router.dynamicallyConfigured = true
+	router.stateChanged = false
+
+	switched := route.DeepCopy()
+	switched.Annotations[routeapihelpers.ActiveColorAnnotation] = "green"
+	router.AddRoute(switched)
+	if cm.colors["be_http:foo:bar"] != routeapihelpers.ColorGreen {
+		t.Fatalf("expected the active color to be switched dynamically, got %v", cm.colors)
+	}
+	if !router.dynamicallyConfigured || !router.stateChanged {
+		t.Fatalf("expected the switch to be written without a reload")
+	}
+	if cfg := router.state["foo:bar"]; cfg.ActiveColor != routeapihelpers.ColorGreen {
+		t.Fatalf("expected the green color to be active, got %q", cfg.ActiveColor)
+	}
+
+	// Moving a service to the other color requires a reload.
+	moved := switched.DeepCopy()
+	moved.Annotations[routeapihelpers.ActiveColorAnnotation] = "blue"
+	moved.Annotations[routeapihelpers.GreenServicesAnnotation] = "v1"
+	router.AddRoute(moved)
+	if cm.colors["be_http:foo:bar"] != routeapihelpers.ColorGreen {
+		t.Fatalf("expected the active color not to be switched dynamically, got %v", cm.colors)
+	}
+	if router.dynamicallyConfigured {
+		t.Fatalf("expected moving a service to require a reload")
+	}
+}
@@ -0,0 +1,97 @@
+package templaterouter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// capabilityProbeTimeout bounds how long haproxy may take to report its
+// version and build options.
+const capabilityProbeTimeout = 10 * time.Second
+
+// haproxyVersionPattern matches the version line of "haproxy -vv", such as
+// "HAProxy version 2.8.5-1 2023/12/09 - https://haproxy.org/".
+var haproxyVersionPattern = regexp.MustCompile(`^HA-?Proxy version (\d+)\.(\d+)(\S*)`)
+
+// HAProxyCapabilities are the version and the build options of a haproxy
+// binary.
+type HAProxyCapabilities struct {
+	// Version is the version of haproxy, such as "2.8.5-1".
+	Version string
+	// Major and Minor are the major and minor version numbers.
+	Major, Minor int
+	// Features are the features haproxy was built with, such as "TPROXY"
+	// or "QUIC".  The features it was built without are missing.
+	Features sets.String
+}
+
+// ProbeHAProxyCapabilities returns the version and the build options of the
+// haproxy binary.
+func ProbeHAProxyCapabilities(binary string) (*HAProxyCapabilities, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), capabilityProbeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, binary, "-vv").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("unable to probe the capabilities of %s: %v\n%s", binary, err, string(out))
+	}
+	return parseHAProxyCapabilities(string(out))
+}
+
+// parseHAProxyCapabilities parses the output of "haproxy -vv".  The feature
+// list may be wrapped over several indented lines.
+func parseHAProxyCapabilities(out string) (*HAProxyCapabilities, error) {
+	capabilities := &HAProxyCapabilities{Features: sets.NewString()}
+	foundVersion := false
+	inFeatures := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := haproxyVersionPattern.FindStringSubmatch(line); m != nil {
+			capabilities.Major, _ = strconv.Atoi(m[1])
+			capabilities.Minor, _ = strconv.Atoi(m[2])
+			capabilities.Version = m[1] + "." + m[2] + m[3]
+			foundVersion = true
+			continue
+		}
+		var features string
+		switch {
+		case strings.HasPrefix(line, "Feature list :"):
+			features = strings.TrimPrefix(line, "Feature list :")
+			inFeatures = true
+		case inFeatures && strings.HasPrefix(line, " "):
+			features = line
+		default:
+			inFeatures = false
+		}
+		for _, feature := range strings.Fields(features) {
+			if strings.HasPrefix(feature, "+") {
+				capabilities.Features.Insert(feature[1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !foundVersion {
+		return nil, fmt.Errorf("no version found in the haproxy build options")
+	}
+	return capabilities, nil
+}
+
+// AtLeast returns true if haproxy is at least version major.minor.
+func (c *HAProxyCapabilities) AtLeast(major, minor int) bool {
+	return c.Major > major || (c.Major == major && c.Minor >= minor)
+}
+
+// HasFeature returns true if haproxy was built with feature.
+func (c *HAProxyCapabilities) HasFeature(feature string) bool {
+	return c.Features.Has(feature)
+}
@@ -0,0 +1,45 @@
+package templaterouter
+
+import (
+	"testing"
+)
+
+func TestParseHAProxyCapabilities(t *testing.T) {
+	out := `HAProxy version 2.8.5-1 2023/12/09 - https://haproxy.org/
+Status: long-term supported branch - will stop receiving fixes around Q2 2028.
+Build options :
+  TARGET  = linux-glibc
+  CPU     = generic
+
+Feature list : -51DEGREES +ACCEPT4 +BACKTRACE -CLOSEFROM +CPU_AFFINITY +CRYPT_H
+  -DEVICEATLAS +DL -ENGINE +EPOLL -EVPORTS +GETADDRINFO -KQUEUE -LIBATOMIC
+  +LIBCRYPT +LINUX_SPLICE +LINUX_TPROXY -QUIC +TPROXY
+
+Default settings :
+  bufsize = 16384, maxrewrite = 1024, maxpollevents = 200
+`
+	capabilities, err := parseHAProxyCapabilities(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if capabilities.Version != "2.8.5-1" || capabilities.Major != 2 || capabilities.Minor != 8 {
+		t.Errorf("expected version 2.8.5-1, got %q (%d.%d)", capabilities.Version, capabilities.Major, capabilities.Minor)
+	}
+	for _, feature := range []string{"ACCEPT4", "CRYPT_H", "EPOLL", "LINUX_TPROXY", "TPROXY"} {
+		if !capabilities.HasFeature(feature) {
+			t.Errorf("expected feature %s, got %v", feature, capabilities.Features.List())
+		}
+	}
+	for _, feature := range []string{"51DEGREES", "QUIC", "bufsize", "TARGET"} {
+		if capabilities.HasFeature(feature) {
+			t.Errorf("unexpected feature %s", feature)
+		}
+	}
+	if !capabilities.AtLeast(2, 6) || !capabilities.AtLeast(2, 8) || capabilities.AtLeast(2, 9) || capabilities.AtLeast(3, 0) {
+		t.Errorf("unexpected version comparisons for %s", capabilities.Version)
+	}
+
+	if _, err := parseHAProxyCapabilities("Feature list : +TPROXY\n"); err == nil {
+		t.Errorf("expected an error without a version")
+	}
+}
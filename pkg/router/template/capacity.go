@@ -0,0 +1,454 @@
+package templaterouter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	kapi "k8s.io/api/core/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// The resources of the generated configuration whose usage is limited.
+const (
+	CapacityConfigBytes  = "config_bytes"
+	CapacityBackends     = "backends"
+	CapacityACLs         = "acls"
+	CapacityMapEntries   = "map_entries"
+	CapacityCertificates = "certificates"
+)
+
+// capacityResources are the limited resources, in the order they are
+// reported.
+var capacityResources = []string{CapacityConfigBytes, CapacityBackends, CapacityACLs, CapacityMapEntries, CapacityCertificates}
+
+// capacityDescriptions describe the limited resources in messages.
+var capacityDescriptions = map[string]string{
+	CapacityConfigBytes:  "bytes of configuration",
+	CapacityBackends:     "backends",
+	CapacityACLs:         "ACLs",
+	CapacityMapEntries:   "map entries",
+	CapacityCertificates: "certificates",
+}
+
+// RouterCapacityExceededReason is the reason routes are rejected for when
+// admitting them would exceed a capacity limit of the router.
+const RouterCapacityExceededReason = reasons.RouterCapacityExceeded
+
+// The levels of the usage of a limited resource.
+const (
+	// capacityAvailable is a usage below the warning threshold.
+	capacityAvailable = iota
+	// capacityNearing is a usage past the warning threshold.
+	capacityNearing
+	// capacityReached is a usage at or over the limit, further routes
+	// are rejected.
+	capacityReached
+)
+
+// CapacityLimits are the ceilings on the configuration generated by the
+// router.  A zero limit is not enforced.
+type CapacityLimits struct {
+	// ConfigBytes is the size of all the generated files.
+	ConfigBytes int
+	// Backends is the number of routes.
+	Backends int
+	// ACLs is the number of named ACLs in the generated configuration.
+	ACLs int
+	// MapEntries is the number of entries in the generated map files.
+	MapEntries int
+	// Certificates is the number of certificates written for routes.
+	Certificates int
+
+	// WarningPercent is the percentage of a limit past which the router
+	// warns that it is nearing the limit.
+	WarningPercent int
+}
+
+// Enabled returns true if any limit is set.
+func (l CapacityLimits) Enabled() bool {
+	return l.ConfigBytes > 0 || l.Backends > 0 || l.ACLs > 0 || l.MapEntries > 0 || l.Certificates > 0
+}
+
+// limit returns the limit of a resource.
+func (l CapacityLimits) limit(resource string) int {
+	switch resource {
+	case CapacityConfigBytes:
+		return l.ConfigBytes
+	case CapacityBackends:
+		return l.Backends
+	case CapacityACLs:
+		return l.ACLs
+	case CapacityMapEntries:
+		return l.MapEntries
+	case CapacityCertificates:
+		return l.Certificates
+	}
+	return 0
+}
+
+// CapacityEventRecorder is an object capable of recording the changes of
+// the usage of the capacity limits of the router.
+type CapacityEventRecorder interface {
+	RecordCapacityEvent(eventType, reason, message string)
+}
+
+// capacityTracker tracks the usage of the resources of the generated
+// configuration against their limits.
+type capacityTracker struct {
+	limits CapacityLimits
+	// usage is the usage measured after the last write of the
+	// configuration.
+	usage map[string]int
+	// levels are the levels of the usage of each resource.
+	levels   map[string]int
+	recorder CapacityEventRecorder
+	// rejected are the routes rejected for capacity.  They are handed to
+	// requeue once capacity is released.
+	rejected map[ServiceAliasConfigKey]*routev1.Route
+	requeue  func(namespace, name string)
+
+	metricUsage *prometheus.GaugeVec
+	metricLimit *prometheus.GaugeVec
+	metricLevel *prometheus.GaugeVec
+}
+
+func newCapacityTracker(limits CapacityLimits) *capacityTracker {
+	t := &capacityTracker{
+		limits:   limits,
+		usage:    map[string]int{},
+		levels:   map[string]int{},
+		rejected: map[ServiceAliasConfigKey]*routev1.Route{},
+		metricUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "capacity_usage",
+			Help:      "Usage of the limited resources of the generated router configuration.",
+		}, []string{"resource"}),
+		metricLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "capacity_limit",
+			Help:      "Limits of the resources of the generated router configuration, 0 if not limited.",
+		}, []string{"resource"}),
+		metricLevel: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "capacity_level",
+			Help:      "Whether the usage of a resource is available (0), nearing its limit (1) or at its limit so that further routes are rejected (2).",
+		}, []string{"resource"}),
+	}
+	for _, resource := range capacityResources {
+		t.metricLimit.WithLabelValues(resource).Set(float64(limits.limit(resource)))
+	}
+	return t
+}
+
+// level returns the level of the usage of a resource.
+func (t *capacityTracker) level(resource string, usage int) int {
+	limit := t.limits.limit(resource)
+	switch {
+	case limit == 0:
+		return capacityAvailable
+	case usage >= limit:
+		return capacityReached
+	case usage*100 >= limit*t.limits.WarningPercent:
+		return capacityNearing
+	}
+	return capacityAvailable
+}
+
+// observe records the usage measured after writing the configuration and
+// reports the resources whose level changed.  It returns whether the usage
+// of a resource decreased, releasing capacity.
+func (t *capacityTracker) observe(usage map[string]int) bool {
+	previousUsage, released := t.usage, false
+	t.usage = usage
+	for _, resource := range capacityResources {
+		value, limit := usage[resource], t.limits.limit(resource)
+		if value < previousUsage[resource] {
+			released = true
+		}
+		level := t.level(resource, value)
+		t.metricUsage.WithLabelValues(resource).Set(float64(value))
+		t.metricLevel.WithLabelValues(resource).Set(float64(level))
+
+		previous := t.levels[resource]
+		if level == previous {
+			continue
+		}
+		t.levels[resource] = level
+
+		description := capacityDescriptions[resource]
+		var eventType, reason, message string
+		switch {
+		case level == capacityReached:
+			eventType, reason = kapi.EventTypeWarning, RouterCapacityExceededReason
+			message = fmt.Sprintf("router configuration has %d %s, at its limit of %d: further routes are rejected", value, description, limit)
+		case level == capacityNearing && previous == capacityAvailable:
+			eventType, reason = kapi.EventTypeWarning, reasons.RouterCapacityNearing
+			message = fmt.Sprintf("router configuration has %d %s, nearing its limit of %d", value, description, limit)
+		case level == capacityAvailable:
+			eventType, reason = kapi.EventTypeNormal, reasons.RouterCapacityAvailable
+			message = fmt.Sprintf("router configuration has %d %s, below its limit of %d", value, description, limit)
+		default:
+			// back under the limit but still nearing it.
+			eventType, reason = kapi.EventTypeNormal, reasons.RouterCapacityNearing
+			message = fmt.Sprintf("router configuration has %d %s, below its limit of %d: routes are admitted again", value, description, limit)
+		}
+		log.V(0).Info("router capacity changed", "resource", resource, "usage", value, "limit", limit, "reason", reason)
+		if t.recorder != nil {
+			t.recorder.RecordCapacityEvent(eventType, reason, message)
+		}
+	}
+	return released
+}
+
+// takeRejected returns the routes rejected for capacity that can be handed
+// to requeue, and forgets them.
+func (t *capacityTracker) takeRejected() []*routev1.Route {
+	if t.requeue == nil || len(t.rejected) == 0 {
+		return nil
+	}
+	routes := make([]*routev1.Route, 0, len(t.rejected))
+	for key, route := range t.rejected {
+		routes = append(routes, route)
+		delete(t.rejected, key)
+	}
+	return routes
+}
+
+// admit returns why a route with the given config cannot be added to a
+// state of backends routes without exceeding a limit, or an empty string if
+// it can.  The usage of the generated files is only known once they are
+// written, so that routes are rejected once a limit is reached.
+func (t *capacityTracker) admit(backends int, cfg *ServiceAliasConfig) string {
+	if limit := t.limits.Backends; limit > 0 && backends+1 > limit {
+		return t.rejection(CapacityBackends)
+	}
+	if limit := t.limits.Certificates; limit > 0 {
+		if certs := configCertificates(cfg); certs > 0 && t.usage[CapacityCertificates]+certs > limit {
+			return t.rejection(CapacityCertificates)
+		}
+	}
+	for _, resource := range []string{CapacityConfigBytes, CapacityACLs, CapacityMapEntries} {
+		if t.level(resource, t.usage[resource]) == capacityReached {
+			return t.rejection(resource)
+		}
+	}
+	return ""
+}
+
+// rejection returns the message of routes rejected for a resource.
+func (t *capacityTracker) rejection(resource string) string {
+	return fmt.Sprintf("router is at its limit of %d %s", t.limits.limit(resource), capacityDescriptions[resource])
+}
+
+// excess returns how many of the backends must be removed for the usage to
+// be within the limits, estimated from the average usage of a backend, and
+// the resource that requires the most.
+func (t *capacityTracker) excess(usage map[string]int) (int, string) {
+	backends := usage[CapacityBackends]
+	excess, exceeded := 0, ""
+	if backends == 0 {
+		return 0, ""
+	}
+	for _, resource := range capacityResources {
+		value, limit := usage[resource], t.limits.limit(resource)
+		if limit == 0 || value <= limit {
+			continue
+		}
+		perBackend := (value + backends - 1) / backends
+		n := (value - limit + perBackend - 1) / perBackend
+		if n < 1 {
+			n = 1
+		}
+		if n > excess {
+			excess, exceeded = n, resource
+		}
+	}
+	return excess, exceeded
+}
+
+// configCertificates returns the number of certificates written for a
+// route.
+func configCertificates(cfg *ServiceAliasConfig) int {
+	n := 0
+	for _, cert := range cfg.Certificates {
+		if len(cert.Contents) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// countConfigFile adds the usage of a generated file to usage.  The entries
+// of map files and the named ACLs of the other files are counted.
+func countConfigFile(file io.Reader, isMap bool, usage map[string]int) error {
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		usage[CapacityConfigBytes] += len(line)
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case len(trimmed) == 0 || strings.HasPrefix(trimmed, "#"):
+		case isMap:
+			usage[CapacityMapEntries]++
+		case strings.HasPrefix(trimmed, "acl "):
+			usage[CapacityACLs]++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// measureCapacity returns the usage of the resources of the written
+// configuration.
+// Must be called while holding r.lock
+func (r *templateRouter) measureCapacity() (map[string]int, error) {
+	usage := map[string]int{CapacityBackends: len(r.state)}
+	for _, cfg := range r.state {
+		cfg := cfg // avoid implicit memory aliasing (gosec G601)
+		usage[CapacityCertificates] += configCertificates(&cfg)
+	}
+	for name := range r.templates {
+		filename := filepath.Join(r.dir, name)
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error measuring config file %s: %v", filename, err)
+		}
+		err = countConfigFile(file, strings.HasSuffix(name, ".map"), usage)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error measuring config file %s: %v", filename, err)
+		}
+	}
+	return usage, nil
+}
+
+// capacityRejection is a route rejected for capacity, recorded once r.lock
+// is released.
+type capacityRejection struct {
+	route   *routev1.Route
+	message string
+}
+
+// enforceCapacity measures the written configuration and, while it exceeds
+// a limit, rejects the most recently created of the routes added since the
+// last reload and writes the configuration again, so that haproxy is never
+// given a configuration over the limits because of new routes.  It returns
+// the rejected routes, and the routes rejected before that are handled
+// again because capacity was released.
+// Must be called while holding r.lock
+func (r *templateRouter) enforceCapacity(changes map[ServiceAliasConfigKey]pendingRouteChange) ([]capacityRejection, []*routev1.Route, error) {
+	var rejections []capacityRejection
+	for {
+		usage, err := r.measureCapacity()
+		if err != nil {
+			return rejections, nil, err
+		}
+		excess, resource := r.capacity.excess(usage)
+		added := addedRoutes(changes)
+		if excess == 0 || len(added) == 0 {
+			if excess > 0 {
+				log.V(0).Info("router configuration exceeds its capacity but no new route can be rejected", "resource", resource, "usage", usage[resource], "limit", r.capacity.limits.limit(resource))
+			}
+			if r.capacity.observe(usage) {
+				return rejections, r.capacity.takeRejected(), nil
+			}
+			return rejections, nil, nil
+		}
+
+		if excess > len(added) {
+			excess = len(added)
+		}
+		message := r.capacity.rejection(resource)
+		for _, route := range added[len(added)-excess:] {
+			log.V(0).Info("rejecting route that exceeds the router capacity", "namespace", route.Namespace, "name", route.Name, "resource", resource)
+			delete(changes, routeKey(route))
+			r.removeRouteInternal(route)
+			r.capacity.rejected[routeKey(route)] = route
+			rejections = append(rejections, capacityRejection{route: route, message: message})
+		}
+		// the configuration is written again without the rejected routes.
+		r.stateChanged = false
+		if err := r.writeCommittedConfig(); err != nil {
+			return rejections, nil, err
+		}
+	}
+}
+
+// recordCapacityRejections records the routes rejected for capacity and
+// hands the routes that may fit again to requeue.  It must be called
+// without holding r.lock, as recording a rejection may call back into the
+// router.
+func recordCapacityRejections(recorder RejectionRecorder, rejections []capacityRejection, requeue func(namespace, name string), routes []*routev1.Route) {
+	if recorder != nil {
+		for _, rejection := range rejections {
+			recorder.RecordRouteRejection(rejection.route, RouterCapacityExceededReason, rejection.message)
+		}
+	}
+	if requeue == nil || len(routes) == 0 {
+		return
+	}
+	// The routes are handled again through the controller, which may be
+	// committing the router.
+	go func() {
+		for _, route := range routes {
+			log.V(0).Info("handling route rejected for capacity again", "namespace", route.Namespace, "name", route.Name)
+			requeue(route.Namespace, route.Name)
+		}
+	}()
+}
+
+// addedRoutes returns the routes added by the changes, oldest first so that
+// the routes created last are rejected first.
+func addedRoutes(changes map[ServiceAliasConfigKey]pendingRouteChange) []*routev1.Route {
+	added := []*routev1.Route{}
+	for _, change := range changes {
+		if change.previous == nil && change.route != nil {
+			added = append(added, change.route)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool {
+		ti, tj := added[i].CreationTimestamp, added[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return routeKey(added[i]) < routeKey(added[j])
+	})
+	return added
+}
+
+// SetCapacityEventRecorder configures the plugin to report the changes of
+// the usage of the capacity limits of the router to recorder.
+func (p *TemplatePlugin) SetCapacityEventRecorder(recorder CapacityEventRecorder) {
+	if r, ok := p.Router.(*templateRouter); ok {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.capacity != nil {
+			r.capacity.recorder = recorder
+		}
+	}
+}
+
+// SetCapacityRequeuer configures the plugin to hand the routes rejected for
+// capacity to requeue, by namespace and name, once capacity is released.
+func (p *TemplatePlugin) SetCapacityRequeuer(requeue func(namespace, name string)) {
+	if r, ok := p.Router.(*templateRouter); ok {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.capacity != nil {
+			r.capacity.requeue = requeue
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package templaterouter
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+type fakeCapacityEventRecorder struct {
+	reasons []string
+}
+
+func (r *fakeCapacityEventRecorder) RecordCapacityEvent(eventType, reason, message string) {
+	r.reasons = append(r.reasons, eventType+"/"+reason)
+}
+
+func TestCountConfigFile(t *testing.T) {
+	usage := map[string]int{}
+	config := "global\n  # acl commented out\n  acl a path /a\nbackend b\n  acl b hdr(host) b\n  http-request deny if { path /c }"
+	if err := countConfigFile(strings.NewReader(config), false, usage); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries := "# comment\na be_a\n\nb be_b\n"
+	if err := countConfigFile(strings.NewReader(entries), true, usage); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]int{CapacityConfigBytes: len(config) + len(entries), CapacityACLs: 2, CapacityMapEntries: 2}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("expected %v, got %v", expected, usage)
+	}
+}
+
+func TestCapacityTrackerEvents(t *testing.T) {
+	tracker := newCapacityTracker(CapacityLimits{MapEntries: 10, WarningPercent: 80})
+	recorder := &fakeCapacityEventRecorder{}
+	tracker.recorder = recorder
+
+	for _, entries := range []int{5, 8, 9, 10, 12, 9, 5, 5} {
+		tracker.observe(map[string]int{CapacityMapEntries: entries, CapacityACLs: 1000})
+	}
+	expected := []string{
+		kapi.EventTypeWarning + "/RouterCapacityNearing",
+		kapi.EventTypeWarning + "/" + RouterCapacityExceededReason,
+		kapi.EventTypeNormal + "/RouterCapacityNearing",
+		kapi.EventTypeNormal + "/RouterCapacityAvailable",
+	}
+	if !reflect.DeepEqual(recorder.reasons, expected) {
+		t.Errorf("expected events %v, got %v", expected, recorder.reasons)
+	}
+}
+
+func TestCapacityTrackerExcess(t *testing.T) {
+	tracker := newCapacityTracker(CapacityLimits{ConfigBytes: 1000, ACLs: 10, WarningPercent: 80})
+	tests := []struct {
+		usage    map[string]int
+		excess   int
+		resource string
+	}{
+		{usage: map[string]int{CapacityBackends: 10, CapacityConfigBytes: 1000, CapacityACLs: 10}},
+		{usage: map[string]int{CapacityBackends: 10, CapacityConfigBytes: 1001, CapacityACLs: 10}, excess: 1, resource: CapacityConfigBytes},
+		{usage: map[string]int{CapacityBackends: 10, CapacityConfigBytes: 1300, CapacityACLs: 10}, excess: 3, resource: CapacityConfigBytes},
+		{usage: map[string]int{CapacityBackends: 10, CapacityConfigBytes: 1300, CapacityACLs: 20}, excess: 5, resource: CapacityACLs},
+	}
+	for _, tc := range tests {
+		excess, resource := tracker.excess(tc.usage)
+		if excess != tc.excess || resource != tc.resource {
+			t.Errorf("%v: expected %d backends over the %q limit, got %d over %q", tc.usage, tc.excess, tc.resource, excess, resource)
+		}
+	}
+}
+
+// TestEnforceCapacity tests that routes are rejected once the router is at
+// its limits and that the configuration written never exceeds them.
+func TestEnforceCapacity(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	router.dir = t.TempDir()
+	router.metricReload = prometheus.NewSummary(prometheus.SummaryOpts{Name: "reload"})
+	router.metricReloadFailure = prometheus.NewGauge(prometheus.GaugeOpts{Name: "reload_failure"})
+	router.metricWriteConfig = prometheus.NewSummary(prometheus.SummaryOpts{Name: "write_config"})
+	router.reloadFn = func(shutdown bool) error { return nil }
+	recorder := &fakeRejectionRecorder{rejections: map[string]string{}}
+	router.rejectionRecorder = recorder
+	router.capacity = newCapacityTracker(CapacityLimits{Backends: 4, ACLs: 5, WarningPercent: 80})
+	// Every route has two ACLs and a map entry.
+	router.templates = map[string]*template.Template{
+		"conf/haproxy.config": template.Must(template.New("conf/haproxy.config").Parse("{{ range $k, $v := .State }}backend {{ $k }}\n  acl a path /a\n  acl b path /b\n{{ end }}")),
+		"conf/os_http_be.map": template.Must(template.New("conf/os_http_be.map").Parse("{{ range $k, $v := .State }}{{ $v.Host }} {{ $k }}\n{{ end }}")),
+	}
+
+	created := time.Now()
+	route := func(name string) *routev1.Route {
+		route := makeFeedbackRoute(name, false)
+		route.CreationTimestamp = metav1.NewTime(created)
+		created = created.Add(time.Second)
+		return route
+	}
+	routes := map[string]*routev1.Route{}
+	for _, name := range []string{"d", "c", "b", "a"} {
+		routes[name] = route(name)
+		router.AddRoute(routes[name])
+	}
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The 8 ACLs of the 4 routes are over the limit, the routes created
+	// last are rejected.
+	for name, admitted := range map[string]bool{"d": true, "c": true, "b": false, "a": false} {
+		if router.HasRoute(routes[name]) != admitted {
+			t.Errorf("expected route %s in the state to be %t", name, admitted)
+		}
+		if _, rejected := recorder.rejections["foo/"+name]; rejected == admitted {
+			t.Errorf("expected route %s rejected to be %t, got %v", name, !admitted, recorder.rejections)
+		}
+	}
+	expected := map[string]int{CapacityBackends: 2, CapacityACLs: 4, CapacityMapEntries: 2}
+	usage := map[string]int{}
+	for resource := range expected {
+		usage[resource] = router.capacity.usage[resource]
+	}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("expected the usage of the written configuration to be %v, got %v", expected, usage)
+	}
+	if level := router.capacity.levels[CapacityACLs]; level != capacityNearing {
+		t.Errorf("expected the ACLs to be nearing their limit, got level %d", level)
+	}
+	if router.stateChanged {
+		t.Errorf("expected the configuration without the rejected routes to be committed")
+	}
+
+	// Once the limit is reached, further routes are rejected right away.
+	router.capacity.limits.ACLs = 4
+	router.capacity.observe(router.capacity.usage)
+	recorder.rejections = map[string]string{}
+	router.AddRoute(routes["a"])
+	if router.HasRoute(routes["a"]) {
+		t.Errorf("expected route a to be rejected at the limit")
+	}
+	if reason := recorder.rejections["foo/a"]; reason != RouterCapacityExceededReason {
+		t.Errorf("expected route a to be rejected with %s, got %q", RouterCapacityExceededReason, reason)
+	}
+	// Existing routes are still updated.
+	updated := routes["c"].DeepCopy()
+	updated.Spec.Path = "/updated"
+	router.AddRoute(updated)
+	if _, rejected := recorder.rejections["foo/c"]; rejected {
+		t.Errorf("expected an existing route to be updated at the limit")
+	}
+
+	// The routes rejected for capacity are handled again once a route is
+	// removed.
+	requeued := make(chan string, 4)
+	router.capacity.requeue = func(namespace, name string) { requeued <- namespace + "/" + name }
+	router.RemoveRoute(routes["d"])
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := []string{}
+	for len(names) < 2 {
+		select {
+		case name := <-requeued:
+			names = append(names, name)
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("expected the rejected routes to be requeued, got %v", names)
+		}
+	}
+	sort.Strings(names)
+	if expected := []string{"foo/a", "foo/b"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected the routes %v to be requeued, got %v", expected, names)
+	}
+	if len(router.capacity.rejected) != 0 {
+		t.Errorf("expected the requeued routes to be forgotten, got %v", router.capacity.rejected)
+	}
+}
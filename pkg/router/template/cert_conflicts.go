@@ -0,0 +1,193 @@
+package templaterouter
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// CertificateConflictOldest presents the certificate of the oldest of
+	// the routes that supply different certificates for the same server
+	// name, as the oldest route holds a host the router admits twice.
+	CertificateConflictOldest = "oldest"
+	// CertificateConflictLatestExpiry presents the certificate that expires
+	// last of those the routes supply for the same server name.
+	CertificateConflictLatestExpiry = "latest-expiry"
+)
+
+// CertificateConflictRecorder is an object capable of recording that the
+// certificate of a route is not presented because another route supplies a
+// different certificate for the same server name.
+type CertificateConflictRecorder interface {
+	// RecordCertificateConflict records that the certificate of a route
+	// is not presented.
+	RecordCertificateConflict(namespace, name, message string)
+	// ClearCertificateConflict records that the certificate of a route is
+	// presented again.
+	ClearCertificateConflict(namespace, name string)
+}
+
+// CertificateConflict is a route whose certificate is not presented because
+// another route supplies a different certificate for the same server name.
+type CertificateConflict struct {
+	// ServerName is the server name of the certificates, which is a
+	// wildcard for wildcard routes.
+	ServerName string
+	// Winner is the route whose certificate is presented.
+	Winner ServiceAliasConfigKey
+}
+
+// message returns the message recorded on the route that lost a conflict.
+func (c CertificateConflict) message(state map[ServiceAliasConfigKey]ServiceAliasConfig) string {
+	winner := state[c.Winner]
+	return fmt.Sprintf("the certificate of route %s/%s is presented for %s instead", winner.Namespace, winner.Name, c.ServerName)
+}
+
+// certificateCandidate is a route that supplies a certificate for a server
+// name.
+type certificateCandidate struct {
+	key      ServiceAliasConfigKey
+	cfg      *ServiceAliasConfig
+	contents string
+	notAfter time.Time
+}
+
+// findCertificateConflicts returns the routes of state whose certificates
+// are not presented because other routes supply different certificates for
+// the same server name.  The route whose certificate is presented is picked
+// by policy, and then by namespace and name, so that every router picks the
+// same one.  Routes that supply the same certificate do not conflict.
+func findCertificateConflicts(state map[ServiceAliasConfigKey]ServiceAliasConfig, workingDir, policy string) map[ServiceAliasConfigKey]CertificateConflict {
+	candidates := map[string][]certificateCandidate{}
+	for k := range state {
+		cfg := state[k]
+		entry, ok := crtListEntry(workingDir, k, &cfg, false)
+		if !ok {
+			continue
+		}
+		cert := cfg.Certificates[generateCertKey(&cfg)]
+		serverName := entry.SNIFilters[0]
+		candidates[serverName] = append(candidates[serverName], certificateCandidate{
+			key:      k,
+			cfg:      &cfg,
+			contents: cert.Contents,
+			notAfter: certificateNotAfter(cert.Contents),
+		})
+	}
+
+	var conflicts map[ServiceAliasConfigKey]CertificateConflict
+	for serverName, routes := range candidates {
+		if len(routes) < 2 {
+			continue
+		}
+		sort.Slice(routes, func(i, j int) bool {
+			a, b := routes[i], routes[j]
+			if policy == CertificateConflictLatestExpiry && !a.notAfter.Equal(b.notAfter) {
+				return a.notAfter.After(b.notAfter)
+			}
+			if !a.cfg.CreationTimestamp.Equal(b.cfg.CreationTimestamp) {
+				return a.cfg.CreationTimestamp.Before(b.cfg.CreationTimestamp)
+			}
+			return a.key < b.key
+		})
+		winner := routes[0]
+		for _, route := range routes[1:] {
+			if route.contents == winner.contents {
+				continue
+			}
+			if conflicts == nil {
+				conflicts = make(map[ServiceAliasConfigKey]CertificateConflict)
+			}
+			conflicts[route.key] = CertificateConflict{ServerName: serverName, Winner: winner.key}
+		}
+	}
+	return conflicts
+}
+
+// certificateNotAfter returns the expiry of the first certificate of
+// contents, or the zero time if it has none.
+func certificateNotAfter(contents string) time.Time {
+	rest := []byte(contents)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(bytes.TrimSpace(rest))
+		if block == nil {
+			return time.Time{}
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}
+		}
+		return cert.NotAfter
+	}
+}
+
+// hasCertificateConflict returns true if another route of the router state
+// supplies a different certificate for the server name of the certificate
+// of cfg, in which case which certificate is presented is only decided when
+// the configuration is written.
+// Must be called while holding r.lock
+func (r *templateRouter) hasCertificateConflict(backendKey ServiceAliasConfigKey, cfg *ServiceAliasConfig) bool {
+	entry, ok := crtListEntry(r.dir, backendKey, cfg, false)
+	if !ok {
+		return false
+	}
+	cert := cfg.Certificates[generateCertKey(cfg)]
+	for k := range r.state {
+		if k == backendKey {
+			continue
+		}
+		other := r.state[k]
+		if otherEntry, ok := crtListEntry(r.dir, k, &other, false); ok && otherEntry.SNIFilters[0] == entry.SNIFilters[0] {
+			if other.Certificates[generateCertKey(&other)].Contents != cert.Contents {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetCertificateConflictRecorder configures the plugin to report the routes
+// whose certificates are not presented because of conflicts to recorder.
+func (p *TemplatePlugin) SetCertificateConflictRecorder(recorder CertificateConflictRecorder) {
+	if r, ok := p.Router.(*templateRouter); ok {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.certificateConflictRecorder = recorder
+	}
+}
+
+// reportCertificateConflicts logs the certificate conflicts of the router
+// state and reports the routes that lost or no longer lose a conflict since
+// the last report.
+// Must be called while holding r.lock
+func (r *templateRouter) reportCertificateConflicts() {
+	conflicts := findCertificateConflicts(r.state, r.dir, r.certificateConflictPolicy)
+	for k, conflict := range conflicts {
+		if previous, ok := r.certificateConflicts[k]; ok && previous == conflict {
+			continue
+		}
+		cfg := r.state[k]
+		winner := r.state[conflict.Winner]
+		log.V(0).Info("routes supply different certificates for the same server name", "serverName", conflict.ServerName, "policy", r.certificateConflictPolicy, "presented", winner.Namespace+"/"+winner.Name, "ignored", cfg.Namespace+"/"+cfg.Name)
+		if r.certificateConflictRecorder != nil {
+			r.certificateConflictRecorder.RecordCertificateConflict(cfg.Namespace, cfg.Name, conflict.message(r.state))
+		}
+	}
+	for k := range r.certificateConflicts {
+		if _, ok := conflicts[k]; ok {
+			continue
+		}
+		if cfg, ok := r.state[k]; ok && r.certificateConflictRecorder != nil {
+			r.certificateConflictRecorder.ClearCertificateConflict(cfg.Namespace, cfg.Name)
+		}
+	}
+	r.certificateConflicts = conflicts
+}
@@ -0,0 +1,146 @@
+package templaterouter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// expiringCertificate returns a self-signed PEM certificate for host that
+// expires at notAfter.
+func expiringCertificate(t *testing.T, host string, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// fakeCertificateConflictRecorder records the certificate conflicts
+// reported, keyed by namespace/name.
+type fakeCertificateConflictRecorder map[string]string
+
+func (r fakeCertificateConflictRecorder) RecordCertificateConflict(namespace, name, message string) {
+	r[namespace+"/"+name] = message
+}
+
+func (r fakeCertificateConflictRecorder) ClearCertificateConflict(namespace, name string) {
+	r[namespace+"/"+name] = ""
+}
+
+func TestCertificateConflicts(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	edge := func(ns, name, host, path string, created time.Time, cert string) (ServiceAliasConfigKey, ServiceAliasConfig) {
+		cfg := ServiceAliasConfig{
+			Name:              name,
+			Namespace:         ns,
+			CreationTimestamp: created,
+			Host:              host,
+			Path:              path,
+			TLSTermination:    routev1.TLSTerminationEdge,
+			Certificates:      map[string]Certificate{},
+		}
+		cfg.Certificates[generateCertKey(&cfg)] = Certificate{ID: generateCertKey(&cfg), Contents: cert, PrivateKey: "key"}
+		return ServiceAliasConfigKey(ns + ":" + name), cfg
+	}
+	shortCert := expiringCertificate(t, "www.example.com", now.Add(30*24*time.Hour))
+	longCert := expiringCertificate(t, "www.example.com", now.Add(300*24*time.Hour))
+	otherCert := expiringCertificate(t, "api.example.com", now.Add(30*24*time.Hour))
+
+	state := map[ServiceAliasConfigKey]ServiceAliasConfig{}
+	for _, route := range []struct {
+		ns, name, host, path string
+		created              time.Time
+		cert                 string
+	}{
+		{"a", "old", "www.example.com", "/", now.Add(-time.Hour), shortCert},
+		{"a", "same", "www.example.com", "/same", now.Add(-time.Minute), shortCert},
+		{"a", "new", "www.example.com", "/new", now, longCert},
+		{"b", "api", "api.example.com", "/", now, otherCert},
+	} {
+		k, cfg := edge(route.ns, route.name, route.host, route.path, route.created, route.cert)
+		state[k] = cfg
+	}
+
+	tests := []struct {
+		policy   string
+		expected map[ServiceAliasConfigKey]CertificateConflict
+	}{
+		{
+			policy: CertificateConflictOldest,
+			expected: map[ServiceAliasConfigKey]CertificateConflict{
+				"a:new": {ServerName: "www.example.com", Winner: "a:old"},
+			},
+		},
+		{
+			policy: CertificateConflictLatestExpiry,
+			expected: map[ServiceAliasConfigKey]CertificateConflict{
+				"a:old":  {ServerName: "www.example.com", Winner: "a:new"},
+				"a:same": {ServerName: "www.example.com", Winner: "a:new"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		conflicts := findCertificateConflicts(state, "/var/lib/haproxy", tc.policy)
+		if !reflect.DeepEqual(conflicts, tc.expected) {
+			t.Errorf("%s: expected the conflicts %v, got %v", tc.policy, tc.expected, conflicts)
+		}
+	}
+
+	// the certificates that lost are left out of the crt-list
+	lines := generateHAProxyCertConfigMap(templateData{
+		WorkingDir:           "/var/lib/haproxy",
+		State:                state,
+		CertificateConflicts: findCertificateConflicts(state, "/var/lib/haproxy", CertificateConflictOldest),
+	})
+	crtList := strings.Join(lines, "\n")
+	if strings.Contains(crtList, "a:new.pem") || !strings.Contains(crtList, "a:old.pem") || !strings.Contains(crtList, "b:api.pem") {
+		t.Errorf("expected the certificate of a:new to be left out of the crt-list, got:\n%s", crtList)
+	}
+
+	// the routes that lose or no longer lose a conflict are reported
+	recorder := fakeCertificateConflictRecorder{}
+	router := NewFakeTemplateRouter()
+	router.dir = "/var/lib/haproxy"
+	router.state = state
+	router.certificateConflictPolicy = CertificateConflictOldest
+	router.certificateConflictRecorder = recorder
+	router.reportCertificateConflicts()
+	if expected := map[string]string{"a/new": "the certificate of route a/old is presented for www.example.com instead"}; !reflect.DeepEqual(map[string]string(recorder), expected) {
+		t.Errorf("expected the conflicts %v to be recorded, got %v", expected, recorder)
+	}
+	delete(recorder, "a/new")
+	router.reportCertificateConflicts()
+	if len(recorder) != 0 {
+		t.Errorf("expected unchanged conflicts not to be recorded again, got %v", recorder)
+	}
+	// a:new is the only route left for the server name
+	delete(router.state, "a:old")
+	delete(router.state, "a:same")
+	router.reportCertificateConflicts()
+	if expected := map[string]string{"a/new": ""}; !reflect.DeepEqual(map[string]string(recorder), expected) {
+		t.Errorf("expected the resolved conflict to be cleared, got %v", recorder)
+	}
+}
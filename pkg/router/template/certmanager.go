@@ -1,11 +1,11 @@
 package templaterouter
 
 import (
-	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	routev1 "github.com/openshift/api/route/v1"
 )
@@ -78,24 +78,14 @@ func (cm *simpleCertificateManager) WriteCertificatesForConfig(config *ServiceAl
 			certObj, ok := config.Certificates[certKey]
 
 			if ok {
-				newLine := []byte("\n")
-
-				//initialize with key and append the newline and cert
-				buffer := bytes.NewBuffer([]byte(certObj.PrivateKey))
-				buffer.Write(newLine)
-				buffer.Write([]byte(certObj.Contents))
-
-				caCertKey := cm.cfg.caCertKeyFunc(config)
-				caCertObj, caOk := config.Certificates[caCertKey]
-
-				if caOk {
-					buffer.Write(newLine)
-					buffer.Write([]byte(caCertObj.Contents))
+				var caCert *Certificate
+				if caCertObj, caOk := config.Certificates[cm.cfg.caCertKeyFunc(config)]; caOk {
+					caCert = &caCertObj
 				}
 
 				certFile := certificateFile{certDir: cm.cfg.certDir, id: certObj.ID}
 				delete(cm.deletedCertificates, certFile.Tag())
-				if err := cm.w.WriteCertificate(cm.cfg.certDir, certObj.ID, buffer.Bytes()); err != nil {
+				if err := cm.w.WriteCertificate(cm.cfg.certDir, certObj.ID, certificatePEM(certObj, caCert)); err != nil {
 					return err
 				}
 			}
@@ -122,14 +112,23 @@ func (cm *simpleCertificateManager) DeleteCertificatesForConfig(config *ServiceA
 	if config == nil {
 		return nil
 	}
+	for _, certFile := range cm.certificateFiles(config) {
+		cm.deletedCertificates[certFile.Tag()] = certFile
+	}
+	return nil
+}
+
+// certificateFiles returns the files the certificates of the
+// ServiceAliasConfig are written to.
+func (cm *simpleCertificateManager) certificateFiles(config *ServiceAliasConfig) []certificateFile {
+	var files []certificateFile
 	if len(config.Certificates) > 0 {
 		if config.TLSTermination == routev1.TLSTerminationEdge || config.TLSTermination == routev1.TLSTerminationReencrypt {
 			certKey := cm.cfg.certKeyFunc(config)
 			certObj, ok := config.Certificates[certKey]
 
 			if ok {
-				certFile := certificateFile{certDir: cm.cfg.certDir, id: certObj.ID}
-				cm.deletedCertificates[certFile.Tag()] = certFile
+				files = append(files, certificateFile{certDir: cm.cfg.certDir, id: certObj.ID})
 			}
 		}
 
@@ -138,8 +137,53 @@ func (cm *simpleCertificateManager) DeleteCertificatesForConfig(config *ServiceA
 			destCert, ok := config.Certificates[destCertKey]
 
 			if ok {
-				destCertFile := certificateFile{certDir: cm.cfg.caCertDir, id: destCert.ID}
-				cm.deletedCertificates[destCertFile.Tag()] = destCertFile
+				files = append(files, certificateFile{certDir: cm.cfg.caCertDir, id: destCert.ID})
+			}
+		}
+	}
+	return files
+}
+
+// ReconcileCertificates rewrites the certificates of configs, whatever their
+// status, and removes every other file of the certificate directories but
+// the ones in keep, so that they only hold the certificates of configs.
+func (cm *simpleCertificateManager) ReconcileCertificates(configs []*ServiceAliasConfig, keep []string) error {
+	expected := make(map[string]bool, len(configs)+len(keep))
+	for _, path := range keep {
+		expected[filepath.Clean(path)] = true
+	}
+	for _, config := range configs {
+		for _, certFile := range cm.certificateFiles(config) {
+			expected[certFile.Tag()] = true
+			delete(cm.deletedCertificates, certFile.Tag())
+		}
+		rewrite := *config
+		rewrite.Status = ""
+		if err := cm.WriteCertificatesForConfig(&rewrite); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{cm.cfg.certDir, cm.cfg.caCertDir} {
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if entry.IsDir() || expected[path] {
+				continue
+			}
+			log.V(0).Info("removing certificate file no route references", "file", path)
+			if id := strings.TrimSuffix(entry.Name(), ".pem"); id != entry.Name() {
+				err = cm.w.DeleteCertificate(dir, id)
+			} else {
+				err = os.Remove(path)
+			}
+			if err != nil {
+				log.V(0).Info("ignoring error removing certificate file", "file", path, "error", err)
 			}
 		}
 	}
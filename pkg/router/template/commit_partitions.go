@@ -0,0 +1,239 @@
+package templaterouter
+
+import (
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCommitPartitionBackoff is the longest the changes of a partition are
+// held back after they prevented the router from reloading.
+const maxCommitPartitionBackoff = 5 * time.Minute
+
+// heldPartition is a partition whose route changes are left out of the
+// commits until retryAt, as they prevented the router from reloading.
+type heldPartition struct {
+	// failures is the number of commits the changes of the partition
+	// failed in a row.
+	failures int
+	retryAt  time.Time
+}
+
+// commitPartitions splits the route changes between partitions of the hosts
+// of the routes.  The routes of a host are always in the same partition.
+// When the changes of a partition prevent the router from reloading, they
+// are held back and retried on a schedule of their own while the changes of
+// the other partitions are committed, so that a broken route only delays
+// the hosts of its partition.
+type commitPartitions struct {
+	count int
+	// retryInterval is how long the changes of a partition are held back
+	// after they first failed, doubling with each further failure.
+	retryInterval time.Duration
+	// held are the partitions held back, by index.
+	held map[int]*heldPartition
+	// retry schedules a commit once held changes are due again.
+	retry func(delay time.Duration)
+
+	// now allows the partitions to be tested.
+	now func() time.Time
+
+	metricHeld prometheus.Gauge
+}
+
+func newCommitPartitions(count int, retryInterval time.Duration) *commitPartitions {
+	if retryInterval < time.Second {
+		retryInterval = time.Second
+	}
+	return &commitPartitions{
+		count:         count,
+		retryInterval: retryInterval,
+		held:          make(map[int]*heldPartition),
+		now:           time.Now,
+		metricHeld: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "template_router",
+			Name:      "held_commit_partitions",
+			Help:      "Number of commit partitions whose route changes are held back because they prevented the router from reloading.",
+		}),
+	}
+}
+
+// partition returns the partition of the routes of a host.
+func (p *commitPartitions) partition(host string) int {
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	return int(h.Sum32() % uint32(p.count))
+}
+
+// changePartition returns the partition of a route change.
+func (p *commitPartitions) changePartition(change pendingRouteChange) int {
+	if change.route != nil {
+		return p.partition(change.route.Spec.Host)
+	}
+	if change.previous != nil {
+		return p.partition(change.previous.Host)
+	}
+	return 0
+}
+
+// isHeld returns true if the changes of a partition are held back now.
+func (p *commitPartitions) isHeld(partition int) bool {
+	held, ok := p.held[partition]
+	return ok && p.now().Before(held.retryAt)
+}
+
+// hold holds back the changes of a partition, for twice as long as the
+// last time if they were held back before.
+func (p *commitPartitions) hold(partition int) time.Duration {
+	held, ok := p.held[partition]
+	if !ok {
+		held = &heldPartition{}
+		p.held[partition] = held
+	}
+	held.failures++
+	delay := p.retryInterval
+	for i := 1; i < held.failures && delay < maxCommitPartitionBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxCommitPartitionBackoff {
+		delay = maxCommitPartitionBackoff
+	}
+	held.retryAt = p.now().Add(delay)
+	p.metricHeld.Set(float64(len(p.held)))
+	if p.retry != nil {
+		p.retry(delay)
+	}
+	return delay
+}
+
+// release forgets the failures of the partitions no longer held back,
+// after their changes were committed.
+func (p *commitPartitions) release() {
+	for partition := range p.held {
+		if !p.isHeld(partition) {
+			delete(p.held, partition)
+		}
+	}
+	p.metricHeld.Set(float64(len(p.held)))
+}
+
+// retryHeldChanges commits the router state again once held changes are
+// due.
+func (r *templateRouter) retryHeldChanges(delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		r.lock.Lock()
+		r.stateChanged = true
+		r.dynamicallyConfigured = false
+		r.lock.Unlock()
+		if r.rateLimitedCommitFunction != nil {
+			r.rateLimitedCommitFunction.RegisterChange()
+		}
+	})
+}
+
+// holdPartitionChanges moves the changes of the partitions held back from
+// the changes about to be committed back to the pending changes.
+// Must be called while holding r.lock
+func (r *templateRouter) holdPartitionChanges(changes map[ServiceAliasConfigKey]pendingRouteChange) {
+	if r.partitions == nil {
+		return
+	}
+	for k, change := range changes {
+		if !r.partitions.isHeld(r.partitions.changePartition(change)) {
+			continue
+		}
+		delete(changes, k)
+		if r.pendingChanges == nil {
+			r.pendingChanges = make(map[ServiceAliasConfigKey]pendingRouteChange)
+		}
+		r.pendingChanges[k] = change
+	}
+}
+
+// writeCommittedConfig writes the configuration of the router state without
+// the pending changes, which are the changes held back while committing.
+// The routes whose changes are committed are saved in the router state.
+// Must be called while holding r.lock
+func (r *templateRouter) writeCommittedConfig() error {
+	if len(r.pendingChanges) == 0 {
+		return r.writeConfig()
+	}
+	current := r.state
+	r.state = r.stateWithChanges(nil)
+	err := r.writeConfig()
+	for k, cfg := range r.state {
+		if _, held := r.pendingChanges[k]; !held {
+			current[k] = cfg
+		}
+	}
+	r.state = current
+	return err
+}
+
+// candidateChanges returns the keys of the pending changes that are not
+// held back, sorted.
+// Must be called while holding r.lock
+func (r *templateRouter) candidateChanges() []ServiceAliasConfigKey {
+	keys := make([]ServiceAliasConfigKey, 0, len(r.pendingChanges))
+	for k, change := range r.pendingChanges {
+		if r.partitions != nil && r.partitions.isHeld(r.partitions.changePartition(change)) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// holdBrokenPartitions is called after a failed reload.  It checks the
+// changes of each partition on their own and holds back the changes of the
+// partitions that make the configuration invalid, so that the changes of
+// the other partitions can be committed right away.  The routes of a
+// partition that fails again once it is retried are left to be rejected if
+// the router rejects the routes that prevent it from reloading.  Returns
+// true if partitions were held back and the remaining state should be
+// committed again.
+func (r *templateRouter) holdBrokenPartitions() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.partitions == nil {
+		return false
+	}
+	byPartition := map[int][]ServiceAliasConfigKey{}
+	for _, k := range r.candidateChanges() {
+		partition := r.partitions.changePartition(r.pendingChanges[k])
+		byPartition[partition] = append(byPartition[partition], k)
+	}
+	if len(byPartition) == 0 {
+		return false
+	}
+	partitions := make([]int, 0, len(byPartition))
+	for partition := range byPartition {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+
+	held := false
+	if err := r.checkState(r.stateWithChanges(nil)); err == nil {
+		for _, partition := range partitions {
+			if _, retried := r.partitions.held[partition]; retried && r.rejectionRecorder != nil {
+				continue
+			}
+			err := r.checkState(r.stateWithChanges(byPartition[partition]))
+			if err == nil {
+				continue
+			}
+			delay := r.partitions.hold(partition)
+			log.V(0).Info("holding back route changes that prevent the router from reloading", "partition", partition, "routes", len(byPartition[partition]), "retryIn", delay.String(), "error", err.Error())
+			held = true
+		}
+	}
+	if err := r.writeConfig(); err != nil {
+		log.Error(err, "unable to restore the router configuration after checking route changes")
+		return false
+	}
+	return held
+}
@@ -0,0 +1,169 @@
+package templaterouter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestCommitPartitions tests that the changes of a partition that prevent
+// the router from reloading are held back and retried with a backoff while
+// the changes of the other partitions are committed.
+func TestCommitPartitions(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	router.metricReload = prometheus.NewSummary(prometheus.SummaryOpts{Name: "reload"})
+	router.metricReloadFailure = prometheus.NewGauge(prometheus.GaugeOpts{Name: "reload_failure"})
+	router.metricWriteConfig = prometheus.NewSummary(prometheus.SummaryOpts{Name: "write_config"})
+	router.partitions = newCommitPartitions(4, time.Second)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	router.partitions.now = func() time.Time { return now }
+	var retries []time.Duration
+	router.partitions.retry = func(delay time.Duration) { retries = append(retries, delay) }
+
+	// The configuration lists the routes, and is invalid if any of them
+	// is broken.
+	router.dir = t.TempDir()
+	router.templates = map[string]*template.Template{
+		"routes": template.Must(template.New("routes").Parse(`{{ range .State }}{{ .Name }}{{ if index .Annotations "test/broken" }} broken{{ end }}
+{{ end }}`)),
+	}
+	written := func() ([]string, error) {
+		data, err := os.ReadFile(filepath.Join(router.dir, "routes"))
+		if err != nil {
+			return nil, err
+		}
+		names := strings.Fields(string(data))
+		for _, name := range names {
+			if name == "broken" {
+				return nil, fmt.Errorf("invalid configuration")
+			}
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	var loaded []string
+	router.checkConfigFn = func() error {
+		_, err := written()
+		return err
+	}
+	router.reloadFn = func(shutdown bool) error {
+		names, err := written()
+		if err == nil {
+			loaded = names
+		}
+		return err
+	}
+
+	// find routes in distinct partitions, and another route in the
+	// partition of the broken one.
+	names := map[int]string{}
+	sibling := ""
+	for i := 0; len(names) < 3 || len(sibling) == 0; i++ {
+		name := fmt.Sprintf("r%d", i)
+		partition := router.partitions.partition(name + ".example.test")
+		if _, ok := names[partition]; !ok && len(names) < 3 {
+			names[partition] = name
+		} else if len(names) == 3 && len(sibling) == 0 && partition == router.partitions.partition(names[partitionOf(names, 0)]+".example.test") {
+			sibling = name
+		}
+	}
+	broken, good1, good2 := names[partitionOf(names, 0)], names[partitionOf(names, 1)], names[partitionOf(names, 2)]
+
+	router.AddRoute(makeFeedbackRoute(good1, false))
+	router.AddRoute(makeFeedbackRoute(broken, true))
+	router.AddRoute(makeFeedbackRoute(good2, false))
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("expected the router to commit the changes of the other partitions, got %v", err)
+	}
+	if expected := sortedNames(good1, good2); fmt.Sprint(loaded) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v to be loaded, got %v", expected, loaded)
+	}
+	if !router.HasRoute(makeFeedbackRoute(broken, true)) {
+		t.Fatalf("expected the held back route to stay in the state")
+	}
+	if len(retries) != 1 || retries[0] != time.Second {
+		t.Fatalf("expected a retry in a second, got %v", retries)
+	}
+
+	// the changes of the held back partition are left out until they are
+	// due, even if its other hosts change.
+	router.AddRoute(makeFeedbackRoute(sibling, false))
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := sortedNames(good1, good2); fmt.Sprint(loaded) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v to be loaded, got %v", expected, loaded)
+	}
+
+	// the partition is held back for longer when it fails again
+	now = now.Add(time.Second)
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(retries) != 2 || retries[1] != 2*time.Second {
+		t.Fatalf("expected a retry in two seconds, got %v", retries)
+	}
+
+	// and committed once it is fixed
+	router.AddRoute(makeFeedbackRoute(broken, false))
+	now = now.Add(2 * time.Second)
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := sortedNames(good1, good2, broken, sibling); fmt.Sprint(loaded) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v to be loaded, got %v", expected, loaded)
+	}
+	if len(router.partitions.held) != 0 || len(router.pendingChanges) != 0 {
+		t.Fatalf("expected no held partitions or pending changes, got %v and %v", router.partitions.held, router.pendingChanges)
+	}
+
+	// a retried partition that fails again has its broken routes rejected
+	// if the router rejects them.
+	recorder := &fakeRejectionRecorder{rejections: map[string]string{}}
+	router.rejectionRecorder = recorder
+	router.AddRoute(makeFeedbackRoute(broken, true))
+	router.AddRoute(makeFeedbackRoute(sibling, true))
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recorder.rejections) != 0 {
+		t.Fatalf("expected the partition to be held back before its routes are rejected, got %v", recorder.rejections)
+	}
+	now = now.Add(time.Second)
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{broken, sibling} {
+		if reason := recorder.rejections["foo/"+name]; reason != "InvalidConfiguration" {
+			t.Errorf("expected route %s to be rejected, got %q", name, reason)
+		}
+	}
+	if expected := sortedNames(good1, good2); fmt.Sprint(loaded) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v to be loaded, got %v", expected, loaded)
+	}
+	if len(router.partitions.held) != 0 {
+		t.Fatalf("expected no held partitions, got %v", router.partitions.held)
+	}
+}
+
+// partitionOf returns the i-th smallest partition of names.
+func partitionOf(names map[int]string, i int) int {
+	partitions := []int{}
+	for partition := range names {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+	return partitions[i]
+}
+
+func sortedNames(names ...string) []string {
+	sort.Strings(names)
+	return names
+}
@@ -227,12 +227,15 @@ func (b *Backend) DisableServer(name string) error {
 	return b.UpdateServerState(name, BackendServerStateMaint)
 }
 
-// Commit commits all the pending changes made to a haproxy backend.
+// Commit commits all the pending changes made to a haproxy backend.  The
+// commands of all the servers are sent in batches.
 func (b *Backend) Commit() error {
+	commands := []string{}
 	for _, s := range b.servers {
-		if err := s.ApplyChanges(b.name, b.client); err != nil {
-			return err
-		}
+		commands = append(commands, s.changeCommands(b.name)...)
+	}
+	if err := b.client.executeChecked(commands, checkServerResponse); err != nil {
+		return err
 	}
 
 	b.Reset()
@@ -321,9 +324,9 @@ func newBackendServer(info BackendServerInfo) *backendServer {
 	}
 }
 
-// ApplyChanges applies all the local backend server changes.
-func (s *backendServer) ApplyChanges(backendName templaterouter.ServiceAliasConfigKey, client *Client) error {
-	// Build the haproxy dynamic config API commands.
+// changeCommands returns the haproxy dynamic config API commands that apply
+// the local backend server changes.
+func (s *backendServer) changeCommands(backendName templaterouter.ServiceAliasConfigKey) []string {
 	commands := []string{}
 
 	cmdPrefix := fmt.Sprintf("%s %s/%s", SetServerCommand, string(backendName), s.Name)
@@ -337,7 +340,6 @@ func (s *backendServer) ApplyChanges(backendName templaterouter.ServiceAliasConf
 	}
 
 	if s.updatedWeight != strconv.Itoa(int(s.CurrentWeight)) {
-		// Build and execute the haproxy dynamic config API command.
 		cmd := fmt.Sprintf("%s weight %s", cmdPrefix, s.updatedWeight)
 		commands = append(commands, cmd)
 	}
@@ -353,24 +355,12 @@ func (s *backendServer) ApplyChanges(backendName templaterouter.ServiceAliasConf
 		commands = append(commands, cmd)
 	}
 
-	// Execute all the commands.
-	for _, cmd := range commands {
-		if err := s.executeCommand(cmd, client); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return commands
 }
 
-// executeCommand runs a server change command and handles the response.
-func (s *backendServer) executeCommand(cmd string, client *Client) error {
-	responseBytes, err := client.Execute(cmd)
-	if err != nil {
-		return err
-	}
-
-	response := strings.TrimSpace(string(responseBytes))
+// checkServerResponse checks the response to a server change command.
+func checkServerResponse(cmd, response string) error {
+	response = strings.TrimSpace(response)
 	if len(response) == 0 {
 		return nil
 	}
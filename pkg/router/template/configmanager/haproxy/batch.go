@@ -0,0 +1,115 @@
+package haproxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxBatchBytes bounds the length of a batch of commands, which haproxy
+	// reads at once into its request buffer.
+	maxBatchBytes = 8192
+
+	// DefaultBatchErrorThreshold is the default share of the commands of a
+	// batch that may fail and be retried one by one.  Above it, the changes
+	// are left to a reload.
+	DefaultBatchErrorThreshold = 0.1
+)
+
+// ExecuteBatch runs haproxy dynamic config API commands and returns their
+// responses.  The commands are separated by semicolons and sent as many at
+// once as fit in a socket write, and haproxy answers each batch in a single
+// response.  The commands must not have a payload nor contain a semicolon.
+func (c *Client) ExecuteBatch(commands []string) ([]string, error) {
+	responses := make([]string, 0, len(commands))
+	for start := 0; start < len(commands); {
+		end, size := start+1, len(commands[start])
+		for end < len(commands) && size+len("; ")+len(commands[end]) <= maxBatchBytes {
+			size += len("; ") + len(commands[end])
+			end++
+		}
+
+		batch := commands[start:end]
+		log.V(4).Info("running haproxy command batch", "commands", len(batch), "bytes", size)
+		buffer, err := c.runCommandWithRetries(strings.Join(batch, "; "), maxRetries)
+		if err != nil {
+			log.V(0).Info("haproxy dynamic config API command batch failed", "commands", len(batch), "error", err)
+			return nil, err
+		}
+		batchResponses, err := splitBatchResponse(buffer.String(), len(batch))
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, batchResponses...)
+		start = end
+	}
+	return responses, nil
+}
+
+// executeChecked runs commands in batches and checks their responses.  The
+// failed commands are retried one by one, unless more of them failed than
+// the error threshold of the client allows, in which case an error is
+// returned so that the changes are applied with a reload instead.
+func (c *Client) executeChecked(commands []string, check func(cmd, response string) error) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	responses, err := c.ExecuteBatch(commands)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	var firstErr error
+	for i, response := range responses {
+		if err := check(commands[i], response); err != nil {
+			failed = append(failed, commands[i])
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if rate := float64(len(failed)) / float64(len(commands)); rate > c.batchErrorThreshold {
+		return fmt.Errorf("%d of %d commands failed, above the error threshold of %v: %v", len(failed), len(commands), c.batchErrorThreshold, firstErr)
+	}
+
+	log.V(4).Info("retrying the failed commands of a batch", "failed", len(failed), "commands", len(commands))
+	for _, cmd := range failed {
+		response, err := c.Execute(cmd)
+		if err != nil {
+			return err
+		}
+		if err := check(cmd, string(response)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBatchResponse splits the response to a batch of n commands into the
+// responses to each command.  haproxy ends the output of every command with
+// an empty line, which no command outputs otherwise; the output of the last
+// command may lack it.
+func splitBatchResponse(response string, n int) ([]string, error) {
+	responses := make([]string, 0, n)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(response, "\n"), "\n") {
+		if len(line) > 0 {
+			lines = append(lines, line)
+			continue
+		}
+		responses = append(responses, strings.Join(lines, "\n"))
+		lines = nil
+	}
+	if len(lines) > 0 || len(responses) == 0 {
+		responses = append(responses, strings.Join(lines, "\n"))
+	}
+
+	if len(responses) != n {
+		return nil, fmt.Errorf("expected %d responses to a batch of commands, got %d", n, len(responses))
+	}
+	return responses, nil
+}
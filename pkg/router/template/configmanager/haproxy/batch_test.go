@@ -0,0 +1,170 @@
+package haproxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	haproxytesting "github.com/openshift/router/pkg/router/template/configmanager/haproxy/testing"
+)
+
+// TestSplitBatchResponse tests splitting the response to a batch of
+// commands.
+func TestSplitBatchResponse(t *testing.T) {
+	testCases := []struct {
+		name      string
+		response  string
+		n         int
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "single empty output",
+			response: "\n",
+			n:        1,
+			expected: []string{""},
+		},
+		{
+			name:     "single output without an empty line",
+			response: "No such server.\n",
+			n:        1,
+			expected: []string{"No such server."},
+		},
+		{
+			name:     "empty and non-empty outputs",
+			response: "\nIP changed from '10.0.0.1' to '10.0.0.2' by 'stats socket command'\n\n\nNo such server.\n\n",
+			n:        4,
+			expected: []string{"", "IP changed from '10.0.0.1' to '10.0.0.2' by 'stats socket command'", "", "No such server."},
+		},
+		{
+			name:     "multi-line output",
+			response: "line 1\nline 2\n\n\n",
+			n:        2,
+			expected: []string{"line 1\nline 2", ""},
+		},
+		{
+			name:      "missing output",
+			response:  "\n\n",
+			n:         3,
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		responses, err := splitBatchResponse(tc.response, tc.n)
+		if tc.expectErr != (err != nil) {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.expectErr, err)
+			continue
+		}
+		if !tc.expectErr && !reflect.DeepEqual(responses, tc.expected) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, responses)
+		}
+	}
+}
+
+// TestClientExecuteBatch tests that the commands of a batch are sent
+// together and their responses matched to them.
+func TestClientExecuteBatch(t *testing.T) {
+	server := haproxytesting.StartFakeServerForTest(t)
+	defer server.Stop()
+
+	client := NewClient(server.SocketFile(), 1)
+	valid := "set server be_edge_http:_hapcm_blueprint_pool:_blueprint-edge-route-1/_dynamic-pod-1 state ready"
+	invalid := "set server be_edge_http:_hapcm_blueprint_pool:_blueprint-edge-route-1/missing state ready"
+
+	// enough commands to need several socket writes
+	commands := []string{}
+	for i := 0; i < 500; i++ {
+		commands = append(commands, valid, invalid)
+	}
+	responses, err := client.ExecuteBatch(commands)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(responses) != len(commands) {
+		t.Fatalf("expected %d responses, got %d", len(commands), len(responses))
+	}
+	for i, response := range responses {
+		expected := ""
+		if commands[i] == invalid {
+			expected = "No such server."
+		}
+		if response != expected {
+			t.Fatalf("expected %q in response to %q, got %q", expected, commands[i], response)
+		}
+	}
+	if n := len(server.Commands()); n != len(commands) {
+		t.Errorf("expected the server to run %d commands, got %d", len(commands), n)
+	}
+}
+
+// TestClientExecuteChecked tests that the failed commands of a batch are
+// retried one by one up to the error threshold of the client.
+func TestClientExecuteChecked(t *testing.T) {
+	server := haproxytesting.StartFakeServerForTest(t)
+	defer server.Stop()
+
+	valid := "set server be_edge_http:_hapcm_blueprint_pool:_blueprint-edge-route-1/_dynamic-pod-1 state ready"
+	invalid := "set server be_edge_http:_hapcm_blueprint_pool:_blueprint-edge-route-1/missing state ready"
+	batch := func(failed int) []string {
+		commands := []string{}
+		for i := 0; i < 10; i++ {
+			if i < failed {
+				commands = append(commands, invalid)
+			} else {
+				commands = append(commands, valid)
+			}
+		}
+		return commands
+	}
+
+	testCases := []struct {
+		name             string
+		threshold        float64
+		commands         []string
+		expectedErr      string
+		expectedCommands int
+	}{
+		{
+			name:             "no failures",
+			threshold:        0.1,
+			commands:         batch(0),
+			expectedCommands: 10,
+		},
+		{
+			name:             "failures within the threshold are retried",
+			threshold:        0.1,
+			commands:         batch(1),
+			expectedErr:      "setting server info",
+			expectedCommands: 11,
+		},
+		{
+			name:             "failures above the threshold are not retried",
+			threshold:        0.1,
+			commands:         batch(2),
+			expectedErr:      "2 of 10 commands failed",
+			expectedCommands: 10,
+		},
+		{
+			name:             "no failures allowed",
+			threshold:        0,
+			commands:         batch(1),
+			expectedErr:      "1 of 10 commands failed",
+			expectedCommands: 10,
+		},
+	}
+	for _, tc := range testCases {
+		server.Reset()
+		client := NewClient(server.SocketFile(), 1)
+		client.batchErrorThreshold = tc.threshold
+		err := client.executeChecked(tc.commands, checkServerResponse)
+		switch {
+		case len(tc.expectedErr) == 0 && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		case len(tc.expectedErr) > 0 && (err == nil || !strings.Contains(err.Error(), tc.expectedErr)):
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.expectedErr, err)
+		}
+		if n := len(server.Commands()); n != tc.expectedCommands {
+			t.Errorf("%s: expected the server to run %d commands, got %d", tc.name, tc.expectedCommands, n)
+		}
+	}
+}
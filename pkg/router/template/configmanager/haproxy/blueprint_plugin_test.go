@@ -60,6 +60,26 @@ func (cm *fakeConfigManager) RemoveRouteEndpoints(id templaterouter.ServiceAlias
 	return nil
 }
 
+func (cm *fakeConfigManager) ReplaceRouteWhitelist(id templaterouter.ServiceAliasConfigKey, whitelistFile string, cidrs []string) error {
+	return nil
+}
+
+func (cm *fakeConfigManager) SetRouteActiveColor(id templaterouter.ServiceAliasConfigKey, backendName, color string) error {
+	return nil
+}
+
+func (cm *fakeConfigManager) SetRouteMaintenance(id templaterouter.ServiceAliasConfigKey, maintenance bool) error {
+	return nil
+}
+
+func (cm *fakeConfigManager) AddCertificate(crtList string, entry templaterouter.CrtListEntry, pem []byte) error {
+	return nil
+}
+
+func (cm *fakeConfigManager) RemoveCertificate(crtList, certFile string) error {
+	return nil
+}
+
 func (cm *fakeConfigManager) Notify(event templaterouter.RouterEventType) {
 }
 
@@ -29,6 +29,10 @@ type Client struct {
 	socketAddress string
 	timeout       int
 
+	// batchErrorThreshold is the share of the commands of a batch that
+	// may fail and be retried one by one.
+	batchErrorThreshold float64
+
 	backends []*Backend
 	maps     map[string]*HAProxyMap
 }
@@ -41,10 +45,11 @@ func NewClient(socketName string, timeout int) *Client {
 	}
 
 	return &Client{
-		socketAddress: sockAddr,
-		timeout:       timeout,
-		backends:      make([]*Backend, 0),
-		maps:          make(map[string]*HAProxyMap),
+		socketAddress:       sockAddr,
+		timeout:             timeout,
+		batchErrorThreshold: DefaultBatchErrorThreshold,
+		backends:            make([]*Backend, 0),
+		maps:                make(map[string]*HAProxyMap),
 	}
 }
 
@@ -72,6 +77,19 @@ func (c *Client) Execute(cmd string) ([]byte, error) {
 	return c.RunCommand(cmd, nil)
 }
 
+// ExecuteWithPayload runs a haproxy dynamic config API command with a
+// multi-line payload, such as the contents of a certificate.  The payload
+// is not logged and must not contain empty lines, which end it.
+func (c *Client) ExecuteWithPayload(cmd, payload string) ([]byte, error) {
+	log.V(4).Info("running haproxy command with a payload", "command", cmd)
+	buffer, err := c.runCommandWithRetries(fmt.Sprintf("%s <<\n%s\n", cmd, payload), maxRetries)
+	if err != nil {
+		log.V(0).Info("haproxy dynamic config API command failed", "command", cmd, "error", err)
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
 // Reset resets any changes and clears the backends and maps.
 func (c *Client) Reset() {
 	c.backends = make([]*Backend, 0)
@@ -191,7 +209,9 @@ func (c *Client) runCommandWithRetries(cmd string, limit int) (*bytes.Buffer, er
 	})
 
 	if cmdErr != nil {
-		log.V(4).Info("failed attempt to run haproxy command", "command", cmd, "attempts", n, "error", cmdErr)
+		// Only the first line is logged, the payload of the command may
+		// hold a private key.
+		log.V(4).Info("failed attempt to run haproxy command", "command", strings.SplitN(cmd, "\n", 2)[0], "attempts", n, "error", cmdErr)
 	}
 
 	return buffer, cmdErr
@@ -96,6 +96,10 @@ type routeBackendEntry struct {
 
 	// DynamicServerMap is a map of all the allocated dynamic servers.
 	dynamicServerMap endpointToDynamicServerMap
+
+	// maintenance indicates if the servers of the route are in
+	// maintenance.
+	maintenance bool
 }
 
 // haproxyConfigManager is a template router config manager implementation
@@ -156,6 +160,7 @@ type haproxyConfigManager struct {
 // NewHAProxyConfigManager returns a new haproxyConfigManager.
 func NewHAProxyConfigManager(options templaterouter.ConfigManagerOptions) *haproxyConfigManager {
 	client := NewClient(options.ConnectionInfo, haproxyConnectionTimeout)
+	client.batchErrorThreshold = options.BatchErrorThreshold
 
 	log.V(4).Info("creating new manager", "manager", haproxyManagerName, "options", options)
 
@@ -461,24 +466,27 @@ func (cm *haproxyConfigManager) ReplaceRouteEndpoints(id templaterouter.ServiceA
 		return err
 	}
 
+	// The endpoints are keyed by the name of their server, which is the
+	// slot of their service if the router names the servers so: a new
+	// endpoint in the slot of a deleted one takes over its server.
 	modifiedEndpoints := make(map[string]templaterouter.Endpoint)
 	for _, ep := range newEndpoints {
-		modifiedEndpoints[ep.ID] = ep
+		modifiedEndpoints[ep.ServerName()] = ep
 	}
 
 	deletedEndpoints := make(map[string]templaterouter.Endpoint)
 	for _, ep := range oldEndpoints {
-		if v2ep, ok := modifiedEndpoints[ep.ID]; ok {
+		if v2ep, ok := modifiedEndpoints[ep.ServerName()]; ok {
 			if reflect.DeepEqual(ep, v2ep) {
 				// endpoint was unchanged.
-				delete(modifiedEndpoints, v2ep.ID)
+				delete(modifiedEndpoints, v2ep.ServerName())
 			}
 			if ep.AppProtocol != v2ep.AppProtocol && (ep.AppProtocol == "h2c" || v2ep.AppProtocol == "h2c") {
 				return fmt.Errorf("endpoint %s changed appProtocol from %q to %q, and dynamically updating proto is unsupported", ep.ID, ep.AppProtocol, v2ep.AppProtocol)
 			}
 		} else {
 			configChanged = true
-			deletedEndpoints[ep.ID] = ep
+			deletedEndpoints[ep.ServerName()] = ep
 		}
 	}
 
@@ -521,7 +529,11 @@ func (cm *haproxyConfigManager) ReplaceRouteEndpoints(id templaterouter.ServiceA
 			configChanged = true
 			log.V(4).Info("enabling server for modified endpoint", "endpoint", relatedEndpointID, "server", s.Name, "ip", ep.IP, "port", ep.Port, "appProtocol", ep.AppProtocol, "weight", weight)
 			backend.UpdateServerInfo(s.Name, ep.IP, ep.Port, ep.AppProtocol, weight, weightIsRelative)
-			backend.EnableServer(s.Name)
+			if entry.maintenance {
+				backend.DisableServer(s.Name)
+			} else {
+				backend.EnableServer(s.Name)
+			}
 
 			delete(modifiedEndpoints, relatedEndpointID)
 		}
@@ -544,13 +556,17 @@ func (cm *haproxyConfigManager) ReplaceRouteEndpoints(id templaterouter.ServiceA
 
 		// Add entry for the dyamic server used.
 		configChanged = true
-		entry.dynamicServerMap[name] = ep.ID
+		entry.dynamicServerMap[name] = ep.ServerName()
 
 		log.V(4).Info("enabling server for added endpoint", "endpoint", ep.ID, "server", name, "ip", ep.IP, "port", ep.Port, "appProtocol", ep.AppProtocol, "weight", weight)
 		backend.UpdateServerInfo(name, ep.IP, ep.Port, ep.AppProtocol, weight, weightIsRelative)
-		backend.EnableServer(name)
+		if entry.maintenance {
+			backend.DisableServer(name)
+		} else {
+			backend.EnableServer(name)
+		}
 
-		delete(modifiedEndpoints, ep.ID)
+		delete(modifiedEndpoints, ep.ServerName())
 	}
 
 	// If we got here, then either we are done with all the endpoints or
@@ -590,7 +606,7 @@ func (cm *haproxyConfigManager) RemoveRouteEndpoints(id templaterouter.ServiceAl
 		return err
 	}
 
-	// Build a reversed map (endpoint id -> server name) to allow us to
+	// Build a reversed map (endpoint server -> dynamic server) to allow us to
 	// search by endpoint.
 	endpointToDynServerMap := make(map[string]string)
 	for serverName, endpointID := range entry.dynamicServerMap {
@@ -598,8 +614,8 @@ func (cm *haproxyConfigManager) RemoveRouteEndpoints(id templaterouter.ServiceAl
 	}
 
 	for _, ep := range endpoints {
-		name := ep.ID
-		if serverName, ok := endpointToDynServerMap[ep.ID]; ok {
+		name := ep.ServerName()
+		if serverName, ok := endpointToDynServerMap[name]; ok {
 			name = serverName
 			delete(entry.dynamicServerMap, name)
 		}
@@ -612,6 +628,241 @@ func (cm *haproxyConfigManager) RemoveRouteEndpoints(id templaterouter.ServiceAl
 	return backend.Commit()
 }
 
+// ReplaceRouteWhitelist replaces the allowed source addresses in the acl file
+// used by a route.
+func (cm *haproxyConfigManager) ReplaceRouteWhitelist(id templaterouter.ServiceAliasConfigKey, whitelistFile string, cidrs []string) error {
+	log.V(4).Info("replacing route whitelist", "id", id, "file", whitelistFile, "entries", len(cidrs))
+	if cm.isReloading() {
+		return fmt.Errorf("Router reload in progress, cannot dynamically replace whitelist for route id %s", id)
+	}
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	// The new entries are added to a new version of the acl, which only
+	// replaces the current one once it is complete, so that the route is
+	// never left without a whitelist.  An error preparing the acl most
+	// likely means the running configuration does not reference the file
+	// yet.
+	responseBytes, err := cm.client.Execute(fmt.Sprintf("prepare acl %s", whitelistFile))
+	if err != nil {
+		return err
+	}
+	match := prepareVersionRE.FindStringSubmatch(string(responseBytes))
+	if match == nil {
+		return fmt.Errorf("preparing whitelist for route id %s: %s", id, strings.TrimSpace(string(responseBytes)))
+	}
+	version := match[1]
+
+	commands := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		commands = append(commands, fmt.Sprintf("add acl @%s %s %s", version, whitelistFile, cidr))
+	}
+	if err := cm.client.executeChecked(commands, func(cmd, response string) error {
+		if response = strings.TrimSpace(response); len(response) > 0 {
+			return fmt.Errorf("replacing whitelist for route id %s: %s", id, response)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	responseBytes, err = cm.client.Execute(fmt.Sprintf("commit acl @%s %s", version, whitelistFile))
+	if err != nil {
+		return err
+	}
+	if response := strings.TrimSpace(string(responseBytes)); len(response) > 0 {
+		return fmt.Errorf("committing whitelist for route id %s: %s", id, response)
+	}
+	return nil
+}
+
+// SetRouteActiveColor points the entries of the backend maps for a route
+// whose services are split into a blue and a green set at the haproxy
+// backend of the given color.  The entries may be in any shard of a map.
+func (cm *haproxyConfigManager) SetRouteActiveColor(id templaterouter.ServiceAliasConfigKey, backendName, color string) error {
+	log.V(4).Info("setting route active color", "id", id, "backend", backendName, "color", color)
+	if cm.isReloading() {
+		return fmt.Errorf("Router reload in progress, cannot dynamically switch the active color for route id %s", id)
+	}
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	haproxyMaps, err := cm.client.Maps()
+	if err != nil {
+		return err
+	}
+
+	colors := []string{backendName + ":" + routeapihelpers.ColorBlue, backendName + ":" + routeapihelpers.ColorGreen}
+	count := 0
+	for _, ham := range haproxyMaps {
+		name := path.Base(ham.Name())
+		if base, ok := mapShardBase(name); ok {
+			name = base
+		}
+		if name != "os_http_be.map" && name != "os_edge_reencrypt_be.map" {
+			continue
+		}
+		n, err := ham.SetValues(colors, backendName+":"+color)
+		if err != nil {
+			return err
+		}
+		count += n
+	}
+	if count == 0 {
+		return fmt.Errorf("no map entries found for route id %s", id)
+	}
+	return nil
+}
+
+// SetRouteMaintenance puts the servers of a haproxy backend in maintenance,
+// or makes them ready again.  The unused dynamic servers are left disabled.
+func (cm *haproxyConfigManager) SetRouteMaintenance(id templaterouter.ServiceAliasConfigKey, maintenance bool) error {
+	log.V(4).Info("setting route maintenance", "id", id, "maintenance", maintenance)
+	if cm.isReloading() {
+		return fmt.Errorf("Router reload in progress, cannot dynamically change maintenance for route id %s", id)
+	}
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	entry, ok := cm.backendEntries[id]
+	if !ok {
+		// Not registered - return error back.
+		return fmt.Errorf("route id %s was not registered", id)
+	}
+
+	backendName := entry.BackendName()
+	log.V(4).Info("finding backend", "backend", backendName)
+	backend, err := cm.client.FindBackend(backendName)
+	if err != nil {
+		return err
+	}
+
+	servers, err := backend.Servers()
+	if err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if _, used := entry.dynamicServerMap[s.Name]; isDynamicBackendServer(s) && !used {
+			continue
+		}
+		if maintenance {
+			backend.DisableServer(s.Name)
+		} else {
+			backend.EnableServer(s.Name)
+		}
+	}
+
+	log.V(4).Info("committing backend", "backend", backendName)
+	if err := backend.Commit(); err != nil {
+		return err
+	}
+	entry.maintenance = maintenance
+	return nil
+}
+
+// AddCertificate loads a certificate in haproxy from its PEM contents and
+// adds its entry to a crt-list, so that the frontends serve it without a
+// reload.  A certificate that is already loaded, from the crt-list of the
+// last reload or an earlier addition, has its contents and entry replaced.
+func (cm *haproxyConfigManager) AddCertificate(crtList string, entry templaterouter.CrtListEntry, pem []byte) error {
+	log.V(4).Info("adding certificate", "crtList", crtList, "certFile", entry.CertFile)
+	if cm.isReloading() {
+		return fmt.Errorf("Router reload in progress, cannot dynamically add certificate %s", entry.CertFile)
+	}
+
+	line := entry.String()
+	if strings.ContainsAny(line, "\r\n") {
+		return fmt.Errorf("invalid crt-list entry %q", line)
+	}
+	payload := certificatePayload(pem)
+	if len(payload) == 0 {
+		return fmt.Errorf("certificate %s is empty", entry.CertFile)
+	}
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	response, err := cm.client.Execute(fmt.Sprintf("new ssl cert %s", entry.CertFile))
+	if err != nil {
+		return err
+	}
+	if strings.Contains(string(response), "already exists") {
+		// The entry is added again below with the options and SNI
+		// filters of the certificate, which may have changed.
+		if err := cm.executeExpecting(fmt.Sprintf("del ssl crt-list %s %s", crtList, entry.CertFile), "deleted"); err != nil {
+			return err
+		}
+	} else if !strings.Contains(string(response), "New empty") {
+		return fmt.Errorf("creating certificate %s: %s", entry.CertFile, strings.TrimSpace(string(response)))
+	}
+
+	response, err = cm.client.ExecuteWithPayload(fmt.Sprintf("set ssl cert %s", entry.CertFile), payload)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(response), "Transaction") {
+		return fmt.Errorf("setting certificate %s: %s", entry.CertFile, strings.TrimSpace(string(response)))
+	}
+	if err := cm.executeExpecting(fmt.Sprintf("commit ssl cert %s", entry.CertFile), "Success"); err != nil {
+		cm.client.Execute(fmt.Sprintf("abort ssl cert %s", entry.CertFile))
+		return err
+	}
+
+	response, err = cm.client.ExecuteWithPayload(fmt.Sprintf("add ssl crt-list %s", crtList), line)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(response), "Success") {
+		return fmt.Errorf("adding certificate %s to crt-list %s: %s", entry.CertFile, crtList, strings.TrimSpace(string(response)))
+	}
+	return nil
+}
+
+// RemoveCertificate removes the entry of a certificate file from a crt-list
+// and unloads the certificate from haproxy.
+func (cm *haproxyConfigManager) RemoveCertificate(crtList, certFile string) error {
+	log.V(4).Info("removing certificate", "crtList", crtList, "certFile", certFile)
+	if cm.isReloading() {
+		return fmt.Errorf("Router reload in progress, cannot dynamically remove certificate %s", certFile)
+	}
+
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+
+	if err := cm.executeExpecting(fmt.Sprintf("del ssl crt-list %s %s", crtList, certFile), "deleted"); err != nil {
+		return err
+	}
+	return cm.executeExpecting(fmt.Sprintf("del ssl cert %s", certFile), "deleted")
+}
+
+// executeExpecting runs a haproxy dynamic config API command and checks
+// that its response contains expected.
+func (cm *haproxyConfigManager) executeExpecting(cmd, expected string) error {
+	response, err := cm.client.Execute(cmd)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(response), expected) {
+		return fmt.Errorf("%s: %s", cmd, strings.TrimSpace(string(response)))
+	}
+	return nil
+}
+
+// certificatePayload returns the PEM contents of a certificate as a runtime
+// API payload, without the empty lines that would end it.
+func certificatePayload(pem []byte) string {
+	var lines []string
+	for _, line := range strings.Split(string(pem), "\n") {
+		if line = strings.TrimRight(line, "\r"); len(strings.TrimSpace(line)) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // Notify informs the config manager of any template router state changes.
 // We only care about the reload specific events.
 func (cm *haproxyConfigManager) Notify(event templaterouter.RouterEventType) {
@@ -750,6 +1001,13 @@ func (cm *haproxyConfigManager) processMapAssociations(associations haproxyMapAs
 
 	for _, ham := range haproxyMaps {
 		name := path.Base(ham.Name())
+		// The entries of a map split into shards may belong to any of
+		// them, so they are only changed by a reload.
+		if base, ok := mapShardBase(name); ok {
+			if _, ok := associations[base]; ok {
+				return fmt.Errorf("map %s is split into shards", base)
+			}
+		}
 		if entries, ok := associations[name]; ok {
 			log.V(4).Info("applying to map", "name", name, "entries", entries)
 			if err := applyMapAssociations(ham, entries, add); err != nil {
@@ -761,6 +1019,20 @@ func (cm *haproxyConfigManager) processMapAssociations(associations haproxyMapAs
 	return nil
 }
 
+// mapShardBase returns the name of the map a shard such as os_http_be.1.map
+// was split from, and false if name is not a shard.
+func mapShardBase(name string) (string, bool) {
+	base := strings.TrimSuffix(name, ".map")
+	i := strings.LastIndex(base, ".")
+	if i < 0 || base == name {
+		return "", false
+	}
+	if _, err := strconv.Atoi(base[i+1:]); err != nil {
+		return "", false
+	}
+	return base[:i] + ".map", true
+}
+
 // findFreeBackendPoolSlot returns a free pool slot backend name.
 func (cm *haproxyConfigManager) findFreeBackendPoolSlot(blueprint *routev1.Route) (templaterouter.ServiceAliasConfigKey, error) {
 	poolSize := getPoolSize(blueprint, cm.blueprintRoutePoolSize)
@@ -849,8 +1121,13 @@ func (cm *haproxyConfigManager) findMatchingBlueprint(route *routev1.Route) *rou
 		if tlsSpec != nil && candidate.Spec.TLS != nil {
 			// So we need compare the TLS fields but don't care
 			// if InsecureEdgeTerminationPolicy doesn't match.
+			// Nor about the certificate of the route, which is
+			// added to the crt-list with the route.
 			candidateCopy := candidate.DeepCopy()
 			candidateCopy.Spec.TLS.InsecureEdgeTerminationPolicy = tlsSpec.InsecureEdgeTerminationPolicy
+			candidateCopy.Spec.TLS.Certificate = tlsSpec.Certificate
+			candidateCopy.Spec.TLS.Key = tlsSpec.Key
+			candidateCopy.Spec.TLS.CACertificate = tlsSpec.CACertificate
 			if reflect.DeepEqual(tlsSpec, candidateCopy.Spec.TLS) {
 				return candidateCopy
 			}
@@ -893,6 +1170,9 @@ func (entry *routeBackendEntry) BuildMapAssociations(route *routev1.Route) {
 	if len(hostspec) == 0 {
 		return
 	}
+	if host, err := routeapihelpers.ASCIIHost(hostspec); err == nil {
+		hostspec = host
+	}
 
 	name := entry.BackendName()
 
@@ -1097,6 +1377,8 @@ func modAnnotationsList(termination routev1.TLSTerminationType) []string {
 		"haproxy.router.openshift.io/rate-limit-connections.rate-tcp",
 		"haproxy.router.openshift.io/rate-limit-connections.rate-http",
 		"haproxy.router.openshift.io/pod-concurrent-connections",
+		"haproxy.router.openshift.io/max-queue",
+		"haproxy.router.openshift.io/client-concurrent-connections",
 		"router.openshift.io/haproxy.health.check.interval",
 	}
 
@@ -1109,5 +1391,26 @@ func modAnnotationsList(termination routev1.TLSTerminationType) []string {
 	annotations = append(annotations, "haproxy.router.openshift.io/hsts_header")
 	annotations = append(annotations, "haproxy.router.openshift.io/rewrite-target")
 	annotations = append(annotations, "router.openshift.io/cookie-same-site")
+	annotations = append(annotations, "router.openshift.io/cookie-secure")
+	annotations = append(annotations, "router.openshift.io/cookie-httponly")
+	annotations = append(annotations, "router.openshift.io/cookie-path")
+	annotations = append(annotations, "router.openshift.io/cookie-max-age")
+	annotations = append(annotations, "haproxy.router.openshift.io/allow-sni-host-mismatch")
+	annotations = append(annotations, "haproxy.router.openshift.io/alpn")
+	annotations = append(annotations, "haproxy.router.openshift.io/http-reuse")
+	annotations = append(annotations, "haproxy.router.openshift.io/pool-max-conn")
+	annotations = append(annotations, "haproxy.router.openshift.io/pool-purge-delay")
+	annotations = append(annotations, "haproxy.router.openshift.io/response-header-policy")
+	annotations = append(annotations, "haproxy.router.openshift.io/deny-rules")
+	annotations = append(annotations, "haproxy.router.openshift.io/external-server-check")
+	annotations = append(annotations, "haproxy.router.openshift.io/external-server-verify-hostname")
+	annotations = append(annotations, "haproxy.router.openshift.io/external-server-proxy-protocol")
+	annotations = append(annotations, "haproxy.router.openshift.io/waf")
+	annotations = append(annotations, "haproxy.router.openshift.io/consistent-hash")
+	annotations = append(annotations, "haproxy.router.openshift.io/cache-ttl")
+	annotations = append(annotations, "haproxy.router.openshift.io/cache-max-object-size")
+	annotations = append(annotations, "haproxy.router.openshift.io/cache-size")
+	annotations = append(annotations, "haproxy.router.openshift.io/queue-full-retry-after")
+	annotations = append(annotations, "haproxy.router.openshift.io/set-forwarded-headers")
 	return annotations
 }
@@ -0,0 +1,92 @@
+package haproxy
+
+import (
+	"reflect"
+	"testing"
+
+	templaterouter "github.com/openshift/router/pkg/router/template"
+	haproxytesting "github.com/openshift/router/pkg/router/template/configmanager/haproxy/testing"
+)
+
+// TestManagerCertificates tests that certificates are loaded, replaced and
+// unloaded through the runtime API along with their crt-list entries.
+func TestManagerCertificates(t *testing.T) {
+	server := haproxytesting.StartFakeServerForTest(t)
+	defer server.Stop()
+
+	cm := NewHAProxyConfigManager(templaterouter.ConfigManagerOptions{ConnectionInfo: server.SocketFile()})
+	crtList := "/var/lib/haproxy/conf/cert_config.map"
+	certFile := "/var/lib/haproxy/router/certs/ns:web.pem"
+	entry := templaterouter.CrtListEntry{
+		CertFile:   certFile,
+		Options:    []string{"alpn h2,http/1.1"},
+		SNIFilters: []string{"www.example.com"},
+	}
+
+	if err := cm.AddCertificate(crtList, entry, []byte("key\n\ncert\n")); err != nil {
+		t.Fatalf("unexpected error adding the certificate: %v", err)
+	}
+	if contents, ok := server.Certificate(certFile); !ok || contents != "key\ncert" {
+		t.Errorf("expected the certificate to be loaded without empty lines, got %q", contents)
+	}
+	if lines := server.CrtList(crtList); !reflect.DeepEqual(lines, []string{entry.String()}) {
+		t.Errorf("expected the crt-list entry %q, got %v", entry.String(), lines)
+	}
+
+	// A certificate that is loaded already is replaced with its entry.
+	entry.SNIFilters = []string{"web.example.com"}
+	if err := cm.AddCertificate(crtList, entry, []byte("key2\ncert2")); err != nil {
+		t.Fatalf("unexpected error replacing the certificate: %v", err)
+	}
+	if contents, _ := server.Certificate(certFile); contents != "key2\ncert2" {
+		t.Errorf("expected the certificate to be replaced, got %q", contents)
+	}
+	if lines := server.CrtList(crtList); !reflect.DeepEqual(lines, []string{entry.String()}) {
+		t.Errorf("expected the crt-list entry to be replaced with %q, got %v", entry.String(), lines)
+	}
+
+	if err := cm.RemoveCertificate(crtList, certFile); err != nil {
+		t.Fatalf("unexpected error removing the certificate: %v", err)
+	}
+	if _, ok := server.Certificate(certFile); ok {
+		t.Errorf("expected the certificate to be unloaded")
+	}
+	if lines := server.CrtList(crtList); len(lines) != 0 {
+		t.Errorf("expected the crt-list entry to be removed, got %v", lines)
+	}
+	if err := cm.RemoveCertificate(crtList, certFile); err == nil {
+		t.Errorf("expected an error removing a certificate that is not loaded")
+	}
+
+	entry.SNIFilters = []string{"www.example.com\nbind :80"}
+	if err := cm.AddCertificate(crtList, entry, []byte("key\ncert")); err == nil {
+		t.Errorf("expected an error adding an entry with a line break")
+	}
+}
+
+// TestManagerReplaceRouteWhitelist tests that the whitelist of a route is
+// replaced through a new version of its acl.
+func TestManagerReplaceRouteWhitelist(t *testing.T) {
+	server := haproxytesting.StartFakeServerForTest(t)
+	defer server.Stop()
+
+	cm := NewHAProxyConfigManager(templaterouter.ConfigManagerOptions{ConnectionInfo: server.SocketFile()})
+	whitelistFile := "/var/lib/haproxy/router/whitelists/ns:web.txt"
+	cidrs := []string{"10.0.0.0/8", "192.168.1.1"}
+	if err := cm.ReplaceRouteWhitelist("ns:web", whitelistFile, cidrs); err != nil {
+		t.Fatalf("unexpected error replacing the whitelist: %v", err)
+	}
+	if patterns := server.ACL(whitelistFile); !reflect.DeepEqual(patterns, cidrs) {
+		t.Errorf("expected the whitelist %v, got %v", cidrs, patterns)
+	}
+
+	expected := []string{
+		"prepare acl " + whitelistFile,
+		"add acl @1 " + whitelistFile + " 10.0.0.0/8",
+		"add acl @1 " + whitelistFile + " 192.168.1.1",
+		"commit acl @1 " + whitelistFile,
+	}
+	if commands := server.Commands(); !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected commands %q, got %q", expected, commands)
+	}
+}
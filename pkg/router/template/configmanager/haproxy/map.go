@@ -5,7 +5,10 @@ import (
 	"regexp"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	templaterouter "github.com/openshift/router/pkg/router/template"
+	templateutil "github.com/openshift/router/pkg/router/template/util"
 )
 
 const (
@@ -18,8 +21,20 @@ const (
 	// output from haproxy, so that we can parse the CSV output.
 	// Note: This should match the CSV tags used in HAProxyMapEntry.
 	showMapHeader = "id name value"
+
+	// mapKeyPortExpr separates the host from the port and path in the
+	// keys of the haproxy maps generated for routes.
+	mapKeyPortExpr = "(:[0-9]+)?"
+
+	// mapKeyWildcardPrefix is the prefix of the keys of the haproxy maps
+	// generated for wildcard routes.
+	mapKeyWildcardPrefix = `^[^\.]*\.`
 )
 
+// prepareVersionRE matches the response to "prepare map" and "prepare acl",
+// which holds the version of the map or acl that is being prepared.
+var prepareVersionRE = regexp.MustCompile(`New version created: ([0-9]+)`)
+
 type mapListEntry struct {
 	ID     string `csv:"id"`
 	Name   string `csv:"(file)"`
@@ -135,6 +150,10 @@ func (m *HAProxyMap) Find(k string) ([]HAProxyMapEntry, error) {
 
 // Add adds a new key and value to the haproxy map and allows all previous
 // entries in the map to be deleted (replaced).
+// haproxy appends entries added at runtime to the map, so an entry that has
+// to be matched before existing ones (e.g. a new path for an existing host)
+// is added by replacing the map with one in the same order as the map file
+// generated on reload.
 func (m *HAProxyMap) Add(k string, v templaterouter.ServiceAliasConfigKey, replace bool) error {
 	if replace {
 		if err := m.Delete(k); err != nil {
@@ -142,6 +161,18 @@ func (m *HAProxyMap) Add(k string, v templaterouter.ServiceAliasConfigKey, repla
 		}
 	}
 
+	if m.dirty {
+		if err := m.Refresh(); err != nil {
+			return err
+		}
+	}
+
+	lines, shadowed := orderMapEntries(m.entries, k, string(v))
+	if shadowed {
+		log.V(4).Info("replacing map to keep entries ordered", "name", m.name, "key", k)
+		return m.replaceEntries(lines)
+	}
+
 	return m.addEntry(k, v)
 }
 
@@ -184,6 +215,109 @@ func (m *HAProxyMap) addEntry(k string, v templaterouter.ServiceAliasConfigKey)
 	return nil
 }
 
+// SetValues sets the value of the entries of the haproxy map whose value is
+// one of oldValues, and returns how many entries were set.
+func (m *HAProxyMap) SetValues(oldValues []string, value string) (int, error) {
+	if m.dirty {
+		if err := m.Refresh(); err != nil {
+			return 0, err
+		}
+	}
+
+	old := sets.NewString(oldValues...)
+	count := 0
+	for _, entry := range m.entries {
+		if !old.Has(entry.Value) {
+			continue
+		}
+		cmd := fmt.Sprintf("set map %s #%s %s", m.name, entry.ID, value)
+		responseBytes, err := m.client.Execute(cmd)
+		if err != nil {
+			return count, err
+		}
+		if response := strings.TrimSpace(string(responseBytes)); len(response) > 0 {
+			return count, fmt.Errorf("setting map %s entry %s: %v", m.name, entry.Name, response)
+		}
+		count++
+	}
+	if count > 0 {
+		m.dirty = true
+	}
+	return count, nil
+}
+
+// replaceEntries atomically replaces all the entries of the haproxy map
+// with lines, each holding a key and a value separated by a space.
+func (m *HAProxyMap) replaceEntries(lines []string) error {
+	responseBytes, err := m.client.Execute(fmt.Sprintf("prepare map %s", m.name))
+	if err != nil {
+		return err
+	}
+	match := prepareVersionRE.FindStringSubmatch(string(responseBytes))
+	if match == nil {
+		return fmt.Errorf("preparing map %s: %v", m.name, strings.TrimSpace(string(responseBytes)))
+	}
+	version := match[1]
+
+	m.dirty = true
+	for _, line := range lines {
+		parts := strings.SplitN(line, " ", 2)
+		cmd := fmt.Sprintf("add map @%s %s %s %s", version, m.name, escapeKeyExpr(parts[0]), parts[1])
+		responseBytes, err := m.client.Execute(cmd)
+		if err != nil {
+			return err
+		}
+		if response := strings.TrimSpace(string(responseBytes)); len(response) > 0 {
+			return fmt.Errorf("adding map %s version %s entry %s: %v", m.name, version, parts[0], response)
+		}
+	}
+
+	responseBytes, err = m.client.Execute(fmt.Sprintf("commit map @%s %s", version, m.name))
+	if err != nil {
+		return err
+	}
+	if response := strings.TrimSpace(string(responseBytes)); len(response) > 0 {
+		return fmt.Errorf("committing map %s version %s: %v", m.name, version, response)
+	}
+	return nil
+}
+
+// orderMapEntries returns the entries of a map with a new entry for key k
+// and value v, in the order used for the map files.  Also returns whether
+// appending the new entry to the map would have it shadowed by an existing
+// entry that matches the same host.
+func orderMapEntries(entries []*HAProxyMapEntry, k, v string) ([]string, bool) {
+	newLine := fmt.Sprintf("%s %s", k, v)
+	lines := []string{newLine}
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf("%s %s", entry.Name, entry.Value))
+	}
+	lines = templateutil.SortMapPaths(lines, mapKeyWildcardPrefix)
+
+	host := mapKeyHost(k)
+	after := false
+	for _, line := range lines {
+		if after {
+			key := strings.SplitN(line, " ", 2)[0]
+			if strings.HasPrefix(key, mapKeyWildcardPrefix) || mapKeyHost(key) == host {
+				return lines, true
+			}
+		}
+		if line == newLine {
+			after = true
+		}
+	}
+	return lines, false
+}
+
+// mapKeyHost returns the host part of a map key.
+func mapKeyHost(k string) string {
+	if i := strings.Index(k, mapKeyPortExpr); i >= 0 {
+		return k[:i]
+	}
+	return k
+}
+
 // deleteEntry removes a specific haproxy map entry.
 func (m *HAProxyMap) deleteEntry(id string) error {
 	cmd := fmt.Sprintf("del map %s #%s", m.name, id)
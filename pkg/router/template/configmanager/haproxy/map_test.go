@@ -1,6 +1,8 @@
 package haproxy
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	templaterouter "github.com/openshift/router/pkg/router/template"
@@ -842,3 +844,104 @@ func TestHAProxyMapDeleteEntry(t *testing.T) {
 		}
 	}
 }
+
+// TestOrderMapEntries tests ordering new haproxy map entries.
+func TestOrderMapEntries(t *testing.T) {
+	entries := []*HAProxyMapEntry{
+		{ID: "1", Name: `^www\.example\.com\.?(:[0-9]+)?(/.*)?$`, Value: "be_edge_http:ns:www"},
+		{ID: "2", Name: `^api\.example\.com\.?(:[0-9]+)?(/.*)?$`, Value: "be_edge_http:ns:api"},
+	}
+
+	testCases := []struct {
+		name             string
+		entries          []*HAProxyMapEntry
+		key              string
+		value            string
+		expectedShadowed bool
+		expectedLines    []string
+	}{
+		{
+			name:    "new host",
+			entries: entries,
+			key:     `^new\.example\.com\.?(:[0-9]+)?(/.*)?$`,
+			value:   "be_edge_http:ns:new",
+			expectedLines: []string{
+				`^www\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:www`,
+				`^new\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:new`,
+				`^api\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:api`,
+			},
+		},
+		{
+			name:             "new path for existing host",
+			entries:          entries,
+			key:              `^api\.example\.com\.?(:[0-9]+)?/v2(/.*)?$`,
+			value:            "be_edge_http:ns:api-v2",
+			expectedShadowed: true,
+			expectedLines: []string{
+				`^www\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:www`,
+				`^api\.example\.com\.?(:[0-9]+)?/v2(/.*)?$ be_edge_http:ns:api-v2`,
+				`^api\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:api`,
+			},
+		},
+		{
+			name: "new host covered by a wildcard",
+			entries: []*HAProxyMapEntry{
+				{ID: "1", Name: `^[^\.]*\.example\.com\.?(:[0-9]+)?(/.*)?$`, Value: "be_edge_http:ns:wildcard"},
+			},
+			key:              `^new\.example\.com\.?(:[0-9]+)?(/.*)?$`,
+			value:            "be_edge_http:ns:new",
+			expectedShadowed: true,
+			expectedLines: []string{
+				`^new\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:new`,
+				`^[^\.]*\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:wildcard`,
+			},
+		},
+		{
+			name:  "empty map",
+			key:   `^new\.example\.com\.?(:[0-9]+)?(/.*)?$`,
+			value: "be_edge_http:ns:new",
+			expectedLines: []string{
+				`^new\.example\.com\.?(:[0-9]+)?(/.*)?$ be_edge_http:ns:new`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		lines, shadowed := orderMapEntries(tc.entries, tc.key, tc.value)
+		if shadowed != tc.expectedShadowed {
+			t.Errorf("TestOrderMapEntries test case %s expected shadowed=%v but got %v", tc.name, tc.expectedShadowed, shadowed)
+		}
+		if !reflect.DeepEqual(lines, tc.expectedLines) {
+			t.Errorf("TestOrderMapEntries test case %s expected lines %q but got %q", tc.name, tc.expectedLines, lines)
+		}
+	}
+}
+
+// TestHAProxyMapAddPath tests that adding a path for an existing host
+// replaces the haproxy map so that the new entry is matched first.
+func TestHAProxyMapAddPath(t *testing.T) {
+	server := haproxytesting.StartFakeServerForTest(t)
+	defer server.Stop()
+
+	client := NewClient(server.SocketFile(), 0)
+	m := newHAProxyMap("/var/lib/haproxy/conf/os_http_be.map", client)
+	if err := m.Add(`^route\.allow-http\.test(:[0-9]+)?/path(/.*)?$`, "be_edge_http:default:test-http-path", true); err != nil {
+		t.Fatalf("TestHAProxyMapAddPath expected no error but got: %v", err)
+	}
+
+	commands := []string{}
+	for _, cmd := range server.Commands() {
+		if !strings.HasPrefix(cmd, "show map") {
+			commands = append(commands, cmd)
+		}
+	}
+	expected := []string{
+		`prepare map /var/lib/haproxy/conf/os_http_be.map`,
+		`add map @1 /var/lib/haproxy/conf/os_http_be.map ^route\\\.allow-http\\\.test(:[0-9]+)?/path(/\.*)?$ be_edge_http:default:test-http-path`,
+		`add map @1 /var/lib/haproxy/conf/os_http_be.map ^route\\\.allow-http\\\.test(:[0-9]+)?(/\.*)?$ be_edge_http:default:test-http-allow`,
+		`commit map @1 /var/lib/haproxy/conf/os_http_be.map`,
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("TestHAProxyMapAddPath expected commands %q but got %q", expected, commands)
+	}
+}
@@ -31,10 +31,16 @@ type fakeHAProxy struct {
 	socketFile  string
 	backendName string
 	maps        map[string]fakeHAProxyMap
+	versions    map[string]fakeHAProxyMap
+	version     int
 	backends    map[string]string
 	lock        sync.Mutex
 	shutdown    bool
 	commands    []string
+	certs       map[string]string
+	crtLists    map[string][]string
+	acls        map[string][]string
+	aclVersions map[string][]string
 }
 
 func startFakeHAProxyServer(prefix string) (*fakeHAProxy, error) {
@@ -67,9 +73,14 @@ func newFakeHAProxy(sockFile, backendName string) *fakeHAProxy {
 		socketFile:  sockFile,
 		backendName: backendName,
 		maps:        make(map[string]fakeHAProxyMap, 0),
+		versions:    make(map[string]fakeHAProxyMap, 0),
 		backends:    make(map[string]string, 0),
 		shutdown:    false,
 		commands:    make([]string, 0),
+		certs:       make(map[string]string),
+		crtLists:    make(map[string][]string),
+		acls:        make(map[string][]string),
+		aclVersions: make(map[string][]string),
 	}
 	p.initialize()
 	return p
@@ -88,6 +99,29 @@ func (p *fakeHAProxy) Reset() {
 	p.initialize()
 }
 
+// CrtList returns the entries of a crt-list.
+func (p *fakeHAProxy) CrtList(name string) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.crtLists[name]
+}
+
+// ACL returns the committed patterns of an acl.
+func (p *fakeHAProxy) ACL(name string) []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.acls[name]
+}
+
+// Certificate returns the committed contents of a certificate and whether
+// it is loaded.
+func (p *fakeHAProxy) Certificate(name string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	contents, ok := p.certs[name]
+	return contents, ok
+}
+
 func (p *fakeHAProxy) Commands() []string {
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -277,6 +311,74 @@ func (p *fakeHAProxy) addMap(name, k, v string) string {
 	return strings.Join(lines, "\n")
 }
 
+func (p *fakeHAProxy) prepareMap(name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.maps[name]; !ok {
+		return "Unknown map identifier. Please use #<id> or <file>.\n"
+	}
+	p.version++
+	p.versions[fmt.Sprintf("@%d %s", p.version, name)] = make(fakeHAProxyMap)
+	return fmt.Sprintf("New version created: %d\n", p.version)
+}
+
+func (p *fakeHAProxy) addMapVersion(version, name, k, v string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m, ok := p.versions[fmt.Sprintf("%s %s", version, name)]
+	if !ok {
+		return "Unknown version.\n"
+	}
+	m[k] = fmt.Sprintf("0x%x %s %s", len(m)+1, k, v)
+	return ""
+}
+
+func (p *fakeHAProxy) commitMap(version, name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := fmt.Sprintf("%s %s", version, name)
+	m, ok := p.versions[key]
+	if !ok {
+		return "Unknown version.\n"
+	}
+	delete(p.versions, key)
+	p.maps[name] = m
+	return ""
+}
+
+func (p *fakeHAProxy) prepareACL(name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.version++
+	p.aclVersions[fmt.Sprintf("@%d %s", p.version, name)] = []string{}
+	return fmt.Sprintf("New version created: %d\n", p.version)
+}
+
+func (p *fakeHAProxy) addACLVersion(version, name, pattern string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := fmt.Sprintf("%s %s", version, name)
+	patterns, ok := p.aclVersions[key]
+	if !ok {
+		return "Unknown version.\n"
+	}
+	p.aclVersions[key] = append(patterns, pattern)
+	return ""
+}
+
+func (p *fakeHAProxy) commitACL(version, name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := fmt.Sprintf("%s %s", version, name)
+	patterns, ok := p.aclVersions[key]
+	if !ok {
+		return "Unknown version.\n"
+	}
+	delete(p.aclVersions, key)
+	p.acls[name] = patterns
+	return ""
+}
+
 func (p *fakeHAProxy) delMap(name, id string) string {
 	id = strings.Trim(id, "#")
 	p.lock.Lock()
@@ -388,8 +490,68 @@ func (p *fakeHAProxy) setServer(name string, options []string) string {
 	return fmt.Sprintf("\n")
 }
 
+func (p *fakeHAProxy) newCert(name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.certs[name]; ok {
+		return fmt.Sprintf("'new ssl cert' : certificate '%s' already exists!\n", name)
+	}
+	p.certs[name] = ""
+	return fmt.Sprintf("New empty certificate store '%s'!\n", name)
+}
+
+func (p *fakeHAProxy) setCert(name, payload string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.certs[name]; !ok {
+		return fmt.Sprintf("Can't replace a certificate which is not referenced by the configuration!\n")
+	}
+	p.certs[name] = payload
+	return fmt.Sprintf("Transaction created for certificate %s!\n", name)
+}
+
+func (p *fakeHAProxy) addCrtList(name, line string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	cert := strings.Fields(line)[0]
+	if _, ok := p.certs[cert]; !ok {
+		return fmt.Sprintf("certificate '%s' does not exist!\n", cert)
+	}
+	p.crtLists[name] = append(p.crtLists[name], line)
+	return fmt.Sprintf("Inserting certificate '%s' in crt-list '%s'.\nSuccess!\n", cert, name)
+}
+
+func (p *fakeHAProxy) delCrtList(name, cert string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, line := range p.crtLists[name] {
+		if strings.Fields(line)[0] == cert {
+			p.crtLists[name] = append(p.crtLists[name][:i], p.crtLists[name][i+1:]...)
+			return fmt.Sprintf("Entry '%s' deleted in crtlist '%s'!\n", cert, name)
+		}
+	}
+	return fmt.Sprintf("error: entry '%s' not found in crtlist '%s'!\n", cert, name)
+}
+
+func (p *fakeHAProxy) delCert(name string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, lines := range p.crtLists {
+		for _, line := range lines {
+			if strings.Fields(line)[0] == name {
+				return fmt.Sprintf("certificate '%s' in use, can't be deleted!\n", name)
+			}
+		}
+	}
+	if _, ok := p.certs[name]; !ok {
+		return fmt.Sprintf("certificate '%s' doesn't exist!\n", name)
+	}
+	delete(p.certs, name)
+	return fmt.Sprintf("Certificate '%s' deleted!\n", name)
+}
+
 func (p *fakeHAProxy) process(conn net.Conn) error {
-	readBuffer := make([]byte, 1024)
+	readBuffer := make([]byte, 65536)
 	nread, err := conn.Read(readBuffer)
 	if err != nil {
 		response := fmt.Sprintf("error: %v", err)
@@ -397,13 +559,37 @@ func (p *fakeHAProxy) process(conn net.Conn) error {
 		return err
 	}
 
-	response := ""
 	cmd := string(bytes.Trim(readBuffer[0:nread], " "))
 	cmd = strings.Trim(cmd, "\n")
+
+	response := ""
+	if strings.Contains(cmd, "; ") && !strings.Contains(cmd, "\n") {
+		// Like haproxy, end the output of each command of a batch with
+		// an empty line.
+		for _, c := range strings.Split(cmd, "; ") {
+			if output := strings.TrimRight(p.run(c), "\n"); len(output) > 0 {
+				response += output + "\n\n"
+			} else {
+				response += "\n"
+			}
+		}
+	} else {
+		response = p.run(cmd)
+	}
+
+	if _, err := conn.Write([]byte(response)); err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// run records and runs a single command and returns its output.
+func (p *fakeHAProxy) run(cmd string) string {
 	p.lock.Lock()
 	p.commands = append(p.commands, cmd)
 	p.lock.Unlock()
 
+	response := ""
 	if strings.HasPrefix(cmd, "show info") {
 		response = p.showInfo()
 	} else if strings.HasPrefix(cmd, "show map") {
@@ -420,9 +606,41 @@ func (p *fakeHAProxy) process(conn net.Conn) error {
 		vals := strings.Split(params, " ")
 		if len(vals) < 3 {
 			response = fmt.Sprintf("'add map' expects three parameters: map identifier, key and value.\n")
+		} else if strings.HasPrefix(vals[0], "@") {
+			if len(vals) < 4 {
+				response = fmt.Sprintf("'add map' expects three parameters: map identifier, key and value.\n")
+			} else {
+				response = p.addMapVersion(vals[0], vals[1], vals[2], vals[3])
+			}
 		} else {
 			response = p.addMap(vals[0], vals[1], vals[2])
 		}
+	} else if strings.HasPrefix(cmd, "prepare map") {
+		response = p.prepareMap(strings.Trim(cmd[len("prepare map"):], " "))
+	} else if strings.HasPrefix(cmd, "commit map") {
+		params := strings.Trim(cmd[len("commit map"):], " ")
+		vals := strings.Split(params, " ")
+		if len(vals) < 2 {
+			response = fmt.Sprintf("'commit map' expects a version and a map identifier.\n")
+		} else {
+			response = p.commitMap(vals[0], vals[1])
+		}
+	} else if strings.HasPrefix(cmd, "prepare acl") {
+		response = p.prepareACL(strings.Trim(cmd[len("prepare acl"):], " "))
+	} else if strings.HasPrefix(cmd, "add acl") {
+		vals := strings.Fields(cmd[len("add acl"):])
+		if len(vals) < 3 || !strings.HasPrefix(vals[0], "@") {
+			response = fmt.Sprintf("'add acl' expects a version, an acl identifier and a pattern.\n")
+		} else {
+			response = p.addACLVersion(vals[0], vals[1], vals[2])
+		}
+	} else if strings.HasPrefix(cmd, "commit acl") {
+		vals := strings.Fields(cmd[len("commit acl"):])
+		if len(vals) < 2 {
+			response = fmt.Sprintf("'commit acl' expects a version and an acl identifier.\n")
+		} else {
+			response = p.commitACL(vals[0], vals[1])
+		}
 	} else if strings.HasPrefix(cmd, "del map") {
 		params := strings.Trim(cmd[len("del map"):], " ")
 		vals := strings.Split(params, " ")
@@ -442,12 +660,37 @@ func (p *fakeHAProxy) process(conn net.Conn) error {
 			name = vals[0]
 		}
 		response = p.setServer(name, vals[1:])
+	} else if strings.HasPrefix(cmd, "new ssl cert ") {
+		response = p.newCert(strings.TrimSpace(cmd[len("new ssl cert "):]))
+	} else if strings.HasPrefix(cmd, "set ssl cert ") {
+		lines := strings.SplitN(cmd, "\n", 2)
+		if len(lines) < 2 {
+			response = fmt.Sprintf("'set ssl cert' expects a filename and a certificate as a payload\n")
+		} else {
+			response = p.setCert(strings.TrimSpace(strings.TrimSuffix(lines[0][len("set ssl cert "):], "<<")), lines[1])
+		}
+	} else if strings.HasPrefix(cmd, "commit ssl cert ") {
+		response = fmt.Sprintf("Committing %s.\nSuccess!\n", strings.TrimSpace(cmd[len("commit ssl cert "):]))
+	} else if strings.HasPrefix(cmd, "abort ssl cert ") {
+		response = fmt.Sprintf("Transaction aborted for certificate '%s'!\n", strings.TrimSpace(cmd[len("abort ssl cert "):]))
+	} else if strings.HasPrefix(cmd, "add ssl crt-list ") {
+		lines := strings.SplitN(cmd, "\n", 2)
+		if len(lines) < 2 {
+			response = fmt.Sprintf("'add ssl crt-list' expects a filename and a certificate name\n")
+		} else {
+			response = p.addCrtList(strings.TrimSpace(strings.TrimSuffix(lines[0][len("add ssl crt-list "):], "<<")), lines[1])
+		}
+	} else if strings.HasPrefix(cmd, "del ssl crt-list ") {
+		vals := strings.Fields(cmd[len("del ssl crt-list "):])
+		if len(vals) < 2 {
+			response = fmt.Sprintf("'del ssl crt-list' expects a filename and a certificate name\n")
+		} else {
+			response = p.delCrtList(vals[0], vals[1])
+		}
+	} else if strings.HasPrefix(cmd, "del ssl cert ") {
+		response = p.delCert(strings.TrimSpace(cmd[len("del ssl cert "):]))
 	} else {
 		response = fmt.Sprintf("Unknown command. Please enter one of the following commands only :\nhelp\n...\n")
 	}
-
-	if _, err := conn.Write([]byte(response)); err != nil {
-		return err
-	}
-	return conn.Close()
+	return response
 }
@@ -0,0 +1,96 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+	routertesting "github.com/openshift/router/pkg/router/testing"
+)
+
+// renderConsistentHashBackends renders routes whose service has endpoints
+// at ips, and returns the backend sections of the routes keyed by name.
+func renderConsistentHashBackends(t *testing.T, routes []*routev1.Route, ips []string) map[string]string {
+	t.Helper()
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	state := renderer.RouteState(routes)
+	var addresses []kapi.EndpointAddress
+	for _, ip := range ips {
+		addresses = append(addresses, kapi.EndpointAddress{IP: ip})
+	}
+	renderer.AddEndpoints(state, &kapi.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cache"},
+		Subsets:    []kapi.EndpointSubset{{Addresses: addresses, Ports: []kapi.EndpointPort{{Port: 8080}}}},
+	}, false, nil)
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	var config string
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" {
+			config = string(file.Contents)
+		}
+	}
+
+	backends := map[string]string{}
+	for _, route := range routes {
+		backend := "backend be_edge_http:ns:" + route.Name
+		section, ok := routertesting.Section(config, backend)
+		if !ok {
+			t.Fatalf("%s not found", backend)
+		}
+		backends[route.Name] = section
+	}
+	return backends
+}
+
+// serverLines returns the server lines of a backend section keyed by the
+// address of the server.
+func serverLines(section string) map[string]string {
+	servers := map[string]string{}
+	for _, line := range strings.Split(section, "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "server" {
+			servers[fields[2]] = line
+		}
+	}
+	return servers
+}
+
+func TestConsistentHashEndpointChurn(t *testing.T) {
+	routes := []*routev1.Route{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "cache", Annotations: map[string]string{routeapihelpers.ConsistentHashAnnotation: "uri"}},
+		Spec: routev1.RouteSpec{
+			Host: "cache.example.com",
+			To:   routev1.RouteTargetReference{Name: "cache"},
+			TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+		},
+	}}
+
+	// An endpoint is replaced: the servers that stay must keep the
+	// positions on the hash ring, which only depend on the server lines.
+	before := serverLines(renderConsistentHashBackends(t, routes, []string{"10.128.0.1", "10.128.0.2", "10.128.0.3"})["cache"])
+	after := serverLines(renderConsistentHashBackends(t, routes, []string{"10.128.0.1", "10.128.0.3", "10.128.0.4"})["cache"])
+	if len(before) != 3 || len(after) != 3 {
+		t.Fatalf("expected 3 servers before and after, got %v and %v", before, after)
+	}
+	for _, addr := range []string{"10.128.0.1:8080", "10.128.0.3:8080"} {
+		if before[addr] != after[addr] {
+			t.Errorf("expected the server at %s to be unchanged, got %q and %q", addr, before[addr], after[addr])
+		}
+		if !strings.Contains(after[addr], " hash-key addr-port") {
+			t.Errorf("expected the server at %s to be hashed by address: %s", addr, after[addr])
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package templaterouter
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	haproxyutil "github.com/openshift/router/pkg/router/template/util/haproxy"
+)
+
+// CrtListEntry is an entry of the crt-list the frontends that terminate TLS
+// load the certificates of the routes from.
+type CrtListEntry struct {
+	// CertFile is the file of the certificate, with its private key and CA
+	// chain.
+	CertFile string
+
+	// Options are the SSL options the certificate is served with, such as
+	// the ALPN protocols negotiated with the clients.
+	Options []string
+
+	// SNIFilters are the server names the certificate is presented for.
+	SNIFilters []string
+}
+
+// String returns the crt-list line of the entry.
+func (e CrtListEntry) String() string {
+	fields := []string{e.CertFile}
+	if len(e.Options) > 0 {
+		fields = append(fields, "["+strings.Join(e.Options, " ")+"]")
+	}
+	return strings.Join(append(fields, e.SNIFilters...), " ")
+}
+
+// crtListPath returns the path of the crt-list under workingDir.
+func crtListPath(workingDir string) string {
+	return filepath.Join(workingDir, "conf", certConfigMap)
+}
+
+// crtListEntry returns the crt-list entry of the certificate of a route, if
+// the route has one.
+func crtListEntry(workingDir string, key ServiceAliasConfigKey, cfg *ServiceAliasConfig, disableHTTP2 bool) (CrtListEntry, bool) {
+	hascert := false
+	if len(cfg.Host) > 0 {
+		cert, ok := cfg.Certificates[generateCertKey(cfg)]
+		hascert = ok && len(cert.Contents) > 0
+	}
+
+	entry := haproxyutil.GenerateMapEntry(certConfigMap, backendConfig(string(key), *cfg, hascert))
+	if entry == nil {
+		return CrtListEntry{}, false
+	}
+	crtListEntry := CrtListEntry{
+		CertFile:   filepath.Join(workingDir, certDir, entry.Key),
+		SNIFilters: []string{entry.Value},
+	}
+	switch {
+	case len(cfg.ALPNProtocols) > 0:
+		crtListEntry.Options = []string{"alpn " + strings.Join(cfg.ALPNProtocols, ",")}
+	case !disableHTTP2:
+		crtListEntry.Options = []string{"alpn h2,http/1.1"}
+	}
+	return crtListEntry, true
+}
+
+// certificatePEM returns the contents of the certificate file of a route:
+// its private key, its certificate and its CA certificate, if any.
+func certificatePEM(cert Certificate, caCert *Certificate) []byte {
+	newLine := []byte("\n")
+
+	buffer := bytes.NewBuffer([]byte(cert.PrivateKey))
+	buffer.Write(newLine)
+	buffer.Write([]byte(cert.Contents))
+	if caCert != nil {
+		buffer.Write(newLine)
+		buffer.Write([]byte(caCert.Contents))
+	}
+	return buffer.Bytes()
+}
+
+// dynamicallyAddCertificate loads the certificate of a route in haproxy and
+// adds its entry to the crt-list with the dynamic config manager.  Returns
+// true if the route has no certificate or if it was added.
+// Must be called while holding r.lock
+func (r *templateRouter) dynamicallyAddCertificate(backendKey ServiceAliasConfigKey, cfg *ServiceAliasConfig) bool {
+	entry, ok := crtListEntry(r.dir, backendKey, cfg, r.disableHTTP2)
+	if !ok {
+		return true
+	}
+	if r.hasCertificateConflict(backendKey, cfg) {
+		log.V(4).Info("router will reload as another route supplies a different certificate for the same server name", "backendKey", backendKey)
+		return false
+	}
+	if ocspUpdateEnabled(r.haproxyCapabilities) {
+		// haproxy only updates the OCSP responses of the certificates it
+		// loads from the crt-list.
+		log.V(4).Info("router will reload to update the OCSP responses of the route certificate", "backendKey", backendKey)
+		return false
+	}
+	entry = versionedCrtListOptions(entry, r.haproxyCapabilities)
+
+	cert := cfg.Certificates[generateCertKey(cfg)]
+	var caCert *Certificate
+	if ca, ok := cfg.Certificates[generateCACertKey(cfg)]; ok {
+		caCert = &ca
+	}
+	if err := r.dynamicConfigManager.AddCertificate(crtListPath(r.dir), entry, certificatePEM(cert, caCert)); err != nil {
+		log.V(4).Info("router will reload as the ConfigManager could not dynamically add the route certificate", "backendKey", backendKey, "error", err)
+		return false
+	}
+	return true
+}
+
+// dynamicallyRemoveCertificate removes the crt-list entry of the certificate
+// of a route and unloads it from haproxy with the dynamic config manager.
+// Returns true if the route has no certificate or if it was removed.
+// Must be called while holding r.lock
+func (r *templateRouter) dynamicallyRemoveCertificate(backendKey ServiceAliasConfigKey, cfg *ServiceAliasConfig) bool {
+	entry, ok := crtListEntry(r.dir, backendKey, cfg, false)
+	if !ok {
+		return true
+	}
+	if r.hasCertificateConflict(backendKey, cfg) {
+		log.V(4).Info("router will reload as another route supplies a different certificate for the same server name", "backendKey", backendKey)
+		return false
+	}
+	if err := r.dynamicConfigManager.RemoveCertificate(crtListPath(r.dir), entry.CertFile); err != nil {
+		log.V(4).Info("router will reload as the ConfigManager could not dynamically remove the route certificate", "backendKey", backendKey, "error", err)
+		return false
+	}
+	return true
+}
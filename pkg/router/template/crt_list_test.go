@@ -0,0 +1,128 @@
+package templaterouter
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// crtListConfigManager is a ConfigManager that adds routes and records the
+// certificates added to and removed from the crt-list.
+type crtListConfigManager struct {
+	whitelistConfigManager
+	entries map[string]string
+	pems    map[string]string
+	certErr error
+}
+
+func (cm *crtListConfigManager) AddRoute(id ServiceAliasConfigKey, routingKey string, route *routev1.Route) error {
+	return nil
+}
+
+func (cm *crtListConfigManager) AddCertificate(crtList string, entry CrtListEntry, pem []byte) error {
+	if cm.certErr != nil {
+		return cm.certErr
+	}
+	cm.entries[entry.CertFile] = crtList + " " + entry.String()
+	cm.pems[entry.CertFile] = string(pem)
+	return nil
+}
+
+func (cm *crtListConfigManager) RemoveCertificate(crtList, certFile string) error {
+	if cm.certErr != nil {
+		return cm.certErr
+	}
+	delete(cm.entries, certFile)
+	return nil
+}
+
+func TestCrtListEntry(t *testing.T) {
+	cfg := &ServiceAliasConfig{
+		Host:           "www.example.com",
+		TLSTermination: routev1.TLSTerminationEdge,
+		Certificates: map[string]Certificate{
+			"www.example.com": {ID: "ns:web", Contents: "cert"},
+		},
+	}
+	entry, ok := crtListEntry("/var/lib/haproxy", "ns:web", cfg, false)
+	if !ok {
+		t.Fatalf("expected an entry for a route with a certificate")
+	}
+	if expected := "/var/lib/haproxy/router/certs/ns:web.pem [alpn h2,http/1.1] www.example.com"; entry.String() != expected {
+		t.Errorf("expected %q, got %q", expected, entry.String())
+	}
+
+	cfg.IsWildcard = true
+	if entry, _ := crtListEntry("/var/lib/haproxy", "ns:web", cfg, true); entry.String() != "/var/lib/haproxy/router/certs/ns:web.pem *.example.com" {
+		t.Errorf("unexpected wildcard entry without HTTP/2 %q", entry.String())
+	}
+
+	cfg.ALPNProtocols = []string{"http/1.1"}
+	if entry, _ := crtListEntry("/var/lib/haproxy", "ns:web", cfg, false); entry.String() != "/var/lib/haproxy/router/certs/ns:web.pem [alpn http/1.1] *.example.com" {
+		t.Errorf("unexpected entry with the ALPN protocols of the route %q", entry.String())
+	}
+	cfg.ALPNProtocols = nil
+
+	cfg.TLSTermination = routev1.TLSTerminationPassthrough
+	if _, ok := crtListEntry("/var/lib/haproxy", "ns:web", cfg, false); ok {
+		t.Errorf("expected no entry for a passthrough route")
+	}
+}
+
+// TestDynamicCertificates tests that the certificates of the routes added
+// and removed without a reload are added to and removed from the crt-list.
+func TestDynamicCertificates(t *testing.T) {
+	cm := &crtListConfigManager{
+		whitelistConfigManager: whitelistConfigManager{whitelists: map[string][]string{}},
+		entries:                map[string]string{},
+		pems:                   map[string]string{},
+	}
+	router := NewFakeTemplateRouter()
+	router.dir = "/var/lib/haproxy"
+	router.dynamicConfigManager = cm
+	router.synced = true
+	router.dynamicallyConfigured = true
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: routev1.RouteSpec{
+			Host: "www.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+			TLS: &routev1.TLSConfig{
+				Termination:   routev1.TLSTerminationEdge,
+				Certificate:   "cert",
+				Key:           "key",
+				CACertificate: "ca",
+			},
+		},
+	}
+	router.AddRoute(route)
+
+	certFile := "/var/lib/haproxy/router/certs/ns:web.pem"
+	if expected := "/var/lib/haproxy/conf/cert_config.map " + certFile + " [alpn h2,http/1.1] www.example.com"; cm.entries[certFile] != expected {
+		t.Errorf("expected crt-list entry %q, got %v", expected, cm.entries)
+	}
+	if expected := "key\ncert\nca"; cm.pems[certFile] != expected {
+		t.Errorf("expected the certificate %q, got %q", expected, cm.pems[certFile])
+	}
+	if !router.dynamicallyConfigured {
+		t.Errorf("expected the route to be added without a reload")
+	}
+
+	router.RemoveRoute(route)
+	if len(cm.entries) != 0 {
+		t.Errorf("expected the crt-list entry to be removed, got %v", cm.entries)
+	}
+	if !router.dynamicallyConfigured {
+		t.Errorf("expected the route to be removed without a reload")
+	}
+
+	cm.certErr = fmt.Errorf("reload in progress")
+	router.AddRoute(route)
+	if router.dynamicallyConfigured {
+		t.Errorf("expected a reload when the certificate cannot be added")
+	}
+}
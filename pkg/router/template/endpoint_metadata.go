@@ -0,0 +1,89 @@
+package templaterouter
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// endpointMetadataVarPattern matches the characters of label keys that
+	// haproxy variable names cannot have.
+	endpointMetadataVarPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	// endpointMetadataHeaderPattern matches the characters of label keys
+	// that header names should not have.
+	endpointMetadataHeaderPattern = regexp.MustCompile(`[^A-Za-z0-9-]`)
+)
+
+// EndpointMetadataConfig configures the metadata of the endpoints that
+// served a request that is made available to the logs and response headers.
+type EndpointMetadataConfig struct {
+	// Enabled sets the txn.endpoint_pod, txn.endpoint_zone,
+	// txn.endpoint_node and txn.endpoint_label_<label> variables of the
+	// requests of HTTP routes to the metadata of the endpoint that served
+	// them, for custom log formats.
+	Enabled bool
+
+	// Labels are the pod labels that are made available, so that only a
+	// bounded set of values ends up in the logs and headers.
+	Labels []string
+
+	// Headers also sets the X-Endpoint-Pod, X-Endpoint-Zone,
+	// X-Endpoint-Node and X-Endpoint-Label-<label> response headers.
+	Headers bool
+}
+
+// EndpointMetadataField is a metadata field of the endpoints.
+type EndpointMetadataField struct {
+	// Index is the position of the field in the endpoint metadata map
+	// values, starting at 1.
+	Index int
+	// Var is the name of the transaction variable set to the field.
+	Var string
+	// Header is the response header set to the field.
+	Header string
+}
+
+// Fields returns the metadata fields of the endpoints, in the order of the
+// values of the endpoint metadata map.
+func (c EndpointMetadataConfig) Fields() []EndpointMetadataField {
+	fields := []EndpointMetadataField{
+		{Index: 1, Var: "endpoint_pod", Header: "X-Endpoint-Pod"},
+		{Index: 2, Var: "endpoint_zone", Header: "X-Endpoint-Zone"},
+		{Index: 3, Var: "endpoint_node", Header: "X-Endpoint-Node"},
+	}
+	for _, label := range c.Labels {
+		fields = append(fields, EndpointMetadataField{
+			Index:  len(fields) + 1,
+			Var:    "endpoint_label_" + endpointMetadataVarPattern.ReplaceAllString(label, "_"),
+			Header: "X-Endpoint-Label-" + endpointMetadataHeaderPattern.ReplaceAllString(label, "-"),
+		})
+	}
+	return fields
+}
+
+// MetadataValue returns the value of the endpoint in the endpoint metadata
+// map: its pod, zone, node and the values of labels, separated by "|", which
+// none of them can contain.  Returns an empty string if the endpoint has no
+// metadata.
+func (e Endpoint) MetadataValue(labels []string) string {
+	values := []string{"", e.Zone, e.NodeName}
+	if strings.HasPrefix(e.ID, "pod:") {
+		values[0] = e.TargetName
+	}
+	for _, label := range labels {
+		values = append(values, e.Labels[label])
+	}
+	if len(strings.Join(values, "")) == 0 {
+		return ""
+	}
+	return strings.Join(values, "|")
+}
+
+// addEndpointLabels sets the labels of the pods of endpoints in namespace.
+func addEndpointLabels(namespace string, endpoints []Endpoint, lookup PodLabelLookup) {
+	for i := range endpoints {
+		if strings.HasPrefix(endpoints[i].ID, "pod:") {
+			endpoints[i].Labels = lookup.LookupPodLabels(namespace, endpoints[i].TargetName)
+		}
+	}
+}
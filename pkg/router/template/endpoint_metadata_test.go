@@ -0,0 +1,211 @@
+package templaterouter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+)
+
+type fakePodLabelLookup map[string]map[string]string
+
+func (l fakePodLabelLookup) LookupPodLabels(namespace, name string) map[string]string {
+	return l[namespace+"/"+name]
+}
+
+func (l fakePodLabelLookup) SetNamespaces(namespaces sets.String) {}
+
+func (l fakePodLabelLookup) OnLabelsChanged(changed func(namespace string)) {}
+
+func TestEndpointMetadataFields(t *testing.T) {
+	config := EndpointMetadataConfig{Enabled: true, Labels: []string{"app.kubernetes.io/version", "track"}}
+	expected := []EndpointMetadataField{
+		{Index: 1, Var: "endpoint_pod", Header: "X-Endpoint-Pod"},
+		{Index: 2, Var: "endpoint_zone", Header: "X-Endpoint-Zone"},
+		{Index: 3, Var: "endpoint_node", Header: "X-Endpoint-Node"},
+		{Index: 4, Var: "endpoint_label_app_kubernetes_io_version", Header: "X-Endpoint-Label-app-kubernetes-io-version"},
+		{Index: 5, Var: "endpoint_label_track", Header: "X-Endpoint-Label-track"},
+	}
+	if fields := config.Fields(); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected fields %v, got %v", expected, fields)
+	}
+}
+
+func TestEndpointMetadataValue(t *testing.T) {
+	labels := []string{"version", "track"}
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		expected string
+	}{
+		{
+			name:     "pod",
+			endpoint: Endpoint{ID: "pod:web-1:svc:http:10.0.0.1:8080", TargetName: "web-1", Zone: "zone-a", NodeName: "node-1", Labels: map[string]string{"track": "canary"}},
+			expected: "web-1|zone-a|node-1||canary",
+		},
+		{
+			name:     "external address",
+			endpoint: Endpoint{ID: "ept:svc:192.0.2.1:8080", TargetName: "192.0.2.1"},
+		},
+		{
+			name:     "external address with a zone",
+			endpoint: Endpoint{ID: "ept:svc:192.0.2.1:8080", TargetName: "192.0.2.1", Zone: "zone-b"},
+			expected: "|zone-b|||",
+		},
+	}
+	for _, tc := range tests {
+		if value := tc.endpoint.MetadataValue(labels); value != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, value)
+		}
+	}
+}
+
+func TestEndpointMetadataTemplate(t *testing.T) {
+	routes := []*routev1.Route{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: routev1.RouteSpec{
+			Host: "web.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}}
+	node := "node-1"
+	endpoints := &kapi.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        "svc",
+			Annotations: map[string]string{endpointsubset.ZonesAnnotation: "10.128.0.5=zone-a"},
+		},
+		Subsets: []kapi.EndpointSubset{{
+			Addresses: []kapi.EndpointAddress{
+				{IP: "10.128.0.5", NodeName: &node, TargetRef: &kapi.ObjectReference{Kind: "Pod", Name: "web-1"}},
+				{IP: "192.0.2.20"},
+			},
+			Ports: []kapi.EndpointPort{{Port: 8080, Protocol: kapi.ProtocolTCP}},
+		}},
+	}
+	lookup := fakePodLabelLookup{"ns/web-1": {"track": "canary"}}
+
+	render := func(metadata EndpointMetadataConfig) map[string]string {
+		t.Helper()
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath:     "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:       "/var/lib/haproxy",
+			BindPorts:        true,
+			EndpointMetadata: metadata,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		state := renderer.RouteState(routes)
+		renderer.AddEndpoints(state, endpoints, true, nil)
+		for id, serviceUnit := range state.ServiceUnits {
+			addEndpointLabels("ns", serviceUnit.EndpointTable, lookup)
+			state.ServiceUnits[id] = serviceUnit
+		}
+		files, err := renderer.Render(state)
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		contents := map[string]string{}
+		for _, file := range files {
+			contents[file.Name] = string(file.Contents)
+		}
+		return contents
+	}
+
+	files := render(EndpointMetadataConfig{Enabled: true, Labels: []string{"track"}, Headers: true})
+	entries := strings.Fields(files["conf/os_endpoint_metadata.map"])
+	if expected := []string{"pod:web-1:svc::10.128.0.5:8080", "web-1|zone-a|node-1|canary"}; !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected the map entries %v, got %v", expected, entries)
+	}
+	config := files["conf/haproxy.config"]
+	i := strings.Index(config, "backend be_http:ns:web\n")
+	if i < 0 {
+		t.Fatalf("backend be_http:ns:web not found")
+	}
+	section := config[i+1:]
+	if j := strings.Index(section, "\nbackend "); j >= 0 {
+		section = section[:j]
+	}
+	for _, expected := range []string{
+		"http-response set-var(txn.endpoint_pod) srv_name,map(/var/lib/haproxy/conf/os_endpoint_metadata.map),field(1,|)",
+		"http-response set-var(txn.endpoint_label_track) srv_name,map(/var/lib/haproxy/conf/os_endpoint_metadata.map),field(4,|)",
+		"http-response set-header X-Endpoint-Zone %[var(txn.endpoint_zone)] if { var(txn.endpoint_zone) -m len gt 0 }",
+	} {
+		if !strings.Contains(section, expected) {
+			t.Errorf("expected %q in:\n%s", expected, section)
+		}
+	}
+
+	// Without headers only the variables are set.
+	files = render(EndpointMetadataConfig{Enabled: true})
+	if config := files["conf/haproxy.config"]; !strings.Contains(config, "set-var(txn.endpoint_node)") || strings.Contains(config, "X-Endpoint-") {
+		t.Errorf("expected the variables without the headers")
+	}
+
+	files = render(EndpointMetadataConfig{})
+	if config := files["conf/haproxy.config"]; strings.Contains(config, "os_endpoint_metadata.map") {
+		t.Errorf("expected no endpoint metadata when disabled")
+	}
+	if entries := strings.TrimSpace(files["conf/os_endpoint_metadata.map"]); len(entries) > 0 {
+		t.Errorf("expected an empty map when disabled, got:\n%s", entries)
+	}
+}
+
+func TestPodLabelStoreReportsChangedLabels(t *testing.T) {
+	var changed []string
+	store := &podLabelStore{Store: cache.NewStore(cache.MetaNamespaceKeyFunc), labels: []string{"track"}, changed: func(namespace string) { changed = append(changed, namespace) }}
+	pod := func(labels map[string]string) *kapi.Pod {
+		return &kapi.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web-1", Labels: labels}}
+	}
+
+	if err := store.Replace([]interface{}{pod(map[string]string{"track": "stable"})}, "1"); err != nil {
+		t.Fatal(err)
+	}
+	// labels the router does not keep are ignored.
+	if err := store.Update(pod(map[string]string{"track": "stable", "other": "a"})); err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 0 {
+		t.Fatalf("expected no change to be reported, got %v", changed)
+	}
+	if err := store.Update(pod(map[string]string{"track": "canary"})); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []string{"ns"}) {
+		t.Fatalf("expected the change of the namespace to be reported, got %v", changed)
+	}
+	if labels := store.lookup("ns", "web-1"); labels["track"] != "canary" {
+		t.Errorf("expected the new labels to be stored, got %v", labels)
+	}
+}
+
+func TestPodLabelLookupNamespaces(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&kapi.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "web-1", Labels: map[string]string{"track": "stable"}}},
+		&kapi.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "b", Name: "web-1", Labels: map[string]string{"track": "canary"}}},
+	)
+	lookup := NewListWatchPodLabelLookup(client.CoreV1(), 0, "", []string{"track"}).(*podLabelLookup)
+	lookup.SetNamespaces(sets.NewString("a"))
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return lookup.LookupPodLabels("a", "web-1")["track"] == "stable", nil
+	}); err != nil {
+		t.Fatalf("expected the pods of the served namespace to be looked up: %v", err)
+	}
+	if labels := lookup.LookupPodLabels("b", "web-1"); labels != nil {
+		t.Errorf("expected the pods of other namespaces to be left out, got %v", labels)
+	}
+	if _, ok := lookup.stores[metav1.NamespaceAll]; ok || len(lookup.stores) != 1 {
+		t.Errorf("expected only the served namespace to be watched, got %v", lookup.stores)
+	}
+}
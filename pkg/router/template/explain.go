@@ -0,0 +1,314 @@
+package templaterouter
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	routev1 "github.com/openshift/api/route/v1"
+	templateutil "github.com/openshift/router/pkg/router/template/util"
+)
+
+const (
+	// defaultBackend is the backend of the requests no route matches.
+	defaultBackend = "openshift_default"
+
+	// ExplainActionForward is the action of requests forwarded to the
+	// servers of a backend.
+	ExplainActionForward = "forward"
+	// ExplainActionRedirect is the action of HTTP requests redirected to
+	// HTTPS, or by the redirect rules of a route.
+	ExplainActionRedirect = "redirect"
+	// ExplainActionDeny is the action of requests the router denies.
+	ExplainActionDeny = "deny"
+)
+
+// getMapFoundPattern and getMapValuePattern match the result of the haproxy
+// "get map" command.
+var (
+	getMapFoundPattern = regexp.MustCompile(`found=(yes|no)`)
+	getMapValuePattern = regexp.MustCompile(`value="((?:[^"\\]|\\.)*)"`)
+)
+
+// ExplainRequest is a request whose routing is explained.
+type ExplainRequest struct {
+	// Host is the Host header of the request, with an optional port.
+	Host string
+	// Path is the path of the request, without the query string.
+	Path string
+	// Method is the method of the request.
+	Method string
+	// Headers are the headers of the request.
+	Headers http.Header
+	// TLS is true for requests received on the HTTPS port.
+	TLS bool
+	// SNI is the server name the TLS connection of the request was set up
+	// for.  Defaults to the host of Host.
+	SNI string
+	// Runtime also looks the request up in the maps of the running
+	// haproxy, to tell apart the maps written from the ones it uses.
+	Runtime bool
+}
+
+// MapLookup is a lookup of a key in a haproxy map.
+type MapLookup struct {
+	// Map is the name of the map.
+	Map string `json:"map"`
+	// Key is the key looked up.
+	Key string `json:"key"`
+	// Pattern is the first entry of the map that matched the key.
+	Pattern string `json:"pattern,omitempty"`
+	// Value is the value of the entry that matched.
+	Value string `json:"value,omitempty"`
+	// Found is true if an entry matched.
+	Found bool `json:"found"`
+	// Runtime is the result of the lookup in the running haproxy, if
+	// requested.
+	Runtime *RuntimeMapLookup `json:"runtime,omitempty"`
+}
+
+// RuntimeMapLookup is the result of a lookup in the running haproxy.
+type RuntimeMapLookup struct {
+	Found bool   `json:"found"`
+	Value string `json:"value,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ACLEvaluation is the evaluation of a condition of the configuration.
+type ACLEvaluation struct {
+	// Name describes the condition.
+	Name string `json:"name"`
+	// Condition is the haproxy condition.
+	Condition string `json:"condition"`
+	// Matched is true if the request matched the condition.
+	Matched bool `json:"matched"`
+}
+
+// RouteExplanation explains how the router routes a request: the map
+// lookups and the conditions evaluated, in the order haproxy does.
+type RouteExplanation struct {
+	// Frontend is the frontend that selected the backend.
+	Frontend string `json:"frontend"`
+	// Lookups are the map lookups of the frontends.
+	Lookups []MapLookup `json:"lookups"`
+	// ACLs are the conditions evaluated on the request.
+	ACLs []ACLEvaluation `json:"acls,omitempty"`
+	// Backend is the backend selected.
+	Backend string `json:"backend"`
+	// Route is the namespace/name of the route of the backend, if any.
+	Route string `json:"route,omitempty"`
+	// Action is what happens to the request: forward, redirect or deny.
+	Action string `json:"action"`
+	// Status is the status of the response of denied requests.
+	Status int `json:"status,omitempty"`
+}
+
+// ExplainRoute explains which route and backend the router selects for a
+// request, from the in-memory state of the router.
+func (r *templateRouter) ExplainRoute(req ExplainRequest) RouteExplanation {
+	explanation := r.explainRoute(req)
+	// The lookups of the running haproxy do not need the state lock.
+	if req.Runtime {
+		for i := range explanation.Lookups {
+			explanation.Lookups[i].Runtime = r.lookupRuntimeMap(explanation.Lookups[i].Map, explanation.Lookups[i].Key)
+		}
+	}
+	return explanation
+}
+
+func (r *templateRouter) explainRoute(req ExplainRequest) RouteExplanation {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	host := strings.ToLower(req.Host)
+	base := host + req.Path
+	lookup := func(explanation *RouteExplanation, name, key string) MapLookup {
+		result := r.lookupStateMap(name, key)
+		explanation.Lookups = append(explanation.Lookups, result)
+		return result
+	}
+
+	explanation := RouteExplanation{Frontend: "public", Backend: defaultBackend, Action: ExplainActionForward}
+	if !req.TLS {
+		if redirect := lookup(&explanation, "os_route_http_redirect.map", base); redirect.Found && redirect.Value == "1" {
+			explanation.Action = ExplainActionRedirect
+			explanation.Backend = ""
+			return explanation
+		}
+		if be := lookup(&explanation, "os_http_be.map", base); be.Found {
+			explanation.Backend = be.Value
+		}
+		r.explainBackend(&explanation, req)
+		return explanation
+	}
+
+	sni := strings.ToLower(req.SNI)
+	if len(sni) == 0 {
+		sni = strings.SplitN(host, ":", 2)[0]
+	}
+	explanation.Frontend = "public_ssl"
+	if passthrough := lookup(&explanation, "os_sni_passthrough.map", sni); passthrough.Found {
+		if be := lookup(&explanation, "os_tcp_be.map", sni); be.Found {
+			explanation.Backend = be.Value
+			explanation.Route = routeOfBackend(be.Value)
+			return explanation
+		}
+	}
+	explanation.Frontend = "fe_sni"
+	if len(req.SNI) == 0 {
+		explanation.Frontend = "fe_no_sni"
+	}
+	if len(r.sniHostMismatchPolicy) > 0 {
+		matched := len(req.SNI) > 0 && sni == strings.SplitN(host, ":", 2)[0]
+		explanation.ACLs = append(explanation.ACLs, ACLEvaluation{Name: "sni_host_match", Condition: "ssl_fc_sni,lower,strcmp(txn.sni_host) eq 0", Matched: matched})
+		if !matched {
+			if exempt := lookup(&explanation, "os_sni_host_mismatch_exempt.map", base); !exempt.Found {
+				if r.sniHostMismatchPolicy == SNIHostMismatchReject {
+					explanation.Action = ExplainActionDeny
+					explanation.Status = http.StatusMisdirectedRequest
+					explanation.Backend = ""
+				}
+				return explanation
+			}
+		}
+	}
+	if be := lookup(&explanation, "os_edge_reencrypt_be.map", base); be.Found {
+		explanation.Backend = be.Value
+	}
+	r.explainBackend(&explanation, req)
+	return explanation
+}
+
+// explainBackend evaluates the rules of the backend of explanation that
+// deny or redirect requests.
+func (r *templateRouter) explainBackend(explanation *RouteExplanation, req ExplainRequest) {
+	explanation.Route = routeOfBackend(explanation.Backend)
+	if len(explanation.Route) == 0 {
+		return
+	}
+	cfg, ok := r.state[ServiceAliasConfigKey(strings.Replace(explanation.Route, "/", routeKeySeparator, 1))]
+	if !ok {
+		return
+	}
+	if redirect := cfg.RedirectHost; len(redirect.Host) > 0 && !cfg.RedirectHostLoop {
+		condition := "!{ ssl_fc }"
+		if redirect.All {
+			condition = ""
+		}
+		matched := redirect.All || !req.TLS
+		explanation.ACLs = append(explanation.ACLs, ACLEvaluation{Name: "redirect host", Condition: condition, Matched: matched})
+		if matched {
+			explanation.Action = ExplainActionRedirect
+			explanation.Status = redirect.Code
+		}
+	}
+	for i, rule := range cfg.DenyRules {
+		matched := rule.Matches(req.Method, req.Path, req.Headers)
+		explanation.ACLs = append(explanation.ACLs, ACLEvaluation{Name: fmt.Sprintf("deny rule %d", i+1), Condition: rule.ACL(), Matched: matched})
+		if matched && explanation.Action == ExplainActionForward {
+			explanation.Action = ExplainActionDeny
+			explanation.Status = http.StatusForbidden
+		}
+	}
+	for i, rule := range cfg.RedirectRules {
+		matched := rule.Matches(req.TLS, req.Path)
+		explanation.ACLs = append(explanation.ACLs, ACLEvaluation{Name: fmt.Sprintf("redirect rule %d", i+1), Condition: rule.ACL(), Matched: matched})
+		if matched && explanation.Action == ExplainActionForward {
+			explanation.Action = ExplainActionRedirect
+			explanation.Status = rule.Code
+		}
+	}
+	if cfg.WAF {
+		// The verdict of the agent cannot be known in advance.
+		explanation.ACLs = append(explanation.ACLs, ACLEvaluation{Name: "web application firewall", Condition: "{ var(txn.waf.block) -m bool }"})
+	}
+}
+
+// lookupStateMap looks key up in a map of the routes of the router without
+// writing the whole map: only the entries of the routes of the host of key,
+// and of the wildcard routes, can match it.
+func (r *templateRouter) lookupStateMap(name, key string) MapLookup {
+	host := strings.SplitN(strings.SplitN(key, "/", 2)[0], ":", 2)[0]
+	var lines []string
+	for k, cfg := range r.state {
+		if !cfg.IsWildcard && !strings.EqualFold(cfg.Host, host) {
+			continue
+		}
+		if entry := routeMapEntry(name, k, cfg); entry != nil {
+			lines = append(lines, entry.Key+" "+entry.Value)
+		}
+	}
+	result := lookupHAProxyMap(sortMapLines(lines), key)
+	result.Map = name
+	return result
+}
+
+// lookupHAProxyMap looks key up in the lines of a map the way map_reg does:
+// the first entry whose pattern matches wins.
+func lookupHAProxyMap(lines []string, key string) MapLookup {
+	result := MapLookup{Key: key}
+	for _, line := range lines {
+		pattern, value, _ := strings.Cut(line, " ")
+		matched, err := matchString(pattern, key)
+		if err != nil || !matched {
+			continue
+		}
+		result.Pattern, result.Value, result.Found = pattern, value, true
+		break
+	}
+	return result
+}
+
+// validRuntimeMapKey returns an error if key cannot be sent to the running
+// haproxy as is: the commands of the stats socket are separated by
+// semicolons and newlines, and their arguments by white space.
+func validRuntimeMapKey(key string) error {
+	for _, c := range key {
+		if c == ';' || unicode.IsSpace(c) || unicode.IsControl(c) {
+			return fmt.Errorf("the key %q cannot be looked up in the running haproxy", key)
+		}
+	}
+	return nil
+}
+
+// lookupRuntimeMap looks key up in the map of the running haproxy.
+func (r *templateRouter) lookupRuntimeMap(name, key string) *RuntimeMapLookup {
+	if err := validRuntimeMapKey(key); err != nil {
+		return &RuntimeMapLookup{Error: err.Error()}
+	}
+	out, err := newMasterCLI(filepath.Join(r.dir, statsSocketFile)).execute(fmt.Sprintf("get map %s %s", filepath.Join(r.dir, "conf", name), key))
+	if err == errMasterNotRunning {
+		return &RuntimeMapLookup{Error: "haproxy is not running"}
+	} else if err != nil {
+		return &RuntimeMapLookup{Error: err.Error()}
+	}
+	return parseGetMap(out)
+}
+
+// parseGetMap parses the output of the haproxy "get map" command.
+func parseGetMap(out string) *RuntimeMapLookup {
+	found := getMapFoundPattern.FindStringSubmatch(out)
+	if found == nil {
+		return &RuntimeMapLookup{Error: fmt.Sprintf("unexpected response: %s", strings.TrimSpace(out))}
+	}
+	result := &RuntimeMapLookup{Found: found[1] == "yes"}
+	if value := getMapValuePattern.FindStringSubmatch(out); result.Found && value != nil {
+		result.Value = value[1]
+	}
+	return result
+}
+
+// routeOfBackend returns the namespace/name of the route of a backend, or
+// an empty string for the backends of the router.
+func routeOfBackend(backend string) string {
+	for _, termination := range []routev1.TLSTerminationType{"", routev1.TLSTerminationEdge, routev1.TLSTerminationPassthrough, routev1.TLSTerminationReencrypt} {
+		prefix := templateutil.GenerateBackendNamePrefix(termination) + ":"
+		if strings.HasPrefix(backend, prefix) {
+			return strings.Replace(strings.TrimPrefix(backend, prefix), routeKeySeparator, "/", 1)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package templaterouter
+
+import (
+	"net/http"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func TestExplainRoute(t *testing.T) {
+	route := func(name, host, path string, tls *routev1.TLSConfig, annotations map[string]string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Annotations: annotations},
+			Spec: routev1.RouteSpec{
+				Host: host,
+				Path: path,
+				To:   routev1.RouteTargetReference{Name: "svc"},
+				TLS:  tls,
+			},
+		}
+	}
+	router := NewFakeTemplateRouter()
+	for _, r := range []*routev1.Route{
+		route("web", "web.example.com", "", nil, map[string]string{routeapihelpers.DenyRulesAnnotation: "method=TRACE"}),
+		route("api", "web.example.com", "/api", nil, nil),
+		route("secure", "secure.example.com", "", &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge, InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect}, nil),
+		route("passthrough", "db.example.com", "", &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough}, nil),
+	} {
+		router.AddRoute(r)
+	}
+
+	tests := []struct {
+		name     string
+		request  ExplainRequest
+		backend  string
+		route    string
+		action   string
+		frontend string
+		lookups  int
+	}{
+		{
+			name:     "host",
+			request:  ExplainRequest{Host: "WEB.example.com", Path: "/", Method: "GET"},
+			backend:  "be_http:ns:web",
+			route:    "ns/web",
+			action:   ExplainActionForward,
+			frontend: "public",
+			lookups:  2,
+		},
+		{
+			name:     "longest path",
+			request:  ExplainRequest{Host: "web.example.com", Path: "/api/users", Method: "GET"},
+			backend:  "be_http:ns:api",
+			route:    "ns/api",
+			action:   ExplainActionForward,
+			frontend: "public",
+			lookups:  2,
+		},
+		{
+			name:     "deny rule",
+			request:  ExplainRequest{Host: "web.example.com", Path: "/", Method: "TRACE"},
+			backend:  "be_http:ns:web",
+			route:    "ns/web",
+			action:   ExplainActionDeny,
+			frontend: "public",
+			lookups:  2,
+		},
+		{
+			name:     "redirect",
+			request:  ExplainRequest{Host: "secure.example.com", Path: "/"},
+			action:   ExplainActionRedirect,
+			frontend: "public",
+			lookups:  1,
+		},
+		{
+			name:     "edge",
+			request:  ExplainRequest{Host: "secure.example.com", Path: "/", TLS: true, SNI: "secure.example.com"},
+			backend:  "be_edge_http:ns:secure",
+			route:    "ns/secure",
+			action:   ExplainActionForward,
+			frontend: "fe_sni",
+			lookups:  2,
+		},
+		{
+			name:     "passthrough",
+			request:  ExplainRequest{Host: "db.example.com", TLS: true, SNI: "db.example.com"},
+			backend:  "be_tcp:ns:passthrough",
+			route:    "ns/passthrough",
+			action:   ExplainActionForward,
+			frontend: "public_ssl",
+			lookups:  2,
+		},
+		{
+			name:     "unknown host",
+			request:  ExplainRequest{Host: "other.example.com", Path: "/"},
+			backend:  defaultBackend,
+			action:   ExplainActionForward,
+			frontend: "public",
+			lookups:  2,
+		},
+	}
+	for _, tc := range tests {
+		explanation := router.ExplainRoute(tc.request)
+		if explanation.Backend != tc.backend || explanation.Route != tc.route || explanation.Action != tc.action || explanation.Frontend != tc.frontend || len(explanation.Lookups) != tc.lookups {
+			t.Errorf("%s: expected %s %s %s %s with %d lookups, got %+v", tc.name, tc.frontend, tc.backend, tc.route, tc.action, tc.lookups, explanation)
+		}
+	}
+
+	// Requests whose SNI does not match their host are rejected when the
+	// policy says so.
+	router.sniHostMismatchPolicy = SNIHostMismatchReject
+	explanation := router.ExplainRoute(ExplainRequest{Host: "secure.example.com", Path: "/", TLS: true, SNI: "web.example.com"})
+	if explanation.Action != ExplainActionDeny || explanation.Status != http.StatusMisdirectedRequest {
+		t.Errorf("expected the request to be denied with a 421, got %+v", explanation)
+	}
+}
+
+func TestParseGetMap(t *testing.T) {
+	tests := []struct {
+		out      string
+		expected RuntimeMapLookup
+	}{
+		{
+			out:      `type=reg, case=sensitive, found=yes, idx=list, key="^web\.example\.com(:[0-9]+)?(/.*)?$", value="be_http:ns:web", type="str"`,
+			expected: RuntimeMapLookup{Found: true, Value: "be_http:ns:web"},
+		},
+		{
+			out:      "type=reg, case=sensitive, found=no\n",
+			expected: RuntimeMapLookup{},
+		},
+	}
+	for _, tc := range tests {
+		if result := parseGetMap(tc.out); *result != tc.expected {
+			t.Errorf("%q: expected %+v, got %+v", tc.out, tc.expected, *result)
+		}
+	}
+	if result := parseGetMap("Unknown map identifier.\n"); len(result.Error) == 0 {
+		t.Errorf("expected an error for an unexpected response")
+	}
+}
+
+func TestLookupRuntimeMapRejectsCommands(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	for _, key := range []string{"web.example.com/;shutdown", "web.example.com/\ndel map os_http_be.map", "web.example.com/ x", "web.example.com/\x00"} {
+		if result := router.lookupRuntimeMap("os_http_be.map", key); len(result.Error) == 0 {
+			t.Errorf("expected the key %q to be rejected, got %+v", key, result)
+		}
+	}
+	if err := validRuntimeMapKey("web.example.com:8080/api?x=1"); err != nil {
+		t.Errorf("expected a valid key, got %v", err)
+	}
+}
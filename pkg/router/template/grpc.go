@@ -0,0 +1,24 @@
+package templaterouter
+
+import "strings"
+
+// grpcAppProtocol is the appProtocol of the ports of the endpoints that
+// serve gRPC.
+const grpcAppProtocol = "grpc"
+
+// isGRPC returns whether the backends of a route serve gRPC: the route
+// says so with its gRPC annotation or, without one, an endpoint of its
+// services has the gRPC appProtocol.
+func (r *templateRouter) isGRPC(cfg *ServiceAliasConfig) bool {
+	if cfg.GRPCOverride != nil {
+		return *cfg.GRPCOverride
+	}
+	for key := range cfg.ServiceUnits {
+		for _, ep := range r.serviceUnits[key].EndpointTable {
+			if strings.EqualFold(ep.AppProtocol, grpcAppProtocol) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package templaterouter
+
+// haproxyDirective is a directive of the template that only some versions
+// or builds of haproxy support.
+type haproxyDirective struct {
+	// major and minor are the first version of haproxy that supports the
+	// directive.
+	major, minor int
+	// feature is the build option haproxy needs for the directive, if any.
+	feature string
+	// assumed is whether the directive is used when the capabilities of
+	// haproxy were not probed.  Only the directives every haproxy the router
+	// runs with supports are assumed.
+	assumed bool
+}
+
+var (
+	// strictSNIDirective rejects the TLS handshakes whose server name
+	// matches no certificate.
+	strictSNIDirective = haproxyDirective{major: 1, minor: 5, assumed: true}
+	// ocspUpdateDirective makes haproxy fetch the OCSP responses of the
+	// certificates of a crt-list and refresh them before they expire.
+	ocspUpdateDirective = haproxyDirective{major: 2, minor: 8}
+	// quicDirective binds HTTP/3 over QUIC.
+	quicDirective = haproxyDirective{major: 2, minor: 6, feature: "QUIC"}
+)
+
+// supports returns true if haproxy supports directive.  The capabilities
+// are nil if they were not probed.
+func (c *HAProxyCapabilities) supports(directive haproxyDirective) bool {
+	if c == nil {
+		return directive.assumed
+	}
+	return c.AtLeast(directive.major, directive.minor) && (len(directive.feature) == 0 || c.HasFeature(directive.feature))
+}
+
+// strictSNI returns the bind option that rejects the TLS handshakes whose
+// server name matches no certificate, or nothing if haproxy does not
+// support it and serves the default certificate instead.
+func strictSNI(capabilities *HAProxyCapabilities) string {
+	if !capabilities.supports(strictSNIDirective) {
+		return ""
+	}
+	return "strict-sni"
+}
+
+// ocspUpdateEnabled returns true if ROUTER_OCSP_UPDATE is set and haproxy
+// fetches the OCSP responses of the certificates itself.  Older versions
+// only staple the OCSP responses found next to the certificates.
+func ocspUpdateEnabled(capabilities *HAProxyCapabilities) bool {
+	return isTrue(env("ROUTER_OCSP_UPDATE", "")) && capabilities.supports(ocspUpdateDirective)
+}
+
+// quicEnabled returns true if ROUTER_ENABLE_QUIC is set and haproxy was
+// built with QUIC support.  Without it, the clients keep using HTTP/1.1 and
+// HTTP/2 over TCP.
+func quicEnabled(capabilities *HAProxyCapabilities) bool {
+	return isTrue(env("ROUTER_ENABLE_QUIC", "")) && capabilities.supports(quicDirective)
+}
+
+// quicBinds returns the QUIC addresses to bind on port for the IP mode of
+// the router (v4, v6 or v4v6), or none if QUIC is not enabled.
+func quicBinds(capabilities *HAProxyCapabilities, ipMode, port string) []string {
+	if !quicEnabled(capabilities) {
+		return nil
+	}
+	switch ipMode {
+	case "v4v6":
+		return []string{"quic4@:" + port, "quic6@:" + port}
+	case "v6":
+		return []string{"quic6@:" + port}
+	}
+	return []string{"quic4@:" + port}
+}
+
+// versionedCrtListOptions returns entry with the options of the versioned
+// directives haproxy supports: h3 is added to the default ALPN protocols
+// of the certificates when QUIC is enabled, since the ALPN protocols of a
+// crt-list entry replace the ones of the bind, and the OCSP responses are
+// updated by haproxy when it supports it.
+func versionedCrtListOptions(entry CrtListEntry, capabilities *HAProxyCapabilities) CrtListEntry {
+	options := make([]string, 0, len(entry.Options)+1)
+	for _, option := range entry.Options {
+		if option == "alpn h2,http/1.1" && quicEnabled(capabilities) {
+			option = "alpn h3,h2,http/1.1"
+		}
+		options = append(options, option)
+	}
+	if ocspUpdateEnabled(capabilities) {
+		options = append(options, "ocsp-update on")
+	}
+	if len(options) == 0 {
+		options = nil
+	}
+	entry.Options = options
+	return entry
+}
@@ -0,0 +1,114 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestHAProxyDirectiveSupport(t *testing.T) {
+	haproxy24 := &HAProxyCapabilities{Version: "2.4.22", Major: 2, Minor: 4, Features: sets.NewString("OPENSSL")}
+	haproxy28 := &HAProxyCapabilities{Version: "2.8.5", Major: 2, Minor: 8, Features: sets.NewString("OPENSSL")}
+	haproxy28QUIC := &HAProxyCapabilities{Version: "2.8.5", Major: 2, Minor: 8, Features: sets.NewString("OPENSSL", "QUIC")}
+
+	tests := []struct {
+		name         string
+		capabilities *HAProxyCapabilities
+		directive    haproxyDirective
+		expected     bool
+	}{
+		{name: "strict-sni without capabilities", directive: strictSNIDirective, expected: true},
+		{name: "strict-sni on 2.4", capabilities: haproxy24, directive: strictSNIDirective, expected: true},
+		{name: "ocsp-update without capabilities", directive: ocspUpdateDirective, expected: false},
+		{name: "ocsp-update on 2.4", capabilities: haproxy24, directive: ocspUpdateDirective, expected: false},
+		{name: "ocsp-update on 2.8", capabilities: haproxy28, directive: ocspUpdateDirective, expected: true},
+		{name: "quic without capabilities", directive: quicDirective, expected: false},
+		{name: "quic on 2.8 without the build option", capabilities: haproxy28, directive: quicDirective, expected: false},
+		{name: "quic on 2.8", capabilities: haproxy28QUIC, directive: quicDirective, expected: true},
+	}
+	for _, tc := range tests {
+		if supported := tc.capabilities.supports(tc.directive); supported != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, supported)
+		}
+	}
+}
+
+func TestHAProxyDirectivesTemplate(t *testing.T) {
+	t.Setenv("ROUTER_STRICT_SNI", "true")
+	t.Setenv("ROUTER_ENABLE_QUIC", "true")
+	t.Setenv("ROUTER_OCSP_UPDATE", "true")
+	t.Setenv("ROUTER_IP_V4_V6_MODE", "v4v6")
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "app"},
+		Spec: routev1.RouteSpec{
+			Host: "app.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+			TLS: &routev1.TLSConfig{
+				Termination: routev1.TLSTerminationEdge,
+				Certificate: "certificate",
+				Key:         "key",
+			},
+		},
+	}
+	render := func(capabilities *HAProxyCapabilities) (string, string) {
+		t.Helper()
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath:        "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:          "/var/lib/haproxy",
+			BindPorts:           true,
+			HAProxyCapabilities: capabilities,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		files, err := renderer.Render(renderer.RouteState([]*routev1.Route{route}))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		contents := map[string]string{}
+		for _, file := range files {
+			contents[file.Name] = string(file.Contents)
+		}
+		return contents["conf/haproxy.config"], contents["conf/cert_config.map"]
+	}
+
+	// a modern haproxy gets the modern directives
+	config, crtList := render(&HAProxyCapabilities{Version: "2.8.5", Major: 2, Minor: 8, Features: sets.NewString("OPENSSL", "QUIC")})
+	for _, expected := range []string{
+		"bind unix@/var/lib/haproxy/run/haproxy-sni.sock ssl strict-sni ",
+		"  bind quic4@:443 ssl crt /var/lib/haproxy/conf/default_pub_keys.pem crt-list /var/lib/haproxy/conf/cert_config.map alpn h3\n",
+		"  bind quic6@:443 ssl crt /var/lib/haproxy/conf/default_pub_keys.pem crt-list /var/lib/haproxy/conf/cert_config.map alpn h3\n",
+		"  http-response set-header alt-svc \"h3=\\\":443\\\"; ma=86400\"\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected %q in the configuration", expected)
+		}
+	}
+	if !strings.Contains(crtList, " [alpn h3,h2,http/1.1 ocsp-update on] app.example.com") {
+		t.Errorf("expected the crt-list to offer h3 and update the OCSP responses, got:\n%s", crtList)
+	}
+
+	// an older haproxy falls back to the directives it supports
+	config, crtList = render(&HAProxyCapabilities{Version: "2.4.22", Major: 2, Minor: 4, Features: sets.NewString("OPENSSL")})
+	if !strings.Contains(config, "bind unix@/var/lib/haproxy/run/haproxy-sni.sock ssl strict-sni ") {
+		t.Errorf("expected strict-sni in the configuration")
+	}
+	if strings.Contains(config, "quic4@") || strings.Contains(config, "alt-svc") {
+		t.Errorf("unexpected QUIC binds without QUIC support")
+	}
+	if !strings.Contains(crtList, " [alpn h2,http/1.1] app.example.com") {
+		t.Errorf("expected the crt-list without the versioned options, got:\n%s", crtList)
+	}
+
+	// capabilities that were not probed only get the directives every
+	// haproxy supports
+	config, crtList = render(nil)
+	if !strings.Contains(config, "haproxy-sni.sock ssl strict-sni ") || strings.Contains(config, "quic4@") || strings.Contains(crtList, "ocsp-update") {
+		t.Errorf("expected only the directives every haproxy supports, got crt-list:\n%s", crtList)
+	}
+}
@@ -0,0 +1,332 @@
+package templaterouter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// haproxyConfigFile and haproxyPidFile are relative to the working
+	// directory of the router.
+	haproxyConfigFile = "conf/haproxy.config"
+	haproxyPidFile    = "run/haproxy.pid"
+
+	// defaultReloadWaitTime is how long to wait for haproxy to pass its
+	// health check after a reload, when MAX_RELOAD_WAIT_TIME is not set.
+	defaultReloadWaitTime = 30 * time.Second
+
+	// reloadHealthCheckTimeout is the timeout of a single health check.
+	reloadHealthCheckTimeout = time.Second
+
+	// reloadHealthCheckInterval is how often haproxy is checked until it
+	// passes its health check.
+	reloadHealthCheckInterval = 500 * time.Millisecond
+
+	// shutdownPollInterval is how often the haproxy processes are looked
+	// up while waiting for them to drain on shutdown.
+	shutdownPollInterval = time.Second
+)
+
+// Stages of a reload reported by ReloadError.
+const (
+	ReloadStageCheck       = "check"
+	ReloadStageShutdown    = "shutdown"
+	ReloadStageStart       = "start"
+	ReloadStageHealthCheck = "health check"
+	ReloadStageVerify      = "verify"
+)
+
+// ReloadError is returned when haproxy fails to reload.
+type ReloadError struct {
+	// Stage is the stage of the reload that failed.
+	Stage string
+	// Output is the output of haproxy, if any.
+	Output string
+	// Err is the cause of the failure.
+	Err error
+}
+
+func (e *ReloadError) Error() string {
+	if len(e.Output) == 0 {
+		return fmt.Sprintf("error reloading router: %s failed: %v", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("error reloading router: %s failed: %v\n%s", e.Stage, e.Err, e.Output)
+}
+
+func (e *ReloadError) Unwrap() error {
+	return e.Err
+}
+
+// haproxyReloader starts, reloads and stops the haproxy processes of the
+// router without a reload script.
+type haproxyReloader struct {
+	// binary is the haproxy binary.
+	binary string
+	// dir is the working directory of the router.
+	dir string
+	// masterSocketPath, if set, is the master CLI socket of haproxy started
+	// in master-worker mode.
+	masterSocketPath string
+
+	// waitTime is how long to wait for haproxy to pass its health check.
+	waitTime time.Duration
+	// shutdownWaitTime is how long to wait for haproxy to drain on shutdown.
+	shutdownWaitTime time.Duration
+	// healthCheckAddress is the address of the http frontend.
+	healthCheckAddress string
+	// proxyProtocol is true if the http frontend expects the PROXY protocol.
+	proxyProtocol bool
+
+	// procDir and signal allow the reloader to be tested.
+	procDir string
+	signal  func(pid int, sig syscall.Signal) error
+}
+
+// inProcessReloader returns the reloader managing the haproxy processes of
+// the router instead of the reload script, or nil if in-process reloads are
+// not enabled.
+func inProcessReloader(cfg templateRouterCfg) *haproxyReloader {
+	if !cfg.inProcessReload || len(cfg.haproxyBinary) == 0 {
+		return nil
+	}
+	return newHAProxyReloader(cfg.haproxyBinary, cfg.dir, cfg.masterSocketPath)
+}
+
+// newHAProxyReloader returns a reloader for the haproxy processes of the
+// router in dir.  It honors the environment variables of the reload script.
+func newHAProxyReloader(binary, dir, masterSocketPath string) *haproxyReloader {
+	waitTime := reloadWaitTimeFromEnv("MAX_RELOAD_WAIT_TIME", defaultReloadWaitTime)
+	port := os.Getenv("ROUTER_SERVICE_HTTP_PORT")
+	if len(port) == 0 {
+		port = "80"
+	}
+	proxyProtocol, _ := strconv.ParseBool(os.Getenv("ROUTER_USE_PROXY_PROTOCOL"))
+	return &haproxyReloader{
+		binary:             binary,
+		dir:                dir,
+		masterSocketPath:   masterSocketPath,
+		waitTime:           waitTime,
+		shutdownWaitTime:   reloadWaitTimeFromEnv("ROUTER_MAX_SHUTDOWN_TIMEOUT", waitTime),
+		healthCheckAddress: net.JoinHostPort("localhost", port),
+		proxyProtocol:      proxyProtocol,
+		procDir:            "/proc",
+		signal:             syscall.Kill,
+	}
+}
+
+// reloadWaitTimeFromEnv returns the number of seconds in the environment
+// variable name, or defaultValue if it is not set or invalid.
+func reloadWaitTimeFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		log.V(0).Info("invalid wait time, using the default", "name", name, "value", value, "default", defaultValue.String())
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// checkConfig checks the haproxy configuration written to disk.
+func (h *haproxyReloader) checkConfig() error {
+	out, err := exec.Command(h.binary, "-c", "-q", "-f", filepath.Join(h.dir, haproxyConfigFile)).CombinedOutput()
+	if err != nil {
+		return &ReloadError{Stage: ReloadStageCheck, Output: string(out), Err: err}
+	}
+	return nil
+}
+
+// reload starts a new haproxy process that takes the listening sockets
+// over from the running ones and tells them to finish, then waits until
+// haproxy serves requests.  On shutdown the running processes are told to
+// stop accepting connections and drain instead.
+func (h *haproxyReloader) reload(shutdown bool) error {
+	h.removeStalePidFile()
+	oldPids, err := h.haproxyPids()
+	if err != nil {
+		return &ReloadError{Stage: ReloadStageStart, Err: err}
+	}
+	if shutdown {
+		return h.shutdown(oldPids)
+	}
+
+	args := []string{}
+	if len(h.masterSocketPath) > 0 {
+		args = append(args, "-W", "-S", h.masterSocketPath+",mode,600")
+	}
+	args = append(args, "-f", filepath.Join(h.dir, haproxyConfigFile), "-p", filepath.Join(h.dir, haproxyPidFile))
+	if len(oldPids) > 0 {
+		// The new process binds seamlessly by receiving the listening
+		// sockets of the old ones over the stats socket.
+		if socket := filepath.Join(h.dir, statsSocketFile); fileExists(socket) {
+			args = append(args, "-x", socket)
+		}
+		args = append(args, "-sf")
+		for _, pid := range oldPids {
+			args = append(args, strconv.Itoa(pid))
+		}
+	}
+	out, err := exec.Command(h.binary, args...).CombinedOutput()
+	if err != nil {
+		return &ReloadError{Stage: ReloadStageStart, Output: string(out), Err: err}
+	}
+	if err := h.waitForHealthy(); err != nil {
+		return &ReloadError{Stage: ReloadStageHealthCheck, Output: string(out), Err: err}
+	}
+	log.V(0).Info("router reloaded", "output", string(out))
+	return nil
+}
+
+// shutdown tells the haproxy processes to stop accepting connections and
+// waits for them to exit, terminating them if they do not drain in time.
+func (h *haproxyReloader) shutdown(pids []int) error {
+	log.V(0).Info("shutting down haproxy", "pids", pids)
+	for _, pid := range pids {
+		h.signal(pid, syscall.SIGUSR1)
+	}
+	deadline := time.Now().Add(h.shutdownWaitTime)
+	for len(pids) > 0 {
+		if !time.Now().Before(deadline) {
+			for _, pid := range pids {
+				h.signal(pid, syscall.SIGTERM)
+			}
+			return &ReloadError{Stage: ReloadStageShutdown, Err: fmt.Errorf("processes %v did not exit within %v", pids, h.shutdownWaitTime)}
+		}
+		time.Sleep(shutdownPollInterval)
+		var err error
+		if pids, err = h.haproxyPids(); err != nil {
+			return &ReloadError{Stage: ReloadStageShutdown, Err: err}
+		}
+	}
+	return nil
+}
+
+// haproxyPids returns the pids of the running haproxy processes, skipping
+// the processes that exited but were not reaped yet.
+func (h *haproxyReloader) haproxyPids() ([]int, error) {
+	entries, err := ioutil.ReadDir(h.procDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the processes: %v", err)
+	}
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if h.isRunningHAProxy(pid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// isRunningHAProxy returns true if pid is a haproxy process that has not
+// exited.
+func (h *haproxyReloader) isRunningHAProxy(pid int) bool {
+	dir := filepath.Join(h.procDir, strconv.Itoa(pid))
+	comm, err := ioutil.ReadFile(filepath.Join(dir, "comm"))
+	if err != nil || strings.TrimSpace(string(comm)) != "haproxy" {
+		return false
+	}
+	// The state follows the command, which is in parentheses.
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return false
+	}
+	i := strings.LastIndex(string(stat), ")")
+	if i < 0 {
+		return false
+	}
+	state := strings.Fields(string(stat)[i+1:])
+	return len(state) > 0 && state[0] != "Z" && state[0] != "X"
+}
+
+// removeStalePidFile removes the pid file left behind by a haproxy process
+// that is no longer running, for instance after the container restarted.
+func (h *haproxyReloader) removeStalePidFile() {
+	pidFile := filepath.Join(h.dir, haproxyPidFile)
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return
+	}
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil && h.isRunningHAProxy(pid) {
+			return
+		}
+	}
+	if err := os.Remove(pidFile); err != nil && !os.IsNotExist(err) {
+		log.Error(err, "unable to remove the stale haproxy pid file", "path", pidFile)
+		return
+	}
+	log.V(0).Info("removed the stale haproxy pid file", "path", pidFile)
+}
+
+// waitForHealthy waits until the http frontend of haproxy answers a request
+// without a host with the 503 of the default backend or a 404.
+func (h *haproxyReloader) waitForHealthy() error {
+	deadline := time.Now().Add(h.waitTime)
+	for retries := 0; ; retries++ {
+		err := h.healthCheck()
+		if err == nil {
+			log.V(4).Info("haproxy health check ok", "retries", retries)
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("haproxy did not pass its health check within %v after %d retries: %v", h.waitTime, retries, err)
+		}
+		time.Sleep(reloadHealthCheckInterval)
+	}
+}
+
+// healthCheck sends a single health check request to the http frontend.
+func (h *haproxyReloader) healthCheck() error {
+	conn, err := net.DialTimeout("tcp", h.healthCheckAddress, reloadHealthCheckTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(reloadHealthCheckTimeout)); err != nil {
+		return err
+	}
+
+	if h.proxyProtocol {
+		local, remote := conn.LocalAddr().(*net.TCPAddr), conn.RemoteAddr().(*net.TCPAddr)
+		family := "TCP4"
+		if local.IP.To4() == nil {
+			family = "TCP6"
+		}
+		if _, err := fmt.Fprintf(conn, "PROXY %s %s %s %d %d\r\n", family, local.IP, remote.IP, local.Port, remote.Port); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprint(conn, "HEAD / HTTP/1.0\r\nHost: \r\n\r\n"); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodHead})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
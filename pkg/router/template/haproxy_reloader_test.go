@@ -0,0 +1,274 @@
+package templaterouter
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeProcess adds a process with the given command and state to the
+// fake proc directory.
+func fakeProcess(t *testing.T, procDir, pid, comm, state string) {
+	t.Helper()
+	dir := filepath.Join(procDir, pid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stat := pid + " (" + comm + ") " + state + " 1 1 1 0 -1"
+	if err := ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestReloader returns a reloader whose haproxy binary is a script that
+// records its arguments and exits with the given status.
+func newTestReloader(t *testing.T, exitStatus string) (*haproxyReloader, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for _, sub := range []string{"conf", "run", "proc"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	binary := filepath.Join(dir, "haproxy")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\necho haproxy output\nexit " + exitStatus + "\n"
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	return &haproxyReloader{
+		binary:             binary,
+		dir:                dir,
+		waitTime:           time.Second,
+		shutdownWaitTime:   time.Second,
+		healthCheckAddress: server.Listener.Addr().String(),
+		procDir:            filepath.Join(dir, "proc"),
+		signal:             func(int, syscall.Signal) error { return nil },
+	}, dir
+}
+
+func TestHAProxyPids(t *testing.T) {
+	reloader, _ := newTestReloader(t, "0")
+	fakeProcess(t, reloader.procDir, "10", "haproxy", "S")
+	fakeProcess(t, reloader.procDir, "11", "haproxy", "Z")
+	fakeProcess(t, reloader.procDir, "12", "openshift-route", "S")
+	fakeProcess(t, reloader.procDir, "13", "haproxy", "R")
+	if err := os.MkdirAll(filepath.Join(reloader.procDir, "self"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pids, err := reloader.haproxyPids()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{10, 13}; !reflect.DeepEqual(pids, expected) {
+		t.Errorf("expected pids %v, got %v", expected, pids)
+	}
+}
+
+func TestHAProxyReload(t *testing.T) {
+	reloader, dir := newTestReloader(t, "0")
+	reloader.masterSocketPath = "/var/lib/haproxy/run/haproxy-master.sock"
+	pidFile := filepath.Join(dir, haproxyPidFile)
+	config := filepath.Join(dir, haproxyConfigFile)
+
+	args := func() string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	// A pid file left behind by a process that is gone is removed.
+	if err := ioutil.WriteFile(pidFile, []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Errorf("expected the stale pid file to be removed")
+	}
+	if expected := "-W -S /var/lib/haproxy/run/haproxy-master.sock,mode,600 -f " + config + " -p " + pidFile; args() != expected {
+		t.Errorf("expected haproxy to be started with %q, got %q", expected, args())
+	}
+
+	// Running processes hand their sockets over and are told to finish.
+	reloader.masterSocketPath = ""
+	fakeProcess(t, reloader.procDir, "42", "haproxy", "S")
+	fakeProcess(t, reloader.procDir, "43", "haproxy", "S")
+	if err := ioutil.WriteFile(pidFile, []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, statsSocketFile), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(pidFile); err != nil {
+		t.Errorf("expected the pid file of a running process to be kept: %v", err)
+	}
+	if expected := "-f " + config + " -p " + pidFile + " -x " + filepath.Join(dir, statsSocketFile) + " -sf 42 43"; args() != expected {
+		t.Errorf("expected haproxy to be started with %q, got %q", expected, args())
+	}
+}
+
+func TestInProcessReloader(t *testing.T) {
+	cfg := templateRouterCfg{dir: "/var/lib/haproxy", reloadScriptPath: "/var/lib/haproxy/reload-haproxy", haproxyBinary: "/usr/sbin/haproxy"}
+	if reloader := inProcessReloader(cfg); reloader != nil {
+		t.Errorf("expected the reload script to be used by default")
+	}
+	cfg.inProcessReload = true
+	if reloader := inProcessReloader(cfg); reloader == nil || reloader.binary != cfg.haproxyBinary || reloader.dir != cfg.dir {
+		t.Errorf("expected haproxy to be reloaded in process, got %#v", reloader)
+	}
+}
+
+func TestReloadRouter(t *testing.T) {
+	reloader, dir := newTestReloader(t, "0")
+	script := filepath.Join(dir, "reload-haproxy")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\ntouch "+filepath.Join(dir, "reloaded")+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ran := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		defer os.Remove(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// The reload script is run by default.
+	router := &templateRouter{dir: dir, reloadScriptPath: script}
+	if err := router.reloadRouter(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ran("reloaded") || ran("args") {
+		t.Errorf("expected the reload script to reload haproxy")
+	}
+
+	// The router reloads haproxy itself when reloading in process.
+	router.reloader = reloader
+	if err := router.reloadRouter(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ran("reloaded") || !ran("args") {
+		t.Errorf("expected the router to reload haproxy in process")
+	}
+}
+
+func TestHAProxyReloadErrors(t *testing.T) {
+	reloader, _ := newTestReloader(t, "1")
+	err := reloader.reload(false)
+	var reloadErr *ReloadError
+	if !errors.As(err, &reloadErr) {
+		t.Fatalf("expected a reload error, got %v", err)
+	}
+	if reloadErr.Stage != ReloadStageStart || !strings.Contains(reloadErr.Output, "haproxy output") {
+		t.Errorf("expected the start to fail with the haproxy output, got %#v", reloadErr)
+	}
+	if err := reloader.checkConfig(); !errors.As(err, &reloadErr) || reloadErr.Stage != ReloadStageCheck {
+		t.Errorf("expected the check to fail, got %v", err)
+	}
+
+	reloader, _ = newTestReloader(t, "0")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader.healthCheckAddress = listener.Addr().String()
+	listener.Close()
+	if err := reloader.reload(false); !errors.As(err, &reloadErr) || reloadErr.Stage != ReloadStageHealthCheck {
+		t.Errorf("expected the health check to fail, got %v", err)
+	}
+}
+
+func TestHAProxyShutdown(t *testing.T) {
+	reloader, _ := newTestReloader(t, "0")
+	fakeProcess(t, reloader.procDir, "10", "haproxy", "S")
+	fakeProcess(t, reloader.procDir, "11", "haproxy", "S")
+
+	// The processes exit once they are told to drain.
+	var signals []syscall.Signal
+	reloader.signal = func(pid int, sig syscall.Signal) error {
+		signals = append(signals, sig)
+		fakeProcess(t, reloader.procDir, "10", "haproxy", "Z")
+		return nil
+	}
+	fakeProcess(t, reloader.procDir, "11", "haproxy", "Z")
+	if err := reloader.reload(true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []syscall.Signal{syscall.SIGUSR1}; !reflect.DeepEqual(signals, expected) {
+		t.Errorf("expected signals %v, got %v", expected, signals)
+	}
+
+	// Processes that do not drain in time are terminated.
+	signals = nil
+	fakeProcess(t, reloader.procDir, "10", "haproxy", "S")
+	reloader.signal = func(pid int, sig syscall.Signal) error {
+		signals = append(signals, sig)
+		return nil
+	}
+	reloader.shutdownWaitTime = 0
+	var reloadErr *ReloadError
+	if err := reloader.reload(true); !errors.As(err, &reloadErr) || reloadErr.Stage != ReloadStageShutdown {
+		t.Errorf("expected the shutdown to fail, got %v", err)
+	}
+	if expected := []syscall.Signal{syscall.SIGUSR1, syscall.SIGTERM}; !reflect.DeepEqual(signals, expected) {
+		t.Errorf("expected signals %v, got %v", expected, signals)
+	}
+}
+
+func TestHAProxyHealthCheckProxyProtocol(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	header := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		line, _ := reader.ReadString('\n')
+		header <- line
+		if _, err := http.ReadRequest(reader); err == nil {
+			conn.Write([]byte("HTTP/1.0 404 Not Found\r\n\r\n"))
+		}
+	}()
+
+	reloader := &haproxyReloader{healthCheckAddress: listener.Addr().String(), proxyProtocol: true}
+	if err := reloader.healthCheck(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if line := <-header; !strings.HasPrefix(line, "PROXY TCP4 127.0.0.1 127.0.0.1 ") {
+		t.Errorf("expected a PROXY protocol header, got %q", line)
+	}
+}
@@ -0,0 +1,253 @@
+package templaterouter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// The columns of the "show stat" output used to weight servers by
+	// their response time.
+	statServerNameField   = 1
+	statResponseTimeField = 60
+
+	// fullWeight is the percentage of the configured weight of servers
+	// that are not slowed down.
+	fullWeight = 100
+)
+
+// LatencyWeightingConfig configures how the weights of the servers of a
+// backend shift toward its fastest servers.
+type LatencyWeightingConfig struct {
+	// Interval is how often the response times of the servers are sampled
+	// and their weights adjusted.  Zero disables the weighting.
+	Interval time.Duration
+
+	// MaxStep is how many percentage points of its configured weight the
+	// weight of a server changes by at most per interval.
+	MaxStep int32
+
+	// MinWeight is the lowest percentage of its configured weight a
+	// server is set to, however slow it is.
+	MinWeight int32
+
+	// Hysteresis is how many percentage points the weight a server should
+	// have must differ from its current weight before it is changed, unless
+	// the server is back to full weight.
+	Hysteresis int32
+
+	// DisableFile is the path of a file whose presence restores the
+	// configured weights of all the servers and stops the weighting until
+	// it is removed.
+	DisableFile string
+}
+
+// latencyWeights tracks the weights the servers of the backends are set to,
+// as percentages of their configured weights.
+type latencyWeights struct {
+	config LatencyWeightingConfig
+
+	lock sync.Mutex
+	// weights are the weights of the servers that are not at full weight,
+	// keyed by <backend>/<server>.
+	weights map[string]int32
+}
+
+func newLatencyWeights(config LatencyWeightingConfig) *latencyWeights {
+	return &latencyWeights{config: config, weights: map[string]int32{}}
+}
+
+// serverResponseTime is the average response time of a server.
+type serverResponseTime struct {
+	server       string
+	responseTime int
+}
+
+// update reads the response times of the servers from the "show stat" output
+// of haproxy and returns the weights to set, keyed by <backend>/<server>.
+// The servers of a backend are weighted by how much slower than its fastest
+// server they respond, within the bounds of the configuration.  The weights
+// of all the slowed down servers are returned, so that they are set again
+// after haproxy reloads, together with the servers back to full weight.
+// The servers of the excluded backends, whose weights are managed by the
+// least-request weighting, are left alone.
+func (w *latencyWeights) update(stats io.Reader, exclude sets.String) (map[string]int32, error) {
+	reader := csv.NewReader(stats)
+	reader.TrailingComma = true
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	seen := map[string]bool{}
+	backends := map[string][]serverResponseTime{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the haproxy stats: %v", err)
+		}
+		if len(row) <= statTypeField || row[statTypeField] != statServerType || !strings.HasPrefix(row[statProxyNameField], "be_") {
+			continue
+		}
+		backend, server := row[statProxyNameField], row[statServerNameField]
+		if exclude.Has(backend) {
+			continue
+		}
+		seen[backend+"/"+server] = true
+		// Servers that are down or did not serve requests yet do not
+		// tell how fast they respond.
+		if row[statStatusField] != "UP" || len(row) <= statResponseTimeField {
+			continue
+		}
+		if rtime, err := strconv.Atoi(row[statResponseTimeField]); err == nil && rtime > 0 {
+			backends[backend] = append(backends[backend], serverResponseTime{server: server, responseTime: rtime})
+		}
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	targets := map[string]int32{}
+	for backend, servers := range backends {
+		if len(servers) < 2 {
+			continue
+		}
+		fastest := servers[0].responseTime
+		for _, server := range servers[1:] {
+			if server.responseTime < fastest {
+				fastest = server.responseTime
+			}
+		}
+		for _, server := range servers {
+			target := int32(fullWeight * fastest / server.responseTime)
+			if target < w.config.MinWeight {
+				target = w.config.MinWeight
+			}
+			targets[backend+"/"+server.server] = target
+		}
+	}
+
+	weights := map[string]int32{}
+	for key, target := range targets {
+		current, ok := w.weights[key]
+		if !ok {
+			current = fullWeight
+		}
+		if diff := target - current; target != fullWeight && diff < w.config.Hysteresis && -diff < w.config.Hysteresis {
+			target = current
+		}
+		weight := boundedStep(current, target, w.config.MaxStep)
+		if weight != fullWeight {
+			w.weights[key] = weight
+			weights[key] = weight
+		} else if ok {
+			delete(w.weights, key)
+			weights[key] = fullWeight
+		}
+	}
+	// Servers that can no longer be compared to the others of their
+	// backend are restored at once.
+	for key := range w.weights {
+		if _, ok := targets[key]; ok {
+			continue
+		}
+		delete(w.weights, key)
+		if seen[key] {
+			weights[key] = fullWeight
+		}
+	}
+	return weights, nil
+}
+
+// reset forgets the weights of all the servers and returns the full weight
+// for every server that was slowed down.
+func (w *latencyWeights) reset() map[string]int32 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	weights := map[string]int32{}
+	for key := range w.weights {
+		weights[key] = fullWeight
+	}
+	w.weights = map[string]int32{}
+	return weights
+}
+
+// boundedStep returns the weight between current and target that is at most
+// maxStep away from current.
+func boundedStep(current, target, maxStep int32) int32 {
+	switch {
+	case target > current+maxStep:
+		return current + maxStep
+	case target < current-maxStep:
+		return current - maxStep
+	default:
+		return target
+	}
+}
+
+// setWeightCommands returns the haproxy commands setting the weights of the
+// servers, sorted so that they are applied in a stable order.
+func setWeightCommands(weights map[string]int32) []string {
+	commands := make([]string, 0, len(weights))
+	for key, weight := range weights {
+		commands = append(commands, fmt.Sprintf("set weight %s %d%%", key, weight))
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// RunLatencyWeighting samples the response times of the servers from haproxy
+// and shifts the weights of the servers of each backend toward its fastest
+// servers until stopCh is closed.
+func (r *templateRouter) RunLatencyWeighting(stopCh <-chan struct{}) error {
+	if r.latencyWeights == nil {
+		return fmt.Errorf("latency weighting is not enabled")
+	}
+	cli := newMasterCLI(filepath.Join(r.dir, statsSocketFile))
+	config := r.latencyWeights.config
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+
+			var weights map[string]int32
+			if len(config.DisableFile) > 0 && fileExists(config.DisableFile) {
+				weights = r.latencyWeights.reset()
+			} else {
+				out, err := cli.execute("show stat")
+				if err == errMasterNotRunning {
+					continue
+				}
+				if err == nil {
+					weights, err = r.latencyWeights.update(strings.NewReader(out), r.leastRequestBackends())
+				}
+				if err != nil {
+					log.Error(err, "failed to sample the response times of the servers")
+					continue
+				}
+			}
+			for _, cmd := range setWeightCommands(weights) {
+				if out, err := cli.execute(cmd); err != nil {
+					log.Error(err, "failed to set the weight of a server", "command", cmd)
+				} else if out = strings.TrimSpace(out); len(out) > 0 {
+					log.V(4).Info("unable to set the weight of a server", "command", cmd, "output", out)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,88 @@
+package templaterouter
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// responseTimeStat is a server row of the "show stat" output.
+type responseTimeStat struct {
+	backend      string
+	server       string
+	status       string
+	responseTime int
+}
+
+// showResponseTimeStat returns "show stat" output with a row per server.
+func showResponseTimeStat(servers ...responseTimeStat) string {
+	lines := []string{"# pxname,svname,status,type,rtime"}
+	for _, server := range servers {
+		row := make([]string, statResponseTimeField+2)
+		row[statProxyNameField] = server.backend
+		row[statServerNameField] = server.server
+		row[statStatusField] = server.status
+		row[statTypeField] = statServerType
+		row[statResponseTimeField] = strconv.Itoa(server.responseTime)
+		lines = append(lines, strings.Join(row, ","))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestLatencyWeights(t *testing.T) {
+	weights := newLatencyWeights(LatencyWeightingConfig{MaxStep: 20, MinWeight: 30, Hysteresis: 10})
+
+	update := func(expected map[string]int32, servers ...responseTimeStat) {
+		t.Helper()
+		got, err := weights.update(strings.NewReader(showResponseTimeStat(servers...)), nil)
+		if err != nil {
+			t.Fatalf("unable to update the weights: %v", err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected weights %v, got %v", expected, got)
+		}
+	}
+
+	slow := []responseTimeStat{
+		{"be_http:ns:app", "fast", "UP", 100},
+		{"be_http:ns:app", "slow", "UP", 400},
+		{"be_http:ns:app", "close", "UP", 105},
+		// Servers alone in their backend are not weighted.
+		{"be_http:ns:single", "only", "UP", 500},
+		{"openshift_default", "other", "UP", 500},
+	}
+	// The slow server is slowed down a step at a time down to the minimum
+	// weight, the server close to the fastest one is within the hysteresis.
+	update(map[string]int32{"be_http:ns:app/slow": 80}, slow...)
+	update(map[string]int32{"be_http:ns:app/slow": 60}, slow...)
+	update(map[string]int32{"be_http:ns:app/slow": 40}, slow...)
+	update(map[string]int32{"be_http:ns:app/slow": 30}, slow...)
+	update(map[string]int32{"be_http:ns:app/slow": 30}, slow...)
+
+	// Small changes of the response time are ignored.
+	update(map[string]int32{"be_http:ns:app/slow": 30}, responseTimeStat{"be_http:ns:app", "fast", "UP", 100}, responseTimeStat{"be_http:ns:app", "slow", "UP", 280})
+	// Servers recovering climb back a step at a time.
+	update(map[string]int32{"be_http:ns:app/slow": 50}, responseTimeStat{"be_http:ns:app", "fast", "UP", 100}, responseTimeStat{"be_http:ns:app", "slow", "UP", 100})
+
+	// Servers that can no longer be compared are restored at once.
+	update(map[string]int32{"be_http:ns:app/slow": 100}, responseTimeStat{"be_http:ns:app", "fast", "UP", 100}, responseTimeStat{"be_http:ns:app", "slow", "DOWN", 100})
+	update(map[string]int32{}, responseTimeStat{"be_http:ns:app", "fast", "UP", 100}, responseTimeStat{"be_http:ns:app", "slow", "UP", 100})
+
+	// The kill switch restores every slowed down server.
+	update(map[string]int32{"be_http:ns:app/slow": 80}, slow...)
+	if got := weights.reset(); !reflect.DeepEqual(got, map[string]int32{"be_http:ns:app/slow": 100}) {
+		t.Errorf("expected the slow server to be restored, got %v", got)
+	}
+	if got := weights.reset(); len(got) != 0 {
+		t.Errorf("expected no weights after a reset, got %v", got)
+	}
+}
+
+func TestSetWeightCommands(t *testing.T) {
+	commands := setWeightCommands(map[string]int32{"be_http:ns:b/s": 100, "be_http:ns:a/s": 40})
+	expected := []string{"set weight be_http:ns:a/s 40%", "set weight be_http:ns:b/s 100%"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected %q, got %q", expected, commands)
+	}
+}
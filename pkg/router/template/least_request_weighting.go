@@ -0,0 +1,229 @@
+package templaterouter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	templateutil "github.com/openshift/router/pkg/router/template/util"
+)
+
+const (
+	// The columns of the "show stat" output counting the outstanding
+	// requests of the servers.
+	statQueueCurrentField    = 2
+	statSessionsCurrentField = 4
+)
+
+// LeastRequestWeightingConfig configures how the weights of the servers of
+// the routes with least-request weighting shift away from their servers
+// with the most outstanding requests.
+type LeastRequestWeightingConfig struct {
+	// Interval is how often the outstanding requests of the servers are
+	// sampled and their weights adjusted.  Zero disables the weighting.
+	Interval time.Duration
+
+	// MaxStep is how many percentage points of its configured weight the
+	// weight of a server changes by at most per interval.
+	MaxStep int32
+
+	// MinWeight is the lowest percentage of its configured weight a
+	// server is set to, however many requests it has outstanding.
+	MinWeight int32
+}
+
+// leastRequestWeights tracks the weights the servers of the backends with
+// least-request weighting are set to, as percentages of their configured
+// weights.
+type leastRequestWeights struct {
+	config LeastRequestWeightingConfig
+
+	lock sync.Mutex
+	// weights are the weights of the servers that are not at full weight,
+	// keyed by <backend>/<server>.
+	weights map[string]int32
+}
+
+func newLeastRequestWeights(config LeastRequestWeightingConfig) *leastRequestWeights {
+	return &leastRequestWeights{config: config, weights: map[string]int32{}}
+}
+
+// serverOutstandingRequests is the number of requests a server is serving
+// or has queued.
+type serverOutstandingRequests struct {
+	server      string
+	outstanding int
+}
+
+// update reads the outstanding requests of the servers of backends from the
+// "show stat" output of haproxy and returns the weights to set, keyed by
+// <backend>/<server>.  The servers of a backend are weighted by how many
+// more requests than its least loaded server they have outstanding, within
+// the bounds of the configuration.  As for the latency weighting, the
+// weights of all the lowered servers are returned so that they are set again
+// after haproxy reloads, together with the servers back to full weight.
+func (w *leastRequestWeights) update(stats io.Reader, backends sets.String) (map[string]int32, error) {
+	reader := csv.NewReader(stats)
+	reader.TrailingComma = true
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+
+	seen := map[string]bool{}
+	servers := map[string][]serverOutstandingRequests{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the haproxy stats: %v", err)
+		}
+		if len(row) <= statTypeField || row[statTypeField] != statServerType {
+			continue
+		}
+		backend, server := row[statProxyNameField], row[statServerNameField]
+		seen[backend+"/"+server] = true
+		if !backends.Has(backend) || row[statStatusField] != "UP" {
+			continue
+		}
+		queued, err := strconv.Atoi(row[statQueueCurrentField])
+		if err != nil {
+			continue
+		}
+		sessions, err := strconv.Atoi(row[statSessionsCurrentField])
+		if err != nil {
+			continue
+		}
+		servers[backend] = append(servers[backend], serverOutstandingRequests{server: server, outstanding: queued + sessions})
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	targets := map[string]int32{}
+	for backend, servers := range servers {
+		if len(servers) < 2 {
+			continue
+		}
+		least := servers[0].outstanding
+		for _, server := range servers[1:] {
+			if server.outstanding < least {
+				least = server.outstanding
+			}
+		}
+		for _, server := range servers {
+			// One is added so that idle servers are not infinitely
+			// preferred over servers with a single request.
+			target := int32(fullWeight * (least + 1) / (server.outstanding + 1))
+			if target < w.config.MinWeight {
+				target = w.config.MinWeight
+			}
+			targets[backend+"/"+server.server] = target
+		}
+	}
+
+	weights := map[string]int32{}
+	for key, target := range targets {
+		current, ok := w.weights[key]
+		if !ok {
+			current = fullWeight
+		}
+		weight := boundedStep(current, target, w.config.MaxStep)
+		if weight != fullWeight {
+			w.weights[key] = weight
+			weights[key] = weight
+		} else if ok {
+			delete(w.weights, key)
+			weights[key] = fullWeight
+		}
+	}
+	// Servers that can no longer be compared to the others of their
+	// backend, or whose route no longer has least-request weighting, are
+	// restored at once.
+	for key := range w.weights {
+		if _, ok := targets[key]; ok {
+			continue
+		}
+		delete(w.weights, key)
+		if seen[key] {
+			weights[key] = fullWeight
+		}
+	}
+	return weights, nil
+}
+
+// leastRequestBackends returns the names of the backends of the routes with
+// least-request weighting.
+func (r *templateRouter) leastRequestBackends() sets.String {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	backends := sets.NewString()
+	for key, cfg := range r.state {
+		if !cfg.LeastRequestWeighting {
+			continue
+		}
+		if cfg.TCPPort != 0 {
+			backends.Insert(fmt.Sprintf("be_tcp_port:%s", key))
+		} else {
+			backends.Insert(fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(cfg.TLSTermination), key))
+		}
+	}
+	return backends
+}
+
+// RunLeastRequestWeighting samples the outstanding requests of the servers
+// of the routes with least-request weighting from haproxy and shifts the
+// weights of the servers of each of their backends toward its least loaded
+// servers until stopCh is closed.
+func (r *templateRouter) RunLeastRequestWeighting(stopCh <-chan struct{}) error {
+	if r.leastRequestWeights == nil {
+		return fmt.Errorf("least-request weighting is not enabled")
+	}
+	cli := newMasterCLI(filepath.Join(r.dir, statsSocketFile))
+	go func() {
+		ticker := time.NewTicker(r.leastRequestWeights.config.Interval)
+		defer ticker.Stop()
+		idle := false
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+
+			// Once the weights of the last route with least-request
+			// weighting are restored, the stats are no longer read.
+			backends := r.leastRequestBackends()
+			if len(backends) == 0 && idle {
+				continue
+			}
+			out, err := cli.execute("show stat")
+			if err == errMasterNotRunning {
+				continue
+			}
+			var weights map[string]int32
+			if err == nil {
+				weights, err = r.leastRequestWeights.update(strings.NewReader(out), backends)
+			}
+			if err != nil {
+				log.Error(err, "failed to sample the outstanding requests of the servers")
+				continue
+			}
+			idle = len(backends) == 0
+			for _, cmd := range setWeightCommands(weights) {
+				if out, err := cli.execute(cmd); err != nil {
+					log.Error(err, "failed to set the weight of a server", "command", cmd)
+				} else if out = strings.TrimSpace(out); len(out) > 0 {
+					log.V(4).Info("unable to set the weight of a server", "command", cmd, "output", out)
+				}
+			}
+		}
+	}()
+	return nil
+}
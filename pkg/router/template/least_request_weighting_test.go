@@ -0,0 +1,107 @@
+package templaterouter
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// outstandingRequestsStat is a server row of the "show stat" output.
+type outstandingRequestsStat struct {
+	backend  string
+	server   string
+	status   string
+	queued   int
+	sessions int
+}
+
+// showOutstandingRequestsStat returns "show stat" output with a row per
+// server.
+func showOutstandingRequestsStat(servers ...outstandingRequestsStat) string {
+	lines := []string{"# pxname,svname,qcur,qmax,scur,status,type"}
+	for _, server := range servers {
+		row := make([]string, statTypeField+2)
+		row[statProxyNameField] = server.backend
+		row[statServerNameField] = server.server
+		row[statQueueCurrentField] = strconv.Itoa(server.queued)
+		row[statSessionsCurrentField] = strconv.Itoa(server.sessions)
+		row[statStatusField] = server.status
+		row[statTypeField] = statServerType
+		lines = append(lines, strings.Join(row, ","))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestLeastRequestWeights(t *testing.T) {
+	weights := newLeastRequestWeights(LeastRequestWeightingConfig{MaxStep: 25, MinWeight: 30})
+	backends := sets.NewString("be_http:ns:app", "be_http:ns:single")
+
+	update := func(expected map[string]int32, servers ...outstandingRequestsStat) {
+		t.Helper()
+		got, err := weights.update(strings.NewReader(showOutstandingRequestsStat(servers...)), backends)
+		if err != nil {
+			t.Fatalf("unable to update the weights: %v", err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected weights %v, got %v", expected, got)
+		}
+	}
+
+	loaded := []outstandingRequestsStat{
+		{"be_http:ns:app", "idle", "UP", 0, 1},
+		{"be_http:ns:app", "busy", "UP", 4, 6},
+		// Servers alone in their backend are not weighted.
+		{"be_http:ns:single", "only", "UP", 0, 50},
+		// Neither are the servers of routes without the weighting.
+		{"be_http:ns:other", "a", "UP", 0, 0},
+		{"be_http:ns:other", "b", "UP", 0, 50},
+	}
+	// The busy server is lowered a step at a time down to the minimum
+	// weight.
+	update(map[string]int32{"be_http:ns:app/busy": 75}, loaded...)
+	update(map[string]int32{"be_http:ns:app/busy": 50}, loaded...)
+	update(map[string]int32{"be_http:ns:app/busy": 30}, loaded...)
+	update(map[string]int32{"be_http:ns:app/busy": 30}, loaded...)
+
+	// Servers catching up climb back a step at a time.
+	update(map[string]int32{"be_http:ns:app/busy": 55}, outstandingRequestsStat{"be_http:ns:app", "idle", "UP", 0, 3}, outstandingRequestsStat{"be_http:ns:app", "busy", "UP", 0, 3})
+
+	// Servers of routes whose weighting was disabled are restored at once.
+	backends = sets.NewString()
+	update(map[string]int32{"be_http:ns:app/busy": 100}, loaded...)
+	update(map[string]int32{}, loaded...)
+}
+
+func TestLatencyWeightsExcludeLeastRequestBackends(t *testing.T) {
+	weights := newLatencyWeights(LatencyWeightingConfig{MaxStep: 20, MinWeight: 30})
+	stats := showResponseTimeStat(
+		responseTimeStat{"be_http:ns:app", "fast", "UP", 100},
+		responseTimeStat{"be_http:ns:app", "slow", "UP", 400},
+	)
+	got, err := weights.update(strings.NewReader(stats), sets.NewString("be_http:ns:app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected the least-request backends to be left alone, got %v", got)
+	}
+}
+
+func TestLeastRequestBackends(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	router.state = map[ServiceAliasConfigKey]ServiceAliasConfig{
+		"ns:edge":        {TLSTermination: routev1.TLSTerminationEdge, LeastRequestWeighting: true},
+		"ns:passthrough": {TLSTermination: routev1.TLSTerminationPassthrough, LeastRequestWeighting: true},
+		"ns:tcp":         {TCPPort: 10000, LeastRequestWeighting: true},
+		"ns:plain":       {},
+	}
+	expected := sets.NewString("be_edge_http:ns:edge", "be_tcp:ns:passthrough", "be_tcp_port:ns:tcp")
+	if got := router.leastRequestBackends(); !got.Equal(expected) {
+		t.Errorf("expected backends %v, got %v", expected.List(), got.List())
+	}
+}
@@ -0,0 +1,145 @@
+package templaterouter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// shardedMapFiles are the maps of the routes, relative to the working
+// directory of the router, that are split into shards once they hold more
+// entries than the router allows in a file.  They hold an entry per host and
+// path, so they grow with the routes, and haproxy looks each of them up in
+// turn from the frontends.
+var shardedMapFiles = []string{
+	"conf/os_http_be.map",
+	"conf/os_edge_reencrypt_be.map",
+	"conf/os_route_http_redirect.map",
+	"conf/os_tcp_be.map",
+	"conf/os_sni_passthrough.map",
+	"conf/os_sni_host_mismatch_exempt.map",
+}
+
+// mapShardName returns the name of shard i of a map.  The first shard keeps
+// the name of the map, so the runtime API and the state kept across reloads
+// still find it, and the others are numbered, e.g. os_http_be.1.map.
+func mapShardName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.%d.map", strings.TrimSuffix(name, ".map"), i)
+}
+
+// splitMap splits the rendered contents of a map into shards of at most
+// maxEntries entries.  The entries keep their order, most specific first, so
+// the first shard with a match holds the entry haproxy would have matched in
+// the whole map.  A map that fits in one shard is returned as it is.
+func splitMap(contents []byte, maxEntries int) [][]byte {
+	var shards [][]byte
+	var shard bytes.Buffer
+	entries := 0
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(contents)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if entries == maxEntries {
+			shards = append(shards, append([]byte(nil), shard.Bytes()...))
+			shard.Reset()
+			entries = 0
+		}
+		shard.WriteString(line)
+		shard.WriteByte('\n')
+		entries++
+	}
+	if len(shards) == 0 {
+		return [][]byte{contents}
+	}
+	return append(shards, append([]byte(nil), shard.Bytes()...))
+}
+
+// renderMapShards renders the maps of templates that may be split and splits
+// those with more than maxEntries entries into shards.  It returns the files
+// of the maps, shards included, and sets the shards of the split maps in the
+// MapFiles of data for the frontends to chain their lookups.  Nothing is
+// rendered if maxEntries is zero.
+func renderMapShards(templates map[string]*template.Template, data *templateData, maxEntries int) ([]File, error) {
+	if maxEntries <= 0 {
+		return nil, nil
+	}
+	var files []File
+	for _, name := range shardedMapFiles {
+		t, ok := templates[name]
+		if !ok {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, *data); err != nil {
+			return nil, fmt.Errorf("error executing template for file %s: %v", name, err)
+		}
+		shards := splitMap(buf.Bytes(), maxEntries)
+		if len(shards) == 1 {
+			files = append(files, File{Name: name, Contents: shards[0]})
+			continue
+		}
+		if data.MapFiles == nil {
+			data.MapFiles = map[string][]string{}
+		}
+		for i, contents := range shards {
+			shardName := mapShardName(name, i)
+			files = append(files, File{Name: shardName, Contents: contents})
+			data.MapFiles[path.Base(name)] = append(data.MapFiles[path.Base(name)], path.Base(shardName))
+		}
+	}
+	return files, nil
+}
+
+// writeMapShards writes the map files rendered by renderMapShards to dir and
+// removes the shards left over from maps that have since shrunk.
+func writeMapShards(dir string, files []File) error {
+	written := sets.NewString()
+	for _, file := range files {
+		filename := filepath.Join(dir, file.Name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			return fmt.Errorf("error creating path %q: %v", filepath.Dir(filename), err)
+		}
+		if err := os.WriteFile(filename, file.Contents, 0644); err != nil {
+			return fmt.Errorf("error writing config file %s: %v", filename, err)
+		}
+		written.Insert(filename)
+	}
+	for _, name := range shardedMapFiles {
+		stale, err := filepath.Glob(filepath.Join(dir, strings.TrimSuffix(name, ".map")+".*.map"))
+		if err != nil {
+			return err
+		}
+		for _, filename := range stale {
+			if written.Has(filename) {
+				continue
+			}
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing map shard %s: %v", filename, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mapFiles returns the files of a map of the routes, relative to the conf
+// directory of the router, that haproxy looks up in turn: the shards of the
+// map if it was split, and the map itself otherwise.
+func mapFiles(td templateData, name string) []string {
+	if shards, ok := td.MapFiles[name]; ok {
+		return shards
+	}
+	return []string{name}
+}
@@ -0,0 +1,164 @@
+package templaterouter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestSplitMap(t *testing.T) {
+	tests := []struct {
+		name       string
+		contents   string
+		maxEntries int
+		expected   []string
+	}{
+		{
+			name:       "empty map",
+			contents:   "",
+			maxEntries: 2,
+			expected:   []string{""},
+		},
+		{
+			name:       "map that fits",
+			contents:   "a 1\nb 2\n",
+			maxEntries: 2,
+			expected:   []string{"a 1\nb 2\n"},
+		},
+		{
+			name:       "map split in order",
+			contents:   "a 1\nb 2\n\nc 3\nd 4\ne 5\n",
+			maxEntries: 2,
+			expected:   []string{"a 1\nb 2\n", "c 3\nd 4\n", "e 5\n"},
+		},
+	}
+	for _, tc := range tests {
+		var shards []string
+		for _, shard := range splitMap([]byte(tc.contents), tc.maxEntries) {
+			shards = append(shards, string(shard))
+		}
+		if !reflect.DeepEqual(shards, tc.expected) {
+			t.Errorf("%s: expected the shards %q, got %q", tc.name, tc.expected, shards)
+		}
+	}
+
+	if name := mapShardName("conf/os_http_be.map", 0); name != "conf/os_http_be.map" {
+		t.Errorf("expected the first shard to keep the name of the map, got %s", name)
+	}
+	if name := mapShardName("conf/os_http_be.map", 2); name != "conf/os_http_be.2.map" {
+		t.Errorf("expected the third shard to be conf/os_http_be.2.map, got %s", name)
+	}
+}
+
+func TestWriteMapShards(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "conf"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"os_http_be.1.map", "os_http_be.2.map", "cert_config.map"} {
+		if err := os.WriteFile(filepath.Join(dir, "conf", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := []File{
+		{Name: "conf/os_http_be.map", Contents: []byte("a 1\n")},
+		{Name: "conf/os_http_be.1.map", Contents: []byte("b 2\n")},
+	}
+	if err := writeMapShards(dir, files); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"os_http_be.map", "os_http_be.1.map", "cert_config.map"} {
+		if _, err := os.Stat(filepath.Join(dir, "conf", name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conf", "os_http_be.2.map")); !os.IsNotExist(err) {
+		t.Errorf("expected the stale shard os_http_be.2.map to be removed, got %v", err)
+	}
+}
+
+func TestMapShardsTemplate(t *testing.T) {
+	var routes []*routev1.Route
+	for i := 0; i < 5; i++ {
+		routes = append(routes, &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: fmt.Sprintf("r%d", i)},
+			Spec: routev1.RouteSpec{
+				Host: fmt.Sprintf("r%d.example.com", i),
+				To:   routev1.RouteTargetReference{Name: "svc"},
+			},
+		})
+	}
+
+	render := func(maxEntries int) map[string]string {
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath:      "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:        "/var/lib/haproxy",
+			BindPorts:         true,
+			MaxMapFileEntries: maxEntries,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		files, err := renderer.Render(renderer.RouteState(routes))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		contents := map[string]string{}
+		for _, file := range files {
+			contents[file.Name] = string(file.Contents)
+		}
+		return contents
+	}
+
+	unsplit := render(0)
+	if _, ok := unsplit["conf/os_http_be.1.map"]; ok {
+		t.Errorf("expected the map not to be split without a limit")
+	}
+	if fits := render(5); fits["conf/haproxy.config"] != unsplit["conf/haproxy.config"] {
+		t.Errorf("expected the configuration not to change when the maps fit")
+	}
+
+	split := render(2)
+	var entries []string
+	for i, name := range []string{"conf/os_http_be.map", "conf/os_http_be.1.map", "conf/os_http_be.2.map"} {
+		contents, ok := split[name]
+		if !ok {
+			t.Fatalf("expected the shard %s to be rendered", name)
+		}
+		lines := strings.Split(strings.TrimSpace(contents), "\n")
+		if expected := []int{2, 2, 1}[i]; len(lines) != expected {
+			t.Errorf("expected %d entries in %s, got %d", expected, name, len(lines))
+		}
+		entries = append(entries, lines...)
+	}
+	if expected := strings.Split(strings.TrimSpace(unsplit["conf/os_http_be.map"]), "\n"); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected the shards to hold the entries of the map in order %q, got %q", expected, entries)
+	}
+	if _, ok := split["conf/os_http_be.3.map"]; ok {
+		t.Errorf("expected no fourth shard")
+	}
+
+	config := split["conf/haproxy.config"]
+	for _, expected := range []string{
+		"  use_backend %[base,map_reg(/var/lib/haproxy/conf/os_http_be.map)] if { base,map_reg(/var/lib/haproxy/conf/os_http_be.map) -m found }\n" +
+			"  use_backend %[base,map_reg(/var/lib/haproxy/conf/os_http_be.1.map)] if { base,map_reg(/var/lib/haproxy/conf/os_http_be.1.map) -m found }\n" +
+			"  use_backend %[base,map_reg(/var/lib/haproxy/conf/os_http_be.2.map)] if { base,map_reg(/var/lib/haproxy/conf/os_http_be.2.map) -m found }\n",
+		"  http-request set-var(txn.secure_redirect) base,map_reg_int(/var/lib/haproxy/conf/os_route_http_redirect.1.map) if !{ var(txn.secure_redirect) -m found } { base,map_reg(/var/lib/haproxy/conf/os_route_http_redirect.1.map) -m found }\n",
+		"  acl secure_redirect var(txn.secure_redirect) -m bool\n",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected the configuration to contain %q", expected)
+		}
+	}
+	if strings.Contains(config, "use_backend %[base,map_reg(/var/lib/haproxy/conf/os_http_be.map)]\n") {
+		t.Errorf("expected the lookup of the whole map to be replaced by the lookups of its shards")
+	}
+}
@@ -0,0 +1,213 @@
+package templaterouter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// masterCLITimeout is the timeout for a single command sent to the
+	// haproxy master CLI.
+	masterCLITimeout = 5 * time.Second
+
+	// masterWorkerReloadTimeout is how long to wait for the haproxy master
+	// to start a new generation of workers after a reload.
+	masterWorkerReloadTimeout = 30 * time.Second
+
+	// masterWorkerPollInterval is how often the haproxy master is polled
+	// while waiting for a reload to complete.
+	masterWorkerPollInterval = 100 * time.Millisecond
+)
+
+// errMasterNotRunning is returned when the haproxy master CLI socket cannot
+// be reached, which means haproxy needs to be started by the reload script.
+var errMasterNotRunning = errors.New("haproxy master process is not running")
+
+// failedReloadsRE matches the failed reload counter on the master line of
+// the "show proc" output.
+var failedReloadsRE = regexp.MustCompile(`\[failed:\s*([0-9]+)\]`)
+
+// OldWorkersConfig limits how long the haproxy processes of previous
+// reloads keep draining their connections, so that they do not accumulate
+// across reloads when clients keep their connections open.
+type OldWorkersConfig struct {
+	// HardStopAfter is the haproxy timeout after which the processes of a
+	// previous reload are stopped.  Empty uses ROUTER_HARD_STOP_AFTER.
+	HardStopAfter string
+	// MaxReloads is the number of reloads a worker survives before the
+	// haproxy master stops it.  Zero uses ROUTER_MAX_WORKER_RELOADS.
+	MaxReloads int
+}
+
+// masterCLI sends commands to the haproxy master process over its CLI socket.
+type masterCLI struct {
+	socketPath string
+	timeout    time.Duration
+}
+
+// newMasterCLI returns a client for the haproxy master CLI listening on
+// the unix socket at socketPath.
+func newMasterCLI(socketPath string) *masterCLI {
+	return &masterCLI{socketPath: socketPath, timeout: masterCLITimeout}
+}
+
+// execute runs a single command on the master CLI and returns its output.
+// The master closes the connection once the command has completed.
+func (c *masterCLI) execute(cmd string) (string, error) {
+	conn, err := net.DialTimeout("unix", c.socketPath, c.timeout)
+	if err != nil {
+		return "", errMasterNotRunning
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return "", fmt.Errorf("unable to send %q to the haproxy master: %v", cmd, err)
+	}
+	out, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the haproxy master response to %q: %v", cmd, err)
+	}
+	return string(out), nil
+}
+
+// haproxyProcesses describes the processes managed by the haproxy master.
+type haproxyProcesses struct {
+	// failedReloads is the number of reloads the master failed to apply.
+	failedReloads int
+	// workers are the pids of the current generation of workers.
+	workers []int
+	// oldWorkers are the pids of workers from previous generations that
+	// are still draining connections.
+	oldWorkers []int
+}
+
+// showProcesses returns the processes currently managed by the master.
+func (c *masterCLI) showProcesses() (*haproxyProcesses, error) {
+	out, err := c.execute("show proc")
+	if err != nil {
+		return nil, err
+	}
+	return parseShowProc(out)
+}
+
+// parseShowProc parses the output of the master CLI "show proc" command.
+func parseShowProc(out string) (*haproxyProcesses, error) {
+	procs := &haproxyProcesses{}
+	section, foundMaster := "", false
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// section headers look like "# workers"; the column header
+			// line starts with "#<PID>".
+			if strings.HasPrefix(line, "# ") {
+				section = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			}
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected haproxy process line %q", line)
+		}
+		switch {
+		case fields[1] == "master":
+			foundMaster = true
+			if m := failedReloadsRE.FindStringSubmatch(line); m != nil {
+				procs.failedReloads, _ = strconv.Atoi(m[1])
+			}
+		case fields[1] != "worker":
+			// external programs are not workers.
+		case section == "workers":
+			procs.workers = append(procs.workers, pid)
+		case section == "old workers":
+			procs.oldWorkers = append(procs.oldWorkers, pid)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !foundMaster {
+		return nil, fmt.Errorf("no master process found in haproxy process list")
+	}
+	return procs, nil
+}
+
+// replaces returns true if the current workers in procs are a new
+// generation compared to the workers in previous.
+func (procs *haproxyProcesses) replaces(previous *haproxyProcesses) bool {
+	if len(procs.workers) == 0 {
+		return false
+	}
+	for _, pid := range procs.workers {
+		for _, old := range previous.workers {
+			if pid == old {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reloadMasterWorker asks the haproxy master to reload its configuration and
+// waits for a new generation of workers to start. Returns errMasterNotRunning
+// if the master cannot be reached.
+func (r *templateRouter) reloadMasterWorker() error {
+	cli := newMasterCLI(r.masterSocketPath)
+	before, err := cli.showProcesses()
+	if err != nil {
+		return err
+	}
+
+	out, err := cli.execute("reload")
+	if err == errMasterNotRunning {
+		return fmt.Errorf("lost connection to the haproxy master while reloading")
+	}
+	if err != nil {
+		return err
+	}
+	// newer versions of haproxy report the outcome of the reload.
+	if strings.Contains(out, "Success=0") {
+		return fmt.Errorf("haproxy master failed to reload:\n%s", out)
+	}
+
+	deadline := time.Now().Add(masterWorkerReloadTimeout)
+	for {
+		// the master re-executes itself while reloading, so the socket is
+		// briefly unavailable.
+		after, err := cli.showProcesses()
+		if err == nil {
+			if after.failedReloads > before.failedReloads {
+				return fmt.Errorf("haproxy master failed to load the new configuration, old workers are still serving")
+			}
+			if after.replaces(before) {
+				r.workerGeneration++
+				r.metricOldWorkers.Set(float64(len(after.oldWorkers)))
+				log.V(0).Info("router reloaded", "generation", r.workerGeneration, "workers", after.workers, "oldWorkers", after.oldWorkers)
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for haproxy to start new workers", masterWorkerReloadTimeout)
+		}
+		time.Sleep(masterWorkerPollInterval)
+	}
+}
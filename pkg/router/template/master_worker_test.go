@@ -0,0 +1,195 @@
+package templaterouter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestParseShowProc tests parsing the master CLI process list.
+func TestParseShowProc(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected *haproxyProcesses
+		err      bool
+	}{
+		{
+			name: "single generation",
+			output: `#<PID>          <type>          <reloads>       <uptime>        <version>
+1               master          0 [failed: 0]   0d00h00m08s     2.2.15
+# workers
+8               worker          0               0d00h00m08s     2.2.15
+# old workers
+# programs
+`,
+			expected: &haproxyProcesses{workers: []int{8}},
+		},
+		{
+			name: "draining old workers after failed reload",
+			output: `#<PID>          <type>          <reloads>       <uptime>        <version>
+1               master          3 [failed: 1]   0d00h02m07s     2.2.15
+# workers
+31              worker          0               0d00h00m01s     2.2.15
+32              worker          0               0d00h00m01s     2.2.15
+# old workers
+24              worker          1               0d00h00m43s     2.2.15
+# programs
+40              rsyslog         0               0d00h02m07s     -
+`,
+			expected: &haproxyProcesses{failedReloads: 1, workers: []int{31, 32}, oldWorkers: []int{24}},
+		},
+		{
+			name: "no master",
+			output: `# workers
+8               worker          0               0d00h00m08s     2.2.15
+`,
+			err: true,
+		},
+		{
+			name:   "garbage",
+			output: "Unknown command.\n",
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		procs, err := parseShowProc(tc.output)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got none", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(procs, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, procs)
+		}
+	}
+}
+
+// fakeMaster emulates the haproxy master CLI.
+type fakeMaster struct {
+	lock       sync.Mutex
+	listener   net.Listener
+	generation int
+	failed     int
+	failReload bool
+}
+
+func (m *fakeMaster) serve() {
+	for {
+		conn, err := m.listener.Accept()
+		if err != nil {
+			return
+		}
+		cmd, _ := bufio.NewReader(conn).ReadString('\n')
+		m.lock.Lock()
+		switch strings.TrimSpace(cmd) {
+		case "show proc":
+			fmt.Fprintf(conn, "#<PID> <type> <reloads> <uptime> <version>\n1 master %d [failed: %d] 0d00h00m01s 2.2.15\n# workers\n", m.generation, m.failed)
+			fmt.Fprintf(conn, "%d worker 0 0d00h00m01s 2.2.15\n# old workers\n", 10+m.generation)
+			if m.generation > 0 {
+				fmt.Fprintf(conn, "%d worker 1 0d00h00m01s 2.2.15\n", 10+m.generation-1)
+			}
+		case "reload":
+			// a failed reload keeps the current workers running.
+			if m.failReload {
+				m.failed++
+			} else {
+				m.generation++
+			}
+		}
+		m.lock.Unlock()
+		conn.Close()
+	}
+}
+
+func newFakeMaster(t *testing.T, dir string) *fakeMaster {
+	listener, err := net.Listen("unix", filepath.Join(dir, "master.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &fakeMaster{listener: listener}
+	go m.serve()
+	return m
+}
+
+// TestReloadMasterWorker tests reloading haproxy through the master CLI.
+func TestReloadMasterWorker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "master-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	router := &templateRouter{
+		masterSocketPath: filepath.Join(dir, "master.sock"),
+		metricOldWorkers: prometheus.NewGauge(prometheus.GaugeOpts{Name: "old_workers"}),
+	}
+	if err := router.reloadMasterWorker(); err != errMasterNotRunning {
+		t.Fatalf("expected %v without a master, got %v", errMasterNotRunning, err)
+	}
+
+	master := newFakeMaster(t, dir)
+	defer master.listener.Close()
+
+	for i := 1; i <= 2; i++ {
+		if err := router.reloadMasterWorker(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if router.workerGeneration != i {
+			t.Fatalf("expected worker generation %d, got %d", i, router.workerGeneration)
+		}
+	}
+
+	master.lock.Lock()
+	master.failReload = true
+	master.lock.Unlock()
+	if err := router.reloadMasterWorker(); err == nil {
+		t.Fatalf("expected an error when the master fails to reload")
+	}
+	if router.workerGeneration != 2 {
+		t.Fatalf("expected worker generation to stay at 2, got %d", router.workerGeneration)
+	}
+}
+
+// TestOldWorkersTemplate checks that the limits on the processes of previous
+// reloads are rendered in the global section.
+func TestOldWorkersTemplate(t *testing.T) {
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		MasterWorker: true,
+		OldWorkers:   OldWorkersConfig{HardStopAfter: "1h", MaxReloads: 3},
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	files, err := renderer.Render(renderer.RouteState(nil))
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	for _, file := range files {
+		if file.Name != "conf/haproxy.config" {
+			continue
+		}
+		for _, line := range []string{"  hard-stop-after 1h\n", "  mworker-max-reloads 3\n"} {
+			if !strings.Contains(string(file.Contents), line) {
+				t.Errorf("expected %q in the configuration", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package templaterouter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// overrideSectionPrefix prefixes the names of the sections of the template
+// that template override files may define.  They render nothing unless
+// overridden, and are not files of their own.
+const overrideSectionPrefix = "override/"
+
+// BackendOverride is the data the override/backend section of the template
+// is rendered with.
+type BackendOverride struct {
+	// Name is the name of the backend.
+	Name string
+	// Key is the key of the route of the backend.
+	Key ServiceAliasConfigKey
+	// Config is the configuration of the route of the backend.
+	Config ServiceAliasConfig
+}
+
+// backendOverride returns the data of the override/backend section for the
+// backend of a route.
+func backendOverride(name string, key ServiceAliasConfigKey, cfg ServiceAliasConfig) BackendOverride {
+	return BackendOverride{Name: name, Key: key, Config: cfg}
+}
+
+// applyTemplateOverrides parses the template override files at
+// overridePaths and replaces the sections of master they define.  The files
+// may only define the override sections of master, at most one file may
+// define each section, and they may not have content outside of the
+// sections they define.
+func applyTemplateOverrides(master *template.Template, overridePaths []string) error {
+	definedBy := map[string]string{}
+	for _, path := range overridePaths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read template override %s: %v", path, err)
+		}
+		override, err := template.New(filepath.Base(path)).Funcs(helperFunctions).Parse(string(contents))
+		if err != nil {
+			return fmt.Errorf("unable to parse template override %s: %v", path, err)
+		}
+		if override.Tree != nil && !isBlankTree(override.Tree) {
+			return fmt.Errorf("template override %s has content outside of the sections it defines", path)
+		}
+
+		for _, t := range override.Templates() {
+			name := t.Name()
+			if name == override.Name() {
+				continue
+			}
+			if !strings.HasPrefix(name, overrideSectionPrefix) || master.Lookup(name) == nil {
+				return fmt.Errorf("template override %s defines %q, which is not a section of the template that can be overridden: %s", path, name, strings.Join(overrideSections(master), ", "))
+			}
+			if other, ok := definedBy[name]; ok {
+				return fmt.Errorf("template overrides %s and %s both define %q", other, path, name)
+			}
+			definedBy[name] = path
+			if _, err := master.AddParseTree(name, t.Tree); err != nil {
+				return fmt.Errorf("unable to apply template override %s: %v", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// overrideSections returns the sorted names of the override sections of
+// master.
+func overrideSections(master *template.Template) []string {
+	var names []string
+	for _, t := range master.Templates() {
+		if strings.HasPrefix(t.Name(), overrideSectionPrefix) {
+			names = append(names, t.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isBlankTree returns whether tree renders nothing but white space.
+func isBlankTree(tree *parse.Tree) bool {
+	if tree.Root == nil {
+		return true
+	}
+	for _, node := range tree.Root.Nodes {
+		text, ok := node.(*parse.TextNode)
+		if !ok || len(strings.TrimSpace(string(text.Text))) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package templaterouter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestTemplateOverrides(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("unable to write %s: %v", name, err)
+		}
+		return path
+	}
+	tuning := write("tuning.template", `
+{{/* Tuning of the router. */}}
+{{ define "override/global" }}
+  tune.bufsize 65536
+{{- end }}
+{{ define "override/defaults" }}
+  option http-keep-alive
+{{- end }}
+`)
+	backends := write("backends.template", `{{ define "override/backend" }}
+  # {{ .Name }} serves {{ .Config.Host }}
+{{- end }}`)
+	routes := []*routev1.Route{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: routev1.RouteSpec{
+			Host: "web.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}}
+
+	render := func(overrides ...string) (string, error) {
+		t.Helper()
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath:          "../../../images/router/haproxy/conf/haproxy-config.template",
+			TemplateOverridePaths: overrides,
+			WorkingDir:            "/var/lib/haproxy",
+			BindPorts:             true,
+		})
+		if err != nil {
+			return "", err
+		}
+		files, err := renderer.Render(renderer.RouteState(routes))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		for _, file := range files {
+			if strings.HasPrefix(file.Name, overrideSectionPrefix) {
+				t.Errorf("expected the override sections not to be rendered as files, got %s", file.Name)
+			}
+			if file.Name == "conf/haproxy.config" {
+				return string(file.Contents), nil
+			}
+		}
+		t.Fatalf("conf/haproxy.config not rendered")
+		return "", nil
+	}
+
+	config, err := render(tuning, backends)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	global := config[strings.Index(config, "\nglobal\n"):strings.Index(config, "\ndefaults\n")]
+	if !strings.Contains(global, "\n  tune.bufsize 65536\n") {
+		t.Errorf("expected the global override in:\n%s", global)
+	}
+	if !strings.Contains(config[strings.Index(config, "\ndefaults\n"):], "\n  option http-keep-alive\n") {
+		t.Errorf("expected the defaults override in the defaults section")
+	}
+	if !strings.Contains(config, "backend be_http:ns:web\n") || !strings.Contains(config, "\n  # be_http:ns:web serves web.example.com\n") {
+		t.Errorf("expected the backend override in the backend of the route")
+	}
+
+	// Without overrides, the sections render nothing.
+	if base, err := render(); err != nil || strings.Contains(base, "tune.bufsize 65536") || strings.Contains(base, "serves web.example.com") {
+		t.Errorf("expected no overrides without override files, got error %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		overrides []string
+		expected  string
+	}{
+		{
+			name:      "conflict",
+			overrides: []string{tuning, write("conflict.template", `{{ define "override/global" }}{{ end }}`)},
+			expected:  "both define \"override/global\"",
+		},
+		{
+			name:      "unknown section",
+			overrides: []string{write("unknown.template", `{{ define "override/frontend" }}{{ end }}`)},
+			expected:  "not a section of the template that can be overridden",
+		},
+		{
+			name:      "whole file",
+			overrides: []string{write("file.template", `{{ define "conf/haproxy.config" }}{{ end }}`)},
+			expected:  "not a section of the template that can be overridden",
+		},
+		{
+			name:      "content outside of the sections",
+			overrides: []string{write("outside.template", "global\n  maxconn 1\n")},
+			expected:  "content outside of the sections",
+		},
+		{
+			name:      "missing file",
+			overrides: []string{filepath.Join(dir, "missing.template")},
+			expected:  "unable to read template override",
+		},
+	}
+	for _, tc := range tests {
+		if _, err := render(tc.overrides...); err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", tc.name, tc.expected, err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package templaterouter
 import (
 	"crypto/md5"
 	"fmt"
+	"io"
 	"net"
 	"path/filepath"
 	"strconv"
@@ -17,6 +18,8 @@ import (
 
 	routev1 "github.com/openshift/api/route/v1"
 
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 	unidlingapi "github.com/openshift/router/pkg/router/unidling"
 )
 
@@ -31,6 +34,11 @@ type TemplatePlugin struct {
 	Router         RouterInterface
 	IncludeUDP     bool
 	ServiceFetcher ServiceLookup
+	// PodLabels, if set, looks up the labels of the pods of endpoints.
+	PodLabels PodLabelLookup
+	// TopologyAwareRouting makes the endpoints that do not serve the zone
+	// of the router backup servers.
+	TopologyAwareRouting bool
 }
 
 func newDefaultTemplatePlugin(router RouterInterface, includeUDP bool, lookupSvc ServiceLookup) *TemplatePlugin {
@@ -44,10 +52,14 @@ func newDefaultTemplatePlugin(router RouterInterface, includeUDP bool, lookupSvc
 type TemplatePluginConfig struct {
 	WorkingDir                    string
 	TemplatePath                  string
+	TemplateOverridePaths         []string
 	ReloadScriptPath              string
+	HAProxyBinary                 string
+	InProcessReload               bool
 	ReloadFn                      func(shutdown bool) error
 	ReloadInterval                time.Duration
 	ReloadCallbacks               []func()
+	MasterSocketPath              string
 	DefaultCertificate            string
 	DefaultCertificatePath        string
 	DefaultCertificateDir         string
@@ -56,8 +68,12 @@ type TemplatePluginConfig struct {
 	StatsUsername                 string
 	StatsPassword                 string
 	IncludeUDP                    bool
+	TopologyAwareRouting          bool
 	AllowWildcardRoutes           bool
 	BindPortsAfterSync            bool
+	Standby                       bool
+	ConfigSnippetDirectives       sets.String
+	HTTPCompatOptions             sets.String
 	MaxConnections                string
 	Ciphers                       string
 	StrictSNI                     bool
@@ -66,6 +82,31 @@ type TemplatePluginConfig struct {
 	CaptureHTTPResponseHeaders    []CaptureHTTPHeader
 	CaptureHTTPCookie             *CaptureHTTPCookie
 	HTTPHeaderNameCaseAdjustments []HTTPHeaderNameCaseAdjustment
+	URINormalizers                []string
+	ResponseHeaderPolicy          []routeapihelpers.ResponseHeaderRule
+	TLSSession                    TLSSessionConfig
+	WAF                           WAFConfig
+	ResponseCacheSize             int
+	MaxMapFileEntries             int
+	TransparentProxy              bool
+	HAProxyCapabilities           *HAProxyCapabilities
+	ReloadVerificationTimeout     time.Duration
+	EndpointMetadata              EndpointMetadataConfig
+	ReloadState                   ReloadStateConfig
+	OldWorkers                    OldWorkersConfig
+	StableServerNames             bool
+	RouterTimeouts                routeapihelpers.RouterTimeouts
+	RouteTimeoutPolicy            string
+	Tuning                        TuningConfig
+	AdaptiveHealthChecks          AdaptiveHealthCheckConfig
+	LatencyWeighting              LatencyWeightingConfig
+	LeastRequestWeighting         LeastRequestWeightingConfig
+	CapacityLimits                CapacityLimits
+	SNIHostMismatchPolicy         string
+	CertificateConflictPolicy     string
+	SetForwardedHeaders           string
+	CommitPartitions              int
+	ActivationWindowInterval      time.Duration
 }
 
 // RouterInterface controls the interaction of the plugin with the underlying router implementation
@@ -117,18 +158,23 @@ func createTemplateWithHelper(t *template.Template) (*template.Template, error)
 	return clone.Funcs(funcMap), nil
 }
 
-// NewTemplatePlugin creates a new TemplatePlugin.
-func NewTemplatePlugin(cfg TemplatePluginConfig, lookupSvc ServiceLookup) (*TemplatePlugin, error) {
-	templateBaseName := filepath.Base(cfg.TemplatePath)
-	masterTemplate, err := template.New("config").Funcs(helperFunctions).ParseFiles(cfg.TemplatePath)
+// parseTemplates parses the template file at templatePath with the sections
+// overridden by the files at overridePaths, and returns the templates it
+// defines, mapped to the names of the files they render.
+func parseTemplates(templatePath string, overridePaths []string) (map[string]*template.Template, error) {
+	templateBaseName := filepath.Base(templatePath)
+	masterTemplate, err := template.New("config").Funcs(helperFunctions).ParseFiles(templatePath)
 	if err != nil {
 		return nil, err
 	}
+	if err := applyTemplateOverrides(masterTemplate, overridePaths); err != nil {
+		return nil, err
+	}
 
 	templates := map[string]*template.Template{}
 
 	for _, template := range masterTemplate.Templates() {
-		if template.Name() == templateBaseName {
+		if template.Name() == templateBaseName || strings.HasPrefix(template.Name(), overrideSectionPrefix) || strings.HasPrefix(template.Name(), partialSectionPrefix) {
 			continue
 		}
 		templateWithHelper, err := createTemplateWithHelper(template)
@@ -138,14 +184,26 @@ func NewTemplatePlugin(cfg TemplatePluginConfig, lookupSvc ServiceLookup) (*Temp
 
 		templates[template.Name()] = templateWithHelper
 	}
+	return templates, nil
+}
+
+// NewTemplatePlugin creates a new TemplatePlugin.
+func NewTemplatePlugin(cfg TemplatePluginConfig, lookupSvc ServiceLookup) (*TemplatePlugin, error) {
+	templates, err := parseTemplates(cfg.TemplatePath, cfg.TemplateOverridePaths)
+	if err != nil {
+		return nil, err
+	}
 
 	templateRouterCfg := templateRouterCfg{
 		dir:                           cfg.WorkingDir,
 		templates:                     templates,
 		reloadScriptPath:              cfg.ReloadScriptPath,
+		haproxyBinary:                 cfg.HAProxyBinary,
+		inProcessReload:               cfg.InProcessReload,
 		reloadFn:                      cfg.ReloadFn,
 		reloadInterval:                cfg.ReloadInterval,
 		reloadCallbacks:               cfg.ReloadCallbacks,
+		masterSocketPath:              cfg.MasterSocketPath,
 		defaultCertificate:            cfg.DefaultCertificate,
 		defaultCertificatePath:        cfg.DefaultCertificatePath,
 		defaultCertificateDir:         cfg.DefaultCertificateDir,
@@ -155,21 +213,153 @@ func NewTemplatePlugin(cfg TemplatePluginConfig, lookupSvc ServiceLookup) (*Temp
 		statsPort:                     cfg.StatsPort,
 		allowWildcardRoutes:           cfg.AllowWildcardRoutes,
 		bindPortsAfterSync:            cfg.BindPortsAfterSync,
+		standby:                       cfg.Standby,
+		configSnippetDirectives:       cfg.ConfigSnippetDirectives,
+		httpCompatOptions:             cfg.HTTPCompatOptions,
 		dynamicConfigManager:          cfg.DynamicConfigManager,
 		captureHTTPRequestHeaders:     cfg.CaptureHTTPRequestHeaders,
 		captureHTTPResponseHeaders:    cfg.CaptureHTTPResponseHeaders,
 		captureHTTPCookie:             cfg.CaptureHTTPCookie,
 		httpHeaderNameCaseAdjustments: cfg.HTTPHeaderNameCaseAdjustments,
+		uriNormalizers:                cfg.URINormalizers,
+		responseHeaderPolicy:          cfg.ResponseHeaderPolicy,
+		tlsSession:                    cfg.TLSSession,
+		waf:                           cfg.WAF,
+		responseCacheSize:             cfg.ResponseCacheSize,
+		maxMapFileEntries:             cfg.MaxMapFileEntries,
+		transparentProxy:              cfg.TransparentProxy,
+		haproxyCapabilities:           cfg.HAProxyCapabilities,
+		reloadVerificationTimeout:     cfg.ReloadVerificationTimeout,
+		endpointMetadata:              cfg.EndpointMetadata,
+		reloadState:                   cfg.ReloadState,
+		oldWorkers:                    cfg.OldWorkers,
+		stableServerNames:             cfg.StableServerNames,
+		routerTimeouts:                cfg.RouterTimeouts,
+		clampRouteTimeouts:            cfg.RouteTimeoutPolicy != routeapihelpers.RouteTimeoutPolicyReject,
+		tuning:                        autoTuning(cfg.Tuning),
+		adaptiveHealthChecks:          cfg.AdaptiveHealthChecks,
+		latencyWeighting:              cfg.LatencyWeighting,
+		leastRequestWeighting:         cfg.LeastRequestWeighting,
+		capacityLimits:                cfg.CapacityLimits,
+		sniHostMismatchPolicy:         cfg.SNIHostMismatchPolicy,
+		certificateConflictPolicy:     cfg.CertificateConflictPolicy,
+		setForwardedHeaders:           cfg.SetForwardedHeaders,
+		commitPartitions:              cfg.CommitPartitions,
+		activationWindowInterval:      cfg.ActivationWindowInterval,
 	}
 	router, err := newTemplateRouter(templateRouterCfg)
-	return newDefaultTemplatePlugin(router, cfg.IncludeUDP, lookupSvc), err
+	plugin := newDefaultTemplatePlugin(router, cfg.IncludeUDP, lookupSvc)
+	plugin.TopologyAwareRouting = cfg.TopologyAwareRouting
+	return plugin, err
+}
+
+// Promote instructs a standby router to start accepting traffic.
+func (p *TemplatePlugin) Promote() {
+	p.Router.(*templateRouter).Promote()
+}
+
+// RunTLSTicketKeyRotation starts rotating the TLS session ticket keys of
+// the router until stopCh is closed.
+func (p *TemplatePlugin) RunTLSTicketKeyRotation(stopCh <-chan struct{}) error {
+	return p.Router.(*templateRouter).RunTLSTicketKeyRotation(stopCh)
+}
+
+// RunBackendStabilityTracking starts tracking how long the backends of the
+// router have been healthy until stopCh is closed.
+func (p *TemplatePlugin) RunBackendStabilityTracking(stopCh <-chan struct{}) error {
+	return p.Router.(*templateRouter).RunBackendStabilityTracking(stopCh)
+}
+
+// RunLatencyWeighting starts shifting the weights of the servers of the
+// backends toward their fastest servers until stopCh is closed.
+func (p *TemplatePlugin) RunLatencyWeighting(stopCh <-chan struct{}) error {
+	return p.Router.(*templateRouter).RunLatencyWeighting(stopCh)
+}
+
+// RunLeastRequestWeighting starts shifting the weights of the servers of the
+// routes with least-request weighting toward their least loaded servers.
+func (p *TemplatePlugin) RunLeastRequestWeighting(stopCh <-chan struct{}) error {
+	return p.Router.(*templateRouter).RunLeastRequestWeighting(stopCh)
+}
+
+// RunActivationScheduler starts putting the routes in and out of maintenance
+// as their activation windows open and close until stopCh is closed.
+func (p *TemplatePlugin) RunActivationScheduler(stopCh <-chan struct{}) error {
+	return p.Router.(*templateRouter).RunActivationScheduler(stopCh)
+}
+
+// ReloadHistory returns the most recent reloads of the router and the
+// reasons for them, newest first.
+func (p *TemplatePlugin) ReloadHistory() []ReloadRecord {
+	return p.Router.(*templateRouter).ReloadHistory()
+}
+
+// Freshness returns when the router last committed its state and haproxy
+// last loaded it.
+func (p *TemplatePlugin) Freshness() Freshness {
+	return p.Router.(*templateRouter).Freshness()
+}
+
+// ExplainRoute explains which route and backend the router selects for a
+// request.
+func (p *TemplatePlugin) ExplainRoute(req ExplainRequest) RouteExplanation {
+	return p.Router.(*templateRouter).ExplainRoute(req)
+}
+
+// ExportState returns a versioned JSON snapshot of the routes and services
+// of the router, with the private keys of their certificates redacted.
+func (p *TemplatePlugin) ExportState() ([]byte, error) {
+	return p.Router.(*templateRouter).ExportState()
+}
+
+// WriteSupportBundle writes a gzipped tarball of the configuration files,
+// state snapshot and recent reloads of the router to w, with their secrets
+// redacted.
+func (p *TemplatePlugin) WriteSupportBundle(w io.Writer, options SupportBundleOptions) error {
+	return p.Router.(*templateRouter).WriteSupportBundle(w, options)
+}
+
+// ImportState replaces the routes and services of the router with a
+// snapshot written by ExportState and commits them.
+func (p *TemplatePlugin) ImportState(data []byte) error {
+	if err := p.Router.(*templateRouter).ImportState(data); err != nil {
+		return err
+	}
+	p.Router.Commit()
+	return nil
+}
+
+// Rerender writes the certificates of the matching routes again and
+// reloads the router with a newly rendered configuration.  It returns the
+// number of matching routes.
+func (p *TemplatePlugin) Rerender(namespace, name string) int {
+	count := p.Router.(*templateRouter).Rerender(namespace, name)
+	// The initial sync renders every route anyway.
+	if p.Router.SyncedAtLeastOnce() {
+		p.Router.Commit()
+	}
+	return count
+}
+
+// InternRoute replaces the values a route shares with other routes with the
+// copies held by the router, so that routes decoded from the API do not keep
+// their own copy of them.
+func (p *TemplatePlugin) InternRoute(route *routev1.Route) {
+	p.Router.(*templateRouter).InternRoute(route)
+}
+
+// StopRouteUpdates instructs the router plugin to stop invoking the reload method, and waits until
+// no further reloads will occur, so that route changes are no longer applied.
+func (p *TemplatePlugin) StopRouteUpdates() error {
+	p.Router.(*templateRouter).rateLimitedCommitFunction.Stop()
+	return nil
 }
 
 // Stop instructs the router plugin to stop invoking the reload method, and waits until no further
 // reloads will occur. It then invokes the reload script one final time with the ROUTER_SHUTDOWN
 // environment variable set with true.
 func (p *TemplatePlugin) Stop() error {
-	p.Router.(*templateRouter).rateLimitedCommitFunction.Stop()
+	p.StopRouteUpdates()
 	return p.Router.(*templateRouter).reloadRouter(true)
 }
 
@@ -191,6 +381,12 @@ func (p *TemplatePlugin) HandleEndpoints(eventType watch.EventType, endpoints *k
 	case watch.Added, watch.Modified:
 		log.V(4).Info("modifying endpoints", "key", key)
 		routerEndpoints := createRouterEndpoints(endpoints, !p.IncludeUDP, p.ServiceFetcher)
+		if p.PodLabels != nil {
+			addEndpointLabels(endpoints.Namespace, routerEndpoints, p.PodLabels)
+		}
+		if p.TopologyAwareRouting {
+			markOtherZoneEndpoints(endpoints, routerEndpoints)
+		}
 		key := endpointsKey(endpoints)
 		p.Router.AddEndpoints(key, routerEndpoints)
 	case watch.Deleted:
@@ -227,6 +423,9 @@ func (p *TemplatePlugin) HandleRoute(eventType watch.EventType, route *routev1.R
 // the provided namespace list.
 func (p *TemplatePlugin) HandleNamespaces(namespaces sets.String) error {
 	p.Router.FilterNamespaces(namespaces)
+	if p.PodLabels != nil {
+		p.PodLabels.SetNamespaces(namespaces)
+	}
 	return nil
 }
 
@@ -314,6 +513,7 @@ func createRouterEndpoints(endpoints *kapi.Endpoints, excludeUDP bool, lookupSvc
 	}
 
 	out := make([]Endpoint, 0, len(endpoints.Subsets)*4)
+	zones := endpointsubset.ParseZones(endpoints.Annotations[endpointsubset.ZonesAnnotation])
 	// For checking if the endpoints ID is duplicated.
 	duplicated := map[string]bool{}
 
@@ -335,6 +535,14 @@ func createRouterEndpoints(endpoints *kapi.Endpoints, excludeUDP bool, lookupSvc
 				continue
 			}
 			for _, a := range s.Addresses {
+				// EndpointSlices of the FQDN address type list host
+				// names, which haproxy would have to resolve when it
+				// loads its configuration and fail to start if it
+				// cannot.
+				if net.ParseIP(a.IP) == nil {
+					log.V(4).Info("skipping an endpoint that is not an IP address", "namespace", endpoints.Namespace, "name", endpoints.Name, "address", a.IP)
+					continue
+				}
 				ep := Endpoint{
 					IP:   formatIPAddr(a.IP),
 					Port: strconv.Itoa(int(p.Port)),
@@ -350,16 +558,23 @@ func createRouterEndpoints(endpoints *kapi.Endpoints, excludeUDP bool, lookupSvc
 						ep.ID = fmt.Sprintf("pod:%s:%s:%s:%s:%d", ep.TargetName, endpoints.Name, p.Name, a.IP, p.Port)
 					} else {
 						ep.ID = fmt.Sprintf("ept:%s:%s:%s:%d", endpoints.Name, p.Name, a.IP, p.Port)
+						ep.External = !wasIdled
 					}
 				} else {
 					ep.TargetName = a.IP
 					ep.ID = fmt.Sprintf("ept:%s:%s:%s:%d", endpoints.Name, p.Name, a.IP, p.Port)
+					ep.External = !wasIdled
 				}
 
 				if p.AppProtocol != nil {
 					ep.AppProtocol = *p.AppProtocol
 				}
 
+				if a.NodeName != nil {
+					ep.NodeName = *a.NodeName
+				}
+				ep.Zone = zones[a.IP]
+
 				// IdHash contains an obfuscated internal IP address
 				// that is the value passed in the cookie. The IP address
 				// is made more difficult to extract by including other
@@ -381,6 +596,16 @@ func createRouterEndpoints(endpoints *kapi.Endpoints, excludeUDP bool, lookupSvc
 	return out
 }
 
+// markOtherZoneEndpoints makes the endpoints the controller annotated as not
+// serving the zone of the router backup servers, so that they only receive
+// traffic when the endpoints of the zone are down.
+func markOtherZoneEndpoints(endpoints *kapi.Endpoints, routerEndpoints []Endpoint) {
+	otherZones := endpointsubset.ParseOtherZoneAddresses(endpoints.Annotations[endpointsubset.OtherZonesAnnotation])
+	for i := range routerEndpoints {
+		routerEndpoints[i].Backup = otherZones[strings.Trim(routerEndpoints[i].IP, "[]")]
+	}
+}
+
 func isServiceIPSet(service *kapi.Service) bool {
 	return service.Spec.ClusterIP != kapi.ClusterIPNone && service.Spec.ClusterIP != ""
 }
@@ -1,19 +1,20 @@
 package templaterouter
 
 import (
-	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	kapi "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/watch"
 
 	routev1 "github.com/openshift/api/route/v1"
 	"github.com/openshift/router/pkg/router/controller"
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
+	routertesting "github.com/openshift/router/pkg/router/testing"
 )
 
 const (
@@ -181,7 +182,7 @@ func (r *TestRouter) calculateServiceWeights(serviceUnits map[ServiceUnitKey]int
 
 // AddRoute adds a ServiceAliasConfig and associated ServiceUnits for the route
 func (r *TestRouter) AddRoute(route *routev1.Route) {
-	routeKey := getKey(route)
+	routeKey := routeKey(route)
 
 	config := ServiceAliasConfig{
 		Host:         route.Spec.Host,
@@ -199,7 +200,7 @@ func (r *TestRouter) AddRoute(route *routev1.Route) {
 
 // RemoveRoute removes the service alias config for Route
 func (r *TestRouter) RemoveRoute(route *routev1.Route) {
-	routeKey := getKey(route)
+	routeKey := routeKey(route)
 	_, ok := r.State[routeKey]
 	if !ok {
 		return
@@ -242,11 +243,6 @@ func (r *TestRouter) FilterNamespaces(namespaces sets.String) {
 	}
 }
 
-// getKey create an identifier for the route consisting of host-path
-func getKey(route *routev1.Route) ServiceAliasConfigKey {
-	return routeKeyFromParts(route.Spec.Host, route.Spec.Path)
-}
-
 func (r *TestRouter) Commit() {
 	// No op
 }
@@ -477,193 +473,33 @@ func (r *fakeRejections) RecordRouteRejection(route *routev1.Route, reason, mess
 	r.rejections = append(r.rejections, rejection{route: route, reason: reason, message: message})
 }
 
-// TestHandleRoute test route watch events
-func TestHandleRoute(t *testing.T) {
-	rejections := &fakeRejections{}
-	router := newTestRouter(make(map[ServiceAliasConfigKey]ServiceAliasConfig))
-	templatePlugin := newDefaultTemplatePlugin(router, true, nil)
-	// TODO: move tests that rely on unique hosts to pkg/router/controller and remove them from
-	// here
-	plugin := controller.NewUniqueHost(templatePlugin, false, rejections)
-
-	uidCount := 0
-	nextUID := func() types.UID {
-		uidCount++
-		return types.UID(fmt.Sprintf("%03d", uidCount))
+// observe returns the routes and service units of the router.
+func (r *TestRouter) observe() routertesting.State {
+	state := routertesting.State{Routes: map[string]string{}}
+	for key, cfg := range r.State {
+		namespace, name := getPartsFromRouteKey(key)
+		state.Routes[namespace+"/"+name] = cfg.Host + cfg.Path
 	}
-	original := metav1.Time{Time: time.Now()}
-
-	//add
-	fooTest1 := &routev1.Route{
-		ObjectMeta: metav1.ObjectMeta{
-			CreationTimestamp: original,
-			Namespace:         "foo",
-			Name:              "test",
-			UID:               nextUID(),
-		},
-		Spec: routev1.RouteSpec{
-			Host: "www.example.com",
-			To: routev1.RouteTargetReference{
-				Name:   "TestService",
-				Weight: new(int32),
-			},
-		},
+	for key := range r.ServiceUnits {
+		state.ServiceUnits = append(state.ServiceUnits, string(key))
 	}
-	serviceUnitKey := endpointsKeyFromParts(fooTest1.Namespace, fooTest1.Spec.To.Name)
-
-	plugin.HandleRoute(watch.Added, fooTest1)
-
-	_, ok := router.FindServiceUnit(serviceUnitKey)
-
-	if !ok {
-		t.Errorf("TestHandleRoute was unable to find the service unit %s after HandleRoute was called", fooTest1.Spec.To.Name)
-	} else {
-		serviceAliasCfg, ok := router.State[getKey(fooTest1)]
-
-		if !ok {
-			t.Errorf("TestHandleRoute expected route key %s", getKey(fooTest1))
-		} else {
-			if serviceAliasCfg.Host != fooTest1.Spec.Host || serviceAliasCfg.Path != fooTest1.Spec.Path {
-				t.Errorf("Expected route did not match service alias config %v : %v", fooTest1, serviceAliasCfg)
-			}
-		}
-	}
-
-	if len(rejections.rejections) > 0 {
-		t.Fatalf("did not expect a recorded rejection: %#v", rejections)
-	}
-
-	// attempt to add a second route with a newer time, verify it is ignored
-	fooDupe2 := &routev1.Route{
-		ObjectMeta: metav1.ObjectMeta{
-			CreationTimestamp: metav1.Time{Time: original.Add(time.Hour)},
-			Namespace:         "foo",
-			Name:              "dupe",
-			UID:               nextUID(),
-		},
-		Spec: routev1.RouteSpec{
-			Host: "www.example.com",
-			To: routev1.RouteTargetReference{
-				Name:   "TestService2",
-				Weight: new(int32),
-			},
-		},
-	}
-	if err := plugin.HandleRoute(watch.Added, fooDupe2); err != nil {
-		t.Fatal("unexpected error")
-	}
-
-	if _, ok := router.FindServiceUnit(endpointsKeyFromParts("foo", "TestService2")); ok {
-		t.Fatalf("unexpected second unit: %#v", router)
-	}
-	if r, ok := plugin.RoutesForHost("www.example.com"); !ok || r[0].Name != "test" {
-		t.Fatalf("unexpected claimed routes: %#v", r)
-	}
-	if len(rejections.rejections) != 1 ||
-		rejections.rejections[0].route.Name != "dupe" ||
-		rejections.rejections[0].reason != "HostAlreadyClaimed" ||
-		rejections.rejections[0].message != "route test already exposes www.example.com and is older" {
-		t.Fatalf("did not record rejection: %#v", rejections)
-	}
-	rejections.rejections = nil
-
-	// attempt to remove the second route that is not being used, verify it is ignored
-	if err := plugin.HandleRoute(watch.Deleted, fooDupe2); err != nil {
-		t.Fatal("unexpected error")
-	}
-
-	if _, ok := router.FindServiceUnit(endpointsKeyFromParts("foo", "TestService2")); ok {
-		t.Fatalf("unexpected second unit: %#v", router)
-	}
-	if _, ok := router.FindServiceUnit(endpointsKeyFromParts("foo", "TestService")); !ok {
-		t.Fatalf("unexpected first unit: %#v", router)
-	}
-	if r, ok := plugin.RoutesForHost("www.example.com"); !ok || r[0].Name != "test" {
-		t.Fatalf("unexpected claimed routes: %#v", r)
-	}
-	if len(rejections.rejections) != 0 {
-		t.Fatalf("did not record rejection: %#v", rejections)
-	}
-	rejections.rejections = nil
-
-	// add a third route with an older time, verify it takes effect
-	copied := *fooDupe2
-	fooDupe3 := &copied
-	fooDupe3.UID = nextUID()
-	fooDupe3.CreationTimestamp = metav1.Time{Time: original.Add(-time.Hour)}
-	if err := plugin.HandleRoute(watch.Added, fooDupe3); err != nil {
-		t.Fatal("unexpected error")
-	}
-	_, ok = router.FindServiceUnit(endpointsKeyFromParts("foo", "TestService2"))
-	if !ok {
-		t.Fatalf("missing second unit: %#v", router)
-	}
-	if len(rejections.rejections) != 1 ||
-		rejections.rejections[0].route.Name != "test" ||
-		rejections.rejections[0].reason != "HostAlreadyClaimed" ||
-		rejections.rejections[0].message != "replaced by older route dupe" {
-		t.Fatalf("did not record rejection: %#v", rejections)
-	}
-	rejections.rejections = nil
-
-	//mod
-	copied2 := *fooTest1
-	fooTest1NewHost := &copied2
-	fooTest1NewHost.Spec.Host = "www.example2.com"
-	if err := plugin.HandleRoute(watch.Modified, fooTest1NewHost); err != nil {
-		t.Fatal("unexpected error")
-	}
-
-	key := getKey(fooTest1NewHost)
-	_, ok = router.FindServiceUnit(serviceUnitKey)
-	if !ok {
-		t.Errorf("TestHandleRoute was unable to find the service unit %s after HandleRoute was called", fooTest1NewHost.Spec.To.Name)
-	} else {
-		serviceAliasCfg, ok := router.State[key]
-		if !ok {
-			t.Errorf("TestHandleRoute expected route key %s", key)
-		} else {
-			if serviceAliasCfg.Host != fooTest1NewHost.Spec.Host || serviceAliasCfg.Path != fooTest1NewHost.Spec.Path {
-				t.Errorf("Expected route did not match service alias config %v : %v", fooTest1NewHost, serviceAliasCfg)
-			}
-		}
-	}
-	if plugin.HostLen() != 2 {
-		t.Fatalf("did not clear claimed route: %#v", plugin)
-	}
-	if len(rejections.rejections) != 0 {
-		t.Fatalf("unexpected rejection: %#v", rejections)
-	}
-
-	plugin.HandleRoute(watch.Deleted, fooDupe3)
-
-	if plugin.HostLen() != 1 {
-		t.Fatalf("did not clear claimed route: %#v", plugin)
-	}
-	if len(rejections.rejections) != 0 {
-		t.Fatalf("unexpected rejection: %#v", rejections)
-	}
-
-	//delete
-	if err := plugin.HandleRoute(watch.Deleted, fooTest1NewHost); err != nil {
-		t.Fatal("unexpected error")
-	}
-	_, ok = router.FindServiceUnit(serviceUnitKey)
-	if !ok {
-		t.Errorf("TestHandleRoute was unable to find the service unit %s after HandleRoute was called", fooTest1NewHost.Spec.To.Name)
-	} else {
-
-		_, ok := router.State[key]
+	return state
+}
 
-		if ok {
-			t.Errorf("TestHandleRoute did not expect route key %s", key)
-		}
-	}
-	if plugin.HostLen() != 0 {
-		t.Errorf("did not clear claimed route: %#v", plugin)
-	}
-	if len(rejections.rejections) != 0 {
-		t.Fatalf("unexpected rejection: %#v", rejections)
+// TestHandleRoute test route watch events
+func TestHandleRoute(t *testing.T) {
+	scenarios, err := routertesting.LoadScenarios("../testing/testdata/unique_host.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scenario := range scenarios {
+		rejections := routertesting.NewRejectionRecorder()
+		router := newTestRouter(make(map[ServiceAliasConfigKey]ServiceAliasConfig))
+		templatePlugin := newDefaultTemplatePlugin(router, true, nil)
+		// TODO: move tests that rely on unique hosts to pkg/router/controller and remove them from
+		// here
+		plugin := controller.NewUniqueHost(templatePlugin, false, rejections)
+		routertesting.RunScenario(t, scenario, routertesting.Harness{Plugin: plugin, Rejections: rejections, Observe: router.observe})
 	}
 }
 
@@ -1088,3 +924,63 @@ func TestNamespaceScopingFromEmpty(t *testing.T) {
 		t.Errorf("unexpected router state %#v", router)
 	}
 }
+
+// TestTopologyAwareRoutingTemplate checks that the endpoints that do not
+// serve the zone of the router are rendered as backup servers.
+func TestTopologyAwareRoutingTemplate(t *testing.T) {
+	routes := []*routev1.Route{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: routev1.RouteSpec{
+			Host: "web.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}}
+	endpoints := &kapi.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        "svc",
+			Annotations: map[string]string{endpointsubset.OtherZonesAnnotation: "10.128.0.6"},
+		},
+		Subsets: []kapi.EndpointSubset{{
+			Addresses: []kapi.EndpointAddress{{IP: "10.128.0.5"}, {IP: "10.128.0.6"}},
+			Ports:     []kapi.EndpointPort{{Port: 8080, Protocol: kapi.ProtocolTCP}},
+		}},
+	}
+
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	state := renderer.RouteState(routes)
+	renderer.AddEndpoints(state, endpoints, true, nil)
+	for id, serviceUnit := range state.ServiceUnits {
+		markOtherZoneEndpoints(endpoints, serviceUnit.EndpointTable)
+		state.ServiceUnits[id] = serviceUnit
+	}
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	servers := 0
+	for _, file := range files {
+		if file.Name != "conf/haproxy.config" {
+			continue
+		}
+		for _, line := range strings.Split(string(file.Contents), "\n") {
+			if !strings.HasPrefix(line, "  server ") {
+				continue
+			}
+			servers++
+			if backup := strings.Contains(line, " backup"); backup != strings.Contains(line, "10.128.0.6:") {
+				t.Errorf("expected only the server of the other zone to be a backup, got %q", line)
+			}
+		}
+	}
+	if servers == 0 {
+		t.Errorf("expected the servers of the endpoints in the configuration")
+	}
+}
@@ -0,0 +1,186 @@
+package templaterouter
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	kcoreclient "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// PodLabelLookup is an interface for fetching the labels of the pods of
+// endpoints.
+type PodLabelLookup interface {
+	LookupPodLabels(namespace, name string) map[string]string
+	// SetNamespaces limits the pods looked up to those of namespaces.
+	SetNamespaces(namespaces sets.String)
+	// OnLabelsChanged sets the function called with the namespace of a pod
+	// whose labels changed.
+	OnLabelsChanged(changed func(namespace string))
+}
+
+// NewListWatchPodLabelLookup returns a PodLabelLookup that watches the pods
+// of namespace, or of all namespaces if empty, until SetNamespaces limits it
+// to the namespaces the router serves.  It only keeps the given labels of
+// each pod, so that its memory use does not grow with the size of the pods.
+func NewListWatchPodLabelLookup(podGetter kcoreclient.PodsGetter, resync time.Duration, namespace string, labels []string) PodLabelLookup {
+	l := &podLabelLookup{
+		podGetter: podGetter,
+		resync:    resync,
+		labels:    labels,
+		stores:    make(map[string]*podLabelStore),
+	}
+	l.SetNamespaces(sets.NewString(namespace))
+	return l
+}
+
+// podLabelLookup watches the pods of each namespace the router serves with
+// a store of its own.
+type podLabelLookup struct {
+	podGetter kcoreclient.PodsGetter
+	resync    time.Duration
+	labels    []string
+
+	// lock protects changed and stores.
+	lock    sync.Mutex
+	changed func(namespace string)
+	// stores are the pods of each watched namespace, under
+	// metav1.NamespaceAll if the pods of all namespaces are watched.
+	stores map[string]*podLabelStore
+}
+
+func (l *podLabelLookup) LookupPodLabels(namespace, name string) map[string]string {
+	l.lock.Lock()
+	store, ok := l.stores[namespace]
+	if !ok {
+		store, ok = l.stores[metav1.NamespaceAll]
+	}
+	l.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	return store.lookup(namespace, name)
+}
+
+// SetNamespaces starts watching the pods of the namespaces that are not
+// watched yet and stops watching the pods of the other namespaces.
+func (l *podLabelLookup) SetNamespaces(namespaces sets.String) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for namespace, store := range l.stores {
+		if !namespaces.Has(namespace) {
+			close(store.stopCh)
+			delete(l.stores, namespace)
+		}
+	}
+	for namespace := range namespaces {
+		if _, ok := l.stores[namespace]; ok {
+			continue
+		}
+		store := &podLabelStore{Store: cache.NewStore(cache.MetaNamespaceKeyFunc), labels: l.labels, changed: l.notify, stopCh: make(chan struct{})}
+		namespace := namespace
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return l.podGetter.Pods(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return l.podGetter.Pods(namespace).Watch(context.TODO(), options)
+			},
+		}
+		go cache.NewReflector(lw, &api.Pod{}, store, l.resync).Run(store.stopCh)
+		l.stores[namespace] = store
+	}
+}
+
+func (l *podLabelLookup) OnLabelsChanged(changed func(namespace string)) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.changed = changed
+}
+
+// notify calls the changed function, if set, for namespace.
+func (l *podLabelLookup) notify(namespace string) {
+	l.lock.Lock()
+	changed := l.changed
+	l.lock.Unlock()
+	if changed != nil {
+		changed(namespace)
+	}
+}
+
+// podLabelStore is a store of pods that only keeps their name and the
+// allowed labels.
+type podLabelStore struct {
+	cache.Store
+	labels []string
+	// changed is called with the namespace of a pod whose labels changed
+	// once the store holds its new labels.
+	changed func(namespace string)
+	// stopCh stops the reflector that fills the store.
+	stopCh chan struct{}
+}
+
+// strip returns a pod with only the name and the allowed labels of obj.
+func (s *podLabelStore) strip(obj interface{}) interface{} {
+	pod, ok := obj.(*api.Pod)
+	if !ok {
+		return obj
+	}
+	stripped := &api.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+	for _, label := range s.labels {
+		if value, ok := pod.Labels[label]; ok {
+			if stripped.Labels == nil {
+				stripped.Labels = map[string]string{}
+			}
+			stripped.Labels[label] = value
+		}
+	}
+	return stripped
+}
+
+func (s *podLabelStore) Add(obj interface{}) error {
+	return s.Update(obj)
+}
+
+// Update stores the pod and reports its namespace if its labels changed,
+// so that the endpoints of the pod pick them up.
+func (s *podLabelStore) Update(obj interface{}) error {
+	stripped := s.strip(obj)
+	pod, ok := stripped.(*api.Pod)
+	if !ok {
+		return s.Store.Update(stripped)
+	}
+	previous := s.lookup(pod.Namespace, pod.Name)
+	if err := s.Store.Update(stripped); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(previous, pod.Labels) && s.changed != nil {
+		s.changed(pod.Namespace)
+	}
+	return nil
+}
+
+func (s *podLabelStore) Replace(list []interface{}, resourceVersion string) error {
+	stripped := make([]interface{}, 0, len(list))
+	for _, obj := range list {
+		stripped = append(stripped, s.strip(obj))
+	}
+	return s.Store.Replace(stripped, resourceVersion)
+}
+
+// lookup returns the labels of the named pod.
+func (s *podLabelStore) lookup(namespace, name string) map[string]string {
+	obj, ok, err := s.Store.GetByKey(namespace + "/" + name)
+	if err != nil || !ok {
+		return nil
+	}
+	return obj.(*api.Pod).Labels
+}
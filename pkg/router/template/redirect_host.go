@@ -0,0 +1,66 @@
+package templaterouter
+
+import (
+	"strings"
+)
+
+// findRedirectHostLoops sets RedirectHostLoop on the routes of state whose
+// requests their canonical host redirects, through the canonical hosts of
+// other routes, back to them.  Only the routes that redirect their secure
+// requests can be on a loop, as the redirects are to https.  The requests
+// redirected to a host are served by the route of that host with the
+// longest path that prefixes theirs, since the redirects keep the path.
+func findRedirectHostLoops(state map[ServiceAliasConfigKey]ServiceAliasConfig) {
+	routesByHost := map[string][]ServiceAliasConfigKey{}
+	for key, cfg := range state {
+		if len(cfg.Host) > 0 && !cfg.IsWildcard {
+			host := strings.ToLower(cfg.Host)
+			routesByHost[host] = append(routesByHost[host], key)
+		}
+	}
+	routeOf := func(host, path string) (ServiceAliasConfigKey, bool) {
+		var match ServiceAliasConfigKey
+		found := false
+		for _, key := range routesByHost[host] {
+			cfg := state[key]
+			if !strings.HasPrefix(path, cfg.Path) {
+				continue
+			}
+			if !found || len(cfg.Path) > len(state[match].Path) {
+				match, found = key, true
+			}
+		}
+		return match, found
+	}
+
+	for key, cfg := range state {
+		loop := false
+		if cfg.RedirectHost.All {
+			path := cfg.Path
+			if len(path) == 0 {
+				path = "/"
+			}
+			visited := map[ServiceAliasConfigKey]bool{}
+			for next := key; !visited[next]; {
+				visited[next] = true
+				redirect := state[next].RedirectHost
+				if !redirect.All {
+					break
+				}
+				var ok bool
+				if next, ok = routeOf(redirect.Hostname(), path); !ok {
+					break
+				}
+				if next == key {
+					loop = true
+					break
+				}
+			}
+		}
+		if loop && !cfg.RedirectHostLoop {
+			log.V(0).Info("ignoring the redirect host of a route that redirects requests back to it", "namespace", cfg.Namespace, "name", cfg.Name, "host", cfg.RedirectHost.Host)
+		}
+		cfg.RedirectHostLoop = loop
+		state[key] = cfg
+	}
+}
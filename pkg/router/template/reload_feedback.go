@@ -0,0 +1,261 @@
+package templaterouter
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/reasons"
+)
+
+// RejectionRecorder is an object capable of recording why a route was rejected
+type RejectionRecorder interface {
+	RecordRouteRejection(route *routev1.Route, reason, message string)
+}
+
+// pendingRouteChange is a route change that has not been loaded by a
+// successful reload yet.
+type pendingRouteChange struct {
+	route *routev1.Route
+	// previous is the config of the route before the change, or nil if the
+	// route was added.
+	previous *ServiceAliasConfig
+	// checkErr is the error reported when checking a configuration that
+	// includes the change.
+	checkErr error
+}
+
+// rejectedRoute is a route that was removed from the router state because
+// it prevented the router from reloading.
+type rejectedRoute struct {
+	config  ServiceAliasConfig
+	message string
+}
+
+// SetRejectionRecorder configures the plugin to report routes that prevent
+// the router from reloading to recorder.
+func (p *TemplatePlugin) SetRejectionRecorder(recorder RejectionRecorder) {
+	if r, ok := p.Router.(*templateRouter); ok {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.rejectionRecorder = recorder
+	}
+}
+
+// recordPendingChange remembers that the route with the given key changed
+// since the last successful reload, along with the config it had before.
+// Must be called while holding r.lock
+func (r *templateRouter) recordPendingChange(backendKey ServiceAliasConfigKey, route *routev1.Route, previous *ServiceAliasConfig) {
+	if r.pendingChanges == nil {
+		r.pendingChanges = make(map[ServiceAliasConfigKey]pendingRouteChange)
+	}
+	change, exists := r.pendingChanges[backendKey]
+	if !exists {
+		change.previous = previous
+	}
+	change.route = route
+	r.pendingChanges[backendKey] = change
+}
+
+// takePendingChanges returns the pending changes that are about to be
+// committed and starts tracking new ones.
+// Must be called while holding r.lock
+func (r *templateRouter) takePendingChanges() map[ServiceAliasConfigKey]pendingRouteChange {
+	changes := r.pendingChanges
+	r.pendingChanges = nil
+	return changes
+}
+
+// restorePendingChanges puts back changes that were not loaded because the
+// reload failed. Changes made in the meantime keep the config the route had
+// before the failed commit.
+func (r *templateRouter) restorePendingChanges(changes map[ServiceAliasConfigKey]pendingRouteChange) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for k, change := range changes {
+		if _, ok := r.state[k]; !ok {
+			// the route was removed in the meantime.
+			continue
+		}
+		if current, ok := r.pendingChanges[k]; ok {
+			current.previous = change.previous
+			r.pendingChanges[k] = current
+			continue
+		}
+		r.recordPendingChange(k, change.route, change.previous)
+	}
+}
+
+// isRejected returns true if the route was rejected because it prevented the
+// router from reloading and the route has not changed since, along with the
+// recorder to report the rejection to again. A route that changed is given
+// another chance.
+func (r *templateRouter) isRejected(backendKey ServiceAliasConfigKey, config *ServiceAliasConfig) (bool, string, RejectionRecorder) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	rejected, ok := r.rejectedRoutes[backendKey]
+	if !ok {
+		return false, "", nil
+	}
+	if configsAreEqual(config, &rejected.config) {
+		return true, rejected.message, r.rejectionRecorder
+	}
+	delete(r.rejectedRoutes, backendKey)
+	return false, "", nil
+}
+
+// rejectBrokenRoutes is called after a failed reload. It bisects the route
+// changes since the last successful reload that are not held back to find
+// the ones that make the configuration invalid, removes them from the router
+// state and records them as rejected. Returns true if routes were rejected and the remaining
+// state should be committed again.
+func (r *templateRouter) rejectBrokenRoutes() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keys := r.candidateChanges()
+	if r.rejectionRecorder == nil || len(keys) == 0 {
+		return false
+	}
+
+	broken, err := r.findBrokenChanges(keys)
+	if writeErr := r.writeConfig(); writeErr != nil {
+		log.Error(writeErr, "unable to restore the router configuration after checking route changes")
+		return false
+	}
+	if err != nil {
+		log.V(0).Info("unable to find the routes that prevent the router from reloading", "error", err.Error())
+		return false
+	}
+	if len(broken) == 0 {
+		log.V(0).Info("router failed to reload but none of the changed routes are invalid")
+		return false
+	}
+
+	for _, k := range broken {
+		change := r.pendingChanges[k]
+		config := r.state[k]
+		message := fmt.Sprintf("route prevents the router from reloading: %v", change.checkErr)
+		log.V(0).Info("rejecting route that prevents the router from reloading", "namespace", change.route.Namespace, "name", change.route.Name, "error", change.checkErr.Error())
+
+		delete(r.pendingChanges, k)
+		r.removeRouteInternal(change.route)
+		r.recordReloadReason(ReloadReasonBrokenRoutes, reloadObjectRoute(change.route))
+		if r.rejectedRoutes == nil {
+			r.rejectedRoutes = make(map[ServiceAliasConfigKey]rejectedRoute)
+		}
+		r.rejectedRoutes[k] = rejectedRoute{config: config, message: message}
+		r.rejectionRecorder.RecordRouteRejection(change.route, reasons.InvalidConfiguration, message)
+	}
+	return true
+}
+
+// findBrokenChanges returns the pending changes in keys that result in an
+// invalid configuration. Returns an error if the configuration is invalid
+// even without any of the changes.
+// Must be called while holding r.lock
+func (r *templateRouter) findBrokenChanges(keys []ServiceAliasConfigKey) ([]ServiceAliasConfigKey, error) {
+	if err := r.checkState(r.stateWithChanges(nil)); err != nil {
+		return nil, fmt.Errorf("configuration without the changed routes is invalid: %v", err)
+	}
+	return r.bisectChanges(nil, keys), nil
+}
+
+// bisectChanges returns the changes in candidates that result in an invalid
+// configuration when added to the changes in applied, which must be valid
+// on their own.
+// Must be called while holding r.lock
+func (r *templateRouter) bisectChanges(applied, candidates []ServiceAliasConfigKey) []ServiceAliasConfigKey {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	all := append(append([]ServiceAliasConfigKey{}, applied...), candidates...)
+	err := r.checkState(r.stateWithChanges(all))
+	if err == nil {
+		return nil
+	}
+	if len(candidates) == 1 {
+		change := r.pendingChanges[candidates[0]]
+		change.checkErr = err
+		r.pendingChanges[candidates[0]] = change
+		return candidates
+	}
+
+	mid := len(candidates) / 2
+	broken := r.bisectChanges(applied, candidates[:mid])
+
+	valid := append([]ServiceAliasConfigKey{}, applied...)
+	for _, k := range candidates[:mid] {
+		if !containsKey(broken, k) {
+			valid = append(valid, k)
+		}
+	}
+	return append(broken, r.bisectChanges(valid, candidates[mid:])...)
+}
+
+// stateWithChanges returns a copy of the router state in which only the
+// given pending changes are applied and all other pending changes are
+// reverted.
+// Must be called while holding r.lock
+func (r *templateRouter) stateWithChanges(applied []ServiceAliasConfigKey) map[ServiceAliasConfigKey]ServiceAliasConfig {
+	state := make(map[ServiceAliasConfigKey]ServiceAliasConfig, len(r.state))
+	for k, cfg := range r.state {
+		state[k] = cfg
+	}
+	for k, change := range r.pendingChanges {
+		if containsKey(applied, k) {
+			continue
+		}
+		if change.previous == nil {
+			delete(state, k)
+		} else {
+			state[k] = *change.previous
+		}
+	}
+	return state
+}
+
+// checkState writes the configuration for the given state and checks it
+// without reloading the router.
+// Must be called while holding r.lock
+func (r *templateRouter) checkState(state map[ServiceAliasConfigKey]ServiceAliasConfig) error {
+	current := r.state
+	r.state = state
+	defer func() { r.state = current }()
+
+	if err := r.writeConfig(); err != nil {
+		return err
+	}
+	return r.checkConfig()
+}
+
+// checkConfig validates the configuration written to disk by running the
+// reload script in check mode, or haproxy itself when reloading in process.
+func (r *templateRouter) checkConfig() error {
+	if r.checkConfigFn != nil {
+		return r.checkConfigFn()
+	}
+	if r.reloader != nil {
+		return r.reloader.checkConfig()
+	}
+	cmd := exec.Command(r.reloadScriptPath)
+	cmd.Env = append(os.Environ(), "ROUTER_CHECK_CONFIG=true")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, string(out))
+	}
+	return nil
+}
+
+func containsKey(keys []ServiceAliasConfigKey, key ServiceAliasConfigKey) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
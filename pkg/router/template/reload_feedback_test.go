@@ -0,0 +1,138 @@
+package templaterouter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	routev1 "github.com/openshift/api/route/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const brokenAnnotation = "test/broken"
+
+type fakeRejectionRecorder struct {
+	rejections map[string]string
+}
+
+func (r *fakeRejectionRecorder) RecordRouteRejection(route *routev1.Route, reason, message string) {
+	r.rejections[route.Namespace+"/"+route.Name] = reason
+}
+
+func makeFeedbackRoute(name string, broken bool) *routev1.Route {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "foo",
+			Name:        name,
+			Annotations: map[string]string{},
+		},
+		Spec: routev1.RouteSpec{
+			Host: name + ".example.test",
+			To:   routev1.RouteTargetReference{Name: "TestService"},
+		},
+	}
+	if broken {
+		route.Annotations[brokenAnnotation] = "true"
+	}
+	return route
+}
+
+// TestRejectBrokenRoutes tests that routes which prevent the router from
+// reloading are found, rejected and left out of the next commit.
+func TestRejectBrokenRoutes(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	router.metricReload = prometheus.NewSummary(prometheus.SummaryOpts{Name: "reload"})
+	router.metricReloadFailure = prometheus.NewGauge(prometheus.GaugeOpts{Name: "reload_failure"})
+	router.metricWriteConfig = prometheus.NewSummary(prometheus.SummaryOpts{Name: "write_config"})
+	recorder := &fakeRejectionRecorder{rejections: map[string]string{}}
+	router.rejectionRecorder = recorder
+
+	// The configuration is invalid if any route in the state is broken.
+	checks := 0
+	check := func() error {
+		checks++
+		for k, cfg := range router.state {
+			if _, ok := cfg.Annotations[brokenAnnotation]; ok {
+				return fmt.Errorf("invalid configuration for %s", k)
+			}
+		}
+		return nil
+	}
+	router.checkConfigFn = check
+	router.reloadFn = func(shutdown bool) error { return check() }
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		router.AddRoute(makeFeedbackRoute(name, false))
+	}
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(router.pendingChanges) != 0 {
+		t.Fatalf("expected no pending changes after a successful reload, got %v", router.pendingChanges)
+	}
+
+	// Add a broken route and break an existing one.
+	for _, name := range []string{"e", "f", "g"} {
+		router.AddRoute(makeFeedbackRoute(name, false))
+	}
+	router.AddRoute(makeFeedbackRoute("h", true))
+	router.AddRoute(makeFeedbackRoute("b", true))
+	checks = 0
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("expected the router to recover from the failed reload, got %v", err)
+	}
+	if checks == 0 {
+		t.Fatalf("expected the configuration to be checked")
+	}
+
+	for _, name := range []string{"b", "h"} {
+		if reason := recorder.rejections["foo/"+name]; reason != "InvalidConfiguration" {
+			t.Errorf("expected route %s to be rejected, got %q", name, reason)
+		}
+		if router.HasRoute(makeFeedbackRoute(name, true)) {
+			t.Errorf("expected route %s to be removed from the state", name)
+		}
+	}
+	for _, name := range []string{"a", "c", "d", "e", "f", "g"} {
+		if _, ok := recorder.rejections["foo/"+name]; ok {
+			t.Errorf("expected route %s not to be rejected", name)
+		}
+		if !router.HasRoute(makeFeedbackRoute(name, false)) {
+			t.Errorf("expected route %s to be in the state", name)
+		}
+	}
+
+	// An unchanged rejected route stays rejected.
+	delete(recorder.rejections, "foo/h")
+	router.AddRoute(makeFeedbackRoute("h", true))
+	if router.HasRoute(makeFeedbackRoute("h", true)) {
+		t.Fatalf("expected unchanged rejected route to stay out of the state")
+	}
+	if _, ok := recorder.rejections["foo/h"]; !ok {
+		t.Fatalf("expected unchanged rejected route to be rejected again")
+	}
+
+	// Fixing the route admits it again.
+	router.AddRoute(makeFeedbackRoute("h", false))
+	if !router.HasRoute(makeFeedbackRoute("h", false)) {
+		t.Fatalf("expected fixed route to be added")
+	}
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A failure that is not caused by a changed route is returned.
+	router.AddRoute(makeFeedbackRoute("i", false))
+	router.checkConfigFn = func() error { return fmt.Errorf("broken global configuration") }
+	router.reloadFn = func(shutdown bool) error { return fmt.Errorf("broken global configuration") }
+	if err := router.commitAndReload(); err == nil {
+		t.Fatalf("expected an error when the configuration is broken without the changed routes")
+	}
+	if _, ok := recorder.rejections["foo/i"]; ok {
+		t.Fatalf("expected route i not to be rejected")
+	}
+	if _, ok := router.pendingChanges[routeKey(makeFeedbackRoute("i", false))]; !ok {
+		t.Fatalf("expected route i to remain a pending change after the failed reload")
+	}
+}
@@ -0,0 +1,206 @@
+package templaterouter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// Reasons the router reloads.
+const (
+	ReloadReasonInitialSync        = "initial-sync"
+	ReloadReasonPromotion          = "promotion"
+	ReloadReasonNamespaces         = "namespaces-changed"
+	ReloadReasonRouteAdded         = "route-added"
+	ReloadReasonRouteUpdated       = "route-updated"
+	ReloadReasonRouteRemoved       = "route-removed"
+	ReloadReasonEndpoints          = "endpoints-changed"
+	ReloadReasonResync             = "periodic-resync"
+	ReloadReasonCertificateRotated = "certificate-rotated"
+	ReloadReasonBrokenRoutes       = "broken-routes-rejected"
+	ReloadReasonStateImported      = "state-imported"
+	ReloadReasonForced             = "forced"
+	ReloadReasonMaintenance        = "maintenance-window"
+	ReloadReasonUnknown            = "unknown"
+)
+
+const (
+	// maxReloadRecords is how many reloads the router remembers.
+	maxReloadRecords = 50
+	// maxReloadObjects is how many objects are remembered per reason of a
+	// reload.  Larger reloads only record how many objects were involved.
+	maxReloadObjects = 20
+)
+
+// ReloadRecord describes a reload of the router and the changes that
+// triggered it.
+type ReloadRecord struct {
+	// Time is when the reload started.
+	Time time.Time `json:"time"`
+	// Duration is how long the reload took.
+	Duration time.Duration `json:"duration"`
+	// Reasons are the reasons for the reload.
+	Reasons []ReloadReason `json:"reasons"`
+	// Error is set if the reload failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ReloadReason is a reason for a reload and the objects it applies to.
+type ReloadReason struct {
+	// Reason is one of the ReloadReason constants.
+	Reason string `json:"reason"`
+	// Count is the number of objects that changed for this reason.
+	Count int `json:"count"`
+	// Objects are some of the objects that changed, by kind and key.
+	Objects []string `json:"objects,omitempty"`
+}
+
+// reloadReasonNames returns the names of reasons.
+func reloadReasonNames(reasons []ReloadReason) []string {
+	names := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		names = append(names, reason.Reason)
+	}
+	return names
+}
+
+// reloadObjectRoute returns how a route is named in reload records.
+func reloadObjectRoute(route *routev1.Route) string {
+	return fmt.Sprintf("route/%s/%s", route.Namespace, route.Name)
+}
+
+// reloadObjectEndpoints returns how the endpoints of a service unit are
+// named in reload records.
+func reloadObjectEndpoints(id ServiceUnitKey) string {
+	return fmt.Sprintf("endpoints/%s", id)
+}
+
+// recordRouteVersion records the resource version of a route added to the
+// state.
+// Must be called while holding r.lock
+func (r *templateRouter) recordRouteVersion(key ServiceAliasConfigKey, route *routev1.Route) {
+	if r.routeVersions == nil {
+		r.routeVersions = make(map[ServiceAliasConfigKey]string)
+	}
+	r.routeVersions[key] = route.ResourceVersion
+}
+
+// routeUpdateReason returns why the configuration of a route in the state
+// changed: the route was updated, or a periodic resync handled the same
+// version of the route again after what its configuration derives from,
+// such as its service or namespace, changed.
+// Must be called while holding r.lock
+func (r *templateRouter) routeUpdateReason(key ServiceAliasConfigKey, route *routev1.Route) string {
+	if version, ok := r.routeVersions[key]; ok && len(version) > 0 && version == route.ResourceVersion {
+		return ReloadReasonResync
+	}
+	return ReloadReasonRouteUpdated
+}
+
+// recordReloadReason records that the named object changed for reason and
+// requires a reload.  Changes applied dynamically do not require one and are
+// not recorded.
+// Must be called while holding r.lock
+func (r *templateRouter) recordReloadReason(reason, object string) {
+	if r.pendingReloadReasons == nil {
+		r.pendingReloadReasons = make(map[string]sets.String)
+	}
+	objects, ok := r.pendingReloadReasons[reason]
+	if !ok {
+		objects = sets.NewString()
+		r.pendingReloadReasons[reason] = objects
+	}
+	if len(object) > 0 {
+		objects.Insert(object)
+	}
+}
+
+// takeReloadReasons returns the reasons recorded since the last reload and
+// clears them.
+// Must be called while holding r.lock
+func (r *templateRouter) takeReloadReasons() []ReloadReason {
+	reasons := make([]ReloadReason, 0, len(r.pendingReloadReasons))
+	for reason, objects := range r.pendingReloadReasons {
+		list := objects.List()
+		if len(list) > maxReloadObjects {
+			list = list[:maxReloadObjects]
+		}
+		reasons = append(reasons, ReloadReason{Reason: reason, Count: objects.Len(), Objects: list})
+	}
+	r.pendingReloadReasons = nil
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, ReloadReason{Reason: ReloadReasonUnknown})
+	}
+	sort.Slice(reasons, func(i, j int) bool { return reasons[i].Reason < reasons[j].Reason })
+	return reasons
+}
+
+// recordReload counts a reload by reason and adds it to the reload history.
+func (r *templateRouter) recordReload(start time.Time, reasons []ReloadReason, err error) {
+	record := ReloadRecord{Time: start, Duration: time.Since(start), Reasons: reasons}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	for _, reason := range reasons {
+		if r.metricReloadReasons != nil {
+			r.metricReloadReasons.WithLabelValues(reason.Reason).Inc()
+		}
+	}
+	log.V(2).Info("router reloaded", "reasons", reasons, "error", record.Error)
+
+	r.reloadHistoryLock.Lock()
+	defer r.reloadHistoryLock.Unlock()
+	// reloads before the state was first committed do not load the
+	// routes yet.
+	if err == nil && !r.lastCommit.IsZero() {
+		r.lastReload = start.Add(record.Duration)
+	}
+	r.reloadHistory = append(r.reloadHistory, record)
+	if len(r.reloadHistory) > maxReloadRecords {
+		r.reloadHistory = r.reloadHistory[len(r.reloadHistory)-maxReloadRecords:]
+	}
+}
+
+// ReloadHistory returns the most recent reloads of the router, newest
+// first.
+func (r *templateRouter) ReloadHistory() []ReloadRecord {
+	r.reloadHistoryLock.Lock()
+	defer r.reloadHistoryLock.Unlock()
+	history := make([]ReloadRecord, 0, len(r.reloadHistory))
+	for i := len(r.reloadHistory) - 1; i >= 0; i-- {
+		history = append(history, r.reloadHistory[i])
+	}
+	return history
+}
+
+// Freshness is when the router last committed its state and haproxy last
+// loaded it.  The times are zero until it first happened.
+type Freshness struct {
+	// LastCommit is when the configuration was last written from the
+	// synced router state.
+	LastCommit time.Time
+	// LastReload is when haproxy last loaded a configuration written
+	// from the synced router state successfully.
+	LastReload time.Time
+}
+
+// recordCommit records that the configuration was written from the synced
+// router state.
+func (r *templateRouter) recordCommit(now time.Time) {
+	r.reloadHistoryLock.Lock()
+	defer r.reloadHistoryLock.Unlock()
+	r.lastCommit = now
+}
+
+// Freshness returns when the router last committed its state and haproxy
+// last loaded it.
+func (r *templateRouter) Freshness() Freshness {
+	r.reloadHistoryLock.Lock()
+	defer r.reloadHistoryLock.Unlock()
+	return Freshness{LastCommit: r.lastCommit, LastReload: r.lastReload}
+}
@@ -0,0 +1,175 @@
+package templaterouter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestTakeReloadReasons(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	if reasons := router.takeReloadReasons(); !reflect.DeepEqual(reasons, []ReloadReason{{Reason: ReloadReasonUnknown}}) {
+		t.Errorf("expected an unknown reason without changes, got %v", reasons)
+	}
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "a"},
+		Spec: routev1.RouteSpec{
+			Host: "a.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}
+	router.AddRoute(route)
+	updated := route.DeepCopy()
+	updated.Spec.Path = "/path"
+	router.AddRoute(updated)
+	router.RemoveRoute(&routev1.Route{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "missing"}})
+
+	router.lock.Lock()
+	reasons := router.takeReloadReasons()
+	router.lock.Unlock()
+	expected := []ReloadReason{
+		{Reason: ReloadReasonRouteAdded, Count: 1, Objects: []string{"route/ns/a"}},
+		{Reason: ReloadReasonRouteUpdated, Count: 1, Objects: []string{"route/ns/a"}},
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected %v, got %v", expected, reasons)
+	}
+
+	router.RemoveRoute(updated)
+	for i := 0; i < maxReloadObjects+5; i++ {
+		router.recordReloadReason(ReloadReasonEndpoints, fmt.Sprintf("endpoints/ns/svc-%02d", i))
+	}
+	reasons = router.takeReloadReasons()
+	if len(reasons) != 2 || reasons[0].Reason != ReloadReasonEndpoints || reasons[1].Reason != ReloadReasonRouteRemoved {
+		t.Fatalf("unexpected reasons %v", reasons)
+	}
+	if reasons[0].Count != maxReloadObjects+5 || len(reasons[0].Objects) != maxReloadObjects {
+		t.Errorf("expected %d of %d objects, got %d of %d", maxReloadObjects, maxReloadObjects+5, len(reasons[0].Objects), reasons[0].Count)
+	}
+	if router.pendingReloadReasons != nil {
+		t.Errorf("expected reasons to be cleared, got %v", router.pendingReloadReasons)
+	}
+}
+
+// TestReloadReasonsOfDynamicChanges tests that changes applied dynamically
+// are not recorded as reasons for a reload.
+func TestReloadReasonsOfDynamicChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reload-reasons")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, whitelistDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewFakeTemplateRouter()
+	router.dir = dir
+	router.dynamicConfigManager = &whitelistConfigManager{whitelists: map[string][]string{}}
+	router.synced = true
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "ns",
+			Name:            "a",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{ipWhitelistAnnotation: "10.0.0.0/8"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "a.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}
+	router.AddRoute(route)
+	router.lock.Lock()
+	reasons := router.takeReloadReasons()
+	router.lock.Unlock()
+	if expected := []ReloadReason{{Reason: ReloadReasonRouteAdded, Count: 1, Objects: []string{"route/ns/a"}}}; !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected %v, got %v", expected, reasons)
+	}
+
+	whitelisted := route.DeepCopy()
+	whitelisted.ResourceVersion = "2"
+	whitelisted.Annotations[ipWhitelistAnnotation] = "10.0.0.0/8 192.168.1.1"
+	router.AddRoute(whitelisted)
+	router.lock.Lock()
+	reasons = router.takeReloadReasons()
+	router.lock.Unlock()
+	if expected := []ReloadReason{{Reason: ReloadReasonUnknown}}; !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected the dynamic whitelist change not to be recorded, got %v", reasons)
+	}
+
+	// The same version of the route with another configuration comes
+	// from a periodic resync.
+	resynced := whitelisted.DeepCopy()
+	resynced.Spec.Path = "/path"
+	router.AddRoute(resynced)
+	updated := resynced.DeepCopy()
+	updated.ResourceVersion = "3"
+	updated.Spec.Path = "/other"
+	router.AddRoute(updated)
+	router.lock.Lock()
+	reasons = router.takeReloadReasons()
+	router.lock.Unlock()
+	expected := []ReloadReason{
+		{Reason: ReloadReasonResync, Count: 1, Objects: []string{"route/ns/a"}},
+		{Reason: ReloadReasonRouteUpdated, Count: 1, Objects: []string{"route/ns/a"}},
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected %v, got %v", expected, reasons)
+	}
+}
+
+func TestReloadHistory(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	start := time.Unix(1000, 0)
+	for i := 0; i < maxReloadRecords+3; i++ {
+		var err error
+		if i%2 == 0 {
+			err = fmt.Errorf("reload %d failed", i)
+		}
+		router.recordReload(start.Add(time.Duration(i)*time.Second), []ReloadReason{{Reason: ReloadReasonPromotion}}, err)
+	}
+
+	history := router.ReloadHistory()
+	if len(history) != maxReloadRecords {
+		t.Fatalf("expected %d records, got %d", maxReloadRecords, len(history))
+	}
+	newest := maxReloadRecords + 2
+	if !history[0].Time.Equal(start.Add(time.Duration(newest)*time.Second)) || history[0].Error != fmt.Sprintf("reload %d failed", newest) {
+		t.Errorf("expected the newest reload first, got %#v", history[0])
+	}
+	if !history[len(history)-1].Time.Equal(start.Add(3*time.Second)) || history[len(history)-1].Error != "" {
+		t.Errorf("expected the oldest reloads to be dropped, got %#v", history[len(history)-1])
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	start := time.Unix(1000, 0)
+	router.recordReload(start, nil, nil)
+	if freshness := router.Freshness(); !freshness.LastCommit.IsZero() || !freshness.LastReload.IsZero() {
+		t.Fatalf("expected reloads before the first commit to be ignored, got %#v", freshness)
+	}
+
+	commit := start.Add(time.Second)
+	router.recordCommit(commit)
+	router.recordReload(commit, nil, fmt.Errorf("reload failed"))
+	if freshness := router.Freshness(); !freshness.LastCommit.Equal(commit) || !freshness.LastReload.IsZero() {
+		t.Fatalf("expected failed reloads to be ignored, got %#v", freshness)
+	}
+
+	router.recordReload(commit, nil, nil)
+	if freshness := router.Freshness(); freshness.LastReload.Before(commit) {
+		t.Errorf("expected the reload after the commit to be recorded, got %#v", freshness)
+	}
+}
@@ -0,0 +1,238 @@
+package templaterouter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// serverStateFile is the file the state of the servers is saved to before a
+// reload, relative to the working directory of the router.
+const serverStateFile = "run/haproxy.state"
+
+// ReloadStateConfig configures the state haproxy keeps across reloads.
+type ReloadStateConfig struct {
+	// PeerPort is the local port of the peers section the haproxy
+	// processes being replaced hand the contents of their stick tables,
+	// such as the rate limiting counters, over to the new process through.
+	// Zero starts the new process with empty stick tables.
+	PeerPort int
+
+	// ServerState saves the state of the servers, such as their health,
+	// weight and administrative state set through the runtime API, before
+	// each reload and loads it in the new process.
+	ServerState bool
+
+	// MapEntries saves the entries added to the maps of the routes through
+	// the runtime API before each reload and adds them to the new process.
+	MapEntries bool
+}
+
+// dynamicMapFiles are the maps of the routes, relative to the working
+// directory of the router, entries may be added to through the runtime API.
+var dynamicMapFiles = []string{
+	"conf/os_http_be.map",
+	"conf/os_edge_reencrypt_be.map",
+	"conf/os_sni_passthrough.map",
+	"conf/os_tcp_be.map",
+	"conf/os_route_http_redirect.map",
+}
+
+// mapEntry is an entry of a haproxy map.
+type mapEntry struct {
+	key   string
+	value string
+}
+
+// saveServerState writes the state of the servers of the running haproxy
+// to the server state file the new process loads.  When the state cannot be
+// saved, the file of the previous reload is removed so the new process does
+// not start from an outdated state, such as servers that were down since.
+func (r *templateRouter) saveServerState() error {
+	path := filepath.Join(r.dir, serverStateFile)
+	out, err := newMasterCLI(filepath.Join(r.dir, statsSocketFile)).execute("show servers state")
+	if err == errMasterNotRunning {
+		// haproxy is starting, there is no state to keep.
+		return removeServerState(path)
+	} else if err != nil {
+		removeServerState(path)
+		return err
+	}
+	if !isServerState(out) {
+		removeServerState(path)
+		return fmt.Errorf("unexpected response: %s", strings.TrimSpace(out))
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(out), 0600); err != nil {
+		removeServerState(path)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeServerState removes the server state file at path, if any.
+func removeServerState(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove the outdated server state %s: %v", path, err)
+	}
+	return nil
+}
+
+// isServerState returns whether out is the output of "show servers state",
+// which starts with the version of its format.
+func isServerState(out string) bool {
+	version := strings.SplitN(out, "\n", 2)[0]
+	return len(version) > 0 && isInteger(strings.TrimSpace(version))
+}
+
+// saveMapEntries records the entries of the maps of the running haproxy that
+// are not in the map files it loaded, because they were added through the
+// runtime API, until they are restored in the new process.  It must be
+// called before the map files are written, without holding r.lock.  Entries
+// already saved for a reload that failed are kept, the map files no longer
+// match the running process.
+func (r *templateRouter) saveMapEntries() error {
+	if r.mapEntries != nil {
+		return nil
+	}
+	cli := newMasterCLI(filepath.Join(r.dir, statsSocketFile))
+	added := map[string][]mapEntry{}
+	for _, name := range dynamicMapFiles {
+		path := filepath.Join(r.dir, name)
+		loaded, err := readMapFile(path)
+		if err != nil {
+			return err
+		}
+		out, err := cli.execute("show map " + path)
+		if err == errMasterNotRunning {
+			// haproxy is starting, there are no entries to keep.
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range parseShowMap(out) {
+			if _, ok := loaded[entry]; !ok {
+				added[path] = append(added[path], entry)
+			}
+		}
+	}
+	r.mapEntries = added
+	return nil
+}
+
+// restoreMapEntries adds the saved map entries to the maps of the new
+// haproxy, after the entries of the map files, unless the map files have
+// entries for their keys since or the entries send requests to the backend
+// of a route the router no longer serves.  It must be called without holding
+// r.lock.
+func (r *templateRouter) restoreMapEntries() error {
+	added := r.mapEntries
+	r.mapEntries = nil
+
+	r.lock.Lock()
+	for path, entries := range added {
+		added[path] = r.servedMapEntries(entries)
+	}
+	r.lock.Unlock()
+
+	cli := newMasterCLI(filepath.Join(r.dir, statsSocketFile))
+	var errs []error
+	for _, name := range dynamicMapFiles {
+		path := filepath.Join(r.dir, name)
+		if len(added[path]) == 0 {
+			continue
+		}
+		written, err := readMapFile(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		keys := sets.NewString()
+		for entry := range written {
+			keys.Insert(entry.key)
+		}
+		for _, entry := range added[path] {
+			if keys.Has(entry.key) {
+				continue
+			}
+			out, err := cli.execute(fmt.Sprintf("add map %s %s %s", path, entry.key, entry.value))
+			if err == nil && len(strings.TrimSpace(out)) > 0 {
+				err = fmt.Errorf("unexpected response: %s", strings.TrimSpace(out))
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to add %s to %s: %v", entry.key, path, err))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// servedMapEntries returns the entries of entries that do not send requests
+// to the backend of a route missing from the router state, such as a route
+// deleted since they were added.  The entries of the maps whose values are
+// not backends are all kept.
+// Must be called while holding r.lock
+func (r *templateRouter) servedMapEntries(entries []mapEntry) []mapEntry {
+	var served []mapEntry
+	for _, entry := range entries {
+		if key, ok := backendRouteKey(entry.value); ok {
+			if _, ok := r.state[key]; !ok {
+				log.V(0).Info("dropping a map entry added through the runtime API for a route the router no longer serves", "key", entry.key, "backend", entry.value)
+				continue
+			}
+		}
+		served = append(served, entry)
+	}
+	return served
+}
+
+// backendRouteKey returns the key of the route of backend, named
+// <prefix>:<namespace>:<name> with an optional :<color>, if it is the name
+// of the backend of a route.
+func backendRouteKey(backend string) (ServiceAliasConfigKey, bool) {
+	parts := strings.Split(backend, ":")
+	if len(parts) < 3 || len(parts) > 4 || !strings.HasPrefix(parts[0], "be_") {
+		return "", false
+	}
+	return routeKeyFromParts(parts[1], parts[2]), true
+}
+
+// readMapFile returns the entries of the map file at path, which has none
+// if it does not exist.
+func readMapFile(path string) (map[mapEntry]struct{}, error) {
+	entries := map[mapEntry]struct{}{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		entries[mapEntry{key: fields[0], value: strings.Join(fields[1:], " ")}] = struct{}{}
+	}
+	return entries, nil
+}
+
+// parseShowMap returns the entries in the output of "show map", whose lines
+// hold the id, key and value of the entries.
+func parseShowMap(out string) []mapEntry {
+	var entries []mapEntry
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "0x") {
+			continue
+		}
+		entries = append(entries, mapEntry{key: fields[1], value: strings.Join(fields[2:], " ")})
+	}
+	return entries
+}
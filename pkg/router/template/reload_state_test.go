@@ -0,0 +1,228 @@
+package templaterouter
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestReloadStateConfig(t *testing.T) {
+	routes := []*routev1.Route{{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        "web",
+			Annotations: map[string]string{"haproxy.router.openshift.io/rate-limit-connections": "true"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "web.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}}
+	render := func(state ReloadStateConfig) string {
+		t.Helper()
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:   "/var/lib/haproxy",
+			BindPorts:    true,
+			ReloadState:  state,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		files, err := renderer.Render(renderer.RouteState(routes))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		for _, file := range files {
+			if file.Name == "conf/haproxy.config" {
+				return string(file.Contents)
+			}
+		}
+		t.Fatalf("conf/haproxy.config not rendered")
+		return ""
+	}
+
+	expected := []string{
+		"\n  server-state-file /var/lib/haproxy/run/haproxy.state\n",
+		"\n  localpeer openshift_router\n",
+		"\n  load-server-state-from-file global\n",
+		"\npeers openshift_router\n  peer openshift_router 127.0.0.1:10444\n",
+		"http_req_rate(10s) peers openshift_router\n",
+	}
+	config := render(ReloadStateConfig{PeerPort: 10444, ServerState: true})
+	for _, line := range expected {
+		if !strings.Contains(config, line) {
+			t.Errorf("expected %q in the config", line)
+		}
+	}
+
+	config = render(ReloadStateConfig{})
+	for _, line := range expected {
+		if strings.Contains(config, line) {
+			t.Errorf("expected no %q in the config without reload state", line)
+		}
+	}
+}
+
+func TestIsServerState(t *testing.T) {
+	tests := map[string]bool{
+		"1\n# be_id be_name srv_id srv_name srv_addr\n": true,
+		"1\n":                true,
+		"Unknown command.\n": false,
+		"":                   false,
+	}
+	for out, expected := range tests {
+		if isServerState(out) != expected {
+			t.Errorf("expected isServerState(%q) to be %v", out, expected)
+		}
+	}
+}
+
+func TestSaveServerState(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "run"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, serverStateFile)
+	router := &templateRouter{dir: dir}
+
+	// A state file left behind is not loaded by a haproxy that starts.
+	if err := ioutil.WriteFile(path, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.saveServerState(); err != nil {
+		t.Fatalf("unexpected error without haproxy: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the outdated server state to be removed, got %v", err)
+	}
+
+	listener, err := net.Listen("unix", filepath.Join(dir, statsSocketFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	response := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if cmd, _ := bufio.NewReader(conn).ReadString('\n'); strings.TrimSpace(cmd) == "show servers state" {
+				conn.Write([]byte(<-response))
+			}
+			conn.Close()
+		}
+	}()
+
+	state := "1\n# be_id be_name srv_id srv_name srv_addr srv_op_state\n3 be_http:ns:web 1 pod:web-1 10.128.0.5 2\n"
+	response <- state
+	if err := router.saveServerState(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if saved, err := ioutil.ReadFile(path); err != nil || string(saved) != state {
+		t.Errorf("expected the server state to be saved, got %q and error %v", saved, err)
+	}
+
+	response <- "Unknown command.\n"
+	if err := router.saveServerState(); err == nil {
+		t.Errorf("expected an error for an unexpected response")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the outdated server state to be removed, got %v", err)
+	}
+}
+
+func TestCommitAndReloadKeepsState(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"conf", "run"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mapPath := filepath.Join(dir, "conf/os_http_be.map")
+	statePath := filepath.Join(dir, serverStateFile)
+
+	// The running haproxy loaded the web route from the map file, the api
+	// route and the route deleted since were added through the runtime API
+	// and the old route is removed from the new config.
+	if err := ioutil.WriteFile(mapPath, []byte("^web\\.example\\.com$ be_http:ns:web\n^old\\.example\\.com$ be_http:ns:old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	state := "1\n# be_id be_name srv_id srv_name srv_addr srv_op_state\n3 be_http:ns:web 1 pod:web-1 10.128.0.5 2\n"
+	responses := map[string]string{
+		"show servers state":  state,
+		"show map " + mapPath: "0x1 ^web\\.example\\.com$ be_http:ns:web\n0x2 ^old\\.example\\.com$ be_http:ns:old\n0x3 ^api\\.example\\.com$ be_http:ns:api\n0x4 ^gone\\.example\\.com$ be_http:ns:gone\n",
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, statsSocketFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	commands := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			cmd, _ := bufio.NewReader(conn).ReadString('\n')
+			cmd = strings.TrimSpace(cmd)
+			commands <- cmd
+			conn.Write([]byte(responses[cmd]))
+			conn.Close()
+		}
+	}()
+
+	router := NewFakeTemplateRouter()
+	router.dir = dir
+	router.metricReload = prometheus.NewSummary(prometheus.SummaryOpts{Name: "reload"})
+	router.metricReloadFailure = prometheus.NewGauge(prometheus.GaugeOpts{Name: "reload_failure"})
+	router.metricWriteConfig = prometheus.NewSummary(prometheus.SummaryOpts{Name: "write_config"})
+	router.reloadState = ReloadStateConfig{ServerState: true, MapEntries: true}
+	router.state[routeKeyFromParts("ns", "api")] = ServiceAliasConfig{Namespace: "ns", Host: "api.example.com"}
+	router.templates = map[string]*template.Template{
+		"conf/os_http_be.map": template.Must(template.New("map").Parse("^web\\.example\\.com$ be_http:ns:web\n")),
+	}
+	var savedState string
+	router.reloadFn = func(shutdown bool) error {
+		data, err := ioutil.ReadFile(statePath)
+		if err != nil {
+			return err
+		}
+		savedState = string(data)
+		return nil
+	}
+
+	if err := router.commitAndReload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if savedState != state {
+		t.Errorf("expected the server state to be saved before the reload, got %q", savedState)
+	}
+	close(commands)
+	var added []string
+	for cmd := range commands {
+		if strings.HasPrefix(cmd, "add map ") {
+			added = append(added, cmd)
+		}
+	}
+	if expected := []string{"add map " + mapPath + " ^api\\.example\\.com$ be_http:ns:api"}; !reflect.DeepEqual(added, expected) {
+		t.Errorf("expected only the entry added through the runtime API for a served route to be restored, got %v", added)
+	}
+	if router.mapEntries != nil {
+		t.Errorf("expected the restored map entries to be forgotten, got %v", router.mapEntries)
+	}
+}
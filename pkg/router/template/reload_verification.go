@@ -0,0 +1,168 @@
+package templaterouter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// verifiedConfigFile is the copy of the last configuration haproxy was
+	// verified to serve after a reload, relative to the working directory
+	// of the router.
+	verifiedConfigFile = "conf/haproxy.config.verified"
+
+	// reloadVerificationPollInterval is how often haproxy is asked for its
+	// process while waiting for the new generation to serve.
+	reloadVerificationPollInterval = 100 * time.Millisecond
+)
+
+// haproxyInfo identifies the haproxy process that answered "show info" on
+// the stats socket.
+type haproxyInfo struct {
+	// pid is the pid of the process.
+	pid int
+	// uptime is how long the process has been running.
+	uptime time.Duration
+}
+
+// showInfo returns the process that serves the socket.
+func (c *masterCLI) showInfo() (*haproxyInfo, error) {
+	out, err := c.execute("show info")
+	if err != nil {
+		return nil, err
+	}
+	return parseShowInfo(out)
+}
+
+// parseShowInfo parses the output of the "show info" command.
+func parseShowInfo(out string) (*haproxyInfo, error) {
+	info := &haproxyInfo{}
+	foundPid := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "Pid":
+			pid, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected haproxy pid %q", value)
+			}
+			info.pid, foundPid = pid, true
+		case "Uptime_sec":
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected haproxy uptime %q", value)
+			}
+			info.uptime = time.Duration(seconds) * time.Second
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !foundPid {
+		return nil, fmt.Errorf("no pid found in haproxy info")
+	}
+	return info, nil
+}
+
+// servingHAProxy returns the haproxy process that serves the stats socket
+// before a reload, or nil if the reloads are not verified or haproxy is not
+// running.
+func (r *templateRouter) servingHAProxy() *haproxyInfo {
+	if r.reloadVerificationTimeout <= 0 {
+		return nil
+	}
+	info, err := newMasterCLI(filepath.Join(r.dir, statsSocketFile)).showInfo()
+	if err != nil {
+		log.V(4).Info("haproxy info is unavailable before the reload", "error", err.Error())
+		return nil
+	}
+	return info
+}
+
+// verifyReload waits for a new haproxy process, other than before, to serve
+// the stats socket after the reload script reported a successful reload,
+// which means haproxy loaded the new configuration.  The configuration is
+// copied aside once it is verified.  If no new process serves by the
+// timeout, the configuration haproxy was last verified to serve is restored,
+// and haproxy is reloaded with it if no process serves at all, so that the
+// configuration on disk is the one haproxy serves.
+func (r *templateRouter) verifyReload(before *haproxyInfo) error {
+	if r.reloadVerificationTimeout <= 0 {
+		return nil
+	}
+	cli := newMasterCLI(filepath.Join(r.dir, statsSocketFile))
+	deadline := time.Now().Add(r.reloadVerificationTimeout)
+	var serving *haproxyInfo
+	for {
+		info, err := cli.showInfo()
+		if err == nil {
+			serving = info
+			if before == nil || info.pid != before.pid {
+				log.V(4).Info("haproxy serves the new configuration", "pid", info.pid, "uptime", info.uptime.String())
+				return r.saveVerifiedConfig()
+			}
+		}
+		if !time.Now().After(deadline) {
+			time.Sleep(reloadVerificationPollInterval)
+			continue
+		}
+
+		r.metricReloadVerificationFailures.Inc()
+		var cause error
+		if serving == nil {
+			cause = fmt.Errorf("no haproxy process answered on the stats socket within %v", r.reloadVerificationTimeout)
+		} else {
+			cause = fmt.Errorf("haproxy process %d still serves the previous configuration after %v", serving.pid, r.reloadVerificationTimeout)
+		}
+		log.V(0).Info("the reloaded haproxy configuration never became live, rolling back", "error", cause.Error())
+		if err := r.rollBackConfig(serving == nil); err != nil {
+			log.Error(err, "unable to roll back to the configuration haproxy was last verified to serve")
+		}
+		return &ReloadError{Stage: ReloadStageVerify, Err: cause}
+	}
+}
+
+// saveVerifiedConfig copies the configuration haproxy was verified to serve
+// aside.
+func (r *templateRouter) saveVerifiedConfig() error {
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, haproxyConfigFile))
+	if err != nil {
+		return fmt.Errorf("unable to read the verified haproxy configuration: %v", err)
+	}
+	path := filepath.Join(r.dir, verifiedConfigFile)
+	if err := ioutil.WriteFile(path+tempFileSuffix, data, 0644); err != nil {
+		return fmt.Errorf("unable to save the verified haproxy configuration: %v", err)
+	}
+	return os.Rename(path+tempFileSuffix, path)
+}
+
+// rollBackConfig restores the configuration haproxy was last verified to
+// serve, and reloads haproxy with it if reload is true.  There is nothing to
+// roll back to before the first verified reload.
+func (r *templateRouter) rollBackConfig(reload bool) error {
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, verifiedConfigFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(r.dir, haproxyConfigFile), data, 0644); err != nil {
+		return err
+	}
+	if reload {
+		return r.reloadRouter(false)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package templaterouter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseShowInfo(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected *haproxyInfo
+		err      bool
+	}{
+		{
+			name:     "show info",
+			output:   "Name: HAProxy\nVersion: 2.8.5\nPid: 42\nUptime: 0d 0h01m05s\nUptime_sec: 65\nMemmax_MB: 0\n",
+			expected: &haproxyInfo{pid: 42, uptime: 65 * time.Second},
+		},
+		{
+			name:   "no pid",
+			output: "Name: HAProxy\nUptime_sec: 65\n",
+			err:    true,
+		},
+		{
+			name:   "invalid pid",
+			output: "Pid: abc\n",
+			err:    true,
+		},
+	}
+	for _, tc := range testCases {
+		info, err := parseShowInfo(tc.output)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got none", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(info, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, info)
+		}
+	}
+}
+
+// fakeStatsSocket answers "show info" with the pid of the haproxy process
+// serving the stats socket.
+type fakeStatsSocket struct {
+	lock     sync.Mutex
+	listener net.Listener
+	pid      int
+}
+
+func (s *fakeStatsSocket) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		cmd, _ := bufio.NewReader(conn).ReadString('\n')
+		if strings.TrimSpace(cmd) == "show info" {
+			s.lock.Lock()
+			fmt.Fprintf(conn, "Name: HAProxy\nPid: %d\nUptime_sec: 1\n", s.pid)
+			s.lock.Unlock()
+		}
+		conn.Close()
+	}
+}
+
+func TestVerifyReload(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"conf", "run"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, statsSocketFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	socket := &fakeStatsSocket{listener: listener, pid: 10}
+	go socket.serve()
+
+	configPath := filepath.Join(dir, haproxyConfigFile)
+	writeConfig := func(config string) {
+		if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readConfig := func() string {
+		data, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	router := &templateRouter{
+		dir:                              dir,
+		reloadVerificationTimeout:        500 * time.Millisecond,
+		metricReloadVerificationFailures: prometheus.NewCounter(prometheus.CounterOpts{Name: "reload_verification_failures"}),
+	}
+
+	// a new process serves the new configuration
+	writeConfig("generation 1")
+	before := router.servingHAProxy()
+	if before == nil || before.pid != 10 {
+		t.Fatalf("expected haproxy 10 to serve before the reload, got %#v", before)
+	}
+	socket.lock.Lock()
+	socket.pid = 11
+	socket.lock.Unlock()
+	if err := router.verifyReload(before); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, verifiedConfigFile)); err != nil || string(data) != "generation 1" {
+		t.Fatalf("expected the verified configuration to be saved, got %q, %v", data, err)
+	}
+
+	// the process that served before the reload still serves
+	writeConfig("generation 2")
+	err = router.verifyReload(router.servingHAProxy())
+	var reloadErr *ReloadError
+	if !errors.As(err, &reloadErr) || reloadErr.Stage != ReloadStageVerify {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+	if config := readConfig(); config != "generation 1" {
+		t.Errorf("expected the verified configuration to be restored, got %q", config)
+	}
+	if failures := testutil.ToFloat64(router.metricReloadVerificationFailures); failures != 1 {
+		t.Errorf("expected 1 verification failure, got %v", failures)
+	}
+
+	// no process serves, the verified configuration is reloaded
+	writeConfig("generation 3")
+	listener.Close()
+	reloads := 0
+	router.reloadFn = func(shutdown bool) error {
+		reloads++
+		return nil
+	}
+	if err := router.verifyReload(before); err == nil {
+		t.Fatalf("expected a verification error without haproxy")
+	}
+	if config := readConfig(); config != "generation 1" || reloads != 1 {
+		t.Errorf("expected haproxy to be reloaded with the verified configuration, got %q after %d reloads", config, reloads)
+	}
+}
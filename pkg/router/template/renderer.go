@@ -0,0 +1,263 @@
+package templaterouter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"text/template"
+
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+// RendererConfig is the router-wide configuration of a Renderer.  It holds
+// the same settings a TemplatePlugin passes to its templates.
+type RendererConfig struct {
+	// TemplatePath is the template file to render.
+	TemplatePath string
+	// TemplateOverridePaths are the template override files whose sections
+	// replace the ones of the template.
+	TemplateOverridePaths []string
+	// WorkingDir is the directory the rendered files refer to for the
+	// certificates and other files of the router.  Render does not write
+	// anything to it.
+	WorkingDir string
+	// DefaultCertificatePath is the full path of the default certificate.
+	DefaultCertificatePath string
+	// DefaultDestinationCAPath is the full path of the default destination CA.
+	DefaultDestinationCAPath string
+	// AllowWildcardRoutes renders the wildcard routes of RouteState as
+	// wildcards.
+	AllowWildcardRoutes bool
+	// ConfigSnippetDirectives are the directives allowed in the config
+	// snippets of the routes of RouteState.
+	ConfigSnippetDirectives sets.String
+	// HTTPCompatOptions are the HTTP/1 compatibility options the routes of
+	// RouteState may set.
+	HTTPCompatOptions sets.String
+	StatsUsername     string
+	StatsPassword     string
+	StatsPort         int
+	// BindPorts binds the router ports.  A router that is not synced yet
+	// renders without them.
+	BindPorts bool
+	// Standby renders the public frontends disabled.
+	Standby bool
+	// DisableHTTP2 disables HTTP/2 on the frontends and the backends.
+	DisableHTTP2 bool
+	// StableServerNames names the servers of the endpoints added with
+	// AddEndpoints after slots of their service, as the router does.
+	StableServerNames bool
+	// MasterWorker renders the configuration for haproxy in master-worker
+	// mode.
+	MasterWorker                  bool
+	CaptureHTTPRequestHeaders     []CaptureHTTPHeader
+	CaptureHTTPResponseHeaders    []CaptureHTTPHeader
+	CaptureHTTPCookie             *CaptureHTTPCookie
+	HTTPHeaderNameCaseAdjustments []HTTPHeaderNameCaseAdjustment
+	URINormalizers                []string
+	ResponseHeaderPolicy          []routeapihelpers.ResponseHeaderRule
+	TLSSession                    TLSSessionConfig
+	// TLSTicketKeysFile is the TLS session ticket keys file the rendered
+	// configuration refers to, if any.
+	TLSTicketKeysFile string
+	// CertificateConflictPolicy picks the route whose certificate is
+	// presented when routes supply different certificates for the same
+	// server name.
+	CertificateConflictPolicy string
+	// SNIHostMismatchPolicy is what happens to TLS requests whose SNI does
+	// not match their Host header.
+	SNIHostMismatchPolicy string
+	// SetForwardedHeaders is the policy for the Forwarded and
+	// X-Forwarded-* headers of the routes of RouteState that do not set
+	// their own.
+	SetForwardedHeaders string
+	// WAF configures the web application firewall agent of the router.
+	WAF WAFConfig
+	// ResponseCacheSize is the size in megabytes the response caches of
+	// the routes may take in total.
+	ResponseCacheSize int
+	// EndpointMetadata configures the metadata of the endpoints made
+	// available to the logs and response headers.
+	EndpointMetadata EndpointMetadataConfig
+	// ReloadState configures the state haproxy keeps across reloads.
+	ReloadState ReloadStateConfig
+	// OldWorkers limits how long the processes of previous reloads drain
+	// their connections.
+	OldWorkers OldWorkersConfig
+	// Tuning is the tuning of the haproxy process.
+	Tuning HAProxyTuning
+	// MaxMapFileEntries is the number of entries above which the maps of
+	// the routes are split into shards.  Zero does not split the maps.
+	MaxMapFileEntries int
+	// TransparentProxy connects to the backends from the addresses of the
+	// clients.
+	TransparentProxy bool
+	// HAProxyCapabilities are the version and build options of the haproxy
+	// the versioned directives are rendered for.  Nil renders the
+	// directives every haproxy the router runs with supports.
+	HAProxyCapabilities *HAProxyCapabilities
+}
+
+// RenderState is the route and service state rendered by a Renderer.
+type RenderState struct {
+	// Routes are the routes to render.
+	Routes map[ServiceAliasConfigKey]ServiceAliasConfig
+	// ServiceUnits are the services of the routes and their endpoints.
+	ServiceUnits map[ServiceUnitKey]ServiceUnit
+	// HealthCheckIntervals are the adaptive health check intervals of the
+	// routes whose backends have been stable long enough for them to grow.
+	HealthCheckIntervals map[ServiceAliasConfigKey]string
+}
+
+// File is a file rendered by a Renderer.
+type File struct {
+	// Name is the path of the file, relative to the working directory.
+	Name string
+	// Contents are the rendered contents of the file.
+	Contents []byte
+}
+
+// Renderer renders the router template for a given state without the
+// watchers, certificate management and reloads of a TemplatePlugin, so that
+// other tools can generate router configuration files.
+type Renderer struct {
+	config    RendererConfig
+	templates map[string]*template.Template
+}
+
+// NewRenderer parses the template of config and returns a Renderer for it.
+func NewRenderer(config RendererConfig) (*Renderer, error) {
+	templates, err := parseTemplates(config.TemplatePath, config.TemplateOverridePaths)
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{config: config, templates: templates}, nil
+}
+
+// RouteState returns the render state of routes, as the router would hold
+// it.  Their services have no endpoints, so their backends have no servers.
+func (r *Renderer) RouteState(routes []*routev1.Route) RenderState {
+	router := r.router(make(map[ServiceUnitKey]ServiceUnit))
+	state := RenderState{Routes: make(map[ServiceAliasConfigKey]ServiceAliasConfig, len(routes))}
+	for _, route := range routes {
+		key := routeKey(route)
+		config := router.createServiceAliasConfig(route, key)
+		for id := range config.ServiceUnits {
+			if _, ok := router.findMatchingServiceUnit(id); !ok {
+				router.createServiceUnitInternal(id)
+			}
+			router.addServiceAliasAssociation(id, key)
+		}
+		state.Routes[key] = *config
+	}
+	state.ServiceUnits = router.serviceUnits
+	return state
+}
+
+// router returns a router with the settings of the renderer that holds
+// serviceUnits, which it does not write or reload.
+func (r *Renderer) router(serviceUnits map[ServiceUnitKey]ServiceUnit) *templateRouter {
+	router := &templateRouter{
+		dir:                           r.config.WorkingDir,
+		serviceUnits:                  serviceUnits,
+		defaultCertificatePath:        r.config.DefaultCertificatePath,
+		defaultDestinationCAPath:      r.config.DefaultDestinationCAPath,
+		statsUser:                     r.config.StatsUsername,
+		statsPassword:                 r.config.StatsPassword,
+		statsPort:                     r.config.StatsPort,
+		allowWildcardRoutes:           r.config.AllowWildcardRoutes,
+		bindPortsAfterSync:            !r.config.BindPorts,
+		standby:                       r.config.Standby,
+		disableHTTP2:                  r.config.DisableHTTP2,
+		configSnippetDirectives:       r.config.ConfigSnippetDirectives,
+		httpCompatOptions:             r.config.HTTPCompatOptions,
+		masterWorker:                  r.config.MasterWorker,
+		captureHTTPRequestHeaders:     r.config.CaptureHTTPRequestHeaders,
+		captureHTTPResponseHeaders:    r.config.CaptureHTTPResponseHeaders,
+		captureHTTPCookie:             r.config.CaptureHTTPCookie,
+		httpHeaderNameCaseAdjustments: r.config.HTTPHeaderNameCaseAdjustments,
+		uriNormalizers:                r.config.URINormalizers,
+		responseHeaderPolicy:          r.config.ResponseHeaderPolicy,
+		tlsSession:                    r.config.TLSSession,
+		certificateConflictPolicy:     r.config.CertificateConflictPolicy,
+		sniHostMismatchPolicy:         r.config.SNIHostMismatchPolicy,
+		setForwardedHeaders:           r.config.SetForwardedHeaders,
+		waf:                           r.config.WAF,
+		endpointMetadata:              r.config.EndpointMetadata,
+		reloadState:                   r.config.ReloadState,
+		oldWorkers:                    r.config.OldWorkers,
+		tuning:                        r.config.Tuning,
+		transparentProxy:              r.config.TransparentProxy,
+		haproxyCapabilities:           r.config.HAProxyCapabilities,
+	}
+	if len(r.config.TLSTicketKeysFile) > 0 {
+		router.tlsTicketKeys = &tlsTicketKeys{path: r.config.TLSTicketKeysFile}
+	}
+	return router
+}
+
+// AddEndpoints sets the endpoints of the service of state they belong to,
+// as the router would.  Endpoints of services no route of state uses are
+// ignored.  lookupSvc finds the services of endpoints without addresses to
+// check whether they are idled.
+func (r *Renderer) AddEndpoints(state RenderState, endpoints *kapi.Endpoints, excludeUDP bool, lookupSvc ServiceLookup) {
+	id := endpointsKey(endpoints)
+	serviceUnit, ok := state.ServiceUnits[id]
+	if !ok {
+		return
+	}
+	table := createRouterEndpoints(endpoints, excludeUDP, lookupSvc)
+	if r.config.StableServerNames {
+		assignServerSlots(id, serviceUnit.EndpointTable, table)
+	}
+	serviceUnit.EndpointTable = table
+	state.ServiceUnits[id] = serviceUnit
+}
+
+// Render renders every file of the template for state, and the shards of
+// the maps it splits, and returns them sorted by name.  The certificates the
+// routes refer to are not written.
+func (r *Renderer) Render(state RenderState) ([]File, error) {
+	// The server weights and active endpoints of the routes are computed
+	// the same way the router does before writing its configuration.
+	router := r.router(state.ServiceUnits)
+	routes := make(map[ServiceAliasConfigKey]ServiceAliasConfig, len(state.Routes))
+	for k, cfg := range state.Routes {
+		cfg.ServiceUnitNames = router.calculateServiceWeights(cfg.ServiceUnits, cfg.WeightByEndpoints)
+		cfg.ActiveEndpoints = router.getActiveEndpoints(cfg.ServiceUnits)
+		cfg.GRPC = router.isGRPC(&cfg)
+		cfg.Status = ServiceAliasConfigStatusSaved
+		routes[k] = cfg
+	}
+	findRedirectHostLoops(routes)
+	responseCaches, _ := allocateResponseCaches(routes, r.config.ResponseCacheSize)
+
+	data := router.templateData(routes, state.HealthCheckIntervals, responseCaches)
+
+	files, err := renderMapShards(r.templates, &data, r.config.MaxMapFileEntries)
+	if err != nil {
+		return nil, err
+	}
+	shards := sets.NewString()
+	for _, file := range files {
+		shards.Insert(file.Name)
+	}
+
+	for name := range r.templates {
+		if shards.Has(name) {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := r.templates[name].Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("error executing template for file %s: %v", name, err)
+		}
+		files = append(files, File{Name: name, Contents: buf.Bytes()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
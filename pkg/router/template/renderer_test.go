@@ -0,0 +1,200 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+	routertesting "github.com/openshift/router/pkg/router/testing"
+)
+
+func TestRenderer(t *testing.T) {
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+
+	serviceKey := ServiceUnitKey("ns/svc")
+	routeKey := ServiceAliasConfigKey("ns:route")
+	state := RenderState{
+		Routes: map[ServiceAliasConfigKey]ServiceAliasConfig{
+			routeKey: {
+				Name:           "route",
+				Namespace:      "ns",
+				Host:           "www.example.com",
+				RoutingKeyName: "key",
+				ServiceUnits:   map[ServiceUnitKey]int32{serviceKey: 100},
+			},
+		},
+		ServiceUnits: map[ServiceUnitKey]ServiceUnit{
+			serviceKey: {
+				Name:     string(serviceKey),
+				Hostname: "svc.ns.svc",
+				EndpointTable: []Endpoint{
+					{ID: "ep1", IP: "10.0.0.1", Port: "8080", IdHash: "hash1"},
+					{ID: "ep2", IP: "10.0.0.2", Port: "8080", IdHash: "hash2"},
+				},
+			},
+		},
+	}
+
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+
+	var config string
+	for i, file := range files {
+		if i > 0 && files[i-1].Name >= file.Name {
+			t.Errorf("files are not sorted by name: %q before %q", files[i-1].Name, file.Name)
+		}
+		if file.Name == "conf/haproxy.config" {
+			config = string(file.Contents)
+		}
+	}
+	if len(config) == 0 {
+		t.Fatalf("conf/haproxy.config was not rendered")
+	}
+	for _, expected := range []string{
+		"backend be_http:ns:route",
+		"server ep1 10.0.0.1:8080 cookie hash1 weight 1 check",
+		"server ep2 10.0.0.2:8080 cookie hash2 weight 1 check",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected %q in the rendered configuration", expected)
+		}
+	}
+
+	if route := state.Routes[routeKey]; route.ServiceUnitNames != nil || route.ActiveEndpoints != 0 {
+		t.Errorf("expected the rendered state to be left unchanged, got %#v", route)
+	}
+}
+
+func TestRendererAddEndpoints(t *testing.T) {
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+
+	state := renderer.RouteState([]*routev1.Route{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route"},
+		Spec: routev1.RouteSpec{
+			Host: "www.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}})
+	endpoints := func(name string) *kapi.Endpoints {
+		return &kapi.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name},
+			Subsets: []kapi.EndpointSubset{{
+				Addresses: []kapi.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports: []kapi.EndpointPort{
+					{Port: 8080, Protocol: kapi.ProtocolTCP},
+					{Port: 53, Protocol: kapi.ProtocolUDP},
+				},
+			}},
+		}
+	}
+	renderer.AddEndpoints(state, endpoints("svc"), true, nil)
+	renderer.AddEndpoints(state, endpoints("other"), true, nil)
+
+	if _, ok := state.ServiceUnits["ns/other"]; ok {
+		t.Errorf("expected the endpoints of a service without routes to be ignored")
+	}
+	if table := state.ServiceUnits["ns/svc"].EndpointTable; len(table) != 1 || table[0].IP != "10.0.0.1" || table[0].Port != "8080" {
+		t.Fatalf("expected the TCP endpoint of the service, got %#v", table)
+	}
+
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" && !strings.Contains(string(file.Contents), " 10.0.0.1:8080 ") {
+			t.Errorf("expected a server for the endpoint in:\n%s", file.Contents)
+		}
+	}
+}
+
+// TestRenderCases renders the routes and endpoints of the shared render
+// cases, and checks the sections of the rendered files they expect.
+func TestRenderCases(t *testing.T) {
+	cases, err := routertesting.LoadRenderCases("../testing/testdata/render.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			for name, value := range tc.Env {
+				t.Setenv(name, value)
+			}
+			config := RendererConfig{
+				TemplatePath:        "../../../images/router/haproxy/conf/haproxy-config.template",
+				WorkingDir:          "/var/lib/haproxy",
+				BindPorts:           true,
+				SetForwardedHeaders: tc.Config.SetForwardedHeaders,
+			}
+			if len(tc.Config.ResponseHeaderPolicy) > 0 {
+				policy, err := routeapihelpers.ParseResponseHeaderPolicy(tc.Config.ResponseHeaderPolicy)
+				if err != nil {
+					t.Fatalf("unable to parse the policy: %v", err)
+				}
+				config.ResponseHeaderPolicy = policy
+			}
+			if tc.Config.HTTPCompatOptions != nil {
+				config.HTTPCompatOptions = sets.NewString(tc.Config.HTTPCompatOptions...)
+			}
+			for _, name := range tc.Config.HTTPHeaderNameCaseAdjustments {
+				config.HTTPHeaderNameCaseAdjustments = append(config.HTTPHeaderNameCaseAdjustments, HTTPHeaderNameCaseAdjustment{From: strings.ToLower(name), To: name})
+			}
+			renderer, err := NewRenderer(config)
+			if err != nil {
+				t.Fatalf("unable to create the renderer: %v", err)
+			}
+
+			var routes []*routev1.Route
+			for _, fixture := range tc.Routes {
+				route, err := fixture.Route()
+				if err != nil {
+					t.Fatal(err)
+				}
+				routes = append(routes, route)
+			}
+			state := renderer.RouteState(routes)
+			for _, fixture := range tc.Endpoints {
+				endpoints, err := fixture.Endpoints()
+				if err != nil {
+					t.Fatal(err)
+				}
+				renderer.AddEndpoints(state, endpoints, true, nil)
+			}
+			files, err := renderer.Render(state)
+			if err != nil {
+				t.Fatalf("unable to render: %v", err)
+			}
+			contents := map[string]string{}
+			for _, file := range files {
+				contents[file.Name] = string(file.Contents)
+			}
+			for _, expectation := range tc.Expect {
+				for _, problem := range expectation.Check(contents) {
+					t.Error(problem)
+				}
+			}
+		})
+	}
+}
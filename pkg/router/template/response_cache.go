@@ -0,0 +1,207 @@
+package templaterouter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	templateutil "github.com/openshift/router/pkg/router/template/util"
+)
+
+const (
+	// The columns of the "show stat" output with the lookups of a backend
+	// in its cache and the hits among them.
+	statCacheLookupsField = 86
+	statCacheHitsField    = 87
+)
+
+// allocateResponseCaches returns the routes whose response caches fit in a
+// budget in megabytes, and the routes whose caches do not.  The caches are
+// allocated in the order of the keys of the routes, so that which routes are
+// cached does not depend on the order the router saw them in.  No route is
+// cached without a budget.
+func allocateResponseCaches(routes map[ServiceAliasConfigKey]ServiceAliasConfig, budget int) (map[ServiceAliasConfigKey]bool, []ServiceAliasConfigKey) {
+	if budget <= 0 {
+		return nil, nil
+	}
+	var keys []ServiceAliasConfigKey
+	for key, cfg := range routes {
+		if cfg.ResponseCache.Enabled() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	cached := map[ServiceAliasConfigKey]bool{}
+	var overBudget []ServiceAliasConfigKey
+	for _, key := range keys {
+		size := routes[key].ResponseCache.Size
+		if size > budget {
+			overBudget = append(overBudget, key)
+			continue
+		}
+		budget -= size
+		cached[key] = true
+	}
+	return cached, overBudget
+}
+
+// reportResponseCachesOverBudget logs the routes whose response caches do
+// not fit in the budget of the router when they change.
+func (r *templateRouter) reportResponseCachesOverBudget(overBudget []ServiceAliasConfigKey) {
+	if reflect.DeepEqual(overBudget, r.responseCachesOverBudget) {
+		return
+	}
+	r.responseCachesOverBudget = overBudget
+	if len(overBudget) > 0 {
+		log.V(0).Info("not caching the responses of routes whose caches exceed the response cache budget", "budgetMegabytes", r.responseCacheSize, "routes", overBudget)
+	}
+}
+
+// cacheStats are the lookups in the response cache of a route and the hits
+// among them.
+type cacheStats struct {
+	namespace string
+	name      string
+	lookups   int64
+	hits      int64
+}
+
+// responseCacheCollector exports the sizes of the response caches of the
+// routes and their lookups and hits since haproxy was last reloaded, whose
+// ratio is how much of the traffic of a route the router serves itself.
+type responseCacheCollector struct {
+	router *templateRouter
+	cli    *masterCLI
+
+	sizeDesc       *prometheus.Desc
+	overBudgetDesc *prometheus.Desc
+	lookupsDesc    *prometheus.Desc
+	hitsDesc       *prometheus.Desc
+	hitRatioDesc   *prometheus.Desc
+}
+
+func newResponseCacheCollector(router *templateRouter) *responseCacheCollector {
+	return &responseCacheCollector{
+		router: router,
+		cli:    newMasterCLI(filepath.Join(router.dir, statsSocketFile)),
+		sizeDesc: prometheus.NewDesc(
+			"template_router_response_cache_size_bytes",
+			"The size of the response cache of a route.",
+			[]string{"namespace", "route"}, nil),
+		overBudgetDesc: prometheus.NewDesc(
+			"template_router_response_cache_over_budget_routes",
+			"Number of routes whose response caches do not fit in the response cache budget of the router, and are not cached.",
+			nil, nil),
+		lookupsDesc: prometheus.NewDesc(
+			"template_router_response_cache_lookups_total",
+			"Number of requests of a route looked up in its response cache.",
+			[]string{"namespace", "route"}, nil),
+		hitsDesc: prometheus.NewDesc(
+			"template_router_response_cache_hits_total",
+			"Number of requests of a route served from its response cache.",
+			[]string{"namespace", "route"}, nil),
+		hitRatioDesc: prometheus.NewDesc(
+			"template_router_response_cache_hit_ratio",
+			"The fraction of the lookups in the response cache of a route that hit, since haproxy was last reloaded.",
+			[]string{"namespace", "route"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *responseCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sizeDesc
+	ch <- c.overBudgetDesc
+	ch <- c.lookupsDesc
+	ch <- c.hitsDesc
+	ch <- c.hitRatioDesc
+}
+
+// Collect implements prometheus.Collector.  The lookups and hits are only
+// read from haproxy while a route is cached.
+func (c *responseCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	backends, overBudget := c.router.responseCaches()
+	if c.router.responseCacheSize > 0 {
+		ch <- prometheus.MustNewConstMetric(c.overBudgetDesc, prometheus.GaugeValue, float64(overBudget))
+	}
+	for _, cfg := range backends {
+		ch <- prometheus.MustNewConstMetric(c.sizeDesc, prometheus.GaugeValue, float64(int64(cfg.ResponseCache.Size)<<20), cfg.Namespace, cfg.Name)
+	}
+	if len(backends) == 0 {
+		return
+	}
+
+	out, err := c.cli.execute("show stat")
+	if err == errMasterNotRunning {
+		return
+	}
+	if err != nil {
+		log.Error(err, "failed to read the response cache lookups of the routes")
+		return
+	}
+	stats, err := parseCacheStats(strings.NewReader(out), backends)
+	if err != nil {
+		log.Error(err, "failed to read the response cache lookups of the routes")
+		return
+	}
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(c.lookupsDesc, prometheus.CounterValue, float64(s.lookups), s.namespace, s.name)
+		ch <- prometheus.MustNewConstMetric(c.hitsDesc, prometheus.CounterValue, float64(s.hits), s.namespace, s.name)
+		if s.lookups > 0 {
+			ch <- prometheus.MustNewConstMetric(c.hitRatioDesc, prometheus.GaugeValue, float64(s.hits)/float64(s.lookups), s.namespace, s.name)
+		}
+	}
+}
+
+// responseCaches returns the cached routes keyed by the names of their
+// backends, and the number of routes whose caches exceed the budget.
+func (r *templateRouter) responseCaches() (map[string]ServiceAliasConfig, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	cached, overBudget := allocateResponseCaches(r.state, r.responseCacheSize)
+	backends := map[string]ServiceAliasConfig{}
+	for key := range cached {
+		cfg := r.state[key]
+		backends[fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(cfg.TLSTermination), key)] = cfg
+	}
+	return backends, len(overBudget)
+}
+
+// parseCacheStats returns the lookups and hits of the caches of the backends
+// of the cached routes, from the "show stat" output of haproxy.
+func parseCacheStats(stats io.Reader, backends map[string]ServiceAliasConfig) ([]cacheStats, error) {
+	reader := csv.NewReader(stats)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var result []cacheStats
+	for _, row := range rows {
+		if len(row) <= statCacheHitsField || row[statTypeField] != statBackendType {
+			continue
+		}
+		cfg, ok := backends[row[statProxyNameField]]
+		if !ok {
+			continue
+		}
+		lookups, err := strconv.ParseInt(row[statCacheLookupsField], 10, 64)
+		if err != nil {
+			continue
+		}
+		hits, err := strconv.ParseInt(row[statCacheHitsField], 10, 64)
+		if err != nil {
+			continue
+		}
+		result = append(result, cacheStats{namespace: cfg.Namespace, name: cfg.Name, lookups: lookups, hits: hits})
+	}
+	return result, nil
+}
@@ -0,0 +1,151 @@
+package templaterouter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func TestAllocateResponseCaches(t *testing.T) {
+	cache := func(size int) ServiceAliasConfig {
+		return ServiceAliasConfig{ResponseCache: routeapihelpers.ResponseCache{TTL: time.Minute, Size: size}}
+	}
+	routes := map[ServiceAliasConfigKey]ServiceAliasConfig{
+		"ns:a":     cache(8),
+		"ns:b":     cache(4),
+		"ns:c":     cache(2),
+		"ns:plain": {},
+	}
+	tests := []struct {
+		name               string
+		budget             int
+		expectedCached     map[ServiceAliasConfigKey]bool
+		expectedOverBudget []ServiceAliasConfigKey
+	}{
+		{name: "no budget"},
+		{name: "all fit", budget: 14, expectedCached: map[ServiceAliasConfigKey]bool{"ns:a": true, "ns:b": true, "ns:c": true}},
+		{name: "later routes fill the rest", budget: 10, expectedCached: map[ServiceAliasConfigKey]bool{"ns:a": true, "ns:c": true}, expectedOverBudget: []ServiceAliasConfigKey{"ns:b"}},
+		{name: "none fit", budget: 1, expectedCached: map[ServiceAliasConfigKey]bool{}, expectedOverBudget: []ServiceAliasConfigKey{"ns:a", "ns:b", "ns:c"}},
+	}
+	for _, tc := range tests {
+		cached, overBudget := allocateResponseCaches(routes, tc.budget)
+		if !reflect.DeepEqual(cached, tc.expectedCached) {
+			t.Errorf("%s: expected the cached routes %v, got %v", tc.name, tc.expectedCached, cached)
+		}
+		if !reflect.DeepEqual(overBudget, tc.expectedOverBudget) {
+			t.Errorf("%s: expected the routes over budget %v, got %v", tc.name, tc.expectedOverBudget, overBudget)
+		}
+	}
+}
+
+func TestResponseCacheTemplate(t *testing.T) {
+	route := func(name string, annotations map[string]string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Annotations: annotations},
+			Spec: routev1.RouteSpec{
+				Host: name + ".example.com",
+				To:   routev1.RouteTargetReference{Name: "static"},
+				TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+			},
+		}
+	}
+	routes := []*routev1.Route{
+		route("assets", map[string]string{
+			routeapihelpers.ResponseCacheTTLAnnotation:           "10m",
+			routeapihelpers.ResponseCacheMaxObjectSizeAnnotation: "256k",
+			routeapihelpers.ResponseCacheSizeAnnotation:          "8",
+		}),
+		route("images", map[string]string{routeapihelpers.ResponseCacheTTLAnnotation: "60s"}),
+		route("plain", nil),
+	}
+
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath:      "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:        "/var/lib/haproxy",
+		BindPorts:         true,
+		ResponseCacheSize: 10,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	state := renderer.RouteState(routes)
+	files, err := renderer.Render(state)
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+	var config string
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" {
+			config = string(file.Contents)
+		}
+	}
+
+	// The 8m cache of ns:assets leaves too little of the budget for the 4m
+	// cache of ns:images.
+	assets := state.Routes["ns:assets"].RoutingKeyName
+	section := "\ncache " + assets + "\n  total-max-size 8\n  max-object-size 262144\n  max-age 600\n"
+	if !strings.Contains(config, section) {
+		t.Errorf("expected the cache section %q in:\n%s", section, config)
+	}
+	if strings.Count(config, "\ncache ") != 1 {
+		t.Errorf("expected a single cache section in:\n%s", config)
+	}
+
+	tests := map[string]bool{"assets": true, "images": false, "plain": false}
+	for name, cached := range tests {
+		backend := "backend be_edge_http:ns:" + name + "\n"
+		i := strings.Index(config, backend)
+		if i < 0 {
+			t.Fatalf("%s not found", backend)
+		}
+		section := config[i+1:]
+		if j := strings.Index(section, "\nbackend "); j >= 0 {
+			section = section[:j]
+		}
+		key := state.Routes[ServiceAliasConfigKey("ns:"+name)].RoutingKeyName
+		for _, line := range []string{"filter cache " + key, "http-request cache-use " + key, "http-response cache-store " + key} {
+			if strings.Contains(section, "\n  "+line+"\n") != cached {
+				t.Errorf("%s: expected %q to be present %t in:\n%s", name, line, cached, section)
+			}
+		}
+	}
+}
+
+func TestParseCacheStats(t *testing.T) {
+	row := func(pxname, svname, typ, lookups, hits string) string {
+		fields := make([]string, 95)
+		fields[statProxyNameField], fields[1], fields[statTypeField] = pxname, svname, typ
+		fields[statCacheLookupsField], fields[statCacheHitsField] = lookups, hits
+		return strings.Join(fields, ",")
+	}
+	stats := strings.Join([]string{
+		"# pxname,svname",
+		row("be_edge_http:ns:assets", "pod:a:static:8080-tcp:10.0.0.1:8080", "2", "", ""),
+		row("be_edge_http:ns:assets", "BACKEND", "1", "200", "150"),
+		row("be_http:ns:images", "BACKEND", "1", "0", "0"),
+		row("be_http:ns:other", "BACKEND", "1", "300", "100"),
+		"be_http:ns:short,BACKEND",
+	}, "\n") + "\n"
+	backends := map[string]ServiceAliasConfig{
+		"be_edge_http:ns:assets": {Namespace: "ns", Name: "assets"},
+		"be_http:ns:images":      {Namespace: "ns", Name: "images"},
+		"be_http:ns:short":       {Namespace: "ns", Name: "short"},
+	}
+	result, err := parseCacheStats(strings.NewReader(stats), backends)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []cacheStats{
+		{namespace: "ns", name: "assets", lookups: 200, hits: 150},
+		{namespace: "ns", name: "images", lookups: 0, hits: 0},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("expected %#v, got %#v", expected, result)
+	}
+}
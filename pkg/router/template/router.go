@@ -24,7 +24,11 @@ import (
 	routev1 "github.com/openshift/api/route/v1"
 
 	logf "github.com/openshift/router/log"
+	"github.com/openshift/router/pkg/router/reasons"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+	"github.com/openshift/router/pkg/router/telemetry"
 	"github.com/openshift/router/pkg/router/template/limiter"
+	haproxyutil "github.com/openshift/router/pkg/router/template/util/haproxy"
 )
 
 var log = logf.Logger.WithName("template")
@@ -40,6 +44,20 @@ const (
 
 	whitelistDir = "router/whitelists"
 
+	// ipWhitelistAnnotation restricts the source addresses allowed to
+	// access a route.
+	ipWhitelistAnnotation = routeapihelpers.IPWhitelistAnnotation
+
+	// weightByEndpointsAnnotation, when "true", makes the weight of each
+	// service of a route apply to each of its endpoints, so that the
+	// endpoints of equally weighted services receive the same share of
+	// requests regardless of how many endpoints each service has.
+	weightByEndpointsAnnotation = "haproxy.router.openshift.io/weight-by-endpoints"
+
+	// allowSNIHostMismatchAnnotation, when "true", exempts a route from the
+	// SNI host mismatch policy of the router.
+	allowSNIHostMismatchAnnotation = "haproxy.router.openshift.io/allow-sni-host-mismatch"
+
 	caCertPostfix   = "_ca"
 	destCertPostfix = "_pod"
 
@@ -51,14 +69,27 @@ const (
 
 // templateRouter is a backend-agnostic router implementation
 // that generates configuration files via a set of templates
-// and manages the backend process with a reload script.
+// and manages the backend process with a reload script, or itself when
+// in-process reloads are enabled.
 type templateRouter struct {
 	// the directory to write router output to
 	dir              string
 	templates        map[string]*template.Template
 	reloadScriptPath string
-	reloadFn         func(shutdown bool) error
-	reloadInterval   time.Duration
+	// reloader manages the haproxy processes instead of the reload script
+	// when in-process reloads are enabled.
+	reloader       *haproxyReloader
+	reloadFn       func(shutdown bool) error
+	reloadInterval time.Duration
+	// masterSocketPath, if set, is the haproxy master CLI socket used to
+	// reload haproxy running in master-worker mode.
+	masterSocketPath string
+	// masterWorker is true if haproxy runs in master-worker mode, that is
+	// if masterSocketPath is set.
+	masterWorker bool
+	// workerGeneration counts the haproxy worker generations started by
+	// reloads through the master CLI.
+	workerGeneration int
 	reloadCallbacks  []func()
 	state            map[ServiceAliasConfigKey]ServiceAliasConfig
 	serviceUnits     map[ServiceUnitKey]ServiceUnit
@@ -92,8 +123,26 @@ type templateRouter struct {
 	lock sync.Mutex
 	// If true, haproxy should only bind ports when it has route and endpoint state
 	bindPortsAfterSync bool
+	// If true, the router is a standby router whose public frontends are
+	// disabled until it is promoted.
+	standby bool
+	// If true, the frontends do not offer HTTP/2 to the clients.
+	disableHTTP2 bool
+	// configSnippetDirectives are the directives allowed in route config
+	// snippets.  Snippets are left out of the configuration if it is empty.
+	configSnippetDirectives sets.String
+	// httpCompatOptions are the HTTP/1 compatibility options routes may
+	// set.  Options that are not allowed are left out of the
+	// configuration.
+	httpCompatOptions sets.String
+	// sharedStrings holds the shared copies of the values of the router state.
+	// The router state does not share values if it is nil.
+	sharedStrings *stringStore
 	// whether the router state has been read from the api at least once
 	synced bool
+	// whether the certificate directories have been rebuilt from the
+	// router state since it was first synced
+	certificatesReconciled bool
 	// whether a state change has occurred
 	stateChanged bool
 	// metricReload tracks reloads
@@ -102,6 +151,25 @@ type templateRouter struct {
 	metricReloadFailure prometheus.Gauge
 	// metricWriteConfig tracks writing config
 	metricWriteConfig prometheus.Summary
+	// metricOldWorkers tracks haproxy workers from previous reloads
+	metricOldWorkers prometheus.Gauge
+	// metricReloadVerificationFailures counts the reloads whose new
+	// configuration never became live
+	metricReloadVerificationFailures prometheus.Counter
+	// metricReloadReasons counts reloads by the reasons that triggered them
+	metricReloadReasons *prometheus.CounterVec
+
+	// pendingReloadReasons are the reasons for the next reload, mapped to
+	// the objects that changed for them.
+	pendingReloadReasons map[string]sets.String
+	// reloadHistory are the most recent reloads, oldest first.
+	reloadHistory     []ReloadRecord
+	reloadHistoryLock sync.Mutex
+	// lastCommit is when the configuration was last written from the
+	// synced router state, and lastReload when haproxy last loaded it.
+	// Both are protected by reloadHistoryLock.
+	lastCommit time.Time
+	lastReload time.Time
 	// dynamicConfigManager configures route changes dynamically on the
 	// underlying router.
 	dynamicConfigManager ConfigManager
@@ -119,6 +187,114 @@ type templateRouter struct {
 	captureHTTPCookie *CaptureHTTPCookie
 	// httpHeaderNameCaseAdjustments specifies HTTP header name case adjustments.
 	httpHeaderNameCaseAdjustments []HTTPHeaderNameCaseAdjustment
+	// uriNormalizers are the normalize-uri normalizers applied to every
+	// request before the route is selected.
+	uriNormalizers []string
+	// responseHeaderPolicy are the rules applied to the response headers
+	// of every route the router terminates HTTP for.
+	responseHeaderPolicy []routeapihelpers.ResponseHeaderRule
+	// tlsSession configures the TLS session resumption of the frontends.
+	tlsSession TLSSessionConfig
+	// waf configures the web application firewall agent of the router.
+	waf WAFConfig
+	// responseCacheSize is the size in megabytes the response caches of the
+	// routes may take in total.  Zero if the routes are not cached.
+	responseCacheSize int
+	// maxMapFileEntries is the number of entries above which the maps of
+	// the routes are split into shards.  Zero if the maps are not split.
+	maxMapFileEntries int
+	// transparentProxy connects to the backends from the addresses of the
+	// clients.
+	transparentProxy bool
+	// haproxyCapabilities are the version and build options of haproxy, or
+	// nil if they were not probed.
+	haproxyCapabilities *HAProxyCapabilities
+	// reloadVerificationTimeout is how long a new haproxy process has to
+	// serve the stats socket after a reload.  Zero if the reloads are not
+	// verified.
+	reloadVerificationTimeout time.Duration
+	// responseCachesOverBudget are the routes whose response caches did not
+	// fit in the budget when the configuration was last written.
+	responseCachesOverBudget []ServiceAliasConfigKey
+	// endpointMetadata configures the metadata of the endpoints made
+	// available to the logs and response headers.
+	endpointMetadata EndpointMetadataConfig
+	// reloadState configures the state haproxy keeps across reloads.
+	reloadState ReloadStateConfig
+	// oldWorkers limits how long the processes of previous reloads drain
+	// their connections.
+	oldWorkers OldWorkersConfig
+	// stableServerNames names the servers of the endpoints after slots of
+	// their service rather than after the endpoints.
+	stableServerNames bool
+	// routerTimeouts are the router wide timeouts the timeouts of the
+	// routes default to.
+	routerTimeouts routeapihelpers.RouterTimeouts
+	// clampRouteTimeouts raises the tunnel timeout of the routes whose
+	// timeouts make it shorter than their server timeout.
+	clampRouteTimeouts bool
+	// tuning is the tuning of the haproxy process.
+	tuning HAProxyTuning
+	// mapEntries are the entries added to the maps of the running haproxy
+	// through the runtime API, by map file, saved until they are added to
+	// the new process.  Only the commits, which do not run concurrently,
+	// use them, without holding r.lock.
+	mapEntries map[string][]mapEntry
+	// tlsTicketKeys are the TLS session ticket keys managed by the router,
+	// nil if haproxy manages its own keys.
+	tlsTicketKeys *tlsTicketKeys
+	// certificateConflictPolicy picks the route whose certificate is
+	// presented when routes supply different certificates for the same
+	// server name.
+	certificateConflictPolicy string
+	// certificateConflicts are the certificate conflicts last reported.
+	certificateConflicts map[ServiceAliasConfigKey]CertificateConflict
+	// certificateConflictRecorder, if set, is reported the routes whose
+	// certificates are not presented because of conflicts.
+	certificateConflictRecorder CertificateConflictRecorder
+	// sniHostMismatchPolicy is what happens to TLS requests whose SNI does
+	// not match their Host header, empty to let them through.
+	sniHostMismatchPolicy string
+	// setForwardedHeaders is the policy for the Forwarded and
+	// X-Forwarded-* headers of the routes that do not set their own.
+	setForwardedHeaders string
+	// adaptiveHealthChecks configures how the health check intervals of
+	// backends adapt to their stability.
+	adaptiveHealthChecks AdaptiveHealthCheckConfig
+	// backendStability tracks how long backends have been healthy, nil if
+	// the health check intervals are fixed.
+	backendStability *backendStability
+	// latencyWeights tracks the weights of the servers slowed down for
+	// their response times, nil if the weights are not adjusted.
+	latencyWeights *latencyWeights
+	// leastRequestWeights tracks the weights of the servers lowered for
+	// their outstanding requests.  Nil if the least-request weighting is
+	// disabled.
+	leastRequestWeights *leastRequestWeights
+	// capacity tracks the usage of the generated configuration against
+	// its limits, nil if the configuration is not limited.
+	capacity *capacityTracker
+	// rejectionRecorder is notified of routes that prevent the router
+	// from reloading.
+	rejectionRecorder RejectionRecorder
+	// checkConfigFn overrides how the written configuration is checked.
+	checkConfigFn func() error
+	// pendingChanges are the route changes made since the last successful
+	// reload.
+	pendingChanges map[ServiceAliasConfigKey]pendingRouteChange
+	// rejectedRoutes are routes that were removed from the state because
+	// they prevented the router from reloading.
+	rejectedRoutes map[ServiceAliasConfigKey]rejectedRoute
+	// routeVersions are the resource versions of the routes in the state,
+	// to tell the changes of a periodic resync from route updates.
+	routeVersions map[ServiceAliasConfigKey]string
+	// partitions holds back the route changes of the partitions of hosts
+	// that prevent the router from reloading, nil if the changes are
+	// committed together.
+	partitions *commitPartitions
+	// activation puts the routes in and out of maintenance as their
+	// activation windows open and close, nil if the windows are ignored.
+	activation *activationScheduler
 }
 
 // templateRouterCfg holds all configuration items required to initialize the template router
@@ -126,9 +302,12 @@ type templateRouterCfg struct {
 	dir                           string
 	templates                     map[string]*template.Template
 	reloadScriptPath              string
+	haproxyBinary                 string
+	inProcessReload               bool
 	reloadFn                      func(shutdown bool) error
 	reloadInterval                time.Duration
 	reloadCallbacks               []func()
+	masterSocketPath              string
 	defaultCertificate            string
 	defaultCertificatePath        string
 	defaultCertificateDir         string
@@ -139,11 +318,39 @@ type templateRouterCfg struct {
 	allowWildcardRoutes           bool
 	includeUDP                    bool
 	bindPortsAfterSync            bool
+	standby                       bool
+	configSnippetDirectives       sets.String
+	httpCompatOptions             sets.String
 	dynamicConfigManager          ConfigManager
 	captureHTTPRequestHeaders     []CaptureHTTPHeader
 	captureHTTPResponseHeaders    []CaptureHTTPHeader
 	captureHTTPCookie             *CaptureHTTPCookie
 	httpHeaderNameCaseAdjustments []HTTPHeaderNameCaseAdjustment
+	uriNormalizers                []string
+	responseHeaderPolicy          []routeapihelpers.ResponseHeaderRule
+	tlsSession                    TLSSessionConfig
+	waf                           WAFConfig
+	responseCacheSize             int
+	maxMapFileEntries             int
+	transparentProxy              bool
+	haproxyCapabilities           *HAProxyCapabilities
+	reloadVerificationTimeout     time.Duration
+	endpointMetadata              EndpointMetadataConfig
+	reloadState                   ReloadStateConfig
+	oldWorkers                    OldWorkersConfig
+	stableServerNames             bool
+	routerTimeouts                routeapihelpers.RouterTimeouts
+	clampRouteTimeouts            bool
+	tuning                        HAProxyTuning
+	adaptiveHealthChecks          AdaptiveHealthCheckConfig
+	latencyWeighting              LatencyWeightingConfig
+	leastRequestWeighting         LeastRequestWeightingConfig
+	capacityLimits                CapacityLimits
+	sniHostMismatchPolicy         string
+	certificateConflictPolicy     string
+	setForwardedHeaders           string
+	commitPartitions              int
+	activationWindowInterval      time.Duration
 }
 
 // templateConfig is a subset of the templateRouter information that should be passed to the template for generating
@@ -167,6 +374,8 @@ type templateData struct {
 	StatsPort int
 	// whether the router should bind the default ports
 	BindPorts bool
+	// whether the router is a standby router that must not accept traffic
+	Standby bool
 	// The dynamic configuration manager if "configured".
 	DynamicConfigManager ConfigManager
 	// DisableHTTP2 on the frontend and the backend when set "true"
@@ -183,6 +392,52 @@ type templateData struct {
 	// HTTPHeaderNameCaseAdjustments specifies HTTP header name adjustments
 	// performed on HTTP headers.
 	HTTPHeaderNameCaseAdjustments []HTTPHeaderNameCaseAdjustment
+	// MasterWorker is true if haproxy runs in master-worker mode.
+	MasterWorker bool
+	// URINormalizers are the haproxy normalize-uri normalizers applied to
+	// every request before the route is selected.
+	URINormalizers []string
+	// TLSSession configures the TLS session resumption of the frontends.
+	TLSSession TLSSessionConfig
+	// TLSTicketKeysFile is the TLS session ticket keys file managed by the
+	// router, empty if haproxy manages its own keys.
+	TLSTicketKeysFile string
+	// HealthCheckIntervals are the health check intervals of the backends
+	// that have been stable long enough for their interval to grow.
+	HealthCheckIntervals map[ServiceAliasConfigKey]string
+	// CertificateConflicts are the routes whose certificates are not
+	// presented because other routes supply different certificates for
+	// the same server name.
+	CertificateConflicts map[ServiceAliasConfigKey]CertificateConflict
+	// SNIHostMismatchPolicy is what happens to TLS requests whose SNI does
+	// not match their Host header: "reject", "default-backend", or empty to
+	// let them through.
+	SNIHostMismatchPolicy string
+	// WAF configures the web application firewall agent the requests of
+	// the routes that enable it are sent to.
+	WAF WAFConfig
+	// ResponseCaches are the routes whose responses are cached.
+	ResponseCaches map[ServiceAliasConfigKey]bool
+	// EndpointMetadata configures the metadata of the endpoints that
+	// served requests made available to the logs and response headers.
+	EndpointMetadata EndpointMetadataConfig
+	// ReloadState configures the state haproxy keeps across reloads.
+	ReloadState ReloadStateConfig
+	// OldWorkers limits how long the processes of previous reloads drain
+	// their connections.
+	OldWorkers OldWorkersConfig
+	// Tuning is the tuning of the haproxy process.
+	Tuning HAProxyTuning
+	// TransparentProxy connects to the backends of the routes from the
+	// addresses of the clients.
+	TransparentProxy bool
+	// HAProxyCapabilities are the version and build options of haproxy
+	// the versioned directives are rendered for, or nil if they were not
+	// probed.
+	HAProxyCapabilities *HAProxyCapabilities
+	// MapFiles are the shards of the maps of the routes that were split,
+	// keyed by the name of the map.  Maps that were not split are missing.
+	MapFiles map[string][]string
 }
 
 func newTemplateRouter(cfg templateRouterCfg) (*templateRouter, error) {
@@ -219,7 +474,26 @@ func newTemplateRouter(cfg templateRouterCfg) (*templateRouter, error) {
 		Help:      "Measures the time spent writing out the router configuration to disk in seconds.",
 	})
 	prometheus.MustRegister(metricWriteConfig)
+	metricOldWorkers := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "template_router",
+		Name:      "old_workers",
+		Help:      "Number of HAProxy workers from previous reloads that are still draining connections.",
+	})
+	prometheus.MustRegister(metricOldWorkers)
+	metricReloadVerificationFailures := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "template_router",
+		Name:      "reload_verification_failures_total",
+		Help:      "Number of reloads after which haproxy did not serve the new configuration, and the configuration was rolled back.",
+	})
+	prometheus.MustRegister(metricReloadVerificationFailures)
+	metricReloadReasons := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "template_router",
+		Name:      "reload_reasons_total",
+		Help:      "Number of router reloads by the reason that triggered them. A reload triggered for several reasons is counted once for each.",
+	}, []string{"reason"})
+	prometheus.MustRegister(metricReloadReasons)
 
+	disableHTTP2, _ := strconv.ParseBool(os.Getenv("ROUTER_DISABLE_HTTP2"))
 	router := &templateRouter{
 		dir:                           dir,
 		templates:                     cfg.templates,
@@ -227,6 +501,9 @@ func newTemplateRouter(cfg templateRouterCfg) (*templateRouter, error) {
 		reloadInterval:                cfg.reloadInterval,
 		reloadCallbacks:               cfg.reloadCallbacks,
 		reloadFn:                      cfg.reloadFn,
+		masterSocketPath:              cfg.masterSocketPath,
+		masterWorker:                  len(cfg.masterSocketPath) > 0,
+		disableHTTP2:                  disableHTTP2,
 		state:                         make(map[ServiceAliasConfigKey]ServiceAliasConfig),
 		serviceUnits:                  make(map[ServiceUnitKey]ServiceUnit),
 		certManager:                   certManager,
@@ -239,21 +516,96 @@ func newTemplateRouter(cfg templateRouterCfg) (*templateRouter, error) {
 		statsPort:                     cfg.statsPort,
 		allowWildcardRoutes:           cfg.allowWildcardRoutes,
 		bindPortsAfterSync:            cfg.bindPortsAfterSync,
+		standby:                       cfg.standby,
+		configSnippetDirectives:       cfg.configSnippetDirectives,
+		httpCompatOptions:             cfg.httpCompatOptions,
 		dynamicConfigManager:          cfg.dynamicConfigManager,
 		captureHTTPRequestHeaders:     cfg.captureHTTPRequestHeaders,
 		captureHTTPResponseHeaders:    cfg.captureHTTPResponseHeaders,
 		captureHTTPCookie:             cfg.captureHTTPCookie,
 		httpHeaderNameCaseAdjustments: cfg.httpHeaderNameCaseAdjustments,
+		uriNormalizers:                cfg.uriNormalizers,
+		responseHeaderPolicy:          cfg.responseHeaderPolicy,
+		tlsSession:                    cfg.tlsSession,
+		waf:                           cfg.waf,
+		responseCacheSize:             cfg.responseCacheSize,
+		maxMapFileEntries:             cfg.maxMapFileEntries,
+		transparentProxy:              cfg.transparentProxy,
+		haproxyCapabilities:           cfg.haproxyCapabilities,
+		reloadVerificationTimeout:     cfg.reloadVerificationTimeout,
+		endpointMetadata:              cfg.endpointMetadata,
+		reloadState:                   cfg.reloadState,
+		oldWorkers:                    cfg.oldWorkers,
+		stableServerNames:             cfg.stableServerNames,
+		routerTimeouts:                cfg.routerTimeouts,
+		clampRouteTimeouts:            cfg.clampRouteTimeouts,
+		tuning:                        cfg.tuning,
+		adaptiveHealthChecks:          cfg.adaptiveHealthChecks,
+		sniHostMismatchPolicy:         cfg.sniHostMismatchPolicy,
+		certificateConflictPolicy:     cfg.certificateConflictPolicy,
+		setForwardedHeaders:           cfg.setForwardedHeaders,
+		sharedStrings:                 newStringStore(),
 
 		metricReload:        metricsReload,
 		metricReloadFailure: metricReloadFailure,
 		metricWriteConfig:   metricWriteConfig,
+		metricOldWorkers:    metricOldWorkers,
+		metricReloadReasons: metricReloadReasons,
+
+		metricReloadVerificationFailures: metricReloadVerificationFailures,
 
 		rateLimitedCommitFunction: nil,
 	}
 
 	router.EnableRateLimiter(cfg.reloadInterval, router.commitAndReload)
 
+	router.reloader = inProcessReloader(cfg)
+
+	if cfg.tlsSession.TicketKeyRotationInterval > 0 {
+		keysPath := filepath.Join(dir, tlsTicketKeysFile)
+		socketPath := filepath.Join(dir, statsSocketFile)
+		keys, err := newTLSTicketKeys(keysPath, func(key string) error {
+			return pushTLSTicketKey(socketPath, keysPath, key)
+		})
+		if err != nil {
+			return nil, err
+		}
+		router.tlsTicketKeys = keys
+	}
+
+	if cfg.adaptiveHealthChecks.MaxInterval > 0 {
+		router.backendStability = newBackendStability()
+	}
+
+	if cfg.latencyWeighting.Interval > 0 {
+		router.latencyWeights = newLatencyWeights(cfg.latencyWeighting)
+	}
+
+	if cfg.leastRequestWeighting.Interval > 0 {
+		router.leastRequestWeights = newLeastRequestWeights(cfg.leastRequestWeighting)
+	}
+
+	prometheus.MustRegister(newBandwidthCollector(router))
+	prometheus.MustRegister(newResponseCacheCollector(router))
+
+	if cfg.activationWindowInterval > 0 {
+		router.activation = newActivationScheduler(cfg.activationWindowInterval)
+	}
+
+	if cfg.commitPartitions > 1 {
+		router.partitions = newCommitPartitions(cfg.commitPartitions, cfg.reloadInterval)
+		router.partitions.retry = router.retryHeldChanges
+		prometheus.MustRegister(router.partitions.metricHeld)
+	}
+
+	if cfg.capacityLimits.Enabled() {
+		router.capacity = newCapacityTracker(cfg.capacityLimits)
+		prometheus.MustRegister(router.capacity.metricUsage, router.capacity.metricLimit, router.capacity.metricLevel)
+	}
+
+	if err := removeTempFiles(dir); err != nil {
+		return nil, err
+	}
 	if err := router.writeDefaultCert(); err != nil {
 		return nil, err
 	}
@@ -406,6 +758,9 @@ func (r *templateRouter) writeDefaultCert() error {
 				return
 			}
 			log.V(0).Info("reloading to get updated default certificate")
+			r.lock.Lock()
+			r.recordReloadReason(ReloadReasonCertificateRotated, "default-certificate")
+			r.lock.Unlock()
 			r.rateLimitedCommitFunction.RegisterChange()
 		}
 		if err := r.watchVolumeMountDir(r.defaultCertificateDir, reloadFn); err != nil {
@@ -432,6 +787,9 @@ func (r *templateRouter) watchMutualTLSCert() error {
 	if len(caPath) != 0 {
 		reloadFn := func() {
 			log.V(0).Info("reloading to get updated client CA", "name", caPath)
+			r.lock.Lock()
+			r.recordReloadReason(ReloadReasonCertificateRotated, "client-ca")
+			r.lock.Unlock()
 			r.rateLimitedCommitFunction.RegisterChange()
 		}
 		if err := r.watchVolumeMountDir(filepath.Dir(caPath), reloadFn); err != nil {
@@ -443,6 +801,9 @@ func (r *templateRouter) watchMutualTLSCert() error {
 	if len(crlPath) != 0 && filepath.Dir(caPath) != filepath.Dir(crlPath) {
 		reloadFn := func() {
 			log.V(0).Info("reloading to get updated client CA CRL", "name", crlPath)
+			r.lock.Lock()
+			r.recordReloadReason(ReloadReasonCertificateRotated, "client-ca-crl")
+			r.lock.Unlock()
 			r.rateLimitedCommitFunction.RegisterChange()
 		}
 		if err := r.watchVolumeMountDir(filepath.Dir(crlPath), reloadFn); err != nil {
@@ -465,6 +826,7 @@ func (r *templateRouter) Commit() {
 		r.synced = true
 		r.stateChanged = true
 		r.dynamicallyConfigured = false
+		r.recordReloadReason(ReloadReasonInitialSync, "")
 	}
 
 	needsCommit := r.stateChanged && !r.dynamicallyConfigured
@@ -475,14 +837,87 @@ func (r *templateRouter) Commit() {
 	}
 }
 
+// Rerender writes the certificates of the routes of the router again and
+// reloads it with a newly rendered configuration, e.g. after the files of
+// the router were fixed by hand.  A namespace limits the certificates
+// written to the ones of its routes, and a name to the ones of the route of
+// the namespace with that name.  It returns the number of routes whose
+// certificates are written again.
+func (r *templateRouter) Rerender(namespace, name string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	count := 0
+	for key, cfg := range r.state {
+		if (len(namespace) > 0 && cfg.Namespace != namespace) || (len(name) > 0 && cfg.Name != name) {
+			continue
+		}
+		cfg.Status = ""
+		r.state[key] = cfg
+		r.recordReloadReason(ReloadReasonForced, fmt.Sprintf("route/%s/%s", cfg.Namespace, cfg.Name))
+		count++
+	}
+	if count == 0 && (len(namespace) > 0 || len(name) > 0) {
+		return 0
+	}
+	if count == 0 {
+		r.recordReloadReason(ReloadReasonForced, "")
+	}
+	r.stateChanged = true
+	r.dynamicallyConfigured = false
+	return count
+}
+
+// Promote enables the frontends of a standby router so that it starts
+// accepting traffic.
+func (r *templateRouter) Promote() {
+	r.lock.Lock()
+	if !r.standby {
+		r.lock.Unlock()
+		return
+	}
+	log.V(0).Info("promoting standby router")
+	r.standby = false
+	r.stateChanged = true
+	r.recordReloadReason(ReloadReasonPromotion, "")
+	r.dynamicallyConfigured = false
+	// the initial sync commits the promotion if it did not complete yet.
+	synced := r.synced
+	r.lock.Unlock()
+
+	if synced {
+		r.rateLimitedCommitFunction.RegisterChange()
+	}
+}
+
 // commitAndReload refreshes the backend and persists the router state.
 func (r *templateRouter) commitAndReload() error {
+	var changes map[ServiceAliasConfigKey]pendingRouteChange
+	var reasons []ReloadReason
+	var capacityRejections []capacityRejection
+	var capacityRequeued []*routev1.Route
+	var recorder RejectionRecorder
+	var requeue func(namespace, name string)
+
+	// The map entries are read from the running haproxy through its socket
+	// before the lock is taken and the map files are written.
+	if r.reloadState.MapEntries {
+		if err := r.saveMapEntries(); err != nil {
+			log.Error(err, "unable to save the map entries added through the runtime API, the new haproxy process starts without them")
+		}
+	}
+
 	// only state changes must be done under the lock
 	if err := func() error {
 		r.lock.Lock()
 		defer r.lock.Unlock()
 
 		r.stateChanged = false
+		changes = r.takePendingChanges()
+		r.holdPartitionChanges(changes)
+		if r.sharedStrings.needsPrune(len(r.state)) {
+			r.pruneStrings()
+		}
 		if r.dynamicConfigManager != nil {
 			r.dynamicallyConfigured = true
 			r.dynamicConfigManager.Notify(RouterEventReloadStart)
@@ -490,24 +925,63 @@ func (r *templateRouter) commitAndReload() error {
 
 		log.V(4).Info("writing the router config")
 		reloadStart := time.Now()
-		err := r.writeConfig()
+		span := telemetry.StartWriteConfig()
+		err := r.writeCommittedConfig()
+		span.End(err)
 		r.metricWriteConfig.Observe(float64(time.Now().Sub(reloadStart)) / float64(time.Second))
 		log.V(4).Info("writeConfig", "duration", time.Now().Sub(reloadStart).String())
+		if err == nil && r.capacity != nil {
+			capacityRejections, capacityRequeued, err = r.enforceCapacity(changes)
+			recorder, requeue = r.rejectionRecorder, r.capacity.requeue
+		}
+		if err == nil {
+			reasons = r.takeReloadReasons()
+			if r.synced {
+				r.recordCommit(time.Now())
+			}
+		}
 		return err
 	}(); err != nil {
+		recordCapacityRejections(recorder, capacityRejections, nil, nil)
 		return err
 	}
+	recordCapacityRejections(recorder, capacityRejections, requeue, capacityRequeued)
 
 	for i, fn := range r.reloadCallbacks {
 		log.V(4).Info("calling reload function", "fn", i)
 		fn()
 	}
 
+	if r.reloadState.ServerState {
+		if err := r.saveServerState(); err != nil {
+			log.Error(err, "unable to save the server state, the servers of the new haproxy process start from their configured state")
+		}
+	}
+
 	log.V(4).Info("reloading the router")
 	reloadStart := time.Now()
+	span := telemetry.StartReload(reloadReasonNames(reasons))
+	serving := r.servingHAProxy()
 	err := r.reloadRouter(false)
+	if err == nil {
+		err = r.verifyReload(serving)
+	}
+	span.End(err)
 	r.metricReload.Observe(float64(time.Now().Sub(reloadStart)) / float64(time.Second))
+	r.recordReload(reloadStart, reasons, err)
 	if err != nil {
+		// Find the routes that broke the configuration, reject them and
+		// commit the remaining state.
+		r.restorePendingChanges(changes)
+		if r.holdBrokenPartitions() {
+			log.V(0).Info("router failed to reload, retrying without the held back route changes", "error", err.Error())
+			return r.commitAndReload()
+		}
+		if r.rejectBrokenRoutes() {
+			log.V(0).Info("router failed to reload, retrying without the rejected routes", "error", err.Error())
+			return r.commitAndReload()
+		}
+
 		if r.dynamicConfigManager != nil {
 			r.dynamicConfigManager.Notify(RouterEventReloadError)
 		}
@@ -519,6 +993,22 @@ func (r *templateRouter) commitAndReload() error {
 	// Set the metricReloadFailure metric to false when a reload succeeds.
 	r.metricReloadFailure.Set(float64(0))
 
+	r.lock.Lock()
+	r.reportCertificateConflicts()
+	r.lock.Unlock()
+
+	if r.reloadState.MapEntries {
+		if err := r.restoreMapEntries(); err != nil {
+			log.Error(err, "unable to restore the map entries added through the runtime API")
+		}
+	}
+
+	if r.partitions != nil {
+		r.lock.Lock()
+		r.partitions.release()
+		r.lock.Unlock()
+	}
+
 	if r.dynamicConfigManager != nil {
 		r.dynamicConfigManager.Notify(RouterEventReloadEnd)
 	}
@@ -526,8 +1016,66 @@ func (r *templateRouter) commitAndReload() error {
 	return nil
 }
 
+// pruneStrings drops the shared values no longer used by the router state.
+// Must be called while holding r.lock
+func (r *templateRouter) pruneStrings() {
+	r.sharedStrings.prune(func(keep func(string)) {
+		for _, cfg := range r.state {
+			cfg := cfg // avoid implicit memory aliasing (gosec G601)
+			markConfig(&cfg, keep)
+		}
+	})
+}
+
+// InternRoute replaces the values of a route that are commonly shared
+// between routes, such as the certificates of a wildcard certificate, with
+// the copies held by the router state.  It is safe to call concurrently with
+// the other methods of the router.
+func (r *templateRouter) InternRoute(route *routev1.Route) {
+	r.sharedStrings.internRoute(route)
+}
+
 // writeConfig writes the config to disk
 // Must be called while holding r.lock
+// templateData returns the data the template is rendered with for the routes
+// of state, with the settings of the router.  The Renderer renders the
+// template with it too, from a router with its own settings.
+func (r *templateRouter) templateData(state map[ServiceAliasConfigKey]ServiceAliasConfig, healthCheckIntervals map[ServiceAliasConfigKey]string, responseCaches map[ServiceAliasConfigKey]bool) templateData {
+	return templateData{
+		WorkingDir:                    r.dir,
+		State:                         state,
+		ServiceUnits:                  r.serviceUnits,
+		DefaultCertificate:            r.defaultCertificatePath,
+		DefaultDestinationCA:          r.defaultDestinationCAPath,
+		StatsUser:                     r.statsUser,
+		StatsPassword:                 r.statsPassword,
+		StatsPort:                     r.statsPort,
+		BindPorts:                     !r.bindPortsAfterSync || r.synced,
+		Standby:                       r.standby,
+		DynamicConfigManager:          r.dynamicConfigManager,
+		DisableHTTP2:                  r.disableHTTP2,
+		CaptureHTTPRequestHeaders:     r.captureHTTPRequestHeaders,
+		CaptureHTTPResponseHeaders:    r.captureHTTPResponseHeaders,
+		CaptureHTTPCookie:             r.captureHTTPCookie,
+		HTTPHeaderNameCaseAdjustments: r.httpHeaderNameCaseAdjustments,
+		URINormalizers:                r.uriNormalizers,
+		TLSSession:                    r.tlsSession,
+		TLSTicketKeysFile:             r.tlsTicketKeysFile(),
+		HealthCheckIntervals:          healthCheckIntervals,
+		SNIHostMismatchPolicy:         r.sniHostMismatchPolicy,
+		CertificateConflicts:          findCertificateConflicts(state, r.dir, r.certificateConflictPolicy),
+		WAF:                           r.waf,
+		ResponseCaches:                responseCaches,
+		EndpointMetadata:              r.endpointMetadata,
+		ReloadState:                   r.reloadState,
+		OldWorkers:                    r.oldWorkers,
+		Tuning:                        r.tuning,
+		TransparentProxy:              r.transparentProxy,
+		HAProxyCapabilities:           r.haproxyCapabilities,
+		MasterWorker:                  r.masterWorker,
+	}
+}
+
 func (r *templateRouter) writeConfig() error {
 	//write out any certificate files that don't exist
 	for k, cfg := range r.state {
@@ -538,15 +1086,23 @@ func (r *templateRouter) writeConfig() error {
 
 		// calculate the server weight for the endpoints in each service
 		// called here to make sure we have the actual number of endpoints.
-		cfg.ServiceUnitNames = r.calculateServiceWeights(cfg.ServiceUnits)
+		cfg.ServiceUnitNames = r.calculateServiceWeights(cfg.ServiceUnits, cfg.WeightByEndpoints)
 
 		// Calculate the number of active endpoints for the route.
 		cfg.ActiveEndpoints = r.getActiveEndpoints(cfg.ServiceUnits)
+		cfg.GRPC = r.isGRPC(&cfg)
 
 		cfg.Status = ServiceAliasConfigStatusSaved
 		r.state[k] = cfg
 	}
 
+	if r.synced && !r.certificatesReconciled {
+		log.V(4).Info("rebuilding the certificate directories from the router state")
+		if err := r.reconcileCertificates(); err != nil {
+			return fmt.Errorf("error rebuilding the certificate directories: %v", err)
+		}
+	}
+
 	log.V(4).Info("committing router certificate manager changes...")
 	if err := r.certManager.Commit(); err != nil {
 		return fmt.Errorf("error committing certificate changes: %v", err)
@@ -554,9 +1110,28 @@ func (r *templateRouter) writeConfig() error {
 
 	log.V(4).Info("router certificate manager config committed")
 
-	disableHTTP2, _ := strconv.ParseBool(os.Getenv("ROUTER_DISABLE_HTTP2"))
+	findRedirectHostLoops(r.state)
+
+	responseCaches, overBudget := allocateResponseCaches(r.state, r.responseCacheSize)
+	r.reportResponseCachesOverBudget(overBudget)
+	data := r.templateData(r.state, r.healthCheckIntervals(), responseCaches)
+
+	mapShards, err := renderMapShards(r.templates, &data, r.maxMapFileEntries)
+	if err != nil {
+		return err
+	}
+	if err := writeMapShards(r.dir, mapShards); err != nil {
+		return err
+	}
+	shards := sets.NewString()
+	for _, file := range mapShards {
+		shards.Insert(file.Name)
+	}
 
 	for name, template := range r.templates {
+		if shards.Has(name) {
+			continue
+		}
 		filename := filepath.Join(r.dir, name)
 		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
 			return fmt.Errorf("error creating path %q: %v", filepath.Dir(filename), err)
@@ -566,23 +1141,6 @@ func (r *templateRouter) writeConfig() error {
 			return fmt.Errorf("error creating config file %s: %v", filename, err)
 		}
 
-		data := templateData{
-			WorkingDir:                    r.dir,
-			State:                         r.state,
-			ServiceUnits:                  r.serviceUnits,
-			DefaultCertificate:            r.defaultCertificatePath,
-			DefaultDestinationCA:          r.defaultDestinationCAPath,
-			StatsUser:                     r.statsUser,
-			StatsPassword:                 r.statsPassword,
-			StatsPort:                     r.statsPort,
-			BindPorts:                     !r.bindPortsAfterSync || r.synced,
-			DynamicConfigManager:          r.dynamicConfigManager,
-			DisableHTTP2:                  disableHTTP2,
-			CaptureHTTPRequestHeaders:     r.captureHTTPRequestHeaders,
-			CaptureHTTPResponseHeaders:    r.captureHTTPResponseHeaders,
-			CaptureHTTPCookie:             r.captureHTTPCookie,
-			HTTPHeaderNameCaseAdjustments: r.httpHeaderNameCaseAdjustments,
-		}
 		if err := template.Execute(file, data); err != nil {
 			file.Close()
 			return fmt.Errorf("error executing template for file %s: %v", filename, err)
@@ -607,9 +1165,23 @@ func (r *templateRouter) reloadRouter(shutdown bool) error {
 	if r.reloadFn != nil {
 		return r.reloadFn(shutdown)
 	}
+	if len(r.masterSocketPath) > 0 && !shutdown {
+		// The reload script is only needed to start the haproxy master.
+		if err := r.reloadMasterWorker(); err != errMasterNotRunning {
+			return err
+		}
+		log.V(0).Info("haproxy master is not running, starting it", "socket", r.masterSocketPath)
+	}
+	if r.reloader != nil {
+		return r.reloader.reload(shutdown)
+	}
 	cmd := exec.Command(r.reloadScriptPath)
+	cmd.Env = os.Environ()
+	if len(r.masterSocketPath) > 0 {
+		cmd.Env = append(cmd.Env, "HAPROXY_MASTER_SOCKET="+r.masterSocketPath)
+	}
 	if shutdown {
-		cmd.Env = append(os.Environ(), "ROUTER_SHUTDOWN=true")
+		cmd.Env = append(cmd.Env, "ROUTER_SHUTDOWN=true")
 	}
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -619,39 +1191,91 @@ func (r *templateRouter) reloadRouter(shutdown bool) error {
 	return nil
 }
 
+// FilterNamespaces removes the routes and service units of the namespaces
+// that are no longer in namespaces.  Only the namespaces the router has
+// state for are removed, so filtering with an unchanged or growing set does
+// not change the config, and the routes of all the removed namespaces are
+// removed with a single reload on the next commit.
 func (r *templateRouter) FilterNamespaces(namespaces sets.String) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	if len(namespaces) == 0 {
-		r.state = make(map[ServiceAliasConfigKey]ServiceAliasConfig)
-		r.serviceUnits = make(map[ServiceUnitKey]ServiceUnit)
-		r.stateChanged = true
+	removed := r.removedNamespaces(namespaces)
+	if len(removed) == 0 {
+		return
 	}
+	log.V(4).Info("removing the routes and services of namespaces", "namespaces", removed.List())
+
+	// The removal of the namespaces is recorded as a single reload reason
+	// rather than one per route and service.
+	changed := false
 	for key, service := range r.serviceUnits {
 		// TODO: the id of a service unit should be defined inside this class, not passed in from the outside
 		//   remove the leak of the abstraction when we refactor this code
 		ns, _ := getPartsFromEndpointsKey(key)
-		if namespaces.Has(ns) {
+		if !removed.Has(ns) {
 			continue
 		}
-		r.deleteServiceUnitInternal(key, service)
+		delete(r.serviceUnits, key)
+		changed = changed || len(service.ServiceAliasAssociations) > 0
 	}
-
-	for k := range r.state {
+	for k, cfg := range r.state {
 		ns, _ := getPartsFromRouteKey(k)
-		if namespaces.Has(ns) {
+		if !removed.Has(ns) {
 			continue
 		}
+		r.cleanUpServiceAliasConfig(&cfg)
 		delete(r.state, k)
-		r.stateChanged = true
+		changed = true
+	}
+	for k := range r.pendingChanges {
+		if ns, _ := getPartsFromRouteKey(k); removed.Has(ns) {
+			delete(r.pendingChanges, k)
+		}
+	}
+	for k := range r.rejectedRoutes {
+		if ns, _ := getPartsFromRouteKey(k); removed.Has(ns) {
+			delete(r.rejectedRoutes, k)
+		}
 	}
 
-	if r.stateChanged {
+	if changed {
+		for _, ns := range removed.List() {
+			r.recordReloadReason(ReloadReasonNamespaces, "namespace/"+ns)
+		}
+		r.stateChanged = true
 		r.dynamicallyConfigured = false
 	}
 }
 
+// removedNamespaces returns the namespaces the router has routes or service
+// units for that are not in namespaces.
+// Must be called while holding r.lock
+func (r *templateRouter) removedNamespaces(namespaces sets.String) sets.String {
+	removed := sets.NewString()
+	for key := range r.serviceUnits {
+		if ns, _ := getPartsFromEndpointsKey(key); !namespaces.Has(ns) {
+			removed.Insert(ns)
+		}
+	}
+	for k := range r.state {
+		if ns, _ := getPartsFromRouteKey(k); !namespaces.Has(ns) {
+			removed.Insert(ns)
+		}
+	}
+	for k := range r.pendingChanges {
+		if ns, _ := getPartsFromRouteKey(k); !namespaces.Has(ns) {
+			removed.Insert(ns)
+		}
+	}
+	for k := range r.rejectedRoutes {
+		if ns, _ := getPartsFromRouteKey(k); !namespaces.Has(ns) {
+			removed.Insert(ns)
+		}
+	}
+	return removed
+}
+
 // CreateServiceUnit creates a new service named with the given id.
 func (r *templateRouter) CreateServiceUnit(id ServiceUnitKey) {
 	r.lock.Lock()
@@ -711,6 +1335,7 @@ func (r *templateRouter) deleteServiceUnitInternal(id ServiceUnitKey, service Se
 	delete(r.serviceUnits, id)
 	if len(service.ServiceAliasAssociations) > 0 {
 		r.stateChanged = true
+		r.recordReloadReason(ReloadReasonEndpoints, reloadObjectEndpoints(id))
 	}
 }
 
@@ -738,6 +1363,27 @@ func (r *templateRouter) dynamicallyAddRoute(backendKey ServiceAliasConfigKey, r
 		return false
 	}
 
+	// TCP routes need a frontend of their own, which requires a reload.
+	if backend.TCPPort != 0 {
+		return false
+	}
+
+	// The dynamic servers are not backup servers.
+	if len(backend.BackupService) > 0 {
+		return false
+	}
+
+	// The dynamic servers belong to neither color.
+	if len(backend.ActiveColor) > 0 {
+		return false
+	}
+
+	// The redirect to the canonical host is written in the backend, and
+	// the loops it makes are only found when the configuration is written.
+	if len(backend.RedirectHost.Host) > 0 {
+		return false
+	}
+
 	log.V(4).Info("dynamically adding route backend", "backendKey", backendKey)
 	r.dynamicConfigManager.Register(backendKey, route)
 
@@ -757,9 +1403,13 @@ func (r *templateRouter) dynamicallyAddRoute(backendKey ServiceAliasConfigKey, r
 	oldEndpoints := []Endpoint{}
 
 	// As the endpoints have changed, recalculate the weights.
-	newWeights := r.calculateServiceWeights(backend.ServiceUnits)
+	newWeights := r.calculateServiceWeights(backend.ServiceUnits, backend.WeightByEndpoints)
 	for key := range backend.ServiceUnits {
 		if service, ok := r.findMatchingServiceUnit(key); ok {
+			if hasBackupEndpoints(service.EndpointTable) {
+				// The dynamic servers are not backup servers.
+				return false
+			}
 			newEndpoints := endpointsForAlias(*backend, service)
 			log.V(4).Info("for new route backend, replacing endpoints for service", "backendKey", backendKey, "serviceKey", key, "newEndpoints", newEndpoints)
 
@@ -775,6 +1425,10 @@ func (r *templateRouter) dynamicallyAddRoute(backendKey ServiceAliasConfigKey, r
 		}
 	}
 
+	if !r.dynamicallyAddCertificate(backendKey, backend) {
+		return false
+	}
+
 	log.V(4).Info("dynamically added route backend", "backendKey", backendKey)
 	return true
 }
@@ -782,7 +1436,7 @@ func (r *templateRouter) dynamicallyAddRoute(backendKey ServiceAliasConfigKey, r
 // dynamicallyRemoveRoute attempts to dynamically remove a route.
 // Note: The config should have been synced at least once initially and
 // the caller needs to acquire a lock [and release it].
-func (r *templateRouter) dynamicallyRemoveRoute(backendKey ServiceAliasConfigKey, route *routev1.Route) bool {
+func (r *templateRouter) dynamicallyRemoveRoute(backendKey ServiceAliasConfigKey, route *routev1.Route, backend *ServiceAliasConfig) bool {
 	if r.dynamicConfigManager == nil || !r.synced {
 		return false
 	}
@@ -794,7 +1448,17 @@ func (r *templateRouter) dynamicallyRemoveRoute(backendKey ServiceAliasConfigKey
 		return false
 	}
 
-	return true
+	return r.dynamicallyRemoveCertificate(backendKey, backend)
+}
+
+// hasBackupEndpoints returns whether any of endpoints is a backup server.
+func hasBackupEndpoints(endpoints []Endpoint) bool {
+	for _, ep := range endpoints {
+		if ep.Backup {
+			return true
+		}
+	}
+	return false
 }
 
 // dynamicallyReplaceEndpoints attempts to dynamically replace endpoints
@@ -815,11 +1479,19 @@ func (r *templateRouter) dynamicallyReplaceEndpoints(id ServiceUnitKey, service
 			log.V(4).Info("associated service alias not found in state, ignoring ...", "serviceAlias", backendKey)
 			continue
 		}
+		if len(cfg.BackupService) > 0 || hasBackupEndpoints(service.EndpointTable) || hasBackupEndpoints(oldEndpoints) {
+			// The dynamic servers are not backup servers.
+			return false
+		}
+		if len(cfg.ActiveColor) > 0 {
+			// The dynamic servers belong to neither color.
+			return false
+		}
 
 		newEndpoints := endpointsForAlias(cfg, service)
 
 		// As the endpoints have changed, recalculate the weights.
-		newWeights := r.calculateServiceWeights(cfg.ServiceUnits)
+		newWeights := r.calculateServiceWeights(cfg.ServiceUnits, cfg.WeightByEndpoints)
 
 		// Get the weight for this service unit.
 		weight, ok := newWeights[id]
@@ -882,6 +1554,9 @@ func (r *templateRouter) DeleteEndpoints(id ServiceUnitKey) {
 
 	if len(service.ServiceAliasAssociations) > 0 {
 		r.stateChanged = true
+		if !configChanged {
+			r.recordReloadReason(ReloadReasonEndpoints, reloadObjectEndpoints(id))
+		}
 	}
 	r.dynamicallyConfigured = r.dynamicallyConfigured && configChanged
 }
@@ -926,6 +1601,7 @@ func (r *templateRouter) createServiceAliasConfig(route *routev1.Route, backendK
 	config := ServiceAliasConfig{
 		Name:               route.Name,
 		Namespace:          route.Namespace,
+		CreationTimestamp:  route.CreationTimestamp.Time,
 		Host:               route.Spec.Host,
 		Path:               route.Spec.Path,
 		IsWildcard:         wildcard,
@@ -938,12 +1614,218 @@ func (r *templateRouter) createServiceAliasConfig(route *routev1.Route, backendK
 		config.PreferPort = route.Spec.Port.TargetPort.String()
 	}
 
+	// haproxy matches the punycode form of internationalized host names,
+	// which is what clients send.  The route keeps its original host.
+	if host, err := routeapihelpers.ASCIIHost(route.Spec.Host); err != nil {
+		log.V(0).Info("invalid internationalized host name", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
+	} else {
+		config.Host = host
+	}
+
+	if host, err := routeapihelpers.BackendHostHeader(route); err != nil {
+		log.V(0).Info("ignoring invalid host rewrite", "namespace", route.Namespace, "name", route.Name, "error", err.Error())
+	} else {
+		config.BackendHostHeader = host
+	}
+
+	config.TCPPort = routeapihelpers.AllocatedTCPPort(route)
+
+	if r.activation != nil {
+		config.Maintenance = r.activation.inMaintenance(route.Annotations)
+	}
+
+	if options, errs := routeapihelpers.GetBackendTCPOptions(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid backend TCP options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.TCPOptions = options
+	}
+
+	if r.clampRouteTimeouts {
+		if server, ok := routeapihelpers.ClampRouteTunnelTimeout(route, r.routerTimeouts); ok {
+			log.V(0).Info("raising the tunnel timeout of a route to its server timeout", "namespace", route.Namespace, "name", route.Name, "timeout", server.String())
+			config.TunnelTimeout = routeapihelpers.FormatHAProxyTimeout(server)
+		}
+	}
+
+	if options, errs := routeapihelpers.GetConnectionPoolOptions(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid connection pool options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.ConnectionPool = options
+	}
+
+	if options, errs := routeapihelpers.GetHTTPCompatOptions(route, r.httpCompatOptions); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid HTTP compatibility options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.HTTPCompat = options
+	}
+
+	if policy, errs := routeapihelpers.GetSetForwardedHeaders(route, r.setForwardedHeaders); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid set-forwarded-headers policy", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+		config.SetForwardedHeaders = r.setForwardedHeaders
+	} else {
+		config.SetForwardedHeaders = policy
+	}
+
+	if protocols, errs := routeapihelpers.GetALPNProtocols(route, routeapihelpers.AllowedALPNProtocols(r.disableHTTP2)); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid ALPN protocols", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.ALPNProtocols = protocols
+	}
+
+	if options, errs := routeapihelpers.GetQueueOptions(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid queue options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.Queue = options
+	}
+
+	if limits, errs := routeapihelpers.GetBandwidthLimits(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid bandwidth limits", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.Bandwidth = limits
+	}
+
+	if cache, errs := routeapihelpers.GetResponseCache(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid response cache", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.ResponseCache = cache
+	}
+
+	if hash, errs := routeapihelpers.GetConsistentHash(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid consistent hash", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.ConsistentHash = hash
+	}
+
+	if accessLog, errs := routeapihelpers.GetAccessLog(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid access log mode", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.AccessLog = accessLog
+	}
+
+	if value, ok := route.Annotations[weightByEndpointsAnnotation]; ok {
+		if byEndpoints, err := strconv.ParseBool(value); err != nil {
+			log.V(0).Info("ignoring invalid weight by endpoints", "namespace", route.Namespace, "name", route.Name, "value", value)
+		} else {
+			config.WeightByEndpoints = byEndpoints
+		}
+	}
+
+	if value, ok := route.Annotations[allowSNIHostMismatchAnnotation]; ok {
+		if allow, err := strconv.ParseBool(value); err != nil {
+			log.V(0).Info("ignoring invalid SNI host mismatch exemption", "namespace", route.Namespace, "name", route.Name, "value", value)
+		} else {
+			config.AllowSNIHostMismatch = allow
+		}
+	}
+
+	if tracing, errs := routeapihelpers.GetTracingOptions(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid tracing options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.Tracing = tracing
+	}
+
+	if normalizers, errs := routeapihelpers.GetURINormalizers(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid URI normalizers", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.URINormalizers = normalizers
+	}
+
+	if options, errs := routeapihelpers.GetExternalServerOptions(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid external server options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.ExternalServers = options
+	}
+
+	if rules, errs := routeapihelpers.GetDenyRules(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid deny rules", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.DenyRules = rules
+		config.URINormalizers = routeapihelpers.DenyRuleURINormalizers(config.URINormalizers, rules)
+	}
+
+	if rules, errs := routeapihelpers.GetRedirectRules(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid redirect rules", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.RedirectRules = rules
+	}
+
+	if redirect, errs := routeapihelpers.GetRedirectHost(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid redirect host", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.RedirectHost = redirect
+	}
+
+	if grpc, errs := routeapihelpers.GetGRPC(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid gRPC option", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.GRPCOverride = grpc
+	}
+
+	if name, errs := routeapihelpers.GetBackupService(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid backup service", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else if len(name) > 0 {
+		config.BackupService = endpointsKeyFromParts(route.Namespace, name)
+	}
+
+	if blueGreen, errs := routeapihelpers.GetBlueGreen(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid blue/green services", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else if blueGreen.Enabled() {
+		config.ActiveColor = blueGreen.Active
+		config.GreenServiceUnits = make(map[ServiceUnitKey]bool, len(blueGreen.Green))
+		for _, name := range blueGreen.Green {
+			config.GreenServiceUnits[endpointsKeyFromParts(route.Namespace, name)] = true
+		}
+	}
+
+	// The default attributes are returned with the errors.
+	cookie, errs := routeapihelpers.GetCookieOptions(route)
+	if len(errs) > 0 {
+		log.V(0).Info("ignoring invalid cookie attributes", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	}
+	config.Cookie = cookie
+
+	if enabled, errs := routeapihelpers.GetLeastRequestWeighting(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid least-request weighting option", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		// The option has no effect on routers without the weighting.
+		config.LeastRequestWeighting = enabled && r.leastRequestWeights != nil
+	}
+
+	if enabled, errs := routeapihelpers.GetWAF(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid web application firewall option", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		// The option has no effect on routers without an agent.
+		config.WAF = enabled && len(r.waf.AgentAddress) > 0
+	}
+
+	// The router does not see the responses of passthrough and TCP routes.
+	if config.TCPPort == 0 && (route.Spec.TLS == nil || route.Spec.TLS.Termination != routev1.TLSTerminationPassthrough) {
+		rules, errs := routeapihelpers.GetResponseHeaderPolicy(route)
+		if len(errs) > 0 {
+			log.V(0).Info("ignoring invalid response header policy", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+		}
+		config.ResponseHeaderRules = routeapihelpers.MergeResponseHeaderPolicies(r.responseHeaderPolicy, rules)
+	}
+
+	if interval, errs := routeapihelpers.GetHealthCheckMaxInterval(route); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid maximum health check interval", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.HealthCheckMaxInterval = interval
+	}
+
+	if errs := routeapihelpers.ValidateConfigSnippet(route, r.configSnippetDirectives); len(errs) > 0 {
+		log.V(0).Info("ignoring invalid config snippet", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+	} else {
+		config.ConfigSnippet = routeapihelpers.ConfigSnippetLines(route)
+	}
+
 	key := fmt.Sprintf("%s %s", config.TLSTermination, backendKey)
 	config.RoutingKeyName = fmt.Sprintf("%x", md5.Sum([]byte(key)))
 
 	tls := route.Spec.TLS
 	if tls != nil && len(tls.Termination) > 0 {
 		config.TLSTermination = tls.Termination
+		destinationCACertificate := tls.DestinationCACertificate
 
 		config.InsecureEdgeTerminationPolicy = tls.InsecureEdgeTerminationPolicy
 
@@ -951,6 +1833,20 @@ func (r *templateRouter) createServiceAliasConfig(route *routev1.Route, backendK
 			config.VerifyServiceHostname = true
 		}
 
+		if tls.Termination == routev1.TLSTerminationReencrypt {
+			if options, errs := routeapihelpers.GetBackendTLSOptions(route); len(errs) > 0 {
+				log.V(0).Info("ignoring invalid backend TLS options", "namespace", route.Namespace, "name", route.Name, "error", errs.ToAggregate().Error())
+			} else {
+				config.DestinationVerifyHostname = options.VerifyHostname
+				config.DestinationMinTLSVersion = options.MinVersion
+				// The backend certificate is only verified against the
+				// pinned certificates of the destination CA.
+				if len(options.PinnedCACertificate) > 0 {
+					destinationCACertificate = options.PinnedCACertificate
+				}
+			}
+		}
+
 		if tls.Termination != routev1.TLSTerminationPassthrough {
 			config.Certificates = make(map[string]Certificate)
 
@@ -975,11 +1871,11 @@ func (r *templateRouter) createServiceAliasConfig(route *routev1.Route, backendK
 				config.Certificates[caCertKey] = caCert
 			}
 
-			if len(tls.DestinationCACertificate) > 0 {
+			if len(destinationCACertificate) > 0 {
 				destCertKey := generateDestCertKey(&config)
 				destCert := Certificate{
 					ID:       string(backendKey),
-					Contents: tls.DestinationCACertificate,
+					Contents: destinationCACertificate,
 				}
 
 				config.Certificates[destCertKey] = destCert
@@ -997,20 +1893,59 @@ func (r *templateRouter) AddRoute(route *routev1.Route) {
 
 	newConfig := r.createServiceAliasConfig(route, backendKey)
 
+	// A rejection for capacity is recorded once the lock is released.
+	var capacityRejections []capacityRejection
+	var recorder RejectionRecorder
+	defer func() { recordCapacityRejections(recorder, capacityRejections, nil, nil) }()
+
+	if rejected, message, recorder := r.isRejected(backendKey, newConfig); rejected {
+		log.V(4).Info("route was rejected and has not changed", "namespace", route.Namespace, "name", route.Name)
+		if recorder != nil {
+			recorder.RecordRouteRejection(route, reasons.InvalidConfiguration, message)
+		}
+		return
+	}
+
 	// We have to call the internal form of functions after this
 	// because we are holding the state lock.
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
+	r.sharedStrings.internConfig(newConfig)
+
+	// The reason is only recorded if the change is not applied
+	// dynamically, when it requires a reload.
+	var reason string
+	removedDynamically := true
 	if existingConfig, exists := r.state[backendKey]; exists {
 		if configsAreEqual(newConfig, &existingConfig) {
 			return
 		}
 
+		if r.dynamicallySwitchColor(backendKey, newConfig, &existingConfig) {
+			log.V(4).Info("dynamically switched route active color", "namespace", route.Namespace, "name", route.Name, "color", newConfig.ActiveColor)
+			r.recordPendingChange(backendKey, route, &existingConfig)
+			r.state[backendKey] = *newConfig
+			r.stateChanged = true
+			r.recordRouteVersion(backendKey, route)
+			return
+		}
+
+		if r.dynamicallyReplaceWhitelist(backendKey, newConfig, &existingConfig) {
+			log.V(4).Info("dynamically updated route whitelist", "namespace", route.Namespace, "name", route.Name)
+			r.recordPendingChange(backendKey, route, &existingConfig)
+			r.state[backendKey] = *newConfig
+			r.stateChanged = true
+			r.recordRouteVersion(backendKey, route)
+			return
+		}
+
 		log.V(4).Info("updating route", "namespace", route.Namespace, "name", route.Name)
+		r.recordPendingChange(backendKey, route, &existingConfig)
+		reason = r.routeUpdateReason(backendKey, route)
 
 		// Delete the route first, because modify is to be treated as delete+add
-		r.removeRouteInternal(route)
+		removedDynamically = r.removeRouteInternal(route)
 
 		// TODO - clean up service units that are no longer
 		// referenced.  This may be challenging if a service unit can
@@ -1018,7 +1953,20 @@ func (r *templateRouter) AddRoute(route *routev1.Route) {
 		// is having stale service units accumulate with the attendant
 		// cost to router memory usage.
 	} else {
+		if r.capacity != nil {
+			if message := r.capacity.admit(len(r.state), newConfig); len(message) > 0 {
+				log.V(4).Info("route exceeds the router capacity", "namespace", route.Namespace, "name", route.Name, "error", message)
+				r.capacity.rejected[backendKey] = route
+				capacityRejections = append(capacityRejections, capacityRejection{route: route, message: message})
+				recorder = r.rejectionRecorder
+				return
+			}
+			delete(r.capacity.rejected, backendKey)
+		}
+
 		log.V(4).Info("adding route", "namespace", route.Namespace, "name", route.Name)
+		r.recordPendingChange(backendKey, route, nil)
+		reason = ReloadReasonRouteAdded
 	}
 
 	// Add service units referred to by the config
@@ -1031,30 +1979,87 @@ func (r *templateRouter) AddRoute(route *routev1.Route) {
 	}
 
 	configChanged := r.dynamicallyAddRoute(backendKey, route, newConfig)
+	if !configChanged || !removedDynamically {
+		r.recordReloadReason(reason, reloadObjectRoute(route))
+	}
 
 	r.state[backendKey] = *newConfig
+	r.recordRouteVersion(backendKey, route)
 	r.stateChanged = true
 	r.dynamicallyConfigured = r.dynamicallyConfigured && configChanged
 }
 
+// dynamicallyReplaceWhitelist updates the allowed source addresses of a route
+// with the dynamic config manager if that is the only change made to the
+// route. Returns true if the change was applied.
+// Must be called while holding r.lock
+func (r *templateRouter) dynamicallyReplaceWhitelist(backendKey ServiceAliasConfigKey, newConfig, oldConfig *ServiceAliasConfig) bool {
+	if r.dynamicConfigManager == nil || !r.synced {
+		return false
+	}
+
+	// The acl file only exists in the running configuration if the route
+	// already had a whitelist.
+	if len(oldConfig.Annotations[ipWhitelistAnnotation]) == 0 || len(newConfig.Annotations[ipWhitelistAnnotation]) == 0 {
+		return false
+	}
+	newList := parseIPList(newConfig.Annotations[ipWhitelistAnnotation])
+	if !configsAreEqual(withoutAnnotation(newConfig, ipWhitelistAnnotation), withoutAnnotation(oldConfig, ipWhitelistAnnotation)) {
+		return false
+	}
+
+	name := generateHAProxyWhiteListFile(r.dir, backendKey, newList)
+	if len(name) == 0 {
+		return false
+	}
+	cidrs, _ := haproxyutil.ValidateWhiteList(newList)
+	if err := r.dynamicConfigManager.ReplaceRouteWhitelist(backendKey, name, cidrs); err != nil {
+		log.V(4).Info("router will reload as the ConfigManager could not dynamically replace the route whitelist", "backendKey", backendKey, "error", err)
+		return false
+	}
+	return true
+}
+
+// withoutAnnotation returns a copy of the config without the given
+// annotation.
+func withoutAnnotation(config *ServiceAliasConfig, annotation string) *ServiceAliasConfig {
+	result := *config
+	result.Annotations = make(map[string]string, len(config.Annotations))
+	for k, v := range config.Annotations {
+		if k != annotation {
+			result.Annotations[k] = v
+		}
+	}
+	return &result
+}
+
 // RemoveRoute removes the given route
 func (r *templateRouter) RemoveRoute(route *routev1.Route) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	r.removeRouteInternal(route)
+	delete(r.pendingChanges, routeKey(route))
+	delete(r.rejectedRoutes, routeKey(route))
+	if r.capacity != nil {
+		delete(r.capacity.rejected, routeKey(route))
+	}
+
+	if _, ok := r.state[routeKey(route)]; ok && !r.removeRouteInternal(route) {
+		r.recordReloadReason(ReloadReasonRouteRemoved, reloadObjectRoute(route))
+	}
 }
 
 // removeRouteInternal removes the given route - internal
 // lockless form, caller needs to ensure lock acquisition [and release].
-func (r *templateRouter) removeRouteInternal(route *routev1.Route) {
+// Returns whether the route was removed dynamically.
+func (r *templateRouter) removeRouteInternal(route *routev1.Route) bool {
 	backendKey := routeKey(route)
 	serviceAliasConfig, ok := r.state[backendKey]
 	if !ok {
-		return
+		return true
 	}
 
-	configChanged := r.dynamicallyRemoveRoute(backendKey, route)
+	configChanged := r.dynamicallyRemoveRoute(backendKey, route, &serviceAliasConfig)
 
 	for key := range serviceAliasConfig.ServiceUnits {
 		r.removeServiceAliasAssociation(key, backendKey)
@@ -1062,8 +2067,10 @@ func (r *templateRouter) removeRouteInternal(route *routev1.Route) {
 
 	r.cleanUpServiceAliasConfig(&serviceAliasConfig)
 	delete(r.state, backendKey)
+	delete(r.routeVersions, backendKey)
 	r.stateChanged = true
 	r.dynamicallyConfigured = r.dynamicallyConfigured && configChanged
+	return configChanged
 }
 
 // numberOfEndpoints returns the number of endpoints
@@ -1083,6 +2090,10 @@ func (r *templateRouter) AddEndpoints(id ServiceUnitKey, endpoints []Endpoint) {
 	defer r.lock.Unlock()
 	frontend, _ := r.findMatchingServiceUnit(id)
 
+	if r.stableServerNames {
+		assignServerSlots(id, frontend.EndpointTable, endpoints)
+	}
+
 	//only make the change if there is a difference
 	if reflect.DeepEqual(frontend.EndpointTable, endpoints) {
 		log.V(4).Info("ignoring change, endpoints are the same", "id", id)
@@ -1097,6 +2108,9 @@ func (r *templateRouter) AddEndpoints(id ServiceUnitKey, endpoints []Endpoint) {
 	configChanged := r.dynamicallyReplaceEndpoints(id, frontend, oldEndpoints)
 	if len(frontend.ServiceAliasAssociations) > 0 {
 		r.stateChanged = true
+		if !configChanged {
+			r.recordReloadReason(ReloadReasonEndpoints, reloadObjectEndpoints(id))
+		}
 	}
 	r.dynamicallyConfigured = r.dynamicallyConfigured && configChanged
 }
@@ -1284,7 +2298,10 @@ func (r *templateRouter) getActiveEndpoints(serviceUnits map[ServiceUnitKey]int3
 // Inaccuracies occur when converting float32 to int32 and when the scaled
 // weight per endpoint is less than 1.0, the minimum.
 // The above assumes roundRobin scheduling.
-func (r *templateRouter) calculateServiceWeights(serviceUnits map[ServiceUnitKey]int32) map[ServiceUnitKey]int32 {
+// If byEndpoints is set, each endpoint gets the full weight of its service
+// instead, so each service gets (weight*numberOfEndpoints) fraction of the
+// requests and endpoints of equally weighted services are treated alike.
+func (r *templateRouter) calculateServiceWeights(serviceUnits map[ServiceUnitKey]int32, byEndpoints bool) map[ServiceUnitKey]int32 {
 	serviceUnitNames := make(map[ServiceUnitKey]int32)
 
 	// If there is only 1 service unit, then always set the weight 1 for all the endpoints.
@@ -1308,7 +2325,11 @@ func (r *templateRouter) calculateServiceWeights(serviceUnits map[ServiceUnitKey
 	for key, units := range serviceUnits {
 		numEp := r.numberOfEndpoints(key)
 		if numEp > 0 {
-			epWeight[key] = float32(units) / float32(numEp)
+			if byEndpoints {
+				epWeight[key] = float32(units)
+			} else {
+				epWeight[key] = float32(units) / float32(numEp)
+			}
 		}
 		if epWeight[key] > maxEpWeight {
 			maxEpWeight = epWeight[key]
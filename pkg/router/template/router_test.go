@@ -3,8 +3,12 @@ package templaterouter
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
@@ -12,6 +16,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/cert"
 
 	routev1 "github.com/openshift/api/route/v1"
 )
@@ -401,6 +406,112 @@ func TestCreateServiceAliasConfig(t *testing.T) {
 
 }
 
+// TestCreateServiceAliasConfigHostRewrite validates that the host rewrite
+// annotation is typed into the service alias config
+func TestCreateServiceAliasConfigHostRewrite(t *testing.T) {
+	router := NewFakeTemplateRouter()
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "service", value: "service", expected: "svc.foo.svc"},
+		{name: "fixed host", value: "backend.example.com", expected: "backend.example.com"},
+		{name: "invalid", value: "backend example.com", expected: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "foo",
+					Name:        "bar",
+					Annotations: map[string]string{"haproxy.router.openshift.io/rewrite-host": tc.value},
+				},
+				Spec: routev1.RouteSpec{
+					Host: "host",
+					To:   routev1.RouteTargetReference{Name: "svc"},
+				},
+			}
+			config := router.createServiceAliasConfig(route, "foo:bar")
+			if config.BackendHostHeader != tc.expected {
+				t.Errorf("expected backend host header %q, got %q", tc.expected, config.BackendHostHeader)
+			}
+		})
+	}
+}
+
+// TestCreateServiceAliasConfigIDNHost validates that internationalized host
+// names are typed into the service alias config in their punycode form and
+// that the route keeps its original host
+func TestCreateServiceAliasConfigIDNHost(t *testing.T) {
+	router := NewFakeTemplateRouter()
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "bar"},
+		Spec: routev1.RouteSpec{
+			Host: "café.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+		},
+	}
+	config := router.createServiceAliasConfig(route, "foo:bar")
+	if config.Host != "xn--caf-dma.example.com" {
+		t.Errorf("expected the punycode host, got %q", config.Host)
+	}
+	if route.Spec.Host != "café.example.com" {
+		t.Errorf("expected the route to keep its host, got %q", route.Spec.Host)
+	}
+}
+
+// TestCreateServiceAliasConfigBackendTLSOptions validates that the backend
+// TLS verification options of reencrypt routes are typed into the service
+// alias config
+func TestCreateServiceAliasConfigBackendTLSOptions(t *testing.T) {
+	router := NewFakeTemplateRouter()
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "foo",
+			Name:      "bar",
+			Annotations: map[string]string{
+				"haproxy.router.openshift.io/backend-tls-verify-hostname": "backend.example.com",
+				"haproxy.router.openshift.io/backend-tls-min-version":     "TLSv1.3",
+			},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "host",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+			TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationReencrypt},
+		},
+	}
+	config := router.createServiceAliasConfig(route, "foo:bar")
+	if config.DestinationVerifyHostname != "backend.example.com" || config.DestinationMinTLSVersion != "TLSv1.3" {
+		t.Errorf("unexpected backend TLS options in %#v", config)
+	}
+
+	// The backend certificate is only verified against the pinned
+	// certificate of the destination CA.
+	certs, err := cert.ParseCertsPEM([]byte(testWildcardCertificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(certs[0].RawSubjectPublicKeyInfo)
+	route.Annotations["haproxy.router.openshift.io/backend-tls-spki-sha256"] = base64.StdEncoding.EncodeToString(hash[:])
+	route.Spec.TLS.DestinationCACertificate = testWildcardCertificate
+	config = router.createServiceAliasConfig(route, "foo:bar")
+	pinned := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[0].Raw}))
+	if contents := config.Certificates[generateDestCertKey(config)].Contents; contents != pinned {
+		t.Errorf("expected the destination CA to be the pinned certificate, got %q", contents)
+	}
+
+	route.Annotations["haproxy.router.openshift.io/backend-tls-min-version"] = "SSLv3"
+	config = router.createServiceAliasConfig(route, "foo:bar")
+	if config.DestinationVerifyHostname != "" || config.DestinationMinTLSVersion != "" {
+		t.Errorf("expected invalid backend TLS options to be ignored, got %#v", config)
+	}
+}
+
 // TestAddRoute validates that adding a route creates a service alias config and associated service units
 func TestAddRoute(t *testing.T) {
 	router := NewFakeTemplateRouter()
@@ -578,6 +689,51 @@ func TestRemoveRoute(t *testing.T) {
 	}
 }
 
+// TestRerender tests that Rerender marks the certificates of the matching
+// routes to be written again and the router to be reloaded.
+func TestRerender(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	for _, r := range []struct{ namespace, name string }{{"foo", "bar"}, {"foo", "baz"}, {"other", "bar"}} {
+		router.AddRoute(&routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: r.namespace, Name: r.name},
+			Spec:       routev1.RouteSpec{Host: r.name + "." + r.namespace},
+		})
+	}
+	saved := func() {
+		for key, cfg := range router.state {
+			cfg.Status = ServiceAliasConfigStatusSaved
+			router.state[key] = cfg
+		}
+		router.stateChanged = false
+	}
+
+	testCases := []struct {
+		name      string
+		namespace string
+		route     string
+		expected  []ServiceAliasConfigKey
+	}{
+		{name: "all routes", expected: []ServiceAliasConfigKey{"foo:bar", "foo:baz", "other:bar"}},
+		{name: "namespace", namespace: "foo", expected: []ServiceAliasConfigKey{"foo:bar", "foo:baz"}},
+		{name: "route", namespace: "other", route: "bar", expected: []ServiceAliasConfigKey{"other:bar"}},
+		{name: "no matching route", namespace: "missing"},
+	}
+	for _, tc := range testCases {
+		saved()
+		if count := router.Rerender(tc.namespace, tc.route); count != len(tc.expected) {
+			t.Errorf("%s: expected %d routes, got %d", tc.name, len(tc.expected), count)
+		}
+		for _, key := range tc.expected {
+			if router.state[key].Status == ServiceAliasConfigStatusSaved {
+				t.Errorf("%s: expected the certificates of %s to be written again", tc.name, key)
+			}
+		}
+		if router.stateChanged != (len(tc.expected) > 0) {
+			t.Errorf("%s: expected a reload %t, got %t", tc.name, len(tc.expected) > 0, router.stateChanged)
+		}
+	}
+}
+
 func TestShouldWriteCertificates(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -789,6 +945,33 @@ func TestFilterNamespaces(t *testing.T) {
 			},
 			expectedStateChanged: false,
 		},
+		{
+			name:                 "no namespaces, empty",
+			serviceUnits:         map[ServiceUnitKey]ServiceUnit{},
+			state:                map[ServiceAliasConfigKey]ServiceAliasConfig{},
+			filterNamespaces:     sets.NewString(),
+			expectedServiceUnits: map[ServiceUnitKey]ServiceUnit{},
+			expectedState:        map[ServiceAliasConfigKey]ServiceAliasConfig{},
+			expectedStateChanged: false,
+		},
+		{
+			name: "valid, filter unused service units",
+			serviceUnits: map[ServiceUnitKey]ServiceUnit{
+				endpointsKeyFromParts("ns1", "svc"): {},
+				endpointsKeyFromParts("ns2", "svc"): {},
+			},
+			state: map[ServiceAliasConfigKey]ServiceAliasConfig{
+				routeKeyFromParts("ns2", "svc"): {},
+			},
+			filterNamespaces: sets.NewString("ns2"),
+			expectedServiceUnits: map[ServiceUnitKey]ServiceUnit{
+				endpointsKeyFromParts("ns2", "svc"): {},
+			},
+			expectedState: map[ServiceAliasConfigKey]ServiceAliasConfig{
+				routeKeyFromParts("ns2", "svc"): {},
+			},
+			expectedStateChanged: false,
+		},
 		{
 			name: "valid, filter some",
 			serviceUnits: map[ServiceUnitKey]ServiceUnit{
@@ -871,6 +1054,7 @@ func TestCalculateServiceWeights(t *testing.T) {
 		name            string
 		serviceUnits    map[ServiceUnitKey][]Endpoint
 		serviceWeights  map[ServiceUnitKey]int32
+		byEndpoints     bool
 		expectedWeights map[ServiceUnitKey]int32
 	}{
 		{
@@ -933,6 +1117,38 @@ func TestCalculateServiceWeights(t *testing.T) {
 				suKey2: 256,
 			},
 		},
+		{
+			name: "services with equal weights and a different number of endpoints weighted by endpoints",
+			serviceUnits: map[ServiceUnitKey][]Endpoint{
+				suKey1: {ep1, ep2},
+				suKey2: {ep3},
+			},
+			serviceWeights: map[ServiceUnitKey]int32{
+				suKey1: 50,
+				suKey2: 50,
+			},
+			byEndpoints: true,
+			expectedWeights: map[ServiceUnitKey]int32{
+				suKey1: 256,
+				suKey2: 256,
+			},
+		},
+		{
+			name: "services with unequal weights and a different number of endpoints weighted by endpoints",
+			serviceUnits: map[ServiceUnitKey][]Endpoint{
+				suKey1: {ep1, ep2},
+				suKey2: {ep3},
+			},
+			serviceWeights: map[ServiceUnitKey]int32{
+				suKey1: 20,
+				suKey2: 60,
+			},
+			byEndpoints: true,
+			expectedWeights: map[ServiceUnitKey]int32{
+				suKey1: 85,
+				suKey2: 256,
+			},
+		},
 		{
 			name: "services with equal weights and a different number of endpoints, one of which is common",
 			serviceUnits: map[ServiceUnitKey][]Endpoint{
@@ -995,7 +1211,7 @@ func TestCalculateServiceWeights(t *testing.T) {
 			router.CreateServiceUnit(suKey)
 			router.AddEndpoints(suKey, eps)
 		}
-		endpointWeights := router.calculateServiceWeights(tc.serviceWeights)
+		endpointWeights := router.calculateServiceWeights(tc.serviceWeights, tc.byEndpoints)
 		if !reflect.DeepEqual(endpointWeights, tc.expectedWeights) {
 			t.Errorf("test %s: expected endpointWeights to be %v, got %v", tc.name, tc.expectedWeights, endpointWeights)
 		}
@@ -1161,3 +1377,137 @@ func TestSecretToPem(t *testing.T) {
 		})
 	}
 }
+
+// whitelistConfigManager is a ConfigManager that records whitelist,
+// maintenance and active color updates.
+type whitelistConfigManager struct {
+	whitelists  map[string][]string
+	maintenance map[ServiceAliasConfigKey]bool
+	colors      map[string]string
+	err         error
+}
+
+func (cm *whitelistConfigManager) Initialize(router RouterInterface, certPath string) {}
+func (cm *whitelistConfigManager) AddBlueprint(route *routev1.Route) error {
+	return nil
+}
+func (cm *whitelistConfigManager) RemoveBlueprint(route *routev1.Route)                    {}
+func (cm *whitelistConfigManager) Register(id ServiceAliasConfigKey, route *routev1.Route) {}
+func (cm *whitelistConfigManager) AddRoute(id ServiceAliasConfigKey, routingKey string, route *routev1.Route) error {
+	return fmt.Errorf("no blueprint found that would match route %s/%s", route.Namespace, route.Name)
+}
+func (cm *whitelistConfigManager) RemoveRoute(id ServiceAliasConfigKey, route *routev1.Route) error {
+	return nil
+}
+func (cm *whitelistConfigManager) ReplaceRouteEndpoints(id ServiceAliasConfigKey, oldEndpoints, newEndpoints []Endpoint, weight int32) error {
+	return nil
+}
+func (cm *whitelistConfigManager) RemoveRouteEndpoints(id ServiceAliasConfigKey, endpoints []Endpoint) error {
+	return nil
+}
+func (cm *whitelistConfigManager) ReplaceRouteWhitelist(id ServiceAliasConfigKey, whitelistFile string, cidrs []string) error {
+	if cm.err != nil {
+		return cm.err
+	}
+	cm.whitelists[whitelistFile] = cidrs
+	return nil
+}
+func (cm *whitelistConfigManager) SetRouteActiveColor(id ServiceAliasConfigKey, backendName, color string) error {
+	if cm.err != nil {
+		return cm.err
+	}
+	cm.colors[backendName] = color
+	return nil
+}
+func (cm *whitelistConfigManager) SetRouteMaintenance(id ServiceAliasConfigKey, maintenance bool) error {
+	if cm.err != nil {
+		return cm.err
+	}
+	cm.maintenance[id] = maintenance
+	return nil
+}
+func (cm *whitelistConfigManager) AddCertificate(crtList string, entry CrtListEntry, pem []byte) error {
+	return nil
+}
+func (cm *whitelistConfigManager) RemoveCertificate(crtList, certFile string) error {
+	return nil
+}
+func (cm *whitelistConfigManager) Notify(event RouterEventType) {}
+func (cm *whitelistConfigManager) ServerTemplateName(id ServiceAliasConfigKey) string {
+	return "whitelistConfigManager"
+}
+func (cm *whitelistConfigManager) ServerTemplateSize(id ServiceAliasConfigKey) string {
+	return "1"
+}
+func (cm *whitelistConfigManager) GenerateDynamicServerNames(id ServiceAliasConfigKey) []string {
+	return nil
+}
+
+// TestDynamicallyReplaceWhitelist tests that a change to only the whitelist
+// of a route is applied without a reload.
+func TestDynamicallyReplaceWhitelist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "whitelist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, whitelistDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cm := &whitelistConfigManager{whitelists: map[string][]string{}}
+	router := NewFakeTemplateRouter()
+	router.dir = dir
+	router.dynamicConfigManager = cm
+	router.synced = true
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "foo",
+			Name:        "bar",
+			Annotations: map[string]string{ipWhitelistAnnotation: "10.0.0.0/8"},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "host",
+			To:   routev1.RouteTargetReference{Name: "TestService"},
+		},
+	}
+	router.AddRoute(route)
+	router.dynamicallyConfigured = true
+	router.stateChanged = false
+
+	whitelistFile := filepath.Join(dir, whitelistDir, "foo:bar.txt")
+	updated := route.DeepCopy()
+	updated.Annotations[ipWhitelistAnnotation] = "10.0.0.0/8 192.168.1.1"
+	router.AddRoute(updated)
+	if !reflect.DeepEqual(cm.whitelists[whitelistFile], []string{"10.0.0.0/8", "192.168.1.1"}) {
+		t.Fatalf("expected whitelist to be replaced dynamically, got %v", cm.whitelists)
+	}
+	if !router.dynamicallyConfigured {
+		t.Fatalf("expected whitelist change not to require a reload")
+	}
+	if data, err := ioutil.ReadFile(whitelistFile); err != nil || string(data) != "10.0.0.0/8\n192.168.1.1\n" {
+		t.Fatalf("unexpected whitelist file contents %q: %v", string(data), err)
+	}
+
+	// Changes to anything else require a reload.
+	moved := updated.DeepCopy()
+	moved.Annotations[ipWhitelistAnnotation] = "10.0.0.0/8"
+	moved.Spec.Host = "other"
+	router.AddRoute(moved)
+	if !reflect.DeepEqual(cm.whitelists[whitelistFile], []string{"10.0.0.0/8", "192.168.1.1"}) {
+		t.Fatalf("expected whitelist not to be replaced dynamically, got %v", cm.whitelists)
+	}
+	if router.dynamicallyConfigured {
+		t.Fatalf("expected route change to require a reload")
+	}
+
+	// Removing the whitelist requires a reload to remove the acl.
+	router.dynamicallyConfigured = true
+	removed := moved.DeepCopy()
+	delete(removed.Annotations, ipWhitelistAnnotation)
+	router.AddRoute(removed)
+	if router.dynamicallyConfigured {
+		t.Fatalf("expected removing the whitelist to require a reload")
+	}
+}
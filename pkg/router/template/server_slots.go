@@ -0,0 +1,67 @@
+package templaterouter
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// serverSlotPrefix is the prefix of the names of the servers named after
+// the slots of their service.
+const serverSlotPrefix = "slot:"
+
+// serverSlotName returns the name of the server of slot i of a service.
+func serverSlotName(service string, i int) string {
+	return fmt.Sprintf("%s%s:%d", serverSlotPrefix, service, i)
+}
+
+// ServerName returns the name of the server of the endpoint in the backends
+// of the routes: the slot of the endpoint if the router names the servers
+// after the slots of their service, and the ID of the endpoint otherwise.
+func (e Endpoint) ServerName() string {
+	if len(e.SlotName) > 0 {
+		return e.SlotName
+	}
+	return e.ID
+}
+
+// assignServerSlots names the servers of the endpoints of a service after
+// slots of the service, so that the servers keep their name, their stats
+// and their metrics when the pods behind them change.  The endpoints of
+// previous keep their slot, and the other endpoints take the free slots,
+// lowest first, so that a pod replacing another takes over its server and
+// its address is changed through the runtime API.  The sticky cookies of
+// the servers are still derived from their endpoint, so that the sessions
+// of a removed pod are not sent to the pod that takes over its slot.
+func assignServerSlots(id ServiceUnitKey, previous, endpoints []Endpoint) {
+	service := string(id)
+	if i := strings.LastIndex(service, "/"); i >= 0 {
+		service = service[i+1:]
+	}
+
+	slots := make(map[string]string, len(previous))
+	for _, ep := range previous {
+		if len(ep.SlotName) > 0 {
+			slots[ep.ID] = ep.SlotName
+		}
+	}
+	taken := sets.NewString()
+	for i := range endpoints {
+		endpoints[i].SlotName = ""
+		if slot, ok := slots[endpoints[i].ID]; ok && !taken.Has(slot) {
+			endpoints[i].SlotName = slot
+			taken.Insert(slot)
+		}
+	}
+	next := 0
+	for i := range endpoints {
+		if len(endpoints[i].SlotName) == 0 {
+			for taken.Has(serverSlotName(service, next)) {
+				next++
+			}
+			endpoints[i].SlotName = serverSlotName(service, next)
+			taken.Insert(endpoints[i].SlotName)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package templaterouter
+
+import (
+	"crypto/md5"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestAssignServerSlots(t *testing.T) {
+	endpoint := func(id string) Endpoint {
+		return Endpoint{ID: id, IP: id, Port: "8080", IdHash: fmt.Sprintf("%x", md5.Sum([]byte(id)))}
+	}
+	slots := func(endpoints []Endpoint) map[string]string {
+		result := map[string]string{}
+		for _, ep := range endpoints {
+			result[ep.ID] = ep.ServerName()
+			if hash := fmt.Sprintf("%x", md5.Sum([]byte(ep.ID))); ep.IdHash != hash {
+				t.Errorf("expected the cookie of %s to stay with the endpoint in slot %s, got %s", ep.ID, ep.SlotName, ep.IdHash)
+			}
+		}
+		return result
+	}
+
+	first := []Endpoint{endpoint("a"), endpoint("b"), endpoint("c")}
+	assignServerSlots("ns/svc", nil, first)
+	if got, expected := slots(first), map[string]string{"a": "slot:svc:0", "b": "slot:svc:1", "c": "slot:svc:2"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the slots %v, got %v", expected, got)
+	}
+
+	// b is replaced by d and e is added: the new endpoints take the free
+	// slots in their order, d the one of b and e the next one.
+	second := []Endpoint{endpoint("d"), endpoint("e"), endpoint("c"), endpoint("a")}
+	assignServerSlots("ns/svc", first, second)
+	if got, expected := slots(second), map[string]string{"a": "slot:svc:0", "c": "slot:svc:2", "d": "slot:svc:1", "e": "slot:svc:3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the slots %v, got %v", expected, got)
+	}
+
+	// The slots of the endpoints are kept when the service scales down.
+	third := []Endpoint{endpoint("e")}
+	assignServerSlots("ns/svc", second, third)
+	if got, expected := slots(third), map[string]string{"e": "slot:svc:3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the slots %v, got %v", expected, got)
+	}
+}
+
+func TestAddEndpointsStableServerNames(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	router.stableServerNames = true
+	suKey := ServiceUnitKey("ns/svc")
+	router.CreateServiceUnit(suKey)
+
+	router.AddEndpoints(suKey, []Endpoint{{ID: "ept:svc:1.1.1.1:8080", IP: "1.1.1.1", Port: "8080"}})
+	su, _ := router.FindServiceUnit(suKey)
+	if len(su.EndpointTable) != 1 || su.EndpointTable[0].ServerName() != "slot:svc:0" {
+		t.Errorf("expected the endpoint to take slot:svc:0, got %+v", su.EndpointTable)
+	}
+
+	router.AddEndpoints(suKey, []Endpoint{{ID: "ept:svc:2.2.2.2:8080", IP: "2.2.2.2", Port: "8080"}})
+	su, _ = router.FindServiceUnit(suKey)
+	if len(su.EndpointTable) != 1 || su.EndpointTable[0].ServerName() != "slot:svc:0" {
+		t.Errorf("expected the new endpoint to take over slot:svc:0, got %+v", su.EndpointTable)
+	}
+}
@@ -20,8 +20,14 @@ type ServiceLookup interface {
 	LookupService(*api.Endpoints) (*api.Service, error)
 }
 
-func NewListWatchServiceLookup(svcGetter kcoreclient.ServicesGetter, resync time.Duration, namespace string) ServiceLookup {
-	svcStore := cache.NewStore(cache.MetaNamespaceKeyFunc)
+// ServiceInformerLookup is a ServiceLookup backed by an informer that the
+// other watchers of the services share, rather than watching them again.
+type ServiceInformerLookup interface {
+	ServiceLookup
+	Informer() cache.SharedInformer
+}
+
+func NewListWatchServiceLookup(svcGetter kcoreclient.ServicesGetter, resync time.Duration, namespace string) ServiceInformerLookup {
 	lw := &cache.ListWatch{
 		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
 			return svcGetter.Services(namespace).List(context.TODO(), options)
@@ -30,15 +36,22 @@ func NewListWatchServiceLookup(svcGetter kcoreclient.ServicesGetter, resync time
 			return svcGetter.Services(namespace).Watch(context.TODO(), options)
 		},
 	}
-	go cache.NewReflector(lw, &api.Service{}, svcStore, resync).Run(wait.NeverStop)
+	informer := cache.NewSharedIndexInformer(lw, &api.Service{}, resync, cache.Indexers{})
+	go informer.Run(wait.NeverStop)
 
 	return &serviceLWLookup{
-		store: svcStore,
+		informer: informer,
+		store:    informer.GetStore(),
 	}
 }
 
 type serviceLWLookup struct {
-	store cache.Store
+	informer cache.SharedInformer
+	store    cache.Store
+}
+
+func (c *serviceLWLookup) Informer() cache.SharedInformer {
+	return c.informer
 }
 
 func (c *serviceLWLookup) LookupService(endpoints *api.Endpoints) (*api.Service, error) {
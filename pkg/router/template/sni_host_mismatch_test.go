@@ -0,0 +1,102 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestSNIHostMismatchPolicyTemplate(t *testing.T) {
+	routes := []*routev1.Route{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        "exempt",
+				Annotations: map[string]string{allowSNIHostMismatchAnnotation: "true"},
+			},
+			Spec: routev1.RouteSpec{
+				Host: "exempt.example.com",
+				To:   routev1.RouteTargetReference{Name: "svc"},
+				TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "strict"},
+			Spec: routev1.RouteSpec{
+				Host: "strict.example.com",
+				To:   routev1.RouteTargetReference{Name: "svc"},
+				TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+			},
+		},
+	}
+
+	tests := []struct {
+		policy   string
+		expected []string
+	}{
+		{
+			policy: "",
+		},
+		{
+			policy:   SNIHostMismatchReject,
+			expected: []string{"  http-request deny deny_status 421 if !sni_host_match !sni_host_mismatch_exempt"},
+		},
+		{
+			policy:   SNIHostMismatchDefaultBackend,
+			expected: []string{"  use_backend openshift_default if !sni_host_match !sni_host_mismatch_exempt"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			renderer, err := NewRenderer(RendererConfig{
+				TemplatePath:          "../../../images/router/haproxy/conf/haproxy-config.template",
+				WorkingDir:            "/var/lib/haproxy",
+				BindPorts:             true,
+				SNIHostMismatchPolicy: tc.policy,
+			})
+			if err != nil {
+				t.Fatalf("unable to create the renderer: %v", err)
+			}
+			files, err := renderer.Render(renderer.RouteState(routes))
+			if err != nil {
+				t.Fatalf("unable to render: %v", err)
+			}
+
+			var config, exempt string
+			for _, file := range files {
+				switch file.Name {
+				case "conf/haproxy.config":
+					config = string(file.Contents)
+				case "conf/os_sni_host_mismatch_exempt.map":
+					exempt = string(file.Contents)
+				}
+			}
+			if !strings.Contains(exempt, `^exempt\.example\.com\.?(:[0-9]+)?(/.*)?$ 1`) || strings.Contains(exempt, "strict") {
+				t.Errorf("expected only the exempt route in the exempt map, got:\n%s", exempt)
+			}
+
+			// The policy applies to both frontends that terminate TLS, before
+			// the route backends are selected.
+			for _, frontend := range []string{"frontend fe_sni\n", "frontend fe_no_sni\n"} {
+				i := strings.Index(config, frontend)
+				if i < 0 {
+					t.Fatalf("%q not found", frontend)
+				}
+				section := config[i:]
+				section = section[:strings.Index(section, "use_backend %[base,map_reg(/var/lib/haproxy/conf/os_edge_reencrypt_be.map)]")]
+				if hasACL := strings.Contains(section, "acl sni_host_match ssl_fc_sni,lower,strcmp(txn.sni_host) eq 0"); hasACL != (len(tc.policy) > 0) {
+					t.Errorf("%s: expected the SNI host match acl to be present: %v", frontend, len(tc.policy) > 0)
+				}
+				for _, expected := range tc.expected {
+					if !strings.Contains(section, expected+"\n") {
+						t.Errorf("%s: expected %q before the route backends", frontend, expected)
+					}
+				}
+			}
+		})
+	}
+}
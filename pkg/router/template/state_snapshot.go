@@ -0,0 +1,106 @@
+package templaterouter
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StateSnapshotVersion is the version of the format of the state snapshots
+// written by ExportState.  It changes when a change to the router state
+// types would make older snapshots decode to a different state.
+const StateSnapshotVersion = 1
+
+// redactedPrivateKey replaces the private keys of the certificates of a
+// state snapshot.
+const redactedPrivateKey = "REDACTED"
+
+// StateSnapshot is a versioned JSON snapshot of the route and service state
+// of a router, so that the state a router rendered can be attached to bug
+// reports and rendered again, e.g. against another template.
+type StateSnapshot struct {
+	// Version is the StateSnapshotVersion the snapshot was written with.
+	Version int `json:"version"`
+	// Routes are the configurations of the routes of the router.
+	Routes map[ServiceAliasConfigKey]ServiceAliasConfig `json:"routes"`
+	// ServiceUnits are the services of the routes and their endpoints.
+	ServiceUnits map[ServiceUnitKey]ServiceUnit `json:"serviceUnits"`
+}
+
+// newStateSnapshot returns a snapshot of routes and serviceUnits.  The
+// private keys of the certificates of the routes are redacted.
+func newStateSnapshot(routes map[ServiceAliasConfigKey]ServiceAliasConfig, serviceUnits map[ServiceUnitKey]ServiceUnit) StateSnapshot {
+	snapshot := StateSnapshot{
+		Version:      StateSnapshotVersion,
+		Routes:       make(map[ServiceAliasConfigKey]ServiceAliasConfig, len(routes)),
+		ServiceUnits: make(map[ServiceUnitKey]ServiceUnit, len(serviceUnits)),
+	}
+	for key, cfg := range routes {
+		if len(cfg.Certificates) > 0 {
+			certificates := make(map[string]Certificate, len(cfg.Certificates))
+			for id, cert := range cfg.Certificates {
+				if len(cert.PrivateKey) > 0 {
+					cert.PrivateKey = redactedPrivateKey
+				}
+				certificates[id] = cert
+			}
+			cfg.Certificates = certificates
+		}
+		snapshot.Routes[key] = cfg
+	}
+	for key, unit := range serviceUnits {
+		snapshot.ServiceUnits[key] = unit
+	}
+	return snapshot
+}
+
+// DecodeStateSnapshot decodes a snapshot written by ExportState into the
+// state a Renderer renders.
+func DecodeStateSnapshot(data []byte) (RenderState, error) {
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return RenderState{}, fmt.Errorf("invalid state snapshot: %v", err)
+	}
+	if snapshot.Version != StateSnapshotVersion {
+		return RenderState{}, fmt.Errorf("unsupported state snapshot version %d, expected %d", snapshot.Version, StateSnapshotVersion)
+	}
+	state := RenderState{Routes: snapshot.Routes, ServiceUnits: snapshot.ServiceUnits}
+	if state.Routes == nil {
+		state.Routes = make(map[ServiceAliasConfigKey]ServiceAliasConfig)
+	}
+	if state.ServiceUnits == nil {
+		state.ServiceUnits = make(map[ServiceUnitKey]ServiceUnit)
+	}
+	return state, nil
+}
+
+// ExportState returns a snapshot of the state of the router as JSON.  The
+// private keys of the certificates of the routes are redacted.
+func (r *templateRouter) ExportState() ([]byte, error) {
+	r.lock.Lock()
+	snapshot := newStateSnapshot(r.state, r.serviceUnits)
+	r.lock.Unlock()
+	return json.Marshal(snapshot)
+}
+
+// ImportState replaces the state of the router with a snapshot written by
+// ExportState.  The certificates of the routes are written again, without
+// their redacted private keys, so it is meant for testing routers.
+func (r *templateRouter) ImportState(data []byte) error {
+	state, err := DecodeStateSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for key, cfg := range state.Routes {
+		cfg.Status = ""
+		state.Routes[key] = cfg
+	}
+	r.state = state.Routes
+	r.serviceUnits = state.ServiceUnits
+	r.stateChanged = true
+	r.dynamicallyConfigured = false
+	r.recordReloadReason(ReloadReasonStateImported, "")
+	return nil
+}
@@ -0,0 +1,103 @@
+package templaterouter
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestStateSnapshot(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "r"},
+		Spec: routev1.RouteSpec{
+			Host: "www.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+			TLS: &routev1.TLSConfig{
+				Termination: routev1.TLSTerminationEdge,
+				Certificate: "cert",
+				Key:         "secret key",
+			},
+		},
+	}
+	router.CreateServiceUnit("ns/svc")
+	router.AddEndpoints("ns/svc", []Endpoint{{ID: "ep1", IP: "10.128.0.5", Port: "8080"}})
+	router.AddRoute(route)
+
+	data, err := router.ExportState()
+	if err != nil {
+		t.Fatalf("unable to export the state: %v", err)
+	}
+	if bytes.Contains(data, []byte("secret key")) {
+		t.Errorf("expected the private key to be redacted from %s", data)
+	}
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != StateSnapshotVersion {
+		t.Errorf("expected version %d, got %d", StateSnapshotVersion, snapshot.Version)
+	}
+	if cert := router.state["ns:r"].Certificates["www.example.com"]; cert.PrivateKey != "secret key" {
+		t.Errorf("expected the state of the router to keep its private key, got %q", cert.PrivateKey)
+	}
+
+	imported := NewFakeTemplateRouter()
+	if err := imported.ImportState(data); err != nil {
+		t.Fatalf("unable to import the state: %v", err)
+	}
+	if !imported.stateChanged {
+		t.Errorf("expected the imported state to be committed")
+	}
+	if !reflect.DeepEqual(imported.serviceUnits, router.serviceUnits) {
+		t.Errorf("expected the imported services %#v, got %#v", router.serviceUnits, imported.serviceUnits)
+	}
+	cfg, ok := imported.state["ns:r"]
+	if !ok {
+		t.Fatalf("expected the imported route, got %#v", imported.state)
+	}
+	if cfg.Host != "www.example.com" || cfg.TLSTermination != routev1.TLSTerminationEdge || cfg.Certificates["www.example.com"].Contents != "cert" {
+		t.Errorf("unexpected imported route %#v", cfg)
+	}
+
+	// A snapshot renders the same configuration as the state it was taken
+	// from.
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	state, err := DecodeStateSnapshot(data)
+	if err != nil {
+		t.Fatalf("unable to decode the snapshot: %v", err)
+	}
+	expected, err := renderer.Render(RenderState{Routes: router.state, ServiceUnits: router.serviceUnits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := renderer.Render(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, replayed) {
+		t.Errorf("expected the snapshot to render the same files")
+	}
+
+	for name, data := range map[string]string{
+		"invalid":     "{",
+		"old version": `{"version": 0}`,
+	} {
+		if _, err := DecodeStateSnapshot([]byte(data)); err == nil || !strings.Contains(err.Error(), "snapshot") {
+			t.Errorf("%s: expected an invalid snapshot error, got %v", name, err)
+		}
+	}
+}
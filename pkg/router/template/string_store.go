@@ -0,0 +1,117 @@
+package templaterouter
+
+import (
+	"sync"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// minStringStorePrune is the number of values that must be added to a
+// string store before it is pruned, so that small routers never prune.
+const minStringStorePrune = 1000
+
+// stringStore deduplicates the strings the router holds for its routes.
+// Every route decoded from the API carries its own copy of values such as
+// its certificates, even when thousands of routes share a wildcard
+// certificate.  Interning them keeps a single copy of each distinct value:
+// values are keyed by their content and a Go string shares its bytes
+// between the map key, the map value and every user of the value.
+//
+// The store does not count references.  It is pruned instead of the values
+// no longer used by the router state, and a pruned value that is still in
+// use elsewhere is kept alive by its users and merely stops being shared.
+type stringStore struct {
+	lock   sync.Mutex
+	values map[string]string
+	// added is the number of values added since the store was last pruned.
+	added int
+}
+
+// newStringStore returns an empty string store.
+func newStringStore() *stringStore {
+	return &stringStore{values: make(map[string]string)}
+}
+
+// intern returns the shared copy of value.  A nil store returns value.
+func (s *stringStore) intern(value string) string {
+	if s == nil || len(value) == 0 {
+		return value
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if shared, ok := s.values[value]; ok {
+		return shared
+	}
+	s.values[value] = value
+	s.added++
+	return value
+}
+
+// needsPrune returns true if enough values were added since the store was
+// last pruned to warrant pruning a store used by live values.
+func (s *stringStore) needsPrune(live int) bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.added >= minStringStorePrune && s.added >= live
+}
+
+// prune drops every value that is not passed to keep by mark.
+func (s *stringStore) prune(mark func(keep func(string))) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	values := make(map[string]string, len(s.values)-s.added)
+	mark(func(value string) {
+		if shared, ok := s.values[value]; ok {
+			values[shared] = shared
+		}
+	})
+	s.values = values
+	s.added = 0
+}
+
+// internRoute replaces the values of a route that are commonly shared
+// between routes with their shared copies.
+func (s *stringStore) internRoute(route *routev1.Route) {
+	if s == nil {
+		return
+	}
+	route.Spec.Host = s.intern(route.Spec.Host)
+	route.Spec.Path = s.intern(route.Spec.Path)
+	if tls := route.Spec.TLS; tls != nil {
+		tls.Certificate = s.intern(tls.Certificate)
+		tls.Key = s.intern(tls.Key)
+		tls.CACertificate = s.intern(tls.CACertificate)
+		tls.DestinationCACertificate = s.intern(tls.DestinationCACertificate)
+	}
+}
+
+// internConfig replaces the values of a service alias config with their
+// shared copies.
+func (s *stringStore) internConfig(cfg *ServiceAliasConfig) {
+	if s == nil {
+		return
+	}
+	cfg.Host = s.intern(cfg.Host)
+	cfg.Path = s.intern(cfg.Path)
+	for key, cert := range cfg.Certificates {
+		cert.Contents = s.intern(cert.Contents)
+		cert.PrivateKey = s.intern(cert.PrivateKey)
+		cfg.Certificates[key] = cert
+	}
+}
+
+// markConfig passes the shared values of a service alias config to keep.
+func markConfig(cfg *ServiceAliasConfig, keep func(string)) {
+	keep(cfg.Host)
+	keep(cfg.Path)
+	for _, cert := range cfg.Certificates {
+		keep(cert.Contents)
+		keep(cert.PrivateKey)
+	}
+}
@@ -0,0 +1,130 @@
+package templaterouter
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// sameString returns true if a and b share their bytes.
+func sameString(a, b string) bool {
+	return len(a) == len(b) && (*reflect.StringHeader)(unsafe.Pointer(&a)).Data == (*reflect.StringHeader)(unsafe.Pointer(&b)).Data
+}
+
+// copyString returns a copy of s that does not share its bytes, like a value
+// decoded from the API.
+func copyString(s string) string {
+	return string([]byte(s))
+}
+
+// sharedCertRoute returns an edge route with its own copy of a certificate
+// shared by every route returned.
+func sharedCertRoute(i int) *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: fmt.Sprintf("route-%d", i)},
+		Spec: routev1.RouteSpec{
+			Host: fmt.Sprintf("route-%d.apps.example.com", i),
+			To:   routev1.RouteTargetReference{Name: "svc"},
+			TLS: &routev1.TLSConfig{
+				Termination:   routev1.TLSTerminationEdge,
+				Certificate:   copyString(strings.Repeat("certificate", 200)),
+				Key:           copyString(strings.Repeat("private key", 150)),
+				CACertificate: copyString(strings.Repeat("ca certificate", 100)),
+			},
+		},
+	}
+}
+
+func TestStringStore(t *testing.T) {
+	s := newStringStore()
+
+	first := s.intern(copyString("value"))
+	if second := s.intern(copyString("value")); !sameString(first, second) {
+		t.Fatalf("expected interned values to be shared")
+	}
+	s.intern("stale")
+	if s.added != 2 {
+		t.Fatalf("expected 2 added values, got %d", s.added)
+	}
+
+	s.prune(func(keep func(string)) { keep(copyString("value")) })
+	if len(s.values) != 1 || s.added != 0 {
+		t.Fatalf("expected only the kept value after pruning, got %v", s.values)
+	}
+	if third := s.intern(copyString("value")); !sameString(first, third) {
+		t.Errorf("expected kept values to remain shared")
+	}
+
+	var nilStore *stringStore
+	if v := nilStore.intern("value"); v != "value" {
+		t.Errorf("expected a nil store to return the value, got %q", v)
+	}
+}
+
+func TestStringStoreSharesRouteState(t *testing.T) {
+	router := NewFakeTemplateRouter()
+	router.sharedStrings = newStringStore()
+
+	// The first route is added to the state, the second is interned like
+	// the routes held by the informer cache.
+	first := sharedCertRoute(0)
+	router.AddRoute(first)
+	second := sharedCertRoute(1)
+	router.InternRoute(second)
+
+	if !sameString(first.Spec.TLS.Certificate, second.Spec.TLS.Certificate) || !sameString(first.Spec.TLS.Key, second.Spec.TLS.Key) {
+		t.Fatalf("expected the certificate and key of the routes to be shared")
+	}
+	for _, cert := range router.state[routeKey(first)].Certificates {
+		if !sameString(cert.Contents, first.Spec.TLS.Certificate) && !sameString(cert.Contents, first.Spec.TLS.CACertificate) {
+			t.Errorf("expected certificate %s of the router state to be shared", cert.ID)
+		}
+	}
+
+	router.RemoveRoute(first)
+	router.pruneStrings()
+	if len(router.sharedStrings.values) != 0 {
+		t.Errorf("expected no shared values once the state is empty, got %d", len(router.sharedStrings.values))
+	}
+}
+
+// BenchmarkStateMemory reports the heap used per route by the router state
+// and the routes of a large router whose routes share a wildcard
+// certificate.
+func BenchmarkStateMemory(b *testing.B) {
+	const routes = 30000
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("shared=%t", shared), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				router := NewFakeTemplateRouter()
+				if shared {
+					router.sharedStrings = newStringStore()
+				}
+				before := heapAlloc()
+				cache := make([]*routev1.Route, routes)
+				for j := range cache {
+					cache[j] = sharedCertRoute(j)
+					router.InternRoute(cache[j])
+					router.AddRoute(cache[j])
+				}
+				b.ReportMetric(float64(heapAlloc()-before)/routes, "heap-bytes/route")
+				runtime.KeepAlive(cache)
+				runtime.KeepAlive(router)
+			}
+		})
+	}
+}
+
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
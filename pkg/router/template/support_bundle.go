@@ -0,0 +1,170 @@
+package templaterouter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var (
+	// privateKeyPattern matches the PEM blocks of private keys.
+	privateKeyPattern = regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`)
+	// statsAuthPattern matches the credentials of the stats endpoint.
+	statsAuthPattern = regexp.MustCompile(`(?m)^(\s*stats\s+auth\s+)\S+`)
+	// ipv4Pattern and ipv6Pattern match the runs of characters that may be
+	// IPv4 or IPv6 addresses, which are parsed before they are anonymized.
+	// The IP addresses of the endpoints are also part of their server
+	// names, after a colon.
+	ipv4Pattern = regexp.MustCompile(`[0-9.]+`)
+	ipv6Pattern = regexp.MustCompile(`[0-9a-fA-F:]*:[0-9a-fA-F:]*:[0-9a-fA-F:]*`)
+)
+
+// redactedStatsAuth replaces the credentials of the stats endpoint.
+const redactedStatsAuth = "REDACTED"
+
+// SupportBundleOptions configures the support bundle of a router.
+type SupportBundleOptions struct {
+	// AnonymizeIPs replaces the IP addresses in the bundle, other than the
+	// loopback and unspecified addresses, with placeholders that are
+	// consistent across the files of the bundle.
+	AnonymizeIPs bool
+}
+
+// ipAnonymizer replaces IP addresses with numbered placeholders.
+type ipAnonymizer struct {
+	placeholders map[string]string
+	// addresses are the IPv6 addresses of the endpoints, longest first.
+	// As a server name and the address and port of the server may
+	// themselves parse as an IPv6 address, these are looked for first.
+	addresses []string
+}
+
+func newIPAnonymizer(serviceUnits map[ServiceUnitKey]ServiceUnit) *ipAnonymizer {
+	a := &ipAnonymizer{placeholders: map[string]string{}}
+	addresses := sets.NewString()
+	for _, unit := range serviceUnits {
+		for _, endpoint := range unit.EndpointTable {
+			if strings.Contains(endpoint.IP, ":") {
+				addresses.Insert(endpoint.IP)
+			}
+		}
+	}
+	a.addresses = addresses.List()
+	sort.SliceStable(a.addresses, func(i, j int) bool { return len(a.addresses[i]) > len(a.addresses[j]) })
+	return a
+}
+
+func (a *ipAnonymizer) anonymize(data []byte) []byte {
+	data = ipv4Pattern.ReplaceAllFunc(data, a.replace)
+	return ipv6Pattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		for i := range match {
+			if i > 0 && (match[i-1] != ':' || match[i] == ':') {
+				continue
+			}
+			rest := match[i:]
+			for _, address := range a.addresses {
+				if bytes.HasPrefix(rest, []byte(address)) && (len(rest) == len(address) || rest[len(address)] == ':') {
+					replaced := append(append([]byte{}, match[:i]...), a.replace([]byte(address))...)
+					return append(replaced, rest[len(address):]...)
+				}
+			}
+		}
+		return a.replace(match)
+	})
+}
+
+// replace returns the placeholder of match if it is an IP address to
+// anonymize, or match.
+func (a *ipAnonymizer) replace(match []byte) []byte {
+	ip := net.ParseIP(string(match))
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return match
+	}
+	key := ip.String()
+	placeholder, ok := a.placeholders[key]
+	if !ok {
+		placeholder = fmt.Sprintf("IP-%d", len(a.placeholders)+1)
+		a.placeholders[key] = placeholder
+	}
+	return []byte(placeholder)
+}
+
+// redactConfig removes the private keys and the stats credentials from a
+// configuration file.
+func redactConfig(data []byte) []byte {
+	data = privateKeyPattern.ReplaceAll(data, []byte(redactedPrivateKey))
+	return statsAuthPattern.ReplaceAll(data, []byte("${1}"+redactedStatsAuth))
+}
+
+// WriteSupportBundle writes a gzipped tarball of the configuration files of
+// the router, its state snapshot and its recent reloads to w, for support
+// cases.  The private keys and the stats credentials are redacted, while the
+// host names are preserved.
+func (r *templateRouter) WriteSupportBundle(w io.Writer, options SupportBundleOptions) error {
+	files := map[string][]byte{}
+
+	r.lock.Lock()
+	for name := range r.templates {
+		data, err := os.ReadFile(filepath.Join(r.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			r.lock.Unlock()
+			return fmt.Errorf("unable to read config file %s: %v", name, err)
+		}
+		files[name] = redactConfig(data)
+	}
+	snapshot := newStateSnapshot(r.state, r.serviceUnits)
+	anonymizer := newIPAnonymizer(r.serviceUnits)
+	r.lock.Unlock()
+
+	state, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	files["state.json"] = state
+	reloads, err := json.MarshalIndent(r.ReloadHistory(), "", "  ")
+	if err != nil {
+		return err
+	}
+	files["reloads.json"] = reloads
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range names {
+		data := files[name]
+		if options.AnonymizeIPs {
+			data = anonymizer.anonymize(data)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
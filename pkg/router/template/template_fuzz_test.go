@@ -0,0 +1,251 @@
+package templaterouter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router/controller"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+const (
+	// fuzzTemplateEnv overrides the template rendered by the fuzz targets.
+	fuzzTemplateEnv = "ROUTER_FUZZ_TEMPLATE"
+	// fuzzHAProxyEnv is the haproxy binary used to check every rendered
+	// configuration.  The check is skipped if it is not set, as it needs
+	// the files of the router image the configuration refers to.
+	fuzzHAProxyEnv = "ROUTER_FUZZ_HAPROXY"
+
+	defaultFuzzTemplate = "../../../images/router/haproxy/conf/haproxy-config.template"
+)
+
+var (
+	fuzzHarnessOnce sync.Once
+	fuzzHarness     *templateFuzzHarness
+	fuzzHarnessErr  error
+)
+
+// templateFuzzHarness renders the router template for a single route so that
+// fuzz targets can check how user controlled route fields end up in the
+// haproxy configuration.
+type templateFuzzHarness struct {
+	lock    sync.Mutex
+	router  *templateRouter
+	workdir string
+	haproxy string
+}
+
+// getTemplateFuzzHarness returns the harness shared by all fuzz targets, as
+// the router registers its metrics globally and can only be created once.
+func getTemplateFuzzHarness(tb testing.TB) *templateFuzzHarness {
+	fuzzHarnessOnce.Do(func() {
+		fuzzHarness, fuzzHarnessErr = newTemplateFuzzHarness()
+	})
+	if fuzzHarnessErr != nil {
+		tb.Fatalf("unable to create the template fuzz harness: %v", fuzzHarnessErr)
+	}
+	return fuzzHarness
+}
+
+func newTemplateFuzzHarness() (*templateFuzzHarness, error) {
+	templatePath := os.Getenv(fuzzTemplateEnv)
+	if len(templatePath) == 0 {
+		templatePath = defaultFuzzTemplate
+	}
+	workdir, err := ioutil.TempDir("", "router-fuzz")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(workdir, whitelistDir), 0775); err != nil {
+		return nil, err
+	}
+
+	plugin, err := NewTemplatePlugin(TemplatePluginConfig{
+		WorkingDir:              workdir,
+		DefaultCertificateDir:   workdir,
+		TemplatePath:            templatePath,
+		ReloadFn:                func(shutdown bool) error { return nil },
+		ConfigSnippetDirectives: sets.NewString(),
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	router := plugin.Router.(*templateRouter)
+
+	service := ServiceUnitKey("fuzz/svc")
+	router.CreateServiceUnit(service)
+	router.AddEndpoints(service, []Endpoint{
+		{ID: "ep1", IP: "10.0.0.1", Port: "8080"},
+		{ID: "ep2", IP: "10.0.0.2", Port: "8080"},
+	})
+
+	return &templateFuzzHarness{
+		router:  router,
+		workdir: workdir,
+		haproxy: os.Getenv(fuzzHAProxyEnv),
+	}, nil
+}
+
+// fuzzRoute returns an edge route to the harness service.
+func fuzzRoute() *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "fuzz",
+			Name:        "route",
+			Annotations: map[string]string{},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "fuzz.example.com",
+			To:   routev1.RouteTargetReference{Name: "svc"},
+			TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+		},
+	}
+}
+
+// render returns the haproxy configuration with route as the only route.
+func (h *templateFuzzHarness) render(t *testing.T, route *routev1.Route) string {
+	t.Helper()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.router.AddRoute(route)
+	defer h.router.RemoveRoute(route)
+
+	h.router.lock.Lock()
+	err := h.router.writeConfig()
+	h.router.lock.Unlock()
+	if err != nil {
+		t.Fatalf("unable to render the template: %v", err)
+	}
+
+	config, err := ioutil.ReadFile(filepath.Join(h.workdir, "conf", "haproxy.config"))
+	if err != nil {
+		t.Fatalf("unable to read the rendered configuration: %v", err)
+	}
+	if len(h.haproxy) > 0 {
+		out, err := exec.Command(h.haproxy, "-c", "-q", "-f", filepath.Join(h.workdir, "conf", "haproxy.config")).CombinedOutput()
+		if err != nil {
+			t.Fatalf("haproxy rejected the rendered configuration: %v\n%s", err, out)
+		}
+	}
+	return string(config)
+}
+
+// checkNoInjection fails if value, which was rendered into config, adds
+// lines or sections to the configuration that are not in baseline.
+func checkNoInjection(t *testing.T, value, config, baseline string) {
+	t.Helper()
+	if sections(config) != sections(baseline) {
+		t.Fatalf("value %q changed the configuration sections:\n%s", value, config)
+	}
+
+	baselineLines := sets.NewString()
+	for _, line := range strings.Split(baseline, "\n") {
+		baselineLines.Insert(strings.TrimSpace(line))
+	}
+	configLines := sets.NewString()
+	for _, line := range strings.Split(config, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.IndexFunc(line, func(r rune) bool { return unicode.IsControl(r) && r != '\t' }) >= 0 {
+			t.Fatalf("value %q added a control character to the configuration line %q", value, line)
+		}
+		configLines.Insert(line)
+	}
+	for _, part := range strings.Split(strings.ReplaceAll(value, "\r", "\n"), "\n")[1:] {
+		part = strings.TrimSpace(part)
+		if len(part) > 0 && configLines.Has(part) && !baselineLines.Has(part) {
+			t.Fatalf("value %q added the line %q to the configuration", value, part)
+		}
+	}
+}
+
+// sections returns the section headers of an haproxy configuration.
+func sections(config string) string {
+	var headers []string
+	for _, line := range strings.Split(config, "\n") {
+		if len(line) > 0 && !unicode.IsSpace(rune(line[0])) && line[0] != '#' {
+			headers = append(headers, line)
+		}
+	}
+	return strings.Join(headers, "\n")
+}
+
+// fuzzAnnotation checks that any value of an annotation renders safely.
+func fuzzAnnotation(f *testing.F, annotation string, seeds ...string) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	h := getTemplateFuzzHarness(f)
+	f.Fuzz(func(t *testing.T, value string) {
+		route := fuzzRoute()
+		baseline := h.render(t, route)
+		route.Annotations[annotation] = value
+		checkNoInjection(t, value, h.render(t, route), baseline)
+	})
+}
+
+func FuzzTemplateHost(f *testing.F) {
+	for _, seed := range []string{"fuzz.example.com", "a.b.c", "UPPER.example.com", "x.example.com\nbackend x", "*.example.com"} {
+		f.Add(seed)
+	}
+	h := getTemplateFuzzHarness(f)
+	f.Fuzz(func(t *testing.T, host string) {
+		route := fuzzRoute()
+		baseline := h.render(t, route)
+		route.Spec.Host = host
+		if len(host) == 0 || len(controller.ValidateHostName(route)) > 0 {
+			// Such routes are rejected before they reach the template.
+			return
+		}
+		checkNoInjection(t, host, h.render(t, route), baseline)
+	})
+}
+
+func FuzzTemplatePath(f *testing.F) {
+	for _, seed := range []string{"/", "/path", "/a/b.c", "/%2e%2e/", "/x\nbackend x", "path"} {
+		f.Add(seed)
+	}
+	h := getTemplateFuzzHarness(f)
+	f.Fuzz(func(t *testing.T, path string) {
+		route := fuzzRoute()
+		baseline := h.render(t, route)
+		route.Spec.Path = path
+		if !strings.HasPrefix(path, "/") {
+			// Such routes are rejected before they reach the template.
+			return
+		}
+		checkNoInjection(t, path, h.render(t, route), baseline)
+	})
+}
+
+func FuzzTemplateCookieName(f *testing.F) {
+	fuzzAnnotation(f, "router.openshift.io/cookie_name", "session", "a-b_c", "bad name", "x\nbackend x", "")
+}
+
+func FuzzTemplateWhitelist(f *testing.F) {
+	fuzzAnnotation(f, ipWhitelistAnnotation, "10.0.0.1", "10.0.0.0/8 192.168.1.1", "::1 fd00::/8", "10.0.0.1\nbackend x", "not-an-ip")
+}
+
+func FuzzTemplateHSTSHeader(f *testing.F) {
+	fuzzAnnotation(f, "haproxy.router.openshift.io/hsts_header", "max-age=31536000;includeSubDomains;preload", "max-age=0", "max-age=1\nbackend x", fmt.Sprintf("max-age=%d", 1<<40))
+}
+
+func FuzzTemplateResponseHeaderPolicy(f *testing.F) {
+	fuzzAnnotation(f, routeapihelpers.ResponseHeaderPolicyAnnotation, "delete X-Powered-By; replace Server router", "keep Via", "replace Server a\nbackend x", "replace Server a\"b", "replace Server %[src]")
+}
+
+func FuzzTemplateHostRewrite(f *testing.F) {
+	fuzzAnnotation(f, "haproxy.router.openshift.io/rewrite-host", "service", "backend.example.com", "backend.example.com:8443", "x\nbackend x", "a b")
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
-	"net"
 	"os"
 	"path"
 	"regexp"
@@ -17,6 +16,7 @@ import (
 
 	routev1 "github.com/openshift/api/route/v1"
 
+	"github.com/openshift/router/pkg/router/controller/endpointsubset"
 	"github.com/openshift/router/pkg/router/routeapihelpers"
 	templateutil "github.com/openshift/router/pkg/router/template/util"
 	haproxyutil "github.com/openshift/router/pkg/router/template/util/haproxy"
@@ -177,16 +177,21 @@ func processEndpointsForAlias(alias ServiceAliasConfig, svc ServiceUnit, action
 	return endpoints
 }
 
+// endpointsForAlias returns the endpoints of svc that serve the target port
+// of a route, falling back for the addresses that do not expose it as
+// endpointsubset.SelectTargetPort does.
 func endpointsForAlias(alias ServiceAliasConfig, svc ServiceUnit) []Endpoint {
 	if len(alias.PreferPort) == 0 {
 		return svc.EndpointTable
 	}
-	endpoints := make([]Endpoint, 0, len(svc.EndpointTable))
-	for i := range svc.EndpointTable {
-		endpoint := svc.EndpointTable[i]
-		if endpoint.PortName == alias.PreferPort || endpoint.Port == alias.PreferPort {
-			endpoints = append(endpoints, endpoint)
-		}
+	ports := make([]endpointsubset.AddressPort, 0, len(svc.EndpointTable))
+	for _, endpoint := range svc.EndpointTable {
+		ports = append(ports, endpointsubset.AddressPort{Address: endpoint.IP, Name: endpoint.PortName, Port: endpoint.Port})
+	}
+	selected, _ := endpointsubset.SelectTargetPort(ports, alias.PreferPort)
+	endpoints := make([]Endpoint, 0, len(selected))
+	for _, i := range selected {
+		endpoints = append(endpoints, svc.EndpointTable[i])
 	}
 	return endpoints
 }
@@ -194,13 +199,16 @@ func endpointsForAlias(alias ServiceAliasConfig, svc ServiceUnit) []Endpoint {
 // backendConfig returns a haproxy backend config for a given service alias.
 func backendConfig(name string, cfg ServiceAliasConfig, hascert bool) *haproxyutil.BackendConfig {
 	return &haproxyutil.BackendConfig{
-		Name:           name,
-		Host:           cfg.Host,
-		Path:           cfg.Path,
-		IsWildcard:     cfg.IsWildcard,
-		Termination:    cfg.TLSTermination,
-		InsecurePolicy: cfg.InsecureEdgeTerminationPolicy,
-		HasCertificate: hascert,
+		Name:                 name,
+		Host:                 cfg.Host,
+		Path:                 cfg.Path,
+		IsWildcard:           cfg.IsWildcard,
+		Termination:          cfg.TLSTermination,
+		InsecurePolicy:       cfg.InsecureEdgeTerminationPolicy,
+		HasCertificate:       hascert,
+		AllowSNIHostMismatch: cfg.AllowSNIHostMismatch,
+		ActiveColor:          cfg.ActiveColor,
+		RedirectsToHost:      len(cfg.RedirectHost.Host) > 0 && !cfg.RedirectHostLoop,
 	}
 }
 
@@ -209,21 +217,12 @@ func generateHAProxyCertConfigMap(td templateData) []string {
 	lines := make([]string, 0)
 	for k, cfg := range td.State {
 		cfg := cfg // avoid implicit memory aliasing (gosec G601)
-		hascert := false
-		if len(cfg.Host) > 0 {
-			certKey := generateCertKey(&cfg)
-			cert, ok := cfg.Certificates[certKey]
-			hascert = ok && len(cert.Contents) > 0
+		// the certificates that lost a conflict are not presented.
+		if _, ok := td.CertificateConflicts[k]; ok {
+			continue
 		}
-
-		backendConfig := backendConfig(string(k), cfg, hascert)
-		if entry := haproxyutil.GenerateMapEntry(certConfigMap, backendConfig); entry != nil {
-			fqCertPath := path.Join(td.WorkingDir, certDir, entry.Key)
-			if td.DisableHTTP2 {
-				lines = append(lines, strings.Join([]string{fqCertPath, entry.Value}, " "))
-			} else {
-				lines = append(lines, strings.Join([]string{fqCertPath, "[alpn h2,http/1.1]", entry.Value}, " "))
-			}
+		if entry, ok := crtListEntry(td.WorkingDir, k, &cfg, td.DisableHTTP2); ok {
+			lines = append(lines, versionedCrtListOptions(entry, td.HAProxyCapabilities).String())
 		}
 	}
 
@@ -255,7 +254,7 @@ func getHTTPAliasesGroupedByHost(aliases map[ServiceAliasConfigKey]ServiceAliasC
 	result := make(map[string]map[ServiceAliasConfigKey]ServiceAliasConfig)
 
 	for k, a := range aliases {
-		if a.TLSTermination == routev1.TLSTerminationPassthrough {
+		if a.TLSTermination == routev1.TLSTerminationPassthrough || a.TCPPort != 0 {
 			continue
 		}
 
@@ -310,12 +309,26 @@ func generateHAProxyMap(name string, td templateData) []string {
 
 	lines := make([]string, 0)
 	for k, cfg := range td.State {
-		backendConfig := backendConfig(string(k), cfg, false)
-		if entry := haproxyutil.GenerateMapEntry(name, backendConfig); entry != nil {
+		if entry := routeMapEntry(name, k, cfg); entry != nil {
 			lines = append(lines, fmt.Sprintf("%s %s", entry.Key, entry.Value))
 		}
 	}
 
+	return sortMapLines(lines)
+}
+
+// routeMapEntry returns the entry of a route in a map, if it has one.
+func routeMapEntry(name string, k ServiceAliasConfigKey, cfg ServiceAliasConfig) *haproxyutil.HAProxyMapEntry {
+	// TCP routes are reached through their dedicated port, not their host.
+	if cfg.TCPPort != 0 {
+		return nil
+	}
+	return haproxyutil.GenerateMapEntry(name, backendConfig(string(k), cfg, false))
+}
+
+// sortMapLines sorts the lines of a map in the order haproxy must match
+// them: the longest paths first and the wildcards last.
+func sortMapLines(lines []string) []string {
 	return templateutil.SortMapPaths(lines, `^[^\.]*\.`)
 }
 
@@ -360,34 +373,51 @@ func clipHAProxyTimeoutValue(val string) string {
 }
 
 // parseIPList parses white space separated list of IPs/CIDRs (IPv4/IPv6)
-// aims at providing the same behavior as the previous approach with regexp in the template file
+// and returns the valid ones.  Invalid entries and the entries past the
+// maximum are ignored rather than the whole list, so that a whitelist never
+// allows more addresses than it lists.
 func parseIPList(list string) string {
 	log.V(7).Info("parseIPList called", "value", list)
 
-	trimmedList := strings.TrimSpace(list)
-	if trimmedList == "" {
-		return ""
-	}
-
-	// same behavior as the previous approach with regexp
-	if trimmedList != list {
-		log.V(7).Info("parseIPList leading/trailing spaces found")
-		return ""
-	}
-
-	ipList := strings.Fields(list)
-	for _, ip := range ipList {
-		if net.ParseIP(ip) == nil {
-			if _, _, err := net.ParseCIDR(ip); err != nil {
-				log.V(7).Info("parseIPList found not IP/CIDR item", "value", ip, "err", err)
-				return ""
-			}
+	ipList := []string{}
+	for _, ip := range strings.Fields(list) {
+		if !routeapihelpers.IsIPOrCIDR(ip) {
+			log.V(0).Info("parseIPList found not IP/CIDR item, ignoring it", "value", ip)
+			continue
 		}
+		ipList = append(ipList, ip)
+	}
+	if len(ipList) > haproxyutil.HAPROXY_MAX_WHITELIST_ENTRIES {
+		// Dropping the whitelist would allow every address, truncate it
+		// instead so the addresses past the limit are denied.
+		log.V(0).Info("parseIPList found too many items, ignoring the items past the maximum", "count", len(ipList), "max", haproxyutil.HAPROXY_MAX_WHITELIST_ENTRIES)
+		ipList = ipList[:haproxyutil.HAPROXY_MAX_WHITELIST_ENTRIES]
 	}
+	list = strings.Join(ipList, " ")
 	log.V(7).Info("parseIPList parsed the list", "value", list)
 	return list
 }
 
+// partialSectionPrefix prefixes the names of the sections of the template
+// that other sections include to share their content.  They are not files
+// of their own.
+const partialSectionPrefix = "partial/"
+
+// ServerData is the data the partial sections of the servers of a backend
+// are rendered with.
+type ServerData struct {
+	// Config is the configuration of the route of the backend.
+	Config ServiceAliasConfig
+	// Endpoint is the endpoint of the server.
+	Endpoint Endpoint
+}
+
+// serverData returns the data of the partial sections for the server of
+// endpoint in the backend of a route.
+func serverData(cfg ServiceAliasConfig, endpoint Endpoint) ServerData {
+	return ServerData{Config: cfg, Endpoint: endpoint}
+}
+
 var helperFunctions = template.FuncMap{
 	"endpointsForAlias":        endpointsForAlias,        //returns the list of valid endpoints
 	"processEndpointsForAlias": processEndpointsForAlias, //returns the list of valid endpoints after processing them
@@ -408,9 +438,20 @@ var helperFunctions = template.FuncMap{
 	"getPrimaryAliasKey":          getPrimaryAliasKey,          //returns the key of the primary alias for a group of aliases
 
 	"generateHAProxyMap":           generateHAProxyMap,           //generates a haproxy map content
+	"mapFiles":                     mapFiles,                     //returns the shards of a haproxy map
 	"validateHAProxyWhiteList":     validateHAProxyWhiteList,     //validates a haproxy whitelist (acl) content
 	"generateHAProxyWhiteListFile": generateHAProxyWhiteListFile, //generates a haproxy whitelist file for use in an acl
 
 	"clipHAProxyTimeoutValue": clipHAProxyTimeoutValue, //clips extrodinarily high timeout values to be below the maximum allowed timeout value
 	"parseIPList":             parseIPList,             //parses the list of IPs/CIDRs (IPv4/IPv6)
+
+	"backendOverride": backendOverride, //returns the data of the override/backend section for the backend of a route
+	"serverData":      serverData,      //returns the data of the partial sections for a server of the backend of a route
+
+	"blueGreenColors":    blueGreenColors,    //returns the color suffixes of the backends of a route
+	"hasColor":           hasColor,           //determines if a service unit belongs to the backend of a route with a color suffix
+	"hasBlueGreenRoutes": hasBlueGreenRoutes, //determines if the services of any route are split into a blue and a green set
+
+	"strictSNI": strictSNI, //returns the strict-sni bind option if haproxy supports it
+	"quicBinds": quicBinds, //returns the QUIC addresses to bind if QUIC is enabled and haproxy supports it
 }
@@ -12,6 +12,8 @@ import (
 	"testing"
 
 	routev1 "github.com/openshift/api/route/v1"
+
+	haproxyutil "github.com/openshift/router/pkg/router/template/util/haproxy"
 )
 
 func buildServiceAliasConfig(name, namespace, host, path string, termination routev1.TLSTerminationType, policy routev1.InsecureEdgeTerminationPolicyType, wildcard bool) ServiceAliasConfig {
@@ -739,6 +741,25 @@ func TestProcessEndpointsForAlias(t *testing.T) {
 		Port:   "bar",
 		IdHash: fmt.Sprintf("%x", md5.Sum([]byte("ep3ipport"))),
 	}
+	ep4 := Endpoint{
+		ID:       "ep4",
+		IP:       "ip",
+		Port:     "8080",
+		PortName: "http",
+		IdHash:   fmt.Sprintf("%x", md5.Sum([]byte("ep4ipport"))),
+	}
+	ep5 := Endpoint{
+		ID:     "ep5",
+		IP:     "ip2",
+		Port:   "8080",
+		IdHash: fmt.Sprintf("%x", md5.Sum([]byte("ep5ipport"))),
+	}
+	ep6 := Endpoint{
+		ID:     "ep6",
+		IP:     "ip3",
+		Port:   "9090",
+		IdHash: fmt.Sprintf("%x", md5.Sum([]byte("ep6ipport"))),
+	}
 
 	testCases := []struct {
 		name           string
@@ -758,6 +779,18 @@ func TestProcessEndpointsForAlias(t *testing.T) {
 			endpoints:      []Endpoint{ep1, ep2, ep3},
 			expectedLength: 2,
 		},
+		{
+			name:           "named port resolved to its number on endpoints without port names",
+			preferPort:     "http",
+			endpoints:      []Endpoint{ep4, ep5, ep6},
+			expectedLength: 2,
+		},
+		{
+			name:           "single port inferred for a named port no endpoint exposes",
+			preferPort:     "web",
+			endpoints:      []Endpoint{ep5, ep6},
+			expectedLength: 2,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -887,6 +920,7 @@ func TestParseIPList(t *testing.T) {
 	testCases := []struct {
 		name          string
 		input         string
+		expected      string
 		expectedEmpty bool
 	}{
 		{
@@ -914,10 +948,9 @@ func TestParseIPList(t *testing.T) {
 			input: "192.168.15.15",
 		},
 		{
-			// as behavior as the previous (regexp) approach
-			name:          "Leading and trailing spaces",
-			input:         " 192.168.10.10  ",
-			expectedEmpty: true,
+			name:     "Leading and trailing spaces",
+			input:    " 192.168.10.10  ",
+			expected: "192.168.10.10",
 		},
 		{
 			name:          "Only white spaces",
@@ -950,9 +983,16 @@ func TestParseIPList(t *testing.T) {
 			expectedEmpty: true,
 		},
 		{
-			name:          "Wrong IP in a list",
-			input:         "192.168.1.0 2001:0db8:85a3:0000:0000:8a2e:0370:7334 172.16.14.10/24 2001:0db8:85a3::8a2e:370:10/64 64:ff9b::192.168.0.1 10.",
-			expectedEmpty: true,
+			name:     "Too many entries",
+			input:    strings.TrimSpace(strings.Repeat("10.0.0.1 ", haproxyutil.HAPROXY_MAX_WHITELIST_ENTRIES) + "10.0.0.2"),
+			expected: strings.TrimSpace(strings.Repeat("10.0.0.1 ", haproxyutil.HAPROXY_MAX_WHITELIST_ENTRIES)),
+		},
+		{
+			// The list is kept without the invalid entry rather than
+			// dropped, which would allow every address.
+			name:     "Wrong IP in a list",
+			input:    "192.168.1.0 2001:0db8:85a3:0000:0000:8a2e:0370:7334 10. 172.16.14.10/24 2001:0db8:85a3::8a2e:370:10/64 64:ff9b::192.168.0.1",
+			expected: "192.168.1.0 2001:0db8:85a3:0000:0000:8a2e:0370:7334 172.16.14.10/24 2001:0db8:85a3::8a2e:370:10/64 64:ff9b::192.168.0.1",
 		},
 	}
 
@@ -965,8 +1005,12 @@ func TestParseIPList(t *testing.T) {
 				}
 				return
 			}
-			if got != tc.input {
-				t.Errorf("Failure: expected %q, got %q", tc.input, got)
+			expected := tc.input
+			if len(tc.expected) > 0 {
+				expected = tc.expected
+			}
+			if got != expected {
+				t.Errorf("Failure: expected %q, got %q", expected, got)
 			}
 		})
 	}
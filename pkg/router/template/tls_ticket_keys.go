@@ -0,0 +1,163 @@
+package templaterouter
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// tlsTicketKeysFile is the file, relative to the working directory,
+	// that holds the TLS session ticket keys managed by the router.
+	tlsTicketKeysFile = "router/tls-ticket-keys"
+
+	// tlsTicketKeyCount is the number of keys haproxy loads from the keys
+	// file.  haproxy encrypts tickets with the penultimate key and decrypts
+	// them with any of the keys.
+	tlsTicketKeyCount = 3
+
+	// tlsTicketKeySize is the size of an AES-256 ticket key.
+	tlsTicketKeySize = 80
+
+	// statsSocketFile is the haproxy stats socket, relative to the working
+	// directory, through which new ticket keys are pushed.
+	statsSocketFile = "run/haproxy.sock"
+)
+
+// tlsTicketKeys manages the TLS session ticket keys file shared by the
+// frontends that terminate TLS, so that tickets stay valid across reloads
+// and are encrypted with keys that are rotated on schedule.
+type tlsTicketKeys struct {
+	path string
+	keys []string
+
+	// random and push allow the keys to be tested.
+	random io.Reader
+	push   func(key string) error
+}
+
+// newTLSTicketKeys returns the ticket keys stored at path, or new keys if
+// the file does not hold enough valid keys.
+func newTLSTicketKeys(path string, push func(key string) error) (*tlsTicketKeys, error) {
+	k := &tlsTicketKeys{path: path, random: rand.Reader, push: push}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		for _, key := range strings.Fields(string(data)) {
+			if raw, err := base64.StdEncoding.DecodeString(key); err == nil && len(raw) == tlsTicketKeySize {
+				k.keys = append(k.keys, key)
+			}
+		}
+	}
+	if len(k.keys) >= tlsTicketKeyCount {
+		k.keys = k.keys[len(k.keys)-tlsTicketKeyCount:]
+		return k, nil
+	}
+
+	k.keys = nil
+	for i := 0; i < tlsTicketKeyCount; i++ {
+		key, err := k.newKey()
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, key)
+	}
+	return k, k.write()
+}
+
+// newKey returns a new random key, base64 encoded as haproxy expects.
+func (k *tlsTicketKeys) newKey() (string, error) {
+	raw := make([]byte, tlsTicketKeySize)
+	if _, err := io.ReadFull(k.random, raw); err != nil {
+		return "", fmt.Errorf("unable to generate a TLS ticket key: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// write replaces the keys file with the current keys.
+func (k *tlsTicketKeys) write() error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(k.keys, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("unable to write the TLS ticket keys: %v", err)
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// rotate replaces the oldest key with a new one.  The new key is pushed to
+// the running haproxy so that it does not need a reload to use it, and is
+// loaded from the keys file by the next haproxy process in any case.
+func (k *tlsTicketKeys) rotate() error {
+	key, err := k.newKey()
+	if err != nil {
+		return err
+	}
+	k.keys = append(k.keys[1:], key)
+	if err := k.write(); err != nil {
+		return err
+	}
+	if k.push != nil {
+		if err := k.push(key); err != nil {
+			return fmt.Errorf("unable to push the new TLS ticket key to haproxy, it is used after the next reload: %v", err)
+		}
+	}
+	return nil
+}
+
+// pushTLSTicketKey sets the next ticket key of the keys file at path in the
+// haproxy listening on the stats socket at socketPath.
+func pushTLSTicketKey(socketPath, path, key string) error {
+	// The stats socket closes the connection after a single command, like
+	// the master CLI does.
+	out, err := newMasterCLI(socketPath).execute(fmt.Sprintf("set ssl tls-key %s %s", path, key))
+	if err == errMasterNotRunning {
+		return fmt.Errorf("haproxy is not running")
+	} else if err != nil {
+		return err
+	}
+	if !strings.Contains(out, "TLS ticket key updated") {
+		return fmt.Errorf("unexpected response: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// RunTLSTicketKeyRotation rotates the TLS session ticket keys of the router
+// every rotation interval until stopCh is closed.
+func (r *templateRouter) RunTLSTicketKeyRotation(stopCh <-chan struct{}) error {
+	if r.tlsTicketKeys == nil {
+		return fmt.Errorf("the TLS ticket keys are not managed by the router")
+	}
+	go func() {
+		ticker := time.NewTicker(r.tlsSession.TicketKeyRotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if err := r.tlsTicketKeys.rotate(); err != nil {
+					log.Error(err, "failed to rotate the TLS ticket keys")
+					continue
+				}
+				log.V(2).Info("rotated the TLS ticket keys", "path", r.tlsTicketKeys.path)
+			}
+		}
+	}()
+	return nil
+}
+
+// tlsTicketKeysFile returns the TLS session ticket keys file managed by the
+// router, or an empty string if haproxy manages its own keys.
+func (r *templateRouter) tlsTicketKeysFile() string {
+	if r.tlsTicketKeys == nil {
+		return ""
+	}
+	return r.tlsTicketKeys.path
+}
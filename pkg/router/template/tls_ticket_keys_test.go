@@ -0,0 +1,146 @@
+package templaterouter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSTicketKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-ticket-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, tlsTicketKeysFile)
+
+	var pushed []string
+	var pushErr error
+	push := func(key string) error {
+		pushed = append(pushed, key)
+		return pushErr
+	}
+
+	keys, err := newTLSTicketKeys(path, push)
+	if err != nil {
+		t.Fatalf("unable to create the keys: %v", err)
+	}
+	if len(keys.keys) != tlsTicketKeyCount {
+		t.Fatalf("expected %d keys, got %d", tlsTicketKeyCount, len(keys.keys))
+	}
+	for _, key := range keys.keys {
+		if raw, err := base64.StdEncoding.DecodeString(key); err != nil || len(raw) != tlsTicketKeySize {
+			t.Fatalf("invalid key %q", key)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the keys file to only be readable by its owner, got %v, %v", info, err)
+	}
+	initial := keys.keys
+
+	// The keys are kept across restarts of the router.
+	keys, err = newTLSTicketKeys(path, push)
+	if err != nil {
+		t.Fatalf("unable to load the keys: %v", err)
+	}
+	if strings.Join(keys.keys, ",") != strings.Join(initial, ",") {
+		t.Fatalf("expected the keys %v to be loaded, got %v", initial, keys.keys)
+	}
+
+	keys.random = bytes.NewReader(bytes.Repeat([]byte{1}, tlsTicketKeySize))
+	if err := keys.rotate(); err != nil {
+		t.Fatalf("unable to rotate the keys: %v", err)
+	}
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, tlsTicketKeySize))
+	expected := append(append([]string{}, initial[1:]...), newKey)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected the keys %v after the rotation, got %v", expected, got)
+	}
+	if len(pushed) != 1 || pushed[0] != newKey {
+		t.Fatalf("expected the new key to be pushed, got %v", pushed)
+	}
+
+	// The keys file is rotated even if haproxy cannot be updated.
+	pushErr = fmt.Errorf("haproxy is not running")
+	keys.random = rand.Reader
+	if err := keys.rotate(); err == nil {
+		t.Fatalf("expected the push error to be reported")
+	}
+	if keys.keys[len(keys.keys)-2] != newKey {
+		t.Fatalf("expected the keys to be rotated, got %v", keys.keys)
+	}
+
+	// Files without enough valid keys are replaced.
+	if err := ioutil.WriteFile(path, []byte("not-a-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = newTLSTicketKeys(path, push)
+	if err != nil {
+		t.Fatalf("unable to create the keys: %v", err)
+	}
+	if len(keys.keys) != tlsTicketKeyCount || keys.keys[0] == "not-a-key" {
+		t.Fatalf("expected new keys, got %v", keys.keys)
+	}
+}
+
+func TestTLSSessionConfigTemplate(t *testing.T) {
+	renderer, err := NewRenderer(RendererConfig{
+		TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+		WorkingDir:   "/var/lib/haproxy",
+		BindPorts:    true,
+		TLSSession: TLSSessionConfig{
+			DisableTickets: map[string]bool{"fe_no_sni": true},
+			CacheSize:      50000,
+			Lifetime:       10 * time.Minute,
+		},
+		TLSTicketKeysFile: "/var/lib/haproxy/router/tls-ticket-keys",
+	})
+	if err != nil {
+		t.Fatalf("unable to create the renderer: %v", err)
+	}
+	files, err := renderer.Render(RenderState{})
+	if err != nil {
+		t.Fatalf("unable to render: %v", err)
+	}
+
+	var config string
+	for _, file := range files {
+		if file.Name == "conf/haproxy.config" {
+			config = string(file.Contents)
+		}
+	}
+	binds := 0
+	for _, line := range strings.Split(config, "\n") {
+		switch {
+		case strings.Contains(line, "bind unix@/var/lib/haproxy/run/haproxy-sni.sock"):
+			binds++
+			if !strings.HasSuffix(line, " tls-ticket-keys /var/lib/haproxy/router/tls-ticket-keys") {
+				t.Errorf("expected fe_sni to use the managed ticket keys: %q", line)
+			}
+		case strings.Contains(line, "bind unix@/var/lib/haproxy/run/haproxy-no-sni.sock"):
+			binds++
+			if !strings.HasSuffix(line, " no-tls-tickets") {
+				t.Errorf("expected fe_no_sni to disable tickets: %q", line)
+			}
+		}
+	}
+	if binds != 2 {
+		t.Errorf("expected the binds of fe_sni and fe_no_sni, found %d", binds)
+	}
+	for _, expected := range []string{"  tune.ssl.cachesize 50000\n", "  tune.ssl.lifetime 600000ms\n"} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected %q in the rendered configuration", expected)
+		}
+	}
+}
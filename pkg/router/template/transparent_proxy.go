@@ -0,0 +1,94 @@
+package templaterouter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// capNetAdmin is the number of the CAP_NET_ADMIN capability, which
+// transparent proxying needs to bind the connections to the backends to the
+// addresses of the clients.
+const capNetAdmin = 12
+
+// CheckTransparentProxy returns an error explaining why haproxy cannot
+// connect to the backends from the addresses of the clients: haproxy was
+// built without transparent proxy support, the router lacks the
+// CAP_NET_ADMIN capability, or the sysctls of the network namespace of the
+// router would drop the replies of the backends.
+func CheckTransparentProxy(capabilities *HAProxyCapabilities) error {
+	return checkTransparentProxy(capabilities, "/proc")
+}
+
+// checkTransparentProxy checks the requirements of transparent proxying
+// with the proc filesystem under procRoot.
+func checkTransparentProxy(capabilities *HAProxyCapabilities, procRoot string) error {
+	if !capabilities.HasFeature("TPROXY") && !capabilities.HasFeature("LINUX_TPROXY") {
+		return fmt.Errorf("haproxy %s was built without transparent proxy support", capabilities.Version)
+	}
+
+	permitted, err := hasEffectiveCapability(filepath.Join(procRoot, "self", "status"), capNetAdmin)
+	if err != nil {
+		return fmt.Errorf("unable to read the capabilities of the router: %v", err)
+	}
+	if !permitted {
+		return fmt.Errorf("transparent proxying is not permitted, the router needs the NET_ADMIN capability")
+	}
+
+	forward, err := readSysctl(procRoot, "net/ipv4/ip_forward")
+	if err != nil {
+		return err
+	}
+	if forward != "1" {
+		return fmt.Errorf("transparent proxying requires the net.ipv4.ip_forward sysctl to be 1 so that the router forwards the replies of the backends, got %s", forward)
+	}
+	rpFilter, err := readSysctl(procRoot, "net/ipv4/conf/all/rp_filter")
+	if err != nil {
+		return err
+	}
+	if rpFilter == "1" {
+		return fmt.Errorf("transparent proxying requires the net.ipv4.conf.all.rp_filter sysctl to be 0 or 2, strict reverse path filtering drops the replies of the backends")
+	}
+	return nil
+}
+
+// readSysctl returns the value of the sysctl at path under the sys directory
+// of procRoot.
+func readSysctl(procRoot, path string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(procRoot, "sys", path))
+	if err != nil {
+		return "", fmt.Errorf("unable to read the %s sysctl: %v", strings.ReplaceAll(path, "/", "."), err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// hasEffectiveCapability returns true if the CapEff mask of the process
+// status file at path has capability.
+func hasEffectiveCapability(path string, capability uint) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value := strings.TrimPrefix(scanner.Text(), "CapEff:")
+		if value == scanner.Text() {
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid capability mask %q", strings.TrimSpace(value))
+		}
+		return mask&(1<<capability) != 0, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("no CapEff found in %s", path)
+}
@@ -0,0 +1,135 @@
+package templaterouter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestCheckTransparentProxy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		features []string
+		capEff   string
+		forward  string
+		rpFilter string
+		err      string
+	}{
+		{
+			name:     "permitted",
+			features: []string{"TPROXY"},
+			capEff:   "00000000a80435fb",
+			forward:  "1",
+			rpFilter: "2",
+		},
+		{
+			name:     "no transparent proxy support",
+			features: []string{"EPOLL"},
+			capEff:   "00000000a80435fb",
+			forward:  "1",
+			rpFilter: "0",
+			err:      "built without transparent proxy support",
+		},
+		{
+			name:     "no NET_ADMIN",
+			features: []string{"LINUX_TPROXY"},
+			capEff:   "00000000a80425fb",
+			forward:  "1",
+			rpFilter: "0",
+			err:      "NET_ADMIN",
+		},
+		{
+			name:     "no forwarding",
+			features: []string{"TPROXY"},
+			capEff:   "00000000a80435fb",
+			forward:  "0",
+			rpFilter: "0",
+			err:      "net.ipv4.ip_forward",
+		},
+		{
+			name:     "strict reverse path filtering",
+			features: []string{"TPROXY"},
+			capEff:   "00000000a80435fb",
+			forward:  "1",
+			rpFilter: "1",
+			err:      "net.ipv4.conf.all.rp_filter",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			procRoot := t.TempDir()
+			for path, contents := range map[string]string{
+				"self/status":                     "Name:\trouter\nCapInh:\t0000000000000000\nCapEff:\t" + tc.capEff + "\n",
+				"sys/net/ipv4/ip_forward":         tc.forward + "\n",
+				"sys/net/ipv4/conf/all/rp_filter": tc.rpFilter + "\n",
+			} {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(procRoot, path)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(procRoot, path), []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			capabilities := &HAProxyCapabilities{Version: "2.8.5", Major: 2, Minor: 8, Features: sets.NewString(tc.features...)}
+			err := checkTransparentProxy(capabilities, procRoot)
+			switch {
+			case len(tc.err) == 0 && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case len(tc.err) > 0 && (err == nil || !strings.Contains(err.Error(), tc.err)):
+				t.Errorf("expected an error about %s, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestTransparentProxyTemplate(t *testing.T) {
+	routes := []*routev1.Route{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "http"},
+			Spec:       routev1.RouteSpec{Host: "http.example.com", To: routev1.RouteTargetReference{Name: "svc"}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "passthrough"},
+			Spec: routev1.RouteSpec{
+				Host: "passthrough.example.com",
+				To:   routev1.RouteTargetReference{Name: "svc"},
+				TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationPassthrough},
+			},
+		},
+	}
+	for _, transparent := range []bool{false, true} {
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath:     "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:       "/var/lib/haproxy",
+			BindPorts:        true,
+			TransparentProxy: transparent,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		files, err := renderer.Render(renderer.RouteState(routes))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		var config string
+		for _, file := range files {
+			if file.Name == "conf/haproxy.config" {
+				config = string(file.Contents)
+			}
+		}
+		expected := 0
+		if transparent {
+			expected = 2
+		}
+		if count := strings.Count(config, "\n  source 0.0.0.0 usesrc clientip\n"); count != expected {
+			t.Errorf("expected %d backends to connect from the client addresses with transparent proxying %v, got %d", expected, transparent, count)
+		}
+	}
+}
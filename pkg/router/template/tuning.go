@@ -0,0 +1,227 @@
+package templaterouter
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxThreads is the highest number of threads haproxy is built to run.
+const maxThreads = 64
+
+// TuningConfig overrides the tuning of the haproxy process the router
+// otherwise derives from the CPUs of its pod.
+type TuningConfig struct {
+	// Threads is the number of threads haproxy runs.  Zero derives it from
+	// the CPU limit and the CPU set of the pod.
+	Threads int
+
+	// DisableCPUPinning keeps the threads of haproxy from being pinned to
+	// the CPUs of the pod when the pod has exclusive CPUs.
+	DisableCPUPinning bool
+
+	// BufSize is the size in bytes of the buffers of haproxy.  Zero keeps
+	// the template default.
+	BufSize int
+
+	// MaxRewrite is the space in bytes reserved in the buffers for
+	// rewriting headers.  Zero keeps the template default.
+	MaxRewrite int
+}
+
+// HAProxyTuning is the tuning of the haproxy process rendered in the global
+// section of the configuration.
+type HAProxyTuning struct {
+	// Threads is the number of threads haproxy runs, zero for the haproxy
+	// default.
+	Threads int
+
+	// CPUMap are the cpu-map directives pinning the threads of haproxy to
+	// CPUs.
+	CPUMap []string
+
+	// BufSize and MaxRewrite are the tune.bufsize and tune.maxrewrite of
+	// haproxy, zero for the template defaults.
+	BufSize    int
+	MaxRewrite int
+}
+
+// cpuTopology are the CPUs the router pod may run on.
+type cpuTopology struct {
+	// cpus are the CPUs the process is allowed to run on.
+	cpus []int
+
+	// quota is the number of CPUs worth of time the pod may use, zero if
+	// it is not limited.
+	quota float64
+}
+
+// detectCPUTopology returns the CPUs the router may run on, read from the
+// status of the process under procRoot and the CPU limit of its cgroup under
+// cgroupRoot.
+func detectCPUTopology(procRoot, cgroupRoot string) (cpuTopology, error) {
+	var topology cpuTopology
+
+	cpus, err := readAllowedCPUs(filepath.Join(procRoot, "self", "status"))
+	if err != nil {
+		return topology, err
+	}
+	topology.cpus = cpus
+
+	quota, err := readCPUQuota(cgroupRoot)
+	if err != nil {
+		return topology, err
+	}
+	topology.quota = quota
+	return topology, nil
+}
+
+// readAllowedCPUs parses the Cpus_allowed_list of the process status at
+// path.
+func readAllowedCPUs(path string) ([]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Cpus_allowed_list:") {
+			continue
+		}
+		return parseCPUList(strings.TrimSpace(strings.TrimPrefix(line, "Cpus_allowed_list:")))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no Cpus_allowed_list in %s", path)
+}
+
+// parseCPUList parses a list of CPUs in the kernel list format, such as
+// "0-3,8,10-11".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(list, ",") {
+		if len(part) == 0 {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU list %q", list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// readCPUQuota returns the number of CPUs worth of time the cgroup under
+// cgroupRoot may use, zero if it is not limited.  Both the cgroup v2 cpu.max
+// and the cgroup v1 CFS quota are supported.
+func readCPUQuota(cgroupRoot string) (float64, error) {
+	if data, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpu.max")); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("invalid cpu.max %q", strings.TrimSpace(string(data)))
+		}
+		if fields[0] == "max" {
+			return 0, nil
+		}
+		return parseCPUQuota(fields[0], fields[1])
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	quota, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_quota_us"))
+	if os.IsNotExist(err) {
+		// No CPU controller, the pod is not limited.
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	period, err := ioutil.ReadFile(filepath.Join(cgroupRoot, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(string(quota)) == "-1" {
+		return 0, nil
+	}
+	return parseCPUQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// parseCPUQuota returns the number of CPUs a quota of CPU time per period
+// amounts to.
+func parseCPUQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, fmt.Errorf("invalid CPU quota %q", quota)
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, fmt.Errorf("invalid CPU period %q", period)
+	}
+	return float64(q) / float64(p), nil
+}
+
+// resolveTuning returns the tuning of haproxy for the CPUs of topology, with
+// the overrides of config.  Haproxy runs a thread per CPU it may use, the
+// CPU limit rounded up or the size of the CPU set if smaller.  When the pod
+// has exclusive CPUs, a whole CPU limit matching its CPU set, each thread is
+// pinned to a CPU so the threads do not move between the CPUs and their
+// caches.
+func resolveTuning(config TuningConfig, topology cpuTopology) HAProxyTuning {
+	tuning := HAProxyTuning{
+		Threads:    config.Threads,
+		BufSize:    config.BufSize,
+		MaxRewrite: config.MaxRewrite,
+	}
+
+	if tuning.Threads == 0 && len(topology.cpus) > 0 {
+		tuning.Threads = len(topology.cpus)
+		if topology.quota > 0 {
+			if limit := int(math.Ceil(topology.quota)); limit < tuning.Threads {
+				tuning.Threads = limit
+			}
+		}
+	}
+	if tuning.Threads > maxThreads {
+		tuning.Threads = maxThreads
+	}
+
+	exclusive := topology.quota > 0 && topology.quota == float64(len(topology.cpus))
+	if !config.DisableCPUPinning && exclusive && tuning.Threads == len(topology.cpus) {
+		for i, cpu := range topology.cpus {
+			tuning.CPUMap = append(tuning.CPUMap, fmt.Sprintf("1/%d %d", i+1, cpu))
+		}
+	}
+	return tuning
+}
+
+// autoTuning returns the tuning of haproxy for the CPUs of the router pod,
+// with the overrides of config.  The overrides are used as they are if the
+// CPUs cannot be detected.
+func autoTuning(config TuningConfig) HAProxyTuning {
+	topology, err := detectCPUTopology("/proc", "/sys/fs/cgroup")
+	if err != nil {
+		log.V(0).Info("unable to detect the CPUs of the router, using the haproxy defaults", "error", err)
+		topology = cpuTopology{}
+	}
+	tuning := resolveTuning(config, topology)
+	log.V(0).Info("tuning haproxy", "cpus", len(topology.cpus), "cpuLimit", topology.quota, "threads", tuning.Threads, "pinned", len(tuning.CPUMap) > 0)
+	return tuning
+}
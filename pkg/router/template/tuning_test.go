@@ -0,0 +1,200 @@
+package templaterouter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDetectCPUTopology tests that the CPU set and the CPU limit of the pod
+// are read with both cgroup versions.
+func TestDetectCPUTopology(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        string
+		files         map[string]string
+		expectedCPUs  []int
+		expectedQuota float64
+		expectError   bool
+	}{
+		{
+			name:          "cgroup v2 limited",
+			status:        "Name:\thaproxy\nCpus_allowed:\tff\nCpus_allowed_list:\t0-3,6\n",
+			files:         map[string]string{"cpu.max": "250000 100000\n"},
+			expectedCPUs:  []int{0, 1, 2, 3, 6},
+			expectedQuota: 2.5,
+		},
+		{
+			name:         "cgroup v2 unlimited",
+			status:       "Cpus_allowed_list:\t0-1\n",
+			files:        map[string]string{"cpu.max": "max 100000\n"},
+			expectedCPUs: []int{0, 1},
+		},
+		{
+			name:          "cgroup v1 limited",
+			status:        "Cpus_allowed_list:\t2\n",
+			files:         map[string]string{"cpu/cpu.cfs_quota_us": "100000\n", "cpu/cpu.cfs_period_us": "100000\n"},
+			expectedCPUs:  []int{2},
+			expectedQuota: 1,
+		},
+		{
+			name:         "cgroup v1 unlimited",
+			status:       "Cpus_allowed_list:\t0-7\n",
+			files:        map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"},
+			expectedCPUs: []int{0, 1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name:        "invalid cpu list",
+			status:      "Cpus_allowed_list:\t3-1\n",
+			expectError: true,
+		},
+		{
+			name:        "invalid cpu.max",
+			status:      "Cpus_allowed_list:\t0\n",
+			files:       map[string]string{"cpu.max": "0 100000\n"},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tuning")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			files := map[string]string{"proc/self/status": tc.status}
+			for name, contents := range tc.files {
+				files["cgroup/"+name] = contents
+			}
+			for name, contents := range files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			topology, err := detectCPUTopology(filepath.Join(dir, "proc"), filepath.Join(dir, "cgroup"))
+			if tc.expectError {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", topology)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(topology.cpus, tc.expectedCPUs) || topology.quota != tc.expectedQuota {
+				t.Errorf("expected cpus %v and quota %v, got %v and %v", tc.expectedCPUs, tc.expectedQuota, topology.cpus, topology.quota)
+			}
+		})
+	}
+}
+
+func TestResolveTuning(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   TuningConfig
+		topology cpuTopology
+		expected HAProxyTuning
+	}{
+		{
+			name:     "undetected",
+			expected: HAProxyTuning{},
+		},
+		{
+			name:     "unlimited",
+			topology: cpuTopology{cpus: []int{0, 1, 2, 3}},
+			expected: HAProxyTuning{Threads: 4},
+		},
+		{
+			name:     "fractional limit",
+			topology: cpuTopology{cpus: []int{0, 1, 2, 3, 4, 5, 6, 7}, quota: 2.5},
+			expected: HAProxyTuning{Threads: 3},
+		},
+		{
+			name:     "limit above the cpu set",
+			topology: cpuTopology{cpus: []int{0, 1}, quota: 4},
+			expected: HAProxyTuning{Threads: 2},
+		},
+		{
+			name:     "exclusive cpus",
+			topology: cpuTopology{cpus: []int{4, 5, 9}, quota: 3},
+			expected: HAProxyTuning{Threads: 3, CPUMap: []string{"1/1 4", "1/2 5", "1/3 9"}},
+		},
+		{
+			name:     "exclusive cpus without pinning",
+			config:   TuningConfig{DisableCPUPinning: true},
+			topology: cpuTopology{cpus: []int{4, 5}, quota: 2},
+			expected: HAProxyTuning{Threads: 2},
+		},
+		{
+			name:     "overridden threads are not pinned",
+			config:   TuningConfig{Threads: 1, BufSize: 65536, MaxRewrite: 16384},
+			topology: cpuTopology{cpus: []int{4, 5}, quota: 2},
+			expected: HAProxyTuning{Threads: 1, BufSize: 65536, MaxRewrite: 16384},
+		},
+		{
+			name:     "large nodes",
+			topology: cpuTopology{cpus: make([]int, 128)},
+			expected: HAProxyTuning{Threads: maxThreads},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tuning := resolveTuning(tc.config, tc.topology); !reflect.DeepEqual(tuning, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, tuning)
+			}
+		})
+	}
+}
+
+// TestTuningTemplate tests that the tuning is rendered in the global
+// section, and that the defaults are kept without it.
+func TestTuningTemplate(t *testing.T) {
+	render := func(tuning HAProxyTuning) string {
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:   "/var/lib/haproxy",
+			Tuning:       tuning,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		files, err := renderer.Render(renderer.RouteState(nil))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		for _, file := range files {
+			if file.Name == "conf/haproxy.config" {
+				return string(file.Contents)
+			}
+		}
+		t.Fatalf("no haproxy.config rendered")
+		return ""
+	}
+
+	config := render(HAProxyTuning{Threads: 2, CPUMap: []string{"1/1 4", "1/2 5"}, BufSize: 65536, MaxRewrite: 16384})
+	for _, line := range []string{"  nbthread 2\n", "  cpu-map 1/1 4\n", "  cpu-map 1/2 5\n", "  tune.bufsize 65536\n", "  tune.maxrewrite 16384\n"} {
+		if !strings.Contains(config, line) {
+			t.Errorf("expected %q in the configuration", line)
+		}
+	}
+
+	config = render(HAProxyTuning{})
+	if strings.Contains(config, "nbthread") || strings.Contains(config, "cpu-map") {
+		t.Errorf("expected no threads without tuning")
+	}
+	for _, line := range []string{"  tune.bufsize 32768\n", "  tune.maxrewrite 8192\n"} {
+		if !strings.Contains(config, line) {
+			t.Errorf("expected %q in the configuration", line)
+		}
+	}
+}
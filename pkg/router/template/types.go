@@ -5,6 +5,7 @@ import (
 	"time"
 
 	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 )
 
 // ServiceUnit represents a service and its endpoints.
@@ -29,6 +30,8 @@ type ServiceAliasConfig struct {
 	Name string
 	// Namespace is the namespace of the route.
 	Namespace string
+	// CreationTimestamp is when the route was created.
+	CreationTimestamp time.Time
 	// Host is a required host name ie. www.example.com
 	Host string
 	// Path is an optional path ie. www.example.com/myservice where "myservice" is the path
@@ -40,6 +43,11 @@ type ServiceAliasConfig struct {
 	// VerifyServiceHostname is true if the backend service(s) are expected to have serving certificates that sign for
 	// the name "service.namespace.svc".
 	VerifyServiceHostname bool
+	// DestinationVerifyHostname is the name the serving certificates of the backend of a reencrypt route are
+	// verified against instead of the service hostname.
+	DestinationVerifyHostname string
+	// DestinationMinTLSVersion is the minimum TLS version used to connect to the backend of a reencrypt route.
+	DestinationMinTLSVersion string
 	// Indicates the status of configuration that needs to be persisted.  Right now this only
 	// includes the certificates and is not an indicator of being written to the underlying
 	// router implementation
@@ -69,11 +77,153 @@ type ServiceAliasConfig struct {
 	// to each endpoint in the service.
 	ServiceUnitNames map[ServiceUnitKey]int32
 
+	// WeightByEndpoints applies the weight of each service to each of its
+	// endpoints rather than dividing it among them.
+	WeightByEndpoints bool
+
+	// AllowSNIHostMismatch exempts the route from the SNI host mismatch
+	// policy of the router.
+	AllowSNIHostMismatch bool
+
 	// ActiveServiceUnits is a count of the service units with a non-zero weight
 	ActiveServiceUnits int
 
 	// ActiveEndpoints is a count of the route endpoints that are part of a service unit with a non-zero weight
 	ActiveEndpoints int
+
+	// GRPCOverride is whether the route says its backends serve gRPC, or
+	// nil if it is detected from the appProtocol of its endpoints.
+	GRPCOverride *bool
+
+	// GRPC is true if the backends of the route serve gRPC, and the
+	// defaults suited to gRPC apply to the route.
+	GRPC bool
+
+	// Cookie are the attributes of the session affinity cookie of the
+	// route.
+	Cookie routeapihelpers.CookieOptions
+
+	// LeastRequestWeighting is true if the weights of the servers of the
+	// route are lowered for their outstanding requests.
+	LeastRequestWeighting bool
+
+	// ConsistentHash is the key of the consistent hash the requests of
+	// the route are balanced with, if any.
+	ConsistentHash routeapihelpers.ConsistentHash
+
+	// AccessLog sets which requests of the route are logged, if the route
+	// does not log like the other routes.
+	AccessLog routeapihelpers.AccessLog
+
+	// BackupService is the service whose servers are backup servers, which
+	// only receive traffic when all the other servers of the route are down.
+	// Empty if the route has no backup service.
+	BackupService ServiceUnitKey
+
+	// GreenServiceUnits are the services of the green set of the route,
+	// its other services form the blue set.  Each set is served by a
+	// backend of its own.  Empty if the services are not split.
+	GreenServiceUnits map[ServiceUnitKey]bool
+
+	// ActiveColor is the set of services that receives the traffic of
+	// the route by default, "blue" or "green".  Requests reach the other
+	// set with the override cookie or header.  Empty if the services are
+	// not split.
+	ActiveColor string
+
+	// BackendHostHeader is the Host header requests are rewritten to
+	// before being sent to the backend.  Empty if the header is not rewritten.
+	BackendHostHeader string
+
+	// Maintenance is true if the route is in one of its maintenance
+	// windows or outside of its active windows, in which case its servers
+	// are disabled.
+	Maintenance bool
+
+	// TCPPort is the dedicated router port a TCP route is exposed on in TCP
+	// mode.  Zero for routes that are reached through their host.
+	TCPPort int32
+
+	// TCPOptions are the options of the connections to the backends of
+	// the route.
+	TCPOptions routeapihelpers.BackendTCPOptions
+
+	// TunnelTimeout is the tunnel timeout of the route raised to its
+	// server timeout, if the timeouts of the route made it shorter.
+	TunnelTimeout string
+
+	// ConnectionPool are the options of the pool of idle connections to
+	// the backends of the route.
+	ConnectionPool routeapihelpers.ConnectionPoolOptions
+
+	// Queue are the options of the queues of the requests to the backends
+	// of the route.
+	Queue routeapihelpers.QueueOptions
+
+	// HTTPCompat are the HTTP/1 compatibility options of the route for
+	// legacy clients and backends.
+	HTTPCompat routeapihelpers.HTTPCompatOptions
+
+	// SetForwardedHeaders is the policy for the Forwarded and
+	// X-Forwarded-* headers of the requests to the route.
+	SetForwardedHeaders string
+
+	// ALPNProtocols are the ALPN protocols advertised for the host of the
+	// route, in order of preference.  The router defaults are advertised
+	// if it is empty.
+	ALPNProtocols []string
+
+	// Bandwidth are the bandwidth limits of the route.
+	Bandwidth routeapihelpers.BandwidthLimits
+
+	// ResponseCache is the cache of the responses of the route, which it
+	// only has if it fits in the response cache budget of the router.
+	ResponseCache routeapihelpers.ResponseCache
+
+	// ExternalServers are the options of the servers of the route whose
+	// endpoints are not pods.
+	ExternalServers routeapihelpers.ExternalServerOptions
+
+	// DenyRules match the requests of the route denied by the router.
+	DenyRules []routeapihelpers.DenyRule
+
+	// RedirectRules redirect the requests of the route instead of
+	// forwarding them to its backends.
+	RedirectRules []routeapihelpers.RedirectRule
+
+	// RedirectHost redirects the requests of the route to https on a
+	// canonical host, if its Host is set.
+	RedirectHost routeapihelpers.RedirectHost
+
+	// RedirectHostLoop is true if the canonical hosts of the route and of
+	// other routes redirect requests back to the route.  The redirect of the
+	// route is left out of the configuration until the loop is broken.
+	RedirectHostLoop bool
+
+	// WAF is true if the requests of the route are sent to the web
+	// application firewall agent of the router.
+	WAF bool
+
+	// ResponseHeaderRules are the router wide and route rules applied to
+	// the response headers of the route, in order.
+	ResponseHeaderRules []routeapihelpers.ResponseHeaderRule
+
+	// Tracing are the request ID and tracing headers set on the requests
+	// of the route.
+	Tracing routeapihelpers.TracingOptions
+
+	// URINormalizers are the haproxy normalize-uri normalizers applied to
+	// requests in the backend of the route.
+	URINormalizers []string
+
+	// HealthCheckMaxInterval is how far the health check interval of the
+	// route grows while its servers stay healthy, zero to use the router
+	// wide maximum.
+	HealthCheckMaxInterval time.Duration
+
+	// ConfigSnippet are the raw configuration lines appended to the backend
+	// of the route.
+	ConfigSnippet []string
 }
 
 type ServiceAliasConfigStatus string
@@ -104,6 +254,22 @@ type Endpoint struct {
 	IdHash        string
 	NoHealthCheck bool
 	AppProtocol   string
+	// NodeName and Zone are the node and zone of the endpoint, if known.
+	NodeName string
+	Zone     string
+	// External is true if the endpoint is not a pod, e.g. an address of
+	// another cluster listed in the EndpointSlice of a service without a
+	// selector.  The cluster IPs of idled services are not external.
+	External bool
+	// Backup is true if the endpoint does not serve the zone of the
+	// router, so that it only receives traffic when the endpoints that do
+	// are down.
+	Backup bool
+	// Labels are the allowed labels of the pod of the endpoint.
+	Labels map[string]string
+	// SlotName is the slot of its service the server of the endpoint is
+	// named after, if the router names the servers so.
+	SlotName string
 }
 
 // certificateManager provides the ability to write certificates for a ServiceAliasConfig
@@ -114,6 +280,10 @@ type certificateManager interface {
 	DeleteCertificatesForConfig(config *ServiceAliasConfig) error
 	// Commit commits all the changes made to the certificateManager.
 	Commit() error
+	// ReconcileCertificates rewrites the certificates of configs and
+	// removes the other files of the certificate directories, except for
+	// the files in keep.
+	ReconcileCertificates(configs []*ServiceAliasConfig, keep []string) error
 	// CertificateWriter provides direct access to the underlying writer if required
 	CertificateWriter() certificateWriter
 }
@@ -174,6 +344,11 @@ type ConfigManagerOptions struct {
 
 	// ExtendedValidation indicates if extended route validation is enabled.
 	ExtendedValidation bool
+
+	// BatchErrorThreshold is the share of the commands of a batch sent to
+	// the underlying router that may fail and be retried one by one.  Above
+	// it, the changes are applied with a reload.
+	BatchErrorThreshold float64
 }
 
 // ConfigManager is used by the router to make configuration changes using
@@ -210,6 +385,28 @@ type ConfigManager interface {
 	// RemoveRouteEndpoints removes a set of endpoints from a route.
 	RemoveRouteEndpoints(id ServiceAliasConfigKey, endpoints []Endpoint) error
 
+	// ReplaceRouteWhitelist replaces the allowed source addresses in the
+	// acl file used by a route.
+	ReplaceRouteWhitelist(id ServiceAliasConfigKey, whitelistFile string, cidrs []string) error
+
+	// SetRouteActiveColor points the map entries of a route whose
+	// services are split into a blue and a green set at the backend of
+	// the given color.
+	SetRouteActiveColor(id ServiceAliasConfigKey, backendName, color string) error
+
+	// SetRouteMaintenance puts the servers of a route in maintenance, or
+	// takes them out of it.
+	SetRouteMaintenance(id ServiceAliasConfigKey, maintenance bool) error
+
+	// AddCertificate loads a certificate from its PEM contents and adds
+	// its entry to a crt-list, replacing the certificate if it is already
+	// loaded.
+	AddCertificate(crtList string, entry CrtListEntry, pem []byte) error
+
+	// RemoveCertificate removes the entry of a certificate file from a
+	// crt-list and unloads the certificate.
+	RemoveCertificate(crtList, certFile string) error
+
 	// Notify notifies a configuration manager of a router event.
 	// Currently the only ones that are received are on reload* events,
 	// which indicates whether or not the configuration manager should
@@ -293,3 +490,73 @@ const (
 func (s ServiceUnit) TemplateSafeName() string {
 	return strings.Replace(s.Name, "/", "-", -1)
 }
+
+// TLSSessionConfig configures how clients resume the TLS sessions of the
+// frontends that terminate TLS.
+type TLSSessionConfig struct {
+	// DisableTickets are the frontends, "fe_sni" and "fe_no_sni", that do
+	// not issue TLS session tickets.
+	DisableTickets map[string]bool
+
+	// CacheSize is the number of sessions kept for resumption by session
+	// ID.  Zero keeps the haproxy default.
+	CacheSize int
+
+	// Lifetime is how long sessions can be resumed by session ID.  Zero
+	// keeps the haproxy default.
+	Lifetime time.Duration
+
+	// TicketKeyRotationInterval is how often the router rotates the keys
+	// that encrypt session tickets.  Zero leaves the keys to haproxy, which
+	// generates new ones on every reload.
+	TicketKeyRotationInterval time.Duration
+}
+
+const (
+	// SNIHostMismatchReject rejects TLS requests whose SNI does not match
+	// their Host header with a 421 Misdirected Request response.
+	SNIHostMismatchReject = "reject"
+	// SNIHostMismatchDefaultBackend sends TLS requests whose SNI does not
+	// match their Host header to the default backend.
+	SNIHostMismatchDefaultBackend = "default-backend"
+)
+
+const (
+	// WAFFailOpen forwards the requests the web application firewall agent
+	// fails to process.
+	WAFFailOpen = "fail-open"
+	// WAFFailClosed denies the requests the web application firewall agent
+	// fails to process with a 503.
+	WAFFailClosed = "fail-closed"
+)
+
+// WAFConfig configures the web application firewall agent the router sends
+// the requests of the routes that enable it to over SPOE.
+type WAFConfig struct {
+	// AgentAddress is the host:port of the agent.  Empty if the router has
+	// no agent.
+	AgentAddress string
+
+	// ConnectTimeout is how long connecting to the agent may take.
+	ConnectTimeout time.Duration
+
+	// ProcessingTimeout is how long the agent may take to process a
+	// request.
+	ProcessingTimeout time.Duration
+
+	// FailClosed denies the requests the agent fails to process, instead
+	// of forwarding them.
+	FailClosed bool
+}
+
+// AdaptiveHealthCheckConfig configures how the health check intervals of
+// backends adapt to their stability.
+type AdaptiveHealthCheckConfig struct {
+	// MaxInterval is how far the health check interval of a backend grows
+	// while its servers stay healthy.  Zero keeps the intervals fixed.
+	MaxInterval time.Duration
+
+	// StablePeriod is how long the servers of a backend stay healthy
+	// before its health check interval doubles.
+	StablePeriod time.Duration
+}
@@ -0,0 +1,414 @@
+package haproxy
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// aclNamePattern matches the names haproxy accepts for ACLs.
+var aclNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// timePattern matches haproxy time values.
+var timePattern = regexp.MustCompile(`^[0-9]+(us|ms|s|m|h|d)?$`)
+
+// predefinedACLs are the ACLs haproxy defines itself.
+var predefinedACLs = sets.NewString(
+	"FALSE", "HTTP", "HTTP_1.0", "HTTP_1.1", "HTTP_2.0", "HTTP_3.0", "HTTP_CONTENT",
+	"HTTP_URL_ABS", "HTTP_URL_SLASH", "HTTP_URL_STAR", "LOCALHOST", "METH_CONNECT",
+	"METH_DELETE", "METH_GET", "METH_HEAD", "METH_OPTIONS", "METH_POST", "METH_PUT",
+	"METH_TRACE", "RDP_COOKIE", "REQ_CONTENT", "TRUE", "WAIT_END",
+)
+
+// lintAction describes the arguments of an http-request or http-response
+// action.
+type lintAction struct {
+	// args is the minimum number of arguments of the action.
+	args int
+	// regexArg is the position of the regular expression argument of the
+	// action, starting at 1, or 0 if it has none.
+	regexArg int
+}
+
+// lintActions are the http-request and http-response actions the linter
+// knows the arguments of.
+var lintActions = map[string]lintAction{
+	"add-header":     {args: 2},
+	"allow":          {},
+	"del-header":     {args: 1},
+	"deny":           {},
+	"normalize-uri":  {args: 1},
+	"redirect":       {args: 2},
+	"replace-header": {args: 3, regexArg: 2},
+	"replace-path":   {args: 2, regexArg: 1},
+	"replace-pathq":  {args: 2, regexArg: 1},
+	"replace-uri":    {args: 2, regexArg: 1},
+	"replace-value":  {args: 3, regexArg: 2},
+	"set-header":     {args: 2},
+	"set-path":       {args: 1},
+	"set-pathq":      {args: 1},
+	"set-query":      {args: 1},
+	"set-status":     {args: 1},
+	"set-uri":        {args: 1},
+	"set-var":        {args: 1},
+	"unset-var":      {args: 1},
+	"tarpit":         {},
+}
+
+// lintBalanceAlgorithms are the load balancing algorithms haproxy knows.
+var lintBalanceAlgorithms = sets.NewString(
+	"roundrobin", "static-rr", "leastconn", "first", "source", "uri", "url_param",
+	"hdr", "random", "rdp-cookie", "hash",
+)
+
+// definiteRegexpErrors are the errors of Go regular expressions that PCRE
+// reports as well.  Other errors come from syntax PCRE supports but Go does
+// not, such as lookarounds.
+var definiteRegexpErrors = map[syntax.ErrorCode]bool{
+	syntax.ErrMissingParen:          true,
+	syntax.ErrUnexpectedParen:       true,
+	syntax.ErrMissingBracket:        true,
+	syntax.ErrTrailingBackslash:     true,
+	syntax.ErrMissingRepeatArgument: true,
+	syntax.ErrInvalidCharRange:      true,
+}
+
+// LintConfigLines checks backend configuration lines for the errors haproxy
+// would report on the directives the router emits: quoting, ACL names and
+// references, regular expressions and map references.  It reports these
+// errors with the line they are on before haproxy is run, but does not know
+// the names of the fetches, converters, timeouts and options of haproxy, so
+// lines that pass must still be checked by haproxy.
+func LintConfigLines(lines []string) error {
+	acls := sets.NewString()
+	for i, line := range lines {
+		args, err := splitConfigLine(line)
+		if err == nil {
+			err = lintConfigLine(args, acls)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d %q: %v", i+1, line, err)
+		}
+	}
+	return nil
+}
+
+// splitConfigLine splits a configuration line into its arguments the way
+// haproxy does, handling quotes, escapes and comments.
+func splitConfigLine(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+			continue
+		case c == '\\':
+			if i+1 == len(line) {
+				return nil, fmt.Errorf("unfinished escape at the end of the line")
+			}
+			i++
+			switch e := line[i]; e {
+			case ' ', '#', '\\', '\'', '"', '$':
+				arg.WriteByte(e)
+			case 'r':
+				arg.WriteByte('\r')
+			case 'n':
+				arg.WriteByte('\n')
+			case 't':
+				arg.WriteByte('\t')
+			case 'x':
+				if i+2 >= len(line) {
+					return nil, fmt.Errorf("incomplete hexadecimal escape")
+				}
+				b, err := strconv.ParseUint(line[i+1:i+3], 16, 8)
+				if err != nil {
+					return nil, fmt.Errorf("invalid hexadecimal escape %q", line[i-1:i+3])
+				}
+				arg.WriteByte(byte(b))
+				i += 2
+			default:
+				// Other escapes are kept as they are, e.g. for regular
+				// expressions.
+				arg.WriteByte('\\')
+				arg.WriteByte(e)
+			}
+			inArg = true
+			continue
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '\'', '"':
+			quote = c
+			inArg = true
+		case ' ', '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		case '#':
+			i = len(line)
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unmatched quote %c", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) > HAPROXY_MAX_LINE_ARGS {
+		return nil, fmt.Errorf("too many arguments, at most %d are allowed", HAPROXY_MAX_LINE_ARGS)
+	}
+	return args, nil
+}
+
+// lintConfigLine checks the arguments of a single line and records the ACLs
+// it declares in acls.
+func lintConfigLine(args []string, acls sets.String) error {
+	if len(args) == 0 {
+		return nil
+	}
+	for _, arg := range args {
+		if err := lintExpression(arg); err != nil {
+			return err
+		}
+	}
+
+	switch args[0] {
+	case "acl":
+		return lintACL(args, acls)
+	case "http-request", "http-response":
+		return lintHTTPAction(args, acls)
+	case "timeout":
+		if len(args) != 3 {
+			return fmt.Errorf("timeout requires a name and a value")
+		}
+		if !timePattern.MatchString(args[2]) {
+			return fmt.Errorf("invalid time value %q", args[2])
+		}
+	case "balance":
+		if len(args) < 2 {
+			return fmt.Errorf("balance requires an algorithm")
+		}
+		name := args[1]
+		if i := strings.Index(name, "("); i >= 0 {
+			name = name[:i]
+		}
+		if !lintBalanceAlgorithms.Has(name) {
+			return fmt.Errorf("unknown balance algorithm %q", args[1])
+		}
+	}
+	return nil
+}
+
+// lintACL checks an acl declaration.
+func lintACL(args []string, acls sets.String) error {
+	if len(args) < 3 {
+		return fmt.Errorf("acl requires a name and a criterion")
+	}
+	name, criterion := args[1], args[2]
+	if !aclNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid ACL name %q", name)
+	}
+	acls.Insert(name)
+
+	fetch := strings.SplitN(criterion, ",", 2)[0]
+	if i := strings.Index(fetch, "("); i >= 0 {
+		fetch = fetch[:i]
+	}
+	if err := lintSample(criterion); err != nil {
+		return err
+	}
+	regex := strings.HasSuffix(fetch, "_reg")
+	values := args[3:]
+flags:
+	for len(values) > 0 && strings.HasPrefix(values[0], "-") {
+		flag := values[0]
+		values = values[1:]
+		switch flag {
+		case "--":
+			break flags
+		case "-i", "-n":
+		case "-m":
+			if len(values) == 0 {
+				return fmt.Errorf("flag -m requires a match method")
+			}
+			regex = values[0] == "reg"
+			values = values[1:]
+		case "-f", "-M", "-u":
+			if len(values) == 0 {
+				return fmt.Errorf("flag %s requires an argument", flag)
+			}
+			values = values[1:]
+		default:
+			// Negative numbers and unknown flags are left to haproxy.
+			return nil
+		}
+	}
+	if regex {
+		for _, value := range values {
+			if err := lintRegexp(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lintHTTPAction checks an http-request or http-response rule.
+func lintHTTPAction(args []string, acls sets.String) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%s requires an action", args[0])
+	}
+	actionArgs, condition := args[2:], []string(nil)
+	for i, arg := range actionArgs {
+		if arg == "if" || arg == "unless" {
+			actionArgs, condition = actionArgs[:i], actionArgs[i+1:]
+			if len(condition) == 0 {
+				return fmt.Errorf("missing condition after %q", arg)
+			}
+			break
+		}
+	}
+	if err := lintCondition(condition, acls); err != nil {
+		return err
+	}
+
+	action, ok := lintActions[args[1]]
+	if !ok {
+		return nil
+	}
+	if len(actionArgs) < action.args {
+		return fmt.Errorf("%s %s requires %d arguments", args[0], args[1], action.args)
+	}
+	if action.regexArg > 0 {
+		return lintRegexp(actionArgs[action.regexArg-1])
+	}
+	return nil
+}
+
+// lintCondition checks that a condition only refers to declared ACLs and
+// that its anonymous ACLs are well formed.
+func lintCondition(terms []string, acls sets.String) error {
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+		switch {
+		case term == "or" || term == "||":
+			if i == 0 || i == len(terms)-1 {
+				return fmt.Errorf("operator %q requires a term on both sides", term)
+			}
+		case term == "{" || term == "!{":
+			end := i + 1
+			for end < len(terms) && terms[end] != "}" {
+				end++
+			}
+			if end == len(terms) {
+				return fmt.Errorf("unmatched '{' in condition")
+			}
+			if end-i < 2 {
+				return fmt.Errorf("empty anonymous ACL in condition")
+			}
+			i = end
+		case strings.HasPrefix(term, "{") || strings.HasPrefix(term, "!{") || term == "}":
+			return fmt.Errorf("braces of anonymous ACLs must be separated by spaces in %q", term)
+		default:
+			name := strings.TrimPrefix(term, "!")
+			if !acls.Has(name) && !predefinedACLs.Has(name) {
+				return fmt.Errorf("no such ACL %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// lintExpression checks the log format expressions of an argument.
+func lintExpression(arg string) error {
+	for rest := arg; ; {
+		start := strings.Index(rest, "%[")
+		if start < 0 {
+			return nil
+		}
+		end := strings.Index(rest[start:], "]")
+		if end < 0 {
+			return fmt.Errorf("unterminated sample expression in %q", arg)
+		}
+		if err := lintSample(rest[start+2 : start+end]); err != nil {
+			return err
+		}
+		rest = rest[start+end+1:]
+	}
+}
+
+// lintSample checks a sample fetch and its converters: parentheses must be
+// balanced and map converters must refer to an absolute path.
+func lintSample(expr string) error {
+	depth, start := 0, 0
+	var parts []string
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("unbalanced parentheses in %q", expr)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in %q", expr)
+	}
+	parts = append(parts, expr[start:])
+
+	for _, part := range parts {
+		name, args := part, ""
+		if i := strings.Index(part, "("); i >= 0 {
+			name, args = part[:i], strings.TrimSuffix(part[i+1:], ")")
+		}
+		if name != "map" && !strings.HasPrefix(name, "map_") {
+			continue
+		}
+		if file := strings.SplitN(args, ",", 2)[0]; !strings.HasPrefix(file, "/") {
+			return fmt.Errorf("converter %s in %q must refer to a map file by absolute path", name, expr)
+		}
+	}
+	return nil
+}
+
+// lintRegexp checks a regular expression for the errors PCRE reports as
+// well.
+func lintRegexp(expr string) error {
+	_, err := syntax.Parse(expr, syntax.Perl)
+	if serr, ok := err.(*syntax.Error); ok && definiteRegexpErrors[serr.Code] {
+		return fmt.Errorf("invalid regular expression %q: %s", expr, serr.Code)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package haproxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitConfigLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+		err      bool
+	}{
+		{line: "  http-request  set-header X-A  b ", expected: []string{"http-request", "set-header", "X-A", "b"}},
+		{line: `http-response set-header X-A "a b" # comment`, expected: []string{"http-response", "set-header", "X-A", "a b"}},
+		{line: `http-response set-header X-A 'a \ "b'`, expected: []string{"http-response", "set-header", "X-A", `a \ "b`}},
+		{line: `http-request replace-path ^/a\.b(.*)$ /c\1`, expected: []string{"http-request", "replace-path", `^/a\.b(.*)$`, `/c\1`}},
+		{line: `http-request set-header X-A a\ b\x41\#`, expected: []string{"http-request", "set-header", "X-A", "a bA#"}},
+		{line: `http-request set-header X-A "a`, err: true},
+		{line: `http-request set-header X-A 'a`, err: true},
+		{line: `http-request set-header X-A a\`, err: true},
+		{line: `http-request set-header X-A \xZZ`, err: true},
+		{line: "# only a comment"},
+	}
+
+	for _, tc := range tests {
+		args, err := splitConfigLine(tc.line)
+		if (err != nil) != tc.err {
+			t.Errorf("%q: expected error %t, got %v", tc.line, tc.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tc.expected) {
+			t.Errorf("%q: expected %q, got %q", tc.line, tc.expected, args)
+		}
+	}
+}
+
+func TestLintConfigLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		err   bool
+	}{
+		{
+			name: "known directives",
+			lines: []string{
+				"acl api path_beg -i /api",
+				"acl legacy path_reg ^/v1/(users|groups)$",
+				"acl routed base,map_reg(/var/lib/haproxy/conf/os_http_be.map) -m found",
+				"http-request set-header X-Api true if api !legacy",
+				"http-request replace-path ^/api/(.*)$ /\\1 if api || { path_beg /internal }",
+				"http-response set-header X-Backend %[be_name,lower]",
+				"http-response del-header Server if TRUE",
+				"timeout server 30s",
+				"balance roundrobin",
+			},
+		},
+		{
+			name:  "unknown directive",
+			lines: []string{"option httplog"},
+		},
+		{
+			name:  "unknown action",
+			lines: []string{"http-request do-something"},
+		},
+		{
+			name:  "regexp with lookahead",
+			lines: []string{"http-request replace-path ^/(?!api)(.*)$ /web/\\1"},
+		},
+		{
+			name:  "pattern file",
+			lines: []string{"acl blocked src -f /etc/blocked.lst"},
+		},
+		{
+			name:  "unbalanced regexp",
+			lines: []string{"http-request replace-path ^/(api /"},
+			err:   true,
+		},
+		{
+			name:  "invalid acl regexp",
+			lines: []string{"acl bad path -m reg [a-"},
+			err:   true,
+		},
+		{
+			name:  "invalid acl name",
+			lines: []string{"acl bad/name path /"},
+			err:   true,
+		},
+		{
+			name:  "undefined acl",
+			lines: []string{"http-request deny if missing"},
+			err:   true,
+		},
+		{
+			name:  "acl used before it is defined",
+			lines: []string{"http-request deny if later", "acl later path /"},
+			err:   true,
+		},
+		{
+			name:  "unmatched anonymous acl",
+			lines: []string{"http-request deny if { path /"},
+			err:   true,
+		},
+		{
+			name:  "anonymous acl without spaces",
+			lines: []string{"http-request deny if {path /}"},
+			err:   true,
+		},
+		{
+			name:  "missing condition",
+			lines: []string{"http-request deny if"},
+			err:   true,
+		},
+		{
+			name:  "missing arguments",
+			lines: []string{"http-response set-header X-A"},
+			err:   true,
+		},
+		{
+			name:  "unterminated sample expression",
+			lines: []string{"http-response set-header X-A %[be_name"},
+			err:   true,
+		},
+		{
+			name:  "unbalanced sample expression",
+			lines: []string{"http-response set-header X-A %[req.hdr(host]"},
+			err:   true,
+		},
+		{
+			name:  "relative map",
+			lines: []string{"http-request set-header X-A %[base,map(os_http_be.map)]"},
+			err:   true,
+		},
+		{
+			name:  "invalid timeout",
+			lines: []string{"timeout server 30 seconds"},
+			err:   true,
+		},
+		{
+			name:  "invalid balance algorithm",
+			lines: []string{"balance fastest"},
+			err:   true,
+		},
+		{
+			name:  "unmatched quote",
+			lines: []string{`http-response set-header X-A "b`},
+			err:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := LintConfigLines(tc.lines)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
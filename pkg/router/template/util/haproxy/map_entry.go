@@ -21,7 +21,20 @@ func generateWildcardDomainMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 	return nil
 }
 
-// generateHttpMapEntry generates a map entry for insecure/http hosts.
+// routeBackendName returns the name of the backend the maps send the
+// requests for a route to, the backend of the active color if the route
+// has a blue and a green backend.
+func routeBackendName(cfg *BackendConfig) string {
+	name := fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(cfg.Termination), cfg.Name)
+	if len(cfg.ActiveColor) > 0 {
+		name += ":" + cfg.ActiveColor
+	}
+	return name
+}
+
+// generateHttpMapEntry generates a map entry for insecure/http hosts.  The
+// insecure requests of the routes that redirect them to a canonical host go
+// to their backend, which redirects them.
 func generateHttpMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 	if len(cfg.Host) == 0 {
 		return nil
@@ -32,6 +45,8 @@ func generateHttpMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 		needsHttpMap = true
 	} else if (cfg.Termination == routev1.TLSTerminationEdge || cfg.Termination == routev1.TLSTerminationReencrypt) && cfg.InsecurePolicy == routev1.InsecureEdgeTerminationPolicyAllow {
 		needsHttpMap = true
+	} else if (cfg.Termination == routev1.TLSTerminationEdge || cfg.Termination == routev1.TLSTerminationReencrypt) && cfg.InsecurePolicy == routev1.InsecureEdgeTerminationPolicyRedirect && cfg.RedirectsToHost {
+		needsHttpMap = true
 	}
 
 	if !needsHttpMap {
@@ -40,7 +55,7 @@ func generateHttpMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 
 	return &HAProxyMapEntry{
 		Key:   templateutil.GenerateRouteRegexp(cfg.Host, cfg.Path, cfg.IsWildcard),
-		Value: fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(cfg.Termination), cfg.Name),
+		Value: routeBackendName(cfg),
 	}
 }
 
@@ -52,7 +67,7 @@ func generateEdgeReencryptMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 
 	return &HAProxyMapEntry{
 		Key:   templateutil.GenerateRouteRegexp(cfg.Host, cfg.Path, cfg.IsWildcard),
-		Value: fmt.Sprintf("%s:%s", templateutil.GenerateBackendNamePrefix(cfg.Termination), cfg.Name),
+		Value: routeBackendName(cfg),
 	}
 }
 
@@ -65,7 +80,9 @@ func generateHttpRedirectMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 		}
 		switch cfg.InsecurePolicy {
 		case routev1.InsecureEdgeTerminationPolicyRedirect:
-			haproxyMapEntry.Value = "1"
+			if !cfg.RedirectsToHost {
+				haproxyMapEntry.Value = "1"
+			}
 		}
 		return haproxyMapEntry
 	}
@@ -96,6 +113,19 @@ func generateSNIPassthroughMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 	return nil
 }
 
+// generateSNIHostMismatchExemptMapEntry generates a map entry for TLS
+// terminated routes exempt from the SNI host mismatch policy.
+func generateSNIHostMismatchExemptMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
+	if len(cfg.Host) > 0 && (cfg.Termination == routev1.TLSTerminationEdge || cfg.Termination == routev1.TLSTerminationReencrypt) && cfg.AllowSNIHostMismatch {
+		return &HAProxyMapEntry{
+			Key:   templateutil.GenerateRouteRegexp(cfg.Host, cfg.Path, cfg.IsWildcard),
+			Value: "1",
+		}
+	}
+
+	return nil
+}
+
 // generateCertConfigMapEntry generates a cert config map entry.
 func generateCertConfigMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 	if len(cfg.Host) > 0 && (cfg.Termination == routev1.TLSTerminationEdge || cfg.Termination == routev1.TLSTerminationReencrypt) && cfg.HasCertificate {
@@ -111,13 +141,14 @@ func generateCertConfigMapEntry(cfg *BackendConfig) *HAProxyMapEntry {
 // GenerateMapEntry generates a haproxy map entry.
 func GenerateMapEntry(id string, cfg *BackendConfig) *HAProxyMapEntry {
 	generator, ok := map[string]mapEntryGeneratorFunc{
-		"os_wildcard_domain.map":     generateWildcardDomainMapEntry,
-		"os_http_be.map":             generateHttpMapEntry,
-		"os_edge_reencrypt_be.map":   generateEdgeReencryptMapEntry,
-		"os_route_http_redirect.map": generateHttpRedirectMapEntry,
-		"os_tcp_be.map":              generateTCPMapEntry,
-		"os_sni_passthrough.map":     generateSNIPassthroughMapEntry,
-		"cert_config.map":            generateCertConfigMapEntry,
+		"os_wildcard_domain.map":          generateWildcardDomainMapEntry,
+		"os_http_be.map":                  generateHttpMapEntry,
+		"os_edge_reencrypt_be.map":        generateEdgeReencryptMapEntry,
+		"os_route_http_redirect.map":      generateHttpRedirectMapEntry,
+		"os_tcp_be.map":                   generateTCPMapEntry,
+		"os_sni_passthrough.map":          generateSNIPassthroughMapEntry,
+		"cert_config.map":                 generateCertConfigMapEntry,
+		"os_sni_host_mismatch_exempt.map": generateSNIHostMismatchExemptMapEntry,
 	}[id]
 
 	if !ok {
@@ -888,3 +888,69 @@ func TestGenerateCertConfigMapEntry(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateSNIHostMismatchExemptMapEntry(t *testing.T) {
+	mapName := "os_sni_host_mismatch_exempt.map"
+	tests := []struct {
+		name        string
+		backendKey  string
+		hostname    string
+		path        string
+		wildcard    bool
+		exempt      bool
+		expectedKey string
+	}{
+		{
+			name:        "empty host",
+			backendKey:  "test1",
+			exempt:      true,
+			expectedKey: "",
+		},
+		{
+			name:        "host not exempt",
+			backendKey:  "test_host",
+			hostname:    "www.example.test",
+			expectedKey: "",
+		},
+		{
+			name:        "exempt host",
+			backendKey:  "test_exempt_host",
+			hostname:    "www.example.test",
+			exempt:      true,
+			expectedKey: `^www\.example\.test\.?(:[0-9]+)?(/.*)?$`,
+		},
+		{
+			name:        "exempt host with path",
+			backendKey:  "test_exempt_host_path",
+			hostname:    "www.example.test",
+			path:        "/x/y/z",
+			exempt:      true,
+			expectedKey: `^www\.example\.test\.?(:[0-9]+)?/x/y/z(/.*)?$`,
+		},
+		{
+			name:        "exempt wildcard host",
+			backendKey:  "test_exempt_wildcard_host",
+			hostname:    "www.wild.test",
+			wildcard:    true,
+			exempt:      true,
+			expectedKey: `^[^\.]*\.wild\.test\.?(:[0-9]+)?(/.*)?$`,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, termination := range getTestTerminations() {
+			name := fmt.Sprintf("%s:termination=%s", tt.name, termination)
+			cfg := testBackendConfig(tt.backendKey, tt.hostname, tt.path, tt.wildcard, termination, routev1.InsecureEdgeTerminationPolicyNone, false)
+			cfg.AllowSNIHostMismatch = tt.exempt
+
+			var expectation *HAProxyMapEntry
+			if len(tt.expectedKey) > 0 && (termination == routev1.TLSTerminationEdge || termination == routev1.TLSTerminationReencrypt) {
+				expectation = &HAProxyMapEntry{Key: tt.expectedKey, Value: "1"}
+			}
+
+			if entry := GenerateMapEntry(mapName, cfg); !reflect.DeepEqual(expectation, entry) {
+				t.Errorf("%s: expected map entry %+v, got %+v", name, expectation, entry)
+			}
+		}
+	}
+}
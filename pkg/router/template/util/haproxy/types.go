@@ -13,6 +13,16 @@ type BackendConfig struct {
 	Termination    routev1.TLSTerminationType
 	InsecurePolicy routev1.InsecureEdgeTerminationPolicyType
 	HasCertificate bool
+	// AllowSNIHostMismatch exempts the route from the SNI host mismatch
+	// policy of the router.
+	AllowSNIHostMismatch bool
+	// ActiveColor is the color suffix of the backend that receives the
+	// traffic of a route with a blue and a green backend.
+	ActiveColor string
+	// RedirectsToHost is true if the backend of the route redirects its
+	// insecure requests to a canonical host, in place of the frontend
+	// redirecting them to https on the same host.
+	RedirectsToHost bool
 }
 
 // HAProxyMapEntry is a haproxy map entry.
@@ -2,6 +2,8 @@ package haproxy
 
 import (
 	"strings"
+
+	"github.com/openshift/router/pkg/router/routeapihelpers"
 )
 
 const (
@@ -13,6 +15,10 @@ const (
 	// HAPROXY_MAX_WHITELIST_LENGTH is the maximum number of CIDRs allowed
 	// for an "acl whitelist src [<cidr>]*" config line.
 	HAPROXY_MAX_WHITELIST_LENGTH = HAPROXY_MAX_LINE_ARGS - 3
+
+	// HAPROXY_MAX_WHITELIST_ENTRIES is the maximum number of CIDRs allowed
+	// in a route whitelist, which is loaded into haproxy from a file.
+	HAPROXY_MAX_WHITELIST_ENTRIES = routeapihelpers.MaxIPWhitelistEntries
 )
 
 // ValidateWhiteList validates a haproxy acl whitelist from an annotation value.
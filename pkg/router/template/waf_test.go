@@ -0,0 +1,117 @@
+package templaterouter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/openshift/router/pkg/router/routeapihelpers"
+)
+
+func TestWAFTemplate(t *testing.T) {
+	route := func(name string, termination routev1.TLSTerminationType, waf string) *routev1.Route {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, Annotations: map[string]string{}},
+			Spec: routev1.RouteSpec{
+				Host: name + ".example.com",
+				To:   routev1.RouteTargetReference{Name: "svc"},
+			},
+		}
+		if len(waf) > 0 {
+			route.Annotations[routeapihelpers.WAFAnnotation] = waf
+		}
+		if len(termination) > 0 {
+			route.Spec.TLS = &routev1.TLSConfig{Termination: termination}
+		}
+		return route
+	}
+	routes := []*routev1.Route{
+		route("http", "", "true"),
+		route("edge", routev1.TLSTerminationEdge, "true"),
+		route("disabled", "", "false"),
+		route("default", "", ""),
+	}
+
+	render := func(waf WAFConfig) map[string]string {
+		t.Helper()
+		renderer, err := NewRenderer(RendererConfig{
+			TemplatePath: "../../../images/router/haproxy/conf/haproxy-config.template",
+			WorkingDir:   "/var/lib/haproxy",
+			BindPorts:    true,
+			WAF:          waf,
+		})
+		if err != nil {
+			t.Fatalf("unable to create the renderer: %v", err)
+		}
+		files, err := renderer.Render(renderer.RouteState(routes))
+		if err != nil {
+			t.Fatalf("unable to render: %v", err)
+		}
+		contents := map[string]string{}
+		for _, file := range files {
+			contents[file.Name] = string(file.Contents)
+		}
+		return contents
+	}
+	backend := func(config, name string) string {
+		t.Helper()
+		i := strings.Index(config, "backend "+name+"\n")
+		if i < 0 {
+			t.Fatalf("backend %s not found", name)
+		}
+		section := config[i+1:]
+		if j := strings.Index(section, "\nbackend "); j >= 0 {
+			section = section[:j]
+		}
+		return section
+	}
+
+	filter := "filter spoe engine waf config /var/lib/haproxy/conf/waf-spoe.conf"
+	failClosed := "http-request deny deny_status 503 if { var(txn.waf.error) -m int gt 0 }"
+
+	files := render(WAFConfig{AgentAddress: "waf.example.com:12345", ConnectTimeout: time.Second, ProcessingTimeout: 100 * time.Millisecond, FailClosed: true})
+	config := files["conf/haproxy.config"]
+	for _, name := range []string{"be_http:ns:http", "be_edge_http:ns:edge"} {
+		section := backend(config, name)
+		for _, expected := range []string{filter, "http-request deny deny_status 403 if { var(txn.waf.block) -m bool }", failClosed} {
+			if !strings.Contains(section, expected) {
+				t.Errorf("%s: expected %q in:\n%s", name, expected, section)
+			}
+		}
+	}
+	for _, name := range []string{"be_http:ns:disabled", "be_http:ns:default"} {
+		if section := backend(config, name); strings.Contains(section, "spoe") {
+			t.Errorf("%s: expected no SPOE filter in:\n%s", name, section)
+		}
+	}
+	agents := backend(config, "openshift_waf_agents")
+	for _, expected := range []string{"timeout connect 1000ms", "server waf waf.example.com:12345 check"} {
+		if !strings.Contains(agents, expected) {
+			t.Errorf("expected %q in the agents backend:\n%s", expected, agents)
+		}
+	}
+	spoe := files["conf/waf-spoe.conf"]
+	for _, expected := range []string{"[waf]\n", "timeout processing 100ms", "use-backend openshift_waf_agents", "event on-backend-http-request"} {
+		if !strings.Contains(spoe, expected) {
+			t.Errorf("expected %q in the SPOE configuration:\n%s", expected, spoe)
+		}
+	}
+
+	// Requests the agent fails to process are forwarded when failing open.
+	files = render(WAFConfig{AgentAddress: "waf.example.com:12345", ConnectTimeout: time.Second, ProcessingTimeout: 100 * time.Millisecond})
+	if section := backend(files["conf/haproxy.config"], "be_http:ns:http"); !strings.Contains(section, filter) || strings.Contains(section, failClosed) {
+		t.Errorf("expected the filter without the fail closed rule in:\n%s", section)
+	}
+
+	// The annotation has no effect without an agent.
+	files = render(WAFConfig{})
+	if config := files["conf/haproxy.config"]; strings.Contains(config, "spoe") || strings.Contains(config, "openshift_waf_agents") {
+		t.Errorf("expected no SPOE configuration without an agent")
+	}
+	if spoe := files["conf/waf-spoe.conf"]; len(strings.TrimSpace(spoe)) > 0 {
+		t.Errorf("expected an empty SPOE configuration without an agent, got:\n%s", spoe)
+	}
+}
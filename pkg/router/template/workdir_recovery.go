@@ -0,0 +1,60 @@
+package templaterouter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempFileSuffix is the suffix of the files the router writes before
+// renaming them in place.  A file with the suffix was left behind by a
+// router that stopped while writing it.
+const tempFileSuffix = ".tmp"
+
+// removeTempFiles removes the partially written files left behind in the
+// working directory dir by a router that stopped while writing them.
+func removeTempFiles(dir string) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), tempFileSuffix) {
+			log.V(0).Info("removing partially written file", "file", path)
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// reconcileCertificates rebuilds the certificate directories from the
+// router state alone: the certificates of the routes are written again,
+// whether or not they were written before, and the files of the routes the
+// router no longer has, or of a previous router, are removed.
+func (r *templateRouter) reconcileCertificates() error {
+	var configs []*ServiceAliasConfig
+	for k := range r.state {
+		cfg := r.state[k]
+		cfg.Status = ""
+		if r.shouldWriteCerts(&cfg) {
+			configs = append(configs, &cfg)
+		}
+	}
+	keep := []string{filepath.Join(r.dir, certDir, defaultCertName+".pem")}
+	if len(r.defaultCertificatePath) > 0 {
+		keep = append(keep, r.defaultCertificatePath)
+	}
+	if err := r.certManager.ReconcileCertificates(configs, keep); err != nil {
+		return err
+	}
+	r.certificatesReconciled = true
+	return nil
+}
@@ -0,0 +1,124 @@
+package templaterouter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestRemoveTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]bool{
+		"run/haproxy.state.tmp":       false,
+		"run/haproxy.state":           true,
+		"router/tls-ticket-keys.tmp":  false,
+		"conf/haproxy.config":         true,
+		"router/certs/www.tmp.pem":    true,
+		"router/cacerts/partial.tmp":  false,
+		"conf/os_http_be.map":         true,
+		"router/certs/default.pem":    true,
+		"router/cacerts/ns:route.pem": true,
+	}
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeTempFiles(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, kept := range files {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s: expected kept %t, got %v", name, kept, err)
+		}
+	}
+
+	if err := removeTempFiles(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("expected no error for a missing working directory, got %v", err)
+	}
+}
+
+func TestReconcileCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certManager, err := newSimpleCertificateManager(&certificateManagerConfig{
+		certKeyFunc:     generateCertKey,
+		caCertKeyFunc:   generateCACertKey,
+		destCertKeyFunc: generateDestCertKey,
+		certDir:         filepath.Join(dir, certDir),
+		caCertDir:       filepath.Join(dir, caCertDir),
+	}, newSimpleCertificateWriter())
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("stale"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("router/certs/default.pem")
+	write("router/certs/ns:deleted.pem")
+	write("router/cacerts/ns:deleted.pem")
+	write("router/certs/ns:edge.pem")
+
+	router := &templateRouter{
+		dir:         dir,
+		certManager: certManager,
+		synced:      true,
+		state: map[ServiceAliasConfigKey]ServiceAliasConfig{
+			"ns:edge": {
+				Host:           "edge.example.com",
+				TLSTermination: routev1.TLSTerminationEdge,
+				Status:         ServiceAliasConfigStatusSaved,
+				Certificates: map[string]Certificate{
+					"edge.example.com": {ID: "ns:edge", Contents: "cert", PrivateKey: "key"},
+				},
+			},
+			"ns:reencrypt": {
+				Host:           "reencrypt.example.com",
+				TLSTermination: routev1.TLSTerminationReencrypt,
+				Status:         ServiceAliasConfigStatusSaved,
+				Certificates: map[string]Certificate{
+					"reencrypt.example.com" + destCertPostfix: {ID: "ns:reencrypt", Contents: "ca"},
+				},
+			},
+		},
+	}
+	if err := router.reconcileCertificates(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !router.certificatesReconciled {
+		t.Errorf("expected the certificates to be reconciled")
+	}
+
+	expected := map[string]string{
+		"router/certs/default.pem":        "stale",
+		"router/certs/ns:edge.pem":        "key\ncert",
+		"router/cacerts/ns:reencrypt.pem": "ca",
+		"router/certs/ns:deleted.pem":     "",
+		"router/cacerts/ns:deleted.pem":   "",
+	}
+	for name, contents := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if len(contents) == 0 {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s: expected the orphaned certificate to be removed, got %v", name, err)
+			}
+			continue
+		}
+		if err != nil || string(data) != contents {
+			t.Errorf("%s: expected %q, got %q and error %v", name, contents, data, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package testing
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/yaml"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+// baseTime is the creation time of the routes of the fixtures that do not
+// set one.
+var baseTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Scenario is a sequence of watch events sent to a plugin chain, and the
+// state of the router expected after them.
+type Scenario struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// Step sends a watch event for a route or endpoints to the plugin chain,
+// and if it expects a state, commits and checks the state of the router.
+type Step struct {
+	// Event is ADDED, MODIFIED or DELETED.
+	Event     watch.EventType   `json:"event"`
+	Route     *RouteFixture     `json:"route,omitempty"`
+	Endpoints *EndpointsFixture `json:"endpoints,omitempty"`
+	Expect    *State            `json:"expect,omitempty"`
+}
+
+// RouteFixture is a compact description of a route.
+type RouteFixture struct {
+	// Name is the namespace/name of the route.
+	Name string `json:"name"`
+	// UID is the UID of the route, its namespace/name if not set.
+	UID  string `json:"uid,omitempty"`
+	Host string `json:"host,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Created is the creation time of the route, as an offset from a base
+	// time such as "-1h" for a route an hour older.
+	Created string `json:"created,omitempty"`
+	// Service is the name of the service of the route, and Weight its
+	// weight.
+	Service string `json:"service"`
+	Weight  *int32 `json:"weight,omitempty"`
+	// AlternateBackends are the other services of the route, as
+	// name=weight.
+	AlternateBackends []string `json:"alternateBackends,omitempty"`
+	// TargetPort is the name or number of the target port of the route.
+	TargetPort string `json:"targetPort,omitempty"`
+	// Termination is the TLS termination of the route, if any.
+	Termination                   routev1.TLSTerminationType                `json:"termination,omitempty"`
+	InsecureEdgeTerminationPolicy routev1.InsecureEdgeTerminationPolicyType `json:"insecureEdgeTerminationPolicy,omitempty"`
+	Annotations                   map[string]string                         `json:"annotations,omitempty"`
+	Labels                        map[string]string                         `json:"labels,omitempty"`
+}
+
+// EndpointsFixture is a compact description of the endpoints of a service.
+type EndpointsFixture struct {
+	// Name is the namespace/name of the service.
+	Name    string          `json:"name"`
+	Subsets []SubsetFixture `json:"subsets,omitempty"`
+}
+
+// SubsetFixture is a compact description of an endpoint subset.
+type SubsetFixture struct {
+	// Addresses are the IP addresses of the ready endpoints, as ip or
+	// ip@pod for the endpoints of pods.
+	Addresses []string `json:"addresses,omitempty"`
+	// NotReadyAddresses are the IP addresses of the endpoints that are not
+	// ready, as Addresses.
+	NotReadyAddresses []string `json:"notReadyAddresses,omitempty"`
+	// Ports are the ports of the subset, as
+	// [name=]port[/protocol][@appProtocol].
+	Ports []string `json:"ports,omitempty"`
+}
+
+// State is the state of the router a harness observes, or a scenario
+// expects.  The sections that are nil are not checked, so that a scenario
+// can be shared by harnesses that observe different parts of the router.
+type State struct {
+	// Routes are the host and path of the routes the router exposes,
+	// keyed by namespace/name.
+	Routes map[string]string `json:"routes,omitempty"`
+	// ServiceUnits are the namespace/name of the services the router
+	// tracks.
+	ServiceUnits []string `json:"serviceUnits,omitempty"`
+	// Rejections are the rejections recorded since the last step that
+	// expected a state, as reason: message keyed by the namespace/name of
+	// the route.
+	Rejections map[string]string `json:"rejections,omitempty"`
+}
+
+// LoadScenarios reads the scenarios of a YAML file.
+func LoadScenarios(path string) ([]Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenarios []Scenario
+	if err := yaml.UnmarshalStrict(data, &scenarios); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return scenarios, nil
+}
+
+// splitName returns the namespace and name of namespace/name.
+func splitName(key string) (string, string, error) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", fmt.Errorf("%q is not namespace/name", key)
+	}
+	return parts[0], parts[1], nil
+}
+
+// Route returns the route the fixture describes.
+func (f *RouteFixture) Route() (*routev1.Route, error) {
+	namespace, name, err := splitName(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	created := baseTime
+	if len(f.Created) > 0 {
+		offset, err := time.ParseDuration(f.Created)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: invalid creation offset: %v", f.Name, err)
+		}
+		created = created.Add(offset)
+	}
+	uid := f.UID
+	if len(uid) == 0 {
+		uid = f.Name
+	}
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			UID:               types.UID(uid),
+			CreationTimestamp: metav1.Time{Time: created},
+			Annotations:       f.Annotations,
+			Labels:            f.Labels,
+		},
+		Spec: routev1.RouteSpec{
+			Host: f.Host,
+			Path: f.Path,
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: f.Service, Weight: f.Weight},
+		},
+	}
+	for _, backend := range f.AlternateBackends {
+		parts := strings.SplitN(backend, "=", 2)
+		ref := routev1.RouteTargetReference{Kind: "Service", Name: parts[0]}
+		if len(parts) == 2 {
+			weight, err := strconv.ParseInt(parts[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid weight of backend %s: %v", f.Name, backend, err)
+			}
+			w := int32(weight)
+			ref.Weight = &w
+		}
+		route.Spec.AlternateBackends = append(route.Spec.AlternateBackends, ref)
+	}
+	if len(f.TargetPort) > 0 {
+		route.Spec.Port = &routev1.RoutePort{TargetPort: intstr.Parse(f.TargetPort)}
+	}
+	if len(f.Termination) > 0 {
+		route.Spec.TLS = &routev1.TLSConfig{Termination: f.Termination, InsecureEdgeTerminationPolicy: f.InsecureEdgeTerminationPolicy}
+	}
+	return route, nil
+}
+
+// Endpoints returns the endpoints the fixture describes.
+func (f *EndpointsFixture) Endpoints() (*kapi.Endpoints, error) {
+	namespace, name, err := splitName(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := &kapi.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	for _, s := range f.Subsets {
+		subset := kapi.EndpointSubset{
+			Addresses:         endpointAddresses(s.Addresses),
+			NotReadyAddresses: endpointAddresses(s.NotReadyAddresses),
+		}
+		for _, p := range s.Ports {
+			port, err := endpointPort(p)
+			if err != nil {
+				return nil, fmt.Errorf("endpoints %s: %v", f.Name, err)
+			}
+			subset.Ports = append(subset.Ports, port)
+		}
+		endpoints.Subsets = append(endpoints.Subsets, subset)
+	}
+	return endpoints, nil
+}
+
+// endpointAddresses returns the endpoint addresses of ip or ip@pod values.
+func endpointAddresses(values []string) []kapi.EndpointAddress {
+	var addresses []kapi.EndpointAddress
+	for _, value := range values {
+		parts := strings.SplitN(value, "@", 2)
+		address := kapi.EndpointAddress{IP: parts[0]}
+		if len(parts) == 2 {
+			address.TargetRef = &kapi.ObjectReference{Kind: "Pod", Name: parts[1]}
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// endpointPort returns the endpoint port of a
+// [name=]port[/protocol][@appProtocol] value.
+func endpointPort(value string) (kapi.EndpointPort, error) {
+	port := kapi.EndpointPort{Protocol: kapi.ProtocolTCP}
+	if i := strings.Index(value, "@"); i >= 0 {
+		appProtocol := value[i+1:]
+		port.AppProtocol, value = &appProtocol, value[:i]
+	}
+	if i := strings.Index(value, "="); i >= 0 {
+		port.Name, value = value[:i], value[i+1:]
+	}
+	if i := strings.Index(value, "/"); i >= 0 {
+		port.Protocol, value = kapi.Protocol(value[i+1:]), value[:i]
+	}
+	number, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return port, fmt.Errorf("invalid port %q", value)
+	}
+	port.Port = int32(number)
+	return port, nil
+}
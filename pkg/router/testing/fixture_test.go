@@ -0,0 +1,171 @@
+package testing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	kapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	routev1 "github.com/openshift/api/route/v1"
+)
+
+func TestRouteFixture(t *testing.T) {
+	weight := int32(0)
+	fixture := RouteFixture{
+		Name:              "foo/test",
+		Host:              "www.example.com",
+		Path:              "/api",
+		Created:           "-1h",
+		Service:           "svc",
+		Weight:            &weight,
+		AlternateBackends: []string{"other=20", "third"},
+		TargetPort:        "http",
+		Termination:       routev1.TLSTerminationEdge,
+	}
+	route, err := fixture.Route()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := int32(20)
+	expected := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "foo",
+			Name:              "test",
+			UID:               "foo/test",
+			CreationTimestamp: metav1.Time{Time: baseTime.Add(-time.Hour)},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "www.example.com",
+			Path: "/api",
+			To:   routev1.RouteTargetReference{Kind: "Service", Name: "svc", Weight: &weight},
+			AlternateBackends: []routev1.RouteTargetReference{
+				{Kind: "Service", Name: "other", Weight: &other},
+				{Kind: "Service", Name: "third"},
+			},
+			Port: &routev1.RoutePort{TargetPort: intstr.FromString("http")},
+			TLS:  &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge},
+		},
+	}
+	if !reflect.DeepEqual(route, expected) {
+		t.Errorf("expected %#v, got %#v", expected, route)
+	}
+
+	for _, invalid := range []RouteFixture{
+		{Name: "test", Service: "svc"},
+		{Name: "foo/test", Service: "svc", Created: "yesterday"},
+		{Name: "foo/test", Service: "svc", AlternateBackends: []string{"other=heavy"}},
+	} {
+		if _, err := invalid.Route(); err == nil {
+			t.Errorf("expected an error for %#v", invalid)
+		}
+	}
+}
+
+func TestEndpointsFixture(t *testing.T) {
+	fixture := EndpointsFixture{
+		Name: "foo/svc",
+		Subsets: []SubsetFixture{{
+			Addresses:         []string{"10.0.0.1@pod-1", "10.0.0.2"},
+			NotReadyAddresses: []string{"10.0.0.3"},
+			Ports:             []string{"http=8080", "53/UDP", "grpc=9090@grpc"},
+		}},
+	}
+	endpoints, err := fixture.Endpoints()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	grpc := "grpc"
+	expected := &kapi.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "foo", Name: "svc"},
+		Subsets: []kapi.EndpointSubset{{
+			Addresses: []kapi.EndpointAddress{
+				{IP: "10.0.0.1", TargetRef: &kapi.ObjectReference{Kind: "Pod", Name: "pod-1"}},
+				{IP: "10.0.0.2"},
+			},
+			NotReadyAddresses: []kapi.EndpointAddress{{IP: "10.0.0.3"}},
+			Ports: []kapi.EndpointPort{
+				{Name: "http", Port: 8080, Protocol: kapi.ProtocolTCP},
+				{Port: 53, Protocol: kapi.ProtocolUDP},
+				{Name: "grpc", Port: 9090, Protocol: kapi.ProtocolTCP, AppProtocol: &grpc},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("expected %#v, got %#v", expected, endpoints)
+	}
+
+	fixture.Subsets[0].Ports = []string{"http=web"}
+	if _, err := fixture.Endpoints(); err == nil {
+		t.Errorf("expected an error for an invalid port")
+	}
+}
+
+func TestLoadScenarios(t *testing.T) {
+	scenarios, err := LoadScenarios("testdata/unique_host.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scenarios) == 0 || len(scenarios[0].Steps) == 0 || scenarios[0].Steps[0].Route == nil {
+		t.Errorf("expected the scenarios to have steps: %#v", scenarios)
+	}
+}
+
+func TestLoadRenderCases(t *testing.T) {
+	cases, err := LoadRenderCases("testdata/render.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range cases {
+		if len(c.Routes) == 0 || len(c.Expect) == 0 {
+			t.Errorf("expected the case to have routes and expectations: %#v", c)
+		}
+	}
+}
+
+func TestSectionExpectation(t *testing.T) {
+	files := map[string]string{
+		"conf/haproxy.config": "global\n  maxconn 100\n\nbackend be_http:ns:a\n  mode http\n\n  server a 10.0.0.1:8080\nbackend be_http:ns:b\n  mode tcp\n",
+		"conf/os_http_be.map": "^a\\.example\\.com$ be_http:ns:a\n",
+	}
+	tests := []struct {
+		name        string
+		expectation SectionExpectation
+		problems    int
+	}{
+		{
+			name:        "section",
+			expectation: SectionExpectation{Section: "backend be_http:ns:a", Contains: []string{"  mode http\n", "10.0.0.1"}, Excludes: []string{"mode tcp"}},
+		},
+		{
+			name:        "whole file",
+			expectation: SectionExpectation{Contains: []string{"maxconn 100", "mode tcp"}},
+		},
+		{
+			name:        "other file",
+			expectation: SectionExpectation{File: "conf/os_http_be.map", Contains: []string{"be_http:ns:a"}, Excludes: []string{"be_http:ns:b"}},
+		},
+		{
+			name:        "unexpected content",
+			expectation: SectionExpectation{Section: "backend be_http:ns:b", Contains: []string{"mode http"}, Excludes: []string{"mode tcp"}},
+			problems:    2,
+		},
+		{
+			name:        "missing section",
+			expectation: SectionExpectation{Section: "backend be_http:ns:c"},
+			problems:    1,
+		},
+		{
+			name:        "missing file",
+			expectation: SectionExpectation{File: "conf/os_tcp_be.map"},
+			problems:    1,
+		},
+	}
+	for _, tc := range tests {
+		if problems := tc.expectation.Check(files); len(problems) != tc.problems {
+			t.Errorf("%s: expected %d problems, got %q", tc.name, tc.problems, problems)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package testing
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/router/pkg/router"
+)
+
+// Harness is a plugin chain under test.
+type Harness struct {
+	// Plugin is the first plugin of the chain.
+	Plugin router.Plugin
+	// Rejections records the routes the chain rejects, if the harness
+	// observes them.
+	Rejections *RejectionRecorder
+	// Observe returns the routes and service units of the router.
+	Observe func() State
+}
+
+// RunScenario sends the watch events of a scenario to the plugin chain of a
+// harness and checks the states the scenario expects.
+func RunScenario(t *testing.T, scenario Scenario, h Harness) {
+	t.Helper()
+	for i, step := range scenario.Steps {
+		switch {
+		case step.Route != nil:
+			route, err := step.Route.Route()
+			if err != nil {
+				t.Fatalf("%s: step %d: %v", scenario.Name, i, err)
+			}
+			if err := h.Plugin.HandleRoute(step.Event, route); err != nil {
+				t.Fatalf("%s: step %d: unexpected error handling route %s: %v", scenario.Name, i, step.Route.Name, err)
+			}
+		case step.Endpoints != nil:
+			endpoints, err := step.Endpoints.Endpoints()
+			if err != nil {
+				t.Fatalf("%s: step %d: %v", scenario.Name, i, err)
+			}
+			if err := h.Plugin.HandleEndpoints(step.Event, endpoints); err != nil {
+				t.Fatalf("%s: step %d: unexpected error handling endpoints %s: %v", scenario.Name, i, step.Endpoints.Name, err)
+			}
+		}
+		if step.Expect == nil {
+			continue
+		}
+
+		if err := h.Plugin.Commit(); err != nil {
+			t.Fatalf("%s: step %d: unexpected error committing: %v", scenario.Name, i, err)
+		}
+		observed := State{}
+		if h.Observe != nil {
+			observed = h.Observe()
+		}
+		if h.Rejections != nil {
+			observed.Rejections = h.Rejections.take()
+		}
+		checkState(t, scenario.Name, i, *step.Expect, observed)
+	}
+}
+
+// checkState checks the sections of a state a harness observes against the
+// expected ones.
+func checkState(t *testing.T, name string, step int, expected, observed State) {
+	t.Helper()
+	if expected.Routes != nil && observed.Routes != nil && !reflect.DeepEqual(expected.Routes, observed.Routes) {
+		t.Errorf("%s: step %d: expected the routes %v, got %v", name, step, expected.Routes, observed.Routes)
+	}
+	if expected.ServiceUnits != nil && observed.ServiceUnits != nil {
+		want, got := sets.NewString(expected.ServiceUnits...), sets.NewString(observed.ServiceUnits...)
+		if !want.Equal(got) {
+			t.Errorf("%s: step %d: expected the service units %v, got %v", name, step, want.List(), got.List())
+		}
+	}
+	if expected.Rejections != nil && observed.Rejections != nil && !reflect.DeepEqual(expected.Rejections, observed.Rejections) {
+		t.Errorf("%s: step %d: expected the rejections %v, got %v", name, step, expected.Rejections, observed.Rejections)
+	}
+}
+
+// RejectionRecorder records the rejections of routes for a harness.
+type RejectionRecorder struct {
+	lock       sync.Mutex
+	rejections map[string]string
+}
+
+// NewRejectionRecorder returns a recorder without rejections.
+func NewRejectionRecorder() *RejectionRecorder {
+	return &RejectionRecorder{rejections: map[string]string{}}
+}
+
+// RecordRouteRejection records the rejection of a route.
+func (r *RejectionRecorder) RecordRouteRejection(route *routev1.Route, reason, message string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.rejections[route.Namespace+"/"+route.Name] = reason + ": " + message
+}
+
+// take returns the rejections recorded since it was last called.
+func (r *RejectionRecorder) take() map[string]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rejections := r.rejections
+	r.rejections = map[string]string{}
+	return rejections
+}
+
+// RoutePlugin is the last plugin of a chain under test, which records the
+// routes the chain passes on, for the harnesses of the plugins that do not
+// keep the state of the router.
+type RoutePlugin struct {
+	lock     sync.Mutex
+	routes   map[string]string
+	services sets.String
+}
+
+var _ router.Plugin = &RoutePlugin{}
+
+// NewRoutePlugin returns a plugin without routes.
+func NewRoutePlugin() *RoutePlugin {
+	return &RoutePlugin{routes: map[string]string{}, services: sets.NewString()}
+}
+
+// HandleRoute records the host and path of an added or modified route, and
+// forgets a deleted one.
+func (p *RoutePlugin) HandleRoute(eventType watch.EventType, route *routev1.Route) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	key := route.Namespace + "/" + route.Name
+	if eventType == watch.Deleted {
+		delete(p.routes, key)
+		return nil
+	}
+	p.routes[key] = route.Spec.Host + route.Spec.Path
+	p.services.Insert(route.Namespace + "/" + route.Spec.To.Name)
+	for _, backend := range route.Spec.AlternateBackends {
+		p.services.Insert(route.Namespace + "/" + backend.Name)
+	}
+	return nil
+}
+
+// HandleEndpoints records the service of endpoints.
+func (p *RoutePlugin) HandleEndpoints(eventType watch.EventType, endpoints *kapi.Endpoints) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.services.Insert(endpoints.Namespace + "/" + endpoints.Name)
+	return nil
+}
+
+func (p *RoutePlugin) HandleNamespaces(namespaces sets.String) error {
+	return nil
+}
+
+func (p *RoutePlugin) HandleNode(eventType watch.EventType, node *kapi.Node) error {
+	return nil
+}
+
+func (p *RoutePlugin) Commit() error {
+	return nil
+}
+
+// State returns the routes and services the plugin recorded.  As the
+// template router, the plugin keeps tracking the services of deleted
+// routes.
+func (p *RoutePlugin) State() State {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	routes := make(map[string]string, len(p.routes))
+	for key, route := range p.routes {
+		routes[key] = route
+	}
+	return State{Routes: routes, ServiceUnits: p.services.List()}
+}
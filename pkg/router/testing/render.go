@@ -0,0 +1,121 @@
+package testing
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// RenderCase is a set of routes and endpoints rendered by the router
+// template, and the configuration expected from it.
+type RenderCase struct {
+	Name string `json:"name"`
+	// Env are the environment variables the router reads its defaults
+	// from while rendering.
+	Env       map[string]string    `json:"env,omitempty"`
+	Config    RenderConfig         `json:"config,omitempty"`
+	Routes    []RouteFixture       `json:"routes"`
+	Endpoints []EndpointsFixture   `json:"endpoints,omitempty"`
+	Expect    []SectionExpectation `json:"expect"`
+}
+
+// RenderConfig is the part of the configuration of a router that routes
+// cannot override and that is not read from the environment.
+type RenderConfig struct {
+	// SetForwardedHeaders is the router wide policy for the forwarded
+	// headers.
+	SetForwardedHeaders string `json:"setForwardedHeaders,omitempty"`
+	// ResponseHeaderPolicy is the router wide response header policy, in
+	// the syntax of its configuration file.
+	ResponseHeaderPolicy string `json:"responseHeaderPolicy,omitempty"`
+	// HTTPCompatOptions are the HTTP/1 compatibility options the routes
+	// may enable.
+	HTTPCompatOptions []string `json:"httpCompatOptions,omitempty"`
+	// HTTPHeaderNameCaseAdjustments are the header names whose case is
+	// restored for the routes that adjust it.
+	HTTPHeaderNameCaseAdjustments []string `json:"httpHeaderNameCaseAdjustments,omitempty"`
+}
+
+// SectionExpectation is the content expected in a section of a rendered
+// file.
+type SectionExpectation struct {
+	// File is the name of the rendered file, conf/haproxy.config if not
+	// set.
+	File string `json:"file,omitempty"`
+	// Section is the header line of the section, such as
+	// "backend be_http:ns:app", or the whole file if not set.
+	Section string `json:"section,omitempty"`
+	// Contains and Excludes are the text expected and not expected in the
+	// section.
+	Contains []string `json:"contains,omitempty"`
+	Excludes []string `json:"excludes,omitempty"`
+}
+
+// LoadRenderCases reads the render cases of a YAML file.
+func LoadRenderCases(path string) ([]RenderCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []RenderCase
+	if err := yaml.UnmarshalStrict(data, &cases); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+	}
+	return cases, nil
+}
+
+// Check returns the problems with the content of a rendered file, for the
+// file contents keyed by name.
+func (e *SectionExpectation) Check(files map[string]string) []string {
+	name := e.File
+	if len(name) == 0 {
+		name = "conf/haproxy.config"
+	}
+	contents, ok := files[name]
+	if !ok {
+		return []string{fmt.Sprintf("%s not rendered", name)}
+	}
+	where := name
+	if len(e.Section) > 0 {
+		section, ok := Section(contents, e.Section)
+		if !ok {
+			return []string{fmt.Sprintf("%s: %q not found", name, e.Section)}
+		}
+		contents, where = section, e.Section
+	}
+
+	var problems []string
+	for _, s := range e.Contains {
+		if !strings.Contains(contents, s) {
+			problems = append(problems, fmt.Sprintf("%s: expected %q in:\n%s", where, s, contents))
+		}
+	}
+	for _, s := range e.Excludes {
+		if strings.Contains(contents, s) {
+			problems = append(problems, fmt.Sprintf("%s: expected no %q in:\n%s", where, s, contents))
+		}
+	}
+	return problems
+}
+
+// Section returns the lines of an haproxy configuration from a header line
+// up to the next line that is not indented.
+func Section(config, header string) (string, bool) {
+	lines := strings.SplitAfter(config, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != header {
+			continue
+		}
+		section := []string{line}
+		for _, line := range lines[i+1:] {
+			if len(line) > 0 && line[0] != ' ' && line[0] != '\n' {
+				break
+			}
+			section = append(section, line)
+		}
+		return strings.Join(section, ""), true
+	}
+	return "", false
+}